@@ -0,0 +1,53 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+
+	"mastogon/internal/db"
+	"mastogon/internal/service"
+
+	"github.com/spf13/cobra"
+)
+
+var backfillCmd = &cobra.Command{
+	Use:   "backfill",
+	Short: "Fetch the recent activities of a remote actor from their outbox",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		actor, _ := cmd.Flags().GetString("actor")
+		actorIRI, err := url.Parse(actor)
+		if err != nil || !actorIRI.IsAbs() {
+			return errors.New("--actor must be the IRI of a remote actor")
+		}
+		limit, _ := cmd.Flags().GetInt("limit")
+		if limit < 1 {
+			return errors.New("--limit must be positive")
+		}
+		hostname, _ := cmd.Flags().GetString("hostname")
+		db := &db.DB{}
+		db.Construct(&sync.Map{}, hostname)
+		s := &service.Service{}
+		s.Construct(db, service.DefaultConfig())
+		stored, err := s.Backfill(context.Background(), nil, actorIRI, limit)
+		out := cmd.OutOrStdout()
+		for _, id := range stored {
+			fmt.Fprintln(out, id)
+		}
+		fmt.Fprintf(out, "fetched %d activities\n", len(stored))
+		return err
+	},
+}
+
+func init() {
+	backfillCmd.Flags().String("actor", "", "the IRI of the remote actor to backfill")
+	backfillCmd.Flags().Int("limit", 20, "the most activities to fetch")
+	backfillCmd.Flags().String("hostname", "localhost", "the domain our actors live on")
+	backfillCmd.MarkFlagRequired("actor")
+	rootCmd.AddCommand(backfillCmd)
+}
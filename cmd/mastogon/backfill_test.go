@@ -0,0 +1,23 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBackfillFlags(t *testing.T) {
+	for _, test := range []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"backfill", "--actor", "bob", "--limit", "20"}, "--actor must be the IRI"},
+		{[]string{"backfill", "--actor", "https://remote.test/users/bob", "--limit", "0"}, "--limit must be positive"},
+	} {
+		if _, err := run(t, test.args...); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%v: %v, want %q", test.args, err, test.err)
+		}
+	}
+}
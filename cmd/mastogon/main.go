@@ -4,12 +4,21 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"mastogon/internal/api"
+	"mastogon/internal/config"
 	"mastogon/internal/db"
 	"mastogon/internal/service"
-	"sync"
 
-	"github.com/go-fed/activity/pub"
 	"github.com/spf13/cobra"
 )
 
@@ -17,15 +26,174 @@ var rootCmd = &cobra.Command{
 	Use:   "mastogon",
 	Short: "Mastodon but in Go, basically. ActivityPub! Fediverse!",
 	Long:  `Long description`,
-	Run: func(cmd *cobra.Command, args []string) {
+}
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve ActivityPub and the Mastodon client API",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		path, _ := flags.GetString("config")
+		load := config.Load
+		if flags.Changed("secure-mode") {
+			secure, _ := flags.GetBool("secure-mode")
+			load = func(path string) (config.Config, error) {
+				return config.LoadSecureMode(path, secure)
+			}
+		}
+		conf, err := load(path)
+		if err != nil {
+			return err
+		}
+		// Flags given take precedence over the file and environment.
+		if flags.Changed("hostname") {
+			conf.Hostname, _ = flags.GetString("hostname")
+		}
+		if flags.Changed("alias") {
+			conf.Aliases, _ = flags.GetStringSlice("alias")
+		}
+		if flags.Changed("listen") {
+			conf.Listen, _ = flags.GetString("listen")
+		}
+		if flags.Changed("grace-period") {
+			conf.GracePeriod, _ = flags.GetDuration("grace-period")
+		}
+		if flags.Changed("pending-deliveries") {
+			conf.PendingDeliveries, _ = flags.GetString("pending-deliveries")
+		}
+		if flags.Changed("account-domain") {
+			conf.Instance.AccountDomain, _ = flags.GetString("account-domain")
+		}
+		if flags.Changed("title") {
+			conf.Instance.Title, _ = flags.GetString("title")
+		}
+		if flags.Changed("description") {
+			conf.Instance.Description, _ = flags.GetString("description")
+		}
+		if flags.Changed("contact-email") {
+			conf.Instance.ContactEmail, _ = flags.GetString("contact-email")
+		}
+		if flags.Changed("contact-username") {
+			conf.Instance.ContactUsername, _ = flags.GetString("contact-username")
+		}
+		if flags.Changed("registrations") {
+			conf.Instance.Registrations, _ = flags.GetBool("registrations")
+		}
+		if flags.Changed("admin") {
+			conf.Instance.Admins, _ = flags.GetStringSlice("admin")
+		}
+		if flags.Changed("max-note-chars") {
+			conf.Instance.MaxNoteChars, _ = flags.GetInt("max-note-chars")
+		}
+		if flags.Changed("language") {
+			conf.Instance.Language, _ = flags.GetString("language")
+		}
+		if flags.Changed("timezone") {
+			conf.Instance.TimeZone, _ = flags.GetString("timezone")
+		}
+		if flags.Changed("key-type") {
+			conf.Federation.KeyType, _ = flags.GetString("key-type")
+		}
+		if flags.Changed("signature-style") {
+			conf.Federation.SignatureStyle, _ = flags.GetString("signature-style")
+		}
+		if flags.Changed("authorized-fetch") {
+			conf.Federation.AuthorizedFetch, _ = flags.GetBool("authorized-fetch")
+		}
+		if err := conf.Validate(); err != nil {
+			return err
+		}
+		db := &db.DB{}
+		db.Construct(&sync.Map{}, conf.Hostname, conf.Aliases...)
+		db.SetIDGenerator(conf.IDGenerator())
 		s := &service.Service{}
-		db := db.DB{}
-		db.Construct(&sync.Map{}, &sync.Map{}, "localhost")
-		actor := pub.NewFederatingActor(s, s, db, s)
+		s.Construct(db, conf.Service())
+		a := &api.API{}
+		a.Construct(s, db)
+
+		if conf.PendingDeliveries != "" {
+			pending, err := loadPending(conf.PendingDeliveries)
+			if err != nil {
+				return fmt.Errorf("reading pending deliveries: %w", err)
+			}
+			db.SavePendingDeliveries(pending)
+		}
+		s.StartDelivery()
+		if conf.Features.Trends {
+			s.StartTrends()
+		}
+		if conf.Features.ScheduledStatuses {
+			s.StartScheduler()
+		}
+		s.StartJobs()
+
+		mux := http.NewServeMux()
+		mux.Handle("/api/", a)
+		mux.Handle("/", s)
+		srv := &http.Server{Addr: conf.Listen, Handler: mux}
+
+		// On SIGINT or SIGTERM, stop taking requests and give deliveries
+		// the grace period to go out.
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		errs := make(chan error, 1)
+		go func() { errs <- srv.ListenAndServe() }()
+		select {
+		case err := <-errs:
+			return err
+		case <-stop:
+		}
+		// Stop taking requests first, so nothing more comes in to deliver
+		// while the queue drains.
+		c, cancel := context.WithTimeout(context.Background(), conf.GracePeriod)
+		defer cancel()
+		err = srv.Shutdown(c)
+		drain, cancelDrain := context.WithTimeout(context.Background(), conf.GracePeriod)
+		defer cancelDrain()
+		if err := s.Shutdown(drain); err != nil {
+			log.Printf("shutting down with undelivered activities: %s", err)
+		}
+		left := s.TakeUndelivered()
+		switch {
+		case len(left) == 0:
+		case conf.PendingDeliveries == "":
+			log.Printf("dropping %d undelivered activities, with no pending_deliveries file to keep them in", len(left))
+		default:
+			if err := savePending(conf.PendingDeliveries, left); err != nil {
+				log.Printf("dropping %d undelivered activities: %s", len(left), err)
+			} else {
+				log.Printf("kept %d undelivered activities in %s for the next start", len(left), conf.PendingDeliveries)
+			}
+		}
+		return err
 	},
 }
 
-func main() {
+func init() {
+	serveCmd.Flags().String("config", "", "a YAML file to read settings from, which MASTOGON_ environment variables override")
+	serveCmd.Flags().String("hostname", "localhost", "the domain our actors live on")
+	serveCmd.Flags().String("account-domain", "", "the domain in our users' handles, if not --hostname")
+	serveCmd.Flags().StringSlice("alias", nil, "other domains we also serve")
+	serveCmd.Flags().String("listen", ":8080", "the address to listen on")
+	serveCmd.Flags().Duration("grace-period", 30*time.Second, "how long to let deliveries finish when shutting down")
+	serveCmd.Flags().String("pending-deliveries", "pending-deliveries.json", "a file to keep what's undelivered at shutdown in, for the next start")
+	serveCmd.Flags().String("title", service.DefaultConfig().Title, "the name of the instance")
+	serveCmd.Flags().String("description", "", "a description of the instance")
+	serveCmd.Flags().String("contact-email", "", "where people can reach the operators")
+	serveCmd.Flags().String("contact-username", "", "the local account to present as the contact")
+	serveCmd.Flags().Bool("registrations", false, "whether anyone may sign up")
+	serveCmd.Flags().StringSlice("admin", nil, "local usernames allowed to moderate")
+	serveCmd.Flags().String("language", service.DefaultConfig().DefaultLanguage, "the language of notes that don't say")
+	serveCmd.Flags().String("timezone", "", "the time zone to show times in, such as Europe/Paris")
+	serveCmd.Flags().String("key-type", service.DefaultConfig().KeyType, "the kind of key new users sign with: rsa or ed25519")
+	serveCmd.Flags().String("signature-style", service.DefaultConfig().SignatureStyle, "how to sign requests to peers first: cavage or rfc9421")
+	serveCmd.Flags().Bool("secure-mode", false, "start from cautious defaults: signed fetches only, recent signatures, suspended domains cut off both ways")
+	serveCmd.Flags().Bool("authorized-fetch", false, "whether peers must sign their requests for our objects")
+	serveCmd.Flags().Int("max-note-chars", service.DefaultConfig().MaxNoteChars, "the longest note local users may post")
+	rootCmd.AddCommand(serveCmd)
+}
+
+func Execute() {
 	err := rootCmd.Execute()
 	if err != nil {
 		log.Fatal(err)
@@ -0,0 +1,20 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package cmd
+
+import (
+	"bytes"
+	"testing"
+)
+
+// run runs the command line `args` and returns what it printed.
+func run(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	rootCmd.SetOut(&out)
+	rootCmd.SetErr(&out)
+	rootCmd.SetArgs(args)
+	err := rootCmd.Execute()
+	return out.String(), err
+}
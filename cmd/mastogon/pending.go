@@ -0,0 +1,68 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+
+	"mastogon/internal/db"
+)
+
+// pendingDelivery is a delivery as the file of pending deliveries keeps it.
+type pendingDelivery struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Body     []byte `json:"body"`
+	Attempts int    `json:"attempts"`
+}
+
+// savePending writes `deliveries` to the file at `path`, for loadPending to
+// read at the next start. It's written whole or not at all, so a crash
+// while writing leaves what an earlier shutdown saved.
+func savePending(path string, deliveries []db.Delivery) error {
+	pending := make([]pendingDelivery, 0, len(deliveries))
+	for _, d := range deliveries {
+		pending = append(pending, pendingDelivery{d.From.String(), d.To.String(), d.Body, d.Attempts})
+	}
+	b, err := json.Marshal(pending)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// loadPending reads the deliveries savePending wrote to the file at `path`,
+// and removes it so they're only made once. No file means none are pending.
+func loadPending(path string) ([]db.Delivery, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var pending []pendingDelivery
+	if err := json.Unmarshal(b, &pending); err != nil {
+		return nil, err
+	}
+	var deliveries []db.Delivery
+	for _, p := range pending {
+		from, err := url.Parse(p.From)
+		if err != nil {
+			return nil, err
+		}
+		to, err := url.Parse(p.To)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, db.Delivery{From: from, To: to, Body: p.Body, Attempts: p.Attempts})
+	}
+	return deliveries, os.Remove(path)
+}
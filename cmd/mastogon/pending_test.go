@@ -0,0 +1,59 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package cmd
+
+import (
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"mastogon/internal/db"
+)
+
+// What's pending at shutdown outlives the database, to be given to the next
+// process's.
+func TestPendingDeliveriesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pending-deliveries.json")
+	if pending, err := loadPending(path); err != nil || len(pending) != 0 {
+		t.Fatalf("loaded %v, %v with no file", pending, err)
+	}
+	parse := func(s string) *url.URL {
+		u, err := url.Parse(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+	want := []db.Delivery{
+		{From: parse("https://localhost/users/alice/outbox"), To: parse("https://remote.test/users/bob/inbox"), Body: []byte(`{"n":1}`)},
+		{From: parse("https://localhost/users/alice/outbox"), To: parse("https://remote.test/users/carol/inbox"), Body: []byte(`{"n":2}`), Attempts: 3},
+	}
+	if err := savePending(path, want); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := &db.DB{}
+	restarted.Construct(&sync.Map{}, "localhost")
+	pending, err := loadPending(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restarted.SavePendingDeliveries(pending)
+	got := restarted.TakePendingDeliveries()
+	if len(got) != len(want) {
+		t.Fatalf("loaded %d deliveries, want %d", len(got), len(want))
+	}
+	for i, d := range got {
+		if d.From.String() != want[i].From.String() || d.To.String() != want[i].To.String() || string(d.Body) != string(want[i].Body) || d.Attempts != want[i].Attempts {
+			t.Errorf("loaded %+v, want %+v", d, want[i])
+		}
+	}
+	// They're only made once.
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("file left after loading: %v", err)
+	}
+}
@@ -0,0 +1,60 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"mastogon/internal/db"
+	"mastogon/internal/service"
+
+	"github.com/spf13/cobra"
+)
+
+var pruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove stale content cached from peers that nothing local references",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		value, _ := cmd.Flags().GetString("older-than")
+		olderThan, err := parseAge(value)
+		if err != nil || olderThan <= 0 {
+			return errors.New("--older-than must be a positive duration, such as 30d or 12h")
+		}
+		batchSize, _ := cmd.Flags().GetInt("batch-size")
+		if batchSize < 1 {
+			return errors.New("--batch-size must be positive")
+		}
+		hostname, _ := cmd.Flags().GetString("hostname")
+		db := &db.DB{}
+		db.Construct(&sync.Map{}, hostname)
+		s := &service.Service{}
+		s.Construct(db, service.DefaultConfig())
+		report, err := s.Prune(context.Background(), olderThan, batchSize)
+		fmt.Fprintf(cmd.OutOrStdout(), "%d stale, %d kept, %d removed\n", report.Stale, report.Kept, report.Removed)
+		return err
+	},
+}
+
+// parseAge parses a duration as time.ParseDuration does, but also in whole
+// days, such as "30d".
+func parseAge(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		n, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		return time.Duration(n) * 24 * time.Hour, err
+	}
+	return time.ParseDuration(s)
+}
+
+func init() {
+	pruneCmd.Flags().String("older-than", "30d", "how long ago remote content must have been published to be pruned")
+	pruneCmd.Flags().Int("batch-size", 500, "how many objects to remove at a time")
+	pruneCmd.Flags().String("hostname", "localhost", "the domain our actors live on")
+	rootCmd.AddCommand(pruneCmd)
+}
@@ -0,0 +1,51 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package cmd
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseAge(t *testing.T) {
+	for _, test := range []struct {
+		age  string
+		want time.Duration
+		ok   bool
+	}{
+		{"30d", 30 * 24 * time.Hour, true},
+		{"12h", 12 * time.Hour, true},
+		{"90m", 90 * time.Minute, true},
+		{"d", 0, false},
+		{"a month", 0, false},
+	} {
+		got, err := parseAge(test.age)
+		if (err == nil) != test.ok || got != test.want {
+			t.Errorf("%q: %s, %v, want %s", test.age, got, err, test.want)
+		}
+	}
+}
+
+func TestPrune(t *testing.T) {
+	for _, test := range []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"prune", "--older-than", "0d", "--batch-size", "500"}, "--older-than must be a positive duration"},
+		{[]string{"prune", "--older-than", "soon", "--batch-size", "500"}, "--older-than must be a positive duration"},
+		{[]string{"prune", "--older-than", "30d", "--batch-size", "0"}, "--batch-size must be positive"},
+	} {
+		if _, err := run(t, test.args...); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%v: %v, want %q", test.args, err, test.err)
+		}
+	}
+	out, err := run(t, "prune", "--older-than", "30d", "--batch-size", "500")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "0 stale, 0 kept, 0 removed\n" {
+		t.Errorf("printed %q", out)
+	}
+}
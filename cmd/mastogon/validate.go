@@ -0,0 +1,81 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sync"
+
+	"mastogon/internal/db"
+	"mastogon/internal/service"
+
+	"github.com/spf13/cobra"
+)
+
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check how we'd take deliveries from a remote actor, without federating",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		actor, _ := cmd.Flags().GetString("actor")
+		actorIRI, err := url.Parse(actor)
+		if err != nil || !actorIRI.IsAbs() {
+			return errors.New("--actor must be the IRI of a remote actor")
+		}
+		var objectIRI *url.URL
+		if object, _ := cmd.Flags().GetString("object"); object != "" {
+			if objectIRI, err = url.Parse(object); err != nil || !objectIRI.IsAbs() {
+				return errors.New("--object must be an IRI")
+			}
+		}
+		hostname, _ := cmd.Flags().GetString("hostname")
+		db := &db.DB{}
+		db.Construct(&sync.Map{}, hostname)
+		s := &service.Service{}
+		s.Construct(db, service.DefaultConfig())
+		c := context.Background()
+		if path, _ := cmd.Flags().GetString("domain-blocks"); path != "" {
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			if _, err := s.ImportDomainBlocks(c, f); err != nil {
+				return err
+			}
+		}
+
+		report := s.ValidateRemote(c, actorIRI, objectIRI)
+		out := cmd.OutOrStdout()
+		fmt.Fprintf(out, "actor:  %s\n", report.Actor)
+		if report.Object != nil {
+			fmt.Fprintf(out, "object: %s\n", report.Object)
+		}
+		for _, check := range report.Checks {
+			mark := "ok  "
+			if !check.OK {
+				mark = "FAIL"
+			}
+			fmt.Fprintf(out, "  %s %s", mark, check.Name)
+			if check.Detail != "" {
+				fmt.Fprintf(out, ": %s", check.Detail)
+			}
+			fmt.Fprintln(out)
+		}
+		fmt.Fprintf(out, "delivery would be: %s\n", report.Verdict)
+		return nil
+	},
+}
+
+func init() {
+	validateCmd.Flags().String("actor", "", "the IRI of the remote actor to check")
+	validateCmd.Flags().String("object", "", "the IRI of an object of theirs to check, rather than their latest")
+	validateCmd.Flags().String("hostname", "localhost", "the domain our actors live on")
+	validateCmd.Flags().String("domain-blocks", "", "a Mastodon domain block export to check against")
+	validateCmd.MarkFlagRequired("actor")
+	rootCmd.AddCommand(validateCmd)
+}
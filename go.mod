@@ -6,8 +6,11 @@ require (
 	github.com/go-fed/activity v1.0.0 // indirect
 	github.com/go-fed/httpsig v0.1.1-0.20190914113940-c2de3672e5b5 // indirect
 	github.com/inconshreveable/mousetrap v1.0.1 // indirect
+	github.com/piprate/json-gold v0.5.0 // indirect
+	github.com/pquerna/cachecontrol v0.0.0-20180517163645-1555304b9b35 // indirect
 	github.com/spf13/cobra v1.6.1 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
 	golang.org/x/crypto v0.0.0-20180527072434-ab813273cd59 // indirect
 	golang.org/x/sys v0.0.0-20180525142821-c11f84a56e43 // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )
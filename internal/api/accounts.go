@@ -0,0 +1,200 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"mastogon/internal/db"
+	"mastogon/internal/service"
+)
+
+// Token is the OAuth token Mastodon hands out.
+type Token struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	Scope       string `json:"scope"`
+	CreatedAt   int64  `json:"created_at"`
+}
+
+// POST /api/v1/accounts
+func (a *API) postAccount(w http.ResponseWriter, r *http.Request) {
+	var params struct {
+		Username string `json:"username"`
+		Email    string `json:"email"`
+		Password string `json:"password"`
+		Reason   string `json:"reason"`
+		Locale   string `json:"locale"`
+	}
+	if err := decodeParams(r, &params); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	token, err := a.service.Register(r.Context(), service.Registration{
+		Username: params.Username,
+		Email:    params.Email,
+		Password: params.Password,
+		Reason:   params.Reason,
+		Locale:   params.Locale,
+	})
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, Token{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		Scope:       strings.Join(service.TokenScopes, " "),
+		CreatedAt:   a.service.Now().Unix(),
+	})
+}
+
+// accountID is how we refer to actors in the Mastodon API: local accounts by
+// username, remote ones by the Mastodon ID `d` hands them.
+func accountID(actorIRI *url.URL, d *db.DB) string {
+	if actorIRI.Host == d.Hostname() {
+		return path.Base(actorIRI.Path)
+	}
+	return d.MastodonIDForIRI(actorIRI)
+}
+
+// actorForAccountID reverses accountID.
+func (a *API) actorForAccountID(c context.Context, id string) (*url.URL, error) {
+	if actorIRI, err := a.db.ActorForUsername(c, id); err == nil {
+		return actorIRI, nil
+	}
+	if actorIRI, ok := a.db.IRIForMastodonID(id); ok {
+		return actorIRI, nil
+	}
+	// IRIs encoded as IDs, as we used to hand out.
+	b, err := base64.RawURLEncoding.DecodeString(id)
+	if err != nil {
+		return nil, fmt.Errorf("account %s: %w", id, service.ErrNotFound)
+	}
+	actorIRI, err := url.Parse(string(b))
+	if err != nil || !actorIRI.IsAbs() {
+		return nil, fmt.Errorf("account %s: %w", id, service.ErrNotFound)
+	}
+	return actorIRI, nil
+}
+
+// account presents the actor at `actorIRI`, with just its ID and URL if we
+// don't have it stored, and the account it moved to if it moved.
+func (a *API) account(c context.Context, actorIRI *url.URL) Account {
+	account := a.storedAccount(c, actorIRI)
+	if t, err := a.db.Get(c, actorIRI); err == nil {
+		if movedIRI := service.MovedTo(t); movedIRI != nil && movedIRI.String() != actorIRI.String() {
+			moved := a.storedAccount(c, movedIRI)
+			account.Moved = &moved
+		}
+	}
+	return account
+}
+
+// storedAccount is account without looking where the actor moved.
+func (a *API) storedAccount(c context.Context, actorIRI *url.URL) Account {
+	if t, err := a.db.Get(c, actorIRI); err == nil {
+		if actor, ok := db.ToActor(t); ok {
+			account := newAccount(actor, a.db)
+			if owns, err := a.db.Owns(c, actorIRI); err == nil && owns {
+				account.Locked = a.service.ManuallyApprovesFollowers(actorIRI)
+			}
+			return account
+		}
+	}
+	return Account{ID: accountID(actorIRI, a.db), URL: actorIRI.String()}
+}
+
+// GET /api/v1/accounts/:id/followers
+func (a *API) getFollowers(w http.ResponseWriter, r *http.Request) {
+	a.listAccounts(w, r, a.service.Followers)
+}
+
+// GET /api/v1/accounts/:id/following
+func (a *API) getFollowing(w http.ResponseWriter, r *http.Request) {
+	a.listAccounts(w, r, a.service.Following)
+}
+
+// listAccounts replies with a page of the accounts `list` returns for the
+// account in the path.
+func (a *API) listAccounts(w http.ResponseWriter,
+	r *http.Request,
+	list func(c context.Context, actorIRI, viewerIRI *url.URL) ([]*url.URL, error)) {
+	c := r.Context()
+	// Anyone may look, but the owner may see more than strangers.
+	viewerIRI, _ := a.authenticate(r)
+	actorIRI, err := a.actorForAccountID(c, pathParam(r, "id"))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	iris, err := list(c, actorIRI, viewerIRI)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	a.writeAccountPage(w, r, iris)
+}
+
+// writeAccountPage replies with the page of the accounts at `actorIRIs` that
+// `r` asks for.
+func (a *API) writeAccountPage(w http.ResponseWriter, r *http.Request, actorIRIs []*url.URL) {
+	ids := make([]string, len(actorIRIs))
+	for i, actorIRI := range actorIRIs {
+		ids[i] = accountID(actorIRI, a.db)
+	}
+	start, end := a.paginate(w, r, ids)
+	accounts := make([]Account, 0, end-start)
+	for _, actorIRI := range actorIRIs[start:end] {
+		accounts = append(accounts, a.account(r.Context(), actorIRI))
+	}
+	writeJSON(w, http.StatusOK, accounts)
+}
+
+// PATCH /api/v1/accounts/update_credentials
+func (a *API) patchCredentials(w http.ResponseWriter, r *http.Request) {
+	actorIRI, err := a.authenticate(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	var params struct {
+		DisplayName     *string `json:"display_name"`
+		Note            *string `json:"note"`
+		HideCollections *bool   `json:"hide_collections"`
+		Locked          *bool   `json:"locked"`
+		Discoverable    *bool   `json:"discoverable"`
+		// The defaults for statuses, which Mastodon files under the
+		// account's source.
+		Source struct {
+			Privacy   *string `json:"privacy"`
+			Sensitive *bool   `json:"sensitive"`
+			Language  *string `json:"language"`
+		} `json:"source"`
+	}
+	if err := decodeParams(r, &params); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	if err := a.service.UpdateCredentials(r.Context(), actorIRI, service.CredentialsParams{
+		HideCollections:   params.HideCollections,
+		Locked:            params.Locked,
+		DefaultVisibility: params.Source.Privacy,
+		DefaultSensitive:  params.Source.Sensitive,
+		DefaultLanguage:   params.Source.Language,
+		DisplayName:       params.DisplayName,
+		Note:              params.Note,
+		Discoverable:      params.Discoverable,
+	}); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, a.account(r.Context(), actorIRI))
+}
@@ -0,0 +1,30 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestPostAccount(t *testing.T) {
+	a, _, _ := newTestAPI(t)
+	var token Token
+	decode(t, call(t, a, http.MethodPost, "/api/v1/accounts", "", `{"username":"carol","email":"carol@mastogon.test","password":"password","locale":"en"}`), &token)
+	if token.AccessToken == "" || token.TokenType != "Bearer" {
+		t.Fatalf("token %+v", token)
+	}
+	if w := call(t, a, http.MethodGet, "/api/v1/preferences", token.AccessToken, ""); w.Code != http.StatusOK {
+		t.Errorf("using the token: %d %s", w.Code, w.Body)
+	}
+
+	for _, body := range []string{
+		`{"username":"carol","email":"carol@mastogon.test","password":"password"}`,
+		`{"username":"dave","email":"dave@mastogon.test","password":"short"}`,
+	} {
+		if w := call(t, a, http.MethodPost, "/api/v1/accounts", "", body); w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("registering %s: %d %s, want 422", body, w.Code, w.Body)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+
+	"mastogon/internal/db"
+	"mastogon/internal/service"
+)
+
+// authenticateAdmin is authenticate for endpoints only moderators may use.
+// On failure the response has been written and ok is false.
+func (a *API) authenticateAdmin(w http.ResponseWriter, r *http.Request) (ok bool) {
+	actorIRI, err := a.authenticate(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return false
+	}
+	if !a.service.IsAdmin(actorIRI) {
+		writeServiceError(w, fmt.Errorf("%s isn't a moderator: %w", actorIRI, service.ErrForbidden))
+		return false
+	}
+	return true
+}
+
+// adminTarget resolves the `:id` of an admin endpoint, writing a 404 if it
+// can't.
+func (a *API) adminTarget(w http.ResponseWriter, r *http.Request) (*url.URL, bool) {
+	actorIRI, err := a.actorForAccountID(r.Context(), pathParam(r, "id"))
+	if err != nil {
+		writeServiceError(w, err)
+		return nil, false
+	}
+	return actorIRI, true
+}
+
+// POST /api/v1/admin/accounts/:id/action
+func (a *API) postAdminAction(w http.ResponseWriter, r *http.Request) {
+	if !a.authenticateAdmin(w, r) {
+		return
+	}
+	actorIRI, ok := a.adminTarget(w, r)
+	if !ok {
+		return
+	}
+	var params struct {
+		Type string `json:"type"`
+	}
+	if err := decodeParams(r, &params); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	switch params.Type {
+	case "suspend":
+		a.service.Suspend(r.Context(), actorIRI)
+	case "none":
+	default:
+		writeServiceError(w, service.NewValidationError("Type is not supported"))
+		return
+	}
+	writeJSON(w, http.StatusOK, struct{}{})
+}
+
+// POST /api/v1/admin/accounts/:id/unsuspend
+func (a *API) postAdminUnsuspend(w http.ResponseWriter, r *http.Request) {
+	if !a.authenticateAdmin(w, r) {
+		return
+	}
+	actorIRI, ok := a.adminTarget(w, r)
+	if !ok {
+		return
+	}
+	a.service.Unsuspend(r.Context(), actorIRI)
+	writeJSON(w, http.StatusOK, a.account(r.Context(), actorIRI))
+}
+
+// POST /api/v1/admin/accounts/:id/rotate_key
+func (a *API) postAdminRotateKey(w http.ResponseWriter, r *http.Request) {
+	if !a.authenticateAdmin(w, r) {
+		return
+	}
+	actorIRI, ok := a.adminTarget(w, r)
+	if !ok {
+		return
+	}
+	if !a.db.IsLocalHost(actorIRI.Host) {
+		writeServiceError(w, fmt.Errorf("key of %s: %w", actorIRI, db.ErrNotOwned))
+		return
+	}
+	if err := a.service.RotateKey(r.Context(), actorIRI); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, a.account(r.Context(), actorIRI))
+}
+
+// DELETE /api/v1/admin/accounts/:id
+func (a *API) deleteAdminAccount(w http.ResponseWriter, r *http.Request) {
+	if !a.authenticateAdmin(w, r) {
+		return
+	}
+	actorIRI, ok := a.adminTarget(w, r)
+	if !ok {
+		return
+	}
+	if !a.db.IsLocalHost(actorIRI.Host) {
+		writeServiceError(w, fmt.Errorf("deleting %s: %w", actorIRI, db.ErrNotOwned))
+		return
+	}
+	if err := a.service.DeleteAccount(r.Context(), path.Base(actorIRI.Path)); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, struct{}{})
+}
@@ -0,0 +1,226 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+// Package api serves the Mastodon client API on top of the service.
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"mastogon/internal/db"
+	"mastogon/internal/service"
+)
+
+type API struct {
+	// The federating service doing the actual work.
+	service *service.Service
+	// Where bearer tokens and content are looked up.
+	db *db.DB
+	// The endpoints we serve, tried in order.
+	routes []route
+}
+
+func (a *API) Construct(service *service.Service, db *db.DB) {
+	a.service = service
+	a.db = db
+	a.routes = []route{
+		newRoute(http.MethodPost, "/api/v1/accounts", a.postAccount),
+		newRoute(http.MethodPatch, "/api/v1/accounts/update_credentials", a.patchCredentials),
+		newRoute(http.MethodGet, "/api/v1/accounts/relationships", a.getRelationships),
+		newRoute(http.MethodGet, "/api/v1/accounts/:id/followers", a.getFollowers),
+		newRoute(http.MethodGet, "/api/v1/accounts/:id/following", a.getFollowing),
+		newRoute(http.MethodPost, "/api/v1/accounts/:id/note", a.postAccountNote),
+		newRoute(http.MethodGet, "/api/pleroma/aliases", a.getAliases),
+		newRoute(http.MethodPut, "/api/pleroma/aliases", a.putAlias),
+		newRoute(http.MethodDelete, "/api/pleroma/aliases", a.deleteAlias),
+		newRoute(http.MethodPost, "/api/pleroma/move_account", a.postMoveAccount),
+		newRoute(http.MethodGet, "/api/v1/directory", a.getDirectory),
+		newRoute(http.MethodGet, "/api/v1/instance", a.getInstance),
+		newRoute(http.MethodGet, "/api/v1/instance/peers", a.getInstancePeers),
+		newRoute(http.MethodGet, "/api/v1/preferences", a.getPreferences),
+		newRoute(http.MethodPost, "/api/v1/statuses", a.postStatus),
+		newRoute(http.MethodDelete, "/api/v1/statuses/:id", a.deleteStatus),
+		newRoute(http.MethodGet, "/api/v1/statuses/:id/context", a.getStatusContext),
+		newRoute(http.MethodGet, "/api/v1/statuses/:id/favourited_by", a.getFavouritedBy),
+		newRoute(http.MethodGet, "/api/v1/statuses/:id/reblogged_by", a.getRebloggedBy),
+		newRoute(http.MethodGet, "/api/v1/pleroma/statuses/:id/reactions", a.getStatusReactions),
+		newRoute(http.MethodGet, "/api/v1/drafts", a.getDrafts),
+		newRoute(http.MethodPost, "/api/v1/drafts", a.postDraft),
+		newRoute(http.MethodGet, "/api/v1/drafts/:id", a.getDraft),
+		newRoute(http.MethodPut, "/api/v1/drafts/:id", a.putDraft),
+		newRoute(http.MethodDelete, "/api/v1/drafts/:id", a.deleteDraft),
+		newRoute(http.MethodPost, "/api/v1/drafts/:id/publish", a.postDraftPublish),
+		newRoute(http.MethodGet, "/api/v1/scheduled_statuses", a.getScheduledStatuses),
+		newRoute(http.MethodGet, "/api/v1/scheduled_statuses/:id", a.getScheduledStatus),
+		newRoute(http.MethodDelete, "/api/v1/scheduled_statuses/:id", a.deleteScheduledStatus),
+		newRoute(http.MethodGet, "/api/v1/timelines/home", a.getHomeTimeline),
+		newRoute(http.MethodGet, "/api/v1/timelines/list/:id", a.getListTimeline),
+		newRoute(http.MethodGet, "/api/v1/conversations", a.getConversations),
+		newRoute(http.MethodPost, "/api/v1/conversations/:id/read", a.postConversationRead),
+		newRoute(http.MethodGet, "/api/v1/trends/tags", a.getTrendingTags),
+		newRoute(http.MethodGet, "/api/v1/filters", a.getFilters),
+		newRoute(http.MethodPost, "/api/v1/filters", a.postFilter),
+		newRoute(http.MethodGet, "/api/v1/filters/:id", a.getFilter),
+		newRoute(http.MethodPut, "/api/v1/filters/:id", a.putFilter),
+		newRoute(http.MethodDelete, "/api/v1/filters/:id", a.deleteFilter),
+		newRoute(http.MethodGet, "/api/v1/lists", a.getLists),
+		newRoute(http.MethodPost, "/api/v1/lists", a.postList),
+		newRoute(http.MethodGet, "/api/v1/lists/:id", a.getList),
+		newRoute(http.MethodPut, "/api/v1/lists/:id", a.putList),
+		newRoute(http.MethodDelete, "/api/v1/lists/:id", a.deleteList),
+		newRoute(http.MethodGet, "/api/v1/lists/:id/accounts", a.getListAccounts),
+		newRoute(http.MethodPost, "/api/v1/lists/:id/accounts", a.postListAccounts),
+		newRoute(http.MethodDelete, "/api/v1/lists/:id/accounts", a.deleteListAccounts),
+		newRoute(http.MethodPost, "/api/v1/reports", a.postReport),
+		newRoute(http.MethodGet, "/api/v1/follow_requests", a.getFollowRequests),
+		newRoute(http.MethodPost, "/api/v1/follow_requests/import", a.postFollowImport),
+		newRoute(http.MethodPost, "/api/v1/follow_requests/:id/authorize", a.postFollowRequestAuthorize),
+		newRoute(http.MethodPost, "/api/v1/follow_requests/:id/reject", a.postFollowRequestReject),
+		newRoute(http.MethodPost, "/api/v1/blocks/import", a.postBlockImport),
+		newRoute(http.MethodGet, "/api/v1/blocks/export", a.getBlockExport),
+		newRoute(http.MethodPost, "/api/v1/admin/domain_blocks/import", a.postDomainBlockImport),
+		newRoute(http.MethodGet, "/api/v1/admin/domain_blocks/export", a.getDomainBlockExport),
+		newRoute(http.MethodGet, "/api/v1/admin/reports", a.getAdminReports),
+		newRoute(http.MethodPost, "/api/v1/admin/reports/:id/forward", a.postAdminReportForward),
+		newRoute(http.MethodPost, "/api/v1/admin/accounts/:id/action", a.postAdminAction),
+		newRoute(http.MethodPost, "/api/v1/admin/accounts/:id/unsuspend", a.postAdminUnsuspend),
+		newRoute(http.MethodPost, "/api/v1/admin/accounts/:id/rotate_key", a.postAdminRotateKey),
+		newRoute(http.MethodDelete, "/api/v1/admin/accounts/:id", a.deleteAdminAccount),
+		newRoute(http.MethodGet, "/api/v1/admin/instances", a.getAdminInstances),
+		newRoute(http.MethodGet, "/api/v1/admin/instances/health", a.getInstancesHealth),
+	}
+}
+
+func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for _, route := range a.routes {
+		if params, ok := route.match(r); ok {
+			c := db.WithLockHolder(context.WithValue(r.Context(), pathParamsKey{}, params))
+			route.handler(w, r.WithContext(c))
+			return
+		}
+	}
+	writeServiceError(w, fmt.Errorf("%s %s: %w", r.Method, r.URL.Path, service.ErrNotFound))
+}
+
+// authenticate returns the local actor the request's bearer token was issued
+// to.
+func (a *API) authenticate(r *http.Request) (*url.URL, error) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" || token == r.Header.Get("Authorization") {
+		return nil, fmt.Errorf("missing bearer token: %w", service.ErrUnauthorized)
+	}
+	actorIRI, err := a.db.ActorForToken(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", service.ErrUnauthorized, err)
+	}
+	if a.db.IsSuspended(actorIRI) {
+		return nil, fmt.Errorf("account suspended: %w", service.ErrUnauthorized)
+	}
+	return actorIRI, nil
+}
+
+// decodeParams fills `v`, a pointer to a struct, from either a JSON body or
+// form values, as Mastodon clients send both. Form values are mapped onto
+// the struct's fields through their JSON tags, those of nested structs going
+// by `outer[inner]`. What can't be read is a *service.ParseError.
+func decodeParams(r *http.Request, v interface{}) error {
+	if err := readParams(r, v); err != nil {
+		return &service.ParseError{Err: err}
+	}
+	return nil
+}
+
+// readParams is decodeParams, failing with whatever went wrong.
+func readParams(r *http.Request, v interface{}) error {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "application/json" {
+		return json.NewDecoder(r.Body).Decode(v)
+	}
+	if mediaType == "multipart/form-data" {
+		if err := r.ParseMultipartForm(maxImportSize); err != nil {
+			return err
+		}
+	} else if err := r.ParseForm(); err != nil {
+		return err
+	}
+	return decodeForm(r.Form, reflect.ValueOf(v).Elem(), "")
+}
+
+// decodeForm fills the struct `rv` from `form`, its fields' names prefixed
+// with `prefix`.
+func decodeForm(form url.Values, rv reflect.Value, prefix string) error {
+	for i := 0; i < rv.NumField(); i++ {
+		name, _, _ := strings.Cut(rv.Type().Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		if prefix != "" {
+			name = prefix + "[" + name + "]"
+		}
+		field := rv.Field(i)
+		if field.Kind() == reflect.Struct {
+			if err := decodeForm(form, field, name); err != nil {
+				return err
+			}
+			continue
+		}
+		// Arrays come as repeated `name[]` fields.
+		if field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String {
+			values := form[name+"[]"]
+			if values == nil {
+				values = form[name]
+			}
+			field.Set(reflect.ValueOf(values))
+			continue
+		}
+		if _, ok := form[name]; !ok {
+			continue
+		}
+		value := form.Get(name)
+		// Pointers tell fields that were sent apart from those that weren't.
+		if field.Kind() == reflect.Ptr {
+			field.Set(reflect.New(field.Type().Elem()))
+			field = field.Elem()
+		}
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(value)
+		case reflect.Bool:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			field.SetBool(b)
+		case reflect.Int, reflect.Int64:
+			if value == "" {
+				continue
+			}
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			field.SetInt(n)
+		}
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeServiceError replies to a request that failed with `err`, with the
+// status code the service maps it to.
+func writeServiceError(w http.ResponseWriter, err error) {
+	service.WriteError(w, err)
+}
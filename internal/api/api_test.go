@@ -0,0 +1,117 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"mastogon/internal/service"
+)
+
+// newTestAPI returns an API over a service in memory, with the tokens of
+// alice, a moderator, and bob, who isn't. Each of `configure` gets to change
+// the service's configuration first.
+func newTestAPI(t *testing.T, configure ...func(*service.Config)) (a *API, alice, bob string) {
+	t.Helper()
+	d := newTestDB()
+	config := service.DefaultConfig()
+	config.RegistrationsOpen = true
+	config.AdminUsernames = []string{"alice"}
+	for _, f := range configure {
+		f(&config)
+	}
+	s := &service.Service{}
+	s.Construct(d, config)
+	s.SetTransport(&service.FakeTransport{})
+	register := func(username string) string {
+		token, err := s.Register(context.Background(), service.Registration{
+			Username: username,
+			Email:    username + "@" + testHostname,
+			Password: "password",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	a = &API{}
+	a.Construct(s, d)
+	return a, register("alice"), register("bob")
+}
+
+// call makes a request of `a` as whoever `token` is for, or no one if it's
+// empty, with the JSON `body` if there is one.
+func call(t *testing.T, a *API, method, path, token, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	a.ServeHTTP(w, r)
+	return w
+}
+
+// decode decodes the body of `w` into `v`, failing the test unless the
+// request succeeded.
+func decode(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if w.Code != http.StatusOK {
+		t.Fatalf("%d %s", w.Code, w.Body)
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("body %q: %s", w.Body, err)
+	}
+}
+
+// Whatever fails, fails with the status and message the service's error
+// mapper gives it.
+func TestErrorResponses(t *testing.T) {
+	a, alice, bob := newTestAPI(t)
+	remote := base64.RawURLEncoding.EncodeToString([]byte("https://remote.test/users/carol"))
+	for _, test := range []struct {
+		name, method, path, token, body string
+		status                          int
+		msg                             string
+	}{
+		{"no such endpoint", http.MethodGet, "/api/v1/nothing", bob, "", http.StatusNotFound, "Record not found"},
+		{"no such account", http.MethodGet, "/api/v1/accounts/!!!/followers", bob, "", http.StatusNotFound, "Record not found"},
+		{"no such status", http.MethodGet, "/api/v1/statuses/!!!/context", bob, "", http.StatusNotFound, "Record not found"},
+		{"deleting no such status", http.MethodDelete, "/api/v1/statuses/!!!", bob, "", http.StatusNotFound, "Record not found"},
+		{"no token", http.MethodPost, "/api/v1/admin/accounts/bob/action", "", `{"type":"suspend"}`, http.StatusUnauthorized, service.ErrUnauthorized.Error()},
+		{"not a moderator", http.MethodPost, "/api/v1/admin/accounts/alice/action", bob, `{"type":"suspend"}`, http.StatusForbidden, "This action is not allowed"},
+		{"unknown action", http.MethodPost, "/api/v1/admin/accounts/bob/action", alice, `{"type":"silence"}`, http.StatusUnprocessableEntity, "Validation failed: Type is not supported"},
+		{"rotating a peer's key", http.MethodPost, "/api/v1/admin/accounts/" + remote + "/rotate_key", alice, "", http.StatusForbidden, "This action is not allowed"},
+		{"deleting a peer", http.MethodDelete, "/api/v1/admin/accounts/" + remote, alice, "", http.StatusForbidden, "This action is not allowed"},
+		{"scheduling at no time", http.MethodPost, "/api/v1/statuses", bob, `{"status":"later","scheduled_at":"tomorrow"}`, http.StatusUnprocessableEntity, "Validation failed: Scheduled at is invalid"},
+		{"quoting nothing", http.MethodPost, "/api/v1/statuses", bob, `{"status":"look","quoted_status_id":"!!!"}`, http.StatusUnprocessableEntity, "Validation failed: Quoted status could not be found"},
+		{"not JSON", http.MethodPost, "/api/v1/admin/accounts/bob/action", alice, `{"type":`, http.StatusBadRequest, ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+			r.Header.Set("Content-Type", "application/json")
+			if test.token != "" {
+				r.Header.Set("Authorization", "Bearer "+test.token)
+			}
+			w := httptest.NewRecorder()
+			a.ServeHTTP(w, r)
+			var body map[string]string
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("body %q: %s", w.Body, err)
+			}
+			if w.Code != test.status || (test.msg != "" && body["error"] != test.msg) {
+				t.Errorf("%d %q, want %d %q", w.Code, body["error"], test.status, test.msg)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"mastogon/internal/service"
+
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// Conversation is the Mastodon representation of a run of direct messages.
+type Conversation struct {
+	ID         string    `json:"id"`
+	Unread     bool      `json:"unread"`
+	Accounts   []Account `json:"accounts"`
+	LastStatus *Status   `json:"last_status"`
+}
+
+func (a *API) conversation(c context.Context, actorIRI *url.URL, conv service.Conversation) Conversation {
+	accounts := make([]Account, 0, len(conv.Participants))
+	for _, p := range conv.Participants {
+		accounts = append(accounts, a.account(c, p))
+	}
+	last := a.statuses(c, actorIRI, "thread", []vocab.Type{conv.LastStatus})[0]
+	return Conversation{
+		ID:         conv.ID,
+		Unread:     conv.Unread,
+		Accounts:   accounts,
+		LastStatus: &last,
+	}
+}
+
+// GET /api/v1/conversations
+func (a *API) getConversations(w http.ResponseWriter, r *http.Request) {
+	actorIRI, err := a.authenticate(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	convs, err := a.service.Conversations(r.Context(), actorIRI)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	ids := make([]string, len(convs))
+	for i, conv := range convs {
+		ids[i] = conv.ID
+	}
+	start, end := a.paginate(w, r, ids)
+	conversations := make([]Conversation, 0, end-start)
+	for _, conv := range convs[start:end] {
+		conversations = append(conversations, a.conversation(r.Context(), actorIRI, conv))
+	}
+	writeJSON(w, http.StatusOK, conversations)
+}
+
+// POST /api/v1/conversations/:id/read
+func (a *API) postConversationRead(w http.ResponseWriter, r *http.Request) {
+	actorIRI, err := a.authenticate(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	conv, err := a.service.MarkConversationRead(r.Context(), actorIRI, pathParam(r, "id"))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, a.conversation(r.Context(), actorIRI, conv))
+}
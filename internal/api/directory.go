@@ -0,0 +1,56 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"mastogon/internal/service"
+)
+
+// How many accounts a page of the profile directory has unless the client
+// asks otherwise, and the most it may ask for.
+const (
+	defaultDirectoryLimit = 40
+	maxDirectoryLimit     = 80
+)
+
+// GET /api/v1/directory
+func (a *API) getDirectory(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	order := q.Get("order")
+	if order != service.DirectoryNew {
+		order = service.DirectoryActive
+	}
+	offset, err := strconv.Atoi(q.Get("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	limit, err := strconv.Atoi(q.Get("limit"))
+	if err != nil || limit < 1 {
+		limit = defaultDirectoryLimit
+	}
+	if limit > maxDirectoryLimit {
+		limit = maxDirectoryLimit
+	}
+	// We only list our own accounts, so `local` makes no difference.
+	actorIRIs, err := a.service.Directory(r.Context(), order)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	if offset > len(actorIRIs) {
+		offset = len(actorIRIs)
+	}
+	end := offset + limit
+	if end > len(actorIRIs) {
+		end = len(actorIRIs)
+	}
+	accounts := make([]Account, 0, end-offset)
+	for _, actorIRI := range actorIRIs[offset:end] {
+		accounts = append(accounts, a.account(r.Context(), actorIRI))
+	}
+	writeJSON(w, http.StatusOK, accounts)
+}
@@ -0,0 +1,141 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"mastogon/internal/db"
+	"mastogon/internal/service"
+)
+
+// Draft is a status a user is still writing. Mastodon has no such thing, so
+// this is our own, shaped like its scheduled statuses.
+type Draft struct {
+	ID        string  `json:"id"`
+	Text      string  `json:"text"`
+	Language  *string `json:"language"`
+	CreatedAt string  `json:"created_at"`
+	UpdatedAt string  `json:"updated_at"`
+}
+
+func newDraft(d *db.Draft) Draft {
+	draft := Draft{
+		ID:        d.ID,
+		Text:      d.Status,
+		CreatedAt: d.CreatedAt.UTC().Format(time.RFC3339),
+		UpdatedAt: d.UpdatedAt.UTC().Format(time.RFC3339),
+	}
+	if d.Language != "" {
+		language := d.Language
+		draft.Language = &language
+	}
+	return draft
+}
+
+type draftParams struct {
+	Status   string `json:"status"`
+	Language string `json:"language"`
+}
+
+// GET /api/v1/drafts
+func (a *API) getDrafts(w http.ResponseWriter, r *http.Request) {
+	actorIRI, err := a.authenticate(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	drafts := []Draft{}
+	for _, d := range a.service.Drafts(r.Context(), actorIRI) {
+		drafts = append(drafts, newDraft(d))
+	}
+	writeJSON(w, http.StatusOK, drafts)
+}
+
+// POST /api/v1/drafts
+func (a *API) postDraft(w http.ResponseWriter, r *http.Request) {
+	actorIRI, err := a.authenticate(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	var params draftParams
+	if err := decodeParams(r, &params); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	d := a.service.CreateDraft(r.Context(), actorIRI, service.StatusParams{
+		Status:   params.Status,
+		Language: params.Language,
+	})
+	writeJSON(w, http.StatusOK, newDraft(d))
+}
+
+// GET /api/v1/drafts/:id
+func (a *API) getDraft(w http.ResponseWriter, r *http.Request) {
+	actorIRI, err := a.authenticate(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	d, err := a.service.Draft(r.Context(), actorIRI, pathParam(r, "id"))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newDraft(d))
+}
+
+// PUT /api/v1/drafts/:id
+func (a *API) putDraft(w http.ResponseWriter, r *http.Request) {
+	actorIRI, err := a.authenticate(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	var params draftParams
+	if err := decodeParams(r, &params); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	d, err := a.service.UpdateDraft(r.Context(), actorIRI, pathParam(r, "id"), service.StatusParams{
+		Status:   params.Status,
+		Language: params.Language,
+	})
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newDraft(d))
+}
+
+// DELETE /api/v1/drafts/:id
+func (a *API) deleteDraft(w http.ResponseWriter, r *http.Request) {
+	actorIRI, err := a.authenticate(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	if err := a.service.DeleteDraft(r.Context(), actorIRI, pathParam(r, "id")); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, struct{}{})
+}
+
+// POST /api/v1/drafts/:id/publish
+func (a *API) postDraftPublish(w http.ResponseWriter, r *http.Request) {
+	actorIRI, err := a.authenticate(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	note, err := a.service.PublishDraft(r.Context(), actorIRI, pathParam(r, "id"))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newStatus(note, a.db))
+}
@@ -0,0 +1,216 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package api
+
+import (
+	"html"
+	"path"
+	"time"
+
+	"mastogon/internal/db"
+	"mastogon/internal/service"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// Status is the Mastodon representation of a note, or of any other object
+// presented like one.
+type Status struct {
+	ID          string  `json:"id"`
+	URI         string  `json:"uri"`
+	URL         string  `json:"url,omitempty"`
+	CreatedAt   string  `json:"created_at"`
+	InReplyToID *string `json:"in_reply_to_id"`
+	Content     string  `json:"content"`
+	Visibility  string  `json:"visibility"`
+	Sensitive   bool    `json:"sensitive"`
+	SpoilerText string  `json:"spoiler_text"`
+	// The ISO 639-1 language the status is in, if known.
+	Language *string `json:"language"`
+	// The ActivityStreams type of the object, as clients otherwise can't
+	// tell an Article or a Video from a Note.
+	Type string `json:"type"`
+	// Set for object types we don't really support, which are shown as best
+	// we can.
+	Unsupported bool `json:"unsupported,omitempty"`
+	// The viewer's filters matching the status, for the client to hide it
+	// behind a warning.
+	Filtered []Filter `json:"filtered,omitempty"`
+	// The status this one quotes, if any.
+	Quote *Quote `json:"quote,omitempty"`
+}
+
+// Quote is how Mastodon presents the status another quotes.
+type Quote struct {
+	// Whether the quote can be shown: "accepted", or "unauthorized" when
+	// the quoted status is out of the viewer's reach.
+	State        string  `json:"state"`
+	QuotedStatus *Status `json:"quoted_status"`
+}
+
+// newStatus presents `t` to Mastodon clients, with the IDs `d` has for it.
+func newStatus(t vocab.Type, d *db.DB) Status {
+	s := Status{
+		Visibility:  service.Visibility(t),
+		Type:        t.GetTypeName(),
+		Unsupported: !service.IsSupportedStatus(t),
+	}
+	if id := t.GetJSONLDId(); id != nil && id.Get() != nil {
+		s.ID = statusID(id.Get(), d)
+		s.URI = id.Get().String()
+	}
+	if o, ok := t.(interface {
+		GetActivityStreamsInReplyTo() vocab.ActivityStreamsInReplyToProperty
+	}); ok && o.GetActivityStreamsInReplyTo() != nil {
+		prop := o.GetActivityStreamsInReplyTo()
+		for iter := prop.Begin(); iter != prop.End(); iter = iter.Next() {
+			if parentIRI, err := pub.ToId(iter); err == nil {
+				parentID := statusID(parentIRI, d)
+				s.InReplyToID = &parentID
+				break
+			}
+		}
+	}
+	s.Sensitive = service.Sensitive(t)
+	if o, ok := t.(interface {
+		GetActivityStreamsPublished() vocab.ActivityStreamsPublishedProperty
+	}); ok && o.GetActivityStreamsPublished() != nil {
+		s.CreatedAt = o.GetActivityStreamsPublished().Get().UTC().Format(time.RFC3339)
+	}
+	if o, ok := t.(interface {
+		GetActivityStreamsUrl() vocab.ActivityStreamsUrlProperty
+	}); ok && o.GetActivityStreamsUrl() != nil {
+		for iter := o.GetActivityStreamsUrl().Begin(); iter != o.GetActivityStreamsUrl().End(); iter = iter.Next() {
+			if iter.IsXMLSchemaAnyURI() {
+				s.URL = iter.GetXMLSchemaAnyURI().String()
+				break
+			}
+		}
+	}
+	if o, ok := t.(interface {
+		GetActivityStreamsContent() vocab.ActivityStreamsContentProperty
+	}); ok && o.GetActivityStreamsContent() != nil {
+		for iter := o.GetActivityStreamsContent().Begin(); iter != o.GetActivityStreamsContent().End(); iter = iter.Next() {
+			if iter.IsXMLSchemaString() && s.Content == "" {
+				s.Content = iter.GetXMLSchemaString()
+			} else if iter.IsRDFLangString() && s.Language == nil {
+				for language, content := range iter.GetRDFLangString() {
+					language := language
+					s.Language = &language
+					if s.Content == "" {
+						s.Content = content
+					}
+					break
+				}
+			}
+		}
+	}
+	// Peers' HTML could carry anything, from scripts to styles that spoof
+	// ours.
+	if !local(t, d) {
+		s.Content = service.SanitizeHTML(s.Content)
+	}
+	// Like Mastodon, show anything longer-form than a note as its title
+	// linking to the original, rather than dumping the whole body inline.
+	if s.Type != "Note" {
+		if o, ok := t.(interface {
+			GetActivityStreamsName() vocab.ActivityStreamsNameProperty
+		}); ok && o.GetActivityStreamsName() != nil {
+			for iter := o.GetActivityStreamsName().Begin(); iter != o.GetActivityStreamsName().End(); iter = iter.Next() {
+				if iter.IsXMLSchemaString() {
+					link := s.URL
+					if link == "" {
+						link = s.URI
+					}
+					s.Content = "<p><a href=\"" + html.EscapeString(link) + "\">" +
+						html.EscapeString(iter.GetXMLSchemaString()) + "</a></p>"
+					break
+				}
+			}
+		}
+	}
+	return s
+}
+
+// local reports whether `t` is one of ours, rather than a peer's.
+func local(t vocab.Type, d *db.DB) bool {
+	id := t.GetJSONLDId()
+	return id != nil && id.Get() != nil && d.IsLocalHost(id.Get().Host)
+}
+
+// Account is the Mastodon representation of an actor.
+type Account struct {
+	ID          string `json:"id"`
+	Username    string `json:"username"`
+	Acct        string `json:"acct"`
+	DisplayName string `json:"display_name"`
+	Note        string `json:"note"`
+	URL         string `json:"url"`
+	Avatar      string `json:"avatar"`
+	Header      string `json:"header"`
+	Locked      bool   `json:"locked"`
+	// Set for automated actors: Services and Applications.
+	Bot bool `json:"bot"`
+	// Set for groups, such as Lemmy communities, whose posts are their
+	// members'.
+	Group bool `json:"group"`
+	// Whether the account may be found in directories and search, and
+	// isn't to be indexed by search engines if not.
+	Discoverable bool   `json:"discoverable"`
+	Noindex      bool   `json:"noindex"`
+	CreatedAt    string `json:"created_at"`
+	// Where the account went, if it moved, for clients to offer following
+	// it there.
+	Moved *Account `json:"moved,omitempty"`
+}
+
+// newAccount presents `person`, an actor of any type, to Mastodon clients.
+// Accounts on other hosts than ours get their domain appended to their acct.
+func newAccount(person db.Actor, d *db.DB) Account {
+	a := Account{
+		Bot:          person.GetTypeName() == "Service" || person.GetTypeName() == "Application",
+		Group:        person.GetTypeName() == "Group",
+		Discoverable: service.Discoverable(person),
+	}
+	a.Noindex = !a.Discoverable
+	hostname := d.Hostname()
+	host := hostname
+	if id := person.GetJSONLDId(); id != nil && id.Get() != nil {
+		a.ID = accountID(id.Get(), d)
+		a.URL = id.Get().String()
+		a.Username = path.Base(id.Get().Path)
+		host = id.Get().Host
+	}
+	if u := person.GetActivityStreamsPreferredUsername(); u != nil && u.IsXMLSchemaString() {
+		a.Username = u.GetXMLSchemaString()
+	}
+	a.Acct = a.Username
+	if host != hostname {
+		a.Acct += "@" + host
+	}
+	if n := person.GetActivityStreamsName(); n != nil {
+		for iter := n.Begin(); iter != n.End(); iter = iter.Next() {
+			if iter.IsXMLSchemaString() {
+				a.DisplayName = iter.GetXMLSchemaString()
+				break
+			}
+		}
+	}
+	if s := person.GetActivityStreamsSummary(); s != nil {
+		for iter := s.Begin(); iter != s.End(); iter = iter.Next() {
+			if iter.IsXMLSchemaString() {
+				a.Note = iter.GetXMLSchemaString()
+				break
+			}
+		}
+	}
+	if host != hostname {
+		a.Note = service.SanitizeHTML(a.Note)
+	}
+	if p := person.GetActivityStreamsPublished(); p != nil {
+		a.CreatedAt = p.Get().UTC().Format(time.RFC3339)
+	}
+	return a
+}
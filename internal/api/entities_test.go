@@ -0,0 +1,133 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package api
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"mastogon/internal/db"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// The hostname our test databases' actors live on.
+const testHostname = "mastogon.test"
+
+func newTestDB() *db.DB {
+	d := &db.DB{}
+	d.Construct(&sync.Map{}, testHostname)
+	return d
+}
+
+// object deserializes `m`, failing the test if it can't.
+func object(t *testing.T, m map[string]interface{}) vocab.Type {
+	t.Helper()
+	m["@context"] = "https://www.w3.org/ns/activitystreams"
+	o, err := streams.ToType(context.Background(), m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return o
+}
+
+func TestNewStatusTypes(t *testing.T) {
+	d := newTestDB()
+	for _, test := range []struct {
+		objectType  string
+		unsupported bool
+	}{
+		{"Note", false},
+		{"Article", false},
+		{"Video", false},
+		{"Page", false},
+		{"Document", true},
+	} {
+		t.Run(test.objectType, func(t *testing.T) {
+			s := newStatus(object(t, map[string]interface{}{
+				"id":      "https://remote.test/objects/1",
+				"type":    test.objectType,
+				"name":    "A title",
+				"content": "<p>The body</p>",
+			}), d)
+			if s.Type != test.objectType || s.Unsupported != test.unsupported {
+				t.Errorf("type %s, unsupported %v; want %s, %v", s.Type, s.Unsupported, test.objectType, test.unsupported)
+			}
+			want := "<p>The body</p>"
+			if test.objectType != "Note" {
+				want = `<p><a href="https://remote.test/objects/1">A title</a></p>`
+			}
+			if s.Content != want {
+				t.Errorf("content %q, want %q", s.Content, want)
+			}
+		})
+	}
+}
+
+func TestNewStatusSanitizesPeersHTML(t *testing.T) {
+	d := newTestDB()
+	html := `<p onmouseover="steal()">hi</p><script>steal()</script>`
+	remote := newStatus(object(t, map[string]interface{}{
+		"id":      "https://remote.test/notes/1",
+		"type":    "Note",
+		"content": html,
+	}), d)
+	if remote.Content != "<p>hi</p>" {
+		t.Errorf("a peer's note shown as %q", remote.Content)
+	}
+	// Ours are as we wrote them.
+	local := newStatus(object(t, map[string]interface{}{
+		"id":      "https://" + testHostname + "/note/1",
+		"type":    "Note",
+		"content": `<p class="quote-inline">hi</p>`,
+	}), d)
+	if local.Content != `<p class="quote-inline">hi</p>` {
+		t.Errorf("our note shown as %q", local.Content)
+	}
+}
+
+func TestNewAccountSanitizesPeersBios(t *testing.T) {
+	d := newTestDB()
+	person := object(t, map[string]interface{}{
+		"id":      "https://remote.test/users/bob",
+		"type":    "Person",
+		"summary": `<p>bob</p><img src="https://evil.test/track.gif">`,
+	})
+	if a := newAccount(person.(db.Actor), d); a.Note != "<p>bob</p>" {
+		t.Errorf("a peer's bio shown as %q", a.Note)
+	}
+}
+
+func TestNewAccountActorTypes(t *testing.T) {
+	d := newTestDB()
+	for _, test := range []struct {
+		actorType  string
+		bot, group bool
+	}{
+		{"Person", false, false},
+		{"Service", true, false},
+		{"Application", true, false},
+		{"Group", false, true},
+	} {
+		actor, ok := db.ToActor(object(t, map[string]interface{}{
+			"id":                "https://remote.test/users/" + test.actorType,
+			"type":              test.actorType,
+			"preferredUsername": "someone",
+			"name":              "Someone",
+		}))
+		if !ok {
+			t.Errorf("a %s isn't an actor", test.actorType)
+			continue
+		}
+		a := newAccount(actor, d)
+		if a.Bot != test.bot || a.Group != test.group {
+			t.Errorf("a %s shown with bot %t and group %t, want %t and %t", test.actorType, a.Bot, a.Group, test.bot, test.group)
+		}
+		if a.Acct != "someone@remote.test" || a.DisplayName != "Someone" {
+			t.Errorf("a %s shown as %s, %q", test.actorType, a.Acct, a.DisplayName)
+		}
+	}
+}
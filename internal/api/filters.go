@@ -0,0 +1,146 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"mastogon/internal/db"
+	"mastogon/internal/service"
+)
+
+// Filter is the Mastodon representation of a filter.
+type Filter struct {
+	ID           string   `json:"id"`
+	Phrase       string   `json:"phrase"`
+	Context      []string `json:"context"`
+	WholeWord    bool     `json:"whole_word"`
+	ExpiresAt    *string  `json:"expires_at"`
+	Irreversible bool     `json:"irreversible"`
+	// Not in Mastodon: the phrase is a regular expression.
+	Regex bool `json:"regex"`
+}
+
+func newFilter(f *db.Filter) Filter {
+	filter := Filter{
+		ID:           f.ID,
+		Phrase:       f.Phrase,
+		Context:      f.Contexts,
+		WholeWord:    f.WholeWord,
+		Irreversible: f.Irreversible,
+		Regex:        f.Regex,
+	}
+	if !f.ExpiresAt.IsZero() {
+		expiresAt := f.ExpiresAt.UTC().Format(time.RFC3339)
+		filter.ExpiresAt = &expiresAt
+	}
+	return filter
+}
+
+// decodeFilterParams reads the parameters of a request creating or changing a
+// filter, writing the response if they don't make sense.
+func decodeFilterParams(w http.ResponseWriter, r *http.Request) (service.FilterParams, bool) {
+	var params struct {
+		Phrase       string   `json:"phrase"`
+		Context      []string `json:"context"`
+		Irreversible bool     `json:"irreversible"`
+		WholeWord    bool     `json:"whole_word"`
+		ExpiresIn    int      `json:"expires_in"`
+		Regex        bool     `json:"regex"`
+	}
+	if err := decodeParams(r, &params); err != nil {
+		writeServiceError(w, err)
+		return service.FilterParams{}, false
+	}
+	return service.FilterParams{
+		Phrase:       params.Phrase,
+		Regex:        params.Regex,
+		WholeWord:    params.WholeWord,
+		Contexts:     params.Context,
+		Irreversible: params.Irreversible,
+		ExpiresIn:    time.Duration(params.ExpiresIn) * time.Second,
+	}, true
+}
+
+// GET /api/v1/filters
+func (a *API) getFilters(w http.ResponseWriter, r *http.Request) {
+	actorIRI, err := a.authenticate(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	filters := []Filter{}
+	for _, f := range a.service.Filters(r.Context(), actorIRI) {
+		filters = append(filters, newFilter(f))
+	}
+	writeJSON(w, http.StatusOK, filters)
+}
+
+// POST /api/v1/filters
+func (a *API) postFilter(w http.ResponseWriter, r *http.Request) {
+	actorIRI, err := a.authenticate(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	params, ok := decodeFilterParams(w, r)
+	if !ok {
+		return
+	}
+	f, err := a.service.CreateFilter(r.Context(), actorIRI, params)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newFilter(f))
+}
+
+// GET /api/v1/filters/:id
+func (a *API) getFilter(w http.ResponseWriter, r *http.Request) {
+	actorIRI, err := a.authenticate(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	f, err := a.service.Filter(r.Context(), actorIRI, pathParam(r, "id"))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newFilter(f))
+}
+
+// PUT /api/v1/filters/:id
+func (a *API) putFilter(w http.ResponseWriter, r *http.Request) {
+	actorIRI, err := a.authenticate(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	params, ok := decodeFilterParams(w, r)
+	if !ok {
+		return
+	}
+	f, err := a.service.UpdateFilter(r.Context(), actorIRI, pathParam(r, "id"), params)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newFilter(f))
+}
+
+// DELETE /api/v1/filters/:id
+func (a *API) deleteFilter(w http.ResponseWriter, r *http.Request) {
+	actorIRI, err := a.authenticate(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	if err := a.service.DeleteFilter(r.Context(), actorIRI, pathParam(r, "id")); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, struct{}{})
+}
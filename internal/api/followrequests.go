@@ -0,0 +1,58 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// GET /api/v1/follow_requests
+func (a *API) getFollowRequests(w http.ResponseWriter, r *http.Request) {
+	actorIRI, err := a.authenticate(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	a.writeAccountPage(w, r, a.service.FollowRequests(actorIRI))
+}
+
+// POST /api/v1/follow_requests/:id/authorize
+func (a *API) postFollowRequestAuthorize(w http.ResponseWriter, r *http.Request) {
+	a.answerFollowRequest(w, r, a.service.AuthorizeFollowRequest)
+}
+
+// POST /api/v1/follow_requests/:id/reject
+func (a *API) postFollowRequestReject(w http.ResponseWriter, r *http.Request) {
+	a.answerFollowRequest(w, r, a.service.RejectFollowRequest)
+}
+
+// answerFollowRequest has `answer` answer the request to follow the user of
+// the account in the path, and replies with how they now stand.
+func (a *API) answerFollowRequest(w http.ResponseWriter,
+	r *http.Request,
+	answer func(c context.Context, actorIRI, followerIRI *url.URL) error) {
+	c := r.Context()
+	actorIRI, err := a.authenticate(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	followerIRI, err := a.actorForAccountID(c, pathParam(r, "id"))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	if err := answer(c, actorIRI, followerIRI); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	rel, err := a.relationship(c, actorIRI, followerIRI)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, rel)
+}
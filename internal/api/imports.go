@@ -0,0 +1,113 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package api
+
+import (
+	"io"
+	"mime"
+	"net/http"
+
+	"mastogon/internal/service"
+)
+
+// The largest import file we accept.
+const maxImportSize = 10 << 20
+
+// importFile returns the CSV of an import request, uploaded either as the
+// `data` field of a multipart form, the way Mastodon's own settings page does,
+// or as the raw request body.
+func importFile(w http.ResponseWriter, r *http.Request) (io.Reader, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return http.MaxBytesReader(w, r.Body, maxImportSize), nil
+	}
+	if err := r.ParseMultipartForm(maxImportSize); err != nil {
+		return nil, &service.ParseError{Err: err}
+	}
+	f, _, err := r.FormFile("data")
+	if err != nil {
+		return nil, &service.ParseError{Err: err}
+	}
+	return f, nil
+}
+
+// POST /api/v1/follow_requests/import
+func (a *API) postFollowImport(w http.ResponseWriter, r *http.Request) {
+	actorIRI, err := a.authenticate(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	f, err := importFile(w, r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	results, err := a.service.ImportFollows(r.Context(), actorIRI, f)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
+// POST /api/v1/blocks/import
+func (a *API) postBlockImport(w http.ResponseWriter, r *http.Request) {
+	actorIRI, err := a.authenticate(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	f, err := importFile(w, r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	results, err := a.service.ImportBlocks(r.Context(), actorIRI, f)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
+// GET /api/v1/blocks/export
+func (a *API) getBlockExport(w http.ResponseWriter, r *http.Request) {
+	actorIRI, err := a.authenticate(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="blocked_accounts.csv"`)
+	a.service.ExportBlocks(r.Context(), actorIRI, w)
+}
+
+// POST /api/v1/admin/domain_blocks/import
+func (a *API) postDomainBlockImport(w http.ResponseWriter, r *http.Request) {
+	if !a.authenticateAdmin(w, r) {
+		return
+	}
+	f, err := importFile(w, r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	results, err := a.service.ImportDomainBlocks(r.Context(), f)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
+// GET /api/v1/admin/domain_blocks/export
+func (a *API) getDomainBlockExport(w http.ResponseWriter, r *http.Request) {
+	if !a.authenticateAdmin(w, r) {
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="domain_blocks.csv"`)
+	a.service.ExportDomainBlocks(r.Context(), w)
+}
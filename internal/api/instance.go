@@ -0,0 +1,115 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"mastogon/internal/db"
+	"mastogon/internal/service"
+)
+
+// Clients sniff the Mastodon version to decide which features to offer, so we
+// claim the API level we implement.
+const Version = "4.0.0 (compatible; Mastogon 0.1.0)"
+
+// Instance is the Mastodon representation of this server.
+type Instance struct {
+	URI              string                `json:"uri"`
+	Title            string                `json:"title"`
+	ShortDescription string                `json:"short_description"`
+	Description      string                `json:"description"`
+	Email            string                `json:"email"`
+	Version          string                `json:"version"`
+	Languages        []string              `json:"languages"`
+	Registrations    bool                  `json:"registrations"`
+	ApprovalRequired bool                  `json:"approval_required"`
+	InvitesEnabled   bool                  `json:"invites_enabled"`
+	Stats            InstanceStats         `json:"stats"`
+	Configuration    InstanceConfiguration `json:"configuration"`
+	ContactAccount   *Account              `json:"contact_account"`
+}
+
+type InstanceStats struct {
+	UserCount   int `json:"user_count"`
+	StatusCount int `json:"status_count"`
+	DomainCount int `json:"domain_count"`
+}
+
+type InstanceConfiguration struct {
+	Statuses struct {
+		MaxCharacters            int `json:"max_characters"`
+		MaxMediaAttachments      int `json:"max_media_attachments"`
+		CharactersReservedPerURL int `json:"characters_reserved_per_url"`
+	} `json:"statuses"`
+	MediaAttachments struct {
+		ImageSizeLimit int `json:"image_size_limit"`
+		VideoSizeLimit int `json:"video_size_limit"`
+	} `json:"media_attachments"`
+	Polls struct {
+		MaxOptions             int `json:"max_options"`
+		MaxCharactersPerOption int `json:"max_characters_per_option"`
+		MinExpiration          int `json:"min_expiration"`
+		MaxExpiration          int `json:"max_expiration"`
+	} `json:"polls"`
+}
+
+// GET /api/v1/instance
+func (a *API) getInstance(w http.ResponseWriter, r *http.Request) {
+	c := r.Context()
+	config := a.service.Config()
+	i := Instance{
+		URI:              a.service.AccountDomain(),
+		Title:            config.Title,
+		ShortDescription: config.Description,
+		Description:      config.Description,
+		Email:            config.ContactEmail,
+		Version:          Version,
+		Languages:        []string{},
+		Registrations:    config.RegistrationsOpen,
+	}
+	var err error
+	i.Stats.UserCount, i.Stats.StatusCount, i.Stats.DomainCount, err = a.db.Stats(c)
+	if err != nil {
+		writeServiceError(w, fmt.Errorf("%w: %s", service.ErrUnavailable, err))
+		return
+	}
+
+	i.Configuration.Statuses.MaxCharacters = config.MaxNoteChars
+	i.Configuration.Statuses.MaxMediaAttachments = config.MaxMediaAttachments
+	i.Configuration.Statuses.CharactersReservedPerURL = service.URLWeight
+	i.Configuration.MediaAttachments.ImageSizeLimit = config.ImageSizeLimit
+	i.Configuration.MediaAttachments.VideoSizeLimit = config.VideoSizeLimit
+	i.Configuration.Polls.MaxOptions = config.MaxPollOptions
+	i.Configuration.Polls.MaxCharactersPerOption = config.MaxPollOptionChars
+	i.Configuration.Polls.MinExpiration = int(config.MinPollExpiration.Seconds())
+	i.Configuration.Polls.MaxExpiration = int(config.MaxPollExpiration.Seconds())
+
+	if config.ContactUsername != "" {
+		if actorIRI, err := a.db.ActorForUsername(c, config.ContactUsername); err == nil {
+			if t, err := a.db.Get(c, actorIRI); err == nil {
+				if actor, ok := db.ToActor(t); ok {
+					account := newAccount(actor, a.db)
+					i.ContactAccount = &account
+				}
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, i)
+}
+
+// GET /api/v1/instance/peers
+func (a *API) getInstancePeers(w http.ResponseWriter, r *http.Request) {
+	peers, err := a.service.Peers(r.Context())
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	domains := make([]string, 0, len(peers))
+	for _, p := range peers {
+		domains = append(domains, p.Domain)
+	}
+	writeJSON(w, http.StatusOK, domains)
+}
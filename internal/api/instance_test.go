@@ -0,0 +1,47 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"mastogon/internal/service"
+)
+
+func TestGetInstance(t *testing.T) {
+	a, _, bob := newTestAPI(t, func(config *service.Config) {
+		config.Title = "Mastogon Test"
+		config.Description = "A test instance"
+		config.ContactEmail = "admin@" + testHostname
+		config.ContactUsername = "alice"
+		config.MaxNoteChars = 1000
+		config.MaxPollExpiration = 24 * time.Hour
+	})
+	if w := call(t, a, http.MethodPost, "/api/v1/statuses", bob, `{"status":"hello"}`); w.Code != http.StatusOK {
+		t.Fatalf("posting: %d %s", w.Code, w.Body)
+	}
+
+	var i Instance
+	decode(t, call(t, a, http.MethodGet, "/api/v1/instance", "", ""), &i)
+	if i.URI != testHostname || i.Title != "Mastogon Test" || i.ShortDescription != "A test instance" || i.Email != "admin@"+testHostname {
+		t.Errorf("instance %+v", i)
+	}
+	if i.Version != Version || !i.Registrations {
+		t.Errorf("version %q, registrations %t", i.Version, i.Registrations)
+	}
+	if i.Stats.UserCount != 2 || i.Stats.StatusCount != 1 || i.Stats.DomainCount != 0 {
+		t.Errorf("stats %+v, want 2 users and 1 status", i.Stats)
+	}
+	if got := i.Configuration.Statuses.MaxCharacters; got != 1000 {
+		t.Errorf("max characters %d, want 1000", got)
+	}
+	if got := i.Configuration.Polls.MaxExpiration; got != 24*60*60 {
+		t.Errorf("max poll expiration %d, want a day", got)
+	}
+	if i.ContactAccount == nil || i.ContactAccount.Username != "alice" {
+		t.Errorf("contact account %+v, want alice", i.ContactAccount)
+	}
+}
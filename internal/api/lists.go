@@ -0,0 +1,196 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package api
+
+import (
+	"net/http"
+	"net/url"
+
+	"mastogon/internal/db"
+	"mastogon/internal/service"
+)
+
+// List is the Mastodon representation of a list.
+type List struct {
+	ID            string `json:"id"`
+	Title         string `json:"title"`
+	RepliesPolicy string `json:"replies_policy"`
+}
+
+func newList(l *db.List) List {
+	return List{ID: l.ID, Title: l.Title, RepliesPolicy: l.RepliesPolicy}
+}
+
+type listParams struct {
+	Title         string `json:"title"`
+	RepliesPolicy string `json:"replies_policy"`
+}
+
+// GET /api/v1/lists
+func (a *API) getLists(w http.ResponseWriter, r *http.Request) {
+	actorIRI, err := a.authenticate(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	lists := []List{}
+	for _, l := range a.service.Lists(r.Context(), actorIRI) {
+		lists = append(lists, newList(l))
+	}
+	writeJSON(w, http.StatusOK, lists)
+}
+
+// POST /api/v1/lists
+func (a *API) postList(w http.ResponseWriter, r *http.Request) {
+	actorIRI, err := a.authenticate(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	var params listParams
+	if err := decodeParams(r, &params); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	l, err := a.service.CreateList(r.Context(), actorIRI, service.ListParams{
+		Title:         params.Title,
+		RepliesPolicy: params.RepliesPolicy,
+	})
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newList(l))
+}
+
+// GET /api/v1/lists/:id
+func (a *API) getList(w http.ResponseWriter, r *http.Request) {
+	actorIRI, err := a.authenticate(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	l, err := a.service.List(r.Context(), actorIRI, pathParam(r, "id"))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newList(l))
+}
+
+// PUT /api/v1/lists/:id
+func (a *API) putList(w http.ResponseWriter, r *http.Request) {
+	actorIRI, err := a.authenticate(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	var params listParams
+	if err := decodeParams(r, &params); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	l, err := a.service.UpdateList(r.Context(), actorIRI, pathParam(r, "id"), service.ListParams{
+		Title:         params.Title,
+		RepliesPolicy: params.RepliesPolicy,
+	})
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newList(l))
+}
+
+// DELETE /api/v1/lists/:id
+func (a *API) deleteList(w http.ResponseWriter, r *http.Request) {
+	actorIRI, err := a.authenticate(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	if err := a.service.DeleteList(r.Context(), actorIRI, pathParam(r, "id")); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, struct{}{})
+}
+
+// GET /api/v1/lists/:id/accounts
+func (a *API) getListAccounts(w http.ResponseWriter, r *http.Request) {
+	actorIRI, err := a.authenticate(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	l, err := a.service.List(r.Context(), actorIRI, pathParam(r, "id"))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	accounts := []Account{}
+	for _, member := range l.Members {
+		if memberIRI, err := url.Parse(member); err == nil {
+			accounts = append(accounts, a.account(r.Context(), memberIRI))
+		}
+	}
+	writeJSON(w, http.StatusOK, accounts)
+}
+
+// listMembers decodes the `account_ids` of a request editing a list's
+// members, writing the response if they don't make sense.
+func (a *API) listMembers(w http.ResponseWriter, r *http.Request) ([]*url.URL, bool) {
+	var params struct {
+		AccountIDs []string `json:"account_ids"`
+	}
+	if err := decodeParams(r, &params); err != nil {
+		writeServiceError(w, err)
+		return nil, false
+	}
+	memberIRIs := make([]*url.URL, 0, len(params.AccountIDs))
+	for _, id := range params.AccountIDs {
+		memberIRI, err := a.actorForAccountID(r.Context(), id)
+		if err != nil {
+			writeServiceError(w, err)
+			return nil, false
+		}
+		memberIRIs = append(memberIRIs, memberIRI)
+	}
+	return memberIRIs, true
+}
+
+// POST /api/v1/lists/:id/accounts
+func (a *API) postListAccounts(w http.ResponseWriter, r *http.Request) {
+	actorIRI, err := a.authenticate(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	memberIRIs, ok := a.listMembers(w, r)
+	if !ok {
+		return
+	}
+	if err := a.service.AddToList(r.Context(), actorIRI, pathParam(r, "id"), memberIRIs); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, struct{}{})
+}
+
+// DELETE /api/v1/lists/:id/accounts
+func (a *API) deleteListAccounts(w http.ResponseWriter, r *http.Request) {
+	actorIRI, err := a.authenticate(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	memberIRIs, ok := a.listMembers(w, r)
+	if !ok {
+		return
+	}
+	if err := a.service.RemoveFromList(r.Context(), actorIRI, pathParam(r, "id"), memberIRIs); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, struct{}{})
+}
@@ -0,0 +1,93 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package api
+
+import (
+	"net/http"
+)
+
+// Mastodon only lets people set up a move from its web interface, so these
+// follow Akkoma's API instead.
+
+// Aliases is the accounts an account is also known as, by IRI.
+type Aliases struct {
+	Aliases []string `json:"aliases"`
+}
+
+// GET /api/pleroma/aliases
+func (a *API) getAliases(w http.ResponseWriter, r *http.Request) {
+	actorIRI, err := a.authenticate(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	aliases, err := a.service.Aliases(r.Context(), actorIRI)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	resp := Aliases{Aliases: []string{}}
+	for _, alias := range aliases {
+		resp.Aliases = append(resp.Aliases, alias.String())
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// PUT /api/pleroma/aliases
+func (a *API) putAlias(w http.ResponseWriter, r *http.Request) {
+	a.editAlias(w, r, true)
+}
+
+// DELETE /api/pleroma/aliases
+func (a *API) deleteAlias(w http.ResponseWriter, r *http.Request) {
+	a.editAlias(w, r, false)
+}
+
+// editAlias adds the `alias` given in `r`, an account as `user@domain` or
+// by IRI, to the user's aliases, or takes it out.
+func (a *API) editAlias(w http.ResponseWriter, r *http.Request, add bool) {
+	actorIRI, err := a.authenticate(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	var params struct {
+		Alias string `json:"alias"`
+	}
+	if err := decodeParams(r, &params); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	if add {
+		err = a.service.AddAlias(r.Context(), actorIRI, params.Alias)
+	} else {
+		err = a.service.RemoveAlias(r.Context(), actorIRI, params.Alias)
+	}
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// POST /api/pleroma/move_account
+func (a *API) postMoveAccount(w http.ResponseWriter, r *http.Request) {
+	actorIRI, err := a.authenticate(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	var params struct {
+		TargetAccount string `json:"target_account"`
+	}
+	if err := decodeParams(r, &params); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	if err := a.service.MoveAccount(r.Context(), actorIRI, params.TargetAccount); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
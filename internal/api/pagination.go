@@ -0,0 +1,72 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// paginate picks out the page of `ids`, newest first, that `r` asks for
+// through Mastodon's `max_id`, `min_id` and `limit` parameters, and sets the
+// `Link` header pointing at the pages either side. It returns the bounds of
+// the page within `ids`.
+func (a *API) paginate(w http.ResponseWriter, r *http.Request, ids []string) (start, end int) {
+	limit := timelineLimit(r)
+	q := r.URL.Query()
+	indexOf := func(id string) int {
+		for i, e := range ids {
+			if e == id {
+				return i
+			}
+		}
+		return -1
+	}
+	switch {
+	case q.Get("max_id") != "":
+		// Strictly older than max_id.
+		start = indexOf(q.Get("max_id")) + 1
+		if start == 0 {
+			start = len(ids)
+		}
+		end = start + limit
+	case q.Get("min_id") != "":
+		// Just newer than min_id.
+		end = indexOf(q.Get("min_id"))
+		if end < 0 {
+			end = 0
+		}
+		start = end - limit
+	default:
+		end = limit
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end > len(ids) {
+		end = len(ids)
+	}
+	if start > end {
+		start = end
+	}
+
+	var links []string
+	link := func(param, id, rel string) {
+		u := url.URL{Scheme: "https", Host: a.db.Hostname(), Path: r.URL.Path}
+		u.RawQuery = url.Values{param: {id}, "limit": {fmt.Sprint(limit)}}.Encode()
+		links = append(links, fmt.Sprintf("<%s>; rel=\"%s\"", u.String(), rel))
+	}
+	if end < len(ids) && end > start {
+		link("max_id", ids[end-1], "next")
+	}
+	if start > 0 && end > start {
+		link("min_id", ids[start], "prev")
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+	return
+}
@@ -0,0 +1,61 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestPaginate(t *testing.T) {
+	a, _, _ := newTestAPI(t)
+	ids := []string{"e", "d", "c", "b", "a"}
+	for _, test := range []struct {
+		query string
+		page  []string
+		link  string
+	}{
+		{"limit=2", []string{"e", "d"},
+			`<https://` + testHostname + `/api/v1/accounts/alice/followers?limit=2&max_id=d>; rel="next"`},
+		{"limit=2&max_id=d", []string{"c", "b"},
+			`<https://` + testHostname + `/api/v1/accounts/alice/followers?limit=2&max_id=b>; rel="next", ` +
+				`<https://` + testHostname + `/api/v1/accounts/alice/followers?limit=2&min_id=c>; rel="prev"`},
+		{"limit=2&max_id=b", []string{"a"},
+			`<https://` + testHostname + `/api/v1/accounts/alice/followers?limit=2&min_id=a>; rel="prev"`},
+		{"limit=2&min_id=b", []string{"d", "c"},
+			`<https://` + testHostname + `/api/v1/accounts/alice/followers?limit=2&max_id=c>; rel="next", ` +
+				`<https://` + testHostname + `/api/v1/accounts/alice/followers?limit=2&min_id=d>; rel="prev"`},
+		{"max_id=a", []string{}, ""},
+		{"max_id=unknown", []string{}, ""},
+		{"", ids, ""},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/accounts/alice/followers?"+test.query, nil)
+		start, end := a.paginate(w, r, ids)
+		if page := ids[start:end]; !reflect.DeepEqual(page, test.page) {
+			t.Errorf("%q: page %v, want %v", test.query, page, test.page)
+		}
+		if link := w.Header().Get("Link"); link != test.link {
+			t.Errorf("%q: Link %s, want %s", test.query, link, test.link)
+		}
+	}
+}
+
+func TestGetFollowers(t *testing.T) {
+	a, alice, bob := newTestAPI(t)
+	var accounts []Account
+	decode(t, call(t, a, http.MethodGet, "/api/v1/accounts/alice/followers", "", ""), &accounts)
+	if len(accounts) != 0 {
+		t.Errorf("followers %+v, want none", accounts)
+	}
+	decode(t, call(t, a, http.MethodGet, "/api/v1/accounts/bob/following", alice, ""), &accounts)
+	if len(accounts) != 0 {
+		t.Errorf("following %+v, want none", accounts)
+	}
+	if w := call(t, a, http.MethodGet, "/api/v1/accounts/nobody/followers", bob, ""); w.Code != http.StatusNotFound {
+		t.Errorf("followers of nobody: %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,98 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"mastogon/internal/service"
+)
+
+// Peer is an instance we know of, and what it runs. Mastodon has no such
+// thing; this is our own.
+type Peer struct {
+	Domain   string  `json:"domain"`
+	Software *string `json:"software"`
+	Version  *string `json:"version"`
+	// When we first dealt with the peer since we started, if we have.
+	FirstSeenAt *string `json:"first_seen_at"`
+}
+
+func newPeer(p service.Peer) Peer {
+	peer := Peer{Domain: p.Domain, FirstSeenAt: optionalTime(p.FirstSeen)}
+	if p.Software != "" {
+		software, version := p.Software, p.Version
+		peer.Software, peer.Version = &software, &version
+	}
+	return peer
+}
+
+// InstanceHealth is how our deliveries to a peer have been going. Mastodon
+// has no such thing; this is our own.
+type InstanceHealth struct {
+	Domain              string  `json:"domain"`
+	Successes           int     `json:"successes"`
+	Failures            int     `json:"failures"`
+	ConsecutiveFailures int     `json:"consecutive_failures"`
+	AverageLatencyMs    int64   `json:"average_latency_ms"`
+	LastSuccessAt       *string `json:"last_success_at"`
+	LastFailureAt       *string `json:"last_failure_at"`
+	// Set while we're holding off delivering to the peer.
+	UnavailableUntil *string `json:"unavailable_until"`
+}
+
+func newInstanceHealth(h service.InstanceHealth, now time.Time) InstanceHealth {
+	health := InstanceHealth{
+		Domain:              h.Domain,
+		Successes:           h.Successes,
+		Failures:            h.Failures,
+		ConsecutiveFailures: h.ConsecutiveFailures,
+		AverageLatencyMs:    h.AverageLatency.Milliseconds(),
+		LastSuccessAt:       optionalTime(h.LastSuccess),
+		LastFailureAt:       optionalTime(h.LastFailure),
+	}
+	if h.UnavailableUntil.After(now) {
+		health.UnavailableUntil = optionalTime(h.UnavailableUntil)
+	}
+	return health
+}
+
+// optionalTime formats `t`, or returns nil if it's the zero time.
+func optionalTime(t time.Time) *string {
+	if t.IsZero() {
+		return nil
+	}
+	s := t.UTC().Format(time.RFC3339)
+	return &s
+}
+
+// GET /api/v1/admin/instances/health
+func (a *API) getInstancesHealth(w http.ResponseWriter, r *http.Request) {
+	if !a.authenticateAdmin(w, r) {
+		return
+	}
+	all := []InstanceHealth{}
+	for _, h := range a.service.InstancesHealth() {
+		all = append(all, newInstanceHealth(h, a.service.Now()))
+	}
+	writeJSON(w, http.StatusOK, all)
+}
+
+// GET /api/v1/admin/instances
+func (a *API) getAdminInstances(w http.ResponseWriter, r *http.Request) {
+	if !a.authenticateAdmin(w, r) {
+		return
+	}
+	peers, err := a.service.Peers(r.Context())
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	all := make([]Peer, 0, len(peers))
+	for _, p := range peers {
+		all = append(all, newPeer(p))
+	}
+	writeJSON(w, http.StatusOK, all)
+}
@@ -0,0 +1,74 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"mastogon/internal/service"
+)
+
+func TestNewInstanceHealth(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	h := service.InstanceHealth{
+		Domain:              "remote.test",
+		Failures:            3,
+		ConsecutiveFailures: 3,
+		AverageLatency:      1500 * time.Millisecond,
+		LastFailure:         now.Add(-time.Minute),
+		UnavailableUntil:    now.Add(time.Hour),
+	}
+	health := newInstanceHealth(h, now)
+	if health.AverageLatencyMs != 1500 || health.LastSuccessAt != nil || *health.LastFailureAt != "2026-10-01T11:59:00Z" {
+		t.Errorf("health %+v", health)
+	}
+	if health.UnavailableUntil == nil || *health.UnavailableUntil != "2026-10-01T13:00:00Z" {
+		t.Errorf("unavailable until %v, want an hour from now", health.UnavailableUntil)
+	}
+	// A breaker past its cooldown isn't shown as open.
+	if health := newInstanceHealth(h, now.Add(2*time.Hour)); health.UnavailableUntil != nil {
+		t.Errorf("unavailable until %s after the cooldown", *health.UnavailableUntil)
+	}
+}
+
+func TestGetInstancesHealth(t *testing.T) {
+	a, alice, bob := newTestAPI(t)
+	var health []InstanceHealth
+	decode(t, call(t, a, http.MethodGet, "/api/v1/admin/instances/health", alice, ""), &health)
+	if health == nil || len(health) != 0 {
+		t.Errorf("health %+v, want an empty list", health)
+	}
+	if w := call(t, a, http.MethodGet, "/api/v1/admin/instances/health", bob, ""); w.Code != http.StatusForbidden {
+		t.Errorf("health for a user who isn't an admin: %d, want 403", w.Code)
+	}
+}
+
+func TestGetPeers(t *testing.T) {
+	a, alice, bob := newTestAPI(t)
+	var domains []string
+	decode(t, call(t, a, http.MethodGet, "/api/v1/instance/peers", "", ""), &domains)
+	if domains == nil || len(domains) != 0 {
+		t.Errorf("peers %v, want an empty list", domains)
+	}
+	var peers []Peer
+	decode(t, call(t, a, http.MethodGet, "/api/v1/admin/instances", alice, ""), &peers)
+	if peers == nil || len(peers) != 0 {
+		t.Errorf("instances %+v, want an empty list", peers)
+	}
+	if w := call(t, a, http.MethodGet, "/api/v1/admin/instances", bob, ""); w.Code != http.StatusForbidden {
+		t.Errorf("instances for a user who isn't an admin: %d, want 403", w.Code)
+	}
+}
+
+func TestNewPeer(t *testing.T) {
+	if p := newPeer(service.Peer{Domain: "remote.test"}); p.Software != nil || p.Version != nil || p.FirstSeenAt != nil {
+		t.Errorf("peer we know nothing of shown as %+v", p)
+	}
+	p := newPeer(service.Peer{Domain: "remote.test", Software: "mastodon", Version: "4.3.0", FirstSeen: time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)})
+	if p.Software == nil || *p.Software != "mastodon" || *p.Version != "4.3.0" || *p.FirstSeenAt != "2026-10-01T12:00:00Z" {
+		t.Errorf("peer shown as %+v", p)
+	}
+}
@@ -0,0 +1,36 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package api
+
+import "net/http"
+
+// Preferences is the Mastodon representation of a user's preferences, keyed
+// the way Mastodon keys them.
+type Preferences struct {
+	Visibility     string `json:"posting:default:visibility"`
+	Sensitive      bool   `json:"posting:default:sensitive"`
+	Language       string `json:"posting:default:language"`
+	ExpandMedia    string `json:"reading:expand:media"`
+	ExpandSpoilers bool   `json:"reading:expand:spoilers"`
+}
+
+// GET /api/v1/preferences
+func (a *API) getPreferences(w http.ResponseWriter, r *http.Request) {
+	actorIRI, err := a.authenticate(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	prefs, err := a.service.Preferences(r.Context(), actorIRI)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, Preferences{
+		Visibility:  prefs.Visibility,
+		Sensitive:   prefs.Sensitive,
+		Language:    prefs.Language,
+		ExpandMedia: "default",
+	})
+}
@@ -0,0 +1,101 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// Relationship is the Mastodon representation of how the user stands with
+// another account.
+type Relationship struct {
+	ID         string `json:"id"`
+	Following  bool   `json:"following"`
+	FollowedBy bool   `json:"followed_by"`
+	Blocking   bool   `json:"blocking"`
+	BlockedBy  bool   `json:"blocked_by"`
+	Muting     bool   `json:"muting"`
+	Requested  bool   `json:"requested"`
+	Note       string `json:"note"`
+}
+
+// relationship presents how the local actor at `actorIRI` stands with
+// `targetIRI`.
+func (a *API) relationship(c context.Context, actorIRI, targetIRI *url.URL) (Relationship, error) {
+	rel, err := a.service.Relationship(c, actorIRI, targetIRI)
+	if err != nil {
+		return Relationship{}, err
+	}
+	return Relationship{
+		ID:         accountID(targetIRI, a.db),
+		Following:  rel.Following,
+		FollowedBy: rel.FollowedBy,
+		Blocking:   rel.Blocking,
+		BlockedBy:  rel.BlockedBy,
+		Muting:     rel.Muting,
+		Requested:  rel.Requested,
+		Note:       rel.Note,
+	}, nil
+}
+
+// GET /api/v1/accounts/relationships
+func (a *API) getRelationships(w http.ResponseWriter, r *http.Request) {
+	actorIRI, err := a.authenticate(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	ids := r.URL.Query()["id[]"]
+	if ids == nil {
+		ids = r.URL.Query()["id"]
+	}
+	relationships := []Relationship{}
+	for _, id := range ids {
+		targetIRI, err := a.actorForAccountID(r.Context(), id)
+		if err != nil {
+			// Like Mastodon, skip accounts we don't know.
+			continue
+		}
+		rel, err := a.relationship(r.Context(), actorIRI, targetIRI)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		relationships = append(relationships, rel)
+	}
+	writeJSON(w, http.StatusOK, relationships)
+}
+
+// POST /api/v1/accounts/:id/note
+func (a *API) postAccountNote(w http.ResponseWriter, r *http.Request) {
+	actorIRI, err := a.authenticate(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	targetIRI, err := a.actorForAccountID(r.Context(), pathParam(r, "id"))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	var params struct {
+		Comment string `json:"comment"`
+	}
+	if err := decodeParams(r, &params); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	if err := a.service.SetAccountNote(r.Context(), actorIRI, targetIRI, params.Comment); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	rel, err := a.relationship(r.Context(), actorIRI, targetIRI)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, rel)
+}
@@ -0,0 +1,55 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestAccountNote(t *testing.T) {
+	a, alice, bob := newTestAPI(t)
+	var rel Relationship
+	decode(t, call(t, a, http.MethodPost, "/api/v1/accounts/bob/note", alice, `{"comment":"  met at the conference  "}`), &rel)
+	if rel.ID != "bob" || rel.Note != "met at the conference" {
+		t.Errorf("relationship %+v", rel)
+	}
+
+	// Notes are private to whoever wrote them.
+	var rels []Relationship
+	decode(t, call(t, a, http.MethodGet, "/api/v1/accounts/relationships?id[]=bob", alice, ""), &rels)
+	if len(rels) != 1 || rels[0].Note != "met at the conference" {
+		t.Errorf("alice's relationships %+v", rels)
+	}
+	decode(t, call(t, a, http.MethodGet, "/api/v1/accounts/relationships?id[]=alice", bob, ""), &rels)
+	if len(rels) != 1 || rels[0].Note != "" {
+		t.Errorf("bob's relationships %+v", rels)
+	}
+
+	if w := call(t, a, http.MethodPost, "/api/v1/accounts/bob/note", alice, `{"comment":"`+strings.Repeat("x", 2001)+`"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("overlong note: %d, want 422", w.Code)
+	}
+	decode(t, call(t, a, http.MethodPost, "/api/v1/accounts/bob/note", alice, `{"comment":""}`), &rel)
+	if rel.Note != "" {
+		t.Errorf("note %q once cleared", rel.Note)
+	}
+}
+
+func TestGetRelationships(t *testing.T) {
+	a, alice, _ := newTestAPI(t)
+	var rels []Relationship
+	// Accounts we don't know are left out.
+	decode(t, call(t, a, http.MethodGet, "/api/v1/accounts/relationships?id[]=bob&id[]=nobody&id[]=alice", alice, ""), &rels)
+	if len(rels) != 2 || rels[0].ID != "bob" || rels[1].ID != "alice" {
+		t.Errorf("relationships %+v, want bob's and alice's", rels)
+	}
+	decode(t, call(t, a, http.MethodGet, "/api/v1/accounts/relationships?id=bob", alice, ""), &rels)
+	if len(rels) != 1 || rels[0].ID != "bob" {
+		t.Errorf("relationships %+v, want bob's", rels)
+	}
+	if w := call(t, a, http.MethodGet, "/api/v1/accounts/relationships?id=bob", "", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("relationships without a token: %d, want 401", w.Code)
+	}
+}
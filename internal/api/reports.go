@@ -0,0 +1,123 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+
+	"mastogon/internal/db"
+	"mastogon/internal/service"
+)
+
+// Report is the Mastodon representation of a report.
+type Report struct {
+	ID            string   `json:"id"`
+	ActionTaken   bool     `json:"action_taken"`
+	Category      string   `json:"category"`
+	Comment       string   `json:"comment"`
+	Forwarded     bool     `json:"forwarded"`
+	CreatedAt     string   `json:"created_at"`
+	StatusIDs     []string `json:"status_ids"`
+	RuleIDs       []string `json:"rule_ids"`
+	TargetAccount Account  `json:"target_account"`
+}
+
+func (a *API) newReport(c context.Context, r *db.Report) Report {
+	report := Report{
+		ID:            r.ID,
+		Category:      "other",
+		Comment:       r.Comment,
+		Forwarded:     r.Forwarded != nil,
+		CreatedAt:     r.CreatedAt.UTC().Format(time.RFC3339),
+		StatusIDs:     []string{},
+		RuleIDs:       []string{},
+		TargetAccount: a.account(c, r.Target),
+	}
+	for _, statusIRI := range r.Statuses {
+		report.StatusIDs = append(report.StatusIDs, statusID(statusIRI, a.db))
+	}
+	return report
+}
+
+// POST /api/v1/reports
+func (a *API) postReport(w http.ResponseWriter, r *http.Request) {
+	c := r.Context()
+	actorIRI, err := a.authenticate(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	var params struct {
+		AccountID string   `json:"account_id"`
+		StatusIDs []string `json:"status_ids"`
+		Comment   string   `json:"comment"`
+		Forward   bool     `json:"forward"`
+	}
+	if err := decodeParams(r, &params); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	targetIRI, err := a.actorForAccountID(c, params.AccountID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	statusIRIs := make([]*url.URL, 0, len(params.StatusIDs))
+	for _, id := range params.StatusIDs {
+		statusIRI, err := a.objectForStatusID(c, id)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		statusIRIs = append(statusIRIs, statusIRI)
+	}
+	report, err := a.service.Report(c, actorIRI, service.ReportParams{
+		Target:   targetIRI,
+		Statuses: statusIRIs,
+		Comment:  params.Comment,
+		Forward:  params.Forward,
+	})
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, a.newReport(c, report))
+}
+
+// GET /api/v1/admin/reports
+func (a *API) getAdminReports(w http.ResponseWriter, r *http.Request) {
+	if !a.authenticateAdmin(w, r) {
+		return
+	}
+	reports := []Report{}
+	for _, report := range a.service.Reports(r.Context()) {
+		reports = append(reports, a.newReport(r.Context(), report))
+	}
+	writeJSON(w, http.StatusOK, reports)
+}
+
+// POST /api/v1/admin/reports/:id/forward
+//
+// Mastodon only forwards reports as they're filed; this lets moderators
+// forward them afterwards.
+func (a *API) postAdminReportForward(w http.ResponseWriter, r *http.Request) {
+	if !a.authenticateAdmin(w, r) {
+		return
+	}
+	c := r.Context()
+	id := pathParam(r, "id")
+	if err := a.service.ForwardReport(c, id); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	report, err := a.db.Report(id)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, a.newReport(c, report))
+}
@@ -0,0 +1,54 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package api
+
+import (
+	"net/http"
+	"strings"
+)
+
+// route pairs an endpoint, whose path may hold `:name` segments, with its
+// handler.
+type route struct {
+	method   string
+	segments []string
+	handler  http.HandlerFunc
+}
+
+type pathParamsKey struct{}
+
+func newRoute(method, pattern string, handler http.HandlerFunc) route {
+	return route{
+		method:   method,
+		segments: strings.Split(strings.Trim(pattern, "/"), "/"),
+		handler:  handler,
+	}
+}
+
+// match reports whether `r` is for this route, along with the values of the
+// route's `:name` segments.
+func (rt route) match(r *http.Request) (map[string]string, bool) {
+	if r.Method != rt.method {
+		return nil, false
+	}
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(segments) != len(rt.segments) {
+		return nil, false
+	}
+	params := make(map[string]string)
+	for i, s := range rt.segments {
+		if strings.HasPrefix(s, ":") {
+			params[s[1:]] = segments[i]
+		} else if s != segments[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// pathParam returns the value of the `:name` segment of the matched route.
+func pathParam(r *http.Request, name string) string {
+	params, _ := r.Context().Value(pathParamsKey{}).(map[string]string)
+	return params[name]
+}
@@ -0,0 +1,95 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"mastogon/internal/db"
+)
+
+// ScheduledStatus is the Mastodon representation of a status waiting to be
+// posted.
+type ScheduledStatus struct {
+	ID               string                `json:"id"`
+	ScheduledAt      string                `json:"scheduled_at"`
+	Params           ScheduledStatusParams `json:"params"`
+	MediaAttachments []struct{}            `json:"media_attachments"`
+}
+
+type ScheduledStatusParams struct {
+	Text       string  `json:"text"`
+	Language   *string `json:"language"`
+	Visibility *string `json:"visibility"`
+	Sensitive  *bool   `json:"sensitive"`
+}
+
+func newScheduledStatus(s *db.ScheduledStatus) ScheduledStatus {
+	scheduled := ScheduledStatus{
+		ID:               s.ID,
+		ScheduledAt:      s.ScheduledAt.UTC().Format(time.RFC3339),
+		Params:           ScheduledStatusParams{Text: s.Status},
+		MediaAttachments: []struct{}{},
+	}
+	if s.Language != "" {
+		language := s.Language
+		scheduled.Params.Language = &language
+	}
+	if s.Visibility != "" {
+		visibility := s.Visibility
+		scheduled.Params.Visibility = &visibility
+	}
+	scheduled.Params.Sensitive = s.Sensitive
+	return scheduled
+}
+
+// GET /api/v1/scheduled_statuses
+func (a *API) getScheduledStatuses(w http.ResponseWriter, r *http.Request) {
+	actorIRI, err := a.authenticate(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	all := a.service.ScheduledStatuses(actorIRI)
+	ids := make([]string, len(all))
+	for i, s := range all {
+		ids[i] = s.ID
+	}
+	start, end := a.paginate(w, r, ids)
+	scheduled := make([]ScheduledStatus, 0, end-start)
+	for _, s := range all[start:end] {
+		scheduled = append(scheduled, newScheduledStatus(s))
+	}
+	writeJSON(w, http.StatusOK, scheduled)
+}
+
+// GET /api/v1/scheduled_statuses/:id
+func (a *API) getScheduledStatus(w http.ResponseWriter, r *http.Request) {
+	actorIRI, err := a.authenticate(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	s, err := a.service.ScheduledStatus(actorIRI, pathParam(r, "id"))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newScheduledStatus(s))
+}
+
+// DELETE /api/v1/scheduled_statuses/:id
+func (a *API) deleteScheduledStatus(w http.ResponseWriter, r *http.Request) {
+	actorIRI, err := a.authenticate(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	if err := a.service.CancelScheduledStatus(actorIRI, pathParam(r, "id")); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, struct{}{})
+}
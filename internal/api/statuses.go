@@ -0,0 +1,218 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"mastogon/internal/db"
+	"mastogon/internal/service"
+
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// POST /api/v1/statuses
+func (a *API) postStatus(w http.ResponseWriter, r *http.Request) {
+	actorIRI, err := a.authenticate(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	var params struct {
+		Status     string `json:"status"`
+		Language   string `json:"language"`
+		Visibility string `json:"visibility"`
+		Sensitive  *bool  `json:"sensitive"`
+		// The status to quote. Mastodon and Akkoma name it differently.
+		QuotedStatusID string `json:"quoted_status_id"`
+		QuoteID        string `json:"quote_id"`
+		// When to post the status, if not now.
+		ScheduledAt string `json:"scheduled_at"`
+	}
+	if err := decodeParams(r, &params); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	statusParams := service.StatusParams{
+		Status:     params.Status,
+		Language:   params.Language,
+		Visibility: params.Visibility,
+		Sensitive:  params.Sensitive,
+	}
+	if params.QuotedStatusID == "" {
+		params.QuotedStatusID = params.QuoteID
+	}
+	if params.QuotedStatusID != "" {
+		quoteIRI, err := a.objectForStatusID(r.Context(), params.QuotedStatusID)
+		if err != nil {
+			writeServiceError(w, service.NewValidationError("Quoted status could not be found"))
+			return
+		}
+		statusParams.Quote = quoteIRI
+	}
+	if params.ScheduledAt != "" {
+		at, err := time.Parse(time.RFC3339, params.ScheduledAt)
+		if err != nil {
+			writeServiceError(w, service.NewValidationError("Scheduled at is invalid"))
+			return
+		}
+		scheduled, err := a.service.ScheduleStatus(r.Context(), actorIRI, statusParams, at)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, newScheduledStatus(scheduled))
+		return
+	}
+	note, err := a.service.PostStatus(r.Context(), actorIRI, statusParams)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	// No filter context: people aren't shielded from what they write.
+	writeJSON(w, http.StatusOK, a.statuses(r.Context(), actorIRI, "", []vocab.Type{note})[0])
+}
+
+// DELETE /api/v1/statuses/:id
+func (a *API) deleteStatus(w http.ResponseWriter, r *http.Request) {
+	actorIRI, err := a.authenticate(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	iri, err := a.objectForStatusID(r.Context(), pathParam(r, "id"))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	status, err := a.service.DeleteStatus(r.Context(), actorIRI, iri)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, a.statuses(r.Context(), actorIRI, "", []vocab.Type{status})[0])
+}
+
+// statusID is how we refer to statuses in the Mastodon API: by the Mastodon
+// ID `d` hands them, which for ours is the snowflake their IRI ends in.
+func statusID(iri *url.URL, d *db.DB) string {
+	return d.MastodonIDForIRI(iri)
+}
+
+// objectForStatusID reverses statusID, and the IDs we handed out before: the
+// last segment of a local status's IRI, or a remote one's IRI encoded.
+func (a *API) objectForStatusID(c context.Context, id string) (*url.URL, error) {
+	if iri, ok := a.db.IRIForMastodonID(id); ok {
+		return iri, nil
+	}
+	// Local statuses live under their type, which the ID doesn't say.
+	for _, kind := range []string{"note", "article", "question"} {
+		iri := &url.URL{Scheme: "https", Host: a.db.Hostname(), Path: "/" + kind + "/" + id}
+		if exists, err := a.db.Exists(c, iri); err == nil && exists {
+			return iri, nil
+		}
+	}
+	b, err := base64.RawURLEncoding.DecodeString(id)
+	if err != nil {
+		return nil, fmt.Errorf("status %s: %w", id, service.ErrNotFound)
+	}
+	iri, err := url.Parse(string(b))
+	if err != nil || !iri.IsAbs() {
+		return nil, fmt.Errorf("status %s: %w", id, service.ErrNotFound)
+	}
+	return iri, nil
+}
+
+// GET /api/v1/statuses/:id/context
+func (a *API) getStatusContext(w http.ResponseWriter, r *http.Request) {
+	c := r.Context()
+	// Anyone may look, but only users get missing ancestors fetched.
+	viewerIRI, _ := a.authenticate(r)
+	iri, err := a.objectForStatusID(c, pathParam(r, "id"))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	ancestors, descendants, err := a.service.Context(c, viewerIRI, iri)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Ancestors   []Status `json:"ancestors"`
+		Descendants []Status `json:"descendants"`
+	}{
+		Ancestors:   a.statuses(c, viewerIRI, "thread", ancestors),
+		Descendants: a.statuses(c, viewerIRI, "thread", descendants),
+	})
+}
+
+// GET /api/v1/statuses/:id/favourited_by
+func (a *API) getFavouritedBy(w http.ResponseWriter, r *http.Request) {
+	a.statusAccounts(w, r, a.service.LikedBy)
+}
+
+// GET /api/v1/statuses/:id/reblogged_by
+func (a *API) getRebloggedBy(w http.ResponseWriter, r *http.Request) {
+	a.statusAccounts(w, r, a.service.SharedBy)
+}
+
+// EmojiReaction is how many reacted to a status with an emoji, as Pleroma's
+// API presents it.
+type EmojiReaction struct {
+	Name     string    `json:"name"`
+	Count    int       `json:"count"`
+	Me       bool      `json:"me"`
+	Accounts []Account `json:"accounts"`
+}
+
+// GET /api/v1/pleroma/statuses/:id/reactions
+func (a *API) getStatusReactions(w http.ResponseWriter, r *http.Request) {
+	c := r.Context()
+	viewerIRI, _ := a.authenticate(r)
+	iri, err := a.objectForStatusID(c, pathParam(r, "id"))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	counts, err := a.service.EmojiReactions(c, iri)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	reactions := make([]EmojiReaction, 0, len(counts))
+	for _, count := range counts {
+		reaction := EmojiReaction{Name: count.Emoji, Count: count.Count, Accounts: []Account{}}
+		for _, actorIRI := range count.Actors {
+			reaction.Me = reaction.Me || viewerIRI != nil && actorIRI.String() == viewerIRI.String()
+			reaction.Accounts = append(reaction.Accounts, a.account(c, actorIRI))
+		}
+		reactions = append(reactions, reaction)
+	}
+	writeJSON(w, http.StatusOK, reactions)
+}
+
+// statusAccounts replies with a page of the accounts `list` returns for the
+// status in the path.
+func (a *API) statusAccounts(w http.ResponseWriter,
+	r *http.Request,
+	list func(c context.Context, iri *url.URL) ([]*url.URL, error)) {
+	c := r.Context()
+	iri, err := a.objectForStatusID(c, pathParam(r, "id"))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	iris, err := list(c, iri)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	a.writeAccountPage(w, r, iris)
+}
@@ -0,0 +1,50 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package api
+
+import (
+	"encoding/base64"
+	"net/http"
+	"testing"
+)
+
+func TestGetStatusContext(t *testing.T) {
+	a, alice, _ := newTestAPI(t)
+	var status Status
+	decode(t, call(t, a, http.MethodPost, "/api/v1/statuses", alice, `{"status":"hello"}`), &status)
+
+	var context struct {
+		Ancestors   []Status `json:"ancestors"`
+		Descendants []Status `json:"descendants"`
+	}
+	decode(t, call(t, a, http.MethodGet, "/api/v1/statuses/"+status.ID+"/context", "", ""), &context)
+	if context.Ancestors == nil || context.Descendants == nil || len(context.Ancestors)+len(context.Descendants) != 0 {
+		t.Errorf("context %+v, want two empty lists", context)
+	}
+
+	unknown := base64.RawURLEncoding.EncodeToString([]byte("https://remote.test/notes/1"))
+	for _, id := range []string{unknown, "nothing"} {
+		if w := call(t, a, http.MethodGet, "/api/v1/statuses/"+id+"/context", alice, ""); w.Code != http.StatusNotFound {
+			t.Errorf("context of %s: %d, want 404", id, w.Code)
+		}
+	}
+}
+
+func TestGetFavouritedAndRebloggedBy(t *testing.T) {
+	a, alice, _ := newTestAPI(t)
+	var status Status
+	decode(t, call(t, a, http.MethodPost, "/api/v1/statuses", alice, `{"status":"hello"}`), &status)
+	for _, list := range []string{"favourited_by", "reblogged_by"} {
+		var accounts []Account
+		decode(t, call(t, a, http.MethodGet, "/api/v1/statuses/"+status.ID+"/"+list, "", ""), &accounts)
+		if accounts == nil || len(accounts) != 0 {
+			t.Errorf("%s %v, want an empty list", list, accounts)
+		}
+		// We only know who reacted to our own statuses.
+		remote := base64.RawURLEncoding.EncodeToString([]byte("https://remote.test/notes/1"))
+		if w := call(t, a, http.MethodGet, "/api/v1/statuses/"+remote+"/"+list, "", ""); w.Code != http.StatusNotFound {
+			t.Errorf("%s of a remote status: %d, want 404", list, w.Code)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"mastogon/internal/service"
+
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// How many statuses a timeline returns by default, and at most.
+const (
+	defaultTimelineLimit = 20
+	maxTimelineLimit     = 40
+)
+
+// timelineLimit returns the `limit` a timeline request asks for.
+func timelineLimit(r *http.Request) int {
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit < 1 {
+		return defaultTimelineLimit
+	}
+	if limit > maxTimelineLimit {
+		return maxTimelineLimit
+	}
+	return limit
+}
+
+// timelineRange returns the time range a timeline request asks for with
+// `since` and `until`.
+func timelineRange(r *http.Request) (service.TimeRange, error) {
+	return service.ParseTimeRange(r.URL.Query().Get("since"), r.URL.Query().Get("until"))
+}
+
+// statuses presents `objects` to the local actor at `actorIRI`, marking those
+// their filters for `filterContext` match and filling in quoted statuses. The
+// actor is nil for anonymous viewers.
+func (a *API) statuses(c context.Context,
+	actorIRI *url.URL,
+	filterContext string,
+	objects []vocab.Type) []Status {
+	statuses := make([]Status, 0, len(objects))
+	for _, o := range objects {
+		status := newStatus(o, a.db)
+		if actorIRI != nil {
+			for _, f := range a.service.FiltersMatching(c, actorIRI, filterContext, o) {
+				status.Filtered = append(status.Filtered, newFilter(f))
+			}
+		}
+		if service.QuoteOf(o) != nil {
+			status.Quote = &Quote{State: "unauthorized"}
+			// Quotes of quotes are left as links, as Mastodon does.
+			if quoted, err := a.service.Quoted(c, actorIRI, o); err == nil && quoted != nil {
+				quotedStatus := newStatus(quoted, a.db)
+				status.Quote = &Quote{State: "accepted", QuotedStatus: &quotedStatus}
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// GET /api/v1/timelines/home
+func (a *API) getHomeTimeline(w http.ResponseWriter, r *http.Request) {
+	actorIRI, err := a.authenticate(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	tr, err := timelineRange(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	objects, err := a.service.HomeTimeline(r.Context(), actorIRI, tr, timelineLimit(r))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, a.statuses(r.Context(), actorIRI, "home", objects))
+}
+
+// GET /api/v1/timelines/list/:id
+func (a *API) getListTimeline(w http.ResponseWriter, r *http.Request) {
+	actorIRI, err := a.authenticate(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	tr, err := timelineRange(r)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	objects, err := a.service.ListTimeline(r.Context(), actorIRI, pathParam(r, "id"), tr, timelineLimit(r))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, a.statuses(r.Context(), actorIRI, "home", objects))
+}
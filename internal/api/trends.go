@@ -0,0 +1,58 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package api
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// Mastodon's defaults for how many trends to list.
+const (
+	defaultTrendsLimit = 10
+	maxTrendsLimit     = 20
+)
+
+// Tag is the Mastodon representation of a hashtag.
+type Tag struct {
+	Name    string       `json:"name"`
+	URL     string       `json:"url"`
+	History []TagHistory `json:"history"`
+}
+
+// TagHistory is the use of a hashtag on a given day. Mastodon sends the
+// numbers as strings.
+type TagHistory struct {
+	Day      string `json:"day"`
+	Uses     string `json:"uses"`
+	Accounts string `json:"accounts"`
+}
+
+// GET /api/v1/trends/tags
+func (a *API) getTrendingTags(w http.ResponseWriter, r *http.Request) {
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit < 1 {
+		limit = defaultTrendsLimit
+	} else if limit > maxTrendsLimit {
+		limit = maxTrendsLimit
+	}
+	trends := a.service.Trends(limit)
+	tags := make([]Tag, 0, len(trends))
+	for _, t := range trends {
+		tag := Tag{
+			Name:    t.Name,
+			URL:     a.service.TagURL(t.Name).String(),
+			History: make([]TagHistory, 0, len(t.History)),
+		}
+		for _, d := range t.History {
+			tag.History = append(tag.History, TagHistory{
+				Day:      strconv.FormatInt(d.Day.Unix(), 10),
+				Uses:     strconv.Itoa(d.Uses),
+				Accounts: strconv.Itoa(d.Accounts),
+			})
+		}
+		tags = append(tags, tag)
+	}
+	writeJSON(w, http.StatusOK, tags)
+}
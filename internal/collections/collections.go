@@ -0,0 +1,150 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+// Package collections walks ActivityStreams collections, ours or peers', page
+// by page.
+package collections
+
+import (
+	"context"
+	"errors"
+	"net/url"
+
+	"mastogon/internal/db"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// ErrStop, returned by the function Iterate or Walk calls on each item, or
+// by their Fetch, stops the walk without it failing.
+var ErrStop = errors.New("stop iterating")
+
+// The most pages a walk goes through, so a peer serving pages without end
+// can't keep us fetching.
+const MaxPages = 100
+
+// Fetch gets the document at `iri` from a peer.
+type Fetch func(c context.Context, iri *url.URL) (vocab.Type, error)
+
+// Iterate calls `f` on each item of the collection at `collectionIRI`, in
+// order, following its pages. Our own collections, and our objects in any
+// collection, are read from `d`; the rest is fetched with `fetch`, which may
+// be nil for walking only our own. Items we can't get hold of are skipped,
+// but a page we can't get ends the walk with its error, as does an error
+// from `f` other than ErrStop. No more than MaxPages pages are walked.
+func Iterate(c context.Context,
+	d *db.DB,
+	fetch Fetch,
+	collectionIRI *url.URL,
+	f func(item vocab.Type) error) error {
+	return Walk(c, d, fetch, collectionIRI, func(item pub.IdProperty) error {
+		o := item.GetType()
+		if o == nil {
+			var err error
+			if o, err = get(c, d, fetch, item.GetIRI()); err != nil {
+				return nil
+			}
+		}
+		return f(o)
+	})
+}
+
+// Walk is Iterate for callers that only need the items as the collection
+// gives them, embedded or by IRI, sparing a fetch of each.
+func Walk(c context.Context,
+	d *db.DB,
+	fetch Fetch,
+	collectionIRI *url.URL,
+	f func(item pub.IdProperty) error) error {
+	seen := make(map[string]bool)
+	var page vocab.Type
+	next := collectionIRI
+	for pages := 0; pages < MaxPages; pages++ {
+		at := next
+		if page != nil {
+			at, _ = pub.GetId(page)
+		}
+		// Pages linking back to one we've been through would have us go
+		// round forever.
+		if at != nil {
+			if seen[at.String()] {
+				return nil
+			}
+			seen[at.String()] = true
+		}
+		if page == nil {
+			if err := c.Err(); err != nil {
+				return err
+			}
+			var err error
+			if page, err = get(c, d, fetch, next); errors.Is(err, ErrStop) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+		}
+		items, following := PageItems(page)
+		for _, item := range items {
+			if err := f(item); errors.Is(err, ErrStop) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+		}
+		if following == nil {
+			return nil
+		}
+		// Peers may embed a page rather than link it, as Mastodon does the
+		// first page of replies.
+		if page = following.GetType(); page == nil {
+			next = following.GetIRI()
+		}
+	}
+	return nil
+}
+
+// PageItems returns the items on the collection page `page`, and the page
+// after it, if any, embedded or by IRI. A collection with no items of its
+// own gives its first page as the next.
+func PageItems(page vocab.Type) (items []pub.IdProperty, next pub.IdProperty) {
+	if o, ok := page.(interface {
+		GetActivityStreamsOrderedItems() vocab.ActivityStreamsOrderedItemsProperty
+	}); ok && o.GetActivityStreamsOrderedItems() != nil {
+		for iter := o.GetActivityStreamsOrderedItems().Begin(); iter != o.GetActivityStreamsOrderedItems().End(); iter = iter.Next() {
+			items = append(items, iter)
+		}
+	}
+	if o, ok := page.(interface {
+		GetActivityStreamsItems() vocab.ActivityStreamsItemsProperty
+	}); ok && o.GetActivityStreamsItems() != nil {
+		for iter := o.GetActivityStreamsItems().Begin(); iter != o.GetActivityStreamsItems().End(); iter = iter.Next() {
+			items = append(items, iter)
+		}
+	}
+	if o, ok := page.(interface {
+		GetActivityStreamsNext() vocab.ActivityStreamsNextProperty
+	}); ok && o.GetActivityStreamsNext() != nil && (o.GetActivityStreamsNext().IsIRI() || o.GetActivityStreamsNext().GetType() != nil) {
+		next = o.GetActivityStreamsNext()
+	}
+	if o, ok := page.(interface {
+		GetActivityStreamsFirst() vocab.ActivityStreamsFirstProperty
+	}); ok && len(items) == 0 && next == nil && o.GetActivityStreamsFirst() != nil &&
+		(o.GetActivityStreamsFirst().IsIRI() || o.GetActivityStreamsFirst().GetType() != nil) {
+		next = o.GetActivityStreamsFirst()
+	}
+	return
+}
+
+// get returns what's at `iri`: from `d` if it's ours, else fetched.
+func get(c context.Context, d *db.DB, fetch Fetch, iri *url.URL) (vocab.Type, error) {
+	if owns, err := d.Owns(c, iri); err != nil {
+		return nil, err
+	} else if owns {
+		return d.Get(c, iri)
+	}
+	if fetch == nil {
+		return nil, errors.New("can't fetch " + iri.String())
+	}
+	return fetch(c, iri)
+}
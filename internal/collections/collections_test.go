@@ -0,0 +1,255 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package collections
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+
+	"mastogon/internal/db"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+const activityStreams = "https://www.w3.org/ns/activitystreams"
+
+// peer serves documents by IRI, as a fake of the peers we fetch from,
+// counting the fetches.
+type peer struct {
+	docs    map[string]map[string]interface{}
+	fetched int
+}
+
+func (p *peer) fetch(c context.Context, iri *url.URL) (vocab.Type, error) {
+	p.fetched++
+	m, ok := p.docs[iri.String()]
+	if !ok {
+		return nil, fmt.Errorf("%s: not found", iri)
+	}
+	m["@context"] = activityStreams
+	return streams.ToType(c, m)
+}
+
+// note is a Note at `id`.
+func note(id string) map[string]interface{} {
+	return map[string]interface{}{"id": id, "type": "Note", "content": id}
+}
+
+// newTestDB returns an empty database for mastogon.test, with a Note stored
+// at each of `ids`.
+func newTestDB(t *testing.T, ids ...string) *db.DB {
+	t.Helper()
+	c := context.Background()
+	d := &db.DB{}
+	d.Construct(&sync.Map{}, "mastogon.test")
+	for _, id := range ids {
+		v, err := streams.ToType(c, map[string]interface{}{"@context": activityStreams, "id": id, "type": "Note"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		iri, _ := url.Parse(id)
+		d.Lock(c, iri)
+		err = d.Create(c, v)
+		d.Unlock(c, iri)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return d
+}
+
+// walked returns the ids of the items Walk gives for the collection at
+// `collectionIRI`.
+func walked(t *testing.T, d *db.DB, p *peer, collectionIRI string) []string {
+	t.Helper()
+	iri, _ := url.Parse(collectionIRI)
+	var ids []string
+	err := Walk(context.Background(), d, p.fetch, iri, func(item pub.IdProperty) error {
+		id, err := pub.ToId(item)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, id.String())
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ids
+}
+
+func TestWalk(t *testing.T) {
+	const r = "https://remote.test/"
+	for _, test := range []struct {
+		name string
+		docs map[string]map[string]interface{}
+		want []string
+	}{
+		{"an OrderedCollection with its items", map[string]map[string]interface{}{
+			r + "c": {"id": r + "c", "type": "OrderedCollection", "orderedItems": []interface{}{r + "1", note(r + "2")}},
+		}, []string{r + "1", r + "2"}},
+		{"a Collection paged by IRI", map[string]map[string]interface{}{
+			r + "c":  {"id": r + "c", "type": "Collection", "first": r + "p1"},
+			r + "p1": {"id": r + "p1", "type": "CollectionPage", "items": []interface{}{r + "1"}, "next": r + "p2"},
+			r + "p2": {"id": r + "p2", "type": "CollectionPage", "items": []interface{}{r + "2", r + "3"}},
+		}, []string{r + "1", r + "2", r + "3"}},
+		{"an OrderedCollection paged by IRI", map[string]map[string]interface{}{
+			r + "c":  {"id": r + "c", "type": "OrderedCollection", "first": r + "p1"},
+			r + "p1": {"id": r + "p1", "type": "OrderedCollectionPage", "orderedItems": []interface{}{r + "1"}, "next": r + "p2"},
+			r + "p2": {"id": r + "p2", "type": "OrderedCollectionPage", "orderedItems": []interface{}{r + "2"}},
+		}, []string{r + "1", r + "2"}},
+		// As Mastodon serves replies.
+		{"an inline first page", map[string]map[string]interface{}{
+			r + "c": {"id": r + "c", "type": "Collection", "first": map[string]interface{}{
+				"id": r + "p1", "type": "CollectionPage", "items": []interface{}{}, "next": r + "p2",
+			}},
+			r + "p2": {"id": r + "p2", "type": "CollectionPage", "items": []interface{}{r + "1"}},
+		}, []string{r + "1"}},
+		{"pages linking back", map[string]map[string]interface{}{
+			r + "c":  {"id": r + "c", "type": "OrderedCollection", "first": r + "p1"},
+			r + "p1": {"id": r + "p1", "type": "OrderedCollectionPage", "orderedItems": []interface{}{r + "1"}, "next": r + "p2"},
+			r + "p2": {"id": r + "p2", "type": "OrderedCollectionPage", "orderedItems": []interface{}{r + "2"}, "next": r + "p1"},
+		}, []string{r + "1", r + "2"}},
+		{"a page linking to itself inline", map[string]map[string]interface{}{
+			r + "c": {"id": r + "c", "type": "Collection", "first": map[string]interface{}{
+				"id": r + "p1", "type": "CollectionPage", "items": []interface{}{r + "1"}, "next": r + "c",
+			}},
+		}, []string{r + "1"}},
+		{"a missing page", map[string]map[string]interface{}{
+			r + "c":  {"id": r + "c", "type": "Collection", "first": r + "p1"},
+			r + "p1": {"id": r + "p1", "type": "CollectionPage", "items": []interface{}{r + "1"}, "next": r + "gone"},
+		}, nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			p := &peer{docs: test.docs}
+			iri, _ := url.Parse(r + "c")
+			var ids []string
+			err := Walk(context.Background(), newTestDB(t), p.fetch, iri, func(item pub.IdProperty) error {
+				id, err := pub.ToId(item)
+				if err != nil {
+					return err
+				}
+				ids = append(ids, id.String())
+				return nil
+			})
+			if test.want == nil {
+				if err == nil {
+					t.Error("walked past a page that couldn't be had")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(ids, test.want) {
+				t.Errorf("walked %v, want %v", ids, test.want)
+			}
+		})
+	}
+}
+
+func TestWalkPageCap(t *testing.T) {
+	const r = "https://remote.test/"
+	docs := map[string]map[string]interface{}{
+		r + "c": {"id": r + "c", "type": "OrderedCollection", "first": r + "p0"},
+	}
+	for i := 0; i < MaxPages+10; i++ {
+		docs[fmt.Sprintf("%sp%d", r, i)] = map[string]interface{}{
+			"id":           fmt.Sprintf("%sp%d", r, i),
+			"type":         "OrderedCollectionPage",
+			"orderedItems": []interface{}{fmt.Sprintf("%s%d", r, i)},
+			"next":         fmt.Sprintf("%sp%d", r, i+1),
+		}
+	}
+	p := &peer{docs: docs}
+	// The collection itself is the first page fetched.
+	if got := walked(t, newTestDB(t), p, r+"c"); len(got) != MaxPages-1 {
+		t.Errorf("walked %d items, want %d", len(got), MaxPages-1)
+	}
+	if p.fetched != MaxPages {
+		t.Errorf("fetched %d pages, want %d", p.fetched, MaxPages)
+	}
+}
+
+func TestIterate(t *testing.T) {
+	c := context.Background()
+	const (
+		l = "https://mastogon.test/"
+		r = "https://remote.test/"
+	)
+	d := newTestDB(t, l+"1", l+"2")
+	// Our own collection, read from the database, lists our notes and a
+	// peer's, some of which can't be had.
+	outbox, err := streams.ToType(c, map[string]interface{}{
+		"@context":     activityStreams,
+		"id":           l + "outbox",
+		"type":         "OrderedCollection",
+		"orderedItems": []interface{}{l + "1", r + "1", r + "gone", note(r + "2"), l + "2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	outboxIRI, _ := url.Parse(l + "outbox")
+	d.Lock(c, outboxIRI)
+	err = d.Create(c, outbox)
+	d.Unlock(c, outboxIRI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &peer{docs: map[string]map[string]interface{}{r + "1": note(r + "1")}}
+
+	var ids []string
+	iterate := func(fetch Fetch, stopAt int) error {
+		ids = nil
+		return Iterate(c, d, fetch, outboxIRI, func(item vocab.Type) error {
+			id, err := pub.GetId(item)
+			if err != nil {
+				return err
+			}
+			ids = append(ids, id.String())
+			if len(ids) == stopAt {
+				return ErrStop
+			}
+			return nil
+		})
+	}
+	if err := iterate(p.fetch, 0); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{l + "1", r + "1", r + "2", l + "2"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("iterated %v, want %v", ids, want)
+	}
+	// Only what we don't have is fetched.
+	if p.fetched != 2 {
+		t.Errorf("fetched %d items, want 2", p.fetched)
+	}
+
+	// Without fetching, only what we have is iterated.
+	if err := iterate(nil, 0); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{l + "1", r + "2", l + "2"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("iterated %v without fetching, want %v", ids, want)
+	}
+
+	if err := iterate(p.fetch, 2); err != nil {
+		t.Errorf("stopping failed the walk: %s", err)
+	}
+	if len(ids) != 2 {
+		t.Errorf("iterated %v after stopping at 2", ids)
+	}
+
+	failure := errors.New("failure")
+	err = Iterate(c, d, p.fetch, outboxIRI, func(vocab.Type) error { return failure })
+	if !errors.Is(err, failure) {
+		t.Errorf("iterating gave %v, want the error of the function", err)
+	}
+}
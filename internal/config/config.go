@@ -0,0 +1,495 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+// Package config loads how an instance is set up from a YAML file, with
+// environment variables taking precedence.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"mastogon/internal/db"
+	"mastogon/internal/service"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The prefix of the environment variables overriding the file. A setting's
+// variable is its path in the file, upper-cased and joined by underscores:
+// `federation.fetch_timeout` is MASTOGON_FEDERATION_FETCH_TIMEOUT.
+const envPrefix = "MASTOGON"
+
+// Config is everything about how an instance is set up.
+type Config struct {
+	// The domain our actors live on.
+	Hostname string `yaml:"hostname"`
+	// Other domains we also serve.
+	Aliases []string `yaml:"aliases"`
+	// The address to listen on.
+	Listen string `yaml:"listen"`
+	// How long to let deliveries finish when shutting down.
+	GracePeriod time.Duration `yaml:"grace_period"`
+	// A file to keep the activities we couldn't deliver by the end of the
+	// grace period in, for the next start to deliver. Empty drops them.
+	PendingDeliveries string `yaml:"pending_deliveries"`
+	// Whether to start from the cautious settings of Secure rather than
+	// Default. Settings given still take precedence.
+	SecureMode bool `yaml:"secure_mode"`
+
+	Database    Database    `yaml:"database"`
+	Instance    Instance    `yaml:"instance"`
+	Federation  Federation  `yaml:"federation"`
+	Collections Collections `yaml:"collections"`
+	Features    Features    `yaml:"features"`
+}
+
+// Database is where we keep everything.
+type Database struct {
+	// Only "memory" for now. There's no SQL backend yet, and so no schema
+	// to migrate.
+	Backend string `yaml:"backend"`
+	// How to reach the database, for backends that need it.
+	DSN string `yaml:"dsn"`
+	// How the IRIs of new objects end: "snowflake", numbers sorting by
+	// time as Mastodon's status IDs do, or "random".
+	IDs string `yaml:"ids"`
+}
+
+// Instance is how the instance presents itself to people.
+type Instance struct {
+	Title           string   `yaml:"title"`
+	Description     string   `yaml:"description"`
+	ContactEmail    string   `yaml:"contact_email"`
+	ContactUsername string   `yaml:"contact_username"`
+	AccountDomain   string   `yaml:"account_domain"`
+	Registrations   bool     `yaml:"registrations"`
+	Admins          []string `yaml:"admins"`
+	Language        string   `yaml:"language"`
+	// An IANA time zone, such as Europe/Paris. Empty means UTC.
+	TimeZone     string `yaml:"timezone"`
+	MaxNoteChars int    `yaml:"max_note_chars"`
+	// Whether follows wait for approval, for accounts that don't say.
+	ManuallyApproveFollows bool `yaml:"manually_approve_follows"`
+	// What to serve as /robots.txt. Empty serves none.
+	RobotsTxt string `yaml:"robots_txt"`
+	// Where clients authorize with OAuth and get their tokens, if anywhere.
+	OAuthAuthorizationEndpoint string `yaml:"oauth_authorization_endpoint"`
+	OAuthTokenEndpoint         string `yaml:"oauth_token_endpoint"`
+}
+
+// Federation is how we deal with peers. See service.Config for what each
+// setting does.
+type Federation struct {
+	KeyType                 string        `yaml:"key_type"`
+	SignatureStyle          string        `yaml:"signature_style"`
+	FetchTimeout            time.Duration `yaml:"fetch_timeout"`
+	MaxResponseSize         int64         `yaml:"max_response_size"`
+	MaxConnsPerHost         int           `yaml:"max_conns_per_host"`
+	MaxRedirects            int           `yaml:"max_redirects"`
+	AllowedPrivateNetworks  []string      `yaml:"allowed_private_networks"`
+	AuthorizedFetch         bool          `yaml:"authorized_fetch"`
+	SignedDeliveries        bool          `yaml:"signed_deliveries"`
+	SignedActorFetches      bool          `yaml:"signed_actor_fetches"`
+	LDSignatures            bool          `yaml:"ld_signatures"`
+	LDSignCreates           bool          `yaml:"ld_sign_creates"`
+	EnforceSignatureDate    bool          `yaml:"enforce_signature_date"`
+	RefuseSuspendedDomains  bool          `yaml:"refuse_suspended_domains"`
+	UnverifiedDeletes       string        `yaml:"unverified_deletes"`
+	MaxInboxBodySize        int64         `yaml:"max_inbox_body_size"`
+	InboxDedupWindow        time.Duration `yaml:"inbox_dedup_window"`
+	InboxDedupSize          int           `yaml:"inbox_dedup_size"`
+	DeliveryWorkers         int           `yaml:"delivery_workers"`
+	DeliveryFailureLimit    int           `yaml:"delivery_failure_limit"`
+	DeliveryCooldown        time.Duration `yaml:"delivery_cooldown"`
+	MaxInboxForwardingDepth int           `yaml:"max_inbox_forwarding_depth"`
+	MaxDeliveryDepth        int           `yaml:"max_delivery_depth"`
+	TombstonesGone          bool          `yaml:"tombstones_gone"`
+}
+
+// Collections is how we serve our collections. See service.Config for what
+// each setting does.
+type Collections struct {
+	PageSize          int `yaml:"page_size"`
+	OutboxPageSize    int `yaml:"outbox_page_size"`
+	InboxPageSize     int `yaml:"inbox_page_size"`
+	FollowersPageSize int `yaml:"followers_page_size"`
+	RepliesPageSize   int `yaml:"replies_page_size"`
+	MaxInlineItems    int `yaml:"max_inline_items"`
+}
+
+// Features are the parts of the instance that can be turned off.
+type Features struct {
+	// Whether we compute trending hashtags.
+	Trends bool `yaml:"trends"`
+	// Whether we post scheduled statuses when they're due.
+	ScheduledStatuses bool `yaml:"scheduled_statuses"`
+}
+
+// Default returns the settings of an instance on localhost with nothing
+// configured.
+func Default() Config {
+	d := service.DefaultConfig()
+	return Config{
+		Hostname:          "localhost",
+		Listen:            ":8080",
+		GracePeriod:       30 * time.Second,
+		PendingDeliveries: "pending-deliveries.json",
+		Database:          Database{Backend: "memory", IDs: "snowflake"},
+		Instance: Instance{
+			Title:        d.Title,
+			Language:     d.DefaultLanguage,
+			MaxNoteChars: d.MaxNoteChars,
+			RobotsTxt:    d.RobotsTxt,
+		},
+		Federation: Federation{
+			KeyType:                 d.KeyType,
+			SignatureStyle:          d.SignatureStyle,
+			FetchTimeout:            d.FetchTimeout,
+			MaxResponseSize:         d.MaxResponseSize,
+			MaxConnsPerHost:         d.MaxConnsPerHost,
+			MaxRedirects:            d.MaxRedirects,
+			DeliveryWorkers:         d.DeliveryWorkers,
+			MaxInboxForwardingDepth: d.MaxInboxForwardingDepth,
+			MaxDeliveryDepth:        d.MaxDeliveryDepth,
+			UnverifiedDeletes:       d.UnverifiedDeletes,
+			SignedDeliveries:        d.SignedDeliveries,
+			LDSignatures:            d.LDSignatures,
+			LDSignCreates:           d.LDSignCreates,
+			MaxInboxBodySize:        d.MaxInboxBodySize,
+			InboxDedupWindow:        d.InboxDedupWindow,
+			InboxDedupSize:          d.InboxDedupSize,
+			DeliveryFailureLimit:    d.DeliveryFailureLimit,
+			DeliveryCooldown:        d.DeliveryCooldown,
+			TombstonesGone:          d.TombstonesGone,
+		},
+		Collections: Collections{
+			PageSize:          d.CollectionPageSize,
+			OutboxPageSize:    d.OutboxPageSize,
+			InboxPageSize:     d.InboxPageSize,
+			FollowersPageSize: d.FollowersPageSize,
+			RepliesPageSize:   d.RepliesPageSize,
+			MaxInlineItems:    d.MaxInlineItems,
+		},
+		Features: Features{Trends: true, ScheduledStatuses: true},
+	}
+}
+
+// Secure returns the defaults of secure mode: peers must sign their fetches,
+// signatures must be recent, and suspended domains are cut off both ways.
+// It leaves connecting to private addresses alone: we refuse to whatever the
+// mode, except to the networks in allowed_private_networks.
+func Secure() Config {
+	config := Default()
+	config.SecureMode = true
+	config.Federation.AuthorizedFetch = true
+	config.Federation.EnforceSignatureDate = true
+	config.Federation.RefuseSuspendedDomains = true
+	return config
+}
+
+// Load reads the file at `path` over the defaults, if `path` isn't empty,
+// then the environment over that, and validates the result. The defaults
+// are those of Secure if the file or environment turn on secure mode.
+func Load(path string) (Config, error) {
+	return load(path, nil)
+}
+
+// LoadSecureMode is Load with secure mode turned on or off by `secure`,
+// whatever the file or environment say.
+func LoadSecureMode(path string, secure bool) (Config, error) {
+	return load(path, &secure)
+}
+
+func load(path string, secure *bool) (Config, error) {
+	config, err := loadOver(Default(), path)
+	if err != nil {
+		return config, err
+	}
+	if secure != nil {
+		config.SecureMode = *secure
+	}
+	if config.SecureMode {
+		// Read again over the secure defaults, so anything set explicitly
+		// still wins over them.
+		if config, err = loadOver(Secure(), path); err != nil {
+			return config, err
+		}
+		config.SecureMode = true
+	}
+	return config, config.Validate()
+}
+
+// loadOver reads the file at `path`, if `path` isn't empty, then the
+// environment, over `config`.
+func loadOver(config Config, path string) (Config, error) {
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return config, err
+		}
+		defer f.Close()
+		dec := yaml.NewDecoder(f)
+		// Misspelled settings would otherwise go unnoticed.
+		dec.KnownFields(true)
+		if err := dec.Decode(&config); err != nil {
+			return config, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if err := applyEnv(reflect.ValueOf(&config).Elem(), envPrefix, os.LookupEnv); err != nil {
+		return config, err
+	}
+	return config, nil
+}
+
+// applyEnv sets the fields of the struct `rv` from the environment variables
+// `lookup` finds under `prefix`.
+func applyEnv(rv reflect.Value, prefix string, lookup func(string) (string, bool)) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		name, _, _ := strings.Cut(rt.Field(i).Tag.Get("yaml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		key := prefix + "_" + strings.ToUpper(name)
+		fv := rv.Field(i)
+		if fv.Kind() == reflect.Struct {
+			if err := applyEnv(fv, key, lookup); err != nil {
+				return err
+			}
+			continue
+		}
+		value, ok := lookup(key)
+		if !ok {
+			continue
+		}
+		if err := setField(fv, value); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// setField parses `value` into `fv`.
+func setField(fv reflect.Value, value string) error {
+	switch fv.Interface().(type) {
+	case time.Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(int64(d))
+		return nil
+	case []string:
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		fv.Set(reflect.ValueOf(items))
+		return nil
+	}
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	default:
+		return fmt.Errorf("can't set a %s from the environment", fv.Type())
+	}
+	return nil
+}
+
+// Validate checks the settings make sense, saying which doesn't if not.
+func (c Config) Validate() error {
+	var problems []string
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	if c.Hostname == "" {
+		problem("hostname is required")
+	}
+	if c.Listen == "" {
+		problem("listen is required")
+	}
+	if c.GracePeriod < 0 {
+		problem("grace_period can't be negative")
+	}
+	switch c.Database.Backend {
+	case "memory":
+		if c.Database.DSN != "" {
+			problem("database.dsn isn't used by the memory backend")
+		}
+	default:
+		problem("database.backend %q is unknown; the only one is memory", c.Database.Backend)
+	}
+	if c.Database.IDs != "snowflake" && c.Database.IDs != "random" {
+		problem("database.ids must be snowflake or random, not %q", c.Database.IDs)
+	}
+	if c.Instance.TimeZone != "" {
+		if _, err := time.LoadLocation(c.Instance.TimeZone); err != nil {
+			problem("instance.timezone: %s", err)
+		}
+	}
+	if c.Instance.MaxNoteChars < 1 {
+		problem("instance.max_note_chars must be positive")
+	}
+	for _, e := range []struct{ name, endpoint string }{
+		{"oauth_authorization_endpoint", c.Instance.OAuthAuthorizationEndpoint},
+		{"oauth_token_endpoint", c.Instance.OAuthTokenEndpoint},
+	} {
+		if u, err := url.Parse(e.endpoint); e.endpoint != "" && (err != nil || !u.IsAbs()) {
+			problem("instance.%s must be an absolute URL", e.name)
+		}
+	}
+	if c.Federation.KeyType != service.KeyTypeRSA && c.Federation.KeyType != service.KeyTypeEd25519 {
+		problem("federation.key_type must be %s or %s", service.KeyTypeRSA, service.KeyTypeEd25519)
+	}
+	if c.Federation.SignatureStyle != service.SignatureCavage && c.Federation.SignatureStyle != service.SignatureRFC9421 {
+		problem("federation.signature_style must be %s or %s", service.SignatureCavage, service.SignatureRFC9421)
+	}
+	if c.Federation.UnverifiedDeletes != service.UnverifiedDeleteReject && c.Federation.UnverifiedDeletes != service.UnverifiedDeleteAcceptSelf {
+		problem("federation.unverified_deletes must be %s or %s", service.UnverifiedDeleteReject, service.UnverifiedDeleteAcceptSelf)
+	}
+	if c.Federation.FetchTimeout <= 0 {
+		problem("federation.fetch_timeout must be positive")
+	}
+	if c.Federation.MaxResponseSize < 1 {
+		problem("federation.max_response_size must be positive")
+	}
+	if c.Federation.MaxConnsPerHost < 1 {
+		problem("federation.max_conns_per_host must be positive")
+	}
+	if c.Federation.MaxRedirects < 0 {
+		problem("federation.max_redirects can't be negative")
+	}
+	for _, cidr := range c.Federation.AllowedPrivateNetworks {
+		if _, err := netip.ParsePrefix(cidr); err != nil {
+			problem("federation.allowed_private_networks: %s", err)
+		}
+	}
+	if c.Federation.MaxInboxBodySize < 1 {
+		problem("federation.max_inbox_body_size must be positive")
+	}
+	if c.Federation.InboxDedupWindow < 0 {
+		problem("federation.inbox_dedup_window can't be negative")
+	}
+	if c.Federation.InboxDedupWindow > 0 && c.Federation.InboxDedupSize < 1 {
+		problem("federation.inbox_dedup_size must be positive")
+	}
+	if c.Federation.DeliveryWorkers < 1 {
+		problem("federation.delivery_workers must be positive")
+	}
+	if c.Federation.DeliveryFailureLimit < 1 {
+		problem("federation.delivery_failure_limit must be positive")
+	}
+	if c.Federation.DeliveryCooldown < 0 {
+		problem("federation.delivery_cooldown can't be negative")
+	}
+	if c.Federation.MaxInboxForwardingDepth < 0 {
+		problem("federation.max_inbox_forwarding_depth can't be negative")
+	}
+	if c.Federation.MaxDeliveryDepth < 1 {
+		problem("federation.max_delivery_depth must be positive")
+	}
+	if c.Collections.PageSize < 1 {
+		problem("collections.page_size must be positive")
+	}
+	for _, size := range []struct {
+		name string
+		size int
+	}{
+		{"outbox_page_size", c.Collections.OutboxPageSize},
+		{"inbox_page_size", c.Collections.InboxPageSize},
+		{"followers_page_size", c.Collections.FollowersPageSize},
+		{"replies_page_size", c.Collections.RepliesPageSize},
+		{"max_inline_items", c.Collections.MaxInlineItems},
+	} {
+		if size.size < 0 {
+			problem("collections.%s can't be negative", size.name)
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New("invalid configuration: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// IDGenerator returns what mints the IRIs of new objects.
+func (c Config) IDGenerator() db.IDGenerator {
+	if c.Database.IDs == "random" {
+		return db.TypedIDs{}
+	}
+	return &db.Snowflakes{}
+}
+
+// Service returns the settings the service takes.
+func (c Config) Service() service.Config {
+	config := service.DefaultConfig()
+	config.Title = c.Instance.Title
+	config.Description = c.Instance.Description
+	config.ContactEmail = c.Instance.ContactEmail
+	config.ContactUsername = c.Instance.ContactUsername
+	config.AccountDomain = c.Instance.AccountDomain
+	config.RegistrationsOpen = c.Instance.Registrations
+	config.ManuallyApproveFollows = c.Instance.ManuallyApproveFollows
+	config.AdminUsernames = c.Instance.Admins
+	config.DefaultLanguage = c.Instance.Language
+	if c.Instance.TimeZone != "" {
+		// Validate made sure it loads.
+		config.TimeZone, _ = time.LoadLocation(c.Instance.TimeZone)
+	}
+	config.MaxNoteChars = c.Instance.MaxNoteChars
+	config.RobotsTxt = c.Instance.RobotsTxt
+	config.OAuthAuthorizationEndpoint = c.Instance.OAuthAuthorizationEndpoint
+	config.OAuthTokenEndpoint = c.Instance.OAuthTokenEndpoint
+	config.KeyType = c.Federation.KeyType
+	config.SignatureStyle = c.Federation.SignatureStyle
+	config.FetchTimeout = c.Federation.FetchTimeout
+	config.MaxResponseSize = c.Federation.MaxResponseSize
+	config.MaxConnsPerHost = c.Federation.MaxConnsPerHost
+	config.MaxRedirects = c.Federation.MaxRedirects
+	config.AllowedPrivateNetworks = c.Federation.AllowedPrivateNetworks
+	config.AuthorizedFetch = c.Federation.AuthorizedFetch
+	config.SignedDeliveries = c.Federation.SignedDeliveries
+	config.SignedActorFetches = c.Federation.SignedActorFetches
+	config.LDSignatures = c.Federation.LDSignatures
+	config.LDSignCreates = c.Federation.LDSignCreates
+	config.EnforceSignatureDate = c.Federation.EnforceSignatureDate
+	config.RefuseSuspendedDomains = c.Federation.RefuseSuspendedDomains
+	config.UnverifiedDeletes = c.Federation.UnverifiedDeletes
+	config.MaxInboxBodySize = c.Federation.MaxInboxBodySize
+	config.InboxDedupWindow = c.Federation.InboxDedupWindow
+	config.InboxDedupSize = c.Federation.InboxDedupSize
+	config.DeliveryWorkers = c.Federation.DeliveryWorkers
+	config.DeliveryFailureLimit = c.Federation.DeliveryFailureLimit
+	config.DeliveryCooldown = c.Federation.DeliveryCooldown
+	config.MaxInboxForwardingDepth = c.Federation.MaxInboxForwardingDepth
+	config.MaxDeliveryDepth = c.Federation.MaxDeliveryDepth
+	config.TombstonesGone = c.Federation.TombstonesGone
+	config.CollectionPageSize = c.Collections.PageSize
+	config.OutboxPageSize = c.Collections.OutboxPageSize
+	config.InboxPageSize = c.Collections.InboxPageSize
+	config.FollowersPageSize = c.Collections.FollowersPageSize
+	config.RepliesPageSize = c.Collections.RepliesPageSize
+	config.MaxInlineItems = c.Collections.MaxInlineItems
+	return config
+}
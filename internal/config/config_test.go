@@ -0,0 +1,274 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"mastogon/internal/service"
+)
+
+// writeConfig writes `yaml` to a file of settings, returning its path, or
+// no path when there's nothing to write.
+func writeConfig(t *testing.T, yaml string) string {
+	t.Helper()
+	if yaml == "" {
+		return ""
+	}
+	path := filepath.Join(t.TempDir(), "mastogon.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	t.Setenv("MASTOGON_LISTEN", ":9090")
+	t.Setenv("MASTOGON_ALIASES", "a.test, b.test")
+	t.Setenv("MASTOGON_FEDERATION_FETCH_TIMEOUT", "3s")
+	t.Setenv("MASTOGON_FEATURES_TRENDS", "false")
+	config, err := Load(writeConfig(t, `
+hostname: mastogon.test
+listen: ":8443"
+aliases: [c.test]
+federation:
+  fetch_timeout: 20s
+  max_redirects: 2
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, setting := range []struct {
+		name      string
+		got, want interface{}
+	}{
+		// Only in the file.
+		{"hostname", config.Hostname, "mastogon.test"},
+		{"federation.max_redirects", config.Federation.MaxRedirects, 2},
+		// The environment wins over the file.
+		{"listen", config.Listen, ":9090"},
+		{"aliases", strings.Join(config.Aliases, " "), "a.test b.test"},
+		{"federation.fetch_timeout", config.Federation.FetchTimeout, 3 * time.Second},
+		// Only in the environment.
+		{"features.trends", config.Features.Trends, false},
+		// In neither.
+		{"database.backend", config.Database.Backend, "memory"},
+		{"features.scheduled_statuses", config.Features.ScheduledStatuses, true},
+	} {
+		if setting.got != setting.want {
+			t.Errorf("%s = %v, want %v", setting.name, setting.got, setting.want)
+		}
+	}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	config, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := Default(); config.Hostname != want.Hostname || config.Listen != want.Listen ||
+		config.Federation.FetchTimeout != want.Federation.FetchTimeout {
+		t.Errorf("loaded %+v with nothing configured, want the defaults %+v", config, want)
+	}
+}
+
+func TestLoadFailures(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		yaml    string
+		env     map[string]string
+		problem string
+	}{
+		{"misspelled setting", "hostnam: mastogon.test\n", nil, "field hostnam not found"},
+		{"unparseable environment", "", map[string]string{"MASTOGON_GRACE_PERIOD": "soon"}, "MASTOGON_GRACE_PERIOD"},
+		{"no hostname", "hostname: \"\"\n", nil, "hostname is required"},
+		{"unknown backend", "database:\n  backend: postgres\n", nil, `database.backend "postgres" is unknown`},
+		{"dsn for memory", "database:\n  dsn: x\n", nil, "database.dsn isn't used by the memory backend"},
+		{"bad time zone", "instance:\n  timezone: Mars/Olympus\n", nil, "instance.timezone"},
+		{"bad key type", "federation:\n  key_type: dsa\n", nil, "federation.key_type must be"},
+		{"no timeout", "", map[string]string{"MASTOGON_FEDERATION_FETCH_TIMEOUT": "0s"}, "federation.fetch_timeout must be positive"},
+		{"bad network", "federation:\n  allowed_private_networks: [10.0.0.0]\n", nil, "federation.allowed_private_networks"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			for k, v := range test.env {
+				t.Setenv(k, v)
+			}
+			_, err := Load(writeConfig(t, test.yaml))
+			if err == nil || !strings.Contains(err.Error(), test.problem) {
+				t.Errorf("Load: %v, want %q", err, test.problem)
+			}
+		})
+	}
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	config := Default()
+	config.Listen = ""
+	config.Federation.MaxRedirects = -1
+	err := config.Validate()
+	if err == nil || !strings.Contains(err.Error(), "listen is required") ||
+		!strings.Contains(err.Error(), "federation.max_redirects can't be negative") {
+		t.Errorf("Validate: %v, want both problems", err)
+	}
+}
+
+func TestSecureMode(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		yaml   string
+		env    map[string]string
+		secure *bool
+		// What the settings secure mode turns on come to.
+		authorizedFetch, signatureDate, suspendedDomains bool
+	}{
+		{"off", "", nil, nil, false, false, false},
+		{"on in the file", "secure_mode: true\n", nil, nil, true, true, true},
+		{"on in the environment", "", map[string]string{"MASTOGON_SECURE_MODE": "true"}, nil, true, true, true},
+		{"on by flag", "", nil, boolPtr(true), true, true, true},
+		{"off by flag", "secure_mode: true\n", nil, boolPtr(false), false, false, false},
+		{
+			"overridden in the file",
+			"secure_mode: true\nfederation:\n  authorized_fetch: false\n",
+			nil, nil, false, true, true,
+		},
+		{
+			"overridden in the environment",
+			"secure_mode: true\n",
+			map[string]string{"MASTOGON_FEDERATION_ENFORCE_SIGNATURE_DATE": "false"},
+			nil, true, false, true,
+		},
+		{
+			"overridden with the flag on",
+			"federation:\n  refuse_suspended_domains: false\n",
+			nil, boolPtr(true), true, true, false,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			for k, v := range test.env {
+				t.Setenv(k, v)
+			}
+			path := writeConfig(t, test.yaml)
+			var config Config
+			var err error
+			if test.secure != nil {
+				config, err = LoadSecureMode(path, *test.secure)
+			} else {
+				config, err = Load(path)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			f := config.Federation
+			if f.AuthorizedFetch != test.authorizedFetch || f.EnforceSignatureDate != test.signatureDate || f.RefuseSuspendedDomains != test.suspendedDomains {
+				t.Errorf("authorized fetch %v, signature date %v, suspended domains %v; want %v, %v, %v",
+					f.AuthorizedFetch, f.EnforceSignatureDate, f.RefuseSuspendedDomains,
+					test.authorizedFetch, test.signatureDate, test.suspendedDomains)
+			}
+		})
+	}
+}
+
+func TestSecureModeKeepsAllowedPrivateNetworks(t *testing.T) {
+	config, err := LoadSecureMode(writeConfig(t, "federation:\n  allowed_private_networks: [10.0.0.0/8]\n"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := config.Federation.AllowedPrivateNetworks; len(got) != 1 || got[0] != "10.0.0.0/8" {
+		t.Errorf("allowed private networks %q, want the one configured", got)
+	}
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func TestServiceSettings(t *testing.T) {
+	t.Setenv("MASTOGON_FEDERATION_DELIVERY_COOLDOWN", "1h")
+	t.Setenv("MASTOGON_COLLECTIONS_MAX_INLINE_ITEMS", "0")
+	config, err := Load(writeConfig(t, `
+federation:
+  max_inbox_body_size: 65536
+  inbox_dedup_window: 1m
+  inbox_dedup_size: 100
+  delivery_failure_limit: 3
+  delivery_cooldown: 5m
+  tombstones_gone: false
+collections:
+  page_size: 40
+  outbox_page_size: 10
+  inbox_page_size: 11
+  followers_page_size: 12
+  replies_page_size: 13
+  max_inline_items: 5
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := config.Service()
+	for _, setting := range []struct {
+		name      string
+		got, want interface{}
+	}{
+		{"MaxInboxBodySize", s.MaxInboxBodySize, int64(65536)},
+		{"InboxDedupWindow", s.InboxDedupWindow, time.Minute},
+		{"InboxDedupSize", s.InboxDedupSize, 100},
+		{"DeliveryFailureLimit", s.DeliveryFailureLimit, 3},
+		// The environment wins over the file.
+		{"DeliveryCooldown", s.DeliveryCooldown, time.Hour},
+		{"TombstonesGone", s.TombstonesGone, false},
+		{"CollectionPageSize", s.CollectionPageSize, 40},
+		{"OutboxPageSize", s.OutboxPageSize, 10},
+		{"InboxPageSize", s.InboxPageSize, 11},
+		{"FollowersPageSize", s.FollowersPageSize, 12},
+		{"RepliesPageSize", s.RepliesPageSize, 13},
+		{"MaxInlineItems", s.MaxInlineItems, 0},
+	} {
+		if setting.got != setting.want {
+			t.Errorf("%s = %v, want %v", setting.name, setting.got, setting.want)
+		}
+	}
+}
+
+func TestServiceSettingsDefaults(t *testing.T) {
+	config, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Nothing configured leaves the service's own defaults.
+	if got, want := config.Service(), service.DefaultConfig(); got.MaxInboxBodySize != want.MaxInboxBodySize ||
+		got.InboxDedupWindow != want.InboxDedupWindow || got.InboxDedupSize != want.InboxDedupSize ||
+		got.DeliveryFailureLimit != want.DeliveryFailureLimit || got.DeliveryCooldown != want.DeliveryCooldown ||
+		got.TombstonesGone != want.TombstonesGone || got.CollectionPageSize != want.CollectionPageSize ||
+		got.MaxInlineItems != want.MaxInlineItems {
+		t.Errorf("defaults %+v, want the service's %+v", got, want)
+	}
+}
+
+func TestValidateServiceSettings(t *testing.T) {
+	for _, test := range []struct {
+		yaml, problem string
+	}{
+		{"federation:\n  max_inbox_body_size: 0\n", "federation.max_inbox_body_size must be positive"},
+		{"federation:\n  inbox_dedup_window: -1s\n", "federation.inbox_dedup_window can't be negative"},
+		{"federation:\n  inbox_dedup_size: 0\n", "federation.inbox_dedup_size must be positive"},
+		{"federation:\n  delivery_failure_limit: 0\n", "federation.delivery_failure_limit must be positive"},
+		{"federation:\n  delivery_cooldown: -1m\n", "federation.delivery_cooldown can't be negative"},
+		{"collections:\n  page_size: 0\n", "collections.page_size must be positive"},
+		{"collections:\n  replies_page_size: -1\n", "collections.replies_page_size can't be negative"},
+		{"collections:\n  max_inline_items: -1\n", "collections.max_inline_items can't be negative"},
+	} {
+		_, err := Load(writeConfig(t, test.yaml))
+		if err == nil || !strings.Contains(err.Error(), test.problem) {
+			t.Errorf("loading %q: %v, want %q", test.yaml, err, test.problem)
+		}
+	}
+	// Turning deduplication off leaves its size alone.
+	if _, err := Load(writeConfig(t, "federation:\n  inbox_dedup_window: 0s\n  inbox_dedup_size: 0\n")); err != nil {
+		t.Error(err)
+	}
+}
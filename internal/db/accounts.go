@@ -0,0 +1,137 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package db
+
+import (
+	"crypto"
+	"fmt"
+	"net/url"
+	"sort"
+)
+
+// LocalAccount holds what we know about a local user beyond their actor.
+type LocalAccount struct {
+	Username string
+	// The actor this account posts as.
+	ActorIRI *url.URL
+	Email    string
+	// A bcrypt hash of the account's password.
+	PasswordHash []byte
+	// Accounts awaiting approval or email verification can't act yet.
+	Confirmed bool
+	// The token handed out at registration, only honored once confirmed.
+	Token string
+	// Keep who the account follows and is followed by to itself.
+	HideCollections bool
+	// What statuses get when the client doesn't say: a visibility, whether
+	// they're sensitive and a language. Empty means the instance's default.
+	DefaultVisibility string
+	DefaultSensitive  bool
+	DefaultLanguage   string
+	// Whether follows of the account wait for it to approve them. Nil means
+	// the instance's default.
+	ManuallyApprovesFollowers *bool
+}
+
+// CreateAccount stores a copy of a new local account, failing if the
+// username is already taken with ErrUsernameTaken.
+func (db *DB) CreateAccount(account *LocalAccount) error {
+	stored := *account
+	if _, loaded := db.accounts.LoadOrStore(account.Username, &stored); loaded {
+		return fmt.Errorf("account %s: %w", account.Username, ErrUsernameTaken)
+	}
+	return nil
+}
+
+// Account returns a copy of the local account with `username`. Changing it
+// changes nothing: see UpdateAccount.
+func (db *DB) Account(username string) (*LocalAccount, error) {
+	i, ok := db.accounts.Load(username)
+	if !ok {
+		return nil, fmt.Errorf("account %s: %w", username, ErrNotFound)
+	}
+	account := *i.(*LocalAccount)
+	return &account, nil
+}
+
+// UpdateAccount has `update` change a copy of the local account with
+// `username`, and stores the copy unless it fails. Updates of the same
+// account are made one after another, so none are lost.
+func (db *DB) UpdateAccount(username string, update func(account *LocalAccount) error) error {
+	db.accountsMu.Lock()
+	defer db.accountsMu.Unlock()
+	account, err := db.Account(username)
+	if err != nil {
+		return err
+	}
+	if err := update(account); err != nil {
+		return err
+	}
+	db.accounts.Store(username, account)
+	return nil
+}
+
+// Accounts lists copies of the local accounts, by username.
+func (db *DB) Accounts() []*LocalAccount {
+	var accounts []*LocalAccount
+	db.accounts.Range(func(_, value interface{}) bool {
+		account := *value.(*LocalAccount)
+		accounts = append(accounts, &account)
+		return true
+	})
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].Username < accounts[j].Username })
+	return accounts
+}
+
+// SetPrivateKey stores the private key a local actor signs with.
+func (db *DB) SetPrivateKey(actorIRI *url.URL, key crypto.PrivateKey) {
+	db.keys.Store(actorIRI.String(), key)
+}
+
+// PrivateKey returns the private key a local actor signs with. We have none
+// for peers' actors.
+func (db *DB) PrivateKey(actorIRI *url.URL) (crypto.PrivateKey, error) {
+	i, ok := db.keys.Load(actorIRI.String())
+	if !ok && !db.IsLocalHost(actorIRI.Host) {
+		return nil, fmt.Errorf("key of %s: %w", actorIRI, ErrNotOwned)
+	} else if !ok {
+		return nil, fmt.Errorf("key of %s: %w", actorIRI, ErrNotFound)
+	}
+	return i.(crypto.PrivateKey), nil
+}
+
+// DeleteAccount forgets a local account along with its key and tokens. The
+// actor and its content are left for the caller to remove.
+func (db *DB) DeleteAccount(username string) error {
+	account, err := db.Account(username)
+	if err != nil {
+		return err
+	}
+	db.tokens.Range(func(key, value interface{}) bool {
+		if value.(*url.URL).String() == account.ActorIRI.String() {
+			db.tokens.Delete(key)
+		}
+		return true
+	})
+	db.keys.Delete(account.ActorIRI.String())
+	db.accountsMu.Lock()
+	defer db.accountsMu.Unlock()
+	db.accounts.Delete(username)
+	return nil
+}
+
+// SetSuspended suspends or reinstates the actor at `actorIRI`.
+func (db *DB) SetSuspended(actorIRI *url.URL, suspended bool) {
+	if suspended {
+		db.suspended.Store(actorIRI.String(), true)
+	} else {
+		db.suspended.Delete(actorIRI.String())
+	}
+}
+
+// IsSuspended reports whether the actor at `actorIRI` is suspended.
+func (db *DB) IsSuspended(actorIRI *url.URL) bool {
+	_, ok := db.suspended.Load(actorIRI.String())
+	return ok
+}
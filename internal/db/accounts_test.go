@@ -0,0 +1,27 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package db
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCreateAccountTaken(t *testing.T) {
+	db := newTestDB()
+	if err := db.CreateAccount(&LocalAccount{Username: "alice", Email: "alice@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	err := db.CreateAccount(&LocalAccount{Username: "alice", Email: "mallory@example.com"})
+	if !errors.Is(err, ErrUsernameTaken) {
+		t.Fatalf("CreateAccount of a taken username = %v, want ErrUsernameTaken", err)
+	}
+	account, err := db.Account("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.Email != "alice@example.com" {
+		t.Errorf("account taken over by %s", account.Email)
+	}
+}
@@ -0,0 +1,59 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package db
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// The ActivityStreams actor types. Our own users are Persons, but peers run
+// bots as Services and Applications, and communities as Groups.
+var actorTypes = map[string]bool{
+	"Person":       true,
+	"Service":      true,
+	"Group":        true,
+	"Application":  true,
+	"Organization": true,
+}
+
+// Actor is what every kind of actor has, whatever its type.
+type Actor interface {
+	vocab.Type
+	GetActivityStreamsInbox() vocab.ActivityStreamsInboxProperty
+	GetActivityStreamsOutbox() vocab.ActivityStreamsOutboxProperty
+	GetActivityStreamsFollowers() vocab.ActivityStreamsFollowersProperty
+	GetActivityStreamsFollowing() vocab.ActivityStreamsFollowingProperty
+	GetActivityStreamsLiked() vocab.ActivityStreamsLikedProperty
+	GetActivityStreamsPreferredUsername() vocab.ActivityStreamsPreferredUsernameProperty
+	GetActivityStreamsName() vocab.ActivityStreamsNameProperty
+	GetActivityStreamsSummary() vocab.ActivityStreamsSummaryProperty
+	GetActivityStreamsPublished() vocab.ActivityStreamsPublishedProperty
+	GetW3IDSecurityV1PublicKey() vocab.W3IDSecurityV1PublicKeyProperty
+	GetTootDiscoverable() vocab.TootDiscoverableProperty
+}
+
+// ToActor returns `t` as an Actor, if it's of one of the actor types.
+func ToActor(t vocab.Type) (Actor, bool) {
+	if t == nil || !actorTypes[t.GetTypeName()] {
+		return nil, false
+	}
+	actor, ok := t.(Actor)
+	return actor, ok
+}
+
+// getActor fetches an actor of any type stored at `id`.
+func (db *DB) getActor(id *url.URL) (Actor, error) {
+	iCon, ok := db.content.Load(id.String())
+	if !ok {
+		return nil, fmt.Errorf("actor %s: %w", id, ErrNotFound)
+	}
+	actor, ok := ToActor(iCon.(*DBContent).data)
+	if !ok {
+		return nil, fmt.Errorf("%s isn't an actor: %w", id, ErrWrongType)
+	}
+	return actor, nil
+}
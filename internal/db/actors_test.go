@@ -0,0 +1,53 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package db
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/go-fed/activity/streams"
+)
+
+func TestGetActorTypes(t *testing.T) {
+	d := newTestDB()
+	for _, test := range []struct {
+		objectType string
+		actor      bool
+	}{
+		{"Person", true},
+		{"Service", true},
+		{"Group", true},
+		{"Application", true},
+		{"Organization", true},
+		{"Note", false},
+	} {
+		id := "https://remote.test/" + test.objectType
+		o, err := streams.ToType(context.Background(), map[string]interface{}{
+			"@context": "https://www.w3.org/ns/activitystreams",
+			"id":       id,
+			"type":     test.objectType,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := ToActor(o); ok != test.actor {
+			t.Errorf("a %s is an actor: %t, want %t", test.objectType, ok, test.actor)
+		}
+		store(t, d, id, o)
+		iri, _ := url.Parse(id)
+		_, err = d.getActor(iri)
+		if test.actor && err != nil {
+			t.Errorf("getting a %s: %s", test.objectType, err)
+		} else if !test.actor && !errors.Is(err, ErrWrongType) {
+			t.Errorf("getting a %s: %v, want ErrWrongType", test.objectType, err)
+		}
+	}
+	iri, _ := url.Parse("https://remote.test/nobody")
+	if _, err := d.getActor(iri); !errors.Is(err, ErrNotFound) {
+		t.Errorf("getting nobody: %v, want ErrNotFound", err)
+	}
+}
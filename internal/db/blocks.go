@@ -0,0 +1,90 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package db
+
+import (
+	"net/url"
+	"sort"
+)
+
+// DomainBlock is a moderation decision about a whole peer instance.
+type DomainBlock struct {
+	// The domain, optionally with a leading `*.` to cover only its
+	// subdomains.
+	Domain string
+	// One of "noop", "silence" or "suspend".
+	Severity      string
+	RejectMedia   bool
+	RejectReports bool
+	// A note shown to the public explaining the block.
+	PublicComment string
+	// Whether to partially hide the domain when listing blocks publicly.
+	Obfuscate bool
+}
+
+// DomainBlock returns the block on exactly `domain`, if there is one.
+func (db *DB) DomainBlock(domain string) (DomainBlock, bool) {
+	i, ok := db.domainBlocks.Load(domain)
+	if !ok {
+		return DomainBlock{}, false
+	}
+	return i.(DomainBlock), true
+}
+
+// SetDomainBlock adds or replaces the block on `b.Domain`.
+func (db *DB) SetDomainBlock(b DomainBlock) {
+	db.domainBlocks.Store(b.Domain, b)
+}
+
+// DeleteDomainBlock lifts the block on `domain`.
+func (db *DB) DeleteDomainBlock(domain string) {
+	db.domainBlocks.Delete(domain)
+}
+
+// DomainBlocks lists every domain block, sorted by domain.
+func (db *DB) DomainBlocks() []DomainBlock {
+	var blocks []DomainBlock
+	db.domainBlocks.Range(func(key, value interface{}) bool {
+		blocks = append(blocks, value.(DomainBlock))
+		return true
+	})
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i].Domain < blocks[j].Domain })
+	return blocks
+}
+
+// pairKey identifies what the local actor at `actorIRI` has to do with
+// `targetIRI`, such as blocking it.
+func pairKey(actorIRI, targetIRI *url.URL) [2]string {
+	return [2]string{actorIRI.String(), targetIRI.String()}
+}
+
+// SetBlocking records whether the local actor at `actorIRI` blocks
+// `targetIRI`.
+func (db *DB) SetBlocking(actorIRI, targetIRI *url.URL, blocking bool) {
+	if blocking {
+		db.blocks.Store(pairKey(actorIRI, targetIRI), targetIRI)
+	} else {
+		db.blocks.Delete(pairKey(actorIRI, targetIRI))
+	}
+}
+
+// IsBlocking reports whether the local actor at `actorIRI` blocks
+// `targetIRI`.
+func (db *DB) IsBlocking(actorIRI, targetIRI *url.URL) bool {
+	_, ok := db.blocks.Load(pairKey(actorIRI, targetIRI))
+	return ok
+}
+
+// Blocking lists the actors the local actor at `actorIRI` blocks.
+func (db *DB) Blocking(actorIRI *url.URL) []*url.URL {
+	var blocked []*url.URL
+	db.blocks.Range(func(key, value interface{}) bool {
+		if key.([2]string)[0] == actorIRI.String() {
+			blocked = append(blocked, value.(*url.URL))
+		}
+		return true
+	})
+	sort.Slice(blocked, func(i, j int) bool { return blocked[i].String() < blocked[j].String() })
+	return blocked
+}
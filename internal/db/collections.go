@@ -0,0 +1,195 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// getOrderedCollection fetches an OrderedCollection stored at `id`.
+func (db *DB) getOrderedCollection(id *url.URL) (vocab.ActivityStreamsOrderedCollection, error) {
+	iCon, ok := db.content.Load(id.String())
+	if !ok {
+		return nil, fmt.Errorf("collection %s: %w", id, ErrNotFound)
+	}
+	oc, ok := iCon.(*DBContent).data.(vocab.ActivityStreamsOrderedCollection)
+	if !ok {
+		return nil, fmt.Errorf("%s isn't an OrderedCollection: %w", id, ErrWrongType)
+	}
+	return oc, nil
+}
+
+// getCollection fetches the collection stored at `id`, as a Collection
+// whatever kind it is. See AsCollection.
+func (db *DB) getCollection(id *url.URL) (vocab.ActivityStreamsCollection, error) {
+	iCon, ok := db.content.Load(id.String())
+	if !ok {
+		return nil, fmt.Errorf("collection %s: %w", id, ErrNotFound)
+	}
+	return AsCollection(iCon.(*DBContent).data)
+}
+
+// AsCollection presents `t`, a Collection or OrderedCollection or a page of
+// either, as a Collection with its id and items, since peers serve followers
+// and the like as either. A Collection is returned as is; the others are
+// copied, pages with only their own items. Order is kept, though a
+// Collection doesn't promise it.
+func AsCollection(t vocab.Type) (vocab.ActivityStreamsCollection, error) {
+	if col, ok := t.(vocab.ActivityStreamsCollection); ok {
+		return col, nil
+	}
+	var iters []interface {
+		GetType() vocab.Type
+		GetIRI() *url.URL
+		IsIRI() bool
+	}
+	switch o := t.(type) {
+	case vocab.ActivityStreamsOrderedCollection:
+		if prop := o.GetActivityStreamsOrderedItems(); prop != nil {
+			for iter := prop.Begin(); iter != prop.End(); iter = iter.Next() {
+				iters = append(iters, iter)
+			}
+		}
+	case vocab.ActivityStreamsOrderedCollectionPage:
+		if prop := o.GetActivityStreamsOrderedItems(); prop != nil {
+			for iter := prop.Begin(); iter != prop.End(); iter = iter.Next() {
+				iters = append(iters, iter)
+			}
+		}
+	case vocab.ActivityStreamsCollectionPage:
+		if prop := o.GetActivityStreamsItems(); prop != nil {
+			for iter := prop.Begin(); iter != prop.End(); iter = iter.Next() {
+				iters = append(iters, iter)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("%s isn't a collection: %w", t.GetTypeName(), ErrWrongType)
+	}
+	col := streams.NewActivityStreamsCollection()
+	col.SetJSONLDId(t.GetJSONLDId())
+	items := streams.NewActivityStreamsItemsProperty()
+	for _, iter := range iters {
+		if o := iter.GetType(); o != nil {
+			if err := items.AppendType(o); err != nil {
+				return nil, err
+			}
+		} else if iter.IsIRI() {
+			items.AppendIRI(iter.GetIRI())
+		}
+	}
+	col.SetActivityStreamsItems(items)
+	totalItems := streams.NewActivityStreamsTotalItemsProperty()
+	totalItems.Set(items.Len())
+	col.SetActivityStreamsTotalItems(totalItems)
+	return col, nil
+}
+
+// getOrderedCollectionPage presents the OrderedCollection at `id` as a single
+// page holding all of its items. Go-Fed edits the page and hands it back to
+// applyDiffOrderedCollectionPage, so the items are copied rather than shared.
+func (db *DB) getOrderedCollectionPage(id *url.URL) (vocab.ActivityStreamsOrderedCollectionPage, error) {
+	oc, err := db.getOrderedCollection(id)
+	if err != nil {
+		return nil, err
+	}
+	page := streams.NewActivityStreamsOrderedCollectionPage()
+	pageId := streams.NewJSONLDIdProperty()
+	pageId.Set(id)
+	page.SetJSONLDId(pageId)
+	items := streams.NewActivityStreamsOrderedItemsProperty()
+	if oi := oc.GetActivityStreamsOrderedItems(); oi != nil {
+		for iter := oi.Begin(); iter != oi.End(); iter = iter.Next() {
+			itemId, err := pub.ToId(iter)
+			if err != nil {
+				return nil, err
+			}
+			items.AppendIRI(itemId)
+		}
+	}
+	page.SetActivityStreamsOrderedItems(items)
+	return page, nil
+}
+
+// applyDiffOrderedCollectionPage writes the items of a page obtained from
+// getOrderedCollectionPage back into the OrderedCollection it came from.
+func (db *DB) applyDiffOrderedCollectionPage(page vocab.ActivityStreamsOrderedCollectionPage) error {
+	id, err := pub.GetId(page)
+	if err != nil {
+		return err
+	}
+	oc, err := db.getOrderedCollection(id)
+	if err != nil {
+		return err
+	}
+	items := page.GetActivityStreamsOrderedItems()
+	if items == nil {
+		items = streams.NewActivityStreamsOrderedItemsProperty()
+	}
+	oc.SetActivityStreamsOrderedItems(items)
+	if iCon, ok := db.content.Load(id.String()); ok {
+		con := iCon.(*DBContent)
+		after := refsOf(oc)
+		db.refs.adjust(con.refs, after)
+		con.refs = after
+	}
+	total := streams.NewActivityStreamsTotalItemsProperty()
+	total.Set(items.Len())
+	oc.SetActivityStreamsTotalItems(total)
+	return nil
+}
+
+// actorForBox scans our local actors for the one whose box, as picked out by
+// `box`, is `boxIRI`. Peers' boxes aren't ours to look up.
+func (db *DB) actorForBox(c context.Context, boxIRI *url.URL, box func(Actor) *url.URL) (actorIRI *url.URL, err error) {
+	if !db.IsLocalHost(boxIRI.Host) {
+		return nil, fmt.Errorf("actor for box %s: %w", boxIRI, ErrNotOwned)
+	}
+	err = db.rangeContent(c, func(id string, con *DBContent) bool {
+		if !con.isLocal {
+			return true
+		}
+		actor, ok := ToActor(con.data)
+		if !ok {
+			return true
+		}
+		if b := box(actor); b != nil && b.String() == boxIRI.String() {
+			actorIRI, _ = pub.GetId(actor)
+			return false
+		}
+		return true
+	})
+	if err == nil && actorIRI == nil {
+		err = fmt.Errorf("actor for box %s: %w", boxIRI, ErrNotFound)
+	}
+	return
+}
+
+// How many items a scan gets through between checks for cancellation.
+const scanCheckInterval = 64
+
+// rangeContent calls `f` on everything we store until it returns false. A
+// full scan can take a while, so it gives up early with the context's error
+// once `c` is done.
+func (db *DB) rangeContent(c context.Context, f func(id string, con *DBContent) bool) error {
+	if err := c.Err(); err != nil {
+		return err
+	}
+	var err error
+	n := 0
+	db.content.Range(func(key, value interface{}) bool {
+		if n++; n%scanCheckInterval == 0 {
+			if err = c.Err(); err != nil {
+				return false
+			}
+		}
+		return f(key.(string), value.(*DBContent))
+	})
+	return err
+}
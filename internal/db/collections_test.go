@@ -0,0 +1,117 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+)
+
+func TestScanCancelled(t *testing.T) {
+	db := newTestDB()
+	const notes = 10 * scanCheckInterval
+	for n := 0; n < notes; n++ {
+		store(t, db, fmt.Sprintf("https://mastogon.test/notes/%d", n), streams.NewActivityStreamsNote())
+	}
+
+	seen := 0
+	if err := db.rangeContent(context.Background(), func(string, *DBContent) bool {
+		seen++
+		return true
+	}); err != nil || seen != notes {
+		t.Fatalf("full scan saw %d, %v; want %d", seen, err, notes)
+	}
+
+	// A scan stops soon after its context is done...
+	c, cancel := context.WithCancel(context.Background())
+	seen = 0
+	err := db.rangeContent(c, func(string, *DBContent) bool {
+		if seen++; seen == 10 {
+			cancel()
+		}
+		return true
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled scan = %v, want context.Canceled", err)
+	}
+	if seen > scanCheckInterval {
+		t.Errorf("cancelled scan went on to %d items", seen)
+	}
+
+	// ...and doesn't start if it already is.
+	if _, err := db.ActorForUsername(c, "alice"); !errors.Is(err, context.Canceled) {
+		t.Errorf("ActorForUsername with a done context = %v, want context.Canceled", err)
+	}
+	outbox := &url.URL{Scheme: "https", Host: "mastogon.test", Path: "/users/alice/outbox"}
+	if _, err := db.ActorForOutbox(c, outbox); !errors.Is(err, context.Canceled) {
+		t.Errorf("ActorForOutbox with a done context = %v, want context.Canceled", err)
+	}
+}
+
+func TestAsCollection(t *testing.T) {
+	const r = "https://remote.test/users/bob/followers"
+	items := []interface{}{"https://remote.test/users/carol", map[string]interface{}{"id": "https://other.test/users/dave", "type": "Person"}}
+	want := []string{"https://remote.test/users/carol", "https://other.test/users/dave"}
+	for _, test := range []struct {
+		typ      string
+		itemsKey string
+	}{
+		{"Collection", "items"},
+		{"OrderedCollection", "orderedItems"},
+		{"CollectionPage", "items"},
+		{"OrderedCollectionPage", "orderedItems"},
+		{"Person", ""},
+	} {
+		t.Run(test.typ, func(t *testing.T) {
+			m := map[string]interface{}{
+				"@context": "https://www.w3.org/ns/activitystreams",
+				"id":       r,
+				"type":     test.typ,
+			}
+			if test.itemsKey != "" {
+				m[test.itemsKey] = items
+			}
+			v, err := streams.ToType(context.Background(), m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			col, err := AsCollection(v)
+			if test.itemsKey == "" {
+				if !errors.Is(err, ErrWrongType) {
+					t.Errorf("a %s as a collection: %v, want ErrWrongType", test.typ, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id, err := pub.GetId(col); err != nil || id.String() != r {
+				t.Errorf("id %v, %v, want %s", id, err, r)
+			}
+			var got []string
+			for iter := col.GetActivityStreamsItems().Begin(); iter != col.GetActivityStreamsItems().End(); iter = iter.Next() {
+				id, err := pub.ToId(iter)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, id.String())
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("items %v, want %v", got, want)
+			}
+			if test.typ != "Collection" {
+				if total := col.GetActivityStreamsTotalItems(); total == nil || total.Get() != len(want) {
+					t.Errorf("totalItems %v, want %d", total, len(want))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package db
+
+import (
+	"net/url"
+	"sync"
+
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// createIndex keeps, for each object, the Creates we store carrying it, as
+// they're stored and removed, so a Create of something we already have can
+// be told apart without going through our inboxes. Like the counts, it's
+// worked out again by Construct.
+type createIndex struct {
+	mu sync.RWMutex
+	// The ids of the Creates of each IRI.
+	creates map[string]map[string]bool
+}
+
+// adjust indexes the Create at `id` as carrying `after` in place of
+// `before`.
+func (x *createIndex) adjust(id string, before, after []string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for _, o := range before {
+		if delete(x.creates[o], id); len(x.creates[o]) == 0 {
+			delete(x.creates, o)
+		}
+	}
+	for _, o := range after {
+		if x.creates == nil {
+			x.creates = make(map[string]map[string]bool)
+		}
+		if x.creates[o] == nil {
+			x.creates[o] = make(map[string]bool)
+		}
+		x.creates[o][id] = true
+	}
+}
+
+func (x *createIndex) get(o string) (ids []string) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	for id := range x.creates[o] {
+		ids = append(ids, id)
+	}
+	return
+}
+
+// createdRefs returns the objects `con` carries if it is a Create.
+func createdRefs(con *DBContent) []string {
+	if con == nil {
+		return nil
+	}
+	if _, ok := con.data.(vocab.ActivityStreamsCreate); !ok {
+		return nil
+	}
+	return con.refs
+}
+
+// CreatesOf returns the ids of the Creates we store of the object at `id`.
+func (db *DB) CreatesOf(id *url.URL) (creates []*url.URL) {
+	for _, s := range db.creates.get(id.String()) {
+		if createIRI, err := url.Parse(s); err == nil {
+			creates = append(creates, createIRI)
+		}
+	}
+	return
+}
@@ -0,0 +1,65 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package db
+
+import (
+	"net/url"
+	"sort"
+	"testing"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+func TestCreateIndex(t *testing.T) {
+	db := newTestDB()
+	const (
+		note  = "https://remote.test/notes/1"
+		other = "https://remote.test/notes/2"
+	)
+	creating := func(objects ...string) vocab.ActivityStreamsCreate {
+		create := streams.NewActivityStreamsCreate()
+		op := streams.NewActivityStreamsObjectProperty()
+		for _, o := range objects {
+			iri, _ := url.Parse(o)
+			op.AppendIRI(iri)
+		}
+		create.SetActivityStreamsObject(op)
+		return create
+	}
+	createsOf := func(db *DB, o string) (ids []string) {
+		iri, _ := url.Parse(o)
+		for _, id := range db.CreatesOf(iri) {
+			ids = append(ids, id.String())
+		}
+		sort.Strings(ids)
+		return
+	}
+
+	store(t, db, "https://remote.test/creates/1", creating(note))
+	store(t, db, "https://relay.test/creates/1", creating(note, other))
+	// Only Creates are indexed.
+	announce := streams.NewActivityStreamsAnnounce()
+	announce.SetActivityStreamsObject(creating(note).GetActivityStreamsObject())
+	store(t, db, "https://remote.test/announces/1", announce)
+	if got := createsOf(db, note); len(got) != 2 || got[0] != "https://relay.test/creates/1" || got[1] != "https://remote.test/creates/1" {
+		t.Errorf("Creates of the note %v, want both", got)
+	}
+
+	// Construct indexes what's already stored.
+	reopened := &DB{}
+	reopened.Construct(db.content, "mastogon.test")
+	if got := createsOf(reopened, other); len(got) != 1 {
+		t.Errorf("Creates of the other note %v once reopened, want the relay's", got)
+	}
+
+	store(t, db, "https://relay.test/creates/1", creating(other))
+	remove(t, db, "https://remote.test/creates/1")
+	if got := createsOf(db, note); len(got) != 0 {
+		t.Errorf("Creates of the note %v once replaced and deleted, want none", got)
+	}
+	if got := createsOf(db, other); len(got) != 1 {
+		t.Errorf("Creates of the other note %v, want the relay's", got)
+	}
+}
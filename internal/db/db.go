@@ -4,18 +4,92 @@
 package db
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/go-fed/activity/pub"
 	"github.com/go-fed/activity/streams/vocab"
 )
 
 type DB struct {
 	// The content of our app, keyed by ActivityPub ID.
 	content *sync.Map
-	// Enables mutations. A sync.Mutex per ActivityPub ID.
-	locks *sync.Map
-	// The host domain of our service, for detecting ownership.
+	// How many collections and activities reference each IRI.
+	refs refCounts
+	// Running counts of what we store, by kind.
+	stats stats
+	// When what we store was published.
+	published publishedIndex
+	// The Creates of each object.
+	creates createIndex
+	// Enables mutations. A lock per ActivityPub ID.
+	locks lockManager
+	// The host domain of our service, which new IRIs are minted on.
 	hostname string
+	// What mints them. TypedIDs if nil.
+	ids IDGenerator
+	// The Mastodon IDs handed out, IRIs keyed by ID and IDs by IRI.
+	mastodonIDs sync.Map
+	iriIDs      sync.Map
+	// Every domain we serve, normalized, for detecting ownership. Includes
+	// `hostname`.
+	localHosts map[string]bool
+	// Bearer tokens handed out to clients, mapped to the IRI of the local
+	// actor they act on behalf of.
+	tokens sync.Map
+	// Local accounts, keyed by username. They're never changed in place,
+	// but replaced under the lock, so readers can have them without it.
+	accounts   sync.Map
+	accountsMu sync.Mutex
+	// The private keys of our local actors, keyed by actor IRI.
+	keys sync.Map
+	// Actors, local or remote, a moderator has suspended, keyed by IRI.
+	suspended sync.Map
+	// Moderation decisions about whole peers, keyed by domain.
+	domainBlocks sync.Map
+	// Who our local actors block, keyed by blocker and blocked IRIs.
+	blocks sync.Map
+	// Private notes local actors keep about others, and who they mute,
+	// keyed like blocks.
+	notes sync.Map
+	mutes sync.Map
+	// How far local actors have read their conversations, keyed by actor
+	// IRI and conversation ID.
+	conversationReads sync.Map
+	// Emoji reactions to objects, keyed by the IRI of the activity
+	// reacting.
+	emojiReactions sync.Map
+	// Local actors' lists, keyed by ID, and the last ID handed out.
+	lists   sync.Map
+	listIDs atomic.Int64
+	// Local actors' filters, keyed by ID, and the last ID handed out.
+	filters   sync.Map
+	filterIDs atomic.Int64
+	// Local actors' drafts, keyed by ID, and the last ID handed out.
+	drafts   sync.Map
+	draftIDs atomic.Int64
+	// Statuses waiting to be posted, keyed by ID, and the last ID handed
+	// out.
+	scheduled    sync.Map
+	scheduledIDs atomic.Int64
+	// Local users' reports, keyed by ID, and the last ID handed out.
+	reports   sync.Map
+	reportIDs atomic.Int64
+	// Follows awaiting approval, keyed by follower and target.
+	followRequests sync.Map
+	// Jobs waiting to be done, keyed by ID, and the last ID handed out.
+	jobs   sync.Map
+	jobIDs atomic.Int64
+	// Deliveries left over from the last shutdown of the service.
+	pendingMu sync.Mutex
+	pending   []Delivery
 }
 
 // Our DBContent map will store this data.
@@ -26,10 +100,351 @@ type DBContent struct {
 	// recommended for a solution that just indiscriminately puts everything
 	// into a single "table", like this in-memory solution.
 	isLocal bool
+	// What `data` referenced when it was stored, as refsOf saw it. Kept
+	// apart because Go-Fed edits collections in place before storing them
+	// again.
+	refs []string
 }
 
-func (db *DB) Construct(content *sync.Map, locks *sync.Map, hostname string) {
+// Construct sets up the database for a service living on `hostname`. Any
+// `aliases` are other domains we also serve, such as `www.` or other brands:
+// IRIs on them are ours too.
+func (db *DB) Construct(content *sync.Map, hostname string, aliases ...string) {
 	db.content = content
-	db.locks = locks
 	db.hostname = hostname
+	db.localHosts = map[string]bool{normalizeHost(hostname): true}
+	for _, alias := range aliases {
+		db.localHosts[normalizeHost(alias)] = true
+	}
+	// From here on, the counts and the indexes are kept as things are stored
+	// and deleted.
+	content.Range(func(k, v interface{}) bool {
+		db.stats.count(k.(string), v.(*DBContent), 1)
+		db.published.set(k.(string), publishedAt(v.(*DBContent).data))
+		db.creates.adjust(k.(string), nil, createdRefs(v.(*DBContent)))
+		db.mastodonID(k.(string))
+		return true
+	})
+}
+
+// normalizeHost lowercases `host` and drops any port, so IRIs differing only
+// in those compare equal.
+func normalizeHost(host string) string {
+	if h, port, err := net.SplitHostPort(host); err == nil && port != "" {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// Hostname returns the host domain of our service.
+func (db *DB) Hostname() string {
+	return db.hostname
+}
+
+// Ping reports whether the database, including the key store, can be used.
+// Being in memory, it only fails before Construct.
+func (db *DB) Ping(c context.Context) error {
+	if db.content == nil {
+		return errors.New("database not constructed")
+	}
+	return c.Err()
+}
+
+func (db *DB) Lock(c context.Context, id *url.URL) error {
+	return db.locks.lock(c, id.String())
+}
+
+func (db *DB) Unlock(c context.Context, id *url.URL) error {
+	return db.locks.unlock(c, id.String())
+}
+
+func (db *DB) InboxContains(c context.Context, inbox, id *url.URL) (contains bool, err error) {
+	// Our goal is to see if the `inbox`, which is an OrderedCollection,
+	// contains an element in its `orderedItems` property that has a
+	// matching `id`.
+	var oc vocab.ActivityStreamsOrderedCollection
+	oc, err = db.getOrderedCollection(inbox)
+	if err != nil {
+		return
+	}
+	oi := oc.GetActivityStreamsOrderedItems()
+	// Properties may be nil, if non-existent!
+	if oi == nil {
+		return
+	}
+	for iter := oi.Begin(); iter != oi.End(); iter = iter.Next() {
+		var iterId *url.URL
+		iterId, err = pub.ToId(iter)
+		if err != nil {
+			return
+		}
+		if iterId.String() == id.String() {
+			contains = true
+			return
+		}
+	}
+	return
+}
+
+func (db *DB) GetInbox(c context.Context, inboxIRI *url.URL) (inbox vocab.ActivityStreamsOrderedCollectionPage, err error) {
+	return db.getOrderedCollectionPage(inboxIRI)
+}
+
+func (db *DB) SetInbox(c context.Context, inbox vocab.ActivityStreamsOrderedCollectionPage) error {
+	return db.applyDiffOrderedCollectionPage(inbox)
+}
+
+// IsLocalHost reports whether `host` is one of the domains we serve.
+func (db *DB) IsLocalHost(host string) bool {
+	return db.localHosts[normalizeHost(host)]
+}
+
+func (db *DB) Owns(c context.Context, id *url.URL) (owns bool, err error) {
+	// Comparing the id's hostname against our hostnames is usually enough
+	// to determine ownership.
+	return db.IsLocalHost(id.Host), nil
+}
+
+func (db *DB) ActorForOutbox(c context.Context, outboxIRI *url.URL) (actorIRI *url.URL, err error) {
+	return db.actorForBox(c, outboxIRI, func(actor Actor) *url.URL {
+		if o := actor.GetActivityStreamsOutbox(); o != nil {
+			id, _ := pub.ToId(o)
+			return id
+		}
+		return nil
+	})
+}
+
+func (db *DB) ActorForInbox(c context.Context, inboxIRI *url.URL) (actorIRI *url.URL, err error) {
+	return db.actorForBox(c, inboxIRI, func(actor Actor) *url.URL {
+		if i := actor.GetActivityStreamsInbox(); i != nil {
+			id, _ := pub.ToId(i)
+			return id
+		}
+		return nil
+	})
+}
+
+func (db *DB) OutboxForInbox(c context.Context, inboxIRI *url.URL) (outboxIRI *url.URL, err error) {
+	actorIRI, err := db.ActorForInbox(c, inboxIRI)
+	if err != nil {
+		return
+	}
+	actor, err := db.getActor(actorIRI)
+	if err != nil {
+		return
+	}
+	o := actor.GetActivityStreamsOutbox()
+	if o == nil {
+		err = fmt.Errorf("outbox of %s: %w", actorIRI, ErrNotFound)
+		return
+	}
+	return pub.ToId(o)
+}
+
+func (db *DB) Exists(c context.Context, id *url.URL) (exists bool, err error) {
+	// Do we have this `id`?
+	_, exists = db.content.Load(id.String())
+	return
+}
+
+func (db *DB) Get(c context.Context, id *url.URL) (value vocab.Type, err error) {
+	// Our goal is to return what we have at that `id`. Returns an error if
+	// not found.
+	iCon, exists := db.content.Load(id.String())
+	if !exists {
+		err = fmt.Errorf("%s: %w", id, ErrNotFound)
+		return
+	}
+	// Extract the data from our `content` type.
+	con := iCon.(*DBContent)
+	return con.data, nil
+}
+
+func (db *DB) Create(c context.Context, asType vocab.Type) error {
+	// Create a payload in our in-memory map. The `Get` and `Update` methods
+	// will be used to fetch and modify the data.
+	id, err := pub.GetId(asType)
+	if err != nil {
+		return err
+	}
+	// Determine whether this is from a federated peer or belongs to
+	// this local app.
+	owns, err := db.Owns(c, id)
+	if err != nil {
+		return err
+	}
+	con := &DBContent{
+		data:    asType,
+		isLocal: owns,
+		refs:    refsOf(asType),
+	}
+	db.refs.adjust(db.storedRefs(id.String()), con.refs)
+	// Callers hold the lock on `id`, so nothing comes between these.
+	old, _ := db.content.Load(id.String())
+	db.content.Store(id.String(), con)
+	var before []string
+	if old != nil {
+		db.stats.count(id.String(), old.(*DBContent), -1)
+		before = createdRefs(old.(*DBContent))
+	}
+	db.stats.count(id.String(), con, 1)
+	db.published.set(id.String(), publishedAt(asType))
+	db.creates.adjust(id.String(), before, createdRefs(con))
+	return nil
+}
+
+func (db *DB) Update(c context.Context, asType vocab.Type) error {
+	// Replace a payload in our in-memory map.
+	return db.Create(c, asType)
+}
+
+func (db *DB) Delete(c context.Context, id *url.URL) error {
+	// Remove the payload from the in-memory map.
+	db.refs.adjust(db.storedRefs(id.String()), nil)
+	if old, loaded := db.content.LoadAndDelete(id.String()); loaded {
+		db.stats.count(id.String(), old.(*DBContent), -1)
+		db.creates.adjust(id.String(), createdRefs(old.(*DBContent)), nil)
+	}
+	db.published.set(id.String(), time.Time{})
+	return nil
+}
+
+func (db *DB) GetOutbox(c context.Context, outboxIRI *url.URL) (outbox vocab.ActivityStreamsOrderedCollectionPage, err error) {
+	return db.getOrderedCollectionPage(outboxIRI)
+}
+
+func (db *DB) SetOutbox(c context.Context, outbox vocab.ActivityStreamsOrderedCollectionPage) error {
+	return db.applyDiffOrderedCollectionPage(outbox)
+}
+
+func (db *DB) NewID(c context.Context, t vocab.Type) (id *url.URL, err error) {
+	// Generate a new `id` for the ActivityStreams object `t`, laid out as
+	// the operator chose. A generator only knows what it minted itself, not
+	// what another, or itself before a restart, did, so one already taken is
+	// minted afresh.
+	var ids IDGenerator = TypedIDs{}
+	if db.ids != nil {
+		ids = db.ids
+	}
+	for i := 0; i < maxIDAttempts; i++ {
+		if id, err = ids.NewID(c, db.hostname, t); err != nil {
+			return nil, err
+		}
+		if _, taken := db.content.Load(id.String()); !taken {
+			return id, nil
+		}
+	}
+	return nil, fmt.Errorf("minting an id: %s and the %d before it were taken", id, maxIDAttempts-1)
+}
+
+func (db *DB) Followers(c context.Context, actorIRI *url.URL) (followers vocab.ActivityStreamsCollection, err error) {
+	var actor Actor
+	actor, err = db.getActor(actorIRI)
+	if err != nil {
+		return
+	}
+	// Note: f is not the Collection itself yet. It is an opaque box (could
+	// be an IRI, a Collection, or something extending a Collection).
+	f := actor.GetActivityStreamsFollowers()
+	if f == nil {
+		err = fmt.Errorf("followers of %s: %w", actorIRI, ErrNotFound)
+		return
+	}
+	followersId, err := pub.ToId(f)
+	if err != nil {
+		return
+	}
+	return db.getCollection(followersId)
+}
+
+func (db *DB) Following(c context.Context, actorIRI *url.URL) (following vocab.ActivityStreamsCollection, err error) {
+	var actor Actor
+	actor, err = db.getActor(actorIRI)
+	if err != nil {
+		return
+	}
+	f := actor.GetActivityStreamsFollowing()
+	if f == nil {
+		err = fmt.Errorf("following of %s: %w", actorIRI, ErrNotFound)
+		return
+	}
+	followingId, err := pub.ToId(f)
+	if err != nil {
+		return
+	}
+	return db.getCollection(followingId)
+}
+
+func (db *DB) Liked(c context.Context, actorIRI *url.URL) (liked vocab.ActivityStreamsCollection, err error) {
+	var actor Actor
+	actor, err = db.getActor(actorIRI)
+	if err != nil {
+		return
+	}
+	l := actor.GetActivityStreamsLiked()
+	if l == nil {
+		err = fmt.Errorf("liked of %s: %w", actorIRI, ErrNotFound)
+		return
+	}
+	likedId, err := pub.ToId(l)
+	if err != nil {
+		return
+	}
+	return db.getCollection(likedId)
+}
+
+// SetToken records that the bearer `token` acts on behalf of the local actor
+// at `actorIRI`.
+func (db *DB) SetToken(token string, actorIRI *url.URL) {
+	db.tokens.Store(token, actorIRI)
+}
+
+// ActorForToken returns the local actor a bearer token was issued to.
+func (db *DB) ActorForToken(token string) (actorIRI *url.URL, err error) {
+	i, ok := db.tokens.Load(token)
+	if !ok {
+		err = fmt.Errorf("token: %w", ErrNotFound)
+		return
+	}
+	return i.(*url.URL), nil
+}
+
+// ActorForUsername finds the local actor whose preferredUsername is
+// `username`.
+func (db *DB) ActorForUsername(c context.Context, username string) (actorIRI *url.URL, err error) {
+	err = db.rangeContent(c, func(id string, con *DBContent) bool {
+		if !con.isLocal {
+			return true
+		}
+		actor, ok := ToActor(con.data)
+		if !ok {
+			return true
+		}
+		if u := actor.GetActivityStreamsPreferredUsername(); u != nil && u.GetXMLSchemaString() == username {
+			actorIRI, _ = pub.GetId(actor)
+			return false
+		}
+		return true
+	})
+	if err == nil && actorIRI == nil {
+		err = fmt.Errorf("username %s: %w", username, ErrNotFound)
+	}
+	return
+}
+
+// PeerDomains returns the hosts of everything we've stored from peers.
+func (db *DB) PeerDomains(c context.Context) (domains []string, err error) {
+	seen := make(map[string]bool)
+	err = db.rangeContent(c, func(id string, con *DBContent) bool {
+		if con.isLocal {
+			return true
+		}
+		if u, err := url.Parse(id); err == nil && !seen[u.Host] {
+			seen[u.Host] = true
+			domains = append(domains, u.Host)
+		}
+		return true
+	})
+	return
 }
@@ -0,0 +1,39 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package db
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"testing"
+)
+
+func TestOwnsLocalDomains(t *testing.T) {
+	c := context.Background()
+	db := &DB{}
+	db.Construct(&sync.Map{}, "mastogon.test", "www.mastogon.test", "Other.Brand.")
+	if db.Hostname() != "mastogon.test" {
+		t.Errorf("hostname %s, want the first domain", db.Hostname())
+	}
+	for iri, want := range map[string]bool{
+		"https://mastogon.test/users/alice":      true,
+		"https://MASTOGON.test/users/alice":      true,
+		"https://mastogon.test:443/users/alice":  true,
+		"https://mastogon.test./users/alice":     true,
+		"https://www.mastogon.test/users/alice":  true,
+		"https://other.brand/users/alice":        true,
+		"https://remote.test/users/alice":        false,
+		"https://api.mastogon.test/users/alice":  false,
+		"https://mastogon.test.evil/users/alice": false,
+	} {
+		u, err := url.Parse(iri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if owns, err := db.Owns(c, u); err != nil || owns != want {
+			t.Errorf("owns %s: %t, %v; want %t", iri, owns, err, want)
+		}
+	}
+}
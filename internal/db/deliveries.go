@@ -0,0 +1,37 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package db
+
+import "net/url"
+
+// Delivery is an activity on its way to a peer's inbox.
+type Delivery struct {
+	// The box of the local actor sending it, whose key signs it.
+	From *url.URL
+	// The inbox it goes to.
+	To *url.URL
+	// The serialized activity.
+	Body []byte
+	// How many times delivering it has failed.
+	Attempts int
+}
+
+// SavePendingDeliveries keeps deliveries we couldn't make before shutting
+// down, for the next start of the service to pick up. They live as long as
+// the database does: with the memory backend, they're lost with the process.
+func (db *DB) SavePendingDeliveries(deliveries []Delivery) {
+	db.pendingMu.Lock()
+	defer db.pendingMu.Unlock()
+	db.pending = append(db.pending, deliveries...)
+}
+
+// TakePendingDeliveries returns and forgets the deliveries saved by
+// SavePendingDeliveries.
+func (db *DB) TakePendingDeliveries() []Delivery {
+	db.pendingMu.Lock()
+	defer db.pendingMu.Unlock()
+	deliveries := db.pending
+	db.pending = nil
+	return deliveries
+}
@@ -0,0 +1,65 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package db
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Draft is a status a local actor is still writing. Drafts never leave the
+// instance and are seen by no one but their owner.
+type Draft struct {
+	ID       string
+	Owner    *url.URL
+	Status   string
+	Language string
+	// When the draft was started and last saved.
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// CreateDraft stores a new draft, assigning its ID.
+func (db *DB) CreateDraft(d *Draft) {
+	d.ID = strconv.FormatInt(db.draftIDs.Add(1), 10)
+	db.drafts.Store(d.ID, d)
+}
+
+// Draft returns the draft with `id`.
+func (db *DB) Draft(id string) (*Draft, error) {
+	i, ok := db.drafts.Load(id)
+	if !ok {
+		return nil, fmt.Errorf("draft %s: %w", id, ErrNotFound)
+	}
+	return i.(*Draft), nil
+}
+
+// Drafts returns the drafts of `owner`, most recently saved first.
+func (db *DB) Drafts(owner *url.URL) (drafts []*Draft) {
+	db.drafts.Range(func(key, value interface{}) bool {
+		if d := value.(*Draft); d.Owner.String() == owner.String() {
+			drafts = append(drafts, d)
+		}
+		return true
+	})
+	sort.Slice(drafts, func(i, j int) bool {
+		return drafts[i].UpdatedAt.After(drafts[j].UpdatedAt)
+	})
+	return
+}
+
+// UpdateDraft replaces the stored draft with the same ID as `d`.
+func (db *DB) UpdateDraft(d *Draft) {
+	db.drafts.Store(d.ID, d)
+}
+
+// TakeDraft forgets the draft with `id`, and reports whether it was still
+// there. Only one caller gets true, so a draft is never published twice.
+func (db *DB) TakeDraft(id string) bool {
+	_, ok := db.drafts.LoadAndDelete(id)
+	return ok
+}
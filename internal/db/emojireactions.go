@@ -0,0 +1,50 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package db
+
+import "net/url"
+
+// EmojiReaction is an actor reacting to an object with an emoji, as Misskey
+// and Pleroma let people do.
+type EmojiReaction struct {
+	// The activity reacting, an EmojiReact or a Like with content.
+	ID     *url.URL
+	Actor  *url.URL
+	Object *url.URL
+	// The emoji: a Unicode one, or a custom one's shortcode, such as
+	// ":blobcat:".
+	Emoji string
+}
+
+// AddEmojiReaction records the reaction `r`, replacing any with the same
+// activity IRI.
+func (db *DB) AddEmojiReaction(r EmojiReaction) {
+	db.emojiReactions.Store(r.ID.String(), r)
+}
+
+// EmojiReaction returns the reaction made by the activity at `id`, if any.
+func (db *DB) EmojiReaction(id *url.URL) (EmojiReaction, bool) {
+	i, ok := db.emojiReactions.Load(id.String())
+	if !ok {
+		return EmojiReaction{}, false
+	}
+	return i.(EmojiReaction), true
+}
+
+// RemoveEmojiReaction forgets the reaction made by the activity at `id`.
+func (db *DB) RemoveEmojiReaction(id *url.URL) {
+	db.emojiReactions.Delete(id.String())
+}
+
+// EmojiReactions lists the reactions to the object at `objectIRI`.
+func (db *DB) EmojiReactions(objectIRI *url.URL) []EmojiReaction {
+	var reactions []EmojiReaction
+	db.emojiReactions.Range(func(_, value interface{}) bool {
+		if r := value.(EmojiReaction); r.Object.String() == objectIRI.String() {
+			reactions = append(reactions, r)
+		}
+		return true
+	})
+	return reactions
+}
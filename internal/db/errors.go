@@ -0,0 +1,22 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package db
+
+import "errors"
+
+// What our methods fail with wraps one of these, for callers to tell apart
+// with errors.Is.
+var (
+	// Nothing is stored under the ID, username or token asked for.
+	ErrNotFound = errors.New("not found")
+	// Something is stored there, but not the kind of thing asked for, say a
+	// Note where an actor was expected.
+	ErrWrongType = errors.New("wrong type")
+	// What was asked for belongs to a peer, not to us.
+	ErrNotOwned = errors.New("not ours")
+	// A local account already has the username asked for.
+	ErrUsernameTaken = errors.New("username already taken")
+	// A lock was released without being held. See UnlockError.
+	ErrLockViolation = errors.New("lock violation")
+)
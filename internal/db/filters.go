@@ -0,0 +1,73 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package db
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Filter hides, or marks, statuses matching a phrase from a local actor's
+// timelines.
+type Filter struct {
+	ID    string
+	Owner *url.URL
+	// What to look for: a keyword or phrase, or a regular expression if
+	// Regex is set.
+	Phrase string
+	Regex  bool
+	// Only match the phrase as whole words.
+	WholeWord bool
+	// Where the filter applies: "home", "notifications", "public",
+	// "thread" or "account".
+	Contexts []string
+	// Matching statuses are dropped outright rather than marked.
+	Irreversible bool
+	// When the filter stops applying. The zero time means never.
+	ExpiresAt time.Time
+}
+
+// CreateFilter stores a new filter, assigning its ID.
+func (db *DB) CreateFilter(f *Filter) {
+	f.ID = strconv.FormatInt(db.filterIDs.Add(1), 10)
+	db.filters.Store(f.ID, f)
+}
+
+// Filter returns the filter with `id`.
+func (db *DB) Filter(id string) (*Filter, error) {
+	i, ok := db.filters.Load(id)
+	if !ok {
+		return nil, fmt.Errorf("filter %s: %w", id, ErrNotFound)
+	}
+	return i.(*Filter), nil
+}
+
+// Filters returns the filters `owner` made, oldest first.
+func (db *DB) Filters(owner *url.URL) (filters []*Filter) {
+	db.filters.Range(func(key, value interface{}) bool {
+		if f := value.(*Filter); f.Owner.String() == owner.String() {
+			filters = append(filters, f)
+		}
+		return true
+	})
+	sort.Slice(filters, func(i, j int) bool {
+		a, _ := strconv.Atoi(filters[i].ID)
+		b, _ := strconv.Atoi(filters[j].ID)
+		return a < b
+	})
+	return
+}
+
+// UpdateFilter replaces the stored filter with the same ID as `f`.
+func (db *DB) UpdateFilter(f *Filter) {
+	db.filters.Store(f.ID, f)
+}
+
+// DeleteFilter forgets the filter with `id`.
+func (db *DB) DeleteFilter(id string) {
+	db.filters.Delete(id)
+}
@@ -0,0 +1,58 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package db
+
+import (
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// FollowRequest is a Follow of a local actor approving its followers,
+// waiting for them to say yes or no.
+type FollowRequest struct {
+	// Who wants to follow whom.
+	Actor  *url.URL
+	Target *url.URL
+	// The Follow itself, to accept or reject.
+	Follow    vocab.ActivityStreamsFollow
+	CreatedAt time.Time
+}
+
+// AddFollowRequest stores `r`, replacing any request by the same actor to
+// follow the same target.
+func (db *DB) AddFollowRequest(r *FollowRequest) {
+	db.followRequests.Store(followRequestKey(r.Actor, r.Target), r)
+}
+
+// FollowRequests returns the requests to follow the actor at `targetIRI`,
+// oldest first.
+func (db *DB) FollowRequests(targetIRI *url.URL) (requests []*FollowRequest) {
+	db.followRequests.Range(func(key, value interface{}) bool {
+		if r := value.(*FollowRequest); r.Target.String() == targetIRI.String() {
+			requests = append(requests, r)
+		}
+		return true
+	})
+	sort.Slice(requests, func(i, j int) bool {
+		return requests[i].CreatedAt.Before(requests[j].CreatedAt)
+	})
+	return
+}
+
+// TakeFollowRequest removes and returns the request of the actor at
+// `actorIRI` to follow the one at `targetIRI`, if there's one.
+func (db *DB) TakeFollowRequest(actorIRI, targetIRI *url.URL) (*FollowRequest, bool) {
+	r, ok := db.followRequests.LoadAndDelete(followRequestKey(actorIRI, targetIRI))
+	if !ok {
+		return nil, false
+	}
+	return r.(*FollowRequest), true
+}
+
+func followRequestKey(actorIRI, targetIRI *url.URL) string {
+	return actorIRI.String() + " " + targetIRI.String()
+}
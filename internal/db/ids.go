@@ -0,0 +1,48 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// IDGenerator mints the IRIs of new objects, letting operators lay them out
+// as they like. IRIs it mints must be on `hostname`, and should seldom
+// repeat: DB.NewID mints again when one is taken, but only a few times.
+type IDGenerator interface {
+	NewID(c context.Context, hostname string, t vocab.Type) (*url.URL, error)
+}
+
+// How many IRIs NewID mints before giving up on finding one not taken.
+const maxIDAttempts = 8
+
+// TypedIDs is the IDGenerator we use unless told otherwise. Everything lives
+// under a path named after its type, with a random suffix. See Snowflakes for
+// suffixes sorting by time.
+type TypedIDs struct{}
+
+func (TypedIDs) NewID(c context.Context, hostname string, t vocab.Type) (*url.URL, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return &url.URL{
+		Scheme: "https",
+		Host:   hostname,
+		Path:   fmt.Sprintf("/%s/%s", strings.ToLower(t.GetTypeName()), hex.EncodeToString(b)),
+	}, nil
+}
+
+// SetIDGenerator has new objects get their IRIs from `g`. Objects already
+// stored keep theirs.
+func (db *DB) SetIDGenerator(g IDGenerator) {
+	db.ids = g
+}
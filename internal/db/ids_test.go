@@ -0,0 +1,49 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-fed/activity/streams"
+)
+
+func TestIDGenerators(t *testing.T) {
+	c := context.Background()
+	db := newTestDB()
+	at := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return at }
+	seen := make(map[string]string)
+	// mint mints and stores `n` Notes' IRIs with `g`, checking each is ours
+	// and new.
+	mint := func(name string, g IDGenerator, n int) {
+		t.Helper()
+		db.SetIDGenerator(g)
+		for i := 0; i < n; i++ {
+			note := streams.NewActivityStreamsNote()
+			iri, err := db.NewID(c, note)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if iri.Scheme != "https" || iri.Host != "mastogon.test" || iri.Path == "" {
+				t.Errorf("%s minted %s, not ours", name, iri)
+			}
+			if by, ok := seen[iri.String()]; ok {
+				t.Errorf("%s minted %s, as %s had", name, iri, by)
+			}
+			seen[iri.String()] = name
+			store(t, db, iri.String(), note)
+		}
+	}
+	mint("typed", TypedIDs{}, 4)
+	mint("snowflakes", &Snowflakes{Now: clock}, 4)
+	// Another generator, or the same one after a restart, minting in the
+	// same millisecond starts over where the first did.
+	mint("restarted snowflakes", &Snowflakes{Now: clock}, 4)
+	// As does one whose clock went back.
+	at = at.Add(-time.Hour)
+	mint("snowflakes after the clock went back", &Snowflakes{Now: clock}, 4)
+}
@@ -0,0 +1,48 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package db
+
+import (
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Job is work to be done once, at a given time, by whichever handler the
+// service has for its kind. Like scheduled statuses, jobs live as long as the
+// database does: a service started again over it picks them up, but with
+// the memory backend, they're lost with the process.
+type Job struct {
+	ID   string
+	Kind string
+	// What the handler is to work on, in whatever form it likes.
+	Payload string
+	At      time.Time
+}
+
+// CreateJob stores a new job, assigning its ID.
+func (db *DB) CreateJob(j *Job) {
+	j.ID = strconv.FormatInt(db.jobIDs.Add(1), 10)
+	db.jobs.Store(j.ID, j)
+}
+
+// Jobs returns the jobs waiting to be done, soonest first.
+func (db *DB) Jobs() (jobs []*Job) {
+	db.jobs.Range(func(key, value interface{}) bool {
+		jobs = append(jobs, value.(*Job))
+		return true
+	})
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].At.Before(jobs[j].At)
+	})
+	return
+}
+
+// TakeJob forgets the job with `id`, and reports whether it was still
+// there. Only one caller gets true, so a job is never done twice nor done
+// once cancelled.
+func (db *DB) TakeJob(id string) bool {
+	_, ok := db.jobs.LoadAndDelete(id)
+	return ok
+}
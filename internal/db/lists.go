@@ -0,0 +1,64 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package db
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+// List is a local actor's own grouping of accounts, with a timeline of its
+// own. Lists never leave the instance.
+type List struct {
+	ID    string
+	Owner *url.URL
+	Title string
+	// Which replies show up: "followed", "list" or "none".
+	RepliesPolicy string
+	// The IRIs of the actors on the list.
+	Members []string
+}
+
+// CreateList stores a new list, assigning its ID.
+func (db *DB) CreateList(l *List) {
+	l.ID = strconv.FormatInt(db.listIDs.Add(1), 10)
+	db.lists.Store(l.ID, l)
+}
+
+// List returns the list with `id`.
+func (db *DB) List(id string) (*List, error) {
+	i, ok := db.lists.Load(id)
+	if !ok {
+		return nil, fmt.Errorf("list %s: %w", id, ErrNotFound)
+	}
+	return i.(*List), nil
+}
+
+// Lists returns the lists `owner` made, oldest first.
+func (db *DB) Lists(owner *url.URL) (lists []*List) {
+	db.lists.Range(func(key, value interface{}) bool {
+		if l := value.(*List); l.Owner.String() == owner.String() {
+			lists = append(lists, l)
+		}
+		return true
+	})
+	sort.Slice(lists, func(i, j int) bool {
+		a, _ := strconv.Atoi(lists[i].ID)
+		b, _ := strconv.Atoi(lists[j].ID)
+		return a < b
+	})
+	return
+}
+
+// UpdateList replaces the stored list with the same ID as `l`.
+func (db *DB) UpdateList(l *List) {
+	db.lists.Store(l.ID, l)
+}
+
+// DeleteList forgets the list with `id`.
+func (db *DB) DeleteList(id string) {
+	db.lists.Delete(id)
+}
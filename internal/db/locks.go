@@ -0,0 +1,194 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package db
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// How long to wait on a lock before warning that we might be deadlocked.
+const lockWarnAfter = 10 * time.Second
+
+// UnlockError is returned by Unlock when the ID isn't locked, either because
+// Lock was never called on it or because it was already unlocked, or when
+// someone else holds it, as after a second Unlock once another took the
+// lock. Go-Fed always pairs the two, so this points at a bug somewhere. It
+// is an ErrLockViolation.
+type UnlockError struct {
+	Id string
+	// Whether someone else holds the lock.
+	Held bool
+}
+
+func (e *UnlockError) Error() string {
+	if e.Held {
+		return "Unlock of " + e.Id + ", which someone else holds"
+	}
+	return "Unlock of " + e.Id + ", which is not locked"
+}
+
+func (e *UnlockError) Is(target error) bool {
+	return target == ErrLockViolation
+}
+
+// Go-Fed's Lock and Unlock only name the ID, but pass the context of what
+// it's doing along, the same to both. Contexts made with WithLockHolder say
+// who's locking then: an Unlock may only release the lock for the holder
+// that took it. Those without one all count as the same, anonymous, holder.
+
+type lockHolderKey struct{}
+
+// lockHolder is who holds a lock. It isn't empty, so that each one made is
+// told apart.
+type lockHolder struct{ _ byte }
+
+// WithLockHolder returns `c` for a holder of locks of its own, such as a
+// request being handled, which Lock and Unlock are to be given.
+func WithLockHolder(c context.Context) context.Context {
+	return context.WithValue(c, lockHolderKey{}, &lockHolder{})
+}
+
+// lockHolderOf returns the holder locking with context `c`, nil for the
+// anonymous one.
+func lockHolderOf(c context.Context) *lockHolder {
+	h, _ := c.Value(lockHolderKey{}).(*lockHolder)
+	return h
+}
+
+// lockManager hands out a lock per ActivityPub ID. Locks only exist while
+// someone holds or waits on them, so IDs touched once don't leak a mutex
+// forever.
+type lockManager struct {
+	mu    sync.Mutex
+	locks map[string]*idLock
+}
+
+type idLock struct {
+	// Holds a token while the ID is locked. Being a channel rather than a
+	// sync.Mutex lets waiters give up when their context is done.
+	held chan struct{}
+	// How many goroutines hold or are waiting on this lock.
+	refs int
+	// Who holds it, guarded by the lockManager's mutex.
+	holder *lockHolder
+}
+
+// acquire returns the lock for `id`, counting the caller as a user of it.
+func (m *lockManager) acquire(id string) *idLock {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.locks == nil {
+		m.locks = make(map[string]*idLock)
+	}
+	l, ok := m.locks[id]
+	if !ok {
+		l = &idLock{held: make(chan struct{}, 1)}
+		m.locks[id] = l
+	}
+	l.refs++
+	return l
+}
+
+// release stops counting the caller as a user of the lock for `id`, letting
+// it be collected once nobody uses it.
+func (m *lockManager) release(id string, l *idLock) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l.refs--
+	if l.refs == 0 {
+		delete(m.locks, id)
+	}
+}
+
+func (m *lockManager) lock(c context.Context, id string) error {
+	l := m.acquire(id)
+	warn := time.NewTimer(lockWarnAfter)
+	defer warn.Stop()
+	for {
+		select {
+		case l.held <- struct{}{}:
+			m.mu.Lock()
+			l.holder = lockHolderOf(c)
+			m.mu.Unlock()
+			return nil
+		case <-c.Done():
+			m.release(id, l)
+			return c.Err()
+		case <-warn.C:
+			log.Printf("waited %s to lock %s, possible deadlock", lockWarnAfter, id)
+		}
+	}
+}
+
+// unlock unlocks `id` for the holder unlocking with context `c`, refusing
+// to if it isn't locked, or is by another holder.
+func (m *lockManager) unlock(c context.Context, id string) error {
+	m.mu.Lock()
+	l, ok := m.locks[id]
+	err := &UnlockError{Id: id}
+	switch {
+	case ok && l.holder != lockHolderOf(c):
+		// Either not held at all, or by someone else.
+		err.Held = len(l.held) > 0
+	case ok:
+		select {
+		case <-l.held:
+			l.holder = nil
+			m.mu.Unlock()
+			m.release(id, l)
+			return nil
+		default:
+			// Only waiters are left, the holder already unlocked.
+		}
+	}
+	m.mu.Unlock()
+	log.Printf("warning: %s", err)
+	return err
+}
+
+// LockAll locks every ID in `ids`, always in the same sorted order so that
+// two callers locking overlapping sets can't deadlock each other. On error
+// nothing is left locked.
+func (db *DB) LockAll(c context.Context, ids ...*url.URL) error {
+	keys := sortedUniqueIds(ids)
+	for i, key := range keys {
+		if err := db.locks.lock(c, key); err != nil {
+			for j := i - 1; j >= 0; j-- {
+				db.locks.unlock(c, keys[j])
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// UnlockAll undoes LockAll.
+func (db *DB) UnlockAll(c context.Context, ids ...*url.URL) error {
+	keys := sortedUniqueIds(ids)
+	var err error
+	for i := len(keys) - 1; i >= 0; i-- {
+		if e := db.locks.unlock(c, keys[i]); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func sortedUniqueIds(ids []*url.URL) []string {
+	seen := make(map[string]bool, len(ids))
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if key := id.String(); !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
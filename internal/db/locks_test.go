@@ -0,0 +1,196 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testIRIs(n int) []*url.URL {
+	iris := make([]*url.URL, n)
+	for i := range iris {
+		iris[i] = &url.URL{Scheme: "https", Host: "mastogon.test", Path: fmt.Sprintf("/note/%d", i)}
+	}
+	return iris
+}
+
+// leftover returns how many locks `db` still keeps.
+func leftover(db *DB) int {
+	db.locks.mu.Lock()
+	defer db.locks.mu.Unlock()
+	return len(db.locks.locks)
+}
+
+func TestLockExcludes(t *testing.T) {
+	c := context.Background()
+	db := &DB{}
+	id := testIRIs(1)[0]
+	// Unsynchronized but for the lock, so the race detector catches any
+	// overlap.
+	count := 0
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if err := db.Lock(c, id); err != nil {
+					t.Error(err)
+					return
+				}
+				count++
+				if err := db.Unlock(c, id); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if count != 100*100 {
+		t.Errorf("count = %d, want %d", count, 100*100)
+	}
+	if n := leftover(db); n != 0 {
+		t.Errorf("%d locks leaked", n)
+	}
+}
+
+func TestLockAllDoesNotDeadlock(t *testing.T) {
+	c, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	db := &DB{}
+	iris := testIRIs(8)
+	// Only touched with their IRIs locked, for the race detector to check.
+	counts := make([]int, len(iris))
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(seed))
+			for j := 0; j < 50; j++ {
+				// Overlapping sets, each in its own order.
+				var set []int
+				for _, k := range r.Perm(len(iris))[:1+r.Intn(len(iris))] {
+					set = append(set, k, k)
+				}
+				ids := make([]*url.URL, len(set))
+				for i, k := range set {
+					ids[i] = iris[k]
+				}
+				if err := db.LockAll(c, ids...); err != nil {
+					t.Error(err)
+					return
+				}
+				for _, k := range set {
+					counts[k]++
+				}
+				if err := db.UnlockAll(c, ids...); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(int64(i))
+	}
+	wg.Wait()
+	if c.Err() != nil {
+		t.Fatal("deadlocked")
+	}
+	if n := leftover(db); n != 0 {
+		t.Errorf("%d locks leaked", n)
+	}
+}
+
+func TestLockAllGivesUp(t *testing.T) {
+	c := context.Background()
+	db := &DB{}
+	iris := testIRIs(3)
+	if err := db.Lock(c, iris[1]); err != nil {
+		t.Fatal(err)
+	}
+	timeout, cancel := context.WithTimeout(c, 20*time.Millisecond)
+	defer cancel()
+	if err := db.LockAll(timeout, iris...); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("LockAll = %v, want %v", err, context.DeadlineExceeded)
+	}
+	// Nothing else was left locked.
+	for _, id := range []*url.URL{iris[0], iris[2]} {
+		if err := db.Unlock(c, id); !errors.Is(err, ErrLockViolation) {
+			t.Errorf("Unlock(%s) = %v, want %v", id, err, ErrLockViolation)
+		}
+	}
+	if err := db.Unlock(c, iris[1]); err != nil {
+		t.Fatal(err)
+	}
+	if n := leftover(db); n != 0 {
+		t.Errorf("%d locks leaked", n)
+	}
+}
+
+func TestUnlockUnlocked(t *testing.T) {
+	c := context.Background()
+	db := &DB{}
+	id := testIRIs(1)[0]
+	err := db.Unlock(c, id)
+	var unlockErr *UnlockError
+	if !errors.As(err, &unlockErr) || !errors.Is(err, ErrLockViolation) {
+		t.Fatalf("Unlock = %v, want an UnlockError", err)
+	}
+	if err := db.Lock(c, id); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Unlock(c, id); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Unlock(c, id); !errors.Is(err, ErrLockViolation) {
+		t.Fatalf("second Unlock = %v, want %v", err, ErrLockViolation)
+	}
+}
+
+func TestStaleUnlock(t *testing.T) {
+	db := &DB{}
+	id := testIRIs(1)[0]
+	first := WithLockHolder(context.Background())
+	if err := db.Lock(first, id); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Unlock(first, id); err != nil {
+		t.Fatal(err)
+	}
+	second := WithLockHolder(context.Background())
+	locked := make(chan error)
+	go func() { locked <- db.Lock(second, id) }()
+	if err := <-locked; err != nil {
+		t.Fatal(err)
+	}
+
+	// Unlocking again, the first holder doesn't release the second's lock.
+	err := db.Unlock(first, id)
+	var unlockErr *UnlockError
+	if !errors.As(err, &unlockErr) || !unlockErr.Held || !errors.Is(err, ErrLockViolation) {
+		t.Fatalf("stale Unlock = %v, want an UnlockError for a lock someone else holds", err)
+	}
+	timeout, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := db.Lock(timeout, id); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Lock after the stale Unlock = %v, want it still held", err)
+	}
+	// Nor does anyone else, anonymous or not.
+	if err := db.Unlock(context.Background(), id); !errors.Is(err, ErrLockViolation) {
+		t.Errorf("anonymous Unlock = %v, want %v", err, ErrLockViolation)
+	}
+	if err := db.Unlock(second, id); err != nil {
+		t.Fatal(err)
+	}
+	if n := leftover(db); n != 0 {
+		t.Errorf("%d locks leaked", n)
+	}
+}
@@ -0,0 +1,64 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package db
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"net/url"
+	"path"
+	"strconv"
+)
+
+// Mastodon clients refer to statuses and accounts by short numeric IDs,
+// where ActivityPub has IRIs. Our IRIs ending in a snowflake have it as
+// their ID; any other IRI has a hash of it, so it gets the same ID again
+// after a restart. Both ways round are kept, and Construct hands the IRIs
+// it finds stored theirs, so clients can still look up IDs from before.
+
+// MastodonIDForIRI returns the Mastodon ID of the object at `iri`, handing
+// it one if it has none yet.
+func (db *DB) MastodonIDForIRI(iri *url.URL) string {
+	return db.mastodonID(iri.String())
+}
+
+func (db *DB) mastodonID(iri string) string {
+	if v, ok := db.iriIDs.Load(iri); ok {
+		return v.(string)
+	}
+	id := ""
+	if u, err := url.Parse(iri); err == nil && db.IsLocalHost(u.Host) {
+		base := path.Base(u.Path)
+		if _, err := strconv.ParseUint(base, 10, 63); err == nil {
+			// Unless a hex suffix happened to be all digits, and
+			// matches one already handed out.
+			if v, loaded := db.mastodonIDs.LoadOrStore(base, iri); !loaded || v.(string) == iri {
+				id = base
+			}
+		}
+	}
+	// Should two IRIs hash the same, the second hashes again, salted.
+	for salt := 0; id == ""; salt++ {
+		h := sha256.Sum256([]byte(iri + "#" + strconv.Itoa(salt)))
+		candidate := strconv.FormatUint(binary.BigEndian.Uint64(h[:])>>1, 10)
+		if v, loaded := db.mastodonIDs.LoadOrStore(candidate, iri); !loaded || v.(string) == iri {
+			id = candidate
+		}
+	}
+	if v, loaded := db.iriIDs.LoadOrStore(iri, id); loaded {
+		// Another request got there first, with the same ID.
+		return v.(string)
+	}
+	return id
+}
+
+// IRIForMastodonID reverses MastodonIDForIRI, for IDs it has handed out.
+func (db *DB) IRIForMastodonID(id string) (*url.URL, bool) {
+	v, ok := db.mastodonIDs.Load(id)
+	if !ok {
+		return nil, false
+	}
+	iri, err := url.Parse(v.(string))
+	return iri, err == nil
+}
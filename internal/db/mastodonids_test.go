@@ -0,0 +1,139 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package db
+
+import (
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/go-fed/activity/streams"
+)
+
+func TestMastodonIDRoundTrip(t *testing.T) {
+	db := newTestDB()
+	for _, iri := range []string{
+		"https://mastogon.test/note/112233445566778899",
+		"https://mastogon.test/users/alice",
+		"https://mastogon.test/note/0a1b2c",
+		"https://peer.test/users/bob/statuses/1",
+	} {
+		u, err := url.Parse(iri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id := db.MastodonIDForIRI(u)
+		if _, err := strconv.ParseUint(id, 10, 63); err != nil {
+			t.Errorf("%s: ID %q isn't a number", iri, id)
+		}
+		if again := db.MastodonIDForIRI(u); again != id {
+			t.Errorf("%s: ID %s, then %s", iri, id, again)
+		}
+		got, ok := db.IRIForMastodonID(id)
+		if !ok || got.String() != iri {
+			t.Errorf("IRIForMastodonID(%s) = %v, %v; want %s", id, got, ok, iri)
+		}
+	}
+	if _, ok := db.IRIForMastodonID("12345"); ok {
+		t.Error("found an IRI for an ID never handed out")
+	}
+}
+
+func TestMastodonIDOfSnowflake(t *testing.T) {
+	db := newTestDB()
+	u, _ := url.Parse("https://mastogon.test/note/112233445566778899")
+	if id := db.MastodonIDForIRI(u); id != "112233445566778899" {
+		t.Errorf("ID %s, want the snowflake the IRI ends in", id)
+	}
+	// Another IRI ending in the same number can't have it too.
+	other, _ := url.Parse("https://mastogon.test/question/112233445566778899")
+	if id := db.MastodonIDForIRI(other); id == "112233445566778899" {
+		t.Error("two IRIs got the same ID")
+	}
+	// Peers' numbers are theirs, and could be anything.
+	remote, _ := url.Parse("https://peer.test/notes/7")
+	if id := db.MastodonIDForIRI(remote); id == "7" {
+		t.Error("a peer's IRI kept its own number")
+	}
+}
+
+func TestMastodonIDConcurrent(t *testing.T) {
+	db := newTestDB()
+	u, _ := url.Parse("https://peer.test/users/bob")
+	ids := make([]string, 50)
+	var wg sync.WaitGroup
+	for i := range ids {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ids[i] = db.MastodonIDForIRI(u)
+		}(i)
+	}
+	wg.Wait()
+	for _, id := range ids {
+		if id != ids[0] {
+			t.Fatalf("handed out both %s and %s", ids[0], id)
+		}
+	}
+	if got, ok := db.IRIForMastodonID(ids[0]); !ok || got.String() != u.String() {
+		t.Errorf("IRIForMastodonID(%s) = %v, %v", ids[0], got, ok)
+	}
+}
+
+func TestMastodonIDAfterRestart(t *testing.T) {
+	db := newTestDB()
+	iris := []*url.URL{}
+	for _, iri := range []string{
+		"https://mastogon.test/note/112233445566778899",
+		"https://mastogon.test/users/alice",
+		"https://peer.test/users/bob",
+		"https://peer.test/users/bob/statuses/1",
+	} {
+		u, _ := url.Parse(iri)
+		iris = append(iris, u)
+	}
+	ids := make([]string, len(iris))
+	for i, iri := range iris {
+		ids[i] = db.MastodonIDForIRI(iri)
+	}
+	// The last is stored, so its ID can be looked up before anything asks
+	// for it again.
+	store(t, db, iris[3].String(), streams.NewActivityStreamsNote())
+
+	// As a restart over the same content would.
+	again := &DB{}
+	again.Construct(db.content, "mastogon.test")
+	if got, ok := again.IRIForMastodonID(ids[3]); !ok || got.String() != iris[3].String() {
+		t.Errorf("IRIForMastodonID(%s) = %v, %v after a restart", ids[3], got, ok)
+	}
+	for i, iri := range iris {
+		if got := again.MastodonIDForIRI(iri); got != ids[i] {
+			t.Errorf("%s: ID %s after a restart, want %s", iri, got, ids[i])
+		}
+		if got, ok := again.IRIForMastodonID(ids[i]); !ok || got.String() != iri.String() {
+			t.Errorf("IRIForMastodonID(%s) = %v, %v after a restart", ids[i], got, ok)
+		}
+	}
+}
+
+func TestMastodonIDCollision(t *testing.T) {
+	remote, _ := url.Parse("https://peer.test/users/bob")
+	id := newTestDB().MastodonIDForIRI(remote)
+	// One of our IRIs ending in the same number takes it first.
+	db := newTestDB()
+	local, _ := url.Parse("https://mastogon.test/note/" + id)
+	if got := db.MastodonIDForIRI(local); got != id {
+		t.Fatalf("ID %s, want the snowflake the IRI ends in", got)
+	}
+	got := db.MastodonIDForIRI(remote)
+	if got == id {
+		t.Fatal("two IRIs got the same ID")
+	}
+	for _, want := range []*url.URL{local, remote} {
+		if iri, ok := db.IRIForMastodonID(db.MastodonIDForIRI(want)); !ok || iri.String() != want.String() {
+			t.Errorf("IRIForMastodonID = %v, %v; want %s", iri, ok, want)
+		}
+	}
+}
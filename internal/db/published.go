@@ -0,0 +1,60 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package db
+
+import (
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// publishedIndex keeps when what we store was published, as it's stored and
+// removed, so collections can be sorted and cut to a time range without
+// getting each of their items. Like the counts, it's worked out again by
+// Construct.
+type publishedIndex struct {
+	mu sync.RWMutex
+	// When each IRI was published. What doesn't say isn't in it.
+	times map[string]time.Time
+}
+
+// set indexes `id` as published at `t`, or takes it out of the index if `t`
+// is zero.
+func (x *publishedIndex) set(id string, t time.Time) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if t.IsZero() {
+		delete(x.times, id)
+		return
+	}
+	if x.times == nil {
+		x.times = make(map[string]time.Time)
+	}
+	x.times[id] = t
+}
+
+func (x *publishedIndex) get(id string) time.Time {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return x.times[id]
+}
+
+// publishedAt returns when `t` was published, or the zero time if it doesn't
+// say.
+func publishedAt(t vocab.Type) time.Time {
+	if o, ok := t.(interface {
+		GetActivityStreamsPublished() vocab.ActivityStreamsPublishedProperty
+	}); ok && o.GetActivityStreamsPublished() != nil {
+		return o.GetActivityStreamsPublished().Get()
+	}
+	return time.Time{}
+}
+
+// Published returns when what's stored at `id` was published, or the zero
+// time if we don't have it or it doesn't say.
+func (db *DB) Published(id *url.URL) time.Time {
+	return db.published.get(id.String())
+}
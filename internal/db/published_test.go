@@ -0,0 +1,54 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package db
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+func TestPublishedIndex(t *testing.T) {
+	db := newTestDB()
+	const iri = "https://mastogon.test/note/1"
+	id, _ := url.Parse(iri)
+	note := func(t time.Time) vocab.ActivityStreamsNote {
+		n := streams.NewActivityStreamsNote()
+		published := streams.NewActivityStreamsPublishedProperty()
+		published.Set(t)
+		n.SetActivityStreamsPublished(published)
+		return n
+	}
+	first := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	store(t, db, iri, note(first))
+	if got := db.Published(id); !got.Equal(first) {
+		t.Errorf("published %v once stored, want %v", got, first)
+	}
+	edited := first.Add(time.Hour)
+	store(t, db, iri, note(edited))
+	if got := db.Published(id); !got.Equal(edited) {
+		t.Errorf("published %v once replaced, want %v", got, edited)
+	}
+
+	// Construct indexes what's already stored.
+	reopened := &DB{}
+	reopened.Construct(db.content, "mastogon.test")
+	if got := reopened.Published(id); !got.Equal(edited) {
+		t.Errorf("published %v once reopened, want %v", got, edited)
+	}
+
+	remove(t, db, iri)
+	if got := db.Published(id); !got.IsZero() {
+		t.Errorf("published %v once deleted, want nothing", got)
+	}
+	// What doesn't say isn't indexed.
+	store(t, db, iri, streams.NewActivityStreamsNote())
+	if got := db.Published(id); !got.IsZero() {
+		t.Errorf("published %v for a note that doesn't say, want nothing", got)
+	}
+}
@@ -0,0 +1,94 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package db
+
+import (
+	"net/url"
+	"sync"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// refCounts counts, for each IRI, the collections listing it and the
+// activities carrying it as their object. Something nothing references any
+// longer is safe to prune.
+type refCounts struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+// adjust counts the references of `after` in place of those of `before`.
+func (r *refCounts) adjust(before, after []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.counts == nil {
+		r.counts = make(map[string]int)
+	}
+	for _, id := range after {
+		r.counts[id]++
+	}
+	for _, id := range before {
+		if r.counts[id]--; r.counts[id] <= 0 {
+			delete(r.counts, id)
+		}
+	}
+}
+
+func (r *refCounts) get(id string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.counts[id]
+}
+
+// RefCount returns how many collections and activities we store reference
+// `id`.
+func (db *DB) RefCount(id *url.URL) int {
+	return db.refs.get(id.String())
+}
+
+// refsOf returns the IRIs `t` references: the items of a collection, or the
+// objects of an activity.
+func refsOf(t vocab.Type) (refs []string) {
+	if t == nil {
+		return nil
+	}
+	appendIds := func(iter pub.IdProperty) {
+		if id, err := pub.ToId(iter); err == nil {
+			refs = append(refs, id.String())
+		}
+	}
+	switch v := t.(type) {
+	case vocab.ActivityStreamsOrderedCollection:
+		if oi := v.GetActivityStreamsOrderedItems(); oi != nil {
+			for iter := oi.Begin(); iter != oi.End(); iter = iter.Next() {
+				appendIds(iter)
+			}
+		}
+	case vocab.ActivityStreamsCollection:
+		if ci := v.GetActivityStreamsItems(); ci != nil {
+			for iter := ci.Begin(); iter != ci.End(); iter = iter.Next() {
+				appendIds(iter)
+			}
+		}
+	case interface {
+		GetActivityStreamsObject() vocab.ActivityStreamsObjectProperty
+	}:
+		if o := v.GetActivityStreamsObject(); o != nil {
+			for iter := o.Begin(); iter != o.End(); iter = iter.Next() {
+				appendIds(iter)
+			}
+		}
+	}
+	return
+}
+
+// storedRefs returns what the content stored at `id` referenced when it was
+// stored.
+func (db *DB) storedRefs(id string) []string {
+	if iCon, ok := db.content.Load(id); ok {
+		return iCon.(*DBContent).refs
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package db
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/go-fed/activity/streams"
+)
+
+func TestRefCount(t *testing.T) {
+	d := newTestDB()
+	alice, _ := url.Parse("https://remote.test/users/alice")
+	bob, _ := url.Parse("https://remote.test/users/bob")
+	check := func(when string, wantAlice, wantBob int) {
+		t.Helper()
+		if a, b := d.RefCount(alice), d.RefCount(bob); a != wantAlice || b != wantBob {
+			t.Errorf("%s: alice referenced %d times and bob %d, want %d and %d", when, a, b, wantAlice, wantBob)
+		}
+	}
+	collection := streams.NewActivityStreamsCollection()
+	items := streams.NewActivityStreamsItemsProperty()
+	items.AppendIRI(alice)
+	items.AppendIRI(bob)
+	collection.SetActivityStreamsItems(items)
+	store(t, d, "https://mastogon.test/users/carol/following", collection)
+	check("following both", 1, 1)
+
+	like := streams.NewActivityStreamsLike()
+	object := streams.NewActivityStreamsObjectProperty()
+	object.AppendIRI(alice)
+	like.SetActivityStreamsObject(object)
+	store(t, d, "https://mastogon.test/likes/1", like)
+	check("liking alice too", 2, 1)
+
+	// Unfollowing bob.
+	items = streams.NewActivityStreamsItemsProperty()
+	items.AppendIRI(alice)
+	collection.SetActivityStreamsItems(items)
+	store(t, d, "https://mastogon.test/users/carol/following", collection)
+	check("unfollowing bob", 2, 0)
+
+	// Unliking alice.
+	remove(t, d, "https://mastogon.test/likes/1")
+	check("unliking alice", 1, 0)
+	remove(t, d, "https://mastogon.test/users/carol/following")
+	check("with nothing left", 0, 0)
+}
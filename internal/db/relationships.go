@@ -0,0 +1,57 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package db
+
+import "net/url"
+
+// SetNote stores the private note the local actor at `actorIRI` keeps about
+// `targetIRI`. An empty note clears it.
+func (db *DB) SetNote(actorIRI, targetIRI *url.URL, note string) {
+	if note == "" {
+		db.notes.Delete(pairKey(actorIRI, targetIRI))
+	} else {
+		db.notes.Store(pairKey(actorIRI, targetIRI), note)
+	}
+}
+
+// Note returns the private note the local actor at `actorIRI` keeps about
+// `targetIRI`, if any.
+func (db *DB) Note(actorIRI, targetIRI *url.URL) string {
+	i, ok := db.notes.Load(pairKey(actorIRI, targetIRI))
+	if !ok {
+		return ""
+	}
+	return i.(string)
+}
+
+// SetMuting records whether the local actor at `actorIRI` mutes `targetIRI`.
+func (db *DB) SetMuting(actorIRI, targetIRI *url.URL, muting bool) {
+	if muting {
+		db.mutes.Store(pairKey(actorIRI, targetIRI), targetIRI)
+	} else {
+		db.mutes.Delete(pairKey(actorIRI, targetIRI))
+	}
+}
+
+// IsMuting reports whether the local actor at `actorIRI` mutes `targetIRI`.
+func (db *DB) IsMuting(actorIRI, targetIRI *url.URL) bool {
+	_, ok := db.mutes.Load(pairKey(actorIRI, targetIRI))
+	return ok
+}
+
+// SetConversationRead records the latest status of the conversation `id` the
+// local actor at `actorIRI` has read.
+func (db *DB) SetConversationRead(actorIRI *url.URL, id, statusIRI string) {
+	db.conversationReads.Store([2]string{actorIRI.String(), id}, statusIRI)
+}
+
+// ConversationRead returns the latest status of the conversation `id` the
+// local actor at `actorIRI` has read, if any.
+func (db *DB) ConversationRead(actorIRI *url.URL, id string) string {
+	i, ok := db.conversationReads.Load([2]string{actorIRI.String(), id})
+	if !ok {
+		return ""
+	}
+	return i.(string)
+}
@@ -0,0 +1,58 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package db
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Report is a local user's complaint about an account, and maybe some of
+// its statuses, for our moderators to look into.
+type Report struct {
+	ID       string
+	Reporter *url.URL
+	Target   *url.URL
+	Statuses []*url.URL
+	Comment  string
+	// The Flag the report was forwarded to the target's instance with, if
+	// it was.
+	Forwarded *url.URL
+	CreatedAt time.Time
+}
+
+// CreateReport stores a new report, assigning its ID.
+func (db *DB) CreateReport(r *Report) {
+	r.ID = strconv.FormatInt(db.reportIDs.Add(1), 10)
+	db.reports.Store(r.ID, r)
+}
+
+// Report returns the report with `id`.
+func (db *DB) Report(id string) (*Report, error) {
+	i, ok := db.reports.Load(id)
+	if !ok {
+		return nil, fmt.Errorf("report %s: %w", id, ErrNotFound)
+	}
+	return i.(*Report), nil
+}
+
+// Reports returns all the reports, most recent first.
+func (db *DB) Reports() (reports []*Report) {
+	db.reports.Range(func(key, value interface{}) bool {
+		reports = append(reports, value.(*Report))
+		return true
+	})
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].CreatedAt.After(reports[j].CreatedAt)
+	})
+	return
+}
+
+// UpdateReport replaces the stored report with the same ID as `r`.
+func (db *DB) UpdateReport(r *Report) {
+	db.reports.Store(r.ID, r)
+}
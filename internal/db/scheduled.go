@@ -0,0 +1,65 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package db
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ScheduledStatus is a status a local actor wrote to be posted later. Like
+// pending deliveries, they live as long as the database does: with the
+// memory backend, they're lost with the process.
+type ScheduledStatus struct {
+	ID          string
+	Owner       *url.URL
+	ScheduledAt time.Time
+	// What the status will be posted with, as in service.StatusParams.
+	Status     string
+	Language   string
+	Visibility string
+	Sensitive  *bool
+	Quote      *url.URL
+}
+
+// CreateScheduledStatus stores a new scheduled status, assigning its ID.
+func (db *DB) CreateScheduledStatus(s *ScheduledStatus) {
+	s.ID = strconv.FormatInt(db.scheduledIDs.Add(1), 10)
+	db.scheduled.Store(s.ID, s)
+}
+
+// ScheduledStatus returns the scheduled status with `id`.
+func (db *DB) ScheduledStatus(id string) (*ScheduledStatus, error) {
+	i, ok := db.scheduled.Load(id)
+	if !ok {
+		return nil, fmt.Errorf("scheduled status %s: %w", id, ErrNotFound)
+	}
+	return i.(*ScheduledStatus), nil
+}
+
+// ScheduledStatuses returns the statuses `owner` scheduled, or everyone's if
+// `owner` is nil, soonest first.
+func (db *DB) ScheduledStatuses(owner *url.URL) (scheduled []*ScheduledStatus) {
+	db.scheduled.Range(func(key, value interface{}) bool {
+		if s := value.(*ScheduledStatus); owner == nil || s.Owner.String() == owner.String() {
+			scheduled = append(scheduled, s)
+		}
+		return true
+	})
+	sort.Slice(scheduled, func(i, j int) bool {
+		return scheduled[i].ScheduledAt.Before(scheduled[j].ScheduledAt)
+	})
+	return
+}
+
+// TakeScheduledStatus forgets the scheduled status with `id`, and reports
+// whether it was still there. Only one caller gets true, so a status is never
+// posted twice nor posted once cancelled.
+func (db *DB) TakeScheduledStatus(id string) bool {
+	_, ok := db.scheduled.LoadAndDelete(id)
+	return ok
+}
@@ -0,0 +1,61 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// Snowflakes is an IDGenerator ending IRIs in numbers that grow with time,
+// as Mastodon's status IDs do, so the IDs clients see sort as the statuses
+// do and make good `max_id` and `since_id` cursors. Like TypedIDs, it puts
+// everything under a path named after its type.
+//
+// A snowflake is the milliseconds since the Unix epoch, shifted left 16 bits,
+// the low bits telling apart those minted in the same millisecond. The zero
+// value is ready to use, and must not be copied once used.
+type Snowflakes struct {
+	mu   sync.Mutex
+	last int64
+	// For tests; time.Now if nil.
+	Now func() time.Time
+}
+
+func (s *Snowflakes) NewID(c context.Context, hostname string, t vocab.Type) (*url.URL, error) {
+	return &url.URL{
+		Scheme: "https",
+		Host:   hostname,
+		Path:   fmt.Sprintf("/%s/%d", strings.ToLower(t.GetTypeName()), s.Next()),
+	}, nil
+}
+
+// Next returns a snowflake greater than any it returned before, even should
+// the clock go back.
+func (s *Snowflakes) Next() int64 {
+	now := time.Now
+	if s.Now != nil {
+		now = s.Now
+	}
+	id := now().UnixMilli() << 16
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id <= s.last {
+		id = s.last + 1
+	}
+	s.last = id
+	return id
+}
+
+// SnowflakeTime returns when the snowflake `id` was minted, to the
+// millisecond.
+func SnowflakeTime(id int64) time.Time {
+	return time.UnixMilli(id >> 16)
+}
@@ -0,0 +1,75 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package db
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// Snowflakes are minted from many goroutines at once. Run with -race.
+func TestSnowflakesConcurrently(t *testing.T) {
+	var s Snowflakes
+	const workers, each = 8, 500
+	minted := make([][]int64, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < each; i++ {
+				minted[w] = append(minted[w], s.Next())
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	seen := make(map[int64]bool)
+	var last int64
+	for w, ids := range minted {
+		for i, id := range ids {
+			if seen[id] {
+				t.Fatalf("minted %d twice", id)
+			}
+			seen[id] = true
+			// Each goroutine sees them only grow.
+			if i > 0 && id <= ids[i-1] {
+				t.Errorf("goroutine %d minted %d after %d", w, id, ids[i-1])
+			}
+			if id > last {
+				last = id
+			}
+		}
+	}
+	if next := s.Next(); next <= last {
+		t.Errorf("minted %d after %d", next, last)
+	}
+}
+
+func TestSnowflakeTime(t *testing.T) {
+	at := time.Date(2026, 10, 16, 12, 34, 56, 789_000_000, time.UTC)
+	s := Snowflakes{Now: func() time.Time { return at }}
+	first, second := s.Next(), s.Next()
+	if second <= first {
+		t.Errorf("minted %d after %d in the same millisecond", second, first)
+	}
+	for _, id := range []int64{first, second} {
+		if got := SnowflakeTime(id); !got.Equal(at) {
+			t.Errorf("snowflake %d minted at %s, want %s", id, got, at)
+		}
+	}
+
+	// Later is bigger, whatever was minted in the millisecond before.
+	at = at.Add(time.Millisecond)
+	third := s.Next()
+	if third <= second || !SnowflakeTime(third).Equal(at) {
+		t.Errorf("snowflake %d, minted at %s after %d", third, SnowflakeTime(third), second)
+	}
+	// Should the clock go back, they still grow.
+	at = at.Add(-time.Hour)
+	if fourth := s.Next(); fourth <= third {
+		t.Errorf("minted %d after %d once the clock went back", fourth, third)
+	}
+}
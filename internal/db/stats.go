@@ -0,0 +1,63 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package db
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"sync/atomic"
+
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// stats keeps count of what we store as it's stored and removed, so the
+// instance's figures don't take a scan of everything to work out. The counts
+// aren't saved anywhere: Construct works them out again from the content it
+// starts with, so they last exactly as long as that does.
+type stats struct {
+	// Our local users and notes.
+	users    atomic.Int64
+	statuses atomic.Int64
+	// How much we store from each peer, keyed by host, as *atomic.Int64.
+	peers sync.Map
+}
+
+// count adds `delta` to the counts `con`, stored at `id`, is in. It's nil if
+// nothing was stored there.
+func (s *stats) count(id string, con *DBContent, delta int64) {
+	if con == nil {
+		return
+	}
+	if con.isLocal {
+		if actor, ok := ToActor(con.data); ok {
+			// Our instance actor, the one Application, is no one's
+			// account.
+			if actor.GetTypeName() != "Application" {
+				s.users.Add(delta)
+			}
+		} else if _, ok := con.data.(vocab.ActivityStreamsNote); ok {
+			s.statuses.Add(delta)
+		}
+		return
+	}
+	u, err := url.Parse(id)
+	if err != nil {
+		return
+	}
+	v, _ := s.peers.LoadOrStore(u.Host, new(atomic.Int64))
+	v.(*atomic.Int64).Add(delta)
+}
+
+// Stats counts our local users and notes, and the peers we store anything
+// from.
+func (db *DB) Stats(c context.Context) (users, statuses, domains int, err error) {
+	db.stats.peers.Range(func(_, v interface{}) bool {
+		if v.(*atomic.Int64).Load() > 0 {
+			domains++
+		}
+		return true
+	})
+	return int(db.stats.users.Load()), int(db.stats.statuses.Load()), domains, nil
+}
@@ -0,0 +1,132 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// newTestDB returns an empty database for mastogon.test.
+func newTestDB() *DB {
+	db := &DB{}
+	db.Construct(&sync.Map{}, "mastogon.test")
+	return db
+}
+
+// store creates or replaces `t` at `iri`, under its lock as callers do.
+func store(t *testing.T, db *DB, iri string, v interface {
+	vocab.Type
+	SetJSONLDId(vocab.JSONLDIdProperty)
+}) {
+	c := context.Background()
+	u, err := url.Parse(iri)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	id := streams.NewJSONLDIdProperty()
+	id.Set(u)
+	v.SetJSONLDId(id)
+	db.Lock(c, u)
+	defer db.Unlock(c, u)
+	if err := db.Create(c, v); err != nil {
+		t.Error(err)
+	}
+}
+
+// remove deletes what's at `iri`, under its lock.
+func remove(t *testing.T, db *DB, iri string) {
+	c := context.Background()
+	u, err := url.Parse(iri)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	db.Lock(c, u)
+	defer db.Unlock(c, u)
+	if err := db.Delete(c, u); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStatsConcurrent(t *testing.T) {
+	c := context.Background()
+	db := newTestDB()
+	const workers, notes = 20, 50
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			store(t, db, fmt.Sprintf("https://mastogon.test/users/u%d", w), streams.NewActivityStreamsPerson())
+			for n := 0; n < notes; n++ {
+				iri := fmt.Sprintf("https://mastogon.test/users/u%d/notes/%d", w, n)
+				store(t, db, iri, streams.NewActivityStreamsNote())
+				// Updates replace what they count, not add to it.
+				store(t, db, iri, streams.NewActivityStreamsNote())
+				store(t, db, fmt.Sprintf("https://peer%d.test/notes/%d", w%5, n), streams.NewActivityStreamsNote())
+				if n%2 == 0 {
+					remove(t, db, iri)
+				}
+			}
+			// Deleting what isn't there counts for nothing.
+			remove(t, db, fmt.Sprintf("https://mastogon.test/users/u%d/notes/0", w))
+		}(w)
+	}
+	wg.Wait()
+
+	users, statuses, domains, err := db.Stats(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if users != workers || statuses != workers*notes/2 || domains != 5 {
+		t.Errorf("Stats = %d users, %d statuses, %d domains; want %d, %d, %d", users, statuses, domains, workers, workers*notes/2, 5)
+	}
+}
+
+func TestStatsCountedOnConstruct(t *testing.T) {
+	c := context.Background()
+	db := newTestDB()
+	store(t, db, "https://mastogon.test/users/alice", streams.NewActivityStreamsPerson())
+	store(t, db, "https://mastogon.test/actor", streams.NewActivityStreamsApplication())
+	store(t, db, "https://mastogon.test/note/1", streams.NewActivityStreamsNote())
+	store(t, db, "https://peer.test/note/1", streams.NewActivityStreamsNote())
+	store(t, db, "https://peer.test/note/2", streams.NewActivityStreamsNote())
+	remove(t, db, "https://peer.test/note/1")
+	remove(t, db, "https://peer.test/note/2")
+
+	// As a restart over the same content would.
+	again := &DB{}
+	again.Construct(db.content, "mastogon.test")
+	users, statuses, domains, err := again.Stats(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if users != 1 || statuses != 1 || domains != 0 {
+		t.Errorf("Stats = %d users, %d statuses, %d domains; want 1, 1, 0", users, statuses, domains)
+	}
+}
+
+func TestStatsLeaveOutInstanceActor(t *testing.T) {
+	c := context.Background()
+	db := newTestDB()
+	store(t, db, "https://mastogon.test/actor", streams.NewActivityStreamsApplication())
+	store(t, db, "https://mastogon.test/users/alice", streams.NewActivityStreamsPerson())
+	// Peers' Applications are no users of ours either way.
+	store(t, db, "https://peer.test/actor", streams.NewActivityStreamsApplication())
+	if users, _, _, err := db.Stats(c); err != nil || users != 1 {
+		t.Errorf("Stats = %d users, %v; want 1", users, err)
+	}
+	remove(t, db, "https://mastogon.test/actor")
+	if users, _, _, err := db.Stats(c); err != nil || users != 1 {
+		t.Errorf("Stats = %d users after deleting the instance actor, %v; want 1", users, err)
+	}
+}
@@ -0,0 +1,71 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package db
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// LocalNotesSince returns the notes of our local actors published at or after
+// `since`.
+func (db *DB) LocalNotesSince(c context.Context, since time.Time) (notes []vocab.ActivityStreamsNote, err error) {
+	err = db.rangeContent(c, func(id string, con *DBContent) bool {
+		if !con.isLocal {
+			return true
+		}
+		note, ok := con.data.(vocab.ActivityStreamsNote)
+		if !ok {
+			return true
+		}
+		if p := note.GetActivityStreamsPublished(); p != nil && !p.Get().Before(since) {
+			notes = append(notes, note)
+		}
+		return true
+	})
+	return
+}
+
+// RemoteObjectsBefore returns the IRIs of the objects and activities from
+// peers published before `cutoff`. Actors and collections aren't included:
+// they don't say when they were published, or don't go stale the same way.
+func (db *DB) RemoteObjectsBefore(c context.Context, cutoff time.Time) (ids []*url.URL, err error) {
+	err = db.rangeContent(c, func(id string, con *DBContent) bool {
+		if con.isLocal {
+			return true
+		}
+		if _, ok := ToActor(con.data); ok {
+			return true
+		}
+		o, ok := con.data.(interface {
+			GetActivityStreamsPublished() vocab.ActivityStreamsPublishedProperty
+		})
+		if !ok || o.GetActivityStreamsPublished() == nil || !o.GetActivityStreamsPublished().Get().Before(cutoff) {
+			return true
+		}
+		if u, err := url.Parse(id); err == nil {
+			ids = append(ids, u)
+		}
+		return true
+	})
+	return
+}
+
+// RemoteObjects returns the IRIs of what we've stored from peers that
+// `match` picks out.
+func (db *DB) RemoteObjects(c context.Context, match func(vocab.Type) bool) (ids []*url.URL, err error) {
+	err = db.rangeContent(c, func(id string, con *DBContent) bool {
+		if con.isLocal || !match(con.data) {
+			return true
+		}
+		if u, err := url.Parse(id); err == nil {
+			ids = append(ids, u)
+		}
+		return true
+	})
+	return
+}
@@ -0,0 +1,38 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package db
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// ReplyIndex maps the IRI of every object something we store replies to
+// onto the IRIs of those replies.
+func (db *DB) ReplyIndex(c context.Context) (map[string][]*url.URL, error) {
+	index := make(map[string][]*url.URL)
+	err := db.rangeContent(c, func(id string, con *DBContent) bool {
+		o, ok := con.data.(interface {
+			GetActivityStreamsInReplyTo() vocab.ActivityStreamsInReplyToProperty
+		})
+		if !ok || o.GetActivityStreamsInReplyTo() == nil {
+			return true
+		}
+		replyIRI, err := pub.GetId(con.data)
+		if err != nil {
+			return true
+		}
+		prop := o.GetActivityStreamsInReplyTo()
+		for iter := prop.Begin(); iter != prop.End(); iter = iter.Next() {
+			if parentIRI, err := pub.ToId(iter); err == nil {
+				index[parentIRI.String()] = append(index[parentIRI.String()], replyIRI)
+			}
+		}
+		return true
+	})
+	return index, err
+}
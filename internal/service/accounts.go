@@ -0,0 +1,330 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"html"
+	"net/url"
+	"path"
+	"regexp"
+
+	"mastogon/internal/db"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var usernameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_]{1,30}$`)
+
+// Registration is what someone signing up supplies.
+type Registration struct {
+	Username string
+	Email    string
+	Password string
+	// Why they want to join, for instances that review sign-ups.
+	Reason string
+	Locale string
+}
+
+// RegistrationHook lets operators plug their own approval or email
+// verification flow into sign-ups.
+type RegistrationHook interface {
+	// Approve is called for every valid registration before the account is
+	// stored. Returning an error refuses the registration outright, while
+	// returning false stores the account but holds it back until
+	// ConfirmRegistration is called, say once an email link is clicked or a
+	// moderator approves.
+	Approve(c context.Context, r Registration) (confirmed bool, err error)
+}
+
+// Register creates a local account with its actor, collections and keypair,
+// returning a bearer token for it.
+func (s *Service) Register(c context.Context, r Registration) (token string, err error) {
+	if !s.config.RegistrationsOpen {
+		return "", ErrRegistrationsClosed
+	}
+	if !usernameRegexp.MatchString(r.Username) {
+		return "", &ValidationError{"Username must contain only letters, numbers and underscores"}
+	}
+	if r.Email == "" {
+		return "", &ValidationError{"Email can't be blank"}
+	}
+	if len(r.Password) < 8 {
+		return "", &ValidationError{"Password is too short (minimum is 8 characters)"}
+	}
+	if _, err := s.db.Account(r.Username); err == nil {
+		return "", fmt.Errorf("account %s: %w", r.Username, db.ErrUsernameTaken)
+	}
+
+	confirmed := true
+	if s.config.RegistrationHook != nil {
+		if confirmed, err = s.config.RegistrationHook.Approve(c, r); err != nil {
+			return "", err
+		}
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(r.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	key, publicKey, err := s.generateKey()
+	if err != nil {
+		return "", err
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token = hex.EncodeToString(b)
+
+	actorIRI := s.actorIRI(r.Username)
+	account := &db.LocalAccount{
+		Username:     r.Username,
+		ActorIRI:     actorIRI,
+		Email:        r.Email,
+		PasswordHash: hash,
+		Confirmed:    confirmed,
+		Token:        token,
+	}
+	// Claiming the username first settles any race between two sign-ups.
+	if err := s.db.CreateAccount(account); err != nil {
+		return "", err
+	}
+	person, err := s.newPerson(r.Username, publicKey)
+	if err != nil {
+		return "", err
+	}
+	if err := s.db.Create(c, person); err != nil {
+		return "", err
+	}
+	for _, box := range []string{"inbox", "outbox", "collections/featured"} {
+		if err := s.db.Create(c, newOrderedCollection(s.boxIRI(actorIRI, box))); err != nil {
+			return "", err
+		}
+	}
+	for _, box := range []string{"followers", "following", "liked"} {
+		if err := s.db.Create(c, newCollection(s.boxIRI(actorIRI, box))); err != nil {
+			return "", err
+		}
+	}
+	s.db.SetPrivateKey(actorIRI, key)
+	if confirmed {
+		s.db.SetToken(token, actorIRI)
+	}
+	return token, nil
+}
+
+// ConfirmRegistration activates an account a RegistrationHook held back.
+func (s *Service) ConfirmRegistration(c context.Context, username string) error {
+	var confirmed *db.LocalAccount
+	if err := s.db.UpdateAccount(username, func(account *db.LocalAccount) error {
+		account.Confirmed = true
+		confirmed = account
+		return nil
+	}); err != nil {
+		return err
+	}
+	s.db.SetToken(confirmed.Token, confirmed.ActorIRI)
+	return nil
+}
+
+// CredentialsParams is what a local user may change about their account.
+// Nil fields are left as they are.
+type CredentialsParams struct {
+	HideCollections *bool
+	// Whether follows wait for approval. See ManuallyApprovesFollowers.
+	Locked *bool
+	// The defaults for statuses, as in Preferences.
+	DefaultVisibility *string
+	DefaultSensitive  *bool
+	DefaultLanguage   *string
+	// What the actor goes by, and their bio, as plain text.
+	DisplayName *string
+	Note        *string
+	// Whether they may be found in directories and search, and indexed.
+	Discoverable *bool
+}
+
+// UpdateCredentials changes the settings of the local actor at `actorIRI`.
+func (s *Service) UpdateCredentials(c context.Context, actorIRI *url.URL, params CredentialsParams) error {
+	if params.DefaultVisibility != nil && !isVisibility(*params.DefaultVisibility) {
+		return &ValidationError{"Privacy is not included in the list"}
+	}
+	if err := s.db.UpdateAccount(path.Base(actorIRI.Path), func(account *db.LocalAccount) error {
+		if params.HideCollections != nil {
+			account.HideCollections = *params.HideCollections
+		}
+		if params.Locked != nil {
+			locked := *params.Locked
+			account.ManuallyApprovesFollowers = &locked
+		}
+		if params.DefaultVisibility != nil {
+			account.DefaultVisibility = *params.DefaultVisibility
+		}
+		if params.DefaultSensitive != nil {
+			account.DefaultSensitive = *params.DefaultSensitive
+		}
+		if params.DefaultLanguage != nil {
+			account.DefaultLanguage = *params.DefaultLanguage
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if params.DisplayName == nil && params.Note == nil && params.Discoverable == nil {
+		return nil
+	}
+	return s.updateActor(c, actorIRI, func(person vocab.ActivityStreamsPerson) error {
+		if params.DisplayName != nil {
+			name := streams.NewActivityStreamsNameProperty()
+			name.AppendXMLSchemaString(*params.DisplayName)
+			person.SetActivityStreamsName(name)
+		}
+		if params.Note != nil {
+			summary := streams.NewActivityStreamsSummaryProperty()
+			if *params.Note != "" {
+				summary.AppendXMLSchemaString("<p>" + html.EscapeString(*params.Note) + "</p>")
+			}
+			person.SetActivityStreamsSummary(summary)
+		}
+		if params.Discoverable != nil {
+			discoverable := streams.NewTootDiscoverableProperty()
+			discoverable.Set(*params.Discoverable)
+			person.SetTootDiscoverable(discoverable)
+		}
+		return nil
+	})
+}
+
+func (s *Service) actorIRI(username string) *url.URL {
+	return &url.URL{
+		Scheme: "https",
+		Host:   s.db.Hostname(),
+		Path:   "/users/" + username,
+	}
+}
+
+func (s *Service) boxIRI(actorIRI *url.URL, box string) *url.URL {
+	u := *actorIRI
+	u.Path += "/" + box
+	return &u
+}
+
+// generateKey makes a key pair of Config.KeyType for a new local actor.
+func (s *Service) generateKey() (crypto.PrivateKey, crypto.PublicKey, error) {
+	switch s.config.KeyType {
+	case KeyTypeEd25519:
+		public, private, err := ed25519.GenerateKey(rand.Reader)
+		return private, public, err
+	case KeyTypeRSA, "":
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, nil, err
+		}
+		return key, &key.PublicKey, nil
+	}
+	return nil, nil, fmt.Errorf("unknown key type %q", s.config.KeyType)
+}
+
+// newPerson builds the actor for a freshly registered local user.
+func (s *Service) newPerson(username string, publicKey crypto.PublicKey) (vocab.ActivityStreamsPerson, error) {
+	actorIRI := s.actorIRI(username)
+	person := streams.NewActivityStreamsPerson()
+	id := streams.NewJSONLDIdProperty()
+	id.Set(actorIRI)
+	person.SetJSONLDId(id)
+	preferredUsername := streams.NewActivityStreamsPreferredUsernameProperty()
+	preferredUsername.SetXMLSchemaString(username)
+	person.SetActivityStreamsPreferredUsername(preferredUsername)
+	published := streams.NewActivityStreamsPublishedProperty()
+	published.Set(s.Now())
+	person.SetActivityStreamsPublished(published)
+
+	inbox := streams.NewActivityStreamsInboxProperty()
+	inbox.SetIRI(s.boxIRI(actorIRI, "inbox"))
+	person.SetActivityStreamsInbox(inbox)
+	outbox := streams.NewActivityStreamsOutboxProperty()
+	outbox.SetIRI(s.boxIRI(actorIRI, "outbox"))
+	person.SetActivityStreamsOutbox(outbox)
+	followers := streams.NewActivityStreamsFollowersProperty()
+	followers.SetIRI(s.boxIRI(actorIRI, "followers"))
+	person.SetActivityStreamsFollowers(followers)
+	following := streams.NewActivityStreamsFollowingProperty()
+	following.SetIRI(s.boxIRI(actorIRI, "following"))
+	person.SetActivityStreamsFollowing(following)
+	liked := streams.NewActivityStreamsLikedProperty()
+	liked.SetIRI(s.boxIRI(actorIRI, "liked"))
+	person.SetActivityStreamsLiked(liked)
+	featured := streams.NewTootFeaturedProperty()
+	featured.SetIRI(s.boxIRI(actorIRI, "collections/featured"))
+	person.SetTootFeatured(featured)
+	// Until they say otherwise.
+	discoverable := streams.NewTootDiscoverableProperty()
+	discoverable.Set(false)
+	person.SetTootDiscoverable(discoverable)
+
+	publicKeyProp, err := publicKeyProperty(actorIRI, publicKey)
+	if err != nil {
+		return nil, err
+	}
+	person.SetW3IDSecurityV1PublicKey(publicKeyProp)
+	return person, nil
+}
+
+// publicKeyProperty presents `publicKey` as the key of the actor at
+// `actorIRI`.
+func publicKeyProperty(actorIRI *url.URL, publicKey crypto.PublicKey) (vocab.W3IDSecurityV1PublicKeyProperty, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	key := streams.NewW3IDSecurityV1PublicKey()
+	keyIRI := *actorIRI
+	keyIRI.Fragment = "main-key"
+	keyId := streams.NewJSONLDIdProperty()
+	keyId.Set(&keyIRI)
+	key.SetJSONLDId(keyId)
+	owner := streams.NewW3IDSecurityV1OwnerProperty()
+	owner.Set(actorIRI)
+	key.SetW3IDSecurityV1Owner(owner)
+	keyPem := streams.NewW3IDSecurityV1PublicKeyPemProperty()
+	keyPem.Set(string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})))
+	key.SetW3IDSecurityV1PublicKeyPem(keyPem)
+	publicKeyProp := streams.NewW3IDSecurityV1PublicKeyProperty()
+	publicKeyProp.AppendW3IDSecurityV1PublicKey(key)
+	return publicKeyProp, nil
+}
+
+func newOrderedCollection(iri *url.URL) vocab.ActivityStreamsOrderedCollection {
+	oc := streams.NewActivityStreamsOrderedCollection()
+	id := streams.NewJSONLDIdProperty()
+	id.Set(iri)
+	oc.SetJSONLDId(id)
+	oc.SetActivityStreamsOrderedItems(streams.NewActivityStreamsOrderedItemsProperty())
+	total := streams.NewActivityStreamsTotalItemsProperty()
+	total.Set(0)
+	oc.SetActivityStreamsTotalItems(total)
+	return oc
+}
+
+func newCollection(iri *url.URL) vocab.ActivityStreamsCollection {
+	col := streams.NewActivityStreamsCollection()
+	id := streams.NewJSONLDIdProperty()
+	id.Set(iri)
+	col.SetJSONLDId(id)
+	col.SetActivityStreamsItems(streams.NewActivityStreamsItemsProperty())
+	total := streams.NewActivityStreamsTotalItemsProperty()
+	total.Set(0)
+	col.SetActivityStreamsTotalItems(total)
+	return col
+}
@@ -0,0 +1,270 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+
+	"mastogon/internal/db"
+
+	"github.com/go-fed/activity/streams"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Settings are changed while requests read them. Run with -race.
+func TestUpdateCredentialsConcurrently(t *testing.T) {
+	c := context.Background()
+	s, _ := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		on := i%2 == 0
+		visibility := []string{"public", "unlisted"}[i%2]
+		go func() {
+			defer wg.Done()
+			err := s.UpdateCredentials(c, aliceIRI, CredentialsParams{
+				HideCollections:   &on,
+				Locked:            &on,
+				DefaultVisibility: &visibility,
+				DefaultSensitive:  &on,
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			s.ManuallyApprovesFollowers(aliceIRI)
+			s.CollectionsHidden(c, aliceIRI, nil)
+			if _, err := s.Preferences(c, aliceIRI); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Each update is whole: none is left half made.
+	prefs, err := s.Preferences(c, aliceIRI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	locked := s.ManuallyApprovesFollowers(aliceIRI)
+	if locked != prefs.Sensitive || locked != (prefs.Visibility == "public") {
+		t.Errorf("locked %v, sensitive %v and visibility %s from different updates", locked, prefs.Sensitive, prefs.Visibility)
+	}
+}
+
+// holdBack holds every registration back until it's confirmed.
+type holdBack struct{}
+
+func (holdBack) Approve(c context.Context, r Registration) (bool, error) {
+	return false, nil
+}
+
+func TestConfirmRegistrationConcurrently(t *testing.T) {
+	c := context.Background()
+	s, _ := newTestService(t)
+	s.config.RegistrationHook = holdBack{}
+	token, err := s.Register(c, Registration{Username: "alice", Email: "alice@" + testHostname, Password: "password"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.db.ActorForToken(token); err == nil {
+		t.Fatal("the token works before the account is confirmed")
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if err := s.ConfirmRegistration(c, "alice"); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			s.Directory(c, "new")
+		}()
+	}
+	wg.Wait()
+	if _, err := s.db.ActorForToken(token); err != nil {
+		t.Errorf("the token doesn't work once the account is confirmed: %s", err)
+	}
+	if account, err := s.db.Account("alice"); err != nil || !account.Confirmed {
+		t.Errorf("account %v, %v; want it confirmed", account, err)
+	}
+}
+
+func TestRegisterUsernameTaken(t *testing.T) {
+	s, _ := newTestService(t)
+	register(t, s, "alice")
+	_, err := s.Register(context.Background(), Registration{
+		Username: "alice",
+		Email:    "mallory@" + testHostname,
+		Password: "password",
+	})
+	if !errors.Is(err, db.ErrUsernameTaken) {
+		t.Fatalf("Register of a taken username = %v, want ErrUsernameTaken", err)
+	}
+	if status, _ := ErrorStatus(err); status != http.StatusUnprocessableEntity {
+		t.Errorf("answered with %d, want 422", status)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	c := context.Background()
+	s, _ := newTestService(t)
+	for _, test := range []struct {
+		name string
+		r    Registration
+		msg  string
+	}{
+		{"bad username", Registration{Username: "al ice", Email: "alice@" + testHostname, Password: "password"}, "Username must contain only letters, numbers and underscores"},
+		{"no email", Registration{Username: "alice", Password: "password"}, "Email can't be blank"},
+		{"short password", Registration{Username: "alice", Email: "alice@" + testHostname, Password: "secret"}, "Password is too short (minimum is 8 characters)"},
+	} {
+		var validation *ValidationError
+		if _, err := s.Register(c, test.r); !errors.As(err, &validation) || validation.msg != test.msg {
+			t.Errorf("%s: %v, want %q", test.name, err, test.msg)
+		}
+	}
+	if _, err := s.db.Account("alice"); err == nil {
+		t.Fatal("invalid registrations stored")
+	}
+
+	aliceIRI := register(t, s, "alice")
+	account, err := s.db.Account("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.ActorIRI.String() != aliceIRI.String() || !account.Confirmed {
+		t.Errorf("account %+v", account)
+	}
+	if bcrypt.CompareHashAndPassword(account.PasswordHash, []byte("password")) != nil {
+		t.Error("password not hashed as given")
+	}
+	if _, err := s.db.PrivateKey(aliceIRI); err != nil {
+		t.Errorf("no key: %s", err)
+	}
+	for _, box := range []string{"inbox", "outbox", "followers", "following", "liked", "collections/featured"} {
+		if exists, _ := s.db.Exists(c, s.boxIRI(aliceIRI, box)); !exists {
+			t.Errorf("no %s", box)
+		}
+	}
+
+	s.config.RegistrationsOpen = false
+	if _, err := s.Register(c, Registration{Username: "bob", Email: "bob@" + testHostname, Password: "password"}); !errors.Is(err, ErrRegistrationsClosed) {
+		t.Errorf("registering while closed: %v", err)
+	}
+}
+
+// approveFunc is a RegistrationHook calling itself.
+type approveFunc func(c context.Context, r Registration) (bool, error)
+
+func (f approveFunc) Approve(c context.Context, r Registration) (bool, error) {
+	return f(c, r)
+}
+
+func TestRegistrationHook(t *testing.T) {
+	c := context.Background()
+	s, _ := newTestService(t)
+	var approved []Registration
+	s.config.RegistrationHook = approveFunc(func(c context.Context, r Registration) (bool, error) {
+		approved = append(approved, r)
+		if r.Reason == "" {
+			return false, &ValidationError{"Reason can't be blank"}
+		}
+		return true, nil
+	})
+
+	if _, err := s.Register(c, Registration{Username: "mallory", Email: "mallory@" + testHostname, Password: "password"}); err == nil {
+		t.Error("registered what the hook refused")
+	}
+	if _, err := s.db.Account("mallory"); err == nil {
+		t.Error("stored an account the hook refused")
+	}
+	r := Registration{Username: "alice", Email: "alice@" + testHostname, Password: "password", Reason: "hi", Locale: "fr"}
+	token, err := s.Register(c, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.db.ActorForToken(token); err != nil {
+		t.Errorf("approved account's token: %s", err)
+	}
+	if len(approved) != 2 || approved[1] != r {
+		t.Errorf("hook saw %+v, want %+v last", approved, r)
+	}
+}
+
+func TestActorUpdatesDelivered(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	respondLocally(t, s, transport, s.boxIRI(aliceIRI, "followers"))
+	carol := newTestPeer(t, transport, "https://remote.test/users/carol", "rsa")
+	follow(t, s, aliceIRI, carol.iri)
+
+	// updated returns the Person in the last Update delivered to carol.
+	updated := func(t *testing.T, before int) map[string]interface{} {
+		t.Helper()
+		var person map[string]interface{}
+		for _, d := range transport.Delivered()[before:] {
+			var m map[string]interface{}
+			if err := json.Unmarshal(d.Body, &m); err != nil {
+				t.Fatal(err)
+			}
+			if d.To.String() != carol.iri.String()+"/inbox" || m["type"] != "Update" {
+				continue
+			}
+			if object, ok := m["object"].(map[string]interface{}); ok && object["id"] == aliceIRI.String() {
+				person = object
+			}
+		}
+		if person == nil {
+			t.Fatal("no Update of alice delivered to her follower")
+		}
+		return person
+	}
+	keyOf := func(person map[string]interface{}) interface{} {
+		if key, ok := person["publicKey"].(map[string]interface{}); ok {
+			return key["publicKeyPem"]
+		}
+		return nil
+	}
+
+	t.Run("bio", func(t *testing.T) {
+		before := len(transport.Delivered())
+		bio := "gardener"
+		if err := s.UpdateCredentials(c, aliceIRI, CredentialsParams{Note: &bio}); err != nil {
+			t.Fatal(err)
+		}
+		if got := updated(t, before)["summary"]; got != "<p>gardener</p>" {
+			t.Errorf("Update has the bio %v", got)
+		}
+	})
+	t.Run("key", func(t *testing.T) {
+		before := len(transport.Delivered())
+		person, err := s.db.Get(c, aliceIRI)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := streams.Serialize(person)
+		if err != nil {
+			t.Fatal(err)
+		}
+		old := keyOf(m)
+		if err := s.RotateKey(c, aliceIRI); err != nil {
+			t.Fatal(err)
+		}
+		if got := keyOf(updated(t, before)); got == nil || got == old {
+			t.Errorf("Update has the key %v, want a new one", got)
+		}
+	})
+}
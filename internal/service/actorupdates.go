@@ -0,0 +1,91 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"errors"
+	"net/url"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// updateActor changes the local actor at `actorIRI` as `edit` does, and lets
+// everyone who may have a copy of it know with an Update, so peers' caches of
+// our actors, and their keys, don't go stale.
+func (s *Service) updateActor(c context.Context,
+	actorIRI *url.URL,
+	edit func(person vocab.ActivityStreamsPerson) error) error {
+	if err := s.db.Lock(c, actorIRI); err != nil {
+		return err
+	}
+	t, err := s.db.Get(c, actorIRI)
+	if err != nil {
+		s.db.Unlock(c, actorIRI)
+		return err
+	}
+	person, ok := t.(vocab.ActivityStreamsPerson)
+	if !ok {
+		s.db.Unlock(c, actorIRI)
+		return errors.New("not a local actor")
+	}
+	if err = edit(person); err == nil {
+		err = s.db.Update(c, person)
+	}
+	s.db.Unlock(c, actorIRI)
+	if err != nil {
+		return err
+	}
+	return s.sendActorUpdate(c, person)
+}
+
+// sendActorUpdate sends an Update of the local actor `person` to their
+// followers, and publicly.
+func (s *Service) sendActorUpdate(c context.Context, person vocab.ActivityStreamsPerson) error {
+	actorIRI, err := pub.GetId(person)
+	if err != nil {
+		return err
+	}
+	update := streams.NewActivityStreamsUpdate()
+	actor := streams.NewActivityStreamsActorProperty()
+	actor.AppendIRI(actorIRI)
+	update.SetActivityStreamsActor(actor)
+	object := streams.NewActivityStreamsObjectProperty()
+	object.AppendActivityStreamsPerson(person)
+	update.SetActivityStreamsObject(object)
+	to := streams.NewActivityStreamsToProperty()
+	to.AppendIRI(publicIRI)
+	update.SetActivityStreamsTo(to)
+	if f := person.GetActivityStreamsFollowers(); f != nil {
+		if followersIRI, err := pub.ToId(f); err == nil {
+			cc := streams.NewActivityStreamsCcProperty()
+			cc.AppendIRI(followersIRI)
+			update.SetActivityStreamsCc(cc)
+		}
+	}
+	_, err = s.actor.Send(c, s.boxIRI(actorIRI, "outbox"), update)
+	return err
+}
+
+// RotateKey gives the local actor at `actorIRI` a new key pair of
+// Config.KeyType, say because the old one may have leaked. Peers learn of
+// the new key from the Update sent, or else when our signatures stop
+// verifying with the one they have.
+func (s *Service) RotateKey(c context.Context, actorIRI *url.URL) error {
+	key, publicKey, err := s.generateKey()
+	if err != nil {
+		return err
+	}
+	return s.updateActor(c, actorIRI, func(person vocab.ActivityStreamsPerson) error {
+		publicKeyProp, err := publicKeyProperty(actorIRI, publicKey)
+		if err != nil {
+			return err
+		}
+		person.SetW3IDSecurityV1PublicKey(publicKeyProp)
+		s.db.SetPrivateKey(actorIRI, key)
+		return nil
+	})
+}
@@ -0,0 +1,154 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"errors"
+	"net/url"
+
+	"mastogon/internal/db"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+)
+
+// IsAdmin reports whether the local actor at `actorIRI` may moderate.
+func (s *Service) IsAdmin(actorIRI *url.URL) bool {
+	for _, username := range s.config.AdminUsernames {
+		if s.actorIRI(username).String() == actorIRI.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// Suspend hides everything by the actor at `actorIRI`, local or remote, and
+// drops any further activities they send us. It can be undone with
+// Unsuspend.
+func (s *Service) Suspend(c context.Context, actorIRI *url.URL) {
+	s.db.SetSuspended(actorIRI, true)
+}
+
+// Unsuspend reinstates a suspended actor.
+func (s *Service) Unsuspend(c context.Context, actorIRI *url.URL) {
+	s.db.SetSuspended(actorIRI, false)
+}
+
+// hidden reports whether the content at `id` is, or is by, a suspended
+// actor.
+func (s *Service) hidden(c context.Context, id *url.URL) bool {
+	if s.db.IsSuspended(id) {
+		return true
+	}
+	t, err := s.db.Get(c, id)
+	if err != nil {
+		return false
+	}
+	for _, author := range authorsOf(t) {
+		if s.db.IsSuspended(author) {
+			return true
+		}
+	}
+	return false
+}
+
+// DeleteAccount tells the followers of a local account that it is gone, then
+// removes its collections and activities, leaving Tombstones in place of the
+// account and everything it posted.
+func (s *Service) DeleteAccount(c context.Context, username string) error {
+	account, err := s.db.Account(username)
+	if err != nil {
+		return err
+	}
+	actorIRI := account.ActorIRI
+	t, err := s.db.Get(c, actorIRI)
+	if err != nil {
+		return err
+	}
+	person, ok := db.ToActor(t)
+	if !ok {
+		return errors.New("not a local actor")
+	}
+	outboxIRI := s.boxIRI(actorIRI, "outbox")
+
+	del := streams.NewActivityStreamsDelete()
+	actor := streams.NewActivityStreamsActorProperty()
+	actor.AppendIRI(actorIRI)
+	del.SetActivityStreamsActor(actor)
+	object := streams.NewActivityStreamsObjectProperty()
+	object.AppendIRI(actorIRI)
+	del.SetActivityStreamsObject(object)
+	to := streams.NewActivityStreamsToProperty()
+	to.AppendIRI(publicIRI)
+	del.SetActivityStreamsTo(to)
+	if f := person.GetActivityStreamsFollowers(); f != nil {
+		if followersIRI, err := pub.ToId(f); err == nil {
+			cc := streams.NewActivityStreamsCcProperty()
+			cc.AppendIRI(followersIRI)
+			del.SetActivityStreamsCc(cc)
+		}
+	}
+	if _, err := s.actor.Send(c, outboxIRI, del); err != nil {
+		return err
+	}
+
+	// With the Delete on its way, bury what the account posted and then the
+	// account itself. Its activities and collections stay locked while we
+	// take them apart, so nothing is delivered into them halfway through.
+	activityIRIs, err := s.outboxItems(c, outboxIRI)
+	if err != nil {
+		return err
+	}
+	var boxIRIs []*url.URL
+	for _, box := range []string{"inbox", "outbox", "followers", "following", "liked", "collections/featured"} {
+		boxIRIs = append(boxIRIs, s.boxIRI(actorIRI, box))
+	}
+	locked := append(append([]*url.URL{}, activityIRIs...), boxIRIs...)
+	if err := s.db.LockAll(c, locked...); err != nil {
+		return err
+	}
+	var buried []*url.URL
+	for _, activityIRI := range activityIRIs {
+		if activity, err := s.db.Get(c, activityIRI); err == nil {
+			for _, objectIRI := range objectsOf(activity) {
+				if owns, _ := s.db.Owns(c, objectIRI); owns && objectIRI.String() != actorIRI.String() {
+					buried = append(buried, objectIRI)
+				}
+			}
+		}
+		s.db.Delete(c, activityIRI)
+	}
+	for _, boxIRI := range boxIRIs {
+		s.db.Delete(c, boxIRI)
+	}
+	s.db.UnlockAll(c, locked...)
+	for _, objectIRI := range buried {
+		s.bury(c, objectIRI)
+	}
+	s.bury(c, actorIRI)
+	s.db.SetSuspended(actorIRI, false)
+	return s.db.DeleteAccount(username)
+}
+
+// outboxItems lists the activities in the outbox at `outboxIRI`.
+func (s *Service) outboxItems(c context.Context, outboxIRI *url.URL) ([]*url.URL, error) {
+	if err := s.db.Lock(c, outboxIRI); err != nil {
+		return nil, err
+	}
+	defer s.db.Unlock(c, outboxIRI)
+	outbox, err := s.db.GetOutbox(c, outboxIRI)
+	if err != nil {
+		return nil, err
+	}
+	var activityIRIs []*url.URL
+	if items := outbox.GetActivityStreamsOrderedItems(); items != nil {
+		for iter := items.Begin(); iter != items.End(); iter = iter.Next() {
+			if activityIRI, err := pub.ToId(iter); err == nil {
+				activityIRIs = append(activityIRIs, activityIRI)
+			}
+		}
+	}
+	return activityIRIs, nil
+}
@@ -0,0 +1,137 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDeleteAccount(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	actorIRI := register(t, s, "alice")
+	respondLocally(t, s, transport, s.boxIRI(actorIRI, "followers"))
+	note, err := s.PostStatus(c, actorIRI, StatusParams{Status: "hello", Visibility: VisibilityPublic})
+	if err != nil {
+		t.Fatal(err)
+	}
+	noteIRI := note.GetJSONLDId().Get()
+
+	if err := s.DeleteAccount(c, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	for _, iri := range []string{noteIRI.String(), actorIRI.String()} {
+		got, err := s.db.Get(c, mustParse(t, iri))
+		if err != nil {
+			t.Fatalf("getting %s: %s", iri, err)
+		}
+		if got.GetTypeName() != "Tombstone" {
+			t.Errorf("%s is a %s, want a Tombstone", iri, got.GetTypeName())
+		}
+	}
+	if exists, _ := s.db.Exists(c, s.boxIRI(actorIRI, "outbox")); exists {
+		t.Error("outbox outlived its account")
+	}
+	if _, err := s.db.Account("alice"); err == nil {
+		t.Error("account outlived its deletion")
+	}
+}
+
+func TestDeleteAccountWaitsForLocks(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	actorIRI := register(t, s, "alice")
+	respondLocally(t, s, transport, s.boxIRI(actorIRI, "followers"))
+	liked := s.boxIRI(actorIRI, "liked")
+	if err := s.db.Lock(c, liked); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() { done <- s.DeleteAccount(c, "alice") }()
+	select {
+	case err := <-done:
+		t.Fatalf("DeleteAccount = %v while a collection of the account was locked", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if exists, _ := s.db.Exists(c, liked); !exists {
+		t.Error("locked collection deleted")
+	}
+	s.db.Unlock(c, liked)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := s.db.Exists(c, liked); exists {
+		t.Error("collection outlived its account")
+	}
+}
+
+func TestSuspendHidesFromTimelines(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	inboxIRI := s.boxIRI(aliceIRI, "inbox")
+	bob := newTestPeer(t, transport, "https://remote.test/users/bob", "rsa")
+	carol := newTestPeer(t, transport, "https://remote.test/users/carol", "rsa")
+	deliver(t, s, bob, inboxIRI, creating(postBy("Note", "https://remote.test/notes/1", bob.iri.String(), aliceIRI.String())))
+	deliver(t, s, carol, inboxIRI, creating(postBy("Note", "https://remote.test/notes/2", carol.iri.String(), aliceIRI.String())))
+
+	home := func() map[string]string {
+		t.Helper()
+		objects, err := s.HomeTimeline(c, aliceIRI, TimeRange{}, 20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return typesOf(objects)
+	}
+	both := map[string]string{
+		"https://remote.test/notes/1": "Note",
+		"https://remote.test/notes/2": "Note",
+	}
+	if got := home(); !reflect.DeepEqual(got, both) {
+		t.Fatalf("home timeline %v, want %v", got, both)
+	}
+
+	s.Suspend(c, bob.iri)
+	if got, want := home(), map[string]string{"https://remote.test/notes/2": "Note"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("home timeline %v while suspended, want %v", got, want)
+	}
+	s.Unsuspend(c, bob.iri)
+	if got := home(); !reflect.DeepEqual(got, both) {
+		t.Errorf("home timeline %v once unsuspended, want %v", got, both)
+	}
+}
+
+func TestDeleteAccountFederated(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	respondLocally(t, s, transport, aliceIRI, s.boxIRI(aliceIRI, "followers"))
+	bob := newTestPeer(t, transport, "https://remote.test/users/bob", "rsa")
+	follow(t, s, aliceIRI, bob.iri)
+
+	if err := s.DeleteAccount(c, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	var deletes int
+	for _, d := range transport.Delivered() {
+		if d.To.String() != bob.iri.String()+"/inbox" {
+			continue
+		}
+		var m map[string]interface{}
+		if err := json.Unmarshal(d.Body, &m); err != nil {
+			t.Fatal(err)
+		}
+		if m["type"] == "Delete" && m["actor"] == aliceIRI.String() && m["object"] == aliceIRI.String() {
+			deletes++
+		}
+	}
+	if deletes != 1 {
+		t.Errorf("%d Deletes of the actor delivered to its follower, want 1", deletes)
+	}
+}
@@ -0,0 +1,102 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// addresseesOf returns everyone `t` is addressed to, blind recipients and
+// its audience included.
+func addresseesOf(t vocab.Type) []*url.URL {
+	addressees := recipientsOf(t)
+	if o, ok := t.(interface {
+		GetActivityStreamsBto() vocab.ActivityStreamsBtoProperty
+	}); ok && o.GetActivityStreamsBto() != nil {
+		for iter := o.GetActivityStreamsBto().Begin(); iter != o.GetActivityStreamsBto().End(); iter = iter.Next() {
+			if id, err := pub.ToId(iter); err == nil {
+				addressees = append(addressees, id)
+			}
+		}
+	}
+	if o, ok := t.(interface {
+		GetActivityStreamsBcc() vocab.ActivityStreamsBccProperty
+	}); ok && o.GetActivityStreamsBcc() != nil {
+		for iter := o.GetActivityStreamsBcc().Begin(); iter != o.GetActivityStreamsBcc().End(); iter = iter.Next() {
+			if id, err := pub.ToId(iter); err == nil {
+				addressees = append(addressees, id)
+			}
+		}
+	}
+	if o, ok := t.(interface {
+		GetActivityStreamsAudience() vocab.ActivityStreamsAudienceProperty
+	}); ok && o.GetActivityStreamsAudience() != nil {
+		for iter := o.GetActivityStreamsAudience().Begin(); iter != o.GetActivityStreamsAudience().End(); iter = iter.Next() {
+			if id, err := pub.ToId(iter); err == nil {
+				addressees = append(addressees, id)
+			}
+		}
+	}
+	return addressees
+}
+
+// mayView reports whether `viewer`, or anyone at all when nil, may see `t`.
+// What's addressed to the public is for everyone, as is what's neither by
+// nor to anyone, such as actors and Tombstones. The rest is only for its
+// authors, those it's addressed to, and the members of the collections it's
+// addressed to, such as the author's followers for a followers-only status.
+// A direct status mentioning no one is its author's alone.
+func (s *Service) mayView(c context.Context, t vocab.Type, viewer *url.URL) bool {
+	addressees := addresseesOf(t)
+	authors := authorsOf(t)
+	if len(addressees) == 0 && len(authors) == 0 {
+		return true
+	}
+	for _, a := range addressees {
+		if a.String() == pub.PublicActivityPubIRI {
+			return true
+		}
+	}
+	if viewer == nil {
+		return false
+	}
+	for _, a := range append(authors, addressees...) {
+		if a.String() == viewer.String() {
+			return true
+		}
+	}
+	for _, a := range addressees {
+		if owns, err := s.db.Owns(c, a); err != nil || !owns {
+			continue
+		}
+		members, _, err := s.collectionItems(c, a)
+		if err != nil {
+			continue
+		}
+		for _, m := range members {
+			if m.String() == viewer.String() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// visibleItems returns those of `items`, the IRIs of a collection, that
+// `viewer` may see. Items we don't have, such as remote ones, are for the
+// peers holding them to show or not.
+func (s *Service) visibleItems(c context.Context, items []*url.URL, viewer *url.URL) []*url.URL {
+	var visible []*url.URL
+	for _, item := range items {
+		if t, err := s.db.Get(c, item); err == nil && !s.mayView(c, t, viewer) {
+			continue
+		}
+		visible = append(visible, item)
+	}
+	return visible
+}
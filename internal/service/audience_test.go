@@ -0,0 +1,286 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+func TestMentions(t *testing.T) {
+	for _, test := range []struct {
+		text string
+		want []string
+	}{
+		{"hello", nil},
+		{"@alice hi", []string{"alice"}},
+		{"hi @bob@remote.test and @alice!", []string{"bob@remote.test", "alice"}},
+		{"@alice @Alice @alice", []string{"alice"}},
+		{"mail alice@example.com", nil},
+		{"see https://example.com/@alice", nil},
+	} {
+		if got := Mentions(test.text); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Mentions(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+// follow makes `followerIRI` one of the followers of the local actor at
+// `actorIRI`, as an accepted Follow would.
+func follow(t testing.TB, s *Service, actorIRI, followerIRI *url.URL) {
+	t.Helper()
+	addToCollection(t, s, s.boxIRI(actorIRI, "followers"), followerIRI, func(c context.Context) (vocab.ActivityStreamsCollection, error) {
+		return s.db.Followers(c, actorIRI)
+	})
+}
+
+// following makes the local actor at `actorIRI` follow `followedIRI`, as
+// the Accept of its Follow would.
+func following(t testing.TB, s *Service, actorIRI, followedIRI *url.URL) {
+	t.Helper()
+	addToCollection(t, s, s.boxIRI(actorIRI, "following"), followedIRI, func(c context.Context) (vocab.ActivityStreamsCollection, error) {
+		return s.db.Following(c, actorIRI)
+	})
+}
+
+// addToCollection adds `iri` to the collection at `collectionIRI`, which
+// `get` gets.
+func addToCollection(t testing.TB, s *Service, collectionIRI, iri *url.URL, get func(context.Context) (vocab.ActivityStreamsCollection, error)) {
+	t.Helper()
+	c := context.Background()
+	if err := s.db.Lock(c, collectionIRI); err != nil {
+		t.Fatal(err)
+	}
+	defer s.db.Unlock(c, collectionIRI)
+	collection, err := get(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := collection.GetActivityStreamsItems()
+	if items == nil {
+		items = streams.NewActivityStreamsItemsProperty()
+		collection.SetActivityStreamsItems(items)
+	}
+	items.AppendIRI(iri)
+	if err := s.db.Update(c, collection); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// signedFetch returns a GET of `iri` signed by `p`, or an unsigned one
+// when `p` is nil.
+func signedFetch(t testing.TB, p *testPeer, iri string) *http.Request {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, iri, nil)
+	r.Header.Set("Accept", "application/activity+json")
+	r.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	if p != nil {
+		signer, err := newCavageSigner(p.key, p.keyId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := signer.sign(r, nil); err != nil {
+			t.Fatal(err)
+		}
+		r.Header.Del("Host")
+	}
+	return r
+}
+
+// addressed returns the IRIs in `prop`.
+func addressed(prop vocab.ActivityStreamsToProperty) (iris []string) {
+	for iter := prop.Begin(); iter != prop.End(); iter = iter.Next() {
+		if id, err := pub.ToId(iter); err == nil {
+			iris = append(iris, id.String())
+		}
+	}
+	return
+}
+
+func TestPostStatusDirect(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	bobIRI := register(t, s, "bob")
+	carol := newTestPeer(t, transport, "https://remote.test/users/carol", "rsa")
+	s.webFingers.Store("carol@remote.test", webFingerResult{carol.iri, s.Now().Add(time.Hour)})
+	respondLocally(t, s, transport, aliceIRI, bobIRI, s.boxIRI(aliceIRI, "followers"))
+
+	note, err := s.PostStatus(c, aliceIRI, StatusParams{
+		Status:     "@bob @carol@remote.test @nobody psst",
+		Visibility: VisibilityDirect,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{bobIRI.String(), carol.iri.String()}
+	if got := addressed(note.GetActivityStreamsTo()); !reflect.DeepEqual(got, want) {
+		t.Errorf("addressed to %q, want %q", got, want)
+	}
+	if cc := note.GetActivityStreamsCc(); cc != nil && cc.Len() > 0 {
+		t.Errorf("copied to %d more", cc.Len())
+	}
+	if Visibility(note) != VisibilityDirect || !s.isDirect(c, note) {
+		t.Error("not a direct note")
+	}
+	var hrefs []string
+	for iter := note.GetActivityStreamsTag().Begin(); iter != note.GetActivityStreamsTag().End(); iter = iter.Next() {
+		if m := iter.GetActivityStreamsMention(); m != nil {
+			hrefs = append(hrefs, m.GetActivityStreamsHref().Get().String())
+		}
+	}
+	if !reflect.DeepEqual(hrefs, want) {
+		t.Errorf("mentions %q, want %q", hrefs, want)
+	}
+
+	delivered := false
+	for _, d := range transport.Delivered() {
+		delivered = delivered || d.To.String() == carol.iri.String()+"/inbox"
+	}
+	if !delivered {
+		t.Error("not delivered to the remote actor mentioned")
+	}
+}
+
+func TestPostStatusMentionsCopied(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	bobIRI := register(t, s, "bob")
+	respondLocally(t, s, transport, aliceIRI, bobIRI, s.boxIRI(aliceIRI, "followers"))
+
+	note, err := s.PostStatus(c, aliceIRI, StatusParams{Status: "hi @bob and @alice", Visibility: VisibilityPrivate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{bobIRI.String()}
+	if got := addressed(note.GetActivityStreamsTo()); !reflect.DeepEqual(got, []string{s.boxIRI(aliceIRI, "followers").String()}) {
+		t.Errorf("addressed to %q, want only the followers", got)
+	}
+	var cc []string
+	for iter := note.GetActivityStreamsCc().Begin(); iter != note.GetActivityStreamsCc().End(); iter = iter.Next() {
+		cc = append(cc, iter.GetIRI().String())
+	}
+	if !reflect.DeepEqual(cc, want) {
+		t.Errorf("copied to %q, want %q", cc, want)
+	}
+}
+
+func TestServeObjectAudience(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	bob := newTestPeer(t, transport, "https://remote.test/users/bob", "rsa")
+	carol := newTestPeer(t, transport, "https://remote.test/users/carol", "rsa")
+	mallory := newTestPeer(t, transport, "https://evil.test/users/mallory", "rsa")
+	s.webFingers.Store("bob@remote.test", webFingerResult{bob.iri, s.Now().Add(time.Hour)})
+	follow(t, s, aliceIRI, carol.iri)
+	respondLocally(t, s, transport, aliceIRI, s.boxIRI(aliceIRI, "followers"))
+
+	post := func(text, visibility string) string {
+		note, err := s.PostStatus(c, aliceIRI, StatusParams{Status: text, Visibility: visibility})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return note.GetJSONLDId().Get().String()
+	}
+	public := post("hello", VisibilityPublic)
+	unlisted := post("hello", VisibilityUnlisted)
+	private := post("followers only", VisibilityPrivate)
+	direct := post("@bob@remote.test psst", VisibilityDirect)
+
+	for _, test := range []struct {
+		name   string
+		viewer *testPeer
+		// Which of the notes they see.
+		public, unlisted, private, direct bool
+	}{
+		{"anyone", nil, true, true, false, false},
+		{"stranger", mallory, true, true, false, false},
+		{"follower", carol, true, true, true, false},
+		{"mentioned", bob, true, true, false, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			for _, note := range []struct {
+				iri  string
+				sees bool
+			}{
+				{public, test.public},
+				{unlisted, test.unlisted},
+				{private, test.private},
+				{direct, test.direct},
+			} {
+				w := httptest.NewRecorder()
+				s.ServeHTTP(w, signedFetch(t, test.viewer, note.iri))
+				want := http.StatusNotFound
+				if note.sees {
+					want = http.StatusOK
+				}
+				if w.Code != want {
+					t.Errorf("GET %s: %d, want %d", note.iri, w.Code, want)
+				}
+			}
+		})
+	}
+
+	t.Run("author", func(t *testing.T) {
+		s.db.SetToken("alice-token", aliceIRI)
+		r := signedFetch(t, nil, direct)
+		r.Header.Set("Authorization", "Bearer alice-token")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Errorf("GET %s: %d, want %d", direct, w.Code, http.StatusOK)
+		}
+	})
+}
+
+func TestServeOutboxAudience(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	carol := newTestPeer(t, transport, "https://remote.test/users/carol", "rsa")
+	follow(t, s, aliceIRI, carol.iri)
+	respondLocally(t, s, transport, aliceIRI, s.boxIRI(aliceIRI, "followers"))
+	for _, visibility := range []string{VisibilityPublic, VisibilityPrivate, VisibilityDirect} {
+		if _, err := s.PostStatus(c, aliceIRI, StatusParams{Status: visibility, Visibility: visibility}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	outboxIRI := s.boxIRI(aliceIRI, "outbox").String()
+	for _, test := range []struct {
+		name   string
+		viewer *testPeer
+		want   int
+	}{
+		{"anyone", nil, 1},
+		{"follower", carol, 2},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, signedFetch(t, test.viewer, outboxIRI))
+			if w.Code != http.StatusOK {
+				t.Fatalf("GET %s: %d", outboxIRI, w.Code)
+			}
+			var served map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &served); err != nil {
+				t.Fatal(err)
+			}
+			if got := served["totalItems"]; got != float64(test.want) {
+				t.Errorf("served %v items, want %d", got, test.want)
+			}
+		})
+	}
+}
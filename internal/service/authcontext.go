@@ -0,0 +1,71 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Once a request is authenticated, who it's from rides along in its context
+// for whatever handles it next, such as Go-Fed's callbacks after
+// AuthenticatePostInbox: a peer that signed it, or a local user whose
+// bearer token a client used.
+
+// TokenScopes are the OAuth scopes of the bearer tokens we hand out. We
+// don't scope tokens any further yet.
+var TokenScopes = []string{"read", "write", "follow", "push"}
+
+type authKey struct{}
+
+// authenticated is who a request was authenticated as.
+type authenticated struct {
+	actor  *url.URL
+	scopes []string
+}
+
+// WithActor returns `c` for a request authenticated as the actor at
+// `actorIRI`, allowed what `scopes` say. A nil actor is for a request taken
+// without knowing who from, such as an unsigned delivery we accept anyway
+// (see verifyDelivery).
+func WithActor(c context.Context, actorIRI *url.URL, scopes []string) context.Context {
+	return context.WithValue(c, authKey{}, authenticated{actor: actorIRI, scopes: scopes})
+}
+
+// ActorFromContext returns the actor the request with context `c` was
+// authenticated as, if it was, and we know who that is.
+func ActorFromContext(c context.Context) (*url.URL, bool) {
+	a, ok := c.Value(authKey{}).(authenticated)
+	return a.actor, ok && a.actor != nil
+}
+
+// ScopesFromContext returns the OAuth scopes of the request with context
+// `c`. Only requests made with a bearer token have any.
+func ScopesFromContext(c context.Context) []string {
+	a, _ := c.Value(authKey{}).(authenticated)
+	return a.scopes
+}
+
+// isAuthenticated reports whether the request with context `c` has been
+// authenticated already, such as a delivery handed on from our shared inbox.
+func isAuthenticated(c context.Context) bool {
+	_, ok := c.Value(authKey{}).(authenticated)
+	return ok
+}
+
+// authenticateBearer returns the local actor whose bearer token `r` is
+// made with.
+func (s *Service) authenticateBearer(r *http.Request) (*url.URL, error) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" || token == r.Header.Get("Authorization") {
+		return nil, ErrUnauthorized
+	}
+	actorIRI, err := s.db.ActorForToken(token)
+	if err != nil || s.db.IsSuspended(actorIRI) {
+		return nil, ErrUnauthorized
+	}
+	return actorIRI, nil
+}
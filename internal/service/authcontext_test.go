@@ -0,0 +1,87 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestActorFromContext(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	inboxIRI := s.boxIRI(aliceIRI, "inbox")
+	bob := newTestPeer(t, transport, "https://remote.test/users/bob", "rsa")
+	mallory := newTestPeer(t, transport, "https://evil.test/users/mallory", "rsa")
+	s.db.SetToken("alice-token", aliceIRI)
+
+	if actorIRI, ok := ActorFromContext(c); ok || isAuthenticated(c) {
+		t.Errorf("a context of no request was authenticated as %v", actorIRI)
+	}
+
+	// A signed delivery is from its signer, for the callbacks after.
+	w := httptest.NewRecorder()
+	out, ok, err := s.AuthenticatePostInbox(c, w, signedDelivery(t, bob, inboxIRI, followBy(bob.iri.String(), aliceIRI.String()), false))
+	if err != nil || !ok {
+		t.Fatalf("AuthenticatePostInbox = %t, %v: %d %s", ok, err, w.Code, w.Body)
+	}
+	if actorIRI, ok := ActorFromContext(out); !ok || actorIRI.String() != bob.iri.String() {
+		t.Errorf("signed delivery from %v, %t, want bob", actorIRI, ok)
+	}
+	if scopes := ScopesFromContext(out); scopes != nil {
+		t.Errorf("signed delivery with scopes %v", scopes)
+	}
+
+	// A client's request is from the user whose token it carries.
+	r := httptest.NewRequest(http.MethodGet, inboxIRI.String(), nil)
+	r.Header.Set("Authorization", "Bearer alice-token")
+	out, ok, err = s.AuthenticateGetInbox(c, httptest.NewRecorder(), r)
+	if err != nil || !ok {
+		t.Fatalf("AuthenticateGetInbox = %t, %v", ok, err)
+	}
+	if actorIRI, ok := ActorFromContext(out); !ok || actorIRI.String() != aliceIRI.String() {
+		t.Errorf("client request from %v, %t, want alice", actorIRI, ok)
+	}
+	if scopes := ScopesFromContext(out); !reflect.DeepEqual(scopes, TokenScopes) {
+		t.Errorf("client request with scopes %v, want %v", scopes, TokenScopes)
+	}
+
+	// One taken unsigned is authenticated, but from no one we know.
+	s.config.SignedDeliveries = false
+	body, _ := json.Marshal(followBy(bob.iri.String(), aliceIRI.String()))
+	r = httptest.NewRequest(http.MethodPost, inboxIRI.String(), bytes.NewReader(body))
+	r.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+	out, ok, err = s.AuthenticatePostInbox(c, httptest.NewRecorder(), r)
+	if err != nil || !ok {
+		t.Fatalf("AuthenticatePostInbox of an unsigned delivery = %t, %v", ok, err)
+	}
+	if actorIRI, ok := ActorFromContext(out); ok || !isAuthenticated(out) {
+		t.Errorf("unsigned delivery from %v, %t", actorIRI, ok)
+	}
+	s.config.SignedDeliveries = true
+
+	// Nor is a delivery signed by someone else than its actor from either.
+	w = httptest.NewRecorder()
+	out, ok, err = s.AuthenticatePostInbox(c, w, signedDelivery(t, mallory, inboxIRI, followBy(bob.iri.String(), aliceIRI.String()), false))
+	if err != nil || ok || w.Code != http.StatusUnauthorized {
+		t.Errorf("AuthenticatePostInbox of mallory's delivery as bob = %t, %v: %d", ok, err, w.Code)
+	}
+	if actorIRI, ok := ActorFromContext(out); ok {
+		t.Errorf("mallory's delivery as bob from %v", actorIRI)
+	}
+	// Or a client's request for someone else's inbox.
+	r = httptest.NewRequest(http.MethodGet, "https://mastogon.test/users/bob/inbox", nil)
+	r.Header.Set("Authorization", "Bearer alice-token")
+	if out, ok, _ := s.AuthenticateGetInbox(c, httptest.NewRecorder(), r); ok {
+		actorIRI, _ := ActorFromContext(out)
+		t.Errorf("alice's client authenticated for bob's inbox as %v", actorIRI)
+	}
+}
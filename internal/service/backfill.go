@@ -0,0 +1,134 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"time"
+
+	"mastogon/internal/collections"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// Backfill pages through the outbox of the remote actor at `actorIRI`,
+// newest first, storing up to `limit` of their activities and the objects
+// they carry, so a freshly followed account has some history. Fetches are
+// made on behalf of the local actor at `viewerIRI`, or unsigned if it's nil,
+// Config.ImportInterval apart to go easy on the peer. Items we can't fetch,
+// being private or gone, are skipped, and a page we can't fetch ends the
+// backfill with what we have. It returns the activities stored.
+func (s *Service) Backfill(c context.Context,
+	viewerIRI *url.URL,
+	actorIRI *url.URL,
+	limit int) (stored []*url.URL, err error) {
+	t, err := s.fetch(c, viewerIRI, actorIRI)
+	if err != nil {
+		return nil, err
+	}
+	o, ok := t.(interface {
+		GetActivityStreamsOutbox() vocab.ActivityStreamsOutboxProperty
+	})
+	if !ok || o.GetActivityStreamsOutbox() == nil {
+		return nil, errors.New("actor has no outbox")
+	}
+	outboxIRI, err := pub.ToId(o.GetActivityStreamsOutbox())
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		return nil, nil
+	}
+	fetches := 0
+	fetch := func(c context.Context, iri *url.URL) (vocab.Type, error) {
+		if fetches++; fetches > 1 && !s.pause(c) {
+			return nil, c.Err()
+		}
+		return s.fetch(c, viewerIRI, iri)
+	}
+	var storeErr error
+	err = collections.Iterate(c, s.db, fetch, outboxIRI, func(activity vocab.Type) error {
+		id, err := s.storeFetched(c, activity)
+		if err != nil {
+			storeErr = err
+			return err
+		}
+		if stored = append(stored, id); len(stored) >= limit {
+			return collections.ErrStop
+		}
+		return nil
+	})
+	if storeErr != nil {
+		return stored, storeErr
+	} else if err != nil && fetches <= 1 {
+		// Not even the outbox could be had.
+		return nil, err
+	}
+	return stored, nil
+}
+
+// fetch fetches and parses the document at `iri` on behalf of the local
+// actor at `viewerIRI`, or of our instance actor if it's nil.
+func (s *Service) fetch(c context.Context, viewerIRI, iri *url.URL) (vocab.Type, error) {
+	var boxIRI *url.URL
+	if viewerIRI != nil {
+		boxIRI = s.boxIRI(viewerIRI, "outbox")
+	}
+	tp, err := s.NewTransport(c, boxIRI, "")
+	if err != nil {
+		return nil, err
+	}
+	b, err := tp.Dereference(c, iri)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	return streams.ToType(c, m)
+}
+
+// storeFetched stores `t`, and the objects it carries if it's an activity,
+// unless we have them already.
+func (s *Service) storeFetched(c context.Context, t vocab.Type) (*url.URL, error) {
+	id, err := pub.GetId(t)
+	if err != nil {
+		return nil, err
+	}
+	if a, ok := t.(interface {
+		GetActivityStreamsObject() vocab.ActivityStreamsObjectProperty
+	}); ok && a.GetActivityStreamsObject() != nil {
+		for iter := a.GetActivityStreamsObject().Begin(); iter != a.GetActivityStreamsObject().End(); iter = iter.Next() {
+			if o := iter.GetType(); o != nil {
+				if _, err := s.storeFetched(c, o); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	if err := s.db.Lock(c, id); err != nil {
+		return nil, err
+	}
+	defer s.db.Unlock(c, id)
+	if exists, err := s.db.Exists(c, id); err != nil || exists {
+		return id, err
+	}
+	return id, s.db.Create(c, t)
+}
+
+// pause waits Config.ImportInterval, and reports whether `c` is still live.
+func (s *Service) pause(c context.Context) bool {
+	select {
+	case <-time.After(s.config.ImportInterval):
+		return true
+	case <-c.Done():
+		return false
+	}
+}
@@ -0,0 +1,116 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"net/url"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// serveOutbox has `transport` serve the outbox of `p` in pages of
+// `pages`, each a list of the Creates on it. The first page's are inline,
+// the rest only linked.
+func serveOutbox(t *testing.T, transport *FakeTransport, p *testPeer, pages ...[]map[string]interface{}) {
+	t.Helper()
+	const activityStreams = "https://www.w3.org/ns/activitystreams"
+	outbox := p.iri.String() + "/outbox"
+	respondJSON(t, transport, outbox, map[string]interface{}{
+		"@context": activityStreams,
+		"id":       outbox,
+		"type":     "OrderedCollection",
+		"first":    outbox + "?page=1",
+	})
+	for i, creates := range pages {
+		pageIRI := outbox + "?page=" + strconv.Itoa(i+1)
+		var items []interface{}
+		for _, create := range creates {
+			if i == 0 {
+				items = append(items, create)
+				continue
+			}
+			items = append(items, create["id"])
+			respondJSON(t, transport, create["id"].(string), create)
+		}
+		page := map[string]interface{}{
+			"@context":     activityStreams,
+			"id":           pageIRI,
+			"type":         "OrderedCollectionPage",
+			"partOf":       outbox,
+			"orderedItems": items,
+		}
+		if i < len(pages)-1 {
+			page["next"] = outbox + "?page=" + strconv.Itoa(i+2)
+		}
+		respondJSON(t, transport, pageIRI, page)
+	}
+}
+
+// stringsOf returns `iris` as strings.
+func stringsOf(iris []*url.URL) []string {
+	s := make([]string, len(iris))
+	for i, iri := range iris {
+		s[i] = iri.String()
+	}
+	return s
+}
+
+func TestBackfill(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	s.config.ImportInterval = 0
+	bob := newTestPeer(t, transport, "https://remote.test/users/bob", "rsa")
+	var creates []map[string]interface{}
+	var want []string
+	for _, id := range []string{"3", "2", "1"} {
+		create := creating(postBy("Note", "https://remote.test/notes/"+id, bob.iri.String(), bob.iri.String()+"/followers"))
+		creates = append(creates, create)
+		want = append(want, create["id"].(string))
+	}
+	serveOutbox(t, transport, bob, creates[:2], creates[2:])
+
+	stored, err := s.Backfill(c, nil, bob.iri, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := stringsOf(stored); !reflect.DeepEqual(got, want[:2]) {
+		t.Errorf("stored %v with a limit of 2, want %v", got, want[:2])
+	}
+	// The notes come with their Creates.
+	if got := contentOf(t, s, "https://remote.test/notes/3"); got != "<p>hello</p>" {
+		t.Errorf("stored note 3 with %q", got)
+	}
+
+	// The second page's items are fetched one by one.
+	if stored, err = s.Backfill(c, nil, bob.iri, 20); err != nil {
+		t.Fatal(err)
+	}
+	if got := stringsOf(stored); !reflect.DeepEqual(got, want) {
+		t.Errorf("stored %v, want %v", got, want)
+	}
+}
+
+func TestBackfillStopsAtMissingPage(t *testing.T) {
+	s, transport := newTestService(t)
+	s.config.ImportInterval = 0
+	bob := newTestPeer(t, transport, "https://remote.test/users/bob", "rsa")
+	create := creating(postBy("Note", "https://remote.test/notes/1", bob.iri.String(), bob.iri.String()+"/followers"))
+	serveOutbox(t, transport, bob, []map[string]interface{}{create}, nil)
+	// The second page is private.
+	transport.Respond(mustParse(t, bob.iri.String()+"/outbox?page=2"), []byte(`{}`))
+
+	stored, err := s.Backfill(context.Background(), nil, bob.iri, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := stringsOf(stored); !reflect.DeepEqual(got, []string{create["id"].(string)}) {
+		t.Errorf("stored %v, want only the first page's", got)
+	}
+
+	if _, err := s.Backfill(context.Background(), nil, mustParse(t, "https://remote.test/users/nobody"), 20); err == nil {
+		t.Error("backfilled an actor we couldn't fetch")
+	}
+}
@@ -0,0 +1,184 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"mastogon/internal/db"
+)
+
+// The header Mastodon puts on domain block exports.
+var domainBlockHeader = []string{"#domain", "#severity", "#reject_media", "#reject_reports", "#public_comment", "#obfuscate"}
+
+// The outcomes of importing a single domain block.
+const (
+	DomainBlockAdded     = "added"
+	DomainBlockUnchanged = "unchanged"
+	// A different block on the same domain already exists and was kept.
+	DomainBlockConflict = "conflict"
+)
+
+// DomainBlockResult reports what became of one row of a domain block import.
+type DomainBlockResult struct {
+	Domain string `json:"domain"`
+	Result string `json:"result"`
+}
+
+func normalizeDomain(domain string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+}
+
+// DomainBlockFor returns the most specific domain block covering `host`.
+// A block on `example.com` covers it and all its subdomains, while one on
+// `*.example.com` covers only the subdomains.
+func (s *Service) DomainBlockFor(host string) (db.DomainBlock, bool) {
+	host = normalizeDomain(host)
+	if h, _, ok := strings.Cut(host, ":"); ok {
+		host = h
+	}
+	for d := host; d != ""; {
+		if b, ok := s.db.DomainBlock(d); ok {
+			return b, true
+		}
+		if d != host {
+			if b, ok := s.db.DomainBlock("*." + d); ok {
+				return b, true
+			}
+		}
+		_, parent, ok := strings.Cut(d, ".")
+		if !ok {
+			break
+		}
+		d = parent
+	}
+	return db.DomainBlock{}, false
+}
+
+// ParseDomainBlockCSV reads a Mastodon domain block export. Exports without
+// the header, including plain lists of domains, are accepted too.
+func ParseDomainBlockCSV(r io.Reader) ([]db.DomainBlock, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	var blocks []db.DomainBlock
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if len(record) == 0 || strings.HasPrefix(record[0], "#") {
+			continue
+		}
+		b := db.DomainBlock{Domain: normalizeDomain(record[0]), Severity: "suspend"}
+		if b.Domain == "" {
+			continue
+		}
+		field := func(i int) string {
+			if i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		switch field(1) {
+		case "noop", "silence", "suspend":
+			b.Severity = field(1)
+		}
+		b.RejectMedia, _ = strconv.ParseBool(field(2))
+		b.RejectReports, _ = strconv.ParseBool(field(3))
+		b.PublicComment = field(4)
+		b.Obfuscate, _ = strconv.ParseBool(field(5))
+		blocks = append(blocks, b)
+	}
+	return blocks, nil
+}
+
+// ImportDomainBlocks merges a Mastodon domain block export into our own
+// blocks. Existing blocks always win: a row that disagrees with one is
+// reported as a conflict rather than applied.
+func (s *Service) ImportDomainBlocks(c context.Context, r io.Reader) ([]DomainBlockResult, error) {
+	blocks, err := ParseDomainBlockCSV(r)
+	if err != nil {
+		return nil, &ValidationError{"File is not a valid CSV"}
+	}
+	if len(blocks) == 0 {
+		return nil, &ValidationError{"File contains no domains"}
+	}
+	results := make([]DomainBlockResult, 0, len(blocks))
+	for _, b := range blocks {
+		result := DomainBlockResult{Domain: b.Domain, Result: DomainBlockAdded}
+		if existing, ok := s.db.DomainBlock(b.Domain); !ok {
+			s.db.SetDomainBlock(b)
+		} else if existing == b {
+			result.Result = DomainBlockUnchanged
+		} else {
+			result.Result = DomainBlockConflict
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// ExportDomainBlocks writes our domain blocks in Mastodon's export format.
+func (s *Service) ExportDomainBlocks(c context.Context, w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write(domainBlockHeader)
+	for _, b := range s.db.DomainBlocks() {
+		cw.Write([]string{
+			b.Domain,
+			b.Severity,
+			strconv.FormatBool(b.RejectMedia),
+			strconv.FormatBool(b.RejectReports),
+			b.PublicComment,
+			strconv.FormatBool(b.Obfuscate),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ImportBlocks blocks every account listed in a Mastodon blocked accounts
+// export on behalf of the local actor at `actorIRI`.
+func (s *Service) ImportBlocks(c context.Context, actorIRI *url.URL, r io.Reader) ([]ImportResult, error) {
+	return s.importAccts(c, r, func(targetIRI *url.URL) (string, error) {
+		if s.db.IsBlocking(actorIRI, targetIRI) {
+			return ImportAlreadyBlocking, nil
+		}
+		s.db.SetBlocking(actorIRI, targetIRI, true)
+		return ImportBlocked, nil
+	})
+}
+
+// ExportBlocks writes the accounts the local actor at `actorIRI` blocks in
+// Mastodon's export format: one `user@domain` per line.
+func (s *Service) ExportBlocks(c context.Context, actorIRI *url.URL, w io.Writer) error {
+	cw := csv.NewWriter(w)
+	for _, blocked := range s.db.Blocking(actorIRI) {
+		cw.Write([]string{s.acctFor(c, blocked)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// acctFor returns the `user@domain` handle of the actor at `actorIRI`,
+// guessing the username from the IRI if we don't have the actor stored.
+func (s *Service) acctFor(c context.Context, actorIRI *url.URL) string {
+	username := path.Base(actorIRI.Path)
+	if t, err := s.db.Get(c, actorIRI); err == nil {
+		if actor, ok := db.ToActor(t); ok {
+			if u := actor.GetActivityStreamsPreferredUsername(); u != nil && u.IsXMLSchemaString() {
+				username = u.GetXMLSchemaString()
+			}
+		}
+	}
+	return username + "@" + actorIRI.Host
+}
@@ -0,0 +1,115 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"mastogon/internal/db"
+)
+
+func TestDomainBlockFor(t *testing.T) {
+	s, _ := newTestService(t)
+	s.db.SetDomainBlock(db.DomainBlock{Domain: "spam.test", Severity: "suspend"})
+	s.db.SetDomainBlock(db.DomainBlock{Domain: "*.noisy.test", Severity: "silence"})
+	s.db.SetDomainBlock(db.DomainBlock{Domain: "ok.spam.test", Severity: "noop"})
+	for host, want := range map[string]string{
+		"spam.test":          "spam.test",
+		"SPAM.test.":         "spam.test",
+		"a.b.spam.test":      "spam.test",
+		"spam.test:8443":     "spam.test",
+		"ok.spam.test":       "ok.spam.test",
+		"x.ok.spam.test":     "ok.spam.test",
+		"noisy.test":         "",
+		"loud.noisy.test":    "*.noisy.test",
+		"notspam.test":       "",
+		"remote.test":        "",
+		"spam.test.evil.com": "",
+	} {
+		b, ok := s.DomainBlockFor(host)
+		if ok != (want != "") || b.Domain != want {
+			t.Errorf("block for %s: %q, want %q", host, b.Domain, want)
+		}
+	}
+}
+
+func TestDomainBlocksRoundTrip(t *testing.T) {
+	c := context.Background()
+	s, _ := newTestService(t)
+	blocks := []db.DomainBlock{
+		{Domain: "*.noisy.test", Severity: "silence", RejectMedia: true},
+		{Domain: "spam.test", Severity: "suspend", RejectReports: true, PublicComment: "spam, mostly", Obfuscate: true},
+	}
+	for _, b := range blocks {
+		s.db.SetDomainBlock(b)
+	}
+	var export bytes.Buffer
+	if err := s.ExportDomainBlocks(c, &export); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(export.String(), "#domain,#severity,") {
+		t.Errorf("export %q has no header", export.String())
+	}
+
+	imported, _ := newTestService(t)
+	imported.db.SetDomainBlock(db.DomainBlock{Domain: "spam.test", Severity: "silence"})
+	results, err := imported.ImportDomainBlocks(c, &export)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []DomainBlockResult{{"*.noisy.test", DomainBlockAdded}, {"spam.test", DomainBlockConflict}}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("results %v, want %v", results, want)
+	}
+	if got := imported.db.DomainBlocks(); !reflect.DeepEqual(got, []db.DomainBlock{blocks[0], {Domain: "spam.test", Severity: "silence"}}) {
+		t.Errorf("blocks %+v after import", got)
+	}
+
+	// Plain lists of domains are suspensions.
+	parsed, err := ParseDomainBlockCSV(strings.NewReader("Spam.test.\nnoisy.test,silence\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []db.DomainBlock{{Domain: "spam.test", Severity: "suspend"}, {Domain: "noisy.test", Severity: "silence"}}; !reflect.DeepEqual(parsed, want) {
+		t.Errorf("parsed %+v, want %+v", parsed, want)
+	}
+}
+
+func TestBlocksRoundTrip(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	s.config.ImportInterval = 0
+	aliceIRI := register(t, s, "alice")
+	bobIRI := register(t, s, "bob")
+	carol := newTestPeer(t, transport, "https://remote.test/users/carol", "rsa")
+	s.webFingers.Store("carol@remote.test", webFingerResult{carol.iri, s.Now().Add(time.Hour)})
+	s.db.SetBlocking(aliceIRI, bobIRI, true)
+
+	results, err := s.ImportBlocks(c, aliceIRI, strings.NewReader("carol@remote.test\nbob@"+testHostname+"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ImportResult{
+		{Acct: "carol@remote.test", Result: ImportBlocked},
+		{Acct: "bob@" + testHostname, Result: ImportAlreadyBlocking},
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("results %+v, want %+v", results, want)
+	}
+
+	var export bytes.Buffer
+	if err := s.ExportBlocks(c, aliceIRI, &export); err != nil {
+		t.Fatal(err)
+	}
+	// Sorted by IRI, with carol's username guessed from their IRI as we
+	// haven't stored their actor.
+	if want := "bob@" + testHostname + "\ncarol@remote.test\n"; export.String() != want {
+		t.Errorf("export %q, want %q", export.String(), want)
+	}
+}
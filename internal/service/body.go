@@ -0,0 +1,67 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// bufferBody reads the body of the delivery `r` to one of our inboxes into
+// memory, for checking its digest and signature and then handing it to
+// Go-Fed, refusing it if it's over Config.MaxInboxBodySize. It reports
+// whether `r` can go on; if not, the peer has been answered.
+func (s *Service) bufferBody(w http.ResponseWriter, r *http.Request) bool {
+	if r.ContentLength > s.config.MaxInboxBodySize {
+		WriteError(w, ErrBodyTooLarge)
+		return false
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, s.config.MaxInboxBodySize+1))
+	r.Body.Close()
+	if err != nil {
+		WriteError(w, &ParseError{err})
+		return false
+	}
+	if int64(len(body)) > s.config.MaxInboxBodySize {
+		WriteError(w, ErrBodyTooLarge)
+		return false
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	// Anything reading the body again, such as Go-Fed, gets it afresh.
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	return true
+}
+
+// checkDigest checks the Digest header of a cavage-signed request, such as
+// "SHA-256=<base64>", matches its `body`.
+func checkDigest(header string, body []byte) error {
+	for _, member := range strings.Split(header, ",") {
+		algo, value, _ := strings.Cut(strings.TrimSpace(member), "=")
+		var sum []byte
+		switch strings.ToUpper(algo) {
+		case "SHA-256":
+			s := sha256.Sum256(body)
+			sum = s[:]
+		case "SHA-512":
+			s := sha512.Sum512(body)
+			sum = s[:]
+		default:
+			continue
+		}
+		if value != base64.StdEncoding.EncodeToString(sum) {
+			return errors.New("Digest doesn't match the body")
+		}
+		return nil
+	}
+	return errors.New("no usable Digest")
+}
@@ -0,0 +1,62 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBufferBody(t *testing.T) {
+	s, _ := newTestService(t)
+	s.config.MaxInboxBodySize = 64
+	_, tooLarge := ErrorStatus(ErrBodyTooLarge)
+	for _, test := range []struct {
+		name string
+		size int64
+		// Whether the peer says how long the body is, rather than sending
+		// it chunked.
+		sized bool
+		ok    bool
+	}{
+		{"at the limit", 64, true, true},
+		{"at the limit, chunked", 64, false, true},
+		{"a byte over", 65, true, false},
+		{"a byte over, chunked", 65, false, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			body := bytes.Repeat([]byte("a"), int(test.size))
+			r := httptest.NewRequest(http.MethodPost, "https://mastogon.test/inbox", bytes.NewReader(body))
+			if !test.sized {
+				r.ContentLength = -1
+			}
+			w := httptest.NewRecorder()
+			if ok := s.bufferBody(w, r); ok != test.ok {
+				t.Fatalf("took a body of %d bytes: %t, want %t", test.size, ok, test.ok)
+			}
+			if !test.ok {
+				if w.Code != http.StatusRequestEntityTooLarge || !bytes.Contains(w.Body.Bytes(), []byte(tooLarge)) {
+					t.Errorf("refused with %d %s, want %d", w.Code, w.Body, http.StatusRequestEntityTooLarge)
+				}
+				return
+			}
+			// The body can be read, and read again.
+			for i := 0; i < 2; i++ {
+				rc, err := r.GetBody()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got, _ := io.ReadAll(rc); !bytes.Equal(got, body) {
+					t.Errorf("read %d bytes back, want %d", len(got), len(body))
+				}
+			}
+			if got, _ := io.ReadAll(r.Body); !bytes.Equal(got, body) || r.ContentLength != test.size {
+				t.Errorf("body of %d bytes and length %d, want %d", len(got), r.ContentLength, test.size)
+			}
+		})
+	}
+}
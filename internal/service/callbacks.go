@@ -0,0 +1,328 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	"mastogon/internal/db"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// targetsOf returns the IRIs in the `target` of an activity.
+func targetsOf(t vocab.Type) (targets []*url.URL) {
+	if a, ok := t.(interface {
+		GetActivityStreamsTarget() vocab.ActivityStreamsTargetProperty
+	}); ok && a.GetActivityStreamsTarget() != nil {
+		prop := a.GetActivityStreamsTarget()
+		for iter := prop.Begin(); iter != prop.End(); iter = iter.Next() {
+			if id, err := pub.ToId(iter); err == nil {
+				targets = append(targets, id)
+			}
+		}
+	}
+	return
+}
+
+// controls reports whether one of `actorIRIs` may edit the collection at
+// `collectionIRI`: either it lives under the actor, as their featured
+// collection does, or it's attributed to them.
+func (s *Service) controls(c context.Context, actorIRIs []*url.URL, collectionIRI *url.URL) bool {
+	for _, actorIRI := range actorIRIs {
+		if strings.EqualFold(actorIRI.Host, collectionIRI.Host) &&
+			strings.HasPrefix(collectionIRI.Path, actorIRI.Path+"/") {
+			return true
+		}
+	}
+	t, err := s.db.Get(c, collectionIRI)
+	if err != nil {
+		return false
+	}
+	for _, owner := range authorsOf(t) {
+		for _, actorIRI := range actorIRIs {
+			if owner.String() == actorIRI.String() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// add handles an Add delivered to us, in place of Go-Fed's default which
+// would let anyone add to any collection of ours. Only the objects' IRIs are
+// added, and only to collections we have a copy of and the actor controls.
+func (s *Service) add(c context.Context, a vocab.ActivityStreamsAdd) error {
+	s.received(a)
+	return s.editCollections(c, a, func(items []*url.URL, objects []*url.URL) []*url.URL {
+		have := make(map[string]bool, len(items))
+		for _, item := range items {
+			have[item.String()] = true
+		}
+		// Newest first, as everywhere else.
+		var added []*url.URL
+		for _, o := range objects {
+			if !have[o.String()] {
+				have[o.String()] = true
+				added = append(added, o)
+			}
+		}
+		return append(added, items...)
+	})
+}
+
+// remove handles a Remove delivered to us, with the same restrictions as
+// add.
+func (s *Service) remove(c context.Context, r vocab.ActivityStreamsRemove) error {
+	s.received(r)
+	return s.editCollections(c, r, func(items []*url.URL, objects []*url.URL) []*url.URL {
+		gone := make(map[string]bool, len(objects))
+		for _, o := range objects {
+			gone[o.String()] = true
+		}
+		kept := items[:0]
+		for _, item := range items {
+			if !gone[item.String()] {
+				kept = append(kept, item)
+			}
+		}
+		return kept
+	})
+}
+
+// undo handles an Undo delivered to us, in place of Go-Fed's default, which
+// checks what's undone is the actor's by fetching it, and so fails on the
+// Follows and Likes Mastodon doesn't serve. We check our own copy instead,
+// or else the one embedded in the Undo, signed along with it, and only
+// fetch what we have neither of.
+func (s *Service) undo(c context.Context, u vocab.ActivityStreamsUndo) error {
+	op := u.GetActivityStreamsObject()
+	if op == nil || op.Len() == 0 {
+		return pub.ErrObjectRequired
+	}
+	actorIRIs := authorsOf(u)
+	for iter := op.Begin(); iter != op.End(); iter = iter.Next() {
+		id, err := pub.ToId(iter)
+		if err != nil {
+			return err
+		}
+		o, err := s.db.Get(c, id)
+		if err != nil {
+			if o = iter.GetType(); o == nil {
+				if o, err = s.fetch(c, nil, id); err != nil {
+					return err
+				}
+			}
+		}
+		for _, author := range authorsOf(o) {
+			if !containsIRI(actorIRIs, author) {
+				return fmt.Errorf("undoing %s: %w", id, db.ErrNotOwned)
+			}
+		}
+	}
+	return s.undone(c, u)
+}
+
+// delete handles a Delete delivered to us, in place of Go-Fed's default,
+// which lets anyone on a peer delete whatever else is on it. Only the authors
+// of what we have may delete it, and only an actor itself; an actor deleting
+// itself takes its follows here, and what we have of it, along.
+func (s *Service) delete(c context.Context, d vocab.ActivityStreamsDelete) error {
+	op := d.GetActivityStreamsObject()
+	if op == nil || op.Len() == 0 {
+		return pub.ErrObjectRequired
+	}
+	actorIRIs := authorsOf(d)
+	var deleted, gone []*url.URL
+	for iter := op.Begin(); iter != op.End(); iter = iter.Next() {
+		id, err := pub.ToId(iter)
+		if err != nil {
+			return err
+		}
+		if owns, err := s.db.Owns(c, id); err != nil {
+			return err
+		} else if owns {
+			return fmt.Errorf("deleting %s: %w", id, db.ErrNotOwned)
+		}
+		if containsIRI(actorIRIs, id) {
+			deleted, gone = append(deleted, id), append(gone, id)
+			continue
+		}
+		t, err := s.db.Get(c, id)
+		if errors.Is(err, db.ErrNotFound) {
+			// Nothing to delete.
+			continue
+		} else if err != nil {
+			return err
+		}
+		authors := authorsOf(t)
+		if len(authors) == 0 {
+			return fmt.Errorf("deleting %s: %w", id, db.ErrNotOwned)
+		}
+		for _, author := range authors {
+			if !containsIRI(actorIRIs, author) {
+				return fmt.Errorf("deleting %s: %w", id, db.ErrNotOwned)
+			}
+		}
+		deleted = append(deleted, id)
+	}
+	for _, id := range deleted {
+		if err := s.db.Lock(c, id); err != nil {
+			return err
+		}
+		err := s.db.Delete(c, id)
+		s.db.Unlock(c, id)
+		if err != nil {
+			return err
+		}
+	}
+	for _, actorIRI := range gone {
+		if err := s.forgetActor(c, actorIRI); err != nil {
+			return err
+		}
+	}
+	s.received(d)
+	return nil
+}
+
+// forgetActor drops the remote actor at `actorIRI`, now deleted, from our
+// users' followers and following, along with its follow requests and
+// everything of it we have stored.
+func (s *Service) forgetActor(c context.Context, actorIRI *url.URL) error {
+	without := func(items []*url.URL) []*url.URL {
+		kept := items[:0]
+		for _, item := range items {
+			if item.String() != actorIRI.String() {
+				kept = append(kept, item)
+			}
+		}
+		return kept
+	}
+	for _, account := range s.db.Accounts() {
+		for _, box := range []string{"followers", "following"} {
+			if err := s.editCollection(c, s.boxIRI(account.ActorIRI, box), without); err != nil {
+				return err
+			}
+		}
+		s.db.TakeFollowRequest(actorIRI, account.ActorIRI)
+	}
+	ids, err := s.db.RemoteObjects(c, func(t vocab.Type) bool {
+		return containsIRI(authorsOf(t), actorIRI)
+	})
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := s.db.Lock(c, id); err != nil {
+			return err
+		}
+		err := s.db.Delete(c, id)
+		s.db.Unlock(c, id)
+		if err != nil {
+			return err
+		}
+	}
+	s.forgetWebFingers(actorIRI)
+	return nil
+}
+
+// editCollections replaces the items of each target of `activity` with what
+// `edit` makes of them and the activity's objects.
+func (s *Service) editCollections(c context.Context,
+	activity vocab.Type,
+	edit func(items []*url.URL, objects []*url.URL) []*url.URL) error {
+	actorIRIs := authorsOf(activity)
+	objects := objectsOf(activity)
+	for _, target := range targetsOf(activity) {
+		if !s.controls(c, actorIRIs, target) {
+			log.Printf("ignoring %s on %s: not the actor's collection", activity.GetTypeName(), target)
+			continue
+		}
+		if err := s.editCollection(c, target, func(items []*url.URL) []*url.URL {
+			return edit(items, objects)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// editCollection replaces the items of the collection stored at `id` with
+// what `edit` makes of them. Collections we don't have are left alone.
+func (s *Service) editCollection(c context.Context, id *url.URL, edit func(items []*url.URL) []*url.URL) error {
+	if err := s.db.Lock(c, id); err != nil {
+		return err
+	}
+	defer s.db.Unlock(c, id)
+	items, ordered, err := s.collectionItems(c, id)
+	if err != nil {
+		return nil
+	}
+	items = edit(items)
+	t, err := s.db.Get(c, id)
+	if err != nil {
+		return err
+	}
+	total := streams.NewActivityStreamsTotalItemsProperty()
+	total.Set(len(items))
+	if ordered {
+		oc := t.(vocab.ActivityStreamsOrderedCollection)
+		prop := streams.NewActivityStreamsOrderedItemsProperty()
+		for _, item := range items {
+			prop.AppendIRI(item)
+		}
+		oc.SetActivityStreamsOrderedItems(prop)
+		oc.SetActivityStreamsTotalItems(total)
+	} else {
+		col := t.(vocab.ActivityStreamsCollection)
+		prop := streams.NewActivityStreamsItemsProperty()
+		for _, item := range items {
+			prop.AppendIRI(item)
+		}
+		col.SetActivityStreamsItems(prop)
+		col.SetActivityStreamsTotalItems(total)
+	}
+	return s.db.Update(c, t)
+}
+
+// moved handles a Move delivered to us, of an account to a new one. Only the
+// account itself may say it moved, and only to an account listing it among
+// its aliases; we then note where it went, so its followers here are
+// prompted to follow it there. Go-Fed has no default for it.
+func (s *Service) moved(c context.Context, m vocab.ActivityStreamsMove) error {
+	s.received(m)
+	actorIRIs := authorsOf(m)
+	var targetIRI *url.URL
+	if target := m.GetActivityStreamsTarget(); target != nil && target.Len() == 1 {
+		targetIRI, _ = pub.ToId(target.At(0))
+	}
+	for _, o := range objectsOf(m) {
+		if !containsIRI(actorIRIs, o) {
+			log.Printf("ignoring Move of %s: not by the account", o)
+			continue
+		}
+		// Its handle may well point somewhere else now.
+		s.forgetWebFingers(o)
+		if targetIRI == nil {
+			log.Printf("ignoring Move of %s: no target", o)
+			continue
+		}
+		if moves, err := s.movesTo(c, nil, o, targetIRI); err != nil || !moves {
+			log.Printf("ignoring Move of %s to %s: not an alias of it", o, targetIRI)
+			continue
+		}
+		if err := s.noteMoved(c, o, targetIRI); err != nil {
+			return err
+		}
+		s.emit(Event{Kind: EventAccountMoved, Activity: m, Actor: o})
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+)
+
+// editing returns an activity of `activityType`, such as an Add, by
+// `actorIRI` of `objectIRI` to or from `targetIRI`.
+func editing(activityType, actorIRI, objectIRI, targetIRI string) map[string]interface{} {
+	return map[string]interface{}{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id":       actorIRI + "#" + activityType + "-" + objectIRI,
+		"type":     activityType,
+		"actor":    actorIRI,
+		"to":       pub.PublicActivityPubIRI,
+		"object":   objectIRI,
+		"target":   targetIRI,
+	}
+}
+
+func TestAddRemove(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	inboxIRI := s.boxIRI(aliceIRI, "inbox")
+	bob := newTestPeer(t, transport, "https://remote.test/users/bob", "rsa")
+	mallory := newTestPeer(t, transport, "https://remote.test/users/mallory", "rsa")
+	featured := mustParse(t, bob.iri.String()+"/collections/featured")
+	if err := s.db.Lock(c, featured); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.db.Create(c, newOrderedCollection(featured)); err != nil {
+		t.Fatal(err)
+	}
+	s.db.Unlock(c, featured)
+	items := func(iri string) []string {
+		t.Helper()
+		items, _, err := s.collectionItems(c, mustParse(t, iri))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var iris []string
+		for _, item := range items {
+			iris = append(iris, item.String())
+		}
+		return iris
+	}
+
+	deliver(t, s, bob, inboxIRI, editing("Add", bob.iri.String(), "https://remote.test/notes/1", featured.String()))
+	deliver(t, s, bob, inboxIRI, editing("Add", bob.iri.String(), "https://remote.test/notes/2", featured.String()))
+	// Adding again changes nothing.
+	deliver(t, s, bob, inboxIRI, editing("Add", bob.iri.String(), "https://remote.test/notes/1", featured.String()))
+	// Only bob may edit bob's collection, and no peer ours.
+	deliver(t, s, mallory, inboxIRI, editing("Add", mallory.iri.String(), "https://remote.test/notes/3", featured.String()))
+	deliver(t, s, bob, inboxIRI, editing("Add", bob.iri.String(), "https://remote.test/notes/3", s.boxIRI(aliceIRI, "collections/featured").String()))
+	want := []string{"https://remote.test/notes/2", "https://remote.test/notes/1"}
+	if got := items(featured.String()); !reflect.DeepEqual(got, want) {
+		t.Errorf("featured %q, want %q", got, want)
+	}
+	if got := items(s.boxIRI(aliceIRI, "collections/featured").String()); len(got) != 0 {
+		t.Errorf("a peer added %q to ours", got)
+	}
+
+	deliver(t, s, mallory, inboxIRI, editing("Remove", mallory.iri.String(), "https://remote.test/notes/2", featured.String()))
+	deliver(t, s, bob, inboxIRI, editing("Remove", bob.iri.String(), "https://remote.test/notes/1", featured.String()))
+	if got, want := items(featured.String()), []string{"https://remote.test/notes/2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("featured %q after the Removes, want %q", got, want)
+	}
+}
+
+func TestActorDeletes(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	inboxIRI := s.boxIRI(aliceIRI, "inbox")
+	bob := newTestPeer(t, transport, "https://remote.test/users/bob", "rsa")
+	mallory := newTestPeer(t, transport, "https://remote.test/users/mallory", "rsa")
+	follow(t, s, aliceIRI, bob.iri)
+	following(t, s, aliceIRI, bob.iri)
+	note := postBy("Note", "https://remote.test/notes/1", bob.iri.String(), aliceIRI.String())
+	deliver(t, s, bob, inboxIRI, creating(note))
+	status := func(p *testPeer, activity map[string]interface{}) int {
+		t.Helper()
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, signedDelivery(t, p, inboxIRI, activity, false))
+		return w.Code
+	}
+	knows := func(actorIRI string) (follows, followed, posted bool) {
+		t.Helper()
+		follows, err := s.isFollowedBy(c, aliceIRI, mustParse(t, actorIRI))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if followed, err = s.IsFollowing(c, aliceIRI, mustParse(t, actorIRI)); err != nil {
+			t.Fatal(err)
+		}
+		posted, err = s.db.Exists(c, mustParse(t, "https://remote.test/notes/1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	if _, err := s.RefreshObject(c, aliceIRI, bob.iri); err != nil {
+		t.Fatal(err)
+	}
+
+	// No one else on bob's instance may delete bob, or what bob posted.
+	for _, objectIRI := range []string{bob.iri.String(), note["id"].(string)} {
+		d := deleting(mallory.iri.String(), objectIRI)
+		d["id"] = mallory.iri.String() + "#delete-" + objectIRI
+		if code := status(mallory, d); code != http.StatusForbidden {
+			t.Errorf("mallory deleting %s: %d, want %d", objectIRI, code, http.StatusForbidden)
+		}
+	}
+	if follows, followed, posted := knows(bob.iri.String()); !follows || !followed || !posted {
+		t.Errorf("after mallory's Deletes, bob follows %t, is followed %t, has posted %t", follows, followed, posted)
+	}
+
+	deliver(t, s, bob, inboxIRI, deleting(bob.iri.String(), bob.iri.String()))
+	if follows, followed, posted := knows(bob.iri.String()); follows || followed || posted {
+		t.Errorf("after bob deleted themselves, bob follows %t, is followed %t, has posted %t", follows, followed, posted)
+	}
+	if exists, _ := s.db.Exists(c, bob.iri); exists {
+		t.Error("kept bob's actor")
+	}
+
+	// A deleted actor's key can't be had any more, and the Delete only
+	// verified by its actor being gone.
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dave := &testPeer{iri: mustParse(t, "https://gone.test/users/dave"), keyId: "https://gone.test/users/dave#main-key", key: key}
+	follow(t, s, aliceIRI, dave.iri)
+	s.client = &http.Client{Transport: serving{http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusGone)
+	})}}
+	for _, test := range []struct {
+		policy string
+		want   int
+	}{
+		{UnverifiedDeleteReject, http.StatusUnauthorized},
+		{UnverifiedDeleteAcceptSelf, http.StatusOK},
+	} {
+		s.config.UnverifiedDeletes = test.policy
+		if code := status(dave, deleting(dave.iri.String(), dave.iri.String())); code != test.want {
+			t.Errorf("dave deleting themselves unverified under %s: %d, want %d", test.policy, code, test.want)
+		}
+	}
+	if follows, _, _ := knows(dave.iri.String()); follows {
+		t.Error("dave still follows alice after deleting themselves")
+	}
+	// But not a Delete of anyone else.
+	if code := status(dave, deleting(dave.iri.String(), mallory.iri.String())); code != http.StatusUnauthorized {
+		t.Errorf("dave deleting mallory unverified: %d, want %d", code, http.StatusUnauthorized)
+	}
+}
+
+func TestActivitiesOfSeveralObjects(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	inboxIRI := s.boxIRI(aliceIRI, "inbox")
+	bob := newTestPeer(t, transport, "https://remote.test/users/bob", "rsa")
+	following(t, s, aliceIRI, bob.iri)
+	notes := []map[string]interface{}{
+		postBy("Note", "https://remote.test/notes/1", bob.iri.String(), aliceIRI.String()),
+		postBy("Note", "https://remote.test/notes/2", bob.iri.String(), aliceIRI.String()),
+	}
+	// content returns what our copy of the note at `id` says, if we have one.
+	content := func(id string) (string, bool) {
+		t.Helper()
+		v, err := s.db.Get(c, mustParse(t, id))
+		if err != nil {
+			return "", false
+		}
+		m, err := streams.Serialize(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := m["content"].(string)
+		return content, true
+	}
+	// of returns an activity of `activityType` by bob of `objects`.
+	of := func(activityType string, objects ...interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"@context": "https://www.w3.org/ns/activitystreams",
+			"id":       bob.iri.String() + "#" + activityType,
+			"type":     activityType,
+			"actor":    bob.iri.String(),
+			"to":       []interface{}{pub.PublicActivityPubIRI, aliceIRI.String()},
+			"object":   objects,
+		}
+	}
+
+	deliver(t, s, bob, inboxIRI, of("Create", notes[0], notes[1]))
+	for _, note := range notes {
+		if got, ok := content(note["id"].(string)); !ok || got != "<p>hello</p>" {
+			t.Errorf("stored %s as %q, %t after the Create", note["id"], got, ok)
+		}
+	}
+
+	for _, note := range notes {
+		note["content"] = "<p>edited</p>"
+	}
+	deliver(t, s, bob, inboxIRI, of("Update", notes[0], notes[1]))
+	for _, note := range notes {
+		if got, _ := content(note["id"].(string)); got != "<p>edited</p>" {
+			t.Errorf("stored %s as %q after the Update", note["id"], got)
+		}
+	}
+
+	deliver(t, s, bob, inboxIRI, of("Delete", notes[0]["id"], notes[1]["id"]))
+	for _, note := range notes {
+		if got, ok := content(note["id"].(string)); ok {
+			t.Errorf("still have %s as %q after the Delete", note["id"], got)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/go-fed/httpsig"
+)
+
+// go-fed/httpsig signs and verifies the cavage way, but the version Go-Fed's
+// API pins us to only knows RSA and HMAC. Ed25519 signatures we make and
+// check ourselves, over the same signing string it builds.
+
+// What we call Ed25519 in our own keyAlgorithm. The cavage draft predates
+// Ed25519 keys: signatures made with them say "hs2019", leaving the
+// algorithm to the key.
+const algorithmEd25519 httpsig.Algorithm = "ed25519"
+
+// The headers our cavage signatures cover.
+var (
+	cavageGetHeaders  = []string{httpsig.RequestTarget, "host", "date"}
+	cavagePostHeaders = []string{httpsig.RequestTarget, "host", "date", "digest"}
+)
+
+// cavageSigner signs requests the cavage way with one key.
+type cavageSigner struct {
+	key   crypto.PrivateKey
+	keyId string
+	// httpsig's signers, for RSA keys, which aren't safe for concurrent use.
+	mu   sync.Mutex
+	get  httpsig.Signer
+	post httpsig.Signer
+}
+
+// newCavageSigner returns a signer with `key`, known to peers as `keyId`.
+func newCavageSigner(key crypto.PrivateKey, keyId string) (*cavageSigner, error) {
+	algo, err := keyAlgorithm(key)
+	if err != nil {
+		return nil, err
+	}
+	cs := &cavageSigner{key: key, keyId: keyId}
+	if algo == algorithmEd25519 {
+		return cs, nil
+	}
+	prefs := []httpsig.Algorithm{algo}
+	if cs.get, _, err = httpsig.NewSigner(prefs, httpsig.DigestSha256, cavageGetHeaders, httpsig.Signature); err != nil {
+		return nil, err
+	}
+	if cs.post, _, err = httpsig.NewSigner(prefs, httpsig.DigestSha256, cavagePostHeaders, httpsig.Signature); err != nil {
+		return nil, err
+	}
+	return cs, nil
+}
+
+// sign signs `r`, whose body is `body` if it has one.
+func (cs *cavageSigner) sign(r *http.Request, body []byte) error {
+	// Covered headers are read off the headers, and Go keeps the host of
+	// requests we make in their URL.
+	r.Header.Set("Host", r.URL.Host)
+	if key, ok := cs.key.(ed25519.PrivateKey); ok {
+		return signCavageEd25519(r, body, key, cs.keyId)
+	}
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if body != nil {
+		// httpsig would add a Digest of the body with the hash appended to
+		// it, not of the hash alone, so we add the one peers check.
+		setDigest(r, body)
+		return cs.post.SignRequest(cs.key, cs.keyId, r, nil)
+	}
+	return cs.get.SignRequest(cs.key, cs.keyId, r, nil)
+}
+
+// setDigest sets the Digest header of `r` to the SHA-256 of `body`.
+func setDigest(r *http.Request, body []byte) {
+	sum := sha256.Sum256(body)
+	r.Header.Set("Digest", "SHA-256="+base64.StdEncoding.EncodeToString(sum[:]))
+}
+
+// signCavageEd25519 signs `r`, whose body is `body` if it has one, with the
+// Ed25519 `key`.
+func signCavageEd25519(r *http.Request, body []byte, key ed25519.PrivateKey, keyId string) error {
+	headers := cavageGetHeaders
+	if body != nil {
+		setDigest(r, body)
+		headers = cavagePostHeaders
+	}
+	signed, err := cavageSigningString(r, headers)
+	if err != nil {
+		return err
+	}
+	sig := ed25519.Sign(key, []byte(signed))
+	r.Header.Set("Signature", `keyId="`+keyId+`",algorithm="hs2019",headers="`+strings.Join(headers, " ")+
+		`",signature="`+base64.StdEncoding.EncodeToString(sig)+`"`)
+	return nil
+}
+
+// verifyCavageEd25519 checks the cavage signature on `r` was made with the
+// private half of the Ed25519 `key`.
+func verifyCavageEd25519(r *http.Request, key ed25519.PublicKey) error {
+	headers := strings.Fields(strings.ToLower(signatureParam(r, "headers")))
+	if len(headers) == 0 {
+		// Signatures not listing their headers cover only the date.
+		headers = []string{"date"}
+	}
+	sig, err := base64.StdEncoding.DecodeString(signatureParam(r, "signature"))
+	if err != nil {
+		return fmt.Errorf("malformed signature: %w", err)
+	}
+	signed, err := cavageSigningString(r, headers)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(key, []byte(signed), sig) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// cavageSigningString builds what a cavage signature covering `headers` of
+// `r` signs, as httpsig does.
+func cavageSigningString(r *http.Request, headers []string) (string, error) {
+	lines := make([]string, len(headers))
+	for i, h := range headers {
+		if h == httpsig.RequestTarget {
+			target := r.URL.Path
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			lines[i] = h + ": " + strings.ToLower(r.Method) + " " + target
+			continue
+		}
+		values := r.Header.Values(h)
+		if len(values) == 0 {
+			return "", fmt.Errorf("covered header %s is missing", h)
+		}
+		for j := range values {
+			values[j] = strings.TrimSpace(values[j])
+		}
+		lines[i] = h + ": " + strings.Join(values, ", ")
+	}
+	return strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,390 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// collectionItems returns the items of the collection stored at `id`, or of
+// the `replies`, `likes` or `shares` of a local status if that's what `id`
+// is, and whether it is an OrderedCollection.
+func (s *Service) collectionItems(c context.Context, id *url.URL) (items []*url.URL, ordered bool, err error) {
+	t, err := s.db.Get(c, id)
+	if err != nil {
+		if items, ok := s.repliesItems(c, id); ok {
+			return items, true, nil
+		}
+		if items, ok := s.reactionItems(c, id); ok {
+			return items, false, nil
+		}
+		return nil, false, err
+	}
+	switch col := t.(type) {
+	case vocab.ActivityStreamsOrderedCollection:
+		if oi := col.GetActivityStreamsOrderedItems(); oi != nil {
+			for iter := oi.Begin(); iter != oi.End(); iter = iter.Next() {
+				if itemId, err := pub.ToId(iter); err == nil {
+					items = append(items, itemId)
+				}
+			}
+		}
+		return items, true, nil
+	case vocab.ActivityStreamsCollection:
+		if ci := col.GetActivityStreamsItems(); ci != nil {
+			for iter := ci.Begin(); iter != ci.End(); iter = iter.Next() {
+				if itemId, err := pub.ToId(iter); err == nil {
+					items = append(items, itemId)
+				}
+			}
+		}
+		return items, false, nil
+	}
+	return nil, false, errors.New("not a collection")
+}
+
+// pageIRI is where page `page`, counting from 1, of the collection at `id`
+// is served. Whatever else `id` queries for, such as a time range, is kept.
+func pageIRI(id *url.URL, page int) *url.URL {
+	u := *id
+	q := u.Query()
+	q.Set("page", strconv.Itoa(page))
+	u.RawQuery = q.Encode()
+	return &u
+}
+
+// pageSize is how many items go on each page of the collection at `id`.
+// Following collections are paged as followers are.
+func (s *Service) pageSize(id *url.URL) int {
+	size := 0
+	switch path.Base(id.Path) {
+	case "outbox":
+		size = s.config.OutboxPageSize
+	case "inbox":
+		size = s.config.InboxPageSize
+	case "followers", "following":
+		size = s.config.FollowersPageSize
+	case "replies":
+		size = s.config.RepliesPageSize
+	}
+	if size < 1 {
+		return s.config.CollectionPageSize
+	}
+	return size
+}
+
+// pageCount is how many pages of `size` it takes to hold `total` items. Even
+// an empty collection has one, empty, page.
+func pageCount(total, size int) int {
+	if total <= size {
+		return 1
+	}
+	return (total + size - 1) / size
+}
+
+// pageBounds returns which of `total` items go on page `page`.
+func pageBounds(total, size, page int) (start, end int) {
+	start = (page - 1) * size
+	if start > total {
+		start = total
+	}
+	end = start + size
+	if end > total {
+		end = total
+	}
+	return
+}
+
+// collectionRoot presents the collection at `id` without its items, linking
+// to the pages holding them instead. Our collections are newest first, so
+// the first page is also the current one.
+func (s *Service) collectionRoot(id *url.URL, total int, ordered bool) vocab.Type {
+	size := s.pageSize(id)
+	jsonId := streams.NewJSONLDIdProperty()
+	jsonId.Set(id)
+	totalItems := streams.NewActivityStreamsTotalItemsProperty()
+	totalItems.Set(total)
+	first := streams.NewActivityStreamsFirstProperty()
+	first.SetIRI(pageIRI(id, 1))
+	last := streams.NewActivityStreamsLastProperty()
+	last.SetIRI(pageIRI(id, pageCount(total, size)))
+	current := streams.NewActivityStreamsCurrentProperty()
+	current.SetIRI(pageIRI(id, 1))
+	if ordered {
+		oc := streams.NewActivityStreamsOrderedCollection()
+		oc.SetJSONLDId(jsonId)
+		oc.SetActivityStreamsTotalItems(totalItems)
+		oc.SetActivityStreamsFirst(first)
+		oc.SetActivityStreamsLast(last)
+		oc.SetActivityStreamsCurrent(current)
+		return oc
+	}
+	col := streams.NewActivityStreamsCollection()
+	col.SetJSONLDId(jsonId)
+	col.SetActivityStreamsTotalItems(totalItems)
+	col.SetActivityStreamsFirst(first)
+	col.SetActivityStreamsLast(last)
+	col.SetActivityStreamsCurrent(current)
+	return col
+}
+
+// collectionHidden reports whether `id` is the followers or following
+// collection of a local actor hiding them. We can't tell who's asking over
+// ActivityPub, so the actor's own requests are refused too.
+func (s *Service) collectionHidden(c context.Context, id *url.URL) bool {
+	for _, box := range []string{"/followers", "/following"} {
+		if strings.HasSuffix(id.Path, box) {
+			actorIRI := *id
+			actorIRI.Path = strings.TrimSuffix(id.Path, box)
+			return s.CollectionsHidden(c, &actorIRI, nil)
+		}
+	}
+	return false
+}
+
+// inlineCollection presents the collection at `id` with its `items` in it,
+// for collections small enough not to need pages.
+func inlineCollection(id *url.URL, items []*url.URL, ordered bool) vocab.Type {
+	jsonId := streams.NewJSONLDIdProperty()
+	jsonId.Set(id)
+	totalItems := streams.NewActivityStreamsTotalItemsProperty()
+	totalItems.Set(len(items))
+	if ordered {
+		oc := streams.NewActivityStreamsOrderedCollection()
+		oc.SetJSONLDId(jsonId)
+		oc.SetActivityStreamsTotalItems(totalItems)
+		orderedItems := streams.NewActivityStreamsOrderedItemsProperty()
+		for _, item := range items {
+			orderedItems.AppendIRI(item)
+		}
+		oc.SetActivityStreamsOrderedItems(orderedItems)
+		return oc
+	}
+	col := streams.NewActivityStreamsCollection()
+	col.SetJSONLDId(jsonId)
+	col.SetActivityStreamsTotalItems(totalItems)
+	colItems := streams.NewActivityStreamsItemsProperty()
+	for _, item := range items {
+		colItems.AppendIRI(item)
+	}
+	col.SetActivityStreamsItems(colItems)
+	return col
+}
+
+// hiddenCollectionRoot presents the collection at `id` as only its size.
+func (s *Service) hiddenCollectionRoot(id *url.URL, total int, ordered bool) vocab.Type {
+	jsonId := streams.NewJSONLDIdProperty()
+	jsonId.Set(id)
+	totalItems := streams.NewActivityStreamsTotalItemsProperty()
+	totalItems.Set(total)
+	if ordered {
+		oc := streams.NewActivityStreamsOrderedCollection()
+		oc.SetJSONLDId(jsonId)
+		oc.SetActivityStreamsTotalItems(totalItems)
+		return oc
+	}
+	col := streams.NewActivityStreamsCollection()
+	col.SetJSONLDId(jsonId)
+	col.SetActivityStreamsTotalItems(totalItems)
+	return col
+}
+
+// orderedCollectionPage returns page `page` of the OrderedCollection at
+// `id` holding `items`.
+func (s *Service) orderedCollectionPage(id *url.URL, items []*url.URL, page int) vocab.ActivityStreamsOrderedCollectionPage {
+	size := s.pageSize(id)
+	start, end := pageBounds(len(items), size, page)
+	p := streams.NewActivityStreamsOrderedCollectionPage()
+	jsonId := streams.NewJSONLDIdProperty()
+	jsonId.Set(pageIRI(id, page))
+	p.SetJSONLDId(jsonId)
+	partOf := streams.NewActivityStreamsPartOfProperty()
+	partOf.SetIRI(id)
+	p.SetActivityStreamsPartOf(partOf)
+	totalItems := streams.NewActivityStreamsTotalItemsProperty()
+	totalItems.Set(len(items))
+	p.SetActivityStreamsTotalItems(totalItems)
+	startIndex := streams.NewActivityStreamsStartIndexProperty()
+	startIndex.Set(start)
+	p.SetActivityStreamsStartIndex(startIndex)
+	orderedItems := streams.NewActivityStreamsOrderedItemsProperty()
+	for _, item := range items[start:end] {
+		orderedItems.AppendIRI(item)
+	}
+	p.SetActivityStreamsOrderedItems(orderedItems)
+	if page > 1 {
+		prev := streams.NewActivityStreamsPrevProperty()
+		prev.SetIRI(pageIRI(id, page-1))
+		p.SetActivityStreamsPrev(prev)
+	}
+	if page < pageCount(len(items), size) {
+		next := streams.NewActivityStreamsNextProperty()
+		next.SetIRI(pageIRI(id, page+1))
+		p.SetActivityStreamsNext(next)
+	}
+	return p
+}
+
+// collectionPage returns page `page` of the unordered Collection at `id`
+// holding `items`.
+func (s *Service) collectionPage(id *url.URL, items []*url.URL, page int) vocab.ActivityStreamsCollectionPage {
+	size := s.pageSize(id)
+	start, end := pageBounds(len(items), size, page)
+	p := streams.NewActivityStreamsCollectionPage()
+	jsonId := streams.NewJSONLDIdProperty()
+	jsonId.Set(pageIRI(id, page))
+	p.SetJSONLDId(jsonId)
+	partOf := streams.NewActivityStreamsPartOfProperty()
+	partOf.SetIRI(id)
+	p.SetActivityStreamsPartOf(partOf)
+	totalItems := streams.NewActivityStreamsTotalItemsProperty()
+	totalItems.Set(len(items))
+	p.SetActivityStreamsTotalItems(totalItems)
+	pageItems := streams.NewActivityStreamsItemsProperty()
+	for _, item := range items[start:end] {
+		pageItems.AppendIRI(item)
+	}
+	p.SetActivityStreamsItems(pageItems)
+	if page > 1 {
+		prev := streams.NewActivityStreamsPrevProperty()
+		prev.SetIRI(pageIRI(id, page-1))
+		p.SetActivityStreamsPrev(prev)
+	}
+	if page < pageCount(len(items), size) {
+		next := streams.NewActivityStreamsNextProperty()
+		next.SetIRI(pageIRI(id, page+1))
+		p.SetActivityStreamsNext(next)
+	}
+	return p
+}
+
+// requestedPage returns the `page` asked for in `r`, or 0 for the collection
+// itself.
+func requestedPage(r *http.Request) (int, error) {
+	p := r.URL.Query().Get("page")
+	if p == "" {
+		return 0, nil
+	}
+	// Mastodon links to `?page=true` for the first page.
+	if p == "true" {
+		return 1, nil
+	}
+	page, err := strconv.Atoi(p)
+	if err != nil || page < 1 {
+		return 0, errors.New("invalid page")
+	}
+	return page, nil
+}
+
+// serveCollection serves the collection stored at `id`, or the page of it
+// the request asks for, with only the items `viewer`, nil for anyone, may
+// see. A request for only what was published within a
+// time range is served that part of the collection, as a collection of its
+// own with the range in its id.
+func (s *Service) serveCollection(w http.ResponseWriter, r *http.Request, id *url.URL, viewer *url.URL) {
+	c := r.Context()
+	page, err := requestedPage(r)
+	if err != nil {
+		WriteError(w, &ParseError{err})
+		return
+	}
+	tr, err := requestedTimeRange(r)
+	if err != nil {
+		WriteError(w, &ParseError{err})
+		return
+	}
+	items, ordered, err := s.collectionItems(c, id)
+	if err != nil {
+		WriteError(w, ErrNotFound)
+		return
+	}
+	items = s.visibleItems(c, items, viewer)
+	if !tr.IsZero() {
+		items = s.itemsWithin(items, tr)
+		within := *id
+		within.RawQuery = tr.query().Encode()
+		id = &within
+	}
+	hidden := s.collectionHidden(c, id)
+	var t vocab.Type
+	switch {
+	case page == 0 && hidden:
+		t = s.hiddenCollectionRoot(id, len(items), ordered)
+	case hidden:
+		WriteError(w, ErrNotFound)
+		return
+	case page == 0 && s.config.MaxInlineItems > 0 && len(items) <= s.config.MaxInlineItems:
+		t = inlineCollection(id, items, ordered)
+	case page == 0:
+		t = s.collectionRoot(id, len(items), ordered)
+	case page > pageCount(len(items), s.pageSize(id)):
+		WriteError(w, ErrNotFound)
+		return
+	case ordered:
+		t = s.orderedCollectionPage(id, items, page)
+	default:
+		t = s.collectionPage(id, items, page)
+	}
+	writeActivityStreams(w, http.StatusOK, t)
+}
+
+// writeActivityStreams replies with `t` as ActivityStreams JSON, without its
+// blind recipients.
+func writeActivityStreams(w http.ResponseWriter, status int, t vocab.Type) {
+	m, err := streams.Serialize(t)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	writeSerialized(w, status, m)
+}
+
+// writeSerialized is writeActivityStreams for a value already serialized.
+func writeSerialized(w http.ResponseWriter, status int, m map[string]interface{}) {
+	stripHiddenRecipients(m)
+	withLanguageMaps(m)
+	withLDContext(m)
+	b, err := marshalCanonical(m)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", mediaTypeActivityJSON)
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+// isCollection reports whether `id` holds one of our collections.
+func (s *Service) isCollection(c context.Context, id *url.URL) bool {
+	_, _, err := s.collectionItems(c, id)
+	return err == nil
+}
+
+// requestedOrderedCollectionPage returns the page of an inbox or outbox that
+// `r` asks for, defaulting to the first.
+func (s *Service) requestedOrderedCollectionPage(c context.Context, r *http.Request) (vocab.ActivityStreamsOrderedCollectionPage, error) {
+	page, err := requestedPage(r)
+	if err != nil {
+		return nil, err
+	}
+	if page == 0 {
+		page = 1
+	}
+	id := &url.URL{Scheme: "https", Host: s.db.Hostname(), Path: r.URL.Path}
+	items, _, err := s.collectionItems(c, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.orderedCollectionPage(id, items, page), nil
+}
@@ -0,0 +1,320 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// collectionJSON is what tests look at in a collection or one of its pages.
+type collectionJSON struct {
+	Id           string      `json:"id"`
+	Type         string      `json:"type"`
+	TotalItems   int         `json:"totalItems"`
+	First        string      `json:"first"`
+	Last         string      `json:"last"`
+	Current      string      `json:"current"`
+	PartOf       string      `json:"partOf"`
+	Prev         string      `json:"prev"`
+	Next         string      `json:"next"`
+	Items        interface{} `json:"items"`
+	OrderedItems interface{} `json:"orderedItems"`
+}
+
+// count returns how many `items` there are: ActivityStreams serializes a
+// single item without its array.
+func count(items interface{}) int {
+	switch items := items.(type) {
+	case nil:
+		return 0
+	case []interface{}:
+		return len(items)
+	}
+	return 1
+}
+
+// getCollection gets `iri` from `s` unsigned, failing the test unless it's
+// served with `status`.
+func getCollection(t *testing.T, s *Service, iri string, status int) collectionJSON {
+	t.Helper()
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, signedFetch(t, nil, iri))
+	if w.Code != status {
+		t.Fatalf("GET %s: %d %s, want %d", iri, w.Code, w.Body, status)
+	}
+	var col collectionJSON
+	if status == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &col); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return col
+}
+
+func TestCollectionPages(t *testing.T) {
+	s, _ := newTestService(t)
+	s.config.FollowersPageSize = 2
+	s.config.MaxInlineItems = 0
+	aliceIRI := register(t, s, "alice")
+	for i := 0; i < 5; i++ {
+		follow(t, s, aliceIRI, mustParse(t, fmt.Sprintf("https://remote.test/users/%d", i)))
+	}
+	followers := s.boxIRI(aliceIRI, "followers").String()
+
+	root := getCollection(t, s, followers, http.StatusOK)
+	want := collectionJSON{
+		Id:         followers,
+		Type:       "Collection",
+		TotalItems: 5,
+		First:      followers + "?page=1",
+		Last:       followers + "?page=3",
+		Current:    followers + "?page=1",
+	}
+	if !reflect.DeepEqual(root, want) {
+		t.Errorf("root %+v, want %+v", root, want)
+	}
+
+	seen := 0
+	for page, links := range []struct{ prev, next string }{
+		{"", followers + "?page=2"},
+		{followers + "?page=1", followers + "?page=3"},
+		{followers + "?page=2", ""},
+	} {
+		p := getCollection(t, s, fmt.Sprintf("%s?page=%d", followers, page+1), http.StatusOK)
+		if p.Type != "CollectionPage" || p.PartOf != followers || p.TotalItems != 5 || p.Prev != links.prev || p.Next != links.next {
+			t.Errorf("page %d: %+v", page+1, p)
+		}
+		seen += count(p.Items)
+	}
+	if seen != 5 {
+		t.Errorf("%d items over the pages, want 5", seen)
+	}
+
+	if p := getCollection(t, s, followers+"?page=true", http.StatusOK); p.Id != followers+"?page=1" {
+		t.Errorf("?page=true served %s, want the first page", p.Id)
+	}
+	getCollection(t, s, followers+"?page=4", http.StatusNotFound)
+	getCollection(t, s, followers+"?page=0", http.StatusBadRequest)
+
+	// Small enough, the items are inline.
+	s.config.MaxInlineItems = 5
+	if root := getCollection(t, s, followers, http.StatusOK); count(root.Items) != 5 || root.First != "" {
+		t.Errorf("inline collection %+v", root)
+	}
+}
+
+func TestInlineCollectionThreshold(t *testing.T) {
+	s, _ := newTestService(t)
+	s.config.FollowersPageSize = 2
+	aliceIRI := register(t, s, "alice")
+	bobIRI := register(t, s, "bob")
+	for i := 0; i < 3; i++ {
+		follow(t, s, aliceIRI, mustParse(t, fmt.Sprintf("https://remote.test/users/%d", i)))
+	}
+	followers := s.boxIRI(aliceIRI, "followers").String()
+	noFollowers := s.boxIRI(bobIRI, "followers").String()
+
+	for _, test := range []struct {
+		iri    string
+		max    int
+		inline bool
+	}{
+		{followers, 2, false},
+		{followers, 3, true},
+		{followers, 4, true},
+		{followers, 0, false},
+		{noFollowers, 0, false},
+		{noFollowers, 1, true},
+	} {
+		s.config.MaxInlineItems = test.max
+		root := getCollection(t, s, test.iri, http.StatusOK)
+		if test.inline && (root.First != "" || count(root.Items) != root.TotalItems) {
+			t.Errorf("%s with at most %d inline: %+v, want its items inline", test.iri, test.max, root)
+		}
+		if !test.inline && (root.First != test.iri+"?page=1" || count(root.Items) != 0) {
+			t.Errorf("%s with at most %d inline: %+v, want it paginated", test.iri, test.max, root)
+		}
+	}
+}
+
+func TestOrderedCollectionPages(t *testing.T) {
+	s, transport := newTestService(t)
+	s.config.OutboxPageSize = 1
+	s.config.MaxInlineItems = 0
+	aliceIRI := register(t, s, "alice")
+	respondLocally(t, s, transport, s.boxIRI(aliceIRI, "followers"))
+	outbox := s.boxIRI(aliceIRI, "outbox").String()
+
+	// Even an empty collection has a page.
+	root := getCollection(t, s, outbox, http.StatusOK)
+	if root.Type != "OrderedCollection" || root.TotalItems != 0 || count(root.OrderedItems) != 0 {
+		t.Errorf("empty outbox %+v", root)
+	}
+	p := getCollection(t, s, outbox+"?page=1", http.StatusOK)
+	if p.Type != "OrderedCollectionPage" || count(p.OrderedItems) != 0 || p.Next != "" {
+		t.Errorf("empty outbox's page %+v", p)
+	}
+	getCollection(t, s, outbox+"?page=2", http.StatusNotFound)
+
+	// Newest first, the first page is the current one.
+	var posted []string
+	for _, status := range []string{"first", "second"} {
+		note, err := s.PostStatus(context.Background(), aliceIRI, StatusParams{Status: status, Visibility: VisibilityPublic})
+		if err != nil {
+			t.Fatal(err)
+		}
+		posted = append(posted, note.GetJSONLDId().Get().String())
+	}
+	root = getCollection(t, s, outbox, http.StatusOK)
+	if root.TotalItems != 2 || root.Current != outbox+"?page=1" || root.Last != outbox+"?page=2" {
+		t.Errorf("outbox %+v", root)
+	}
+	for page, want := range []string{posted[1], posted[0]} {
+		p := getCollection(t, s, fmt.Sprintf("%s?page=%d", outbox, page+1), http.StatusOK)
+		create, ok := p.OrderedItems.(string)
+		if !ok {
+			t.Fatalf("page %d: %v", page+1, p.OrderedItems)
+		}
+		got := s.createdObjects(context.Background(), mustParse(t, create))
+		if len(got) != 1 || got[0].GetJSONLDId().Get().String() != want {
+			t.Errorf("page %d holds the Create of %v, want %s", page+1, typesOf(got), want)
+		}
+	}
+}
+
+// getObject gets the object at `iri` from `s` unsigned, as JSON.
+func getObject(t *testing.T, s *Service, iri string) map[string]interface{} {
+	t.Helper()
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, signedFetch(t, nil, iri))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET %s: %d %s", iri, w.Code, w.Body)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestRepliesCollection(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	s.config.RepliesPageSize = 1
+	s.config.MaxInlineItems = 0
+	aliceIRI := register(t, s, "alice")
+	inboxIRI := s.boxIRI(aliceIRI, "inbox")
+	bob := newTestPeer(t, transport, "https://remote.test/users/bob", "rsa")
+	note, err := s.PostStatus(c, aliceIRI, StatusParams{Status: "hello", Visibility: VisibilityPublic})
+	if err != nil {
+		t.Fatal(err)
+	}
+	noteIRI := note.GetJSONLDId().Get().String()
+	replies := noteIRI + "/replies"
+	if got := getObject(t, s, noteIRI)["replies"]; got != replies {
+		t.Errorf("replies %v, want %s", got, replies)
+	}
+	if root := getCollection(t, s, replies, http.StatusOK); root.Type != "OrderedCollection" || root.TotalItems != 0 {
+		t.Errorf("replies before any %+v", root)
+	}
+
+	for i, published := range []string{"2026-10-16T12:00:00Z", "2026-10-16T13:00:00Z"} {
+		reply := postBy("Note", fmt.Sprintf("https://remote.test/notes/%d", i+1), bob.iri.String(), aliceIRI.String())
+		reply["inReplyTo"] = noteIRI
+		reply["published"] = published
+		deliver(t, s, bob, inboxIRI, creating(reply))
+	}
+	// Replies only alice may see aren't listed.
+	direct := postBy("Note", "https://remote.test/notes/3", bob.iri.String(), aliceIRI.String())
+	direct["to"] = aliceIRI.String()
+	direct["inReplyTo"] = noteIRI
+	deliver(t, s, bob, inboxIRI, creating(direct))
+
+	root := getCollection(t, s, replies, http.StatusOK)
+	if root.TotalItems != 2 || root.First != replies+"?page=1" || root.Last != replies+"?page=2" {
+		t.Errorf("replies %+v", root)
+	}
+	for page, want := range []string{"https://remote.test/notes/2", "https://remote.test/notes/1"} {
+		p := getCollection(t, s, fmt.Sprintf("%s?page=%d", replies, page+1), http.StatusOK)
+		if p.Type != "OrderedCollectionPage" || p.PartOf != replies || p.OrderedItems != want {
+			t.Errorf("page %d: %+v, want it to hold %s", page+1, p, want)
+		}
+	}
+
+	// Statuses that aren't public have none to show.
+	private, err := s.PostStatus(c, aliceIRI, StatusParams{Status: "hush", Visibility: VisibilityPrivate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	getCollection(t, s, private.GetJSONLDId().Get().String()+"/replies", http.StatusNotFound)
+}
+
+func TestLikesAndSharesCollections(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	inboxIRI := s.boxIRI(aliceIRI, "inbox")
+	bob := newTestPeer(t, transport, "https://remote.test/users/bob", "rsa")
+	carol := newTestPeer(t, transport, "https://other.test/users/carol", "rsa")
+	note, err := s.PostStatus(c, aliceIRI, StatusParams{Status: "hello", Visibility: VisibilityPublic})
+	if err != nil {
+		t.Fatal(err)
+	}
+	noteIRI := note.GetJSONLDId().Get().String()
+
+	deliver(t, s, bob, inboxIRI, reacting(bob, "Like", "https://remote.test/likes/1", noteIRI))
+	deliver(t, s, carol, inboxIRI, reacting(carol, "Like", "https://other.test/likes/1", noteIRI))
+	deliver(t, s, carol, inboxIRI, reacting(carol, "Announce", "https://other.test/announces/1", noteIRI))
+
+	served := getObject(t, s, noteIRI)
+	for _, test := range []struct {
+		key   string
+		items []string
+	}{
+		{"likes", []string{"https://other.test/likes/1", "https://remote.test/likes/1"}},
+		{"shares", []string{"https://other.test/announces/1"}},
+	} {
+		want := map[string]interface{}{
+			"id":         noteIRI + "/" + test.key,
+			"type":       "Collection",
+			"totalItems": float64(len(test.items)),
+		}
+		if got := served[test.key]; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s served as %v, want %v", test.key, got, want)
+		}
+		col := getCollection(t, s, noteIRI+"/"+test.key, http.StatusOK)
+		if col.Type != "Collection" || col.TotalItems != len(test.items) {
+			t.Errorf("%s %+v, want %d items", test.key, col, len(test.items))
+		}
+		var items []string
+		switch got := getCollection(t, s, col.First, http.StatusOK).Items.(type) {
+		case string:
+			items = append(items, got)
+		case []interface{}:
+			for _, item := range got {
+				items = append(items, item.(string))
+			}
+		}
+		sort.Strings(items)
+		if !reflect.DeepEqual(items, test.items) {
+			t.Errorf("%s lists %q, want %q", test.key, items, test.items)
+		}
+	}
+
+	// Statuses that aren't public have none to list.
+	private, err := s.PostStatus(c, aliceIRI, StatusParams{Status: "hush", Visibility: VisibilityPrivate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateIRI := private.GetJSONLDId().Get().String()
+	getCollection(t, s, privateIRI+"/likes", http.StatusNotFound)
+	getCollection(t, s, privateIRI+"/shares", http.StatusNotFound)
+}
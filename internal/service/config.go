@@ -0,0 +1,236 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import "time"
+
+// Config holds the settings an operator can tune on the service.
+type Config struct {
+	// The name of the instance, as shown to clients.
+	Title string
+	// A longer, free-form description of the instance.
+	Description string
+	// Where people can reach the operators.
+	ContactEmail string
+	// The username of the local account to present as the contact.
+	ContactUsername string
+	// Whether anyone may sign up.
+	RegistrationsOpen bool
+	// Whether follows of local accounts wait for them to approve, for
+	// accounts that don't say. Mastodon has them accepted right away.
+	ManuallyApproveFollows bool
+	// The domain in our users' handles, when it isn't the one our actors
+	// live on: say the web UI is on `example.com` and actors on
+	// `ap.example.com`. Empty means the actors' domain.
+	AccountDomain string
+	// Consulted on every sign-up, if set. See RegistrationHook.
+	RegistrationHook RegistrationHook
+	// The local accounts allowed to moderate.
+	AdminUsernames []string
+	// The language, as an ISO 639-1 code, of notes that don't say.
+	DefaultLanguage string
+	// The time zone we show times in. Nil means UTC.
+	TimeZone *time.Location
+
+	// The most characters a local user may put in a single note, counted
+	// the way Mastodon counts them (see NoteLength).
+	MaxNoteChars int
+	// The most media attachments a single note may carry.
+	MaxMediaAttachments int
+	// The largest image and video uploads accepted, in bytes.
+	ImageSizeLimit int
+	VideoSizeLimit int
+	// The most options a poll may offer, and how long each may be.
+	MaxPollOptions     int
+	MaxPollOptionChars int
+	// The shortest and longest a poll may stay open.
+	MinPollExpiration time.Duration
+	MaxPollExpiration time.Duration
+
+	// The kind of key new local actors sign with, one of the KeyType
+	// constants. Few peers verify Ed25519 signatures yet.
+	KeyType string
+	// How we sign requests to peers first, one of the Signature constants.
+	// Peers refusing it get the other.
+	SignatureStyle string
+
+	// How long a request to a peer may take, body and all, the most we read
+	// of what it sends back, and how many connections we keep open to it
+	// at once.
+	FetchTimeout    time.Duration
+	MaxResponseSize int64
+	MaxConnsPerHost int
+	// The private, loopback and link-local addresses, as CIDR prefixes like
+	// "127.0.0.0/8", we may still connect to. Such addresses are otherwise
+	// refused, lest peers have us probe our own network. Tests allow
+	// loopback.
+	AllowedPrivateNetworks []string
+	// How many redirects we follow fetching an object. One landing on
+	// another host must serve an object whose id is on that host.
+	MaxRedirects int
+
+	// Whether peers must sign their requests for our objects and
+	// collections, as Mastodon's "authorized fetch" has them do, so that
+	// suspended domains can't read them either. Actors stay readable by
+	// anyone, for peers to get their keys, unless SignedActorFetches.
+	AuthorizedFetch bool
+	// Whether deliveries to our inboxes must be signed.
+	// Turning it off lets anyone deliver anything as anyone: it's only for
+	// trying things out.
+	SignedDeliveries bool
+	// Whether we take deliveries signed by someone other than their actor,
+	// as forwarded ones are, if they carry their actor's Linked Data
+	// Signature, checked with LDCanonicalizer. Otherwise they're refused.
+	LDSignatures bool
+	// Whether the public Creates we send carry our LD signature too, also
+	// made with LDCanonicalizer, for peers that only forward signed ones.
+	LDSignCreates bool
+	// What canonicalizes documents for LD signatures. If nil, json-gold's
+	// URDNA2015, with the contexts fetched as anything else is.
+	LDCanonicalizer LDCanonicalizer
+	// Whether peers must sign their requests for our actors too. Peers
+	// fetching our keys unsigned can't verify our signatures then.
+	SignedActorFetches bool
+	// Whether cavage-style signatures must cover a Date header within an
+	// hour of now, as RFC 9421 signatures' creation time always must, so
+	// captured requests can't be replayed for long.
+	EnforceSignatureDate bool
+	// Whether we also refuse to fetch from or deliver to suspended domains,
+	// rather than only refusing to hear from them.
+	RefuseSuspendedDomains bool
+	// What we do with Deletes whose signature we can't check, one of the
+	// UnverifiedDelete constants.
+	UnverifiedDeletes string
+
+	// The largest delivery to our inboxes we take.
+	MaxInboxBodySize int64
+
+	// How many deliveries to peers we make at once.
+	DeliveryWorkers int
+	// How many deliveries to a peer may fail in a row before we hold off
+	// delivering to it, and for how long.
+	DeliveryFailureLimit int
+	DeliveryCooldown     time.Duration
+	// How deep we look into an activity for one of our objects when
+	// deciding whether to forward it to the members of our collections it's
+	// addressed to.
+	MaxInboxForwardingDepth int
+	// How deep we look into the collections our activities are addressed
+	// to for more recipients, counting the members of the collections
+	// addressed as the first level. The default of 1 reaches our followers,
+	// but not those of a remote actor, which are theirs to deliver to, nor
+	// the members of any collection among them.
+	MaxDeliveryDepth int
+
+	// How long to wait between the rows of an import, to go easy on peers.
+	ImportInterval time.Duration
+
+	// The least time between two fetches of the same remote object by
+	// RefreshObject, or of a peer's key when a signature doesn't verify
+	// with the one we have.
+	MinRefreshInterval time.Duration
+
+	// How long we trust a peer's WebFinger answer about one of its
+	// accounts, and its saying there's no such account, before asking
+	// again. Zero turns either off.
+	WebFingerCacheTTL    time.Duration
+	WebFingerNegativeTTL time.Duration
+
+	// How long, and for how many deliveries at most, we remember the
+	// activities delivered to our inboxes so redeliveries can be skipped
+	// outright. A zero window turns this off.
+	InboxDedupWindow time.Duration
+	InboxDedupSize   int
+
+	// How deep a thread we show either side of a status, and how many
+	// fetches from peers we make to fill it in, of missing ancestors and of
+	// the replies a remote status lists.
+	MaxContextDepth   int
+	MaxContextFetches int
+
+	// How often we recompute the trending hashtags, over how long a stretch
+	// of posts, how quickly a use of a hashtag counts for less, and how many
+	// of them we keep.
+	TrendInterval time.Duration
+	TrendWindow   time.Duration
+	TrendHalfLife time.Duration
+	MaxTrends     int
+
+	// Whether what's been deleted is served, as its Tombstone, with 410
+	// Gone, as Mastodon does, rather than 200 OK, for peers taking a 410
+	// for a failure.
+	TombstonesGone bool
+
+	// What we serve as /robots.txt. Empty serves none.
+	RobotsTxt string
+
+	// Where clients authorize with OAuth and get their tokens, advertised
+	// among our actors' endpoints. Empty advertises none.
+	OAuthAuthorizationEndpoint string
+	OAuthTokenEndpoint         string
+
+	// How many items go on each page of the collections we serve.
+	CollectionPageSize int
+	// The page sizes of particular collections, where they should differ.
+	// Zero means CollectionPageSize.
+	OutboxPageSize    int
+	InboxPageSize     int
+	FollowersPageSize int
+	RepliesPageSize   int
+	// Collections of at most this many items are served with their items
+	// inline, sparing peers fetching a page. Larger ones, and all of them
+	// if it's zero, only link to their pages.
+	MaxInlineItems int
+}
+
+// The kinds of key local actors may have.
+const (
+	KeyTypeRSA     = "rsa"
+	KeyTypeEd25519 = "ed25519"
+)
+
+// DefaultConfig returns the settings a stock Mastodon instance would use.
+func DefaultConfig() Config {
+	return Config{
+		Title:                   "Mastogon",
+		DefaultLanguage:         "en",
+		MaxNoteChars:            500,
+		MaxMediaAttachments:     4,
+		ImageSizeLimit:          10 * 1024 * 1024,
+		VideoSizeLimit:          40 * 1024 * 1024,
+		MaxPollOptions:          4,
+		MaxPollOptionChars:      50,
+		MinPollExpiration:       5 * time.Minute,
+		MaxPollExpiration:       30 * 24 * time.Hour,
+		KeyType:                 KeyTypeRSA,
+		SignatureStyle:          SignatureCavage,
+		FetchTimeout:            10 * time.Second,
+		MaxResponseSize:         1 << 20,
+		MaxConnsPerHost:         8,
+		MaxRedirects:            5,
+		UnverifiedDeletes:       UnverifiedDeleteAcceptSelf,
+		MaxInboxBodySize:        1 << 20,
+		DeliveryWorkers:         4,
+		DeliveryFailureLimit:    10,
+		DeliveryCooldown:        10 * time.Minute,
+		MaxInboxForwardingDepth: 4,
+		MaxDeliveryDepth:        1,
+		ImportInterval:          500 * time.Millisecond,
+		MinRefreshInterval:      time.Minute,
+		WebFingerCacheTTL:       24 * time.Hour,
+		WebFingerNegativeTTL:    time.Hour,
+		InboxDedupWindow:        10 * time.Minute,
+		InboxDedupSize:          10000,
+		MaxContextDepth:         40,
+		MaxContextFetches:       10,
+		TrendInterval:           5 * time.Minute,
+		TrendWindow:             7 * 24 * time.Hour,
+		TrendHalfLife:           12 * time.Hour,
+		MaxTrends:               20,
+		TombstonesGone:          true,
+		SignedDeliveries:        true,
+		RobotsTxt:               "User-agent: *\nDisallow: /api/\n",
+		CollectionPageSize:      20,
+	}
+}
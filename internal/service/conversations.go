@@ -0,0 +1,156 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// Conversation is a run of direct messages between the same people.
+type Conversation struct {
+	ID string
+	// Everyone in the conversation but the viewer.
+	Participants []*url.URL
+	LastStatus   vocab.Type
+	// Whether someone else has written since the viewer last read it.
+	Unread bool
+}
+
+// recipientsOf returns who `t` is addressed to, through `to` and `cc`.
+func recipientsOf(t vocab.Type) (recipients []*url.URL) {
+	if o, ok := t.(interface {
+		GetActivityStreamsTo() vocab.ActivityStreamsToProperty
+	}); ok && o.GetActivityStreamsTo() != nil {
+		for iter := o.GetActivityStreamsTo().Begin(); iter != o.GetActivityStreamsTo().End(); iter = iter.Next() {
+			if id, err := pub.ToId(iter); err == nil {
+				recipients = append(recipients, id)
+			}
+		}
+	}
+	if o, ok := t.(interface {
+		GetActivityStreamsCc() vocab.ActivityStreamsCcProperty
+	}); ok && o.GetActivityStreamsCc() != nil {
+		for iter := o.GetActivityStreamsCc().Begin(); iter != o.GetActivityStreamsCc().End(); iter = iter.Next() {
+			if id, err := pub.ToId(iter); err == nil {
+				recipients = append(recipients, id)
+			}
+		}
+	}
+	return
+}
+
+// isDirect reports whether `t` is addressed only to people: not to the
+// public nor to anyone's followers.
+func (s *Service) isDirect(c context.Context, t vocab.Type) bool {
+	recipients := recipientsOf(t)
+	if len(recipients) == 0 {
+		return false
+	}
+	for _, r := range recipients {
+		if r.String() == pub.PublicActivityPubIRI || strings.HasSuffix(r.Path, "/followers") {
+			return false
+		}
+		if s.isCollection(c, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// participants returns everyone taking part in `t` bar `actorIRI`, sorted.
+func participants(t vocab.Type, actorIRI *url.URL) []*url.URL {
+	seen := map[string]bool{actorIRI.String(): true}
+	var ps []*url.URL
+	for _, p := range append(authorsOf(t), recipientsOf(t)...) {
+		if !seen[p.String()] {
+			seen[p.String()] = true
+			ps = append(ps, p)
+		}
+	}
+	sort.Slice(ps, func(i, j int) bool { return ps[i].String() < ps[j].String() })
+	return ps
+}
+
+// conversationID names the conversation between `ps`.
+func conversationID(ps []*url.URL) string {
+	h := sha256.New()
+	for _, p := range ps {
+		h.Write([]byte(p.String()))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// Conversations groups the direct messages the local actor at `actorIRI`
+// sent and received by who they were with, most recently active first.
+func (s *Service) Conversations(c context.Context, actorIRI *url.URL) ([]Conversation, error) {
+	direct, err := s.timeline(c, actorIRI, TimeRange{}, math.MaxInt, func(o vocab.Type) bool {
+		return s.isDirect(c, o)
+	})
+	if err != nil {
+		return nil, err
+	}
+	var conversations []Conversation
+	index := make(map[string]int)
+	// Newest first, so the first of each conversation is its last status.
+	for _, o := range direct {
+		ps := participants(o, actorIRI)
+		id := conversationID(ps)
+		if _, ok := index[id]; ok {
+			continue
+		}
+		index[id] = len(conversations)
+		conversations = append(conversations, Conversation{
+			ID:           id,
+			Participants: ps,
+			LastStatus:   o,
+			Unread:       s.unread(actorIRI, id, o),
+		})
+	}
+	return conversations, nil
+}
+
+// unread reports whether `last`, the latest status of the conversation `id`,
+// is news to the local actor at `actorIRI`.
+func (s *Service) unread(actorIRI *url.URL, id string, last vocab.Type) bool {
+	for _, author := range authorsOf(last) {
+		if author.String() == actorIRI.String() {
+			return false
+		}
+	}
+	lastIRI, err := pub.GetId(last)
+	if err != nil {
+		return false
+	}
+	return s.db.ConversationRead(actorIRI, id) != lastIRI.String()
+}
+
+// MarkConversationRead marks the conversation `id` of the local actor at
+// `actorIRI` as read up to its latest status.
+func (s *Service) MarkConversationRead(c context.Context, actorIRI *url.URL, id string) (Conversation, error) {
+	conversations, err := s.Conversations(c, actorIRI)
+	if err != nil {
+		return Conversation{}, err
+	}
+	for _, conversation := range conversations {
+		if conversation.ID != id {
+			continue
+		}
+		if lastIRI, err := pub.GetId(conversation.LastStatus); err == nil {
+			s.db.SetConversationRead(actorIRI, id, lastIRI.String())
+		}
+		conversation.Unread = false
+		return conversation, nil
+	}
+	return Conversation{}, ErrNotFound
+}
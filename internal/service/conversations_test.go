@@ -0,0 +1,85 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-fed/activity/pub"
+)
+
+// messageBy returns a note by `p` at `id` addressed only to `to`.
+func messageBy(p *testPeer, id, published string, to ...string) map[string]interface{} {
+	note := postBy("Note", id, p.iri.String(), "")
+	note["published"] = published
+	recipients := make([]interface{}, len(to))
+	for i, r := range to {
+		recipients[i] = r
+	}
+	note["to"] = recipients
+	return note
+}
+
+func TestConversations(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	inboxIRI := s.boxIRI(aliceIRI, "inbox")
+	bob := newTestPeer(t, transport, "https://remote.test/users/bob", "rsa")
+	carol := newTestPeer(t, transport, "https://other.test/users/carol", "rsa")
+	following(t, s, aliceIRI, bob.iri)
+	following(t, s, aliceIRI, carol.iri)
+	deliver(t, s, bob, inboxIRI, creating(messageBy(bob, "https://remote.test/notes/1", "2026-10-16T12:01:00Z", aliceIRI.String())))
+	deliver(t, s, carol, inboxIRI, creating(messageBy(carol, "https://other.test/notes/1", "2026-10-16T12:02:00Z", aliceIRI.String(), bob.iri.String())))
+	deliver(t, s, bob, inboxIRI, creating(messageBy(bob, "https://remote.test/notes/2", "2026-10-16T12:03:00Z", aliceIRI.String())))
+	// Neither public nor followers-only posts are direct messages.
+	deliver(t, s, bob, inboxIRI, creating(messageBy(bob, "https://remote.test/notes/3", "2026-10-16T12:04:00Z", aliceIRI.String(), pub.PublicActivityPubIRI)))
+	deliver(t, s, bob, inboxIRI, creating(messageBy(bob, "https://remote.test/notes/4", "2026-10-16T12:05:00Z", aliceIRI.String(), bob.iri.String()+"/followers")))
+
+	conversations, err := s.Conversations(c, aliceIRI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conversations) != 2 {
+		t.Fatalf("%d conversations, want 2", len(conversations))
+	}
+	// Both of bob's messages make one conversation, the latest.
+	withBob, withBoth := conversations[0], conversations[1]
+	if len(withBob.Participants) != 1 || withBob.Participants[0].String() != bob.iri.String() {
+		t.Errorf("participants %v, want bob", withBob.Participants)
+	}
+	if id, _ := pub.GetId(withBob.LastStatus); id.String() != "https://remote.test/notes/2" || !withBob.Unread {
+		t.Errorf("conversation with bob last had %s, unread %t", id, withBob.Unread)
+	}
+	if len(withBoth.Participants) != 2 || withBoth.ID == withBob.ID {
+		t.Errorf("conversation with carol and bob %+v", withBoth)
+	}
+
+	read, err := s.MarkConversationRead(c, aliceIRI, withBob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.Unread {
+		t.Error("still unread once read")
+	}
+	if conversations, err = s.Conversations(c, aliceIRI); err != nil {
+		t.Fatal(err)
+	}
+	if conversations[0].Unread || !conversations[1].Unread {
+		t.Errorf("only the conversation read should be read: %t, %t", conversations[0].Unread, conversations[1].Unread)
+	}
+	// Until bob writes again.
+	deliver(t, s, bob, inboxIRI, creating(messageBy(bob, "https://remote.test/notes/5", "2026-10-16T12:06:00Z", aliceIRI.String())))
+	if conversations, err = s.Conversations(c, aliceIRI); err != nil {
+		t.Fatal(err)
+	}
+	if conversations[0].ID != withBob.ID || !conversations[0].Unread {
+		t.Errorf("conversation with bob after a new message %+v", conversations[0])
+	}
+
+	if _, err := s.MarkConversationRead(c, aliceIRI, "nothing"); err != ErrNotFound {
+		t.Errorf("marking an unknown conversation read: %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// dedupWindow remembers the deliveries we've recently taken in, so that a
+// peer redelivering one doesn't get it processed twice. It forgets them after
+// a while, and forgets the oldest early if it gets full.
+type dedupWindow struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+	// Keys in the order they were seen, for forgetting the oldest first.
+	order []string
+}
+
+// contains reports whether `key` was seen within `ttl` of `now`.
+func (d *dedupWindow) contains(key string, now time.Time, ttl time.Duration) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	at, ok := d.seen[key]
+	return ok && now.Sub(at) < ttl
+}
+
+// add records `key` as seen at `now`, first forgetting keys older than `ttl`
+// and, if there are `size` of them already, the oldest.
+func (d *dedupWindow) add(key string, now time.Time, ttl time.Duration, size int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.seen == nil {
+		d.seen = make(map[string]time.Time)
+	}
+	// Expire from the front, where the oldest keys are.
+	for len(d.order) > 0 {
+		oldest := d.order[0]
+		if at, ok := d.seen[oldest]; ok && now.Sub(at) < ttl && len(d.order) < size {
+			break
+		}
+		delete(d.seen, oldest)
+		d.order = d.order[1:]
+	}
+	if _, ok := d.seen[key]; ok {
+		return
+	}
+	d.seen[key] = now
+	d.order = append(d.order, key)
+}
+
+// deliveryKey identifies the activity POSTed in `r` to the inbox it was
+// POSTed to: the same activity may rightly be delivered to several of our
+// inboxes. The body is left for Go-Fed to read again. An empty key means the
+// activity has no id to go by.
+func deliveryKey(r *http.Request) (string, error) {
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		return "", err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(b))
+	var activity struct {
+		Id string `json:"id"`
+	}
+	if json.Unmarshal(b, &activity) != nil || activity.Id == "" {
+		return "", nil
+	}
+	return r.URL.Path + " " + activity.Id, nil
+}
+
+// statusRecorder notes the status of the response it writes.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// postInbox hands a delivery to Go-Fed, unless the same one was already
+// accepted recently, sparing us even looking at redeliveries. That is only
+// a window though: the inbox itself, through InboxContains, is what really
+// keeps duplicates out. Only accepted deliveries are remembered, so nobody
+// can get a real activity skipped by first sending a forged one.
+func (s *Service) postInbox(c context.Context, w http.ResponseWriter, r *http.Request) (bool, error) {
+	if s.config.InboxDedupWindow <= 0 {
+		return s.postInboxOnce(c, w, r)
+	}
+	key, err := deliveryKey(r)
+	if err != nil {
+		WriteError(w, &ParseError{err})
+		return true, nil
+	}
+	if key != "" && s.deliveries.contains(key, s.Now(), s.config.InboxDedupWindow) {
+		// Already got it: tell the peer so it stops retrying.
+		w.WriteHeader(http.StatusOK)
+		return true, nil
+	}
+	rec := &statusRecorder{ResponseWriter: w}
+	isAS, err := s.postInboxOnce(c, rec, r)
+	if err == nil && isAS && key != "" && rec.status >= 200 && rec.status < 300 {
+		s.deliveries.add(key, s.Now(), s.config.InboxDedupWindow, s.config.InboxDedupSize)
+	}
+	return isAS, err
+}
+
+// postInboxOnce hands a delivery to Go-Fed, answering for it if Go-Fed
+// stopped at a replayed Create.
+func (s *Service) postInboxOnce(c context.Context, w http.ResponseWriter, r *http.Request) (bool, error) {
+	isAS, err := s.actor.PostInbox(c, w, r)
+	if errors.Is(err, errReplayedCreate) {
+		w.WriteHeader(http.StatusOK)
+		return true, nil
+	}
+	return isAS, err
+}
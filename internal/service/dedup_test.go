@@ -0,0 +1,115 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDedupWindow(t *testing.T) {
+	var d dedupWindow
+	now := time.Now()
+	ttl := time.Minute
+
+	d.add("a", now, ttl, 2)
+	if !d.contains("a", now, ttl) {
+		t.Error("forgot a key just added")
+	}
+	if d.contains("a", now.Add(ttl), ttl) {
+		t.Error("remembered a key past its ttl")
+	}
+	if d.contains("b", now, ttl) {
+		t.Error("remembered a key never added")
+	}
+
+	// Full, the oldest goes first.
+	d.add("b", now.Add(time.Second), ttl, 2)
+	d.add("c", now.Add(2*time.Second), ttl, 2)
+	if d.contains("a", now.Add(2*time.Second), ttl) {
+		t.Error("kept the oldest key past the size")
+	}
+	for _, key := range []string{"b", "c"} {
+		if !d.contains(key, now.Add(2*time.Second), ttl) {
+			t.Errorf("forgot %s", key)
+		}
+	}
+
+	// Expired keys go before fresh ones are added.
+	d.add("d", now.Add(2*ttl), ttl, 2)
+	if len(d.seen) != 1 || len(d.order) != 1 {
+		t.Errorf("kept %d keys, want 1", len(d.seen))
+	}
+}
+
+func TestDeliveryKey(t *testing.T) {
+	body := `{"id":"https://remote.test/follows/1","type":"Follow"}`
+	inboxes := []string{"/users/alice/inbox", "/users/bob/inbox"}
+	var keys []string
+	for _, inbox := range inboxes {
+		r := httptest.NewRequest(http.MethodPost, inbox, strings.NewReader(body))
+		key, err := deliveryKey(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, key)
+		// Left for Go-Fed to read.
+		if b, _ := io.ReadAll(r.Body); string(b) != body {
+			t.Errorf("body left = %q, want %q", b, body)
+		}
+	}
+	if keys[0] == "" || keys[0] == keys[1] {
+		t.Errorf("keys = %q, want distinct ones for each inbox", keys)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, inboxes[0], strings.NewReader(`{"type":"Follow"}`))
+	if key, err := deliveryKey(r); err != nil || key != "" {
+		t.Errorf("deliveryKey of an activity without id = %q, %v", key, err)
+	}
+}
+
+func TestPostInboxDedup(t *testing.T) {
+	s, transport := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	inboxIRI := s.boxIRI(aliceIRI, "inbox")
+	bob := newTestPeer(t, transport, "https://remote.test/users/bob", "rsa")
+	mallory := newTestPeer(t, transport, "https://evil.test/users/mallory", "rsa")
+	follow := followBy(bob.iri.String(), aliceIRI.String())
+	key := inboxIRI.Path + " " + follow["id"].(string)
+
+	deliver := func(r *http.Request) int {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	// A forgery comes first, and isn't remembered.
+	forged := signedDelivery(t, mallory, inboxIRI, follow, false)
+	if code := deliver(forged); code >= 200 && code < 300 {
+		t.Fatalf("forged delivery got %d", code)
+	}
+	if s.deliveries.contains(key, s.Now(), s.config.InboxDedupWindow) {
+		t.Fatal("remembered a refused delivery")
+	}
+
+	// So the real one gets in, and is remembered.
+	if code := deliver(signedDelivery(t, bob, inboxIRI, follow, false)); code < 200 || code >= 300 {
+		t.Fatalf("delivery got %d", code)
+	}
+	if !s.deliveries.contains(key, s.Now(), s.config.InboxDedupWindow) {
+		t.Fatal("forgot an accepted delivery")
+	}
+
+	// A redelivery is acknowledged without being looked at, signature and
+	// all.
+	r := signedDelivery(t, bob, inboxIRI, follow, false)
+	r.Header.Set("Signature", "garbage")
+	if code := deliver(r); code != http.StatusOK {
+		t.Fatalf("redelivery got %d, want %d", code, http.StatusOK)
+	}
+}
@@ -0,0 +1,313 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/url"
+	"sync"
+	"time"
+
+	"mastogon/internal/db"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+)
+
+// deliveryQueue hands deliveries to a pool of workers, so that shutting down
+// can let them finish instead of cutting them off.
+type deliveryQueue struct {
+	// Guards closing `jobs` against sends to it. Senders share it, and
+	// Shutdown closes `stop` to free any waiting on a full queue before it
+	// takes it to close `jobs`.
+	mu       sync.RWMutex
+	jobs     chan db.Delivery
+	closed   bool
+	stop     chan struct{}
+	stopping sync.Once
+	workers  sync.WaitGroup
+	// Cancelled once the grace period for draining is over, failing any
+	// delivery still in flight.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// queuedTransport is a Transport whose deliveries go through the delivery
+// queue, when it's running, and to shared inboxes where peers have them.
+// What's ours it reads from the database: Go-Fed fetches our followers
+// collection to deliver to them, and we only serve it paged, which Go-Fed
+// doesn't follow, or not at all when it's hidden.
+type queuedTransport struct {
+	pub.Transport
+	s    *Service
+	from *url.URL
+	// Whether Go-Fed made it, to find the inboxes of who it delivers or
+	// forwards to.
+	resolving bool
+}
+
+func (t *queuedTransport) Dereference(c context.Context, iri *url.URL) ([]byte, error) {
+	if owns, err := t.s.db.Owns(c, iri); err == nil && owns {
+		if v, err := t.s.db.Get(c, iri); err == nil {
+			m, err := streams.Serialize(v)
+			if err != nil {
+				return nil, err
+			}
+			return json.Marshal(m)
+		}
+	}
+	b, err := t.Transport.Dereference(c, iri)
+	if err != nil {
+		return nil, err
+	}
+	t.s.noteSharedInbox(b)
+	if t.resolving && t.s.config.MaxDeliveryDepth <= 1 {
+		// Go-Fed looks as deep into peers' collections as into ours, which
+		// it must to reach our followers.
+		b = withoutMembers(b)
+	}
+	return b, nil
+}
+
+// withoutMembers returns the document `b` without the items it has if it's
+// a collection, so Go-Fed won't deliver to them: a peer's followers are
+// theirs to deliver to.
+func withoutMembers(b []byte) []byte {
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return b
+	}
+	_, items := m["items"]
+	_, orderedItems := m["orderedItems"]
+	if !items && !orderedItems {
+		return b
+	}
+	delete(m, "items")
+	delete(m, "orderedItems")
+	if stripped, err := json.Marshal(m); err == nil {
+		return stripped
+	}
+	return b
+}
+
+func (t *queuedTransport) Deliver(c context.Context, b []byte, to *url.URL) error {
+	b = t.s.withLDSignature(c, t.from, withLDContextJSON(b))
+	if t.s.enqueue(db.Delivery{From: t.from, To: to, Body: b}) {
+		return nil
+	}
+	return t.Transport.Deliver(c, b, to)
+}
+
+func (t *queuedTransport) BatchDeliver(c context.Context, b []byte, recipients []*url.URL) error {
+	b = t.s.withLDSignature(c, t.from, withLDContextJSON(b))
+	var rest []*url.URL
+	for _, to := range t.s.withSharedInboxes(c, b, recipients) {
+		if !t.s.enqueue(db.Delivery{From: t.from, To: to, Body: b}) {
+			rest = append(rest, to)
+		}
+	}
+	if len(rest) == 0 {
+		return nil
+	}
+	return t.Transport.BatchDeliver(c, b, rest)
+}
+
+// StartDelivery starts Config.DeliveryWorkers workers delivering our
+// activities in the background, beginning with any left over from the last
+// shutdown. Until it's called, deliveries are made as they are sent.
+func (s *Service) StartDelivery() {
+	q := &s.delivery
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.jobs != nil {
+		return
+	}
+	pending := s.db.TakePendingDeliveries()
+	q.jobs = make(chan db.Delivery, len(pending)+deliveryBuffer)
+	q.stop = make(chan struct{})
+	q.ctx, q.cancel = context.WithCancel(context.Background())
+	for _, d := range pending {
+		q.jobs <- d
+	}
+	for i := 0; i < s.config.DeliveryWorkers; i++ {
+		q.workers.Add(1)
+		go s.deliveryWorker()
+	}
+}
+
+// How many deliveries may wait for a worker before senders have to.
+const deliveryBuffer = 256
+
+// How many times we try a delivery before giving up on it, and how long we
+// wait before the first retry. Each retry waits four times as long as the
+// one before, so the last is about three days after the first failure.
+const (
+	maxDeliveryAttempts = 8
+	deliveryRetryDelay  = time.Minute
+)
+
+// The kind of the stored jobs retrying deliveries.
+const deliveryRetryJob = "delivery-retry"
+
+// enqueue queues `d` for delivery, and reports whether it could. If the
+// queue is full it waits for room, unless we start shutting down meanwhile,
+// in which case `d` is kept for the next start.
+func (s *Service) enqueue(d db.Delivery) bool {
+	q := &s.delivery
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.jobs == nil || q.closed {
+		return false
+	}
+	select {
+	case q.jobs <- d:
+	case <-q.stop:
+		s.db.SavePendingDeliveries([]db.Delivery{d})
+	}
+	return true
+}
+
+func (s *Service) deliveryWorker() {
+	q := &s.delivery
+	defer q.workers.Done()
+	for d := range q.jobs {
+		s.deliverOrRetry(db.WithLockHolder(q.ctx), d)
+	}
+}
+
+// deliverOrRetry makes `d`, and if that fails, schedules it to be tried
+// again later, unless the peer refused it or we've tried it too many times
+// already. One cut off by shutdown is kept for the next start instead.
+func (s *Service) deliverOrRetry(c context.Context, d db.Delivery) {
+	err := s.deliver(c, d)
+	switch {
+	case err == nil:
+	case c.Err() != nil:
+		s.db.SavePendingDeliveries([]db.Delivery{d})
+	case errors.Is(err, errDeliveryRefused):
+		log.Printf("delivering to %s: %s", d.To, err)
+	case d.Attempts+1 >= maxDeliveryAttempts:
+		log.Printf("giving up delivering to %s after %d attempts: %s", d.To, d.Attempts+1, err)
+	default:
+		d.Attempts++
+		payload, _ := json.Marshal(retriedDelivery{d.From.String(), d.To.String(), d.Body, d.Attempts})
+		s.ScheduleJob(deliveryRetryJob, string(payload), s.Now().Add(deliveryRetryDelay<<(2*(d.Attempts-1))))
+	}
+}
+
+// retriedDelivery is a delivery as its retry job stores it.
+type retriedDelivery struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Body     []byte `json:"body"`
+	Attempts int    `json:"attempts"`
+}
+
+// retryDelivery handles the jobs deliverOrRetry schedules.
+func (s *Service) retryDelivery(c context.Context, payload string) error {
+	d, err := retriedDeliveryOf(payload)
+	if err != nil {
+		return err
+	}
+	s.deliverOrRetry(c, d)
+	return nil
+}
+
+// retriedDeliveryOf reads the delivery in the payload of a retry job.
+func retriedDeliveryOf(payload string) (db.Delivery, error) {
+	var r retriedDelivery
+	if err := json.Unmarshal([]byte(payload), &r); err != nil {
+		return db.Delivery{}, err
+	}
+	from, err := url.Parse(r.From)
+	if err != nil {
+		return db.Delivery{}, err
+	}
+	to, err := url.Parse(r.To)
+	if err != nil {
+		return db.Delivery{}, err
+	}
+	return db.Delivery{From: from, To: to, Body: r.Body, Attempts: r.Attempts}, nil
+}
+
+// deliver makes `d` straight away.
+func (s *Service) deliver(c context.Context, d db.Delivery) error {
+	t, err := s.NewTransport(c, d.From, "")
+	if err != nil {
+		return err
+	}
+	return t.(*queuedTransport).Transport.Deliver(c, d.Body, d.To)
+}
+
+// Shutdown stops taking deliveries to our inboxes, computing trends,
+// posting scheduled statuses and the rest of our background work, and gives
+// it and the delivery workers until `c` is done to finish. Whatever they
+// couldn't deliver by then is saved in the database for the next start.
+func (s *Service) Shutdown(c context.Context) error {
+	s.draining.Store(true)
+	s.SetReady(false)
+	s.stopTrends()
+	s.stopScheduler()
+	s.stopJobs(c)
+	q := &s.delivery
+	q.mu.RLock()
+	started := q.jobs != nil
+	q.mu.RUnlock()
+	if !started {
+		return nil
+	}
+	q.stopping.Do(func() { close(q.stop) })
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return nil
+	}
+	q.closed = true
+	close(q.jobs)
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		q.cancel()
+		return nil
+	case <-c.Done():
+	}
+	// Out of time: fail what's in flight, and save it and what's left.
+	q.cancel()
+	var left []db.Delivery
+	for d := range q.jobs {
+		left = append(left, d)
+	}
+	s.db.SavePendingDeliveries(left)
+	<-done
+	return c.Err()
+}
+
+// TakeUndelivered returns and forgets, once the service is shut down, all it
+// still had to deliver: what Shutdown saved, and what was waiting to be
+// retried. It's for keeping them somewhere outliving the database, to be
+// given back with SavePendingDeliveries before the next StartDelivery.
+func (s *Service) TakeUndelivered() []db.Delivery {
+	deliveries := s.db.TakePendingDeliveries()
+	for _, j := range s.db.Jobs() {
+		if j.Kind != deliveryRetryJob || !s.db.TakeJob(j.ID) {
+			continue
+		}
+		d, err := retriedDeliveryOf(j.Payload)
+		if err != nil {
+			log.Printf("dropping delivery retry job %s: %s", j.ID, err)
+			continue
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries
+}
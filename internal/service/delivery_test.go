@@ -0,0 +1,284 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"mastogon/internal/db"
+)
+
+func TestPendingDeliveriesSurviveShutdown(t *testing.T) {
+	s, _ := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	// No workers, so everything queued is still there at shutdown.
+	s.config.DeliveryWorkers = 0
+	s.StartDelivery()
+	want := []db.Delivery{
+		{From: s.boxIRI(aliceIRI, "outbox"), To: mustParse(t, "https://remote.test/users/bob/inbox"), Body: []byte(`{"n":1}`)},
+		{From: s.boxIRI(aliceIRI, "outbox"), To: mustParse(t, "https://remote.test/users/carol/inbox"), Body: []byte(`{"n":2}`)},
+	}
+	for _, d := range want {
+		if !s.enqueue(d) {
+			t.Fatal("couldn't queue a delivery")
+		}
+	}
+	c, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.Shutdown(c); err == nil {
+		t.Fatal("Shutdown finished deliveries it had no workers for")
+	}
+	if s.enqueue(want[0]) {
+		t.Fatal("queued a delivery after shutting down")
+	}
+
+	// The next start, over the same database, makes them.
+	config := DefaultConfig()
+	// One worker, so they go out in order.
+	config.DeliveryWorkers = 1
+	restarted := &Service{}
+	restarted.Construct(s.db, config)
+	transport := &FakeTransport{}
+	restarted.SetTransport(transport)
+	restarted.StartDelivery()
+	if err := restarted.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	delivered := transport.Delivered()
+	if len(delivered) != len(want) {
+		t.Fatalf("delivered %d activities, want %d", len(delivered), len(want))
+	}
+	for i, d := range delivered {
+		if d.To.String() != want[i].To.String() || string(d.Body) != string(want[i].Body) {
+			t.Errorf("delivered %s to %s, want %s to %s", d.Body, d.To, want[i].Body, want[i].To)
+		}
+	}
+	if left := s.db.TakePendingDeliveries(); len(left) != 0 {
+		t.Errorf("%d deliveries left pending", len(left))
+	}
+}
+
+// Senders waiting on a full queue don't hold up shutting down, and what
+// they were sending is kept for the next start.
+func TestEnqueueFullQueueAtShutdown(t *testing.T) {
+	s, _ := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	// No workers, so nothing frees up room.
+	s.config.DeliveryWorkers = 0
+	s.StartDelivery()
+	d := db.Delivery{From: s.boxIRI(aliceIRI, "outbox"), To: mustParse(t, "https://remote.test/users/bob/inbox"), Body: []byte(`{}`)}
+	for i := 0; i < deliveryBuffer; i++ {
+		if !s.enqueue(d) {
+			t.Fatal("couldn't queue a delivery")
+		}
+	}
+	const waiting = 3
+	var wg sync.WaitGroup
+	var queued atomic.Int32
+	for i := 0; i < waiting; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Those not yet waiting when shutdown starts are refused, to be
+			// made straight away.
+			if s.enqueue(d) {
+				queued.Add(1)
+			}
+		}()
+	}
+	// Let them start waiting.
+	time.Sleep(50 * time.Millisecond)
+
+	shutDown := make(chan error)
+	go func() {
+		c, cancel := context.WithCancel(context.Background())
+		cancel()
+		shutDown <- s.Shutdown(c)
+	}()
+	select {
+	case <-shutDown:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Shutdown waited on senders to a full queue")
+	}
+	wg.Wait()
+	if left, want := s.db.TakePendingDeliveries(), deliveryBuffer+int(queued.Load()); len(left) != want {
+		t.Errorf("%d deliveries kept, want %d", len(left), want)
+	}
+}
+
+// unreliableTransport fails deliveries with `err` while it's set.
+type unreliableTransport struct {
+	*FakeTransport
+	mu  sync.Mutex
+	err error
+}
+
+func (t *unreliableTransport) Deliver(c context.Context, b []byte, to *url.URL) error {
+	t.mu.Lock()
+	err := t.err
+	t.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return t.FakeTransport.Deliver(c, b, to)
+}
+
+func (t *unreliableTransport) fail(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.err = err
+}
+
+func TestFailedDeliveriesRetried(t *testing.T) {
+	c := context.Background()
+	s, fake := newTestService(t)
+	clock := &testClock{now: time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)}
+	s.SetClock(clock)
+	transport := &unreliableTransport{FakeTransport: fake}
+	s.SetTransport(transport)
+	aliceIRI := register(t, s, "alice")
+	d := db.Delivery{From: s.boxIRI(aliceIRI, "outbox"), To: mustParse(t, "https://remote.test/users/bob/inbox"), Body: []byte(`{"n":1}`)}
+	// retries returns the retries scheduled, taking them from the database.
+	retries := func() (jobs []*db.Job) {
+		for _, j := range s.db.Jobs() {
+			if j.Kind == deliveryRetryJob && s.db.TakeJob(j.ID) {
+				jobs = append(jobs, j)
+			}
+		}
+		return
+	}
+
+	transport.fail(errors.New("connection refused"))
+	s.deliverOrRetry(c, d)
+	jobs := retries()
+	if len(jobs) != 1 {
+		t.Fatalf("%d retries scheduled, want 1", len(jobs))
+	}
+	if want := clock.Now().Add(deliveryRetryDelay); !jobs[0].At.Equal(want) {
+		t.Errorf("retrying at %v, want %v", jobs[0].At, want)
+	}
+	// Failing again, it's retried later still.
+	if err := s.retryDelivery(c, jobs[0].Payload); err != nil {
+		t.Fatal(err)
+	}
+	if jobs = retries(); len(jobs) != 1 || !jobs[0].At.Equal(clock.Now().Add(4*deliveryRetryDelay)) {
+		t.Fatalf("retries %v, want one in %s", jobs, 4*deliveryRetryDelay)
+	}
+	// Once the peer is back, it's made.
+	transport.fail(nil)
+	if err := s.retryDelivery(c, jobs[0].Payload); err != nil {
+		t.Fatal(err)
+	}
+	if delivered := fake.Delivered(); len(delivered) != 1 || string(delivered[0].Body) != `{"n":1}` {
+		t.Errorf("delivered %v, want the retried delivery", delivered)
+	}
+	if jobs = retries(); len(jobs) != 0 {
+		t.Errorf("%d retries scheduled after it was made", len(jobs))
+	}
+
+	t.Run("refused", func(t *testing.T) {
+		transport.fail(fmt.Errorf("POST request to %s failed (403): %w", d.To, errDeliveryRefused))
+		s.deliverOrRetry(c, d)
+		if jobs := retries(); len(jobs) != 0 {
+			t.Errorf("%d retries scheduled of a delivery the peer refused", len(jobs))
+		}
+	})
+
+	t.Run("too many attempts", func(t *testing.T) {
+		transport.fail(errors.New("connection refused"))
+		last := d
+		last.Attempts = maxDeliveryAttempts - 1
+		s.deliverOrRetry(c, last)
+		if jobs := retries(); len(jobs) != 0 {
+			t.Errorf("%d retries scheduled after %d attempts", len(jobs), maxDeliveryAttempts)
+		}
+	})
+}
+
+// Once shut down, what's left to deliver, queued or waiting to be retried,
+// can be taken out of the database to outlive it.
+func TestTakeUndelivered(t *testing.T) {
+	s, fake := newTestService(t)
+	transport := &unreliableTransport{FakeTransport: fake}
+	s.SetTransport(transport)
+	aliceIRI := register(t, s, "alice")
+	s.config.DeliveryWorkers = 0
+	s.StartDelivery()
+	queued := db.Delivery{From: s.boxIRI(aliceIRI, "outbox"), To: mustParse(t, "https://remote.test/users/bob/inbox"), Body: []byte(`{"n":1}`)}
+	if !s.enqueue(queued) {
+		t.Fatal("couldn't queue a delivery")
+	}
+	transport.fail(errors.New("connection refused"))
+	retried := db.Delivery{From: s.boxIRI(aliceIRI, "outbox"), To: mustParse(t, "https://remote.test/users/carol/inbox"), Body: []byte(`{"n":2}`)}
+	s.deliverOrRetry(context.Background(), retried)
+	c, cancel := context.WithCancel(context.Background())
+	cancel()
+	s.Shutdown(c)
+
+	left := s.TakeUndelivered()
+	if len(left) != 2 {
+		t.Fatalf("%d deliveries left, want 2", len(left))
+	}
+	for i, want := range []db.Delivery{queued, {To: retried.To, Body: retried.Body, Attempts: 1}} {
+		if left[i].To.String() != want.To.String() || string(left[i].Body) != string(want.Body) || left[i].Attempts != want.Attempts {
+			t.Errorf("left %s to %s after %d attempts, want %s to %s after %d", left[i].Body, left[i].To, left[i].Attempts, want.Body, want.To, want.Attempts)
+		}
+	}
+	if again := s.TakeUndelivered(); len(again) != 0 {
+		t.Errorf("%d deliveries left once taken", len(again))
+	}
+}
+
+func TestDeliveryDoesNotExpandPeersCollections(t *testing.T) {
+	s, transport := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	s.db.SetToken("alice-token", aliceIRI)
+	followersIRI := s.boxIRI(aliceIRI, "followers")
+	carol := newTestPeer(t, transport, "https://remote.test/users/carol", "rsa")
+	dave := newTestPeer(t, transport, "https://other.test/users/dave", "rsa")
+	erin := newTestPeer(t, transport, "https://third.test/users/erin", "rsa")
+	follow(t, s, aliceIRI, erin.iri)
+	respondLocally(t, s, transport, followersIRI)
+	// dave follows carol, whose followers alice copies.
+	carolFollowers := carol.iri.String() + "/followers"
+	respondJSON(t, transport, carolFollowers, map[string]interface{}{
+		"@context":   "https://www.w3.org/ns/activitystreams",
+		"id":         carolFollowers,
+		"type":       "OrderedCollection",
+		"totalItems": 1,
+		"orderedItems": []interface{}{
+			dave.iri.String(),
+		},
+	})
+
+	w := postToOutbox(t, s, aliceIRI.String(), "alice-token", map[string]interface{}{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"type":     "Note",
+		"content":  "<p>hello</p>",
+		"to":       []interface{}{carol.iri.String(), followersIRI.String()},
+		"cc":       carolFollowers,
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("posting a Note: %d %s", w.Code, w.Body)
+	}
+	var delivered []string
+	for _, d := range transport.Delivered() {
+		delivered = append(delivered, d.To.String())
+	}
+	sort.Strings(delivered)
+	// Our own followers are expanded, carol's are hers to deliver to.
+	if want := []string{carol.iri.String() + "/inbox", erin.iri.String() + "/inbox"}; !reflect.DeepEqual(delivered, want) {
+		t.Errorf("delivered to %v, want %v", delivered, want)
+	}
+}
@@ -0,0 +1,81 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// How the profile directory may be ordered.
+const (
+	// Those who posted most recently first.
+	DirectoryActive = "active"
+	// Those who joined most recently first.
+	DirectoryNew = "new"
+)
+
+// Directory lists our local actors who are discoverable, in `order`, one of
+// the Directory constants, for people looking for whom to follow. Accounts
+// awaiting approval and suspended ones aren't listed.
+func (s *Service) Directory(c context.Context, order string) ([]*url.URL, error) {
+	type entry struct {
+		actorIRI           *url.URL
+		joined, lastPosted time.Time
+	}
+	var entries []entry
+	for _, account := range s.db.Accounts() {
+		if !account.Confirmed || s.db.IsSuspended(account.ActorIRI) {
+			continue
+		}
+		t, err := s.db.Get(c, account.ActorIRI)
+		if err != nil || !Discoverable(t) {
+			continue
+		}
+		e := entry{actorIRI: account.ActorIRI, joined: published(t)}
+		if order != DirectoryNew {
+			e.lastPosted = s.lastPosted(c, account.ActorIRI)
+		}
+		entries = append(entries, e)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if order != DirectoryNew && !entries[i].lastPosted.Equal(entries[j].lastPosted) {
+			return entries[i].lastPosted.After(entries[j].lastPosted)
+		}
+		return entries[i].joined.After(entries[j].joined)
+	})
+	actorIRIs := make([]*url.URL, len(entries))
+	for i, e := range entries {
+		actorIRIs[i] = e.actorIRI
+	}
+	return actorIRIs, nil
+}
+
+// lastPosted returns when the local actor at `actorIRI` last sent anything,
+// going by the newest activity in their outbox, or the zero time if never.
+func (s *Service) lastPosted(c context.Context, actorIRI *url.URL) time.Time {
+	t, err := s.db.Get(c, s.boxIRI(actorIRI, "outbox"))
+	if err != nil {
+		return time.Time{}
+	}
+	outbox, ok := t.(vocab.ActivityStreamsOrderedCollection)
+	if !ok || outbox.GetActivityStreamsOrderedItems() == nil || outbox.GetActivityStreamsOrderedItems().Len() == 0 {
+		return time.Time{}
+	}
+	// Newest first.
+	id, err := pub.ToId(outbox.GetActivityStreamsOrderedItems().At(0))
+	if err != nil {
+		return time.Time{}
+	}
+	activity, err := s.db.Get(c, id)
+	if err != nil {
+		return time.Time{}
+	}
+	return published(activity)
+}
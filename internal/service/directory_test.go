@@ -0,0 +1,68 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDirectory(t *testing.T) {
+	c := context.Background()
+	s, _ := newTestService(t)
+	clock := &testClock{now: time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)}
+	s.SetClock(clock)
+	actors := make(map[string]*url.URL)
+	// They join in this order, and all but dave opt in.
+	for _, username := range []string{"alice", "bob", "carol", "dave"} {
+		actors[username] = register(t, s, username)
+		clock.Advance(time.Hour)
+		if username == "dave" {
+			continue
+		}
+		discoverable := true
+		if err := s.UpdateCredentials(c, actors[username], CredentialsParams{Discoverable: &discoverable}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// bob never posts, dave posts last.
+	for _, username := range []string{"carol", "alice", "dave"} {
+		clock.Advance(time.Hour)
+		if _, err := s.PostStatus(c, actors[username], StatusParams{Status: "hello", Visibility: VisibilityPublic}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	directory := func(order string) []string {
+		t.Helper()
+		actorIRIs, err := s.Directory(c, order)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var usernames []string
+		for _, actorIRI := range actorIRIs {
+			for username, iri := range actors {
+				if iri.String() == actorIRI.String() {
+					usernames = append(usernames, username)
+				}
+			}
+		}
+		return usernames
+	}
+
+	if got, want := directory(DirectoryActive), []string{"alice", "carol", "bob"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("most active first: %v, want %v", got, want)
+	}
+	if got, want := directory(DirectoryNew), []string{"carol", "bob", "alice"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("newest first: %v, want %v", got, want)
+	}
+
+	// Nor are suspended accounts listed.
+	s.Suspend(c, actors["carol"])
+	if got, want := directory(DirectoryActive), []string{"alice", "bob"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("with carol suspended: %v, want %v", got, want)
+	}
+}
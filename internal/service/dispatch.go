@@ -0,0 +1,70 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"reflect"
+	"runtime"
+	"strings"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// The activities Go-Fed handles itself unless we supply our own callback,
+// in FederatingWrappedCallbacks.
+var wrappedCallbacks = map[string]bool{
+	"Create": true, "Update": true, "Delete": true, "Follow": true,
+	"Accept": true, "Reject": true, "Add": true, "Remove": true,
+	"Like": true, "Announce": true, "Undo": true, "Block": true,
+}
+
+// InboundCallback parses the serialized activity `m` as it would arrive in an
+// inbox and names the callback it would be dispatched to, without running
+// it: one of ours from FederatingCallbacks by its method name, such as
+// "add", Go-Fed's default by the activity type, such as "Create", or
+// "DefaultCallback". EmojiReacts, and Undos of them, never reach Go-Fed:
+// they're "postEmojiReact"'s. It lets deliveries captured from peers be checked
+// against our dispatching in isolation.
+func (s *Service) InboundCallback(c context.Context, m map[string]interface{}) (string, error) {
+	undone, _ := m["object"].(map[string]interface{})
+	if m["type"] == "EmojiReact" || m["type"] == "Undo" && undone != nil && undone["type"] == "EmojiReact" {
+		return "postEmojiReact", nil
+	}
+	t, err := streams.ToType(c, m)
+	if err != nil {
+		return "", err
+	}
+	return s.callbackFor(c, t)
+}
+
+// callbackFor names the callback the activity `t` would be dispatched to.
+func (s *Service) callbackFor(c context.Context, t vocab.Type) (string, error) {
+	_, other, err := s.FederatingCallbacks(c)
+	if err != nil {
+		return "", err
+	}
+	// Like Go-Fed, the first of ours taking `t` wins.
+	for _, f := range other {
+		ft := reflect.TypeOf(f)
+		if ft.Kind() != reflect.Func || ft.NumIn() != 2 {
+			continue
+		}
+		if reflect.TypeOf(t).Implements(ft.In(1)) {
+			return funcName(f), nil
+		}
+	}
+	if wrappedCallbacks[t.GetTypeName()] {
+		return t.GetTypeName(), nil
+	}
+	return "DefaultCallback", nil
+}
+
+// funcName returns the bare name of the function or method value `f`.
+func funcName(f interface{}) string {
+	name := runtime.FuncForPC(reflect.ValueOf(f).Pointer()).Name()
+	name = strings.TrimSuffix(name, "-fm")
+	return name[strings.LastIndex(name, ".")+1:]
+}
@@ -0,0 +1,97 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"net/url"
+
+	"mastogon/internal/db"
+
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// Drafts are kept apart from everything ActivityPub: they're not objects, get
+// no IRI and so can't end up in a collection, a timeline or a delivery until
+// they're published.
+
+// CreateDraft saves a new draft for the local actor at `actorIRI`. Drafts
+// may break the limits statuses are held to, until they're published.
+func (s *Service) CreateDraft(c context.Context, actorIRI *url.URL, params StatusParams) *db.Draft {
+	now := s.Now()
+	d := &db.Draft{
+		Owner:     actorIRI,
+		Status:    params.Status,
+		Language:  params.Language,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	s.db.CreateDraft(d)
+	return d
+}
+
+// Draft returns the draft with `id`, if the local actor at `actorIRI` wrote
+// it.
+func (s *Service) Draft(c context.Context, actorIRI *url.URL, id string) (*db.Draft, error) {
+	d, err := s.db.Draft(id)
+	if err != nil || d.Owner.String() != actorIRI.String() {
+		return nil, ErrNotFound
+	}
+	return d, nil
+}
+
+// Drafts returns the drafts of the local actor at `actorIRI`, most recently
+// saved first.
+func (s *Service) Drafts(c context.Context, actorIRI *url.URL) []*db.Draft {
+	return s.db.Drafts(actorIRI)
+}
+
+// UpdateDraft saves new contents for a draft.
+func (s *Service) UpdateDraft(c context.Context, actorIRI *url.URL, id string, params StatusParams) (*db.Draft, error) {
+	d, err := s.Draft(c, actorIRI, id)
+	if err != nil {
+		return nil, err
+	}
+	updated := *d
+	updated.Status = params.Status
+	updated.Language = params.Language
+	updated.UpdatedAt = s.Now()
+	s.db.UpdateDraft(&updated)
+	return &updated, nil
+}
+
+// DeleteDraft throws a draft away.
+func (s *Service) DeleteDraft(c context.Context, actorIRI *url.URL, id string) error {
+	if _, err := s.Draft(c, actorIRI, id); err != nil {
+		return err
+	}
+	if !s.db.TakeDraft(id) {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// PublishDraft posts a draft as a status, which federates as usual, and
+// deletes the draft. A draft breaking the limits on statuses is kept.
+func (s *Service) PublishDraft(c context.Context, actorIRI *url.URL, id string) (vocab.ActivityStreamsNote, error) {
+	d, err := s.Draft(c, actorIRI, id)
+	if err != nil {
+		return nil, err
+	}
+	params := StatusParams{Status: d.Status, Language: d.Language}
+	if err := s.validateStatus(params); err != nil {
+		return nil, err
+	}
+	if !s.db.TakeDraft(id) {
+		// Published or deleted meanwhile.
+		return nil, ErrNotFound
+	}
+	note, err := s.PostStatus(c, actorIRI, params)
+	if err != nil {
+		// Don't lose their work.
+		s.db.UpdateDraft(d)
+		return nil, err
+	}
+	return note, nil
+}
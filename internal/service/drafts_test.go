@@ -0,0 +1,101 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDraftLifecycle(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	clock := &testClock{now: time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)}
+	s.SetClock(clock)
+	aliceIRI := register(t, s, "alice")
+	bobIRI := register(t, s, "bob")
+	respondLocally(t, s, transport, s.boxIRI(aliceIRI, "followers"))
+	carol := newTestPeer(t, transport, "https://remote.test/users/carol", "rsa")
+	follow(t, s, aliceIRI, carol.iri)
+
+	first := s.CreateDraft(c, aliceIRI, StatusParams{Status: "first thoughts"})
+	clock.Advance(time.Minute)
+	second := s.CreateDraft(c, aliceIRI, StatusParams{Status: "second thoughts"})
+	clock.Advance(time.Minute)
+	updated, err := s.UpdateDraft(c, aliceIRI, first.ID, StatusParams{Status: "better thoughts", Language: "en"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Status != "better thoughts" || !updated.UpdatedAt.Equal(clock.Now()) || !updated.CreatedAt.Equal(first.CreatedAt) {
+		t.Errorf("updated draft %+v", updated)
+	}
+	if drafts := s.Drafts(c, aliceIRI); len(drafts) != 2 || drafts[0].ID != first.ID || drafts[1].ID != second.ID {
+		t.Errorf("drafts %+v, want the one saved last first", drafts)
+	}
+
+	// Nobody else sees them, they're not in any timeline and nothing is
+	// delivered.
+	if _, err := s.Draft(c, bobIRI, first.ID); err != ErrNotFound {
+		t.Errorf("bob got alice's draft: %v", err)
+	}
+	if _, err := s.UpdateDraft(c, bobIRI, first.ID, StatusParams{Status: "mine now"}); err != ErrNotFound {
+		t.Errorf("bob updated alice's draft: %v", err)
+	}
+	if err := s.DeleteDraft(c, bobIRI, first.ID); err != ErrNotFound {
+		t.Errorf("bob deleted alice's draft: %v", err)
+	}
+	if drafts := s.Drafts(c, bobIRI); len(drafts) != 0 {
+		t.Errorf("bob's drafts %+v", drafts)
+	}
+	home, err := s.HomeTimeline(c, aliceIRI, TimeRange{}, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(home) != 0 {
+		t.Errorf("home timeline %v with only drafts", typesOf(home))
+	}
+	if delivered := transport.Delivered(); len(delivered) != 0 {
+		t.Errorf("delivered %d drafts", len(delivered))
+	}
+
+	note, err := s.PublishDraft(c, aliceIRI, first.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := note.GetActivityStreamsContent().At(0).GetXMLSchemaString(); !strings.Contains(got, "better thoughts") {
+		t.Errorf("published %q", got)
+	}
+	if delivered := transport.Delivered(); len(delivered) != 1 || delivered[0].To.String() != carol.iri.String()+"/inbox" {
+		t.Errorf("delivered %+v once published, want it sent to carol", delivered)
+	}
+	if _, err := s.Draft(c, aliceIRI, first.ID); err != ErrNotFound {
+		t.Errorf("draft still there once published: %v", err)
+	}
+	if _, err := s.PublishDraft(c, aliceIRI, first.ID); err != ErrNotFound {
+		t.Errorf("published a draft twice: %v", err)
+	}
+
+	if err := s.DeleteDraft(c, aliceIRI, second.ID); err != nil {
+		t.Fatal(err)
+	}
+	if drafts := s.Drafts(c, aliceIRI); len(drafts) != 0 {
+		t.Errorf("drafts %+v once published and deleted", drafts)
+	}
+}
+
+func TestPublishDraftTooLong(t *testing.T) {
+	c := context.Background()
+	s, _ := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	// Drafts may run long, but they must be cut down to be published.
+	d := s.CreateDraft(c, aliceIRI, StatusParams{Status: strings.Repeat("x", s.config.MaxNoteChars+1)})
+	if _, err := s.PublishDraft(c, aliceIRI, d.ID); err == nil {
+		t.Fatal("published an overlong draft")
+	}
+	if _, err := s.Draft(c, aliceIRI, d.ID); err != nil {
+		t.Errorf("lost the overlong draft: %s", err)
+	}
+}
@@ -0,0 +1,212 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+
+	"mastogon/internal/db"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// Misskey and Pleroma let people react to posts with an emoji. Pleroma sends
+// an EmojiReact, a type of its own that Go-Fed can't parse, so we take those
+// before Go-Fed sees the delivery; Misskey sends a Like with the emoji as
+// its content, which Go-Fed handles as any Like before we note the emoji.
+
+// EmojiReactionCount is how many reacted to an object with an emoji, and who.
+type EmojiReactionCount struct {
+	Emoji  string
+	Count  int
+	Actors []*url.URL
+}
+
+// EmojiReactions counts the emoji reactions to the object at `iri`, most
+// used first.
+func (s *Service) EmojiReactions(c context.Context, iri *url.URL) ([]EmojiReactionCount, error) {
+	if exists, err := s.db.Exists(c, iri); err != nil || !exists {
+		return nil, ErrNotFound
+	}
+	var counts []EmojiReactionCount
+	index := make(map[string]int)
+	for _, r := range s.db.EmojiReactions(iri) {
+		i, ok := index[r.Emoji]
+		if !ok {
+			i = len(counts)
+			index[r.Emoji] = i
+			counts = append(counts, EmojiReactionCount{Emoji: r.Emoji})
+		}
+		counts[i].Count++
+		counts[i].Actors = append(counts[i].Actors, r.Actor)
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Emoji < counts[j].Emoji
+	})
+	return counts, nil
+}
+
+// liked runs after Go-Fed's default handling of a Like, meeting whoever
+// liked one of ours for the first time, and noting the emoji reaction it is
+// if it has content.
+func (s *Service) liked(c context.Context, l vocab.ActivityStreamsLike) error {
+	s.received(l)
+	for _, objectIRI := range objectsOf(l) {
+		if ownerIRI := s.localOwner(c, objectIRI); ownerIRI != nil {
+			s.meet(c, ownerIRI, authorsOf(l))
+			break
+		}
+	}
+	id, err := pub.GetId(l)
+	if err != nil {
+		return nil
+	}
+	var emoji string
+	if content := l.GetActivityStreamsContent(); content != nil {
+		for iter := content.Begin(); iter != content.End(); iter = iter.Next() {
+			if iter.IsXMLSchemaString() {
+				emoji = iter.GetXMLSchemaString()
+				break
+			}
+		}
+	}
+	actors := authorsOf(l)
+	if emoji == "" || len(actors) == 0 {
+		return nil
+	}
+	for _, objectIRI := range objectsOf(l) {
+		s.addEmojiReaction(c, db.EmojiReaction{ID: id, Actor: actors[0], Object: objectIRI, Emoji: emoji})
+	}
+	return nil
+}
+
+// undone runs once undo has checked an Undo, taking back the emoji
+// reactions, follows and follow requests it's of. Only who reacted or asked
+// may take them back.
+func (s *Service) undone(c context.Context, u vocab.ActivityStreamsUndo) error {
+	s.received(u)
+	s.withdrawFollow(c, u)
+	actors := authorsOf(u)
+	for _, id := range objectsOf(u) {
+		if r, ok := s.db.EmojiReaction(id); ok && containsIRI(actors, r.Actor) {
+			s.db.RemoveEmojiReaction(id)
+		}
+	}
+	return nil
+}
+
+// addEmojiReaction records `r`, if it's to an object we have.
+func (s *Service) addEmojiReaction(c context.Context, r db.EmojiReaction) {
+	if exists, err := s.db.Exists(c, r.Object); err == nil && exists {
+		s.db.AddEmojiReaction(r)
+	}
+}
+
+// emojiReact is a Pleroma EmojiReact, or an Undo of one, as delivered.
+type emojiReact struct {
+	ID      string          `json:"id"`
+	Type    string          `json:"type"`
+	Actor   json.RawMessage `json:"actor"`
+	Object  json.RawMessage `json:"object"`
+	Content string          `json:"content"`
+}
+
+// postEmojiReact takes the delivery `r` to one of our inboxes if it's an
+// EmojiReact, or an Undo of one embedding it, and reports whether it did.
+// Its body must have been buffered. Like any delivery, it must be signed by
+// its actor, whether here or at our shared inbox.
+func (s *Service) postEmojiReact(c context.Context, w http.ResponseWriter, r *http.Request) bool {
+	body, err := r.GetBody()
+	if err != nil {
+		return false
+	}
+	var activity emojiReact
+	if err := json.NewDecoder(body).Decode(&activity); err != nil {
+		return false
+	}
+	var undone emojiReact
+	switch activity.Type {
+	case "EmojiReact":
+	case "Undo":
+		if err := json.Unmarshal(activity.Object, &undone); err != nil || undone.Type != "EmojiReact" {
+			return false
+		}
+	default:
+		return false
+	}
+	defer func() {
+		// Should the peer's signature have read it.
+		r.Body, _ = r.GetBody()
+	}()
+	signer, _ := ActorFromContext(c)
+	ok := isAuthenticated(c)
+	if !ok {
+		inboxIRI := &url.URL{Scheme: "https", Host: s.db.Hostname(), Path: r.URL.Path}
+		signer, ok = s.verifyDelivery(c, inboxIRI, r)
+	}
+	actorIRI, _ := url.Parse(rawID(activity.Actor))
+	if !ok || actorIRI == nil || signer != nil && signer.String() != actorIRI.String() {
+		WriteError(w, ErrInvalidSignature)
+		return true
+	}
+	if blocked, _ := s.Blocked(c, []*url.URL{actorIRI}); blocked {
+		WriteError(w, ErrBlocked)
+		return true
+	}
+	if activity.Type == "Undo" {
+		s.undoEmojiReact(c, actorIRI, undone)
+	} else {
+		id, _ := url.Parse(activity.ID)
+		objectIRI, _ := url.Parse(rawID(activity.Object))
+		if id == nil || !id.IsAbs() || objectIRI == nil || activity.Content == "" {
+			WriteError(w, &ParseError{errors.New("invalid EmojiReact")})
+			return true
+		}
+		s.addEmojiReaction(c, db.EmojiReaction{ID: id, Actor: actorIRI, Object: objectIRI, Emoji: activity.Content})
+	}
+	w.WriteHeader(http.StatusOK)
+	return true
+}
+
+// undoEmojiReact takes back the reaction `react` by the actor at `actorIRI`:
+// by its id, or if it has none, by what it reacted to with.
+func (s *Service) undoEmojiReact(c context.Context, actorIRI *url.URL, react emojiReact) {
+	if id, err := url.Parse(react.ID); err == nil && react.ID != "" {
+		if r, ok := s.db.EmojiReaction(id); ok && r.Actor.String() == actorIRI.String() {
+			s.db.RemoveEmojiReaction(id)
+		}
+		return
+	}
+	objectIRI, err := url.Parse(rawID(react.Object))
+	if err != nil {
+		return
+	}
+	for _, r := range s.db.EmojiReactions(objectIRI) {
+		if r.Actor.String() == actorIRI.String() && r.Emoji == react.Content {
+			s.db.RemoveEmojiReaction(r.ID)
+		}
+	}
+}
+
+// rawID returns the IRI `raw` is, or the id of the object it is.
+func rawID(raw json.RawMessage) string {
+	var iri string
+	if err := json.Unmarshal(raw, &iri); err == nil {
+		return iri
+	}
+	var o struct {
+		ID string `json:"id"`
+	}
+	json.Unmarshal(raw, &o)
+	return o.ID
+}
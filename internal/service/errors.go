@@ -0,0 +1,125 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"mastogon/internal/db"
+)
+
+// ErrRegistrationsClosed is returned when someone tries to sign up while the
+// instance isn't taking new accounts.
+var ErrRegistrationsClosed = errors.New("registrations are closed")
+
+// ErrNotFound is returned when a local user asks for something that doesn't
+// exist, or that isn't theirs to see.
+var ErrNotFound = errors.New("Record not found")
+
+// ErrUnauthorized is returned when a client's bearer token is missing, or
+// isn't one we handed out to an account that may act.
+var ErrUnauthorized = errors.New("The access token is invalid")
+
+// ErrInvalidSignature is returned when a request from a peer isn't signed,
+// or not by whoever it should be.
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// ErrForbidden is returned when a local user asks for what they may not do,
+// such as moderation without being a moderator.
+var ErrForbidden = errors.New("This action is not allowed")
+
+// ErrBlocked is returned when a peer we've blocked, or suspended, asks
+// something of us.
+var ErrBlocked = errors.New("blocked")
+
+// ErrRateLimited is returned when a peer tells us to slow down, so whoever
+// asked us can try again later.
+var ErrRateLimited = errors.New("Too many requests")
+
+// ErrBodyTooLarge is returned when a request's body is over what we take.
+var ErrBodyTooLarge = errors.New("body too large")
+
+// ErrUnavailable is returned when we can't take a request just now, say
+// because we're shutting down.
+var ErrUnavailable = errors.New("service unavailable")
+
+// ValidationError is returned when a local user submits something we refuse
+// to store, such as an overlong note. Mastodon reports these as 422s.
+type ValidationError struct {
+	msg string
+}
+
+// NewValidationError returns a ValidationError saying `msg`, for callers
+// validating requests themselves.
+func NewValidationError(msg string) *ValidationError {
+	return &ValidationError{msg}
+}
+
+func (e *ValidationError) Error() string {
+	return "Validation failed: " + e.msg
+}
+
+// ParseError is returned when a request can't be read at all, such as a
+// body that isn't JSON. It wraps what went wrong reading it.
+type ParseError struct {
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorStatus returns the HTTP status code to answer with when handling a
+// request failed with `err`, and the message to give, as Mastodon would.
+// What we don't expect is a 500, whose message says no more than that: the
+// error may tell of our internals, such as the addresses we failed to reach.
+func ErrorStatus(err error) (int, string) {
+	var validation *ValidationError
+	var parse *ParseError
+	switch {
+	case errors.Is(err, ErrRegistrationsClosed):
+		return http.StatusForbidden, "Registrations are closed"
+	case errors.Is(err, ErrNotFound), errors.Is(err, db.ErrNotFound), errors.Is(err, db.ErrWrongType):
+		return http.StatusNotFound, "Record not found"
+	case errors.Is(err, ErrForbidden), errors.Is(err, db.ErrNotOwned), errors.Is(err, ErrBlocked):
+		return http.StatusForbidden, "This action is not allowed"
+	case errors.Is(err, ErrUnauthorized):
+		return http.StatusUnauthorized, ErrUnauthorized.Error()
+	case errors.Is(err, ErrInvalidSignature):
+		return http.StatusUnauthorized, err.Error()
+	case errors.Is(err, ErrRateLimited):
+		return http.StatusTooManyRequests, ErrRateLimited.Error()
+	case errors.Is(err, ErrBodyTooLarge):
+		return http.StatusRequestEntityTooLarge, err.Error()
+	case errors.Is(err, ErrUnavailable):
+		return http.StatusServiceUnavailable, err.Error()
+	case errors.Is(err, db.ErrUsernameTaken):
+		return http.StatusUnprocessableEntity, "Validation failed: Username has already been taken"
+	case errors.As(err, &parse):
+		return http.StatusBadRequest, err.Error()
+	case errors.As(err, &validation):
+		return http.StatusUnprocessableEntity, err.Error()
+	}
+	return http.StatusInternalServerError, "Internal error"
+}
+
+// WriteError answers a request that failed with `err` with the status
+// ErrorStatus picks and a Mastodon-style error body. Errors we didn't expect
+// are logged, their body not saying what they were.
+func WriteError(w http.ResponseWriter, err error) {
+	status, msg := ErrorStatus(err)
+	if status == http.StatusInternalServerError {
+		log.Printf("internal error: %s", err)
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
@@ -0,0 +1,72 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"mastogon/internal/db"
+)
+
+func TestErrorStatus(t *testing.T) {
+	for _, test := range []struct {
+		err    error
+		status int
+		msg    string
+	}{
+		{fmt.Errorf("note: %w", db.ErrNotFound), http.StatusNotFound, "Record not found"},
+		{&ValidationError{"Text can't be blank"}, http.StatusUnprocessableEntity, "Validation failed: Text can't be blank"},
+		{&ParseError{errors.New("unexpected EOF")}, http.StatusBadRequest, "unexpected EOF"},
+		{ErrUnauthorized, http.StatusUnauthorized, ErrUnauthorized.Error()},
+		{fmt.Errorf("outbox: %w", db.ErrNotOwned), http.StatusForbidden, "This action is not allowed"},
+		{fmt.Errorf("not a moderator: %w", ErrForbidden), http.StatusForbidden, "This action is not allowed"},
+		{fmt.Errorf("account alice: %w", db.ErrUsernameTaken), http.StatusUnprocessableEntity, "Validation failed: Username has already been taken"},
+		{fmt.Errorf("fetching: %w", ErrRateLimited), http.StatusTooManyRequests, "Too many requests"},
+		{NewValidationError("Type is not supported"), http.StatusUnprocessableEntity, "Validation failed: Type is not supported"},
+		{errors.New("dial tcp 10.0.0.7:5432: connection refused"), http.StatusInternalServerError, "Internal error"},
+	} {
+		status, msg := ErrorStatus(test.err)
+		if status != test.status || msg != test.msg {
+			t.Errorf("ErrorStatus(%q) = %d, %q; want %d, %q", test.err, status, msg, test.status, test.msg)
+		}
+	}
+}
+
+func TestWriteErrorHidesInternalErrors(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	w := httptest.NewRecorder()
+	WriteError(w, errors.New("dial tcp 10.0.0.7:5432: connection refused"))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body["error"] != "Internal error" {
+		t.Errorf("error %q, want nothing of what went wrong", body["error"])
+	}
+	if !strings.Contains(logged.String(), "10.0.0.7:5432") {
+		t.Errorf("logged %q, want the error", logged.String())
+	}
+
+	// Nor is what the client got wrong.
+	logged.Reset()
+	WriteError(httptest.NewRecorder(), &ValidationError{"Text can't be blank"})
+	if logged.Len() > 0 {
+		t.Errorf("logged %q", logged.String())
+	}
+}
@@ -0,0 +1,124 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"sync"
+
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// Extensions learn of what happens on the instance through events, rather
+// than by hooking into our callbacks: they Listen for the kinds they care
+// about and Read them as they come. Events are handed out without waiting,
+// so a listener that falls behind misses some rather than holding us up.
+
+// EventKind is what kind of thing an Event says happened.
+type EventKind string
+
+const (
+	// A peer delivered an activity to one of our inboxes, and we took it.
+	// Activity is what was delivered, Actor who by.
+	EventActivityReceived EventKind = "activity.received"
+	// A local user posted a status. Activity is the status, Actor who
+	// posted it.
+	EventStatusCreated EventKind = "status.created"
+	// Someone one of our users asked to follow accepted. Activity is the
+	// Follow, Actor who accepted.
+	EventFollowAccepted EventKind = "follow.accepted"
+	// A peer's account moved to one listing it among its aliases, and its
+	// followers here may want to follow it there: see MovePrompts.
+	// Activity is the Move, Actor the account that moved.
+	EventAccountMoved EventKind = "account.moved"
+)
+
+// How many events a listener may have waiting to be read before it misses
+// some.
+const listenerBuffer = 64
+
+// Event is something that happened on the instance.
+type Event struct {
+	Kind     EventKind
+	Activity vocab.Type
+	Actor    *url.URL
+}
+
+// Listener receives the events it listens for. See Listen.
+type Listener struct {
+	kinds  map[EventKind]bool
+	events chan Event
+	bus    *eventBus
+}
+
+// eventBus hands out events to the listeners for them.
+type eventBus struct {
+	mu        sync.Mutex
+	listeners map[*Listener]bool
+}
+
+// Listen returns a Listener for the events of `kinds`, or for all events if
+// none are given. It must be closed once done with.
+func (s *Service) Listen(kinds ...EventKind) *Listener {
+	l := &Listener{
+		kinds:  make(map[EventKind]bool, len(kinds)),
+		events: make(chan Event, listenerBuffer),
+		bus:    &s.events,
+	}
+	for _, kind := range kinds {
+		l.kinds[kind] = true
+	}
+	s.events.mu.Lock()
+	defer s.events.mu.Unlock()
+	if s.events.listeners == nil {
+		s.events.listeners = make(map[*Listener]bool)
+	}
+	s.events.listeners[l] = true
+	return l
+}
+
+// Read returns the next event for `l`, waiting for one until `c` is done.
+func (l *Listener) Read(c context.Context) (Event, error) {
+	select {
+	case e := <-l.events:
+		return e, nil
+	case <-c.Done():
+		return Event{}, c.Err()
+	}
+}
+
+// Close stops `l` receiving events. Those not yet read are dropped.
+func (l *Listener) Close() {
+	l.bus.mu.Lock()
+	defer l.bus.mu.Unlock()
+	delete(l.bus.listeners, l)
+}
+
+// emit hands `e` to everyone listening for it.
+func (s *Service) emit(e Event) {
+	s.events.mu.Lock()
+	defer s.events.mu.Unlock()
+	for l := range s.events.listeners {
+		if len(l.kinds) > 0 && !l.kinds[e.Kind] {
+			continue
+		}
+		select {
+		case l.events <- e:
+		default:
+			log.Printf("a listener missed a %s event: it's %d behind", e.Kind, listenerBuffer)
+		}
+	}
+}
+
+// received emits the EventActivityReceived for `activity`, delivered to one
+// of our inboxes.
+func (s *Service) received(activity vocab.Type) {
+	e := Event{Kind: EventActivityReceived, Activity: activity}
+	if actors := authorsOf(activity); len(actors) > 0 {
+		e.Actor = actors[0]
+	}
+	s.emit(e)
+}
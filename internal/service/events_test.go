@@ -0,0 +1,79 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-fed/activity/pub"
+)
+
+func TestEvents(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	bob := newTestPeer(t, transport, "https://remote.test/users/bob", "rsa")
+	following(t, s, aliceIRI, bob.iri)
+	statuses := s.Listen(EventStatusCreated)
+	defer statuses.Close()
+	everything := s.Listen()
+	defer everything.Close()
+	accepts := s.Listen(EventFollowAccepted)
+	defer accepts.Close()
+
+	// read returns the events `l` has waiting, up to `n`.
+	read := func(l *Listener, n int) (events []Event) {
+		t.Helper()
+		for len(events) < n {
+			readCtx, cancel := context.WithTimeout(c, 100*time.Millisecond)
+			e, err := l.Read(readCtx)
+			cancel()
+			if errors.Is(err, context.DeadlineExceeded) {
+				break
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			events = append(events, e)
+		}
+		return
+	}
+	post := func() *url.URL {
+		t.Helper()
+		note, err := s.PostStatus(c, aliceIRI, StatusParams{Status: "hello", Visibility: VisibilityPublic})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return note.GetJSONLDId().Get()
+	}
+
+	noteIRI := post()
+	got := read(statuses, 2)
+	if len(got) != 1 || got[0].Kind != EventStatusCreated || got[0].Actor.String() != aliceIRI.String() {
+		t.Fatalf("read %+v, want alice's status", got)
+	}
+	if id, err := pub.GetId(got[0].Activity); err != nil || id.String() != noteIRI.String() {
+		t.Errorf("status created was %v, want %s", id, noteIRI)
+	}
+	deliver(t, s, bob, s.boxIRI(aliceIRI, "inbox"), creating(postBy("Note", "https://remote.test/notes/1", bob.iri.String(), aliceIRI.String())))
+	if got := read(everything, 3); len(got) != 2 || got[0].Kind != EventStatusCreated || got[1].Kind != EventActivityReceived || got[1].Actor.String() != bob.iri.String() {
+		t.Errorf("read %+v, want alice's status and bob's Create", got)
+	}
+	if got := read(accepts, 1); len(got) != 0 {
+		t.Errorf("listening for accepted follows, read %+v", got)
+	}
+
+	// Closed, a listener gets nothing more, while others still do.
+	statuses.Close()
+	post()
+	if got := read(statuses, 1); len(got) != 0 {
+		t.Errorf("read %+v once closed", got)
+	}
+	if got := read(everything, 2); len(got) != 1 || got[0].Kind != EventStatusCreated {
+		t.Errorf("read %+v, want alice's second status", got)
+	}
+}
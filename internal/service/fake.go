@@ -0,0 +1,77 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+)
+
+// FakeTransport is a Transport that never touches the network, for tests
+// of federation: it serves the canned documents it's told to and records
+// what's delivered. The zero value serves nothing. See SetTransport.
+type FakeTransport struct {
+	mu sync.Mutex
+	// The documents Dereference serves, keyed by IRI.
+	responses map[string][]byte
+	delivered []FakeDelivery
+}
+
+// FakeDelivery is an activity a FakeTransport was asked to deliver.
+type FakeDelivery struct {
+	To   *url.URL
+	Body []byte
+}
+
+// Respond makes the transport serve `payload` for `iri`. Like a web server,
+// it ignores fragments: keys are served by their actor's document.
+func (t *FakeTransport) Respond(iri *url.URL, payload []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.responses == nil {
+		t.responses = make(map[string][]byte)
+	}
+	t.responses[withoutFragment(iri)] = payload
+}
+
+// Delivered returns what's been delivered so far, oldest first.
+func (t *FakeTransport) Delivered() []FakeDelivery {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]FakeDelivery(nil), t.delivered...)
+}
+
+func (t *FakeTransport) Dereference(c context.Context, iri *url.URL) ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b, ok := t.responses[withoutFragment(iri)]
+	if !ok {
+		return nil, fmt.Errorf("GET request to %s failed (404): no canned response", iri)
+	}
+	return b, nil
+}
+
+func (t *FakeTransport) Deliver(c context.Context, b []byte, to *url.URL) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.delivered = append(t.delivered, FakeDelivery{To: to, Body: b})
+	return nil
+}
+
+func (t *FakeTransport) BatchDeliver(c context.Context, b []byte, recipients []*url.URL) error {
+	for _, to := range recipients {
+		if err := t.Deliver(c, b, to); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func withoutFragment(iri *url.URL) string {
+	u := *iri
+	u.Fragment = ""
+	return u.String()
+}
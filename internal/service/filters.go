@@ -0,0 +1,206 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"mastogon/internal/db"
+
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// The places a filter may apply to.
+var filterContexts = map[string]bool{
+	"home":          true,
+	"notifications": true,
+	"public":        true,
+	"thread":        true,
+	"account":       true,
+}
+
+// FilterParams is what a local user supplies when creating or changing a
+// filter.
+type FilterParams struct {
+	Phrase       string
+	Regex        bool
+	WholeWord    bool
+	Contexts     []string
+	Irreversible bool
+	// How long the filter lasts. Zero means forever.
+	ExpiresIn time.Duration
+}
+
+func (p FilterParams) validate() error {
+	if strings.TrimSpace(p.Phrase) == "" {
+		return &ValidationError{"Phrase can't be blank"}
+	}
+	if p.Regex {
+		if _, err := regexp.Compile(p.Phrase); err != nil {
+			return &ValidationError{"Phrase is not a valid regular expression"}
+		}
+	}
+	if len(p.Contexts) == 0 {
+		return &ValidationError{"Context can't be blank"}
+	}
+	for _, context := range p.Contexts {
+		if !filterContexts[context] {
+			return &ValidationError{"Context is not included in the list"}
+		}
+	}
+	if p.ExpiresIn < 0 {
+		return &ValidationError{"Expires in must be positive"}
+	}
+	return nil
+}
+
+// applyFilterParams sets the fields of `f` from `p`.
+func (s *Service) applyFilterParams(f *db.Filter, p FilterParams) {
+	f.Phrase = p.Phrase
+	f.Regex = p.Regex
+	f.WholeWord = p.WholeWord
+	f.Contexts = p.Contexts
+	f.Irreversible = p.Irreversible
+	f.ExpiresAt = time.Time{}
+	if p.ExpiresIn > 0 {
+		f.ExpiresAt = s.Now().Add(p.ExpiresIn)
+	}
+}
+
+// CreateFilter makes a new filter for the local actor at `actorIRI`.
+func (s *Service) CreateFilter(c context.Context, actorIRI *url.URL, params FilterParams) (*db.Filter, error) {
+	if err := params.validate(); err != nil {
+		return nil, err
+	}
+	f := &db.Filter{Owner: actorIRI}
+	s.applyFilterParams(f, params)
+	s.db.CreateFilter(f)
+	return f, nil
+}
+
+// Filter returns the filter with `id`, if the local actor at `actorIRI` made
+// it.
+func (s *Service) Filter(c context.Context, actorIRI *url.URL, id string) (*db.Filter, error) {
+	f, err := s.db.Filter(id)
+	if err != nil || f.Owner.String() != actorIRI.String() {
+		return nil, ErrNotFound
+	}
+	return f, nil
+}
+
+// Filters returns the filters the local actor at `actorIRI` made, expired
+// ones included.
+func (s *Service) Filters(c context.Context, actorIRI *url.URL) []*db.Filter {
+	return s.db.Filters(actorIRI)
+}
+
+// UpdateFilter changes a filter.
+func (s *Service) UpdateFilter(c context.Context, actorIRI *url.URL, id string, params FilterParams) (*db.Filter, error) {
+	if err := params.validate(); err != nil {
+		return nil, err
+	}
+	f, err := s.Filter(c, actorIRI, id)
+	if err != nil {
+		return nil, err
+	}
+	updated := *f
+	s.applyFilterParams(&updated, params)
+	s.db.UpdateFilter(&updated)
+	return &updated, nil
+}
+
+// DeleteFilter deletes a filter.
+func (s *Service) DeleteFilter(c context.Context, actorIRI *url.URL, id string) error {
+	if _, err := s.Filter(c, actorIRI, id); err != nil {
+		return err
+	}
+	s.db.DeleteFilter(id)
+	return nil
+}
+
+// FiltersMatching returns the unexpired filters of the local actor at
+// `actorIRI` that apply in `filterContext` and match `t`.
+func (s *Service) FiltersMatching(c context.Context,
+	actorIRI *url.URL,
+	filterContext string,
+	t vocab.Type) (matched []*db.Filter) {
+	var text string
+	for _, f := range s.db.Filters(actorIRI) {
+		if !f.ExpiresAt.IsZero() && !s.Now().Before(f.ExpiresAt) {
+			continue
+		}
+		if !contains(f.Contexts, filterContext) {
+			continue
+		}
+		if text == "" {
+			text = filterableText(t)
+		}
+		if filterMatches(f, text) {
+			matched = append(matched, f)
+		}
+	}
+	return
+}
+
+// filterMatches reports whether `f` matches `text`, ignoring case.
+func filterMatches(f *db.Filter, text string) bool {
+	pattern := f.Phrase
+	if !f.Regex {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if f.WholeWord {
+		// Like Mastodon, a word is bounded by anything but letters and
+		// digits, which \b doesn't get right outside of ASCII.
+		pattern = `(?:^|[^\p{L}\p{N}_])(?:` + pattern + `)(?:$|[^\p{L}\p{N}_])`
+	}
+	re, err := regexp.Compile(`(?i)` + pattern)
+	if err != nil {
+		return false
+	}
+	return re.MatchString(text)
+}
+
+var tagPattern = regexp.MustCompile(`<[^>]*>`)
+
+// filterableText is the text of `t` filters are matched against: its
+// content, summary and name, stripped of markup.
+func filterableText(t vocab.Type) string {
+	var parts []string
+	if o, ok := t.(interface {
+		GetActivityStreamsContent() vocab.ActivityStreamsContentProperty
+	}); ok && o.GetActivityStreamsContent() != nil {
+		for iter := o.GetActivityStreamsContent().Begin(); iter != o.GetActivityStreamsContent().End(); iter = iter.Next() {
+			if iter.IsXMLSchemaString() {
+				parts = append(parts, iter.GetXMLSchemaString())
+			}
+		}
+	}
+	if o, ok := t.(interface {
+		GetActivityStreamsSummary() vocab.ActivityStreamsSummaryProperty
+	}); ok && o.GetActivityStreamsSummary() != nil {
+		for iter := o.GetActivityStreamsSummary().Begin(); iter != o.GetActivityStreamsSummary().End(); iter = iter.Next() {
+			if iter.IsXMLSchemaString() {
+				parts = append(parts, iter.GetXMLSchemaString())
+			}
+		}
+	}
+	if o, ok := t.(interface {
+		GetActivityStreamsName() vocab.ActivityStreamsNameProperty
+	}); ok && o.GetActivityStreamsName() != nil {
+		for iter := o.GetActivityStreamsName().Begin(); iter != o.GetActivityStreamsName().End(); iter = iter.Next() {
+			if iter.IsXMLSchemaString() {
+				parts = append(parts, iter.GetXMLSchemaString())
+			}
+		}
+	}
+	text := strings.Join(parts, "\n")
+	// Keep words in separate tags apart.
+	text = tagPattern.ReplaceAllString(text, " ")
+	return html.UnescapeString(text)
+}
@@ -0,0 +1,106 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"mastogon/internal/db"
+)
+
+func TestFilterMatches(t *testing.T) {
+	for _, test := range []struct {
+		f    db.Filter
+		text string
+		want bool
+	}{
+		{db.Filter{Phrase: "spoiler"}, "No SPOILERS please", true},
+		{db.Filter{Phrase: "spoiler", WholeWord: true}, "No SPOILERS please", false},
+		{db.Filter{Phrase: "spoiler", WholeWord: true}, "spoiler: it ends", true},
+		{db.Filter{Phrase: "café", WholeWord: true}, "cafés are open", false},
+		{db.Filter{Phrase: "café", WholeWord: true}, "le Café!", true},
+		{db.Filter{Phrase: "a.b"}, "axb", false},
+		{db.Filter{Phrase: "a.b", Regex: true}, "axb", true},
+		{db.Filter{Phrase: `^breaking\b`, Regex: true}, "Breaking news", true},
+		{db.Filter{Phrase: `^breaking\b`, Regex: true}, "not breaking news", false},
+		{db.Filter{Phrase: "news|sports", Regex: true, WholeWord: true}, "the sports section", true},
+	} {
+		if got := filterMatches(&test.f, test.text); got != test.want {
+			t.Errorf("%+v matching %q: %t, want %t", test.f, test.text, got, test.want)
+		}
+	}
+}
+
+func TestFilterParamsValidate(t *testing.T) {
+	for _, test := range []struct {
+		params FilterParams
+		msg    string
+	}{
+		{FilterParams{Phrase: " ", Contexts: []string{"home"}}, "Phrase can't be blank"},
+		{FilterParams{Phrase: "(", Regex: true, Contexts: []string{"home"}}, "Phrase is not a valid regular expression"},
+		{FilterParams{Phrase: "x"}, "Context can't be blank"},
+		{FilterParams{Phrase: "x", Contexts: []string{"home", "everywhere"}}, "Context is not included in the list"},
+		{FilterParams{Phrase: "x", Contexts: []string{"home"}, ExpiresIn: -time.Hour}, "Expires in must be positive"},
+		{FilterParams{Phrase: "(", Contexts: []string{"home"}}, ""},
+	} {
+		err := test.params.validate()
+		var validation *ValidationError
+		if test.msg == "" && err != nil || test.msg != "" && (!errors.As(err, &validation) || validation.msg != test.msg) {
+			t.Errorf("%+v: %v, want %q", test.params, err, test.msg)
+		}
+	}
+}
+
+func TestFiltersMatching(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	clock := &testClock{now: time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)}
+	s.SetClock(clock)
+	aliceIRI := register(t, s, "alice")
+	bobIRI := register(t, s, "bob")
+	carol := newTestPeer(t, transport, "https://remote.test/users/carol", "rsa")
+	inboxIRI := s.boxIRI(aliceIRI, "inbox")
+	filter := func(actorIRI string, params FilterParams) *db.Filter {
+		t.Helper()
+		f, err := s.CreateFilter(c, mustParse(t, actorIRI), params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	marking := filter(aliceIRI.String(), FilterParams{Phrase: "hello", Contexts: []string{"home", "public"}})
+	filter(aliceIRI.String(), FilterParams{Phrase: "hello", Contexts: []string{"notifications"}})
+	filter(aliceIRI.String(), FilterParams{Phrase: "hello", Contexts: []string{"home"}, Irreversible: true, ExpiresIn: time.Hour})
+	filter(bobIRI.String(), FilterParams{Phrase: "hello", Contexts: []string{"home"}, Irreversible: true})
+
+	deliver(t, s, carol, inboxIRI, creating(postBy("Note", "https://remote.test/notes/1", carol.iri.String(), aliceIRI.String())))
+	home := func() map[string]string {
+		t.Helper()
+		objects, err := s.HomeTimeline(c, aliceIRI, TimeRange{}, 20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return typesOf(objects)
+	}
+	if got := home(); len(got) != 0 {
+		t.Errorf("home timeline %v, want the note dropped", got)
+	}
+
+	// Once the irreversible filter expires the note is only marked.
+	clock.Advance(time.Hour)
+	if got, want := home(), map[string]string{"https://remote.test/notes/1": "Note"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("home timeline %v once the filter expired, want %v", got, want)
+	}
+	note, err := s.db.Get(c, mustParse(t, "https://remote.test/notes/1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.FiltersMatching(c, aliceIRI, "home", note); len(got) != 1 || got[0].ID != marking.ID {
+		t.Errorf("filters matching %+v, want only %+v", got, marking)
+	}
+}
@@ -0,0 +1,49 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"log"
+	"net/url"
+
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// Go-Fed only records the IRIs of the actors following or liking ours. We
+// fetch and store the whole actor the first time one of them turns up, so
+// its key, shared inbox, name and avatar are at hand from then on.
+
+// followed runs after Go-Fed's default handling of a Follow.
+func (s *Service) followed(c context.Context, f vocab.ActivityStreamsFollow) error {
+	s.received(f)
+	var viewerIRI *url.URL
+	for _, o := range objectsOf(f) {
+		if owns, err := s.db.Owns(c, o); err == nil && owns {
+			viewerIRI = o
+			break
+		}
+	}
+	s.meet(c, viewerIRI, authorsOf(f))
+	s.requestFollow(c, f)
+	return nil
+}
+
+// meet fetches and stores the actors at `actorIRIs` we don't have yet, on
+// behalf of the local actor at `viewerIRI`. Concurrent first contacts with
+// the same actor share a fetch. Failing to fetch one is no reason to refuse
+// what it sent us, so it's only logged.
+func (s *Service) meet(c context.Context, viewerIRI *url.URL, actorIRIs []*url.URL) {
+	if viewerIRI == nil {
+		return
+	}
+	for _, actorIRI := range actorIRIs {
+		if exists, err := s.db.Exists(c, actorIRI); err != nil || exists {
+			continue
+		}
+		if _, err := s.RefreshObject(c, viewerIRI, actorIRI); err != nil {
+			log.Printf("fetching %s on first contact: %v", actorIRI, err)
+		}
+	}
+}
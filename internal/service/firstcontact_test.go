@@ -0,0 +1,75 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-fed/activity/streams"
+)
+
+func TestFirstContact(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	clock := &testClock{now: time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)}
+	s.SetClock(clock)
+	aliceIRI := register(t, s, "alice")
+	inboxIRI := s.boxIRI(aliceIRI, "inbox")
+	note, err := s.PostStatus(c, aliceIRI, StatusParams{Status: "hello", Visibility: VisibilityPublic})
+	if err != nil {
+		t.Fatal(err)
+	}
+	noteIRI := note.GetJSONLDId().Get().String()
+	bob := newTestPeer(t, transport, "https://remote.test/users/bob", "rsa")
+	carol := newTestPeer(t, transport, "https://other.test/users/carol", "rsa")
+	// serveNamed has `p`'s document say it's called `name`.
+	serveNamed := func(p *testPeer, name string) {
+		doc := p.actorDoc(p.publicKeyDoc(t, p.iri.String()))
+		doc["name"] = name
+		respondJSON(t, transport, p.iri.String(), doc)
+	}
+	// storedName is what our copy of `p`'s document says it's called, if we
+	// have one.
+	storedName := func(p *testPeer) (string, bool) {
+		t.Helper()
+		v, err := s.db.Get(c, p.iri)
+		if err != nil {
+			return "", false
+		}
+		m, err := streams.Serialize(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		name, _ := m["name"].(string)
+		return name, true
+	}
+	serveNamed(bob, "Bob")
+	serveNamed(carol, "Carol")
+	for _, p := range []*testPeer{bob, carol} {
+		if _, ok := storedName(p); ok {
+			t.Fatalf("stored %s before meeting", p.iri)
+		}
+	}
+
+	// Following or liking first, the whole actor is stored.
+	deliver(t, s, bob, inboxIRI, reacting(bob, "Follow", "https://remote.test/follows/1", aliceIRI.String()))
+	deliver(t, s, carol, inboxIRI, reacting(carol, "Like", "https://other.test/likes/1", noteIRI))
+	if name, ok := storedName(bob); !ok || name != "Bob" {
+		t.Errorf("stored bob as %q, %t after following", name, ok)
+	}
+	if name, ok := storedName(carol); !ok || name != "Carol" {
+		t.Errorf("stored carol as %q, %t after liking", name, ok)
+	}
+
+	// Later contacts don't fetch them again, however long after.
+	serveNamed(bob, "Robert")
+	clock.Advance(2 * s.config.MinRefreshInterval)
+	deliver(t, s, bob, inboxIRI, reacting(bob, "Like", "https://remote.test/likes/1", noteIRI))
+	deliver(t, s, bob, inboxIRI, reacting(bob, "Follow", "https://remote.test/follows/2", aliceIRI.String()))
+	if name, _ := storedName(bob); name != "Bob" {
+		t.Errorf("stored bob as %q after meeting again, want the first copy", name)
+	}
+}
@@ -0,0 +1,186 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"time"
+
+	"mastogon/internal/db"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// Follows of our actors are accepted as they come in by Go-Fed, unless the
+// actor followed approves its followers itself: then they're kept as follow
+// requests until it authorizes or rejects them. Each account may choose,
+// with Config.ManuallyApproveFollows for those that don't.
+
+type inboxKey struct{}
+
+// withInbox returns `c` for a delivery to our inbox at `inboxIRI`.
+func withInbox(c context.Context, inboxIRI *url.URL) context.Context {
+	return context.WithValue(c, inboxKey{}, inboxIRI)
+}
+
+// inboxOwner returns the local actor whose inbox the delivery with context
+// `c` was made to, if we know.
+func (s *Service) inboxOwner(c context.Context) *url.URL {
+	inboxIRI, ok := c.Value(inboxKey{}).(*url.URL)
+	if !ok {
+		return nil
+	}
+	return s.localOwner(c, inboxIRI)
+}
+
+// ManuallyApprovesFollowers reports whether follows of the local actor at
+// `actorIRI` wait for it to approve them.
+func (s *Service) ManuallyApprovesFollowers(actorIRI *url.URL) bool {
+	account, err := s.db.Account(path.Base(actorIRI.Path))
+	if err != nil || account.ManuallyApprovesFollowers == nil {
+		return s.config.ManuallyApproveFollows
+	}
+	return *account.ManuallyApprovesFollowers
+}
+
+// onFollow is what Go-Fed does with a Follow delivered with context `c`:
+// accept it, unless the owner of the inbox approves its followers. Without
+// an owner, such as for deliveries to our instance actor, nobody gets to
+// follow.
+func (s *Service) onFollow(c context.Context) pub.OnFollowBehavior {
+	ownerIRI := s.inboxOwner(c)
+	if ownerIRI == nil || s.ManuallyApprovesFollowers(ownerIRI) {
+		return pub.OnFollowDoNothing
+	}
+	return pub.OnFollowAutomaticallyAccept
+}
+
+// requestFollow keeps the Follow `f`, delivered with context `c`, for the
+// owner of the inbox to approve, if it's what it does.
+func (s *Service) requestFollow(c context.Context, f vocab.ActivityStreamsFollow) {
+	targetIRI := s.inboxOwner(c)
+	if targetIRI == nil || !containsIRI(objectsOf(f), targetIRI) || !s.ManuallyApprovesFollowers(targetIRI) {
+		return
+	}
+	for _, actorIRI := range authorsOf(f) {
+		s.db.AddFollowRequest(&db.FollowRequest{
+			Actor:     actorIRI,
+			Target:    targetIRI,
+			Follow:    f,
+			CreatedAt: time.Now(),
+		})
+	}
+}
+
+// withdrawFollow drops the follow requests the Undo `u` takes back, and ends
+// the follows of our actors it does.
+func (s *Service) withdrawFollow(c context.Context, u vocab.ActivityStreamsUndo) {
+	actorIRIs := authorsOf(u)
+	for _, o := range s.embeddedOrStored(c, u) {
+		if o.GetTypeName() != "Follow" {
+			continue
+		}
+		for _, actorIRI := range actorIRIs {
+			if !containsIRI(authorsOf(o), actorIRI) {
+				continue
+			}
+			for _, targetIRI := range objectsOf(o) {
+				s.db.TakeFollowRequest(actorIRI, targetIRI)
+				if !s.isLocalActor(c, targetIRI) {
+					continue
+				}
+				if err := s.editCollection(c, s.boxIRI(targetIRI, "followers"), func(items []*url.URL) []*url.URL {
+					kept := items[:0]
+					for _, item := range items {
+						if item.String() != actorIRI.String() {
+							kept = append(kept, item)
+						}
+					}
+					return kept
+				}); err != nil {
+					log.Printf("unfollowing %s: %s", targetIRI, err)
+				}
+			}
+		}
+	}
+}
+
+// FollowRequests lists who asked to follow the local actor at `actorIRI`,
+// oldest first.
+func (s *Service) FollowRequests(actorIRI *url.URL) []*url.URL {
+	requests := s.db.FollowRequests(actorIRI)
+	actorIRIs := make([]*url.URL, 0, len(requests))
+	for _, r := range requests {
+		actorIRIs = append(actorIRIs, r.Actor)
+	}
+	return actorIRIs
+}
+
+// AuthorizeFollowRequest makes `followerIRI`, who asked to, a follower of the
+// local actor at `actorIRI`, and tells them.
+func (s *Service) AuthorizeFollowRequest(c context.Context, actorIRI, followerIRI *url.URL) error {
+	r, ok := s.db.TakeFollowRequest(followerIRI, actorIRI)
+	if !ok {
+		return fmt.Errorf("follow request from %s: %w", followerIRI, ErrNotFound)
+	}
+	if err := s.editCollection(c, s.boxIRI(actorIRI, "followers"), func(items []*url.URL) []*url.URL {
+		if containsIRI(items, followerIRI) {
+			return items
+		}
+		return append([]*url.URL{followerIRI}, items...)
+	}); err != nil {
+		return err
+	}
+	accept := streams.NewActivityStreamsAccept()
+	s.answerFollow(accept, r)
+	_, err := s.actor.Send(c, s.boxIRI(actorIRI, "outbox"), accept)
+	return err
+}
+
+// RejectFollowRequest turns down the request of `followerIRI` to follow the
+// local actor at `actorIRI`, and tells them.
+func (s *Service) RejectFollowRequest(c context.Context, actorIRI, followerIRI *url.URL) error {
+	r, ok := s.db.TakeFollowRequest(followerIRI, actorIRI)
+	if !ok {
+		return fmt.Errorf("follow request from %s: %w", followerIRI, ErrNotFound)
+	}
+	reject := streams.NewActivityStreamsReject()
+	s.answerFollow(reject, r)
+	_, err := s.actor.Send(c, s.boxIRI(actorIRI, "outbox"), reject)
+	return err
+}
+
+// answerFollow makes `answer`, an Accept or a Reject, the answer of the
+// target of `r` to its follower.
+func (s *Service) answerFollow(answer interface {
+	SetActivityStreamsActor(vocab.ActivityStreamsActorProperty)
+	SetActivityStreamsObject(vocab.ActivityStreamsObjectProperty)
+	SetActivityStreamsTo(vocab.ActivityStreamsToProperty)
+}, r *db.FollowRequest) {
+	actor := streams.NewActivityStreamsActorProperty()
+	actor.AppendIRI(r.Target)
+	answer.SetActivityStreamsActor(actor)
+	object := streams.NewActivityStreamsObjectProperty()
+	object.AppendActivityStreamsFollow(r.Follow)
+	answer.SetActivityStreamsObject(object)
+	to := streams.NewActivityStreamsToProperty()
+	to.AppendIRI(r.Actor)
+	answer.SetActivityStreamsTo(to)
+}
+
+// withApproval adds to our actor `t`, serialized as `m`, whether it approves
+// its followers, which Go-Fed has no property for.
+func (s *Service) withApproval(m map[string]interface{}, t vocab.Type) {
+	actor, ok := db.ToActor(t)
+	if !ok || actor.GetJSONLDId() == nil || s.isInstanceActor(actor.GetJSONLDId().Get()) {
+		return
+	}
+	m["manuallyApprovesFollowers"] = s.ManuallyApprovesFollowers(actor.GetJSONLDId().Get())
+}
@@ -0,0 +1,93 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"testing"
+)
+
+func TestFollowApprovalPerAccount(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	bobIRI := register(t, s, "bob")
+	carol := newTestPeer(t, transport, "https://remote.test/users/carol", "rsa")
+	dave := newTestPeer(t, transport, "https://other.test/users/dave", "rsa")
+	locked := func(actorIRI *url.URL, locked bool) {
+		t.Helper()
+		if err := s.UpdateCredentials(c, actorIRI, CredentialsParams{Locked: &locked}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// followed has `p` follow the local actor at `actorIRI`, and returns
+	// whether it follows and the types of what it was sent back.
+	followed := func(p *testPeer, actorIRI *url.URL) (follows bool, answers []string) {
+		t.Helper()
+		before := len(transport.Delivered())
+		deliver(t, s, p, s.boxIRI(actorIRI, "inbox"), reacting(p, "Follow", p.iri.String()+"/follows/"+actorIRI.String(), actorIRI.String()))
+		for _, d := range transport.Delivered()[before:] {
+			var m map[string]interface{}
+			if err := json.Unmarshal(d.Body, &m); err != nil {
+				t.Fatal(err)
+			}
+			if d.To.String() == p.iri.String()+"/inbox" {
+				answers = append(answers, m["type"].(string))
+			}
+		}
+		follows, err := s.isFollowedBy(c, actorIRI, p.iri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return follows, answers
+	}
+
+	// alice approves their followers, while bob has them accepted, as the
+	// instance does by default.
+	locked(aliceIRI, true)
+	if follows, answers := followed(carol, aliceIRI); follows || len(answers) != 0 {
+		t.Errorf("carol following alice: follows %t, sent %v, want it left for alice", follows, answers)
+	}
+	if requests := s.FollowRequests(aliceIRI); len(requests) != 1 || requests[0].String() != carol.iri.String() {
+		t.Errorf("alice's follow requests %v, want carol's", requests)
+	}
+	if follows, answers := followed(dave, bobIRI); !follows || len(answers) != 1 || answers[0] != "Accept" {
+		t.Errorf("dave following bob: follows %t, sent %v, want it accepted", follows, answers)
+	}
+	if len(s.FollowRequests(bobIRI)) != 0 {
+		t.Errorf("bob has follow requests %v", s.FollowRequests(bobIRI))
+	}
+	if got := getObject(t, s, aliceIRI.String())["manuallyApprovesFollowers"]; got != true {
+		t.Errorf("alice served as approving their followers: %v", got)
+	}
+	if got := getObject(t, s, bobIRI.String())["manuallyApprovesFollowers"]; got != false {
+		t.Errorf("bob served as approving their followers: %v", got)
+	}
+
+	// Once approved, the follow is accepted.
+	before := len(transport.Delivered())
+	if err := s.AuthorizeFollowRequest(c, aliceIRI, carol.iri); err != nil {
+		t.Fatal(err)
+	}
+	if follows, err := s.isFollowedBy(c, aliceIRI, carol.iri); err != nil || !follows {
+		t.Errorf("carol follows alice %t, %v once approved", follows, err)
+	}
+	if len(transport.Delivered()) == before {
+		t.Error("sent carol no Accept")
+	}
+
+	// Whatever the instance's default, the accounts' choices hold.
+	s.config.ManuallyApproveFollows = true
+	locked(aliceIRI, false)
+	if follows, answers := followed(dave, aliceIRI); !follows || len(answers) != 1 || answers[0] != "Accept" {
+		t.Errorf("dave following alice: follows %t, sent %v, want it accepted", follows, answers)
+	}
+	// Those that don't choose go by it.
+	erinIRI := register(t, s, "erin")
+	if follows, answers := followed(dave, erinIRI); follows || len(answers) != 0 {
+		t.Errorf("dave following erin: follows %t, sent %v, want it left for erin", follows, answers)
+	}
+}
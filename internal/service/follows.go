@@ -0,0 +1,121 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"net/url"
+	"path"
+
+	"mastogon/internal/db"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+)
+
+// Follow sends a Follow from the local actor at `actorIRI` to `targetIRI`.
+func (s *Service) Follow(c context.Context, actorIRI, targetIRI *url.URL) error {
+	// Accounts that moved are followed where they went.
+	if moved := s.movedTarget(c, actorIRI, targetIRI); moved != nil {
+		targetIRI = moved
+	}
+	follow := streams.NewActivityStreamsFollow()
+	actor := streams.NewActivityStreamsActorProperty()
+	actor.AppendIRI(actorIRI)
+	follow.SetActivityStreamsActor(actor)
+	object := streams.NewActivityStreamsObjectProperty()
+	object.AppendIRI(targetIRI)
+	follow.SetActivityStreamsObject(object)
+	to := streams.NewActivityStreamsToProperty()
+	to.AppendIRI(targetIRI)
+	follow.SetActivityStreamsTo(to)
+	_, err := s.actor.Send(c, s.boxIRI(actorIRI, "outbox"), follow)
+	return err
+}
+
+// IsFollowing reports whether `targetIRI` is in the following collection of
+// the local actor at `actorIRI`.
+func (s *Service) IsFollowing(c context.Context, actorIRI, targetIRI *url.URL) (bool, error) {
+	following, err := s.db.Following(c, actorIRI)
+	if err != nil {
+		return false, err
+	}
+	items := following.GetActivityStreamsItems()
+	if items == nil {
+		return false, nil
+	}
+	for iter := items.Begin(); iter != items.End(); iter = iter.Next() {
+		if id, err := pub.ToId(iter); err == nil && id.String() == targetIRI.String() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// CollectionsHidden reports whether the actor at `actorIRI` keeps its
+// followers and following to itself, and `viewerIRI`, who may be nil for
+// anonymous viewers, isn't that actor.
+func (s *Service) CollectionsHidden(c context.Context, actorIRI, viewerIRI *url.URL) bool {
+	if viewerIRI != nil && viewerIRI.String() == actorIRI.String() {
+		return false
+	}
+	owns, err := s.db.Owns(c, actorIRI)
+	if err != nil || !owns {
+		return false
+	}
+	account, err := s.db.Account(path.Base(actorIRI.Path))
+	return err == nil && account.HideCollections
+}
+
+// Followers lists who follows the actor at `actorIRI`, newest first, as far
+// as we know. If the actor hides its collections from `viewerIRI` the list
+// is empty.
+func (s *Service) Followers(c context.Context, actorIRI, viewerIRI *url.URL) ([]*url.URL, error) {
+	return s.actorCollection(c, actorIRI, viewerIRI, func(actor db.Actor) *url.URL {
+		if f := actor.GetActivityStreamsFollowers(); f != nil {
+			id, _ := pub.ToId(f)
+			return id
+		}
+		return nil
+	})
+}
+
+// Following lists who the actor at `actorIRI` follows, like Followers.
+func (s *Service) Following(c context.Context, actorIRI, viewerIRI *url.URL) ([]*url.URL, error) {
+	return s.actorCollection(c, actorIRI, viewerIRI, func(actor db.Actor) *url.URL {
+		if f := actor.GetActivityStreamsFollowing(); f != nil {
+			id, _ := pub.ToId(f)
+			return id
+		}
+		return nil
+	})
+}
+
+// actorCollection returns the items of the actor's collection picked out by
+// `collection`. Collections we have no copy of are empty.
+func (s *Service) actorCollection(c context.Context,
+	actorIRI *url.URL,
+	viewerIRI *url.URL,
+	collection func(db.Actor) *url.URL) ([]*url.URL, error) {
+	if s.CollectionsHidden(c, actorIRI, viewerIRI) {
+		return nil, nil
+	}
+	t, err := s.db.Get(c, actorIRI)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	actor, ok := db.ToActor(t)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	id := collection(actor)
+	if id == nil {
+		return nil, nil
+	}
+	items, _, err := s.collectionItems(c, id)
+	if err != nil {
+		return nil, nil
+	}
+	return items, nil
+}
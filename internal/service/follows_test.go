@@ -0,0 +1,52 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"net/url"
+	"testing"
+)
+
+func TestFollowersAndFollowing(t *testing.T) {
+	c := context.Background()
+	s, _ := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	bobIRI := register(t, s, "bob")
+	carolIRI := mustParse(t, "https://remote.test/users/carol")
+	follow(t, s, aliceIRI, bobIRI)
+	follow(t, s, aliceIRI, carolIRI)
+	following(t, s, aliceIRI, carolIRI)
+
+	check := func(viewerIRI *url.URL, wantFollowers, wantFollowing int) {
+		t.Helper()
+		followers, err := s.Followers(c, aliceIRI, viewerIRI)
+		if err != nil {
+			t.Fatal(err)
+		}
+		following, err := s.Following(c, aliceIRI, viewerIRI)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(followers) != wantFollowers || len(following) != wantFollowing {
+			t.Errorf("%v sees followers %v and following %v, want %d and %d", viewerIRI, followers, following, wantFollowers, wantFollowing)
+		}
+	}
+	check(nil, 2, 1)
+	check(bobIRI, 2, 1)
+
+	hide := true
+	if err := s.UpdateCredentials(c, aliceIRI, CredentialsParams{HideCollections: &hide}); err != nil {
+		t.Fatal(err)
+	}
+	// Only alice sees them now.
+	check(nil, 0, 0)
+	check(bobIRI, 0, 0)
+	check(aliceIRI, 2, 1)
+
+	// Remote actors we have no copy of have no one to list.
+	if _, err := s.Followers(c, carolIRI, nil); err == nil {
+		t.Error("listed the followers of an actor we don't know")
+	}
+}
@@ -0,0 +1,92 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/url"
+	"path"
+
+	"mastogon/internal/db"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+)
+
+// forward delivers `a` to the inboxes of the members of our `collections`,
+// as each collection's owner.
+//
+// We leave out the activity's authors, people on the same host as them, who
+// got it from there, our own actors, who got it through their inbox, and
+// anyone we'd refuse deliveries from.
+func (s *Service) forward(c context.Context, collections []*url.URL, a pub.Activity) error {
+	if len(collections) == 0 {
+		return nil
+	}
+	m, err := streams.Serialize(a)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	authorHosts := make(map[string]bool)
+	for _, author := range authorsOf(a) {
+		authorHosts[author.Host] = true
+	}
+	seen := make(map[string]bool)
+	for _, collectionIRI := range collections {
+		members, _, err := s.collectionItems(c, collectionIRI)
+		if err != nil {
+			continue
+		}
+		// Our collections all hang off their owner's IRI.
+		ownerIRI := *collectionIRI
+		ownerIRI.Path = path.Dir(collectionIRI.Path)
+		var inboxes []*url.URL
+		for _, member := range members {
+			if seen[member.String()] || authorHosts[member.Host] || s.db.IsLocalHost(member.Host) {
+				continue
+			}
+			seen[member.String()] = true
+			if blocked, _ := s.Blocked(c, []*url.URL{member}); blocked {
+				continue
+			}
+			if inboxIRI, err := s.inboxOf(c, &ownerIRI, member); err == nil {
+				inboxes = append(inboxes, inboxIRI)
+			}
+		}
+		if len(inboxes) == 0 {
+			continue
+		}
+		tp, err := s.NewTransport(c, s.boxIRI(&ownerIRI, "inbox"), "")
+		if err != nil {
+			log.Printf("forwarding %s to %s: %s", a.GetJSONLDId().Get(), collectionIRI, err)
+			continue
+		}
+		if err := tp.BatchDeliver(c, b, inboxes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inboxOf returns the inbox of the actor at `actorIRI`, fetching the actor
+// on behalf of the local actor at `viewerIRI` if we have no copy.
+func (s *Service) inboxOf(c context.Context, viewerIRI, actorIRI *url.URL) (*url.URL, error) {
+	t, err := s.db.Get(c, actorIRI)
+	if err != nil {
+		if t, err = s.RefreshObject(c, viewerIRI, actorIRI); err != nil {
+			return nil, err
+		}
+	}
+	actor, ok := db.ToActor(t)
+	if !ok || actor.GetActivityStreamsInbox() == nil {
+		return nil, ErrNotFound
+	}
+	return pub.ToId(actor.GetActivityStreamsInbox())
+}
@@ -0,0 +1,100 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"mastogon/internal/db"
+)
+
+func TestForwardRepliesToFollowers(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	bobIRI := register(t, s, "bob")
+	followersIRI := s.boxIRI(aliceIRI, "followers")
+	respondLocally(t, s, transport, aliceIRI, bobIRI, followersIRI)
+	carol := newTestPeer(t, transport, "https://remote.test/users/carol", "rsa")
+	dave := newTestPeer(t, transport, "https://other.test/users/dave", "rsa")
+	erin := newTestPeer(t, transport, "https://remote.test/users/erin", "rsa")
+	frank := newTestPeer(t, transport, "https://blocked.test/users/frank", "rsa")
+	for _, followerIRI := range []string{bobIRI.String(), dave.iri.String(), erin.iri.String(), frank.iri.String()} {
+		follow(t, s, aliceIRI, mustParse(t, followerIRI))
+	}
+	s.db.SetDomainBlock(db.DomainBlock{Domain: "blocked.test", Severity: "suspend"})
+	note, err := s.PostStatus(c, aliceIRI, StatusParams{Status: "hello", Visibility: VisibilityPublic})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := len(transport.Delivered())
+
+	// carol replies to alice and copies alice's followers, whom carol can't
+	// see.
+	reply := postBy("Note", "https://remote.test/notes/1", carol.iri.String(), aliceIRI.String())
+	reply["cc"] = []interface{}{followersIRI.String()}
+	reply["inReplyTo"] = note.GetJSONLDId().Get().String()
+	create := creating(reply)
+	create["cc"] = reply["cc"]
+	deliver(t, s, carol, s.boxIRI(aliceIRI, "inbox"), create)
+
+	var forwarded []string
+	for _, d := range transport.Delivered()[before:] {
+		forwarded = append(forwarded, d.To.String())
+	}
+	sort.Strings(forwarded)
+	// Not to erin, who got it from carol's host, nor to bob, who's ours,
+	// nor to frank, whose domain is blocked.
+	if want := []string{dave.iri.String() + "/inbox"}; !reflect.DeepEqual(forwarded, want) {
+		t.Errorf("forwarded to %v, want %v", forwarded, want)
+	}
+}
+
+func TestForwardingDepth(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	followersIRI := s.boxIRI(aliceIRI, "followers")
+	respondLocally(t, s, transport, aliceIRI, followersIRI)
+	carol := newTestPeer(t, transport, "https://remote.test/users/carol", "rsa")
+	dave := newTestPeer(t, transport, "https://other.test/users/dave", "rsa")
+	follow(t, s, aliceIRI, dave.iri)
+	note, err := s.PostStatus(c, aliceIRI, StatusParams{Status: "hello", Visibility: VisibilityPublic})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// carol's first note replies to alice's, which we only find out by
+	// fetching it.
+	parent := postBy("Note", "https://remote.test/notes/0", carol.iri.String(), aliceIRI.String())
+	parent["@context"] = "https://www.w3.org/ns/activitystreams"
+	parent["inReplyTo"] = note.GetJSONLDId().Get().String()
+	respondJSON(t, transport, "https://remote.test/notes/0", parent)
+
+	for i, test := range []struct {
+		inReplyTo string
+		depth     int
+		forwarded bool
+	}{
+		// The Create, the reply, then what it replies to.
+		{"https://remote.test/notes/0", 2, false},
+		{"https://remote.test/notes/0", 3, true},
+		// Nothing of ours is in this thread.
+		{"https://remote.test/notes/elsewhere", 4, false},
+	} {
+		s.config.MaxInboxForwardingDepth = test.depth
+		before := len(transport.Delivered())
+		reply := postBy("Note", fmt.Sprintf("https://remote.test/notes/%d", i+1), carol.iri.String(), aliceIRI.String())
+		reply["inReplyTo"] = test.inReplyTo
+		create := creating(reply)
+		create["cc"] = []interface{}{followersIRI.String()}
+		deliver(t, s, carol, s.boxIRI(aliceIRI, "inbox"), create)
+		if forwarded := len(transport.Delivered()) > before; forwarded != test.forwarded {
+			t.Errorf("reply to %s with a depth of %d forwarded: %t, want %t", test.inReplyTo, test.depth, forwarded, test.forwarded)
+		}
+	}
+}
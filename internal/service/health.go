@@ -0,0 +1,97 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrPeerUnavailable is returned for deliveries to a peer we're backing off
+// from, having failed to deliver to it too many times in a row.
+var ErrPeerUnavailable = errors.New("peer is unavailable")
+
+// InstanceHealth is how deliveries to a peer have been going.
+type InstanceHealth struct {
+	Domain    string
+	Successes int
+	Failures  int
+	// The failures since the last success.
+	ConsecutiveFailures int
+	// The mean time deliveries to the peer took, failures included.
+	AverageLatency time.Duration
+	LastSuccess    time.Time
+	LastFailure    time.Time
+	// Until when we're holding off delivering to the peer, if we are.
+	UnavailableUntil time.Time
+}
+
+// peerHealth tracks deliveries to one peer. Once Config.DeliveryFailureLimit
+// of them fail in a row, the breaker opens: deliveries fail straight away
+// until Config.DeliveryCooldown has passed. The next delivery after that
+// closes it again if it succeeds, and reopens it if it doesn't.
+type peerHealth struct {
+	mu           sync.Mutex
+	health       InstanceHealth
+	totalLatency time.Duration
+}
+
+func (s *Service) peerHealth(host string) *peerHealth {
+	v, _ := s.deliveryHealth.LoadOrStore(host, &peerHealth{health: InstanceHealth{Domain: host}})
+	return v.(*peerHealth)
+}
+
+// deliveryAllowed reports whether we may deliver to `host` now.
+func (s *Service) deliveryAllowed(host string) bool {
+	v, ok := s.deliveryHealth.Load(host)
+	if !ok {
+		return true
+	}
+	p := v.(*peerHealth)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return !s.Now().Before(p.health.UnavailableUntil)
+}
+
+// recordDelivery notes a delivery to `host` that took `latency`, and whether
+// the peer was up to take it.
+func (s *Service) recordDelivery(host string, latency time.Duration, up bool) {
+	p := s.peerHealth(host)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	h := &p.health
+	now := s.Now()
+	p.totalLatency += latency
+	if up {
+		h.Successes++
+		h.ConsecutiveFailures = 0
+		h.LastSuccess = now
+		h.UnavailableUntil = time.Time{}
+	} else {
+		h.Failures++
+		h.ConsecutiveFailures++
+		h.LastFailure = now
+		if h.ConsecutiveFailures >= s.config.DeliveryFailureLimit {
+			h.UnavailableUntil = now.Add(s.config.DeliveryCooldown)
+		}
+	}
+	h.AverageLatency = p.totalLatency / time.Duration(h.Successes+h.Failures)
+}
+
+// InstancesHealth returns how deliveries have been going to each peer we've
+// delivered to, by domain.
+func (s *Service) InstancesHealth() []InstanceHealth {
+	var all []InstanceHealth
+	s.deliveryHealth.Range(func(key, value interface{}) bool {
+		p := value.(*peerHealth)
+		p.mu.Lock()
+		all = append(all, p.health)
+		p.mu.Unlock()
+		return true
+	})
+	sort.Slice(all, func(i, j int) bool { return all[i].Domain < all[j].Domain })
+	return all
+}
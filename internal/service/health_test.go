@@ -0,0 +1,94 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDeliveryBreaker(t *testing.T) {
+	c := context.Background()
+	var requests, status atomic.Int32
+	status.Store(http.StatusInternalServerError)
+	s, peer := newHTTPTest(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(int(status.Load()))
+	}))
+	clock := &testClock{now: time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)}
+	s.SetClock(clock)
+	s.config.DeliveryFailureLimit = 2
+	s.config.DeliveryCooldown = time.Hour
+	tp, err := s.NewTransport(c, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inboxIRI := mustParse(t, peer.URL+"/inbox")
+	deliver := func() error { return tp.Deliver(c, []byte(`{"type":"Note"}`), inboxIRI) }
+
+	for i := 0; i < 2; i++ {
+		if err := deliver(); err == nil || errors.Is(err, ErrPeerUnavailable) {
+			t.Fatalf("delivery %d: %v, want the peer's error", i+1, err)
+		}
+	}
+	// The breaker's open: we don't even try.
+	if err := deliver(); !errors.Is(err, ErrPeerUnavailable) {
+		t.Errorf("delivery with the breaker open: %v", err)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("the peer got %d requests, want 2", n)
+	}
+	health := s.InstancesHealth()
+	if len(health) != 1 || health[0].Domain != inboxIRI.Host || health[0].Failures != 2 || health[0].ConsecutiveFailures != 2 ||
+		!health[0].UnavailableUntil.Equal(clock.Now().Add(time.Hour)) {
+		t.Errorf("health %+v", health)
+	}
+
+	// Once the cooldown's over, a success closes it.
+	clock.Advance(time.Hour)
+	status.Store(http.StatusAccepted)
+	if err := deliver(); err != nil {
+		t.Fatalf("delivery after the cooldown: %s", err)
+	}
+	if err := deliver(); err != nil {
+		t.Errorf("delivery with the breaker closed: %s", err)
+	}
+	health = s.InstancesHealth()
+	if health[0].Successes != 2 || health[0].ConsecutiveFailures != 0 || !health[0].UnavailableUntil.IsZero() {
+		t.Errorf("health %+v after recovering", health)
+	}
+}
+
+func TestDeliveryBreakerReopens(t *testing.T) {
+	s, _ := newTestService(t)
+	clock := &testClock{now: time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)}
+	s.SetClock(clock)
+	s.config.DeliveryFailureLimit = 2
+	s.config.DeliveryCooldown = time.Hour
+	s.recordDelivery("remote.test", time.Second, false)
+	s.recordDelivery("remote.test", 3*time.Second, false)
+	if s.deliveryAllowed("remote.test") {
+		t.Fatal("delivering after too many failures")
+	}
+	// The first delivery after the cooldown failing reopens it straight
+	// away.
+	clock.Advance(time.Hour)
+	if !s.deliveryAllowed("remote.test") {
+		t.Fatal("not delivering after the cooldown")
+	}
+	s.recordDelivery("remote.test", 2*time.Second, false)
+	if s.deliveryAllowed("remote.test") {
+		t.Error("delivering after failing again")
+	}
+	if h := s.InstancesHealth(); h[0].AverageLatency != 2*time.Second {
+		t.Errorf("average latency %s, want 2s", h[0].AverageLatency)
+	}
+	if !s.deliveryAllowed("other.test") {
+		t.Error("not delivering to a peer we haven't tried")
+	}
+}
@@ -0,0 +1,111 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// The outcomes of importing a single row.
+const (
+	ImportFollowed         = "followed"
+	ImportAlreadyFollowing = "already_following"
+	ImportBlocked          = "blocked"
+	ImportAlreadyBlocking  = "already_blocking"
+	ImportUnresolvable     = "unresolvable"
+	ImportFailed           = "failed"
+)
+
+// ImportResult reports what became of one row of an import.
+type ImportResult struct {
+	Acct   string `json:"acct"`
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ParseAcctCSV reads the accounts out of a Mastodon export, either the
+// current format with an "Account address" header and extra columns, or the
+// older one holding just one account per line.
+func ParseAcctCSV(r io.Reader) ([]string, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	var accts []string
+	for first := true; ; first = false {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if len(record) == 0 {
+			continue
+		}
+		acct := strings.TrimSpace(record[0])
+		if first && strings.EqualFold(acct, "Account address") {
+			continue
+		}
+		if acct != "" {
+			accts = append(accts, acct)
+		}
+	}
+	return accts, nil
+}
+
+// ImportFollows follows every account listed in a Mastodon following export
+// on behalf of the local actor at `actorIRI`. Accounts already followed or
+// that can't be resolved are skipped.
+func (s *Service) ImportFollows(c context.Context, actorIRI *url.URL, r io.Reader) ([]ImportResult, error) {
+	return s.importAccts(c, r, func(targetIRI *url.URL) (string, error) {
+		if following, err := s.IsFollowing(c, actorIRI, targetIRI); err == nil && following {
+			return ImportAlreadyFollowing, nil
+		}
+		if err := s.Follow(c, actorIRI, targetIRI); err != nil {
+			return ImportFailed, err
+		}
+		return ImportFollowed, nil
+	})
+}
+
+// importAccts resolves each account listed in a Mastodon export and hands it
+// to `apply`, which reports what it did. Lookups are spaced out by
+// Config.ImportInterval so we don't hammer peers.
+func (s *Service) importAccts(c context.Context,
+	r io.Reader,
+	apply func(targetIRI *url.URL) (string, error)) ([]ImportResult, error) {
+	accts, err := ParseAcctCSV(r)
+	if err != nil {
+		return nil, &ValidationError{"File is not a valid CSV"}
+	}
+	if len(accts) == 0 {
+		return nil, &ValidationError{"File contains no accounts"}
+	}
+	results := make([]ImportResult, 0, len(accts))
+	for i, acct := range accts {
+		if i > 0 {
+			select {
+			case <-c.Done():
+				return results, c.Err()
+			case <-time.After(s.config.ImportInterval):
+			}
+		}
+		result := ImportResult{Acct: acct}
+		targetIRI, err := s.ResolveAccount(c, acct)
+		if err != nil {
+			result.Result = ImportUnresolvable
+		} else {
+			result.Result, err = apply(targetIRI)
+		}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
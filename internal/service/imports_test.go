@@ -0,0 +1,79 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseAcctCSV(t *testing.T) {
+	for _, test := range []struct {
+		name, csv string
+		want      []string
+	}{
+		{"current", "Account address,Show boosts,Notify on new posts,Languages\nbob@remote.test,true,false,\ncarol@other.test,false,false,en\n", []string{"bob@remote.test", "carol@other.test"}},
+		{"older", "bob@remote.test\n carol@other.test \n\n", []string{"bob@remote.test", "carol@other.test"}},
+		{"crlf", "bob@remote.test\r\n", []string{"bob@remote.test"}},
+	} {
+		got, err := ParseAcctCSV(strings.NewReader(test.csv))
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+		} else if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: %q, want %q", test.name, got, test.want)
+		}
+	}
+	if _, err := ParseAcctCSV(strings.NewReader("\"bob@remote.test\n")); err == nil {
+		t.Error("parsed an unterminated quote")
+	}
+}
+
+func TestImportFollows(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	s.config.ImportInterval = 0
+	aliceIRI := register(t, s, "alice")
+	respondLocally(t, s, transport, aliceIRI)
+	carol := newTestPeer(t, transport, "https://remote.test/users/carol", "rsa")
+	dave := newTestPeer(t, transport, "https://remote.test/users/dave", "rsa")
+	s.webFingers.Store("carol@remote.test", webFingerResult{carol.iri, s.Now().Add(time.Hour)})
+	s.webFingers.Store("dave@remote.test", webFingerResult{dave.iri, s.Now().Add(time.Hour)})
+	following(t, s, aliceIRI, dave.iri)
+
+	results, err := s.ImportFollows(c, aliceIRI, strings.NewReader("Account address,Show boosts\ncarol@remote.test,true\ndave@remote.test,true\nnobody@"+testHostname+",true\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ImportResult{
+		{Acct: "carol@remote.test", Result: ImportFollowed},
+		{Acct: "dave@remote.test", Result: ImportAlreadyFollowing},
+		{Acct: "nobody@" + testHostname, Result: ImportUnresolvable},
+	}
+	for i := range results {
+		results[i].Error = ""
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("results %+v, want %+v", results, want)
+	}
+	var follows []string
+	for _, d := range transport.Delivered() {
+		var m map[string]interface{}
+		if err := json.Unmarshal(d.Body, &m); err == nil && m["type"] == "Follow" {
+			follows = append(follows, d.To.String()+" "+m["object"].(string))
+		}
+	}
+	if want := []string{carol.iri.String() + "/inbox " + carol.iri.String()}; !reflect.DeepEqual(follows, want) {
+		t.Errorf("Follows delivered %q, want %q", follows, want)
+	}
+
+	for _, csv := range []string{"", "Account address\n"} {
+		if _, err := s.ImportFollows(c, aliceIRI, strings.NewReader(csv)); err == nil {
+			t.Errorf("imported %q", csv)
+		}
+	}
+}
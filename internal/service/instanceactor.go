@@ -0,0 +1,100 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"mastogon/internal/db"
+
+	"github.com/go-fed/activity/streams"
+)
+
+// Requests we make for the server itself, rather than for one of our users,
+// are signed by our instance actor, as Mastodon's are: peers insisting on
+// signed fetches then still answer them. It's an Application at /actor,
+// made the first time it's needed.
+
+// instanceActorIRI returns the IRI of our instance actor.
+func (s *Service) instanceActorIRI() *url.URL {
+	return &url.URL{Scheme: "https", Host: s.db.Hostname(), Path: "/actor"}
+}
+
+// isInstanceActor reports whether `iri` is our instance actor, or one of its
+// boxes.
+func (s *Service) isInstanceActor(iri *url.URL) bool {
+	actorIRI := s.instanceActorIRI()
+	return s.db.IsLocalHost(iri.Host) &&
+		(iri.Path == actorIRI.Path || iri.Path == s.boxIRI(actorIRI, "inbox").Path ||
+			iri.Path == s.boxIRI(actorIRI, "outbox").Path)
+}
+
+// instanceActor returns our instance actor, making it, its boxes and its key
+// if we haven't yet.
+func (s *Service) instanceActor(c context.Context) (*url.URL, error) {
+	actorIRI := s.instanceActorIRI()
+	s.instanceActorMu.Lock()
+	defer s.instanceActorMu.Unlock()
+	if _, err := s.db.PrivateKey(actorIRI); err == nil {
+		return actorIRI, nil
+	}
+	key, publicKey, err := s.generateKey()
+	if err != nil {
+		return nil, err
+	}
+	app := streams.NewActivityStreamsApplication()
+	id := streams.NewJSONLDIdProperty()
+	id.Set(actorIRI)
+	app.SetJSONLDId(id)
+	preferredUsername := streams.NewActivityStreamsPreferredUsernameProperty()
+	preferredUsername.SetXMLSchemaString(s.db.Hostname())
+	app.SetActivityStreamsPreferredUsername(preferredUsername)
+	inbox := streams.NewActivityStreamsInboxProperty()
+	inbox.SetIRI(s.boxIRI(actorIRI, "inbox"))
+	app.SetActivityStreamsInbox(inbox)
+	outbox := streams.NewActivityStreamsOutboxProperty()
+	outbox.SetIRI(s.boxIRI(actorIRI, "outbox"))
+	app.SetActivityStreamsOutbox(outbox)
+	publicKeyProp, err := publicKeyProperty(actorIRI, publicKey)
+	if err != nil {
+		return nil, err
+	}
+	app.SetW3IDSecurityV1PublicKey(publicKeyProp)
+	if err := s.db.Create(c, app); err != nil {
+		return nil, err
+	}
+	for _, box := range []string{"inbox", "outbox"} {
+		if err := s.db.Create(c, newOrderedCollection(s.boxIRI(actorIRI, box))); err != nil {
+			return nil, err
+		}
+	}
+	s.db.SetPrivateKey(actorIRI, key)
+	return actorIRI, nil
+}
+
+// signingActor returns the local actor requests from `actorBoxIRI` are
+// signed as: the user or instance actor whose box it is, or for requests
+// made from no box at all, the instance actor. Users' boxes are under their
+// actor, so this is found from the path, without a scan of what we store.
+func (s *Service) signingActor(c context.Context, actorBoxIRI *url.URL) (*url.URL, error) {
+	if actorBoxIRI == nil || s.isInstanceActor(actorBoxIRI) {
+		return s.instanceActor(c)
+	}
+	if !s.db.IsLocalHost(actorBoxIRI.Host) {
+		return nil, fmt.Errorf("actor for box %s: %w", actorBoxIRI, db.ErrNotOwned)
+	}
+	rest := strings.TrimPrefix(actorBoxIRI.Path, "/users/")
+	username, box, _ := strings.Cut(rest, "/")
+	if rest == actorBoxIRI.Path || (box != "inbox" && box != "outbox") {
+		return nil, fmt.Errorf("actor for box %s: %w", actorBoxIRI, db.ErrNotFound)
+	}
+	account, err := s.db.Account(username)
+	if err != nil {
+		return nil, fmt.Errorf("actor for box %s: %w", actorBoxIRI, err)
+	}
+	return account.ActorIRI, nil
+}
@@ -0,0 +1,173 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"mastogon/internal/db"
+)
+
+// Work we do in the background, such as computing trends, runs through
+// Every and At, so it all stops together at Shutdown. Work that has to be
+// done even should we shut down before it's due is stored in the database as
+// a job instead, naming its kind for the handler to do it: see ScheduleJob.
+// It's done once the service is started again over the same database, which
+// the memory backend doesn't outlive.
+
+// JobHandler does a stored job of the kind it handles, given its payload.
+type JobHandler func(c context.Context, payload string) error
+
+// jobRunner runs our background work.
+type jobRunner struct {
+	mu sync.Mutex
+	// Cancelled at Shutdown, cancelling the contexts of all the work.
+	ctx     context.Context
+	cancel  context.CancelFunc
+	stopped bool
+	running sync.WaitGroup
+	// The handlers of stored jobs, keyed by kind.
+	handlers map[string]JobHandler
+}
+
+// begin returns the context for a new piece of work, and what cancels it,
+// unless we're shutting down. The work must call running.Done once over.
+func (q *jobRunner) begin() (context.Context, context.CancelFunc, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.stopped {
+		return nil, nil, false
+	}
+	if q.ctx == nil {
+		q.ctx, q.cancel = context.WithCancel(context.Background())
+	}
+	c, cancel := context.WithCancel(db.WithLockHolder(q.ctx))
+	q.running.Add(1)
+	return c, cancel, true
+}
+
+// Every calls `fn` every `d`, starting `d` from now, until the returned
+// function is called or Shutdown. The context `fn` gets is cancelled then.
+func (s *Service) Every(d time.Duration, fn func(c context.Context)) (cancel func()) {
+	c, cancel, ok := s.jobs.begin()
+	if !ok {
+		return func() {}
+	}
+	go func() {
+		defer s.jobs.running.Done()
+		ticker := time.NewTicker(d)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				fn(c)
+			case <-c.Done():
+				return
+			}
+		}
+	}()
+	return cancel
+}
+
+// At calls `fn` once, at `t`, or straight away if that's past, unless the
+// returned function is called or Shutdown comes first. The context `fn` gets
+// is cancelled then.
+func (s *Service) At(t time.Time, fn func(c context.Context)) (cancel func()) {
+	c, cancel, ok := s.jobs.begin()
+	if !ok {
+		return func() {}
+	}
+	go func() {
+		defer s.jobs.running.Done()
+		defer cancel()
+		timer := time.NewTimer(t.Sub(s.Now()))
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			fn(c)
+		case <-c.Done():
+		}
+	}()
+	return cancel
+}
+
+// HandleJobs has stored jobs of `kind` done by `handler`. Handlers should
+// all be in place before StartJobs.
+func (s *Service) HandleJobs(kind string, handler JobHandler) {
+	q := &s.jobs
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.handlers == nil {
+		q.handlers = make(map[string]JobHandler)
+	}
+	q.handlers[kind] = handler
+}
+
+// ScheduleJob stores a job of `kind` to be done with `payload` at `t`, and
+// returns its ID. A job not done by Shutdown is done after the next
+// StartJobs, straight away if it's overdue by then.
+func (s *Service) ScheduleJob(kind, payload string, t time.Time) string {
+	j := &db.Job{Kind: kind, Payload: payload, At: t}
+	s.db.CreateJob(j)
+	s.runJob(j)
+	return j.ID
+}
+
+// CancelJob drops the stored job `id`, and reports whether it was still to
+// be done.
+func (s *Service) CancelJob(id string) bool {
+	return s.db.TakeJob(id)
+}
+
+// StartJobs schedules the jobs stored in the database, such as those left
+// by a service shut down before they were due.
+func (s *Service) StartJobs() {
+	for _, j := range s.db.Jobs() {
+		s.runJob(j)
+	}
+}
+
+// runJob does the stored job `j` when it's due, unless it's cancelled
+// first. Should we be shutting down by then, it's left stored.
+func (s *Service) runJob(j *db.Job) {
+	s.At(j.At, func(c context.Context) {
+		if !s.db.TakeJob(j.ID) {
+			return
+		}
+		s.jobs.mu.Lock()
+		handler := s.jobs.handlers[j.Kind]
+		s.jobs.mu.Unlock()
+		if handler == nil {
+			log.Printf("dropping job %s: nothing handles %q jobs", j.ID, j.Kind)
+			return
+		}
+		if err := handler(c, j.Payload); err != nil {
+			log.Printf("doing %s job %s: %s", j.Kind, j.ID, err)
+		}
+	})
+}
+
+// stopJobs cancels all the background work, and waits for what's running
+// to return or `c` to be done.
+func (s *Service) stopJobs(c context.Context) {
+	q := &s.jobs
+	q.mu.Lock()
+	q.stopped = true
+	if q.cancel != nil {
+		q.cancel()
+	}
+	q.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		q.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-c.Done():
+	}
+}
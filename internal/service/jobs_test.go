@@ -0,0 +1,93 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// ticks returns a function sending the contexts it's called with on the
+// returned channel.
+func ticks() (func(c context.Context), chan context.Context) {
+	ch := make(chan context.Context, 100)
+	return func(c context.Context) { ch <- c }, ch
+}
+
+// wait returns the next context on `ch`, failing if there's none soon.
+func wait(t *testing.T, ch chan context.Context) context.Context {
+	t.Helper()
+	select {
+	case c := <-ch:
+		return c
+	case <-time.After(5 * time.Second):
+		t.Fatal("not called")
+		return nil
+	}
+}
+
+// quiet fails if anything comes on `ch` for a while.
+func quiet(t *testing.T, ch chan context.Context) {
+	t.Helper()
+	select {
+	case <-ch:
+		t.Error("called after being stopped")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestEvery(t *testing.T) {
+	s, _ := newTestService(t)
+	fn, ch := ticks()
+	cancel := s.Every(time.Millisecond, fn)
+	var c context.Context
+	for i := 0; i < 3; i++ {
+		c = wait(t, ch)
+	}
+	cancel()
+	select {
+	case <-c.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("context not cancelled")
+	}
+	// One tick may have been on its way.
+	time.Sleep(10 * time.Millisecond)
+	for len(ch) > 0 {
+		<-ch
+	}
+	quiet(t, ch)
+}
+
+func TestEveryStopsAtShutdown(t *testing.T) {
+	s, _ := newTestService(t)
+	fn, ch := ticks()
+	s.Every(time.Millisecond, fn)
+	c := wait(t, ch)
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if c.Err() == nil {
+		t.Error("context not cancelled at Shutdown")
+	}
+	// Shutdown waits for the work to return.
+	for len(ch) > 0 {
+		<-ch
+	}
+	quiet(t, ch)
+
+	s.Every(time.Millisecond, fn)
+	quiet(t, ch)
+}
+
+func TestAt(t *testing.T) {
+	s, _ := newTestService(t)
+	fn, ch := ticks()
+	s.At(s.Now().Add(-time.Hour), fn)
+	wait(t, ch)
+
+	cancel := s.At(s.Now().Add(time.Hour), fn)
+	cancel()
+	quiet(t, ch)
+}
@@ -0,0 +1,160 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"log"
+	"net/url"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// JoinGroup sends a Join from the local actor at `actorIRI` to the Group at
+// `groupIRI`. Once the group accepts, it's in the actor's following
+// collection, as a followed group would be.
+func (s *Service) JoinGroup(c context.Context, actorIRI, groupIRI *url.URL) error {
+	join := streams.NewActivityStreamsJoin()
+	actor := streams.NewActivityStreamsActorProperty()
+	actor.AppendIRI(actorIRI)
+	join.SetActivityStreamsActor(actor)
+	object := streams.NewActivityStreamsObjectProperty()
+	object.AppendIRI(groupIRI)
+	join.SetActivityStreamsObject(object)
+	to := streams.NewActivityStreamsToProperty()
+	to.AppendIRI(groupIRI)
+	join.SetActivityStreamsTo(to)
+	_, err := s.actor.Send(c, s.boxIRI(actorIRI, "outbox"), join)
+	return err
+}
+
+// accepted runs after Go-Fed's default handling of an Accept, which only
+// knows about Follows, and sees to the other activities it may accept.
+func (s *Service) accepted(c context.Context, a vocab.ActivityStreamsAccept) error {
+	s.received(a)
+	return s.answered(c, a, true)
+}
+
+// rejected is accepted for Rejects.
+func (s *Service) rejected(c context.Context, r vocab.ActivityStreamsReject) error {
+	s.received(r)
+	return s.answered(c, r, false)
+}
+
+// answered dispatches each activity the Accept or Reject `answer` is of on
+// its type. Only activities we sent are answered, as we stored them: what
+// a peer embeds may not be what we sent, if we sent it at all.
+func (s *Service) answered(c context.Context, answer vocab.Type, accepted bool) error {
+	for _, activity := range s.ownActivities(c, answer) {
+		var err error
+		switch activity.GetTypeName() {
+		case "Follow":
+			// Go-Fed has seen to it.
+			if accepted {
+				for _, actorIRI := range authorsOf(answer) {
+					s.emit(Event{Kind: EventFollowAccepted, Activity: activity, Actor: actorIRI})
+				}
+			}
+		case "Join":
+			err = s.answeredJoin(c, answer, activity, accepted)
+		default:
+			log.Printf("ignoring %s of %s", answer.GetTypeName(), activity.GetTypeName())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// answeredJoin adds the groups that accepted the `join` by one of our actors
+// to their following collection, or takes those that rejected it out. Only
+// a group itself may answer a Join of it.
+func (s *Service) answeredJoin(c context.Context, answer, join vocab.Type, accepted bool) error {
+	answerers := make(map[string]bool)
+	for _, actorIRI := range authorsOf(answer) {
+		answerers[actorIRI.String()] = true
+	}
+	var groups []*url.URL
+	for _, groupIRI := range objectsOf(join) {
+		if answerers[groupIRI.String()] {
+			groups = append(groups, groupIRI)
+		}
+	}
+	if len(groups) == 0 {
+		return nil
+	}
+	for _, actorIRI := range authorsOf(join) {
+		if owns, err := s.db.Owns(c, actorIRI); err != nil || !owns {
+			continue
+		}
+		err := s.editCollection(c, s.boxIRI(actorIRI, "following"), func(items []*url.URL) []*url.URL {
+			kept := items[:0]
+			for _, item := range items {
+				if !containsIRI(groups, item) {
+					kept = append(kept, item)
+				}
+			}
+			if accepted {
+				kept = append(append([]*url.URL{}, groups...), kept...)
+			}
+			return kept
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ownActivities returns the objects of the activity `t` that are ours, as
+// we store them, whether `t` embeds them or gives their IRIs.
+func (s *Service) ownActivities(c context.Context, t vocab.Type) (activities []vocab.Type) {
+	for _, id := range objectsOf(t) {
+		if owns, err := s.db.Owns(c, id); err != nil || !owns {
+			continue
+		}
+		if activity, err := s.db.Get(c, id); err == nil {
+			activities = append(activities, activity)
+		}
+	}
+	return
+}
+
+// embeddedOrStored returns the objects of the activity `t`, looking up those
+// given by IRI in what we store.
+func (s *Service) embeddedOrStored(c context.Context, t vocab.Type) (objects []vocab.Type) {
+	a, ok := t.(interface {
+		GetActivityStreamsObject() vocab.ActivityStreamsObjectProperty
+	})
+	if !ok || a.GetActivityStreamsObject() == nil {
+		return nil
+	}
+	for iter := a.GetActivityStreamsObject().Begin(); iter != a.GetActivityStreamsObject().End(); iter = iter.Next() {
+		if o := iter.GetType(); o != nil {
+			objects = append(objects, o)
+			continue
+		}
+		id, err := pub.ToId(iter)
+		if err != nil {
+			continue
+		}
+		if o, err := s.db.Get(c, id); err == nil {
+			objects = append(objects, o)
+		}
+	}
+	return
+}
+
+// containsIRI reports whether `iri` is among `iris`.
+func containsIRI(iris []*url.URL, iri *url.URL) bool {
+	for _, i := range iris {
+		if i.String() == iri.String() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestAnsweredJoin(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	respondLocally(t, s, transport, aliceIRI)
+	group := newTestPeer(t, transport, "https://remote.test/groups/gardening", "rsa")
+	mallory := newTestPeer(t, transport, "https://evil.test/users/mallory", "rsa")
+	inboxIRI := s.boxIRI(aliceIRI, "inbox")
+
+	if err := s.JoinGroup(c, aliceIRI, group.iri); err != nil {
+		t.Fatal(err)
+	}
+	var joinID string
+	for _, d := range transport.Delivered() {
+		var m map[string]interface{}
+		if err := json.Unmarshal(d.Body, &m); err == nil && m["type"] == "Join" {
+			joinID, _ = m["id"].(string)
+		}
+	}
+	if joinID == "" {
+		t.Fatal("no Join delivered to the group")
+	}
+	answer := func(p *testPeer, answerType, id string, object interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"@context": "https://www.w3.org/ns/activitystreams",
+			"id":       id,
+			"type":     answerType,
+			"actor":    p.iri.String(),
+			"object":   object,
+			"to":       aliceIRI.String(),
+		}
+	}
+	joined := func() bool {
+		following, err := s.Following(c, aliceIRI, aliceIRI)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return containsIRI(following, group.iri)
+	}
+
+	for _, test := range []struct {
+		name   string
+		p      *testPeer
+		answer map[string]interface{}
+		joined bool
+	}{
+		// A Join alice never sent, embedded as if she had.
+		{"a made up Join", group, answer(group, "Accept", group.iri.String()+"/accepts/0", map[string]interface{}{
+			"id":     "https://remote.test/joins/1",
+			"type":   "Join",
+			"actor":  aliceIRI.String(),
+			"object": group.iri.String(),
+		}), false},
+		{"someone else accepting", mallory, answer(mallory, "Accept", "https://evil.test/accepts/1", joinID), false},
+		{"the group accepting", group, answer(group, "Accept", group.iri.String()+"/accepts/1", joinID), true},
+		{"the group rejecting", group, answer(group, "Reject", group.iri.String()+"/rejects/1", map[string]interface{}{
+			"id":     joinID,
+			"type":   "Join",
+			"actor":  aliceIRI.String(),
+			"object": group.iri.String(),
+		}), false},
+	} {
+		deliver(t, s, test.p, inboxIRI, test.answer)
+		if got := joined(); got != test.joined {
+			t.Errorf("after %s, alice in the group: %t, want %t", test.name, got, test.joined)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// The context every document we send starts with.
+const activityStreamsContext = "https://www.w3.org/ns/activitystreams"
+
+// ldExtension is a vocabulary beyond ActivityStreams proper that documents we
+// send may use, and which then has to be in their `@context` for peers to
+// understand them.
+type ldExtension struct {
+	// The properties and types that call for the extension.
+	Terms []string
+	// What the extension adds to the `@context`: either the IRI of a context
+	// document, or term definitions to inline, for vocabularies such as
+	// Mastodon's that have no document to fetch.
+	Context interface{}
+}
+
+// The extensions we know, in the order their contexts go in.
+var ldExtensions []ldExtension
+
+// registerLDExtension makes documents using any of `e`'s terms carry its
+// context. Call it from an init function next to the code using the terms.
+func registerLDExtension(e ldExtension) {
+	ldExtensions = append(ldExtensions, e)
+}
+
+func init() {
+	registerLDExtension(ldExtension{
+		Terms:   []string{"publicKey", "publicKeyPem", "signature"},
+		Context: "https://w3id.org/security/v1",
+	})
+	// Terms Mastodon uses from drafts of ActivityStreams that didn't make it
+	// into the published context.
+	registerLDExtension(ldExtension{
+		Terms: []string{"manuallyApprovesFollowers", "sensitive", "Hashtag", "movedTo", "alsoKnownAs"},
+		Context: map[string]interface{}{
+			"manuallyApprovesFollowers": "as:manuallyApprovesFollowers",
+			"sensitive":                 "as:sensitive",
+			"Hashtag":                   "as:Hashtag",
+			"movedTo":                   map[string]interface{}{"@id": "as:movedTo", "@type": "@id"},
+			"alsoKnownAs":               map[string]interface{}{"@id": "as:alsoKnownAs", "@type": "@id"},
+		},
+	})
+	registerLDExtension(ldExtension{
+		Terms: []string{"featured", "featuredTags", "discoverable", "Emoji"},
+		Context: map[string]interface{}{
+			"toot":         "http://joinmastodon.org/ns#",
+			"featured":     map[string]interface{}{"@id": "toot:featured", "@type": "@id"},
+			"featuredTags": map[string]interface{}{"@id": "toot:featuredTags", "@type": "@id"},
+			"discoverable": "toot:discoverable",
+			"Emoji":        "toot:Emoji",
+		},
+	})
+	registerLDExtension(ldExtension{
+		Terms: []string{"PropertyValue"},
+		Context: map[string]interface{}{
+			"schema":        "http://schema.org#",
+			"PropertyValue": "schema:PropertyValue",
+			"value":         "schema:value",
+		},
+	})
+}
+
+// Context IRIs Go-Fed may put in documents that peers can't dereference,
+// their terms being inlined by our extensions instead.
+var unfetchableContexts = map[string]bool{
+	"http://joinmastodon.org/ns": true,
+}
+
+// withLDContext sets the `@context` of the serialized document `m` to cover
+// ActivityStreams and every extension `m` uses, anywhere within it. Contexts
+// Go-Fed put there are kept, unless peers couldn't fetch them.
+func withLDContext(m map[string]interface{}) {
+	used := make(map[string]bool)
+	collectTerms(m, used)
+
+	ctx := []interface{}{activityStreamsContext}
+	seen := map[string]bool{activityStreamsContext: true}
+	addIRI := func(iri string) {
+		if !seen[iri] && !unfetchableContexts[iri] {
+			seen[iri] = true
+			ctx = append(ctx, iri)
+		}
+	}
+	terms := make(map[string]interface{})
+	mergeTerms := func(defs map[string]interface{}) {
+		for k, v := range defs {
+			terms[k] = v
+		}
+	}
+	switch existing := m["@context"].(type) {
+	case string:
+		addIRI(existing)
+	case []interface{}:
+		for _, e := range existing {
+			switch e := e.(type) {
+			case string:
+				addIRI(e)
+			case map[string]interface{}:
+				mergeTerms(e)
+			}
+		}
+	case map[string]interface{}:
+		mergeTerms(existing)
+	}
+	for _, e := range ldExtensions {
+		if !usesAny(used, e.Terms) {
+			continue
+		}
+		switch c := e.Context.(type) {
+		case string:
+			addIRI(c)
+		case map[string]interface{}:
+			mergeTerms(c)
+		}
+	}
+	if len(terms) > 0 {
+		ctx = append(ctx, terms)
+	}
+	if len(ctx) == 1 {
+		m["@context"] = activityStreamsContext
+	} else {
+		m["@context"] = ctx
+	}
+}
+
+// collectTerms adds the properties and types used in `v` to `used`.
+func collectTerms(v interface{}, used map[string]bool) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			if k == "@context" {
+				continue
+			}
+			used[k] = true
+			if k == "type" {
+				switch t := e.(type) {
+				case string:
+					used[t] = true
+				case []interface{}:
+					for _, t := range t {
+						if t, ok := t.(string); ok {
+							used[t] = true
+						}
+					}
+				}
+				continue
+			}
+			collectTerms(e, used)
+		}
+	case []interface{}:
+		for _, e := range v {
+			collectTerms(e, used)
+		}
+	}
+}
+
+func usesAny(used map[string]bool, terms []string) bool {
+	for _, t := range terms {
+		if used[t] {
+			return true
+		}
+	}
+	return false
+}
+
+// withLDContextJSON is withLDContext, after withLanguageMaps, for a document
+// already marshalled, which comes out as marshalCanonical has it: what we
+// deliver is signed and digested as it comes out of here. Documents it can't
+// make out are returned as they are.
+func withLDContextJSON(b []byte) []byte {
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return b
+	}
+	withLanguageMaps(m)
+	withLDContext(m)
+	out, err := marshalCanonical(m)
+	if err != nil {
+		return b
+	}
+	return out
+}
+
+// marshalCanonical marshals `v` the one way we serialize anything we sign or
+// digest, so the same document always comes out as the same bytes: object
+// keys sorted, as encoding/json has them, HTML characters left unescaped, as
+// JSON-LD processors leave them, and no trailing newline.
+func marshalCanonical(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// Natural language properties, which may come with a map of their value in
+// each language.
+var languageMapped = []string{"content", "name", "summary"}
+
+// withLanguageMaps moves the values in each language of the natural language
+// properties of the serialized document `m`, and of the objects embedded in
+// it, to their maps: `contentMap` and the like. Go-Fed keeps them with the
+// plain value and serializes them alongside it, where peers, and Go-Fed
+// itself, don't look for them.
+func withLanguageMaps(m map[string]interface{}) {
+	for _, p := range languageMapped {
+		values, ok := m[p].([]interface{})
+		if !ok {
+			continue
+		}
+		var plain []interface{}
+		languages := make(map[string]interface{})
+		for _, v := range values {
+			// As Go-Fed serializes them, or as they're unmarshalled.
+			switch byLanguage := v.(type) {
+			case map[string]string:
+				for language, s := range byLanguage {
+					languages[language] = s
+				}
+			case map[string]interface{}:
+				for language, s := range byLanguage {
+					languages[language] = s
+				}
+			default:
+				plain = append(plain, v)
+			}
+		}
+		if len(languages) == 0 {
+			continue
+		}
+		switch len(plain) {
+		case 0:
+			delete(m, p)
+		case 1:
+			m[p] = plain[0]
+		default:
+			m[p] = plain
+		}
+		m[p+"Map"] = languages
+	}
+	for _, o := range serializedValues(m["object"]) {
+		if om, ok := o.(map[string]interface{}); ok {
+			withLanguageMaps(om)
+		}
+	}
+}
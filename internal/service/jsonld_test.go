@@ -0,0 +1,201 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+func TestWithLanguageMaps(t *testing.T) {
+	m := map[string]interface{}{
+		"type":    "Create",
+		"content": []interface{}{"hello", map[string]string{"en": "hello"}},
+		"object": map[string]interface{}{
+			"type":    "Note",
+			"content": []interface{}{"bonjour", map[string]interface{}{"fr": "bonjour"}},
+			"summary": "plain",
+		},
+	}
+	withLanguageMaps(m)
+	want := map[string]interface{}{
+		"type":       "Create",
+		"content":    "hello",
+		"contentMap": map[string]interface{}{"en": "hello"},
+		"object": map[string]interface{}{
+			"type":       "Note",
+			"content":    "bonjour",
+			"contentMap": map[string]interface{}{"fr": "bonjour"},
+			"summary":    "plain",
+		},
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("withLanguageMaps left %v, want %v", m, want)
+	}
+}
+
+func TestExtendedKeepsLanguages(t *testing.T) {
+	note := streams.NewActivityStreamsNote()
+	content := streams.NewActivityStreamsContentProperty()
+	content.AppendXMLSchemaString("bonjour")
+	content.AppendRDFLangString(map[string]string{"fr": "bonjour"})
+	note.SetActivityStreamsContent(content)
+
+	out, err := extended(context.Background(), note, func(m map[string]interface{}) {
+		m["sensitive"] = true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var plain []string
+	var languages []map[string]string
+	got := out.(vocab.ActivityStreamsNote).GetActivityStreamsContent()
+	for iter := got.Begin(); iter != got.End(); iter = iter.Next() {
+		switch {
+		case iter.IsXMLSchemaString():
+			plain = append(plain, iter.GetXMLSchemaString())
+		case iter.IsRDFLangString():
+			languages = append(languages, iter.GetRDFLangString())
+		default:
+			t.Errorf("content has a value neither plain nor in a language")
+		}
+	}
+	if !reflect.DeepEqual(plain, []string{"bonjour"}) || !reflect.DeepEqual(languages, []map[string]string{{"fr": "bonjour"}}) {
+		t.Errorf("content = %q and %v, want bonjour and fr:bonjour", plain, languages)
+	}
+	if !Sensitive(out) {
+		t.Error("lost the edit")
+	}
+}
+
+func TestWithLDContext(t *testing.T) {
+	const security = "https://w3id.org/security/v1"
+	asTerms := map[string]interface{}{
+		"manuallyApprovesFollowers": "as:manuallyApprovesFollowers",
+		"sensitive":                 "as:sensitive",
+		"Hashtag":                   "as:Hashtag",
+		"movedTo":                   map[string]interface{}{"@id": "as:movedTo", "@type": "@id"},
+		"alsoKnownAs":               map[string]interface{}{"@id": "as:alsoKnownAs", "@type": "@id"},
+	}
+	schemaTerms := map[string]interface{}{
+		"schema":        "http://schema.org#",
+		"PropertyValue": "schema:PropertyValue",
+		"value":         "schema:value",
+	}
+	merged := func(defs ...map[string]interface{}) map[string]interface{} {
+		terms := make(map[string]interface{})
+		for _, d := range defs {
+			for k, v := range d {
+				terms[k] = v
+			}
+		}
+		return terms
+	}
+	for _, test := range []struct {
+		name string
+		m    map[string]interface{}
+		want interface{}
+	}{
+		{
+			"plain",
+			map[string]interface{}{"type": "Note", "content": "hello"},
+			activityStreamsContext,
+		},
+		{
+			"hashtag",
+			map[string]interface{}{
+				"type": "Create",
+				"object": map[string]interface{}{
+					"type": "Note",
+					"tag":  []interface{}{map[string]interface{}{"type": "Hashtag", "name": "#go"}},
+				},
+			},
+			[]interface{}{activityStreamsContext, asTerms},
+		},
+		{
+			"property value",
+			map[string]interface{}{
+				"type":       "Person",
+				"attachment": []interface{}{map[string]interface{}{"type": "PropertyValue", "name": "site", "value": "x"}},
+			},
+			[]interface{}{activityStreamsContext, schemaTerms},
+		},
+		{
+			"hashtag and property value",
+			map[string]interface{}{
+				"type":       []interface{}{"Person"},
+				"attachment": map[string]interface{}{"type": "PropertyValue", "name": "site", "value": "x"},
+				"tag":        map[string]interface{}{"type": "Hashtag", "name": "#go"},
+			},
+			[]interface{}{activityStreamsContext, merged(asTerms, schemaTerms)},
+		},
+		{
+			"key, with Go-Fed's context",
+			map[string]interface{}{
+				"@context":  []interface{}{activityStreamsContext, "http://joinmastodon.org/ns", security},
+				"type":      "Person",
+				"publicKey": map[string]interface{}{"id": "k", "publicKeyPem": "pem"},
+			},
+			[]interface{}{activityStreamsContext, security},
+		},
+		{
+			"terms already inlined",
+			map[string]interface{}{
+				"@context": []interface{}{activityStreamsContext, map[string]interface{}{"blurhash": "toot:blurhash"}},
+				"type":     "Note",
+			},
+			[]interface{}{activityStreamsContext, map[string]interface{}{"blurhash": "toot:blurhash"}},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			withLDContext(test.m)
+			if got := test.m["@context"]; !reflect.DeepEqual(got, test.want) {
+				t.Errorf("@context = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMarshalCanonical(t *testing.T) {
+	c := context.Background()
+	note, err := streams.ToType(c, map[string]interface{}{
+		"@context":     activityStreamsContext,
+		"id":           "https://mastogon.test/notes/1",
+		"type":         "Note",
+		"attributedTo": "https://mastogon.test/users/alice",
+		"content":      "<p>a & b</p>",
+		"to":           []interface{}{"https://www.w3.org/ns/activitystreams#Public"},
+		"tag":          []interface{}{map[string]interface{}{"type": "Mention", "href": "https://remote.test/users/bob", "name": "@bob"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = `{"@context":"https://www.w3.org/ns/activitystreams","attributedTo":"https://mastogon.test/users/alice","content":"<p>a & b</p>","id":"https://mastogon.test/notes/1",` +
+		`"tag":{"href":"https://remote.test/users/bob","name":"@bob","type":"Mention"},"to":"https://www.w3.org/ns/activitystreams#Public","type":"Note"}`
+	// Go-Fed builds its maps anew each time, in no particular order.
+	for i := 0; i < 20; i++ {
+		m, err := streams.Serialize(note)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := marshalCanonical(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != want {
+			t.Fatalf("run %d marshalled %s, want %s", i, b, want)
+		}
+	}
+
+	// However what we deliver was marshalled before, it comes out the same.
+	a := withLDContextJSON([]byte(`{"type":"Note","content":"<p>hi</p>","id":"https://mastogon.test/notes/2"}`))
+	b := withLDContextJSON([]byte(`{"id": "https://mastogon.test/notes/2", "content": "<p>hi</p>", "type": "Note"}`))
+	if string(a) != string(b) {
+		t.Errorf("the same document came out as %s and %s", a, b)
+	}
+}
@@ -0,0 +1,269 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/piprate/json-gold/ld"
+)
+
+// Mastodon also signs the public activities it sends with a Linked Data
+// Signature, an RsaSignature2017, so they can be forwarded: the HTTP
+// signature on a forwarded activity is the forwarder's, and says nothing of
+// who wrote it. LD signatures sign the document as RDF, canonicalized with
+// URDNA2015, which json-gold does for us unless Config.LDCanonicalizer is
+// another. They're on their way out, so we only check them if
+// Config.LDSignatures says to, and only sign ours if Config.LDSignCreates
+// does.
+
+// The context the options of an RsaSignature2017 are read in.
+const identityContext = "https://w3id.org/identity/v1"
+
+// LDCanonicalizer turns JSON-LD documents into canonical RDF, for Linked
+// Data Signatures. A wrapper around json-gold's Normalize with the URDNA2015
+// algorithm is one.
+type LDCanonicalizer interface {
+	// Canonicalize returns `doc` as URDNA2015-canonicalized N-Quads.
+	Canonicalize(c context.Context, doc map[string]interface{}) (string, error)
+}
+
+// urdna2015 is the LDCanonicalizer we use unless told otherwise: json-gold,
+// reading the contexts documents name as we fetch anything else, and keeping
+// them, since they hardly ever change and every signature needs them.
+type urdna2015 struct {
+	s *Service
+}
+
+func (u urdna2015) Canonicalize(c context.Context, doc map[string]interface{}) (string, error) {
+	options := ld.NewJsonLdOptions("")
+	options.Algorithm = ld.AlgorithmURDNA2015
+	options.Format = "application/n-quads"
+	options.DocumentLoader = ldContextLoader{c, u.s}
+	nquads, err := ld.NewJsonLdProcessor().Normalize(doc, options)
+	if err != nil {
+		return "", err
+	}
+	s, ok := nquads.(string)
+	if !ok {
+		return "", errors.New("canonicalizing gave no N-Quads")
+	}
+	return s, nil
+}
+
+// ldContextLoader is json-gold's DocumentLoader for the contexts documents
+// name, fetched as by `s`.
+type ldContextLoader struct {
+	c context.Context
+	s *Service
+}
+
+func (l ldContextLoader) LoadDocument(iri string) (*ld.RemoteDocument, error) {
+	if doc, ok := l.s.ldContexts.Load(iri); ok {
+		return &ld.RemoteDocument{DocumentURL: iri, Document: doc}, nil
+	}
+	u, err := url.Parse(iri)
+	if err != nil {
+		return nil, err
+	}
+	b, err := l.s.fetchPlain(l.c, u)
+	if err != nil {
+		return nil, fmt.Errorf("fetching the context %s: %w", iri, err)
+	}
+	doc, err := ld.DocumentFromReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("reading the context %s: %w", iri, err)
+	}
+	l.s.ldContexts.Store(iri, doc)
+	return &ld.RemoteDocument{DocumentURL: iri, Document: doc}, nil
+}
+
+// ldCanonicalizer returns what canonicalizes documents for LD signatures.
+func (s *Service) ldCanonicalizer() LDCanonicalizer {
+	if s.config.LDCanonicalizer != nil {
+		return s.config.LDCanonicalizer
+	}
+	return urdna2015{s}
+}
+
+// deliveredByActor reports whether the delivery `r` to our inbox at
+// `inboxIRI`, signed by `signer`, comes from its actors: either it has the
+// one, and they signed the request, or it was forwarded and carries their LD
+// signature, which we only check with Config.LDSignatures. It returns the
+// actor then, or the signer for activities without one.
+func (s *Service) deliveredByActor(c context.Context, inboxIRI *url.URL, r *http.Request, signer *url.URL) (*url.URL, bool) {
+	body, err := r.GetBody()
+	if err != nil {
+		return nil, false
+	}
+	var m map[string]interface{}
+	if err := json.NewDecoder(body).Decode(&m); err != nil {
+		return nil, false
+	}
+	actorIRIs := irisOf(m["actor"])
+	if len(actorIRIs) == 0 {
+		return signer, true
+	}
+	if len(actorIRIs) > 1 {
+		log.Printf("refusing delivery to %s with several actors, signed by %s", inboxIRI, signer)
+		return nil, false
+	}
+	actorIRI := actorIRIs[0]
+	if actorIRI.String() == signer.String() {
+		return signer, true
+	}
+	if !s.config.LDSignatures {
+		log.Printf("refusing delivery to %s by %s, signed by %s", inboxIRI, actorIRI, signer)
+		return nil, false
+	}
+	if err := s.verifyLDSignature(c, inboxIRI, actorIRI, m); err != nil {
+		log.Printf("refusing delivery to %s by %s, signed by %s: %s", inboxIRI, actorIRI, signer, err)
+		return nil, false
+	}
+	return actorIRI, true
+}
+
+// verifyLDSignature checks the document `m` carries an RsaSignature2017 by
+// the actor at `actorIRI`, fetching their key as the local actor owning
+// `boxIRI`. As with HTTP signatures, a cached key failing to verify is
+// fetched again, in case it was rotated.
+func (s *Service) verifyLDSignature(c context.Context, boxIRI, actorIRI *url.URL, m map[string]interface{}) error {
+	sig, ok := m["signature"].(map[string]interface{})
+	if !ok {
+		return errors.New("no LD signature")
+	}
+	if sig["type"] != "RsaSignature2017" {
+		return errors.New("unsupported LD signature type")
+	}
+	creator, _ := sig["creator"].(string)
+	value, _ := sig["signatureValue"].(string)
+	sigBytes, err := base64.StdEncoding.DecodeString(value)
+	if creator == "" || err != nil {
+		return errors.New("malformed LD signature")
+	}
+	hash, err := s.ldSignedHash(c, m, sig)
+	if err != nil {
+		return err
+	}
+	verify := func(rk *remoteKey) error {
+		if rk.owner.String() != actorIRI.String() {
+			return errors.New("LD signature isn't by the actor")
+		}
+		key, ok := rk.key.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("RsaSignature2017 needs an RSA key")
+		}
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, hash, sigBytes)
+	}
+	rk, cached, err := s.publicKey(c, boxIRI, creator, false)
+	if err != nil {
+		return err
+	}
+	err = verify(rk)
+	if err != nil && cached && s.mayRefetchKey(rk) {
+		if rk, _, err = s.publicKey(c, boxIRI, creator, true); err != nil {
+			return err
+		}
+		err = verify(rk)
+	}
+	return err
+}
+
+// ldSignedHash returns the SHA-256 hash an RsaSignature2017 `sig` of the
+// document `m` signs: that of the hex hashes of its options, the signature
+// less its type, id and value, and of the document less its signature, each
+// canonicalized.
+func (s *Service) ldSignedHash(c context.Context, m, sig map[string]interface{}) ([]byte, error) {
+	options := map[string]interface{}{"@context": identityContext}
+	for k, v := range sig {
+		if k != "type" && k != "id" && k != "signatureValue" {
+			options[k] = v
+		}
+	}
+	doc := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		if k != "signature" {
+			doc[k] = v
+		}
+	}
+	var signed []byte
+	for _, d := range []map[string]interface{}{options, doc} {
+		nquads, err := s.ldCanonicalizer().Canonicalize(c, d)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256([]byte(nquads))
+		signed = append(signed, hex.EncodeToString(sum[:])...)
+	}
+	sum := sha256.Sum256(signed)
+	return sum[:], nil
+}
+
+// withLDSignature returns the activity `b`, about to be delivered from the
+// local actor owning `boxIRI`, with their LD signature if Config.LDSignCreates
+// asks for one and it's a public Create, which older peers may want to
+// forward. Activities that can't be signed, say because the actor's key
+// isn't an RSA one, go out as they are.
+func (s *Service) withLDSignature(c context.Context, boxIRI *url.URL, b []byte) []byte {
+	if !s.config.LDSignCreates {
+		return b
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil || m["type"] != "Create" {
+		return b
+	}
+	if t, err := streams.ToType(c, m); err != nil || !isPublic(t) {
+		return b
+	}
+	actorIRI, err := s.db.ActorForOutbox(c, boxIRI)
+	if err != nil {
+		return b
+	}
+	key, err := s.db.PrivateKey(actorIRI)
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if err != nil || !ok {
+		return b
+	}
+	keyIRI := *actorIRI
+	keyIRI.Fragment = "main-key"
+	sig := map[string]interface{}{
+		"type":    "RsaSignature2017",
+		"creator": keyIRI.String(),
+		"created": s.Now().UTC().Format("2006-01-02T15:04:05Z"),
+	}
+	// The signature's terms have to be in the context it signs.
+	m["signature"] = sig
+	withLDContext(m)
+	delete(m, "signature")
+	hash, err := s.ldSignedHash(c, m, sig)
+	if err != nil {
+		log.Printf("LD signing %s: %s", m["id"], err)
+		return b
+	}
+	value, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, hash)
+	if err != nil {
+		return b
+	}
+	sig["signatureValue"] = base64.StdEncoding.EncodeToString(value)
+	m["signature"] = sig
+	signed, err := marshalCanonical(m)
+	if err != nil {
+		return b
+	}
+	return signed
+}
@@ -0,0 +1,239 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-fed/activity/pub"
+)
+
+// serveLDContexts has `transport` serve the JSON-LD contexts LD signatures
+// need. Those under testdata/ldcontexts are cut down to the terms the tests
+// use, so they run without the network.
+func serveLDContexts(t testing.TB, transport *FakeTransport) {
+	t.Helper()
+	for iri, file := range map[string]string{
+		"https://www.w3.org/ns/activitystreams": "activitystreams.jsonld",
+		"https://w3id.org/security/v1":          "security-v1.jsonld",
+		"https://w3id.org/identity/v1":          "identity-v1.jsonld",
+	} {
+		b, err := os.ReadFile(filepath.Join("testdata", "ldcontexts", file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		transport.Respond(mustParse(t, iri), b)
+	}
+}
+
+// createBy returns a public Create of a Note by the actor at `actorIRI`,
+// copied to `cc`.
+func createBy(actorIRI, cc string) map[string]interface{} {
+	return map[string]interface{}{
+		"@context": []interface{}{activityStreamsContext, "https://w3id.org/security/v1"},
+		"id":       actorIRI + "/statuses/1/activity",
+		"type":     "Create",
+		"actor":    actorIRI,
+		"to":       pub.PublicActivityPubIRI,
+		"cc":       cc,
+		"object": map[string]interface{}{
+			"id":           actorIRI + "/statuses/1",
+			"type":         "Note",
+			"attributedTo": actorIRI,
+			"content":      "<p>hello</p>",
+			"to":           pub.PublicActivityPubIRI,
+			"cc":           cc,
+		},
+	}
+}
+
+// ldSign adds `p`'s RsaSignature2017 to `m`, as `s` would check it.
+func ldSign(t testing.TB, s *Service, p *testPeer, m map[string]interface{}) {
+	t.Helper()
+	sig := map[string]interface{}{
+		"type":    "RsaSignature2017",
+		"creator": p.keyId,
+		"created": "2026-10-16T12:00:00Z",
+	}
+	hash, err := s.ldSignedHash(context.Background(), m, sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := rsa.SignPKCS1v15(rand.Reader, p.key.(*rsa.PrivateKey), crypto.SHA256, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig["signatureValue"] = base64.StdEncoding.EncodeToString(value)
+	m["signature"] = sig
+}
+
+// content sets the content of the Note `m` creates.
+func content(m map[string]interface{}, html string) {
+	m["object"].(map[string]interface{})["content"] = html
+}
+
+func TestURDNA2015(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	serveLDContexts(t, transport)
+	m := createBy("https://remote.test/users/bob", "https://remote.test/users/bob/followers")
+	nquads, err := s.ldCanonicalizer().Canonicalize(c, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<https://remote.test/users/bob/statuses/1/activity> <https://www.w3.org/ns/activitystreams#actor> <https://remote.test/users/bob> .`,
+		`<https://remote.test/users/bob/statuses/1> <https://www.w3.org/ns/activitystreams#content> "<p>hello</p>" .`,
+	} {
+		if !strings.Contains("\n"+nquads, "\n"+want+"\n") {
+			t.Errorf("no %s in:\n%s", want, nquads)
+		}
+	}
+
+	// The contexts are fetched once.
+	transport.Respond(mustParse(t, "https://w3id.org/security/v1"), []byte("not JSON"))
+	again, err := s.ldCanonicalizer().Canonicalize(c, m)
+	if err != nil || again != nquads {
+		t.Errorf("canonicalizing again: %v\n%s", err, again)
+	}
+}
+
+func TestVerifyDeliveryLDSigned(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	serveLDContexts(t, transport)
+	aliceIRI := register(t, s, "alice")
+	inboxIRI := s.boxIRI(aliceIRI, "inbox")
+	bob := newTestPeer(t, transport, "https://remote.test/users/bob", "rsa")
+	carol := newTestPeer(t, transport, "https://other.test/users/carol", "rsa")
+	mallory := newTestPeer(t, transport, "https://evil.test/users/mallory", "rsa")
+
+	signed := func() map[string]interface{} {
+		m := createBy(bob.iri.String(), aliceIRI.String())
+		ldSign(t, s, bob, m)
+		return m
+	}
+	for _, test := range []struct {
+		name         string
+		ldSignatures bool
+		activity     func() map[string]interface{}
+		ok           bool
+	}{
+		{"forwarded", true, signed, true},
+		{"forwarded, not checking LD signatures", false, signed, false},
+		{"unsigned", true, func() map[string]interface{} {
+			return createBy(bob.iri.String(), aliceIRI.String())
+		}, false},
+		{"tampered with", true, func() map[string]interface{} {
+			m := signed()
+			content(m, "<p>send me your password</p>")
+			return m
+		}, false},
+		{"signed by someone else", true, func() map[string]interface{} {
+			m := createBy(bob.iri.String(), aliceIRI.String())
+			ldSign(t, s, mallory, m)
+			return m
+		}, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			s.config.LDSignatures = test.ldSignatures
+			// Carol forwards it, signing the request herself.
+			r := signedDelivery(t, carol, inboxIRI, test.activity(), false)
+			signer, ok := s.verifyDelivery(c, inboxIRI, r)
+			if ok != test.ok {
+				t.Fatalf("verifyDelivery = %v, %v; want %v", signer, ok, test.ok)
+			}
+			if ok && signer.String() != bob.iri.String() {
+				t.Errorf("signer %s, want the actor %s", signer, bob.iri)
+			}
+		})
+	}
+}
+
+func TestWithLDSignature(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	serveLDContexts(t, transport)
+	aliceIRI := register(t, s, "alice")
+	respondLocally(t, s, transport, aliceIRI)
+	outboxIRI := s.boxIRI(aliceIRI, "outbox")
+	followersIRI := s.boxIRI(aliceIRI, "followers")
+	sign := func(m map[string]interface{}) map[string]interface{} {
+		t.Helper()
+		b, err := json.Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var signed map[string]interface{}
+		if err := json.Unmarshal(s.withLDSignature(c, outboxIRI, withLDContextJSON(b)), &signed); err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	if m := sign(createBy(aliceIRI.String(), followersIRI.String())); m["signature"] != nil {
+		t.Error("signed with LDSignCreates off")
+	}
+	s.config.LDSignCreates = true
+	private := createBy(aliceIRI.String(), followersIRI.String())
+	private["to"] = followersIRI.String()
+	private["object"].(map[string]interface{})["to"] = followersIRI.String()
+	if m := sign(private); m["signature"] != nil {
+		t.Error("signed a Create that isn't public, and so isn't forwarded")
+	}
+
+	m := sign(createBy(aliceIRI.String(), followersIRI.String()))
+	sig, ok := m["signature"].(map[string]interface{})
+	if !ok {
+		t.Fatal("not signed")
+	}
+	if sig["type"] != "RsaSignature2017" || sig["creator"] != aliceIRI.String()+"#main-key" {
+		t.Errorf("signature %v", sig)
+	}
+	if err := s.verifyLDSignature(c, s.boxIRI(aliceIRI, "inbox"), aliceIRI, m); err != nil {
+		t.Errorf("our own signature doesn't verify: %s", err)
+	}
+	content(m, "<p>goodbye</p>")
+	if err := s.verifyLDSignature(c, s.boxIRI(aliceIRI, "inbox"), aliceIRI, m); err == nil {
+		t.Error("verified a tampered activity")
+	}
+}
+
+// The hash LD signatures sign is made of those of the options and the
+// document, so that neither can be swapped for another.
+func TestLDSignedHashCoversOptions(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	serveLDContexts(t, transport)
+	m := createBy("https://remote.test/users/bob", "https://remote.test/users/bob/followers")
+	hash := func(created string) [sha256.Size]byte {
+		h, err := s.ldSignedHash(c, m, map[string]interface{}{
+			"type":    "RsaSignature2017",
+			"creator": "https://remote.test/users/bob#main-key",
+			"created": created,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var sum [sha256.Size]byte
+		copy(sum[:], h)
+		return sum
+	}
+	if hash("2026-10-16T12:00:00Z") == hash("2026-10-17T12:00:00Z") {
+		t.Error("the signing time isn't signed")
+	}
+	if _, err := s.ldSignedHash(c, map[string]interface{}{"@context": "https://unknown.test/context"}, map[string]interface{}{}); err == nil {
+		t.Error("canonicalized a document whose context can't be had")
+	}
+}
@@ -0,0 +1,88 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Mastodon counts every link as this many characters, however long it is.
+const URLWeight = 23
+
+var (
+	urlRegexp = regexp.MustCompile(`https?://[^\s<>"]+`)
+	// Remote mentions only count the username part, not the domain.
+	mentionRegexp = regexp.MustCompile(`(^|[^\w/])@(\w+(?:[\w.-]*\w)?)@[\w.-]+\w`)
+)
+
+// NoteLength counts the characters of a note's source text the way Mastodon
+// does: URLs weigh a fixed 23 characters, mentions of remote accounts weigh
+// only their `@username`, and everything else is counted in grapheme clusters
+// so that, say, an emoji with a skin tone counts once.
+func NoteLength(text string) int {
+	countable := urlRegexp.ReplaceAllString(text, strings.Repeat("x", URLWeight))
+	countable = mentionRegexp.ReplaceAllString(countable, "$1@$2")
+	return graphemeCount(countable)
+}
+
+// graphemeCount approximates Unicode extended grapheme cluster segmentation
+// using only the standard library: CR LF pairs, combining marks, joiners and
+// emoji modifiers attach to the preceding character, ZWJ sequences fuse, and
+// regional indicators pair up into flags.
+func graphemeCount(s string) int {
+	count := 0
+	var prev rune
+	joined := false
+	regionalRun := 0
+	for len(s) > 0 {
+		r, size := utf8.DecodeRuneInString(s)
+		s = s[size:]
+		switch {
+		case count == 0:
+		case prev == '\r' && r == '\n':
+			prev = r
+			continue
+		case isGraphemeExtend(r):
+			prev = r
+			joined = r == '\u200d'
+			regionalRun = 0
+			continue
+		case joined && isPictographic(r):
+			prev = r
+			joined = false
+			continue
+		case isRegionalIndicator(r) && regionalRun%2 == 1:
+			prev = r
+			regionalRun++
+			continue
+		}
+		count++
+		prev = r
+		joined = false
+		if isRegionalIndicator(r) {
+			regionalRun = 1
+		} else {
+			regionalRun = 0
+		}
+	}
+	return count
+}
+
+func isGraphemeExtend(r rune) bool {
+	return unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc) ||
+		r == '\u200d' || // Zero width joiner.
+		(r >= 0x1f3fb && r <= 0x1f3ff) || // Emoji skin tone modifiers.
+		(r >= 0xe0020 && r <= 0xe007f) // Tag characters, as in subdivision flags.
+}
+
+func isPictographic(r rune) bool {
+	return unicode.Is(unicode.So, r) || (r >= 0x1f000 && r <= 0x1faff)
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1f1e6 && r <= 0x1f1ff
+}
@@ -0,0 +1,67 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNoteLength(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		text string
+		want int
+	}{
+		{"empty", "", 0},
+		{"ascii", "hello", 5},
+		{"short url", "see http://a.b", 4 + URLWeight},
+		{"long url", "https://example.com/" + strings.Repeat("a", 100), URLWeight},
+		{"two urls", "https://a.example https://b.example/path?q=1", 2*URLWeight + 1},
+		{"local mention", "@alice hi", 9},
+		{"remote mention", "@alice@example.com hi", 9},
+		{"remote mention in text", "hi @alice@social.example.org!", 10},
+		{"email is not a mention", "mail alice@example.com", 22},
+		{"combining mark", "é", 1},
+		{"skin tone", "\U0001f44b\U0001f3fd", 1},
+		{"zwj family", "\U0001f468‍\U0001f469‍\U0001f467", 1},
+		{"flags", "\U0001f1eb\U0001f1f7\U0001f1e9\U0001f1ea", 2},
+		{"crlf", "a\r\nb", 3},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := NoteLength(test.text); got != test.want {
+				t.Errorf("NoteLength(%q) = %d, want %d", test.text, got, test.want)
+			}
+		})
+	}
+}
+
+func TestValidateStatusLength(t *testing.T) {
+	s := &Service{config: DefaultConfig()}
+	max := s.config.MaxNoteChars
+	for _, test := range []struct {
+		name string
+		text string
+		ok   bool
+	}{
+		{"at limit", strings.Repeat("a", max), true},
+		{"over limit", strings.Repeat("a", max+1), false},
+		{"emoji at limit", strings.Repeat("\U0001f44b\U0001f3fd", max), true},
+		{"urls at limit", strings.Repeat("a", max-URLWeight) + "https://example.com/" + strings.Repeat("b", 200), true},
+		{"urls over limit", strings.Repeat("a", max-URLWeight+1) + "https://example.com/", false},
+		{"remote mention at limit", strings.Repeat("a", max-7) + " @alice@example.com", true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			err := s.validateStatus(StatusParams{Status: test.text})
+			var verr *ValidationError
+			switch {
+			case test.ok && err != nil:
+				t.Errorf("validateStatus: %v", err)
+			case !test.ok && !errors.As(err, &verr):
+				t.Errorf("validateStatus = %v, want a ValidationError", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"mastogon/internal/db"
+
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// ListParams is what a local user supplies when creating or renaming a list.
+type ListParams struct {
+	Title string
+	// One of "followed", "list" or "none". Empty means "list".
+	RepliesPolicy string
+}
+
+func (p ListParams) validate() error {
+	if strings.TrimSpace(p.Title) == "" {
+		return &ValidationError{"Title can't be blank"}
+	}
+	switch p.RepliesPolicy {
+	case "", "followed", "list", "none":
+		return nil
+	}
+	return &ValidationError{"Replies policy is not included in the list"}
+}
+
+// CreateList makes a new, empty list for the local actor at `actorIRI`.
+func (s *Service) CreateList(c context.Context, actorIRI *url.URL, params ListParams) (*db.List, error) {
+	if err := params.validate(); err != nil {
+		return nil, err
+	}
+	l := &db.List{
+		Owner:         actorIRI,
+		Title:         strings.TrimSpace(params.Title),
+		RepliesPolicy: params.RepliesPolicy,
+	}
+	if l.RepliesPolicy == "" {
+		l.RepliesPolicy = "list"
+	}
+	s.db.CreateList(l)
+	return l, nil
+}
+
+// List returns the list with `id`, if the local actor at `actorIRI` made it.
+// Other people's lists don't exist as far as they're concerned.
+func (s *Service) List(c context.Context, actorIRI *url.URL, id string) (*db.List, error) {
+	l, err := s.db.List(id)
+	if err != nil || l.Owner.String() != actorIRI.String() {
+		return nil, ErrNotFound
+	}
+	return l, nil
+}
+
+// Lists returns the lists the local actor at `actorIRI` made.
+func (s *Service) Lists(c context.Context, actorIRI *url.URL) []*db.List {
+	return s.db.Lists(actorIRI)
+}
+
+// UpdateList renames a list, or changes which replies show up on it.
+func (s *Service) UpdateList(c context.Context, actorIRI *url.URL, id string, params ListParams) (*db.List, error) {
+	if err := params.validate(); err != nil {
+		return nil, err
+	}
+	l, err := s.List(c, actorIRI, id)
+	if err != nil {
+		return nil, err
+	}
+	updated := *l
+	updated.Title = strings.TrimSpace(params.Title)
+	if params.RepliesPolicy != "" {
+		updated.RepliesPolicy = params.RepliesPolicy
+	}
+	s.db.UpdateList(&updated)
+	return &updated, nil
+}
+
+// DeleteList deletes a list.
+func (s *Service) DeleteList(c context.Context, actorIRI *url.URL, id string) error {
+	if _, err := s.List(c, actorIRI, id); err != nil {
+		return err
+	}
+	s.db.DeleteList(id)
+	return nil
+}
+
+// AddToList puts the actors at `memberIRIs` on a list. Like Mastodon, only
+// accounts the owner follows may go on it.
+func (s *Service) AddToList(c context.Context, actorIRI *url.URL, id string, memberIRIs []*url.URL) error {
+	l, err := s.List(c, actorIRI, id)
+	if err != nil {
+		return err
+	}
+	updated := *l
+	updated.Members = append([]string(nil), l.Members...)
+	for _, memberIRI := range memberIRIs {
+		following, err := s.IsFollowing(c, actorIRI, memberIRI)
+		if err != nil {
+			return err
+		}
+		if !following {
+			return &ValidationError{"You must be following this account"}
+		}
+		if !contains(updated.Members, memberIRI.String()) {
+			updated.Members = append(updated.Members, memberIRI.String())
+		}
+	}
+	s.db.UpdateList(&updated)
+	return nil
+}
+
+// RemoveFromList takes the actors at `memberIRIs` off a list.
+func (s *Service) RemoveFromList(c context.Context, actorIRI *url.URL, id string, memberIRIs []*url.URL) error {
+	l, err := s.List(c, actorIRI, id)
+	if err != nil {
+		return err
+	}
+	updated := *l
+	updated.Members = nil
+	for _, member := range l.Members {
+		gone := false
+		for _, memberIRI := range memberIRIs {
+			if member == memberIRI.String() {
+				gone = true
+				break
+			}
+		}
+		if !gone {
+			updated.Members = append(updated.Members, member)
+		}
+	}
+	s.db.UpdateList(&updated)
+	return nil
+}
+
+// ListTimeline is HomeTimeline narrowed to what the members of a list wrote.
+func (s *Service) ListTimeline(c context.Context,
+	actorIRI *url.URL,
+	id string,
+	tr TimeRange,
+	limit int) ([]vocab.Type, error) {
+	l, err := s.List(c, actorIRI, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.timeline(c, actorIRI, tr, limit, func(o vocab.Type) bool {
+		for _, author := range authorsOf(o) {
+			if contains(l.Members, author.String()) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func contains(ss []string, s string) bool {
+	for _, e := range ss {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestListTimeline(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	inboxIRI := s.boxIRI(aliceIRI, "inbox")
+	bob := newTestPeer(t, transport, "https://remote.test/users/bob", "rsa")
+	carol := newTestPeer(t, transport, "https://other.test/users/carol", "rsa")
+	following(t, s, aliceIRI, bob.iri)
+	following(t, s, aliceIRI, carol.iri)
+	list, err := s.CreateList(c, aliceIRI, ListParams{Title: "remote"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddToList(c, aliceIRI, list.ID, []*url.URL{bob.iri}); err != nil {
+		t.Fatal(err)
+	}
+	deliver(t, s, bob, inboxIRI, creating(postBy("Note", "https://remote.test/notes/1", bob.iri.String(), aliceIRI.String())))
+	deliver(t, s, bob, inboxIRI, creating(postBy("Note", "https://remote.test/notes/2", bob.iri.String(), aliceIRI.String())))
+	deliver(t, s, carol, inboxIRI, creating(postBy("Note", "https://other.test/notes/1", carol.iri.String(), aliceIRI.String())))
+	deliver(t, s, bob, inboxIRI, deleting(bob.iri.String(), "https://remote.test/notes/2"))
+
+	listed, err := s.ListTimeline(c, aliceIRI, list.ID, TimeRange{}, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only what members wrote, and that's still there.
+	if got, want := typesOf(listed), map[string]string{"https://remote.test/notes/1": "Note"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("list timeline %v, want %v", got, want)
+	}
+
+	// It follows who's on the list.
+	if err := s.AddToList(c, aliceIRI, list.ID, []*url.URL{carol.iri}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RemoveFromList(c, aliceIRI, list.ID, []*url.URL{bob.iri}); err != nil {
+		t.Fatal(err)
+	}
+	if listed, err = s.ListTimeline(c, aliceIRI, list.ID, TimeRange{}, 20); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := typesOf(listed), map[string]string{"https://other.test/notes/1": "Note"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("list timeline %v after swapping bob for carol, want %v", got, want)
+	}
+}
+
+func TestListCRUD(t *testing.T) {
+	c := context.Background()
+	s, _ := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	bobIRI := register(t, s, "bob")
+
+	if _, err := s.CreateList(c, aliceIRI, ListParams{Title: " "}); err == nil {
+		t.Error("made a list without a title")
+	}
+	if _, err := s.CreateList(c, aliceIRI, ListParams{Title: "friends", RepliesPolicy: "all"}); err == nil {
+		t.Error("made a list with an unknown replies policy")
+	}
+	list, err := s.CreateList(c, aliceIRI, ListParams{Title: " friends "})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.Title != "friends" || list.RepliesPolicy != "list" {
+		t.Errorf("made %q with replies policy %q", list.Title, list.RepliesPolicy)
+	}
+	if got, err := s.List(c, aliceIRI, list.ID); err != nil || got.Title != "friends" {
+		t.Errorf("List = %v, %v", got, err)
+	}
+	// Other people's lists don't exist as far as they're concerned.
+	if _, err := s.List(c, bobIRI, list.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("bob getting alice's list: %v", err)
+	}
+	if _, err := s.UpdateList(c, bobIRI, list.ID, ListParams{Title: "mine"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("bob renaming alice's list: %v", err)
+	}
+
+	updated, err := s.UpdateList(c, aliceIRI, list.ID, ListParams{Title: "close friends", RepliesPolicy: "none"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Title != "close friends" || updated.RepliesPolicy != "none" {
+		t.Errorf("updated to %q with replies policy %q", updated.Title, updated.RepliesPolicy)
+	}
+	if lists := s.Lists(c, aliceIRI); len(lists) != 1 || lists[0].Title != "close friends" {
+		t.Errorf("Lists = %v", lists)
+	}
+	if lists := s.Lists(c, bobIRI); len(lists) != 0 {
+		t.Errorf("bob has alice's lists: %v", lists)
+	}
+
+	if err := s.DeleteList(c, bobIRI, list.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("bob deleting alice's list: %v", err)
+	}
+	if err := s.DeleteList(c, aliceIRI, list.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.List(c, aliceIRI, list.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("getting a deleted list: %v", err)
+	}
+}
+
+func TestAddToListOnlyFollowed(t *testing.T) {
+	c := context.Background()
+	s, _ := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	list, err := s.CreateList(c, aliceIRI, ListParams{Title: "remote"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var validation *ValidationError
+	if err := s.AddToList(c, aliceIRI, list.ID, []*url.URL{mustParse(t, "https://remote.test/users/bob")}); !errors.As(err, &validation) {
+		t.Errorf("adding someone alice doesn't follow: %v", err)
+	}
+}
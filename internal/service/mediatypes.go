@@ -0,0 +1,86 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// The media types ActivityStreams documents go by. We send the first, which
+// every peer takes, and accept either.
+const (
+	mediaTypeActivityJSON = "application/activity+json"
+	mediaTypeLDJSON       = `application/ld+json; profile="https://www.w3.org/ns/activitystreams"`
+)
+
+// What we ask peers for when fetching ActivityStreams documents.
+const acceptActivityStreams = mediaTypeLDJSON + ", " + mediaTypeActivityJSON
+
+// isActivityStreamsMediaType reports whether `value`, a media type with any
+// parameters, is one an ActivityStreams document goes by. JSON-LD without
+// a profile counts, as some peers don't bother saying.
+func isActivityStreamsMediaType(value string) bool {
+	mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(value))
+	if err != nil {
+		return false
+	}
+	switch mediaType {
+	case "application/activity+json":
+		return true
+	case "application/ld+json":
+		profile, ok := params["profile"]
+		return !ok || strings.Contains(profile, "activitystreams")
+	}
+	return false
+}
+
+// isActivityStreamsGet reports whether `r` asks for an ActivityStreams
+// representation, as opposed to say a web browser wanting HTML.
+func isActivityStreamsGet(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mediaType, _, _ := mime.ParseMediaType(strings.TrimSpace(accept)); mediaType == "application/ld+json" {
+			// Asking for plain JSON-LD isn't asking for ActivityStreams.
+			if !strings.Contains(accept, "activitystreams") {
+				continue
+			}
+		}
+		if isActivityStreamsMediaType(accept) {
+			return true
+		}
+	}
+	return false
+}
+
+type contentTypeKey struct{}
+
+// withActivityContentType makes the `Content-Type` of the delivery `r` one
+// Go-Fed recognizes, when it's any ActivityStreams media type, since Go-Fed
+// is pickier than some peers. Peers often sign the header, so the original
+// is kept in the returned context for verifying the signature with.
+func withActivityContentType(c context.Context, r *http.Request) context.Context {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == mediaTypeActivityJSON || !isActivityStreamsMediaType(contentType) {
+		return c
+	}
+	r.Header.Set("Content-Type", mediaTypeActivityJSON)
+	return context.WithValue(c, contentTypeKey{}, contentType)
+}
+
+// asDelivered returns `r` as the peer sent it, undoing
+// withActivityContentType. Its body is shared with `r`.
+func asDelivered(c context.Context, r *http.Request) *http.Request {
+	contentType, ok := c.Value(contentTypeKey{}).(string)
+	if !ok {
+		return r
+	}
+	delivered := r.Clone(c)
+	delivered.Header.Set("Content-Type", contentType)
+	return delivered
+}
@@ -0,0 +1,82 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIsActivityStreamsMediaType(t *testing.T) {
+	for _, test := range []struct {
+		value string
+		want  bool
+	}{
+		{"application/activity+json", true},
+		{"application/activity+json; charset=utf-8", true},
+		{mediaTypeLDJSON, true},
+		{`application/ld+json;profile="https://www.w3.org/ns/activitystreams"`, true},
+		{"application/ld+json", true},
+		{`application/ld+json; profile="http://www.w3.org/ns/json-ld#compacted"`, false},
+		{"application/json", false},
+		{"text/html", false},
+		{"", false},
+	} {
+		if got := isActivityStreamsMediaType(test.value); got != test.want {
+			t.Errorf("isActivityStreamsMediaType(%q) = %t, want %t", test.value, got, test.want)
+		}
+	}
+}
+
+func TestIsActivityStreamsGet(t *testing.T) {
+	for _, test := range []struct {
+		method, accept string
+		want           bool
+	}{
+		{http.MethodGet, "application/activity+json", true},
+		{http.MethodGet, mediaTypeLDJSON, true},
+		{http.MethodGet, acceptActivityStreams, true},
+		{http.MethodHead, "application/activity+json", true},
+		{http.MethodGet, "text/html, application/activity+json;q=0.9", true},
+		// Plain JSON-LD could be anything.
+		{http.MethodGet, "application/ld+json", false},
+		{http.MethodGet, "text/html,application/xhtml+xml", false},
+		{http.MethodGet, "", false},
+		{http.MethodPost, "application/activity+json", false},
+	} {
+		r := httptest.NewRequest(test.method, "https://"+testHostname+"/users/alice", nil)
+		r.Header.Set("Accept", test.accept)
+		if got := isActivityStreamsGet(r); got != test.want {
+			t.Errorf("%s accepting %q: %t, want %t", test.method, test.accept, got, test.want)
+		}
+	}
+}
+
+func TestDeliveryOfEitherMediaType(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	inboxIRI := s.boxIRI(aliceIRI, "inbox")
+	bob := newTestPeer(t, transport, "https://remote.test/users/bob", "rsa")
+
+	for i, contentType := range []string{
+		mediaTypeActivityJSON,
+		mediaTypeLDJSON,
+		"application/ld+json",
+		"application/json",
+	} {
+		note := postBy("Note", fmt.Sprintf("https://remote.test/notes/%d", i+1), bob.iri.String(), aliceIRI.String())
+		r := signedDelivery(t, bob, inboxIRI, creating(note), false)
+		r.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		_, err := s.db.Get(c, mustParse(t, note["id"].(string)))
+		if want := contentType != "application/json"; (err == nil) != want {
+			t.Errorf("delivered as %s: %d, stored %t, want %t", contentType, w.Code, err == nil, want)
+		}
+	}
+}
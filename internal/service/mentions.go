@@ -0,0 +1,66 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// A mention is `@user` for a local account and `@user@domain` for any, not
+// right after a word character or a slash, as in an email address or URL.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w/])@(\w+(?:[\w.-]*\w)?(?:@[\w.-]+\w)?)`)
+
+// Mentions returns the accounts mentioned in the status text `s`, without
+// their leading `@`, once each and in order.
+func Mentions(s string) (accts []string) {
+	seen := make(map[string]bool)
+	for _, m := range mentionPattern.FindAllStringSubmatch(s, -1) {
+		acct := m[1]
+		if !seen[strings.ToLower(acct)] {
+			seen[strings.ToLower(acct)] = true
+			accts = append(accts, acct)
+		}
+	}
+	return
+}
+
+// mention is an account a status mentions, and the actor it is.
+type mention struct {
+	acct     string
+	actorIRI *url.URL
+}
+
+// mentioned resolves the accounts `status`, by the actor at `authorIRI`,
+// mentions. As with Mastodon, those that can't be found are only text, and
+// authors don't mention themselves.
+func (s *Service) mentioned(c context.Context, authorIRI *url.URL, status string) (mentions []mention) {
+	seen := map[string]bool{authorIRI.String(): true}
+	for _, acct := range Mentions(status) {
+		actorIRI, err := s.ResolveAccount(c, acct)
+		if err != nil || seen[actorIRI.String()] {
+			continue
+		}
+		seen[actorIRI.String()] = true
+		mentions = append(mentions, mention{acct, actorIRI})
+	}
+	return
+}
+
+// newMention returns the Mention tag of `m`.
+func newMention(m mention) vocab.ActivityStreamsMention {
+	tag := streams.NewActivityStreamsMention()
+	href := streams.NewActivityStreamsHrefProperty()
+	href.Set(m.actorIRI)
+	tag.SetActivityStreamsHref(href)
+	name := streams.NewActivityStreamsNameProperty()
+	name.AppendXMLSchemaString("@" + m.acct)
+	tag.SetActivityStreamsName(name)
+	return tag
+}
@@ -0,0 +1,299 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// Accounts move between instances as Mastodon has them do: the new account
+// lists the old one among its `alsoKnownAs` aliases, then the old one points
+// to it with `movedTo` and tells its followers with a Move. Go-Fed knows
+// neither property, and leaves them among the unknown ones.
+
+// AliasesOf returns the accounts the actor `t` says it's also known as.
+func AliasesOf(t vocab.Type) (aliases []*url.URL) {
+	o, ok := t.(interface {
+		GetUnknownProperties() map[string]interface{}
+	})
+	if !ok {
+		return nil
+	}
+	switch v := o.GetUnknownProperties()["alsoKnownAs"].(type) {
+	case []interface{}:
+		for _, e := range v {
+			if iri := iriOf(e); iri != nil {
+				aliases = append(aliases, iri)
+			}
+		}
+	default:
+		if iri := iriOf(v); iri != nil {
+			aliases = append(aliases, iri)
+		}
+	}
+	return
+}
+
+// MovedTo returns the account the actor `t` moved to, if it moved.
+func MovedTo(t vocab.Type) *url.URL {
+	if o, ok := t.(interface {
+		GetUnknownProperties() map[string]interface{}
+	}); ok {
+		return iriOf(o.GetUnknownProperties()["movedTo"])
+	}
+	return nil
+}
+
+// Aliases returns the accounts the local actor at `actorIRI` is also known
+// as.
+func (s *Service) Aliases(c context.Context, actorIRI *url.URL) ([]*url.URL, error) {
+	t, err := s.db.Get(c, actorIRI)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	return AliasesOf(t), nil
+}
+
+// AddAlias has the local actor at `actorIRI` say it's also known as the
+// account `alias`, given as `user@domain` or by IRI, so that account can
+// move to it.
+func (s *Service) AddAlias(c context.Context, actorIRI *url.URL, alias string) error {
+	aliasIRI, err := s.resolveAccountOrIRI(c, alias)
+	if err != nil {
+		return err
+	}
+	if aliasIRI.String() == actorIRI.String() {
+		return &ValidationError{"An account can't be an alias of itself"}
+	}
+	return s.editAliases(c, actorIRI, func(aliases []*url.URL) []*url.URL {
+		if containsIRI(aliases, aliasIRI) {
+			return aliases
+		}
+		return append(aliases, aliasIRI)
+	})
+}
+
+// RemoveAlias takes the account `alias` out of the local actor at
+// `actorIRI`'s aliases.
+func (s *Service) RemoveAlias(c context.Context, actorIRI *url.URL, alias string) error {
+	aliasIRI, err := s.resolveAccountOrIRI(c, alias)
+	if err != nil {
+		return err
+	}
+	return s.editAliases(c, actorIRI, func(aliases []*url.URL) []*url.URL {
+		kept := aliases[:0]
+		for _, a := range aliases {
+			if a.String() != aliasIRI.String() {
+				kept = append(kept, a)
+			}
+		}
+		return kept
+	})
+}
+
+// editAliases replaces the aliases of the local actor at `actorIRI` with
+// what `edit` makes of them.
+func (s *Service) editAliases(c context.Context, actorIRI *url.URL, edit func([]*url.URL) []*url.URL) error {
+	return s.updateActor(c, actorIRI, func(person vocab.ActivityStreamsPerson) error {
+		unknown := person.GetUnknownProperties()
+		if unknown == nil {
+			return errors.New("can't set aliases")
+		}
+		aliases := edit(AliasesOf(person))
+		if len(aliases) == 0 {
+			delete(unknown, "alsoKnownAs")
+			return nil
+		}
+		v := make([]interface{}, len(aliases))
+		for i, alias := range aliases {
+			v[i] = alias.String()
+		}
+		unknown["alsoKnownAs"] = v
+		return nil
+	})
+}
+
+// MoveAccount moves the local actor at `actorIRI` to the account `target`,
+// given as `user@domain` or by IRI, which must list it among its aliases.
+// The actor points to its new account from then on, and its followers are
+// sent a Move so they can follow it there.
+func (s *Service) MoveAccount(c context.Context, actorIRI *url.URL, target string) error {
+	targetIRI, err := s.resolveAccountOrIRI(c, target)
+	if err != nil {
+		return err
+	}
+	if targetIRI.String() == actorIRI.String() {
+		return &ValidationError{"An account can't move to itself"}
+	}
+	if moves, err := s.movesTo(c, actorIRI, actorIRI, targetIRI); err != nil {
+		return err
+	} else if !moves {
+		return &ValidationError{"The new account must have this one among its aliases"}
+	}
+	var followersIRI *url.URL
+	err = s.updateActor(c, actorIRI, func(person vocab.ActivityStreamsPerson) error {
+		unknown := person.GetUnknownProperties()
+		if unknown == nil {
+			return errors.New("can't set movedTo")
+		}
+		unknown["movedTo"] = targetIRI.String()
+		if f := person.GetActivityStreamsFollowers(); f != nil {
+			followersIRI, _ = pub.ToId(f)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	move := streams.NewActivityStreamsMove()
+	actor := streams.NewActivityStreamsActorProperty()
+	actor.AppendIRI(actorIRI)
+	move.SetActivityStreamsActor(actor)
+	object := streams.NewActivityStreamsObjectProperty()
+	object.AppendIRI(actorIRI)
+	move.SetActivityStreamsObject(object)
+	targetProp := streams.NewActivityStreamsTargetProperty()
+	targetProp.AppendIRI(targetIRI)
+	move.SetActivityStreamsTarget(targetProp)
+	if followersIRI != nil {
+		to := streams.NewActivityStreamsToProperty()
+		to.AppendIRI(followersIRI)
+		move.SetActivityStreamsTo(to)
+	}
+	_, err = s.actor.Send(c, s.boxIRI(actorIRI, "outbox"), move)
+	return err
+}
+
+// resolveAccountOrIRI returns the actor IRI of `account`, given as
+// `user@domain` or by IRI.
+func (s *Service) resolveAccountOrIRI(c context.Context, account string) (*url.URL, error) {
+	if strings.HasPrefix(account, "https://") {
+		iri, err := url.Parse(account)
+		if err != nil {
+			return nil, &ValidationError{err.Error()}
+		}
+		return iri, nil
+	}
+	iri, err := s.ResolveAccount(c, account)
+	if err != nil {
+		return nil, &ValidationError{"Unknown account " + account}
+	}
+	return iri, nil
+}
+
+// movesTo reports whether the account at `targetIRI` lists the one at
+// `actorIRI` among its aliases, so that it may move there. Unless it's ours,
+// it's fetched on behalf of `viewerIRI`, who may be nil, should our copy not
+// list it: the alias was most likely added just before the move.
+func (s *Service) movesTo(c context.Context, viewerIRI, actorIRI, targetIRI *url.URL) (bool, error) {
+	if t, err := s.db.Get(c, targetIRI); err == nil && containsIRI(AliasesOf(t), actorIRI) {
+		return true, nil
+	}
+	if owns, err := s.db.Owns(c, targetIRI); err != nil || owns {
+		return false, err
+	}
+	t, err := s.fetch(c, viewerIRI, targetIRI)
+	if err != nil {
+		return false, err
+	}
+	return containsIRI(AliasesOf(t), actorIRI), nil
+}
+
+// movedTarget returns the account the actor at `actorIRI` moved to, if we
+// know it did, following it as far as the account it moved to next but not
+// round in circles. Only moves to accounts listing the one moving among
+// their aliases are followed, as fetched on behalf of `viewerIRI`.
+func (s *Service) movedTarget(c context.Context, viewerIRI, actorIRI *url.URL) *url.URL {
+	seen := map[string]bool{actorIRI.String(): true}
+	var target *url.URL
+	for iri := actorIRI; ; {
+		t, err := s.db.Get(c, iri)
+		if err != nil {
+			return target
+		}
+		moved := MovedTo(t)
+		if moved == nil || seen[moved.String()] {
+			return target
+		}
+		if moves, _ := s.movesTo(c, viewerIRI, iri, moved); !moves {
+			return target
+		}
+		seen[moved.String()] = true
+		target, iri = moved, moved
+	}
+}
+
+// MovePrompt is an account a local actor follows that moved, and where to,
+// so they can be asked to follow it there.
+type MovePrompt struct {
+	From *url.URL
+	To   *url.URL
+}
+
+// MovePrompts lists the accounts the local actor at `actorIRI` follows that
+// moved to accounts they don't follow yet, nor asked to.
+func (s *Service) MovePrompts(c context.Context, actorIRI *url.URL) ([]MovePrompt, error) {
+	following, err := s.Following(c, actorIRI, actorIRI)
+	if err != nil {
+		return nil, err
+	}
+	var prompts []MovePrompt
+	for _, followedIRI := range following {
+		to := s.movedTarget(c, actorIRI, followedIRI)
+		if to == nil {
+			continue
+		}
+		if follows, err := s.IsFollowing(c, actorIRI, to); err != nil {
+			return nil, err
+		} else if follows {
+			continue
+		}
+		if requested, err := s.hasSentFollow(c, actorIRI, to); err != nil {
+			return nil, err
+		} else if requested {
+			continue
+		}
+		prompts = append(prompts, MovePrompt{From: followedIRI, To: to})
+	}
+	return prompts, nil
+}
+
+// noteMoved records on our copy of the remote actor at `actorIRI`, fetching
+// it if we have none, that it moved to `targetIRI`, as its Move said.
+func (s *Service) noteMoved(c context.Context, actorIRI, targetIRI *url.URL) error {
+	if exists, err := s.db.Exists(c, actorIRI); err != nil {
+		return err
+	} else if !exists {
+		t, err := s.fetch(c, nil, actorIRI)
+		if err != nil {
+			return err
+		}
+		if _, err := s.storeFetched(c, t); err != nil {
+			return err
+		}
+	}
+	if err := s.db.Lock(c, actorIRI); err != nil {
+		return err
+	}
+	defer s.db.Unlock(c, actorIRI)
+	t, err := s.db.Get(c, actorIRI)
+	if err != nil {
+		return err
+	}
+	o, ok := t.(interface {
+		GetUnknownProperties() map[string]interface{}
+	})
+	if !ok || o.GetUnknownProperties() == nil {
+		return errors.New("can't set movedTo")
+	}
+	o.GetUnknownProperties()["movedTo"] = targetIRI.String()
+	return s.db.Update(c, t)
+}
@@ -0,0 +1,138 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAliasesServed(t *testing.T) {
+	c := context.Background()
+	s, _ := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	bobIRI := register(t, s, "bob")
+
+	if err := s.AddAlias(c, aliceIRI, "bob@"+testHostname); err != nil {
+		t.Fatal(err)
+	}
+	// Adding it again changes nothing.
+	if err := s.AddAlias(c, aliceIRI, bobIRI.String()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := getObject(t, s, aliceIRI.String())["alsoKnownAs"], []interface{}{bobIRI.String()}; !reflect.DeepEqual(got, want) {
+		t.Errorf("served alsoKnownAs %v, want %v", got, want)
+	}
+	if aliases, err := s.Aliases(c, aliceIRI); err != nil || len(aliases) != 1 || aliases[0].String() != bobIRI.String() {
+		t.Errorf("aliases %v, %v", aliases, err)
+	}
+	if err := s.AddAlias(c, aliceIRI, aliceIRI.String()); err == nil {
+		t.Error("made an account an alias of itself")
+	}
+
+	if err := s.RemoveAlias(c, aliceIRI, bobIRI.String()); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := getObject(t, s, aliceIRI.String())["alsoKnownAs"]; ok {
+		t.Errorf("served alsoKnownAs %v once removed", got)
+	}
+}
+
+func TestMovedTo(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	inboxIRI := s.boxIRI(aliceIRI, "inbox")
+	bob := newTestPeer(t, transport, "https://remote.test/users/bob", "rsa")
+	// bob's new account, which says it's bob's.
+	newBob := newTestPeer(t, transport, "https://new.test/users/bob", "rsa")
+	doc := newBob.actorDoc(newBob.publicKeyDoc(t, newBob.iri.String()))
+	doc["alsoKnownAs"] = []interface{}{bob.iri.String()}
+	respondJSON(t, transport, newBob.iri.String(), doc)
+	// An account that doesn't.
+	dave := newTestPeer(t, transport, "https://other.test/users/dave", "rsa")
+	mallory := newTestPeer(t, transport, "https://evil.test/users/mallory", "rsa")
+	following(t, s, aliceIRI, bob.iri)
+	listener := s.Listen(EventAccountMoved)
+	defer listener.Close()
+
+	moving := func(p *testPeer, objectIRI, targetIRI string) map[string]interface{} {
+		return map[string]interface{}{
+			"@context": "https://www.w3.org/ns/activitystreams",
+			"id":       p.iri.String() + "#moves/" + targetIRI,
+			"type":     "Move",
+			"actor":    p.iri.String(),
+			"object":   objectIRI,
+			"target":   targetIRI,
+		}
+	}
+	prompts := func() []MovePrompt {
+		t.Helper()
+		prompts, err := s.MovePrompts(c, aliceIRI)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return prompts
+	}
+
+	// Moves to accounts that don't say they're the one moving, or by someone
+	// else than the account, are ignored.
+	deliver(t, s, bob, inboxIRI, moving(bob, bob.iri.String(), dave.iri.String()))
+	deliver(t, s, mallory, inboxIRI, moving(mallory, bob.iri.String(), mallory.iri.String()))
+	if got := prompts(); len(got) != 0 {
+		t.Errorf("prompted to follow %+v", got)
+	}
+
+	deliver(t, s, bob, inboxIRI, moving(bob, bob.iri.String(), newBob.iri.String()))
+	if got := prompts(); len(got) != 1 || got[0].From.String() != bob.iri.String() || got[0].To.String() != newBob.iri.String() {
+		t.Errorf("prompted to follow %+v, want bob where they moved", got)
+	}
+	readCtx, cancel := context.WithTimeout(c, time.Second)
+	defer cancel()
+	if e, err := listener.Read(readCtx); err != nil || e.Actor.String() != bob.iri.String() {
+		t.Errorf("read %+v, %v, want bob's move", e, err)
+	}
+
+	// Following bob follows them where they went, after which there's
+	// nothing to prompt.
+	before := len(transport.Delivered())
+	if err := s.Follow(c, aliceIRI, bob.iri); err != nil {
+		t.Fatal(err)
+	}
+	if len(transport.Delivered()) == before {
+		t.Fatal("sent no Follow")
+	}
+	for _, d := range transport.Delivered()[before:] {
+		if d.To.String() != newBob.iri.String()+"/inbox" {
+			t.Errorf("followed at %s, want bob's new inbox", d.To)
+		}
+	}
+	if got := prompts(); len(got) != 0 {
+		t.Errorf("prompted to follow %+v once following", got)
+	}
+
+	// Nor are accounts followed to where their document says they moved
+	// unless the account there says it's them.
+	erin := newTestPeer(t, transport, "https://remote.test/users/erin", "rsa")
+	doc = erin.actorDoc(erin.publicKeyDoc(t, erin.iri.String()))
+	doc["movedTo"] = dave.iri.String()
+	respondJSON(t, transport, erin.iri.String(), doc)
+	if _, err := s.RefreshObject(c, aliceIRI, erin.iri); err != nil {
+		t.Fatal(err)
+	}
+	before = len(transport.Delivered())
+	if err := s.Follow(c, aliceIRI, erin.iri); err != nil {
+		t.Fatal(err)
+	}
+	if len(transport.Delivered()) == before {
+		t.Fatal("sent no Follow")
+	}
+	for _, d := range transport.Delivered()[before:] {
+		if d.To.String() != erin.iri.String()+"/inbox" {
+			t.Errorf("followed at %s, want erin's inbox", d.To)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/go-fed/activity/streams"
+)
+
+// serveObject serves the object stored at `id` to `viewer`, nil for anyone.
+// What isn't for them isn't found. It's serialized under the lock, Go-Fed
+// adding likes and shares to it as they come in.
+func (s *Service) serveObject(w http.ResponseWriter, r *http.Request, id *url.URL, viewer *url.URL) {
+	c := r.Context()
+	if err := s.db.Lock(c, id); err != nil {
+		WriteError(w, err)
+		return
+	}
+	t, err := s.db.Get(c, id)
+	if err == nil && !s.mayView(c, t, viewer) {
+		err = ErrNotFound
+	}
+	var m map[string]interface{}
+	if err == nil {
+		withReplies(t, id)
+		if m, err = streams.Serialize(t); err == nil {
+			withReactions(m, t, id)
+			s.withEndpoints(m, t)
+			s.withApproval(m, t)
+		}
+	}
+	s.db.Unlock(c, id)
+	if err != nil {
+		WriteError(w, ErrNotFound)
+		return
+	}
+	status := http.StatusOK
+	if t.GetTypeName() == "Tombstone" && s.config.TombstonesGone {
+		status = http.StatusGone
+	}
+	writeSerialized(w, status, m)
+}
+
+// stripHiddenRecipients removes `bto` and `bcc` from the serialized
+// ActivityStreams value `m`, and from any objects embedded in it. Blind
+// recipients are only for working out who to deliver to: ActivityPub wants
+// them gone from anything we hand out. The stored value is left alone.
+func stripHiddenRecipients(m map[string]interface{}) {
+	delete(m, "bto")
+	delete(m, "bcc")
+	switch o := m["object"].(type) {
+	case map[string]interface{}:
+		stripHiddenRecipients(o)
+	case []interface{}:
+		for _, e := range o {
+			if em, ok := e.(map[string]interface{}); ok {
+				stripHiddenRecipients(em)
+			}
+		}
+	}
+}
@@ -0,0 +1,97 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/go-fed/activity/streams"
+)
+
+func TestStripHiddenRecipients(t *testing.T) {
+	m := map[string]interface{}{
+		"type": "Create",
+		"to":   "https://www.w3.org/ns/activitystreams#Public",
+		"bto":  "https://remote.test/users/bob",
+		"bcc":  []interface{}{"https://remote.test/users/carol"},
+		"object": []interface{}{
+			map[string]interface{}{
+				"type": "Note",
+				"bcc":  "https://remote.test/users/carol",
+				"object": map[string]interface{}{
+					"type": "Note",
+					"bto":  "https://remote.test/users/bob",
+				},
+			},
+			"https://remote.test/notes/1",
+		},
+	}
+	stripHiddenRecipients(m)
+	want := map[string]interface{}{
+		"type": "Create",
+		"to":   "https://www.w3.org/ns/activitystreams#Public",
+		"object": []interface{}{
+			map[string]interface{}{
+				"type":   "Note",
+				"object": map[string]interface{}{"type": "Note"},
+			},
+			"https://remote.test/notes/1",
+		},
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("stripHiddenRecipients left %v, want %v", m, want)
+	}
+}
+
+func TestServeObjectStripsHiddenRecipients(t *testing.T) {
+	c := context.Background()
+	s, _ := newTestService(t)
+	actorIRI := register(t, s, "alice")
+	noteIRI := "https://" + testHostname + "/note/1"
+	note, err := streams.ToType(c, map[string]interface{}{
+		"@context":     "https://www.w3.org/ns/activitystreams",
+		"id":           noteIRI,
+		"type":         "Note",
+		"attributedTo": actorIRI.String(),
+		"content":      "hello",
+		"to":           "https://www.w3.org/ns/activitystreams#Public",
+		"bto":          "https://remote.test/users/bob",
+		"bcc":          "https://remote.test/users/carol",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.db.Create(c, note); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, noteIRI, nil)
+	r.Header.Set("Accept", "application/activity+json")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET %s: %d", noteIRI, w.Code)
+	}
+	var served map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &served); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"bto", "bcc"} {
+		if _, ok := served[key]; ok {
+			t.Errorf("served %s", key)
+		}
+	}
+	stored, err := s.db.Get(c, mustParse(t, noteIRI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m, _ := streams.Serialize(stored); m["bcc"] == nil {
+		t.Error("stripped the stored note too")
+	}
+}
@@ -0,0 +1,337 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"mastogon/internal/db"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// The largest activity a client may post to an outbox.
+const maxOutboxBody = 1 << 20
+
+// postOutbox takes an activity posted to the outbox at `outboxIRI` by a
+// client of its owner, as in ActivityPub's client-to-server protocol, and
+// sends it. Clients authenticate with the bearer tokens of the client API.
+func (s *Service) postOutbox(w http.ResponseWriter, r *http.Request, outboxIRI *url.URL) {
+	actorIRI, err := s.authenticateBearer(r)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	c := WithActor(r.Context(), actorIRI, TokenScopes)
+	if s.boxIRI(actorIRI, "outbox").String() != outboxIRI.String() {
+		WriteError(w, fmt.Errorf("outbox %s: %w", outboxIRI, db.ErrNotOwned))
+		return
+	}
+	var m map[string]interface{}
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxOutboxBody)).Decode(&m); err != nil {
+		WriteError(w, &ParseError{err})
+		return
+	}
+	t, err := streams.ToType(c, m)
+	if err != nil {
+		WriteError(w, &ParseError{err})
+		return
+	}
+	activity, err := s.asActivity(c, t, actorIRI)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	if err := s.withIDs(c, activity, true); err != nil {
+		WriteError(w, err)
+		return
+	}
+	// Go-Fed assigns the ids, stores the activity, adds it to the outbox,
+	// and delivers it. What it creates or updates is ours to store, and what
+	// it deletes ours to bury.
+	sent, err := s.actor.Send(c, outboxIRI, activity)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	if err := s.storeCreated(c, sent); err != nil {
+		WriteError(w, err)
+		return
+	}
+	if err := s.buryDeleted(c, sent); err != nil {
+		WriteError(w, err)
+		return
+	}
+	if id, err := pub.GetId(sent); err == nil {
+		w.Header().Set("Location", id.String())
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// asActivity returns `t`, posted to the outbox of the local actor at
+// `actorIRI`, as an activity by them. A bare object is wrapped in a Create,
+// as ActivityPub has servers do. What the actor creates must be theirs, what
+// they update, delete or undo already theirs, and notes no longer than the
+// instance allows.
+func (s *Service) asActivity(c context.Context, t vocab.Type, actorIRI *url.URL) (pub.Activity, error) {
+	if err := s.checkAuthored(t, actorIRI); err != nil {
+		return nil, err
+	}
+	activity, ok := t.(pub.Activity)
+	if !ok {
+		create, err := wrapInCreate(t, actorIRI)
+		if err != nil {
+			return nil, &ParseError{err}
+		}
+		return create, nil
+	}
+	if activity.GetActivityStreamsActor() == nil {
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(actorIRI)
+		activity.SetActivityStreamsActor(actor)
+	}
+	owned := false
+	_, updates := activity.(vocab.ActivityStreamsUpdate)
+	switch activity.(type) {
+	case vocab.ActivityStreamsCreate:
+	case vocab.ActivityStreamsUpdate, vocab.ActivityStreamsDelete, vocab.ActivityStreamsUndo:
+		owned = true
+	default:
+		// Likes, Announces and the like are often of others' objects.
+		return activity, nil
+	}
+	if o := activity.GetActivityStreamsObject(); o != nil {
+		for iter := o.Begin(); iter != o.End(); iter = iter.Next() {
+			if object := iter.GetType(); object != nil {
+				if err := s.checkAuthored(object, actorIRI); err != nil {
+					return nil, err
+				}
+				if updates {
+					attributeTo(object, actorIRI)
+				}
+			}
+			if !owned {
+				continue
+			}
+			id, err := pub.ToId(iter)
+			if err != nil {
+				return nil, &ParseError{err}
+			}
+			if err := s.checkOwned(c, id, actorIRI); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return activity, nil
+}
+
+// checkOwned checks the object stored at `id` is by the actor at `actorIRI`
+// alone, so theirs to update, delete or undo.
+func (s *Service) checkOwned(c context.Context, id, actorIRI *url.URL) error {
+	t, err := s.db.Get(c, id)
+	if errors.Is(err, db.ErrNotFound) {
+		return fmt.Errorf("%s: %w", id, db.ErrNotOwned)
+	} else if err != nil {
+		return err
+	}
+	authors := authorsOf(t)
+	if len(authors) == 0 {
+		return fmt.Errorf("%s: %w", id, db.ErrNotOwned)
+	}
+	for _, author := range authors {
+		if author.String() != actorIRI.String() {
+			return fmt.Errorf("%s: %w", id, db.ErrNotOwned)
+		}
+	}
+	return nil
+}
+
+// checkAuthored checks `t`, posted by the actor at `actorIRI`, is by no one
+// else, and is within the instance's limit if it's a note.
+func (s *Service) checkAuthored(t vocab.Type, actorIRI *url.URL) error {
+	for _, author := range authorsOf(t) {
+		if author.String() != actorIRI.String() {
+			return fmt.Errorf("posting as %s: %w", author, db.ErrNotOwned)
+		}
+	}
+	if note, ok := t.(vocab.ActivityStreamsNote); ok && NoteLength(noteText(note)) > s.config.MaxNoteChars {
+		return &ValidationError{fmt.Sprintf("Text character limit of %d exceeded", s.config.MaxNoteChars)}
+	}
+	return nil
+}
+
+// noteText is the text of `note`'s content, as it was typed: stripped of
+// markup, with paragraphs and line breaks back as new lines.
+func noteText(note vocab.ActivityStreamsNote) string {
+	var parts []string
+	if content := note.GetActivityStreamsContent(); content != nil {
+		for iter := content.Begin(); iter != content.End(); iter = iter.Next() {
+			if iter.IsXMLSchemaString() {
+				parts = append(parts, iter.GetXMLSchemaString())
+			}
+		}
+	}
+	text := strings.Join(parts, "\n")
+	text = lineBreakPattern.ReplaceAllString(text, "\n")
+	return html.UnescapeString(tagPattern.ReplaceAllString(text, ""))
+}
+
+// Where one paragraph or line of a note ends and the next starts.
+var lineBreakPattern = regexp.MustCompile(`(?i)<br\s*/?>|</p>\s*<p[^>]*>`)
+
+// withIDs gives `t` an id if it has none, and the objects embedded in it at
+// any depth too. If it's `ours`, being the activity posted or an object it
+// creates, it gets a `published` time if it has none as well: objects merely
+// embedded, such as the status a Like is of, aren't ours to date. Go-Fed
+// replaces the ids of the activity and its own objects on sending; those
+// nested deeper keep ours.
+func (s *Service) withIDs(c context.Context, t vocab.Type, ours bool) error {
+	if id := t.GetJSONLDId(); id == nil || id.Get() == nil {
+		iri, err := s.db.NewID(c, t)
+		if err != nil {
+			return err
+		}
+		prop := streams.NewJSONLDIdProperty()
+		prop.Set(iri)
+		t.SetJSONLDId(prop)
+	}
+	if o, ok := t.(interface {
+		GetActivityStreamsPublished() vocab.ActivityStreamsPublishedProperty
+		SetActivityStreamsPublished(vocab.ActivityStreamsPublishedProperty)
+	}); ok && ours && o.GetActivityStreamsPublished() == nil {
+		published := streams.NewActivityStreamsPublishedProperty()
+		published.Set(s.Now())
+		o.SetActivityStreamsPublished(published)
+	}
+	a, ok := t.(interface {
+		GetActivityStreamsObject() vocab.ActivityStreamsObjectProperty
+	})
+	if !ok || a.GetActivityStreamsObject() == nil {
+		return nil
+	}
+	_, creates := t.(vocab.ActivityStreamsCreate)
+	for iter := a.GetActivityStreamsObject().Begin(); iter != a.GetActivityStreamsObject().End(); iter = iter.Next() {
+		if o := iter.GetType(); o != nil {
+			if err := s.withIDs(c, o, ours && creates); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// wrapInCreate wraps the object `t` in a Create by the actor at `actorIRI`,
+// addressed to whoever the object is, and published when it was. The object
+// is attributed to the actor if it doesn't say.
+func wrapInCreate(t vocab.Type, actorIRI *url.URL) (vocab.ActivityStreamsCreate, error) {
+	create := streams.NewActivityStreamsCreate()
+	actor := streams.NewActivityStreamsActorProperty()
+	actor.AppendIRI(actorIRI)
+	create.SetActivityStreamsActor(actor)
+	attributeTo(t, actorIRI)
+	object := streams.NewActivityStreamsObjectProperty()
+	if err := object.AppendType(t); err != nil {
+		return nil, err
+	}
+	create.SetActivityStreamsObject(object)
+	if o, ok := t.(interface {
+		GetActivityStreamsTo() vocab.ActivityStreamsToProperty
+	}); ok && o.GetActivityStreamsTo() != nil {
+		create.SetActivityStreamsTo(o.GetActivityStreamsTo())
+	}
+	if o, ok := t.(interface {
+		GetActivityStreamsCc() vocab.ActivityStreamsCcProperty
+	}); ok && o.GetActivityStreamsCc() != nil {
+		create.SetActivityStreamsCc(o.GetActivityStreamsCc())
+	}
+	if o, ok := t.(interface {
+		GetActivityStreamsBto() vocab.ActivityStreamsBtoProperty
+	}); ok && o.GetActivityStreamsBto() != nil {
+		create.SetActivityStreamsBto(o.GetActivityStreamsBto())
+	}
+	if o, ok := t.(interface {
+		GetActivityStreamsBcc() vocab.ActivityStreamsBccProperty
+	}); ok && o.GetActivityStreamsBcc() != nil {
+		create.SetActivityStreamsBcc(o.GetActivityStreamsBcc())
+	}
+	if o, ok := t.(interface {
+		GetActivityStreamsAudience() vocab.ActivityStreamsAudienceProperty
+	}); ok && o.GetActivityStreamsAudience() != nil {
+		create.SetActivityStreamsAudience(o.GetActivityStreamsAudience())
+	}
+	if o, ok := t.(interface {
+		GetActivityStreamsPublished() vocab.ActivityStreamsPublishedProperty
+	}); ok && o.GetActivityStreamsPublished() != nil {
+		create.SetActivityStreamsPublished(o.GetActivityStreamsPublished())
+	}
+	return create, nil
+}
+
+// attributeTo attributes `t` to the actor at `actorIRI` if it doesn't say
+// whose it is.
+func attributeTo(t vocab.Type, actorIRI *url.URL) {
+	if o, ok := t.(interface {
+		GetActivityStreamsAttributedTo() vocab.ActivityStreamsAttributedToProperty
+		SetActivityStreamsAttributedTo(vocab.ActivityStreamsAttributedToProperty)
+	}); ok && o.GetActivityStreamsAttributedTo() == nil {
+		attributedTo := streams.NewActivityStreamsAttributedToProperty()
+		attributedTo.AppendIRI(actorIRI)
+		o.SetActivityStreamsAttributedTo(attributedTo)
+	}
+}
+
+// storeCreated stores the objects the Create or Update `activity`, just
+// sent, embeds, an Update's replacing what was there. Go-Fed only stores the
+// activity itself when federating, leaving its objects to the
+// client-to-server side effects we don't run.
+func (s *Service) storeCreated(c context.Context, activity pub.Activity) error {
+	switch activity.(type) {
+	case vocab.ActivityStreamsCreate, vocab.ActivityStreamsUpdate:
+	default:
+		return nil
+	}
+	o := activity.GetActivityStreamsObject()
+	if o == nil {
+		return nil
+	}
+	for iter := o.Begin(); iter != o.End(); iter = iter.Next() {
+		t := iter.GetType()
+		if t == nil {
+			continue
+		}
+		id, err := pub.GetId(t)
+		if err != nil {
+			return err
+		}
+		if err := s.storeObject(c, id, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// storeObject stores `t` at `id`, replacing what's there.
+func (s *Service) storeObject(c context.Context, id *url.URL, t vocab.Type) error {
+	if err := s.db.Lock(c, id); err != nil {
+		return err
+	}
+	defer s.db.Unlock(c, id)
+	if exists, err := s.db.Exists(c, id); err != nil {
+		return err
+	} else if exists {
+		return s.db.Update(c, t)
+	}
+	return s.db.Create(c, t)
+}
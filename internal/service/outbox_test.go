@@ -0,0 +1,290 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// postToOutbox posts `activity` to the outbox of the local actor at
+// `actorIRI` with their `token`, returning the recorded answer.
+func postToOutbox(t *testing.T, s *Service, actorIRI string, token string, activity map[string]interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	b, err := json.Marshal(activity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPost, actorIRI+"/outbox", bytes.NewReader(b))
+	r.Header.Set("Content-Type", "application/activity+json")
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	return w
+}
+
+func TestPostOutboxWrapsObject(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	s.db.SetToken("alice-token", aliceIRI)
+	followersIRI := s.boxIRI(aliceIRI, "followers")
+	respondLocally(t, s, transport, followersIRI)
+
+	w := postToOutbox(t, s, aliceIRI.String(), "alice-token", map[string]interface{}{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"type":     "Note",
+		"content":  "<p>hello</p>",
+		"to":       pub.PublicActivityPubIRI,
+		"cc":       followersIRI.String(),
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("posting a Note: %d %s", w.Code, w.Body)
+	}
+	created, err := s.db.Get(c, mustParse(t, w.Header().Get("Location")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	create, ok := created.(vocab.ActivityStreamsCreate)
+	if !ok {
+		t.Fatalf("posted a %s, want a Create", created.GetTypeName())
+	}
+	if got := authorsOf(create); len(got) != 1 || got[0].String() != aliceIRI.String() {
+		t.Errorf("Create by %v, want %s", got, aliceIRI)
+	}
+	if got := addressed(create.GetActivityStreamsTo()); !reflect.DeepEqual(got, []string{pub.PublicActivityPubIRI}) {
+		t.Errorf("Create addressed to %q, want the public", got)
+	}
+	var cc []string
+	for iter := create.GetActivityStreamsCc().Begin(); iter != create.GetActivityStreamsCc().End(); iter = iter.Next() {
+		cc = append(cc, iter.GetIRI().String())
+	}
+	if !reflect.DeepEqual(cc, []string{followersIRI.String()}) {
+		t.Errorf("Create copied to %q, want the followers", cc)
+	}
+
+	noteIRI, err := pub.ToId(create.GetActivityStreamsObject().At(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	note, err := s.db.Get(c, noteIRI)
+	if err != nil {
+		t.Fatalf("the Note wasn't stored: %s", err)
+	}
+	if got := authorsOf(note); len(got) != 1 || got[0].String() != aliceIRI.String() {
+		t.Errorf("Note attributed to %v, want %s", got, aliceIRI)
+	}
+}
+
+func TestPostOutboxRefuses(t *testing.T) {
+	s, transport := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	bobIRI := register(t, s, "bob")
+	s.db.SetToken("alice-token", aliceIRI)
+	respondLocally(t, s, transport, s.boxIRI(aliceIRI, "followers"))
+	note := func(attributedTo, content string) map[string]interface{} {
+		return map[string]interface{}{
+			"type":         "Note",
+			"attributedTo": attributedTo,
+			"content":      content,
+			"to":           pub.PublicActivityPubIRI,
+		}
+	}
+	activity := func(activityType string, object interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"@context": "https://www.w3.org/ns/activitystreams",
+			"type":     activityType,
+			"actor":    aliceIRI.String(),
+			"object":   object,
+			"to":       pub.PublicActivityPubIRI,
+		}
+	}
+	bare := func(object map[string]interface{}) map[string]interface{} {
+		object["@context"] = "https://www.w3.org/ns/activitystreams"
+		return object
+	}
+	tooLong := "<p>" + strings.Repeat("a", s.config.MaxNoteChars) + "</p><p>a</p>"
+	// As many characters as allowed, the new line between the paragraphs
+	// being one.
+	justRight := "<p>" + strings.Repeat("a", s.config.MaxNoteChars-2) + "</p><p>a</p>"
+
+	for _, test := range []struct {
+		name     string
+		activity map[string]interface{}
+		want     int
+	}{
+		{"someone else's note", bare(note(bobIRI.String(), "hi")), http.StatusForbidden},
+		{"creating someone else's note", activity("Create", note(bobIRI.String(), "hi")), http.StatusForbidden},
+		{"updating someone else's note", activity("Update", note(bobIRI.String(), "hi")), http.StatusForbidden},
+		{"sharing someone else's note", activity("Announce", note(bobIRI.String(), "hi")), http.StatusCreated},
+		{"a note too long", bare(note(aliceIRI.String(), tooLong)), http.StatusUnprocessableEntity},
+		{"creating a note too long", activity("Create", note(aliceIRI.String(), tooLong)), http.StatusUnprocessableEntity},
+		{"a note just short enough", bare(note(aliceIRI.String(), justRight)), http.StatusCreated},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if w := postToOutbox(t, s, aliceIRI.String(), "alice-token", test.activity); w.Code != test.want {
+				t.Errorf("%d %s, want %d", w.Code, w.Body, test.want)
+			}
+		})
+	}
+}
+
+func TestPostOutboxOwnership(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	bobIRI := register(t, s, "bob")
+	s.db.SetToken("alice-token", aliceIRI)
+	s.db.SetToken("bob-token", bobIRI)
+	respondLocally(t, s, transport, s.boxIRI(aliceIRI, "followers"), s.boxIRI(bobIRI, "followers"))
+	// post posts a note by `actorIRI`, returning its IRI.
+	post := func(actorIRI, token string) string {
+		t.Helper()
+		w := postToOutbox(t, s, actorIRI, token, map[string]interface{}{
+			"@context": "https://www.w3.org/ns/activitystreams",
+			"type":     "Note",
+			"content":  "<p>hello</p>",
+			"to":       pub.PublicActivityPubIRI,
+		})
+		if w.Code != http.StatusCreated {
+			t.Fatalf("posting a Note: %d %s", w.Code, w.Body)
+		}
+		create, err := s.db.Get(c, mustParse(t, w.Header().Get("Location")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return objectsOf(create)[0].String()
+	}
+	activity := func(activityType string, object interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"@context": "https://www.w3.org/ns/activitystreams",
+			"type":     activityType,
+			"actor":    aliceIRI.String(),
+			"object":   object,
+			"to":       pub.PublicActivityPubIRI,
+		}
+	}
+	aliceNote := post(aliceIRI.String(), "alice-token")
+	bobNote := post(bobIRI.String(), "bob-token")
+
+	for _, test := range []struct {
+		name     string
+		activity map[string]interface{}
+		want     int
+	}{
+		{"deleting someone else's note", activity("Delete", bobNote), http.StatusForbidden},
+		{"deleting what isn't stored", activity("Delete", aliceIRI.String()+"/statuses/gone"), http.StatusForbidden},
+		{"updating someone else's note", activity("Update", map[string]interface{}{
+			"id":      bobNote,
+			"type":    "Note",
+			"content": "<p>mine now</p>",
+		}), http.StatusForbidden},
+		{"undoing someone else's note", activity("Undo", bobNote), http.StatusForbidden},
+		{"updating one's own note", activity("Update", map[string]interface{}{
+			"id":      aliceNote,
+			"type":    "Note",
+			"content": "<p>edited</p>",
+		}), http.StatusCreated},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if w := postToOutbox(t, s, aliceIRI.String(), "alice-token", test.activity); w.Code != test.want {
+				t.Errorf("%d %s, want %d", w.Code, w.Body, test.want)
+			}
+		})
+	}
+
+	note, err := s.db.Get(c, mustParse(t, bobNote))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := noteText(note.(vocab.ActivityStreamsNote)); got != "hello" {
+		t.Errorf("bob's note reads %q after alice's Update, want it untouched", got)
+	}
+	note, err = s.db.Get(c, mustParse(t, aliceNote))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := noteText(note.(vocab.ActivityStreamsNote)); got != "edited" {
+		t.Errorf("alice's note reads %q after her Update, want it stored", got)
+	}
+	if got := authorsOf(note); len(got) != 1 || got[0].String() != aliceIRI.String() {
+		t.Errorf("updated note attributed to %v, want %s", got, aliceIRI)
+	}
+
+	if w := postToOutbox(t, s, aliceIRI.String(), "alice-token", activity("Delete", aliceNote)); w.Code != http.StatusCreated {
+		t.Fatalf("deleting one's own note: %d %s", w.Code, w.Body)
+	}
+	if note, err = s.db.Get(c, mustParse(t, aliceNote)); err != nil {
+		t.Fatal(err)
+	}
+	if note.GetTypeName() != "Tombstone" {
+		t.Errorf("alice's note is a %s after she deleted it, want a Tombstone", note.GetTypeName())
+	}
+}
+
+func TestPostOutboxAssignsIDs(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	s.db.SetToken("alice-token", aliceIRI)
+	respondLocally(t, s, transport, s.boxIRI(aliceIRI, "followers"))
+
+	seen := map[string]bool{}
+	// assigned checks `t` has an id no other has, and a published time.
+	assigned := func(t *testing.T, what string, v vocab.Type) {
+		t.Helper()
+		id, err := pub.GetId(v)
+		if err != nil {
+			t.Fatalf("%s has no id: %s", what, err)
+		}
+		if seen[id.String()] {
+			t.Errorf("%s has the id %s, already given", what, id)
+		}
+		seen[id.String()] = true
+		published, ok := v.(interface {
+			GetActivityStreamsPublished() vocab.ActivityStreamsPublishedProperty
+		})
+		if !ok || published.GetActivityStreamsPublished() == nil || published.GetActivityStreamsPublished().Get().IsZero() {
+			t.Errorf("%s %s has no published time", what, id)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		w := postToOutbox(t, s, aliceIRI.String(), "alice-token", map[string]interface{}{
+			"@context": "https://www.w3.org/ns/activitystreams",
+			"type":     "Create",
+			"object": map[string]interface{}{
+				"type":    "Note",
+				"content": "<p>hello</p>",
+				"to":      pub.PublicActivityPubIRI,
+			},
+			"to": pub.PublicActivityPubIRI,
+		})
+		if w.Code != http.StatusCreated {
+			t.Fatalf("posting a Create: %d %s", w.Code, w.Body)
+		}
+		create, err := s.db.Get(c, mustParse(t, w.Header().Get("Location")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assigned(t, "Create", create)
+		note := create.(vocab.ActivityStreamsCreate).GetActivityStreamsObject().At(0).GetType()
+		if note == nil {
+			t.Fatal("the Create doesn't embed its Note")
+		}
+		assigned(t, "Note", note)
+		noteID, _ := pub.GetId(note)
+		if _, err := s.db.Get(c, noteID); err != nil {
+			t.Errorf("the Note wasn't stored at its id: %s", err)
+		}
+	}
+}
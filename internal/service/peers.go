@@ -0,0 +1,156 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Peer is another instance we've dealt with.
+type Peer struct {
+	Domain string
+	// What the peer runs, as its NodeInfo says, if we could find out.
+	Software string
+	Version  string
+	// When we first dealt with the peer, this run.
+	FirstSeen time.Time
+}
+
+// knownPeer is a Peer whose NodeInfo may still be on its way.
+type knownPeer struct {
+	mu   sync.Mutex
+	peer Peer
+}
+
+// The NodeInfo schemas we read, most preferred first.
+var nodeInfoSchemas = []string{
+	"http://nodeinfo.diaspora.software/ns/schema/2.1",
+	"http://nodeinfo.diaspora.software/ns/schema/2.0",
+}
+
+// notePeer records that we've dealt with the instance at `host`, looking up
+// what software it runs the first time.
+func (s *Service) notePeer(host string) {
+	if host == "" || s.db.IsLocalHost(host) {
+		return
+	}
+	kp := &knownPeer{peer: Peer{Domain: host, FirstSeen: s.Now()}}
+	if _, loaded := s.instances.LoadOrStore(host, kp); loaded {
+		return
+	}
+	go func() {
+		c, cancel := context.WithTimeout(context.Background(), 2*s.config.FetchTimeout)
+		defer cancel()
+		software, version, err := s.fetchNodeInfo(c, host)
+		if err != nil {
+			return
+		}
+		kp.mu.Lock()
+		kp.peer.Software, kp.peer.Version = software, version
+		kp.mu.Unlock()
+	}()
+}
+
+// fetchNodeInfo finds out what software `host` runs from its NodeInfo.
+func (s *Service) fetchNodeInfo(c context.Context, host string) (software, version string, err error) {
+	b, err := s.fetchPlain(c, &url.URL{Scheme: "https", Host: host, Path: "/.well-known/nodeinfo"})
+	if err != nil {
+		return "", "", err
+	}
+	var index struct {
+		Links []struct {
+			Rel  string `json:"rel"`
+			Href string `json:"href"`
+		} `json:"links"`
+	}
+	if err := json.Unmarshal(b, &index); err != nil {
+		return "", "", err
+	}
+	var href string
+	for _, schema := range nodeInfoSchemas {
+		for _, link := range index.Links {
+			if link.Rel == schema && href == "" {
+				href = link.Href
+			}
+		}
+	}
+	if href == "" {
+		return "", "", errors.New("no NodeInfo 2.x")
+	}
+	u, err := url.Parse(href)
+	if err != nil {
+		return "", "", err
+	}
+	if b, err = s.fetchPlain(c, u); err != nil {
+		return "", "", err
+	}
+	var nodeInfo struct {
+		Software struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"software"`
+	}
+	if err := json.Unmarshal(b, &nodeInfo); err != nil {
+		return "", "", err
+	}
+	return strings.ToLower(nodeInfo.Software.Name), nodeInfo.Software.Version, nil
+}
+
+// fetchPlain GETs `iri` without signing, through the transport tests set if
+// there is one.
+func (s *Service) fetchPlain(c context.Context, iri *url.URL) ([]byte, error) {
+	if s.transport != nil {
+		return s.transport.Dereference(c, iri)
+	}
+	req, err := http.NewRequestWithContext(c, http.MethodGet, iri.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", iri, resp.Status)
+	}
+	return s.readResponse(resp)
+}
+
+// Peers returns the instances we know of, by domain: those we've dealt with
+// and those of everything we've stored from peers.
+func (s *Service) Peers(c context.Context) ([]Peer, error) {
+	domains, err := s.db.PeerDomains(c)
+	if err != nil {
+		return nil, err
+	}
+	byDomain := make(map[string]Peer)
+	for _, domain := range domains {
+		byDomain[domain] = Peer{Domain: domain}
+	}
+	s.instances.Range(func(key, value interface{}) bool {
+		kp := value.(*knownPeer)
+		kp.mu.Lock()
+		byDomain[key.(string)] = kp.peer
+		kp.mu.Unlock()
+		return true
+	})
+	peers := make([]Peer, 0, len(byDomain))
+	for _, p := range byDomain {
+		peers = append(peers, p)
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].Domain < peers[j].Domain })
+	return peers, nil
+}
@@ -0,0 +1,70 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// waitForPeer waits for `domain` to be a peer whose software we know, and
+// returns it.
+func waitForPeer(t *testing.T, s *Service, domain string) Peer {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		peers, err := s.Peers(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range peers {
+			if p.Domain == domain && p.Software != "" {
+				return p
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no software for %s among %+v", domain, peers)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPeers(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	bob := newTestPeer(t, transport, "https://remote.test/users/bob", "rsa")
+	respondJSON(t, transport, "https://remote.test/.well-known/nodeinfo", map[string]interface{}{
+		"links": []interface{}{
+			map[string]interface{}{"rel": "http://nodeinfo.diaspora.software/ns/schema/2.0", "href": "https://remote.test/nodeinfo/2.0"},
+			map[string]interface{}{"rel": "http://nodeinfo.diaspora.software/ns/schema/2.1", "href": "https://remote.test/nodeinfo/2.1"},
+		},
+	})
+	respondJSON(t, transport, "https://remote.test/nodeinfo/2.1", map[string]interface{}{
+		"software": map[string]interface{}{"name": "Mastodon", "version": "4.3.0"},
+	})
+	// Stored from a thread, say, but never dealt with.
+	storeReply(t, s, "https://other.test/notes/1", "", "2026-10-16T12:00:00Z")
+
+	deliver(t, s, bob, s.boxIRI(aliceIRI, "inbox"), creating(postBy("Note", "https://remote.test/notes/1", bob.iri.String(), aliceIRI.String())))
+	if p := waitForPeer(t, s, "remote.test"); p.Software != "mastodon" || p.Version != "4.3.0" || p.FirstSeen.IsZero() {
+		t.Errorf("peer %+v", p)
+	}
+
+	peers, err := s.Peers(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var domains []string
+	for _, p := range peers {
+		domains = append(domains, p.Domain)
+		if s.db.IsLocalHost(p.Domain) {
+			t.Errorf("our own domain %s among the peers", p.Domain)
+		}
+	}
+	if len(domains) != 2 || domains[0] != "other.test" || domains[1] != "remote.test" {
+		t.Errorf("peers %v, want other.test and remote.test", domains)
+	}
+}
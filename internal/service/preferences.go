@@ -0,0 +1,100 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"net/url"
+	"path"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// Who a status is for, as Mastodon puts it:
+//   - public: everyone, and shown on public timelines
+//   - unlisted: everyone, but kept off public timelines
+//   - private: the author's followers
+//   - direct: only the people it mentions
+const (
+	VisibilityPublic   = "public"
+	VisibilityUnlisted = "unlisted"
+	VisibilityPrivate  = "private"
+	VisibilityDirect   = "direct"
+)
+
+func isVisibility(v string) bool {
+	switch v {
+	case VisibilityPublic, VisibilityUnlisted, VisibilityPrivate, VisibilityDirect:
+		return true
+	}
+	return false
+}
+
+// Visibility works out who `t` is for from how it's addressed.
+func Visibility(t vocab.Type) string {
+	o, ok := t.(interface {
+		GetActivityStreamsTo() vocab.ActivityStreamsToProperty
+	})
+	if ok && o.GetActivityStreamsTo() != nil {
+		for iter := o.GetActivityStreamsTo().Begin(); iter != o.GetActivityStreamsTo().End(); iter = iter.Next() {
+			if iter.IsIRI() && iter.GetIRI().String() == publicIRI.String() {
+				return VisibilityPublic
+			}
+		}
+	}
+	for _, r := range recipientsOf(t) {
+		if r.String() == publicIRI.String() {
+			return VisibilityUnlisted
+		}
+	}
+	for _, r := range recipientsOf(t) {
+		if path.Base(r.Path) == "followers" {
+			return VisibilityPrivate
+		}
+	}
+	return VisibilityDirect
+}
+
+// Sensitive reports whether `t` is marked sensitive, as statuses behind a
+// content warning are. Go-Fed has no `sensitive` property: it keeps it as it
+// read it.
+func Sensitive(t vocab.Type) bool {
+	m, err := streams.Serialize(t)
+	if err != nil {
+		return false
+	}
+	sensitive, _ := m["sensitive"].(bool)
+	return sensitive
+}
+
+// Preferences are what a local user's statuses get when their client
+// doesn't say.
+type Preferences struct {
+	Visibility string
+	Sensitive  bool
+	// An ISO 639-1 code.
+	Language string
+}
+
+// Preferences returns the preferences of the local actor at `actorIRI`,
+// falling back on the instance's defaults.
+func (s *Service) Preferences(c context.Context, actorIRI *url.URL) (Preferences, error) {
+	account, err := s.db.Account(path.Base(actorIRI.Path))
+	if err != nil {
+		return Preferences{}, err
+	}
+	p := Preferences{
+		Visibility: account.DefaultVisibility,
+		Sensitive:  account.DefaultSensitive,
+		Language:   account.DefaultLanguage,
+	}
+	if p.Visibility == "" {
+		p.Visibility = VisibilityPublic
+	}
+	if p.Language == "" {
+		p.Language = s.config.DefaultLanguage
+	}
+	return p, nil
+}
@@ -0,0 +1,76 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"net/url"
+	"time"
+)
+
+// PruneReport is what Prune got through.
+type PruneReport struct {
+	// The remote objects old enough to prune.
+	Stale int
+	// Those of them still referenced, and so kept.
+	Kept int
+	// Those removed.
+	Removed int
+}
+
+// Prune removes what we've cached from peers that was published more than
+// `olderThan` ago and that nothing we store references any longer (see
+// db.RefCount), to bound how much we store. Local content is never pruned.
+// Removing an activity can leave its objects unreferenced, so we go round
+// until nothing more can be removed. Removals are made `batchSize` at a
+// time, stopping between batches once `c` is done.
+func (s *Service) Prune(c context.Context, olderThan time.Duration, batchSize int) (report PruneReport, err error) {
+	stale, err := s.db.RemoteObjectsBefore(c, s.Now().Add(-olderThan))
+	if err != nil {
+		return report, err
+	}
+	report.Stale = len(stale)
+	for {
+		var kept, batch []*url.URL
+		removed := report.Removed
+		for i, id := range stale {
+			if s.db.RefCount(id) > 0 {
+				kept = append(kept, id)
+			} else {
+				batch = append(batch, id)
+			}
+			if len(batch) < batchSize && i < len(stale)-1 {
+				continue
+			}
+			if err := s.removeBatch(c, batch); err != nil {
+				return report, err
+			}
+			report.Removed += len(batch)
+			batch = batch[:0]
+			if err := c.Err(); err != nil {
+				return report, err
+			}
+		}
+		report.Kept = len(kept)
+		if report.Removed == removed || len(kept) == 0 {
+			return report, nil
+		}
+		stale = kept
+	}
+}
+
+// removeBatch deletes the objects at `ids`.
+func (s *Service) removeBatch(c context.Context, ids []*url.URL) error {
+	for _, id := range ids {
+		if err := s.db.Lock(c, id); err != nil {
+			return err
+		}
+		err := s.db.Delete(c, id)
+		s.db.Unlock(c, id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+func TestPrune(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	bob := newTestPeer(t, transport, "https://remote.test/users/bob", "rsa")
+	following(t, s, aliceIRI, bob.iri)
+	// Delivered, so in alice's inbox.
+	deliver(t, s, bob, s.boxIRI(aliceIRI, "inbox"), creating(postBy("Note", "https://remote.test/notes/1", bob.iri.String(), aliceIRI.String())))
+	// Fetched along a thread, say, but referenced by nothing.
+	storeReply(t, s, "https://remote.test/notes/2", "", "2026-10-16T12:00:00Z")
+	storeReply(t, s, "https://remote.test/notes/3", "", "2026-10-16T12:00:00Z")
+	// Once its Create goes, so can the note it carries.
+	orphan := creating(postBy("Note", "https://remote.test/notes/5", bob.iri.String(), aliceIRI.String()))
+	orphan["published"] = "2026-10-16T12:00:00Z"
+	activity, err := streams.ToType(c, orphan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.storeFetched(c, activity); err != nil {
+		t.Fatal(err)
+	}
+	// Too recent to prune.
+	storeReply(t, s, "https://remote.test/notes/4", "", "2026-11-30T12:00:00Z")
+	s.SetClock(&testClock{now: time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC)})
+	local, err := s.PostStatus(c, aliceIRI, StatusParams{Status: "mine", Visibility: VisibilityPublic})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := s.Prune(c, 30*24*time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The delivered note is kept; its Create, unpublished, isn't stale.
+	if report.Stale != 5 || report.Kept != 1 || report.Removed != 4 {
+		t.Errorf("report %+v, want 5 stale, 1 kept and 4 removed", report)
+	}
+	for iri, want := range map[string]bool{
+		"https://remote.test/notes/1":          true,
+		"https://remote.test/notes/1/activity": true,
+		"https://remote.test/notes/2":          false,
+		"https://remote.test/notes/3":          false,
+		"https://remote.test/notes/4":          true,
+		"https://remote.test/notes/5":          false,
+		"https://remote.test/notes/5/activity": false,
+		local.GetJSONLDId().Get().String():     true,
+	} {
+		if exists, err := s.db.Exists(c, mustParse(t, iri)); err != nil || exists != want {
+			t.Errorf("%s exists: %t, %v, want %t", iri, exists, err, want)
+		}
+	}
+}
+
+func TestPruneOnceUnliked(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	bob := newTestPeer(t, transport, "https://remote.test/users/bob", "rsa")
+	deliver(t, s, bob, s.boxIRI(aliceIRI, "inbox"), creating(postBy("Note", "https://remote.test/notes/1", bob.iri.String(), aliceIRI.String())))
+	// Delivering it put its Create in alice's inbox.
+	if n := s.db.RefCount(mustParse(t, "https://remote.test/notes/1/activity")); n != 1 {
+		t.Errorf("the Create is referenced %d times, want once", n)
+	}
+
+	const noteIRI = "https://remote.test/notes/2"
+	storeReply(t, s, noteIRI, "", "2026-10-16T12:00:00Z")
+	likedIRI := s.boxIRI(aliceIRI, "liked")
+	addToCollection(t, s, likedIRI, mustParse(t, noteIRI), func(c context.Context) (vocab.ActivityStreamsCollection, error) {
+		return s.db.Liked(c, aliceIRI)
+	})
+	s.SetClock(&testClock{now: time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC)})
+	if report, err := s.Prune(c, 30*24*time.Hour, 10); err != nil || report.Removed != 0 {
+		t.Fatalf("pruned %+v, %v while everything's referenced", report, err)
+	}
+
+	// Once alice no longer likes it, it goes.
+	if err := s.db.Lock(c, likedIRI); err != nil {
+		t.Fatal(err)
+	}
+	liked, err := s.db.Liked(c, aliceIRI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	liked.SetActivityStreamsItems(nil)
+	err = s.db.Update(c, liked)
+	s.db.Unlock(c, likedIRI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := s.db.RefCount(mustParse(t, noteIRI)); n != 0 {
+		t.Errorf("the note unliked is referenced %d times", n)
+	}
+	if report, err := s.Prune(c, 30*24*time.Hour, 10); err != nil || report.Removed != 1 {
+		t.Errorf("pruned %+v, %v, want the note unliked removed", report, err)
+	}
+}
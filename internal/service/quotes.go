@@ -0,0 +1,169 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"html"
+	"net/url"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// The properties implementations put the object a post quotes in, which
+// Go-Fed doesn't know and leaves among the unknown properties. In order of
+// preference, before FEP-e232 quote links:
+//   - quote: FEP-044f, which Mastodon follows
+//   - quoteUrl: Pleroma and Akkoma, under the ActivityStreams namespace
+//   - quoteUri: Fedibird
+//   - _misskey_quote: Misskey and its forks
+var quoteProperties = []string{"quote", "quoteUrl", "quoteUri", "_misskey_quote"}
+
+// The link relation FEP-e232 quote links carry, as Misskey coined it.
+const quoteRel = "https://misskey-hub.net/ns#_misskey_quote"
+
+// QuoteOf returns the IRI of the object `t` quotes, if it quotes one.
+func QuoteOf(t vocab.Type) *url.URL {
+	if o, ok := t.(interface {
+		GetUnknownProperties() map[string]interface{}
+	}); ok {
+		unknown := o.GetUnknownProperties()
+		for _, p := range quoteProperties {
+			if iri := iriOf(unknown[p]); iri != nil {
+				return iri
+			}
+		}
+	}
+	return quoteLinkOf(t)
+}
+
+// quoteLinkOf returns the IRI in the FEP-e232 quote link `t` is tagged with,
+// if any: a Link to an ActivityStreams object with the quote relation.
+func quoteLinkOf(t vocab.Type) *url.URL {
+	o, ok := t.(interface {
+		GetActivityStreamsTag() vocab.ActivityStreamsTagProperty
+	})
+	if !ok || o.GetActivityStreamsTag() == nil {
+		return nil
+	}
+	for iter := o.GetActivityStreamsTag().Begin(); iter != o.GetActivityStreamsTag().End(); iter = iter.Next() {
+		if !iter.IsActivityStreamsLink() {
+			continue
+		}
+		link := iter.GetActivityStreamsLink()
+		if link.GetActivityStreamsHref() == nil || link.GetActivityStreamsHref().Get() == nil {
+			continue
+		}
+		if mt := link.GetActivityStreamsMediaType(); mt == nil || !isActivityStreamsMediaType(mt.Get()) {
+			continue
+		}
+		if rel := link.GetActivityStreamsRel(); rel != nil {
+			// Being an IRI, the relation reads back as one.
+			for r := rel.Begin(); r != rel.End(); r = r.Next() {
+				if (r.IsRFCRfc5988() && r.Get() == quoteRel) || (r.IsIRI() && r.GetIRI().String() == quoteRel) {
+					return link.GetActivityStreamsHref().Get()
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// newQuoteLink builds the FEP-e232 quote link for a note quoting `iri`.
+func newQuoteLink(iri *url.URL) vocab.ActivityStreamsLink {
+	link := streams.NewActivityStreamsLink()
+	href := streams.NewActivityStreamsHrefProperty()
+	href.Set(iri)
+	link.SetActivityStreamsHref(href)
+	mediaType := streams.NewActivityStreamsMediaTypeProperty()
+	mediaType.Set(mediaTypeLDJSON)
+	link.SetActivityStreamsMediaType(mediaType)
+	rel := streams.NewActivityStreamsRelProperty()
+	rel.AppendRFCRfc5988(quoteRel)
+	link.SetActivityStreamsRel(rel)
+	name := streams.NewActivityStreamsNameProperty()
+	name.AppendXMLSchemaString("RE: " + iri.String())
+	link.SetActivityStreamsName(name)
+	return link
+}
+
+// quoteInline is the fallback FEP-e232 asks for in the content of a quote,
+// for implementations that don't show quotes.
+func quoteInline(iri *url.URL) string {
+	return `<p class="quote-inline">RE: <a href="` + html.EscapeString(iri.String()) + `">` +
+		html.EscapeString(iri.String()) + "</a></p>"
+}
+
+// checkQuotable refuses quotes of objects the local actor at `actorIRI`
+// can't see, or whose authors didn't make them public.
+func (s *Service) checkQuotable(c context.Context, actorIRI, iri *url.URL) error {
+	quoted, err := s.RefreshObject(c, actorIRI, iri)
+	if err != nil || len(s.visible(c, []vocab.Type{quoted})) == 0 {
+		return &ValidationError{"Quoted status could not be found"}
+	}
+	switch Visibility(quoted) {
+	case VisibilityPublic, VisibilityUnlisted:
+		return nil
+	}
+	return &ValidationError{"Quoted status is not public"}
+}
+
+// iriOf makes out an IRI from a raw JSON-LD value: a string, an object with
+// an `id`, or a list of either, in which case the first IRI wins.
+func iriOf(v interface{}) *url.URL {
+	switch v := v.(type) {
+	case string:
+		if iri, err := url.Parse(v); err == nil && iri.IsAbs() {
+			return iri
+		}
+	case map[string]interface{}:
+		return iriOf(v["id"])
+	case []interface{}:
+		for _, e := range v {
+			if iri := iriOf(e); iri != nil {
+				return iri
+			}
+		}
+	}
+	return nil
+}
+
+// irisOf makes out the IRIs in a raw JSON-LD value, as iriOf does, but all
+// of them.
+func irisOf(v interface{}) (iris []*url.URL) {
+	if l, ok := v.([]interface{}); ok {
+		for _, e := range l {
+			iris = append(iris, irisOf(e)...)
+		}
+		return
+	}
+	if iri := iriOf(v); iri != nil {
+		iris = append(iris, iri)
+	}
+	return
+}
+
+// Quoted returns the object `t` quotes, or nil if it quotes none, or none
+// `viewerIRI` may see. Quoted objects we don't have are fetched on behalf of
+// `viewerIRI`, unless they're nil.
+func (s *Service) Quoted(c context.Context, viewerIRI *url.URL, t vocab.Type) (vocab.Type, error) {
+	iri := QuoteOf(t)
+	if iri == nil {
+		return nil, nil
+	}
+	quoted, err := s.db.Get(c, iri)
+	if err != nil {
+		if viewerIRI == nil {
+			return nil, nil
+		}
+		if quoted, err = s.RefreshObject(c, viewerIRI, iri); err != nil {
+			return nil, err
+		}
+	}
+	if len(s.visible(c, []vocab.Type{quoted})) == 0 {
+		return nil, nil
+	}
+	return quoted, nil
+}
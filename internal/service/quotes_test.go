@@ -0,0 +1,128 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+)
+
+func TestQuoteOf(t *testing.T) {
+	const quoted = "https://remote.test/notes/1"
+	for name, m := range map[string]map[string]interface{}{
+		"quoteUrl":       {"quoteUrl": quoted},
+		"quoteUri":       {"quoteUri": quoted},
+		"_misskey_quote": {"_misskey_quote": quoted},
+		"FEP-e232 link": {"tag": map[string]interface{}{
+			"type":      "Link",
+			"mediaType": `application/ld+json; profile="https://www.w3.org/ns/activitystreams"`,
+			"href":      quoted,
+			"rel":       quoteRel,
+		}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			m["@context"] = "https://www.w3.org/ns/activitystreams"
+			m["type"] = "Note"
+			note, err := streams.ToType(context.Background(), m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := QuoteOf(note); got == nil || got.String() != quoted {
+				t.Errorf("QuoteOf = %v, want %s", got, quoted)
+			}
+		})
+	}
+
+	link := map[string]interface{}{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"type":     "Note",
+		"tag": map[string]interface{}{
+			"type": "Link",
+			"href": quoted,
+			"rel":  "https://example.com/ns#other",
+		},
+	}
+	note, err := streams.ToType(context.Background(), link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := QuoteOf(note); got != nil {
+		t.Errorf("QuoteOf a link of another relation = %s", got)
+	}
+}
+
+func TestQuoteLinkRoundTrip(t *testing.T) {
+	iri := mustParse(t, "https://remote.test/notes/1")
+	note := streams.NewActivityStreamsNote()
+	tags := streams.NewActivityStreamsTagProperty()
+	tags.AppendActivityStreamsLink(newQuoteLink(iri))
+	note.SetActivityStreamsTag(tags)
+	if got := QuoteOf(note); got == nil || got.String() != iri.String() {
+		t.Fatalf("QuoteOf = %v, want %s", got, iri)
+	}
+	// As peers, or our own database, read it back.
+	m, err := streams.Serialize(note)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, err := streams.ToType(context.Background(), m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := QuoteOf(read); got == nil || got.String() != iri.String() {
+		t.Errorf("QuoteOf read back = %v, want %s", got, iri)
+	}
+}
+
+func TestIngestQuotes(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	inboxIRI := s.boxIRI(aliceIRI, "inbox")
+	bob := newTestPeer(t, transport, "https://remote.test/users/bob", "rsa")
+	carol := newTestPeer(t, transport, "https://other.test/users/carol", "rsa")
+	// The quoted note, which we don't have until a quote of it comes in.
+	quoted := postBy("Note", "https://other.test/notes/1", carol.iri.String(), carol.iri.String()+"/followers")
+	quoted["@context"] = "https://www.w3.org/ns/activitystreams"
+	respondJSON(t, transport, quoted["id"].(string), quoted)
+
+	for i, convention := range []map[string]interface{}{
+		{"quote": quoted["id"]},
+		{"quoteUrl": quoted["id"]},
+		{"quoteUri": quoted["id"]},
+		{"_misskey_quote": quoted["id"]},
+		// Misskey sends both, Pleroma an object.
+		{"_misskey_quote": quoted["id"], "quoteUrl": quoted["id"]},
+		{"quoteUrl": map[string]interface{}{"id": quoted["id"], "type": "Note"}},
+		{"tag": []interface{}{map[string]interface{}{
+			"type":      "Link",
+			"mediaType": "application/activity+json",
+			"href":      quoted["id"],
+			"rel":       quoteRel,
+		}}},
+	} {
+		id := fmt.Sprintf("https://remote.test/notes/%d", i+1)
+		note := postBy("Note", id, bob.iri.String(), aliceIRI.String())
+		for k, v := range convention {
+			note[k] = v
+		}
+		deliver(t, s, bob, inboxIRI, creating(note))
+
+		stored, err := s.db.Get(c, mustParse(t, id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := s.Quoted(c, aliceIRI, stored)
+		if err != nil {
+			t.Fatalf("quoting by %v: %s", convention, err)
+		}
+		if gotID, err := pub.GetId(got); err != nil || gotID.String() != quoted["id"] {
+			t.Errorf("quoting by %v quoted %v, want %s", convention, got, quoted["id"])
+		}
+	}
+}
@@ -0,0 +1,175 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// Every local status also has `likes` and `shares` collections, listing the
+// Likes and Announces of it we know of, so peers can show how it's been
+// received. Go-Fed's default Like and Announce callbacks keep them, embedded
+// in the status; we serve them at their own IRIs instead, and only for
+// statuses everyone may see.
+
+// likesIRI and sharesIRI are where the likes and shares of the local status
+// at `id` are served.
+func likesIRI(id *url.URL) *url.URL {
+	u := *id
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/likes"
+	return &u
+}
+
+func sharesIRI(id *url.URL) *url.URL {
+	u := *id
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/shares"
+	return &u
+}
+
+// likesOf and sharesOf pick the collection of likes or shares Go-Fed
+// embedded in `t`, if any.
+func likesOf(t vocab.Type) vocab.Type {
+	if o, ok := t.(interface {
+		GetActivityStreamsLikes() vocab.ActivityStreamsLikesProperty
+	}); ok && o.GetActivityStreamsLikes() != nil {
+		return o.GetActivityStreamsLikes().GetType()
+	}
+	return nil
+}
+
+func sharesOf(t vocab.Type) vocab.Type {
+	if o, ok := t.(interface {
+		GetActivityStreamsShares() vocab.ActivityStreamsSharesProperty
+	}); ok && o.GetActivityStreamsShares() != nil {
+		return o.GetActivityStreamsShares().GetType()
+	}
+	return nil
+}
+
+// embeddedItems returns the IRIs of the items of the embedded collection
+// `col`.
+func embeddedItems(col vocab.Type) (items []*url.URL) {
+	switch col := col.(type) {
+	case vocab.ActivityStreamsCollection:
+		if prop := col.GetActivityStreamsItems(); prop != nil {
+			for iter := prop.Begin(); iter != prop.End(); iter = iter.Next() {
+				if id, err := pub.ToId(iter); err == nil {
+					items = append(items, id)
+				}
+			}
+		}
+	case vocab.ActivityStreamsOrderedCollection:
+		if prop := col.GetActivityStreamsOrderedItems(); prop != nil {
+			for iter := prop.Begin(); iter != prop.End(); iter = iter.Next() {
+				if id, err := pub.ToId(iter); err == nil {
+					items = append(items, id)
+				}
+			}
+		}
+	}
+	return
+}
+
+// reactionItems returns the Likes or Announces of the local status whose
+// `likes` or `shares` collection is at `id`, newest first, and whether `id`
+// is such a collection at all. Statuses that aren't public have none to
+// show.
+func (s *Service) reactionItems(c context.Context, id *url.URL) ([]*url.URL, bool) {
+	var suffix string
+	var collection func(vocab.Type) vocab.Type
+	switch {
+	case strings.HasSuffix(id.Path, "/likes"):
+		suffix, collection = "/likes", likesOf
+	case strings.HasSuffix(id.Path, "/shares"):
+		suffix, collection = "/shares", sharesOf
+	default:
+		return nil, false
+	}
+	statusIRI := *id
+	statusIRI.Path = strings.TrimSuffix(id.Path, suffix)
+	statusIRI.RawQuery = ""
+	if owns, err := s.db.Owns(c, &statusIRI); err != nil || !owns {
+		return nil, false
+	}
+	status, err := s.db.Get(c, &statusIRI)
+	if err != nil || !IsSupportedStatus(status) || !isPublic(status) {
+		return nil, false
+	}
+	return embeddedItems(collection(status)), true
+}
+
+// withReactions replaces the likes and shares embedded in `m`, the local
+// status `t` at `id` serialized, with their sizes and, if it's public, the
+// IRIs to fetch them at. The stored status is left alone, Go-Fed adding to
+// it.
+func withReactions(m map[string]interface{}, t vocab.Type, id *url.URL) {
+	if !IsSupportedStatus(t) {
+		return
+	}
+	for _, r := range []struct {
+		key        string
+		collection func(vocab.Type) vocab.Type
+		iri        func(*url.URL) *url.URL
+	}{
+		{"likes", likesOf, likesIRI},
+		{"shares", sharesOf, sharesIRI},
+	} {
+		col := map[string]interface{}{
+			"type":       "Collection",
+			"totalItems": len(embeddedItems(r.collection(t))),
+		}
+		if isPublic(t) {
+			col["id"] = r.iri(id).String()
+		}
+		m[r.key] = col
+	}
+}
+
+// LikedBy lists the actors who liked our object at `iri`, newest first.
+func (s *Service) LikedBy(c context.Context, iri *url.URL) ([]*url.URL, error) {
+	return s.reactors(c, iri, likesOf)
+}
+
+// SharedBy lists the actors who announced our object at `iri`, newest
+// first.
+func (s *Service) SharedBy(c context.Context, iri *url.URL) ([]*url.URL, error) {
+	return s.reactors(c, iri, sharesOf)
+}
+
+// reactors returns the actors of the activities in the collection
+// `collection` picks out of our object at `iri`. Go-Fed keeps the likes and
+// shares of our objects as collections embedded in them, holding the IRIs of
+// the Likes and Announces.
+func (s *Service) reactors(c context.Context,
+	iri *url.URL,
+	collection func(vocab.Type) vocab.Type) ([]*url.URL, error) {
+	if owns, err := s.db.Owns(c, iri); err != nil || !owns {
+		return nil, ErrNotFound
+	}
+	t, err := s.db.Get(c, iri)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	activityIRIs := embeddedItems(collection(t))
+	seen := make(map[string]bool)
+	var actors []*url.URL
+	for _, activityIRI := range activityIRIs {
+		activity, err := s.db.Get(c, activityIRI)
+		if err != nil {
+			continue
+		}
+		for _, actorIRI := range authorsOf(activity) {
+			if !seen[actorIRI.String()] {
+				seen[actorIRI.String()] = true
+				actors = append(actors, actorIRI)
+			}
+		}
+	}
+	return actors, nil
+}
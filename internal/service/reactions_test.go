@@ -0,0 +1,150 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/go-fed/activity/pub"
+)
+
+// reacting returns an activity of `activityType` by `p` of the object at
+// `objectIRI`.
+func reacting(p *testPeer, activityType, id, objectIRI string) map[string]interface{} {
+	return map[string]interface{}{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id":       id,
+		"type":     activityType,
+		"actor":    p.iri.String(),
+		"object":   objectIRI,
+		"to":       []interface{}{pub.PublicActivityPubIRI},
+	}
+}
+
+func TestLikedAndSharedBy(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	inboxIRI := s.boxIRI(aliceIRI, "inbox")
+	bob := newTestPeer(t, transport, "https://remote.test/users/bob", "rsa")
+	carol := newTestPeer(t, transport, "https://other.test/users/carol", "rsa")
+	note, err := s.PostStatus(c, aliceIRI, StatusParams{Status: "hello", Visibility: VisibilityPublic})
+	if err != nil {
+		t.Fatal(err)
+	}
+	noteIRI := note.GetJSONLDId().Get()
+
+	deliver(t, s, bob, inboxIRI, reacting(bob, "Like", "https://remote.test/likes/1", noteIRI.String()))
+	deliver(t, s, carol, inboxIRI, reacting(carol, "Like", "https://other.test/likes/1", noteIRI.String()))
+	deliver(t, s, carol, inboxIRI, reacting(carol, "Announce", "https://other.test/announces/1", noteIRI.String()))
+
+	actors := func(list func(context.Context, *url.URL) ([]*url.URL, error)) []string {
+		t.Helper()
+		iris, err := list(c, noteIRI)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, iri := range iris {
+			got = append(got, iri.String())
+		}
+		sort.Strings(got)
+		return got
+	}
+	if got, want := actors(s.LikedBy), []string{carol.iri.String(), bob.iri.String()}; !reflect.DeepEqual(got, want) {
+		t.Errorf("liked by %v, want %v", got, want)
+	}
+	if got, want := actors(s.SharedBy), []string{carol.iri.String()}; !reflect.DeepEqual(got, want) {
+		t.Errorf("shared by %v, want %v", got, want)
+	}
+
+	// Only our own statuses keep count.
+	if _, err := s.LikedBy(c, mustParse(t, "https://remote.test/notes/1")); err != ErrNotFound {
+		t.Errorf("likes of a remote note: %v", err)
+	}
+}
+
+func TestEmojiReactions(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	inboxIRI := s.boxIRI(aliceIRI, "inbox")
+	bob := newTestPeer(t, transport, "https://remote.test/users/bob", "rsa")
+	carol := newTestPeer(t, transport, "https://other.test/users/carol", "rsa")
+	note, err := s.PostStatus(c, aliceIRI, StatusParams{Status: "hello", Visibility: VisibilityPublic})
+	if err != nil {
+		t.Fatal(err)
+	}
+	noteIRI := note.GetJSONLDId().Get()
+
+	// As Pleroma reacts with an EmojiReact, and Misskey with a Like.
+	reactingWith := func(p *testPeer, activityType, id, emoji string) map[string]interface{} {
+		m := reacting(p, activityType, id, noteIRI.String())
+		m["content"] = emoji
+		return m
+	}
+	undoing := func(p *testPeer, activity map[string]interface{}) map[string]interface{} {
+		embedded := make(map[string]interface{})
+		for k, v := range activity {
+			if k != "@context" {
+				embedded[k] = v
+			}
+		}
+		m := reacting(p, "Undo", activity["id"].(string)+"#undo", "")
+		m["object"] = embedded
+		return m
+	}
+	counts := func() string {
+		t.Helper()
+		reactions, err := s.EmojiReactions(c, noteIRI)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var b strings.Builder
+		for _, r := range reactions {
+			var actors []string
+			for _, iri := range r.Actors {
+				actors = append(actors, iri.String())
+			}
+			sort.Strings(actors)
+			fmt.Fprintf(&b, "%s x%d %v\n", r.Emoji, r.Count, actors)
+		}
+		return b.String()
+	}
+
+	bobThumbs := reactingWith(bob, "EmojiReact", "https://remote.test/reactions/1", "👍")
+	carolThumbs := reactingWith(carol, "Like", "https://other.test/likes/1", "👍")
+	carolParty := reactingWith(carol, "EmojiReact", "https://other.test/reactions/1", "🎉")
+	deliver(t, s, bob, inboxIRI, bobThumbs)
+	deliver(t, s, carol, inboxIRI, carolThumbs)
+	deliver(t, s, carol, inboxIRI, carolParty)
+	want := "👍 x2 [https://other.test/users/carol https://remote.test/users/bob]\n" +
+		"🎉 x1 [https://other.test/users/carol]\n"
+	if got := counts(); got != want {
+		t.Errorf("reactions:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Only who reacted can take it back.
+	deliver(t, s, carol, inboxIRI, undoing(carol, bobThumbs))
+	if got := counts(); got != want {
+		t.Errorf("reactions after someone else undid one:\n%s\nwant:\n%s", got, want)
+	}
+
+	deliver(t, s, bob, inboxIRI, undoing(bob, bobThumbs))
+	deliver(t, s, carol, inboxIRI, undoing(carol, carolThumbs))
+	want = "🎉 x1 [https://other.test/users/carol]\n"
+	if got := counts(); got != want {
+		t.Errorf("reactions after undoing:\n%s\nwant:\n%s", got, want)
+	}
+
+	if _, err := s.EmojiReactions(c, mustParse(t, "https://mastogon.test/notes/missing")); err != ErrNotFound {
+		t.Errorf("reactions to a missing note: %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"time"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// RefreshObject re-fetches the remote object or actor at `iri` on behalf of
+// the local actor at `actorIRI` and updates our copy of it. It's meant for
+// when a user opens a remote profile, or we suspect we missed an Update.
+//
+// Objects fetched less than Config.MinRefreshInterval ago, and our own
+// objects, are returned as stored. Concurrent refreshes of the same object
+// share a single fetch.
+func (s *Service) RefreshObject(c context.Context,
+	actorIRI *url.URL,
+	iri *url.URL) (vocab.Type, error) {
+	if owns, err := s.db.Owns(c, iri); err != nil {
+		return nil, err
+	} else if owns {
+		return s.db.Get(c, iri)
+	}
+	if last, ok := s.refreshed.Load(iri.String()); ok &&
+		s.Now().Sub(last.(time.Time)) < s.config.MinRefreshInterval {
+		if t, err := s.db.Get(c, iri); err == nil {
+			return t, nil
+		}
+	}
+	v, err := s.refreshes.do(iri.String(), func() (interface{}, error) {
+		return s.refetch(c, actorIRI, iri)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(vocab.Type), nil
+}
+
+// refetch fetches `iri` and stores what we get back.
+func (s *Service) refetch(c context.Context,
+	actorIRI *url.URL,
+	iri *url.URL) (vocab.Type, error) {
+	tp, err := s.NewTransport(c, s.boxIRI(actorIRI, "outbox"), "")
+	if err != nil {
+		return nil, err
+	}
+	b, err := tp.Dereference(c, iri)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	t, err := streams.ToType(c, m)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.Lock(c, iri); err != nil {
+		return nil, err
+	}
+	defer s.db.Unlock(c, iri)
+	if exists, err := s.db.Exists(c, iri); err != nil {
+		return nil, err
+	} else if exists {
+		err = s.db.Update(c, t)
+	} else {
+		err = s.db.Create(c, t)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.refreshed.Store(iri.String(), s.Now())
+	return t, nil
+}
@@ -0,0 +1,105 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-fed/activity/streams"
+)
+
+// contentOf returns the content of the note stored at `iri`.
+func contentOf(t *testing.T, s *Service, iri string) string {
+	t.Helper()
+	stored, err := s.db.Get(context.Background(), mustParse(t, iri))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := streams.Serialize(stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ := m["content"].(string)
+	return content
+}
+
+func TestRefreshObject(t *testing.T) {
+	c := context.Background()
+	s, fake := newTestService(t)
+	transport := &countingTransport{FakeTransport: fake}
+	s.SetTransport(transport)
+	clock := &testClock{now: time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)}
+	s.SetClock(clock)
+	s.config.MinRefreshInterval = time.Minute
+	aliceIRI := register(t, s, "alice")
+	const noteIRI = "https://remote.test/notes/1"
+	note := postBy("Note", noteIRI, "https://remote.test/users/bob", aliceIRI.String())
+	note["@context"] = "https://www.w3.org/ns/activitystreams"
+	respondJSON(t, fake, noteIRI, note)
+
+	if _, err := s.RefreshObject(c, aliceIRI, mustParse(t, noteIRI)); err != nil {
+		t.Fatal(err)
+	}
+	if got := contentOf(t, s, noteIRI); got != "<p>hello</p>" {
+		t.Errorf("stored %q", got)
+	}
+
+	// Refreshed again too soon, it's left as stored...
+	note["content"] = "<p>edited</p>"
+	respondJSON(t, fake, noteIRI, note)
+	if _, err := s.RefreshObject(c, aliceIRI, mustParse(t, noteIRI)); err != nil {
+		t.Fatal(err)
+	}
+	if n := transport.fetched(mustParse(t, noteIRI)); n != 1 || contentOf(t, s, noteIRI) != "<p>hello</p>" {
+		t.Errorf("fetched %d times within the interval", n)
+	}
+	// ...but not once the interval is up.
+	clock.Advance(time.Minute)
+	if _, err := s.RefreshObject(c, aliceIRI, mustParse(t, noteIRI)); err != nil {
+		t.Fatal(err)
+	}
+	if got := contentOf(t, s, noteIRI); got != "<p>edited</p>" {
+		t.Errorf("stored %q after the interval, want the edit", got)
+	}
+
+	// Our own objects are never fetched.
+	if _, err := s.RefreshObject(c, aliceIRI, aliceIRI); err != nil {
+		t.Fatal(err)
+	}
+	if n := transport.fetched(aliceIRI); n != 0 {
+		t.Errorf("fetched our own actor %d times", n)
+	}
+}
+
+func TestRefreshObjectFetchesCoalesce(t *testing.T) {
+	c := context.Background()
+	s, fake := newTestService(t)
+	transport := &countingTransport{FakeTransport: fake, hold: make(chan struct{})}
+	s.SetTransport(transport)
+	aliceIRI := register(t, s, "alice")
+	const noteIRI = "https://remote.test/notes/1"
+	note := postBy("Note", noteIRI, "https://remote.test/users/bob", aliceIRI.String())
+	note["@context"] = "https://www.w3.org/ns/activitystreams"
+	respondJSON(t, fake, noteIRI, note)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.RefreshObject(c, aliceIRI, mustParse(t, noteIRI)); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(transport.hold)
+	wg.Wait()
+	if n := transport.fetched(mustParse(t, noteIRI)); n != 1 {
+		t.Errorf("fetched %d times, want once", n)
+	}
+}
@@ -0,0 +1,109 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/go-fed/activity/pub"
+)
+
+// The longest private note a local user may keep about an account.
+const MaxAccountNoteChars = 2000
+
+// SetAccountNote stores a private note the local actor at `actorIRI` keeps
+// about `targetIRI`. Notes never leave the instance. An empty note clears it.
+func (s *Service) SetAccountNote(c context.Context, actorIRI, targetIRI *url.URL, note string) error {
+	note = strings.TrimSpace(note)
+	if graphemeCount(note) > MaxAccountNoteChars {
+		return &ValidationError{fmt.Sprintf("Comment is too long (maximum is %d characters)", MaxAccountNoteChars)}
+	}
+	s.db.SetNote(actorIRI, targetIRI, note)
+	return nil
+}
+
+// Relationship is how a local actor stands with another account.
+type Relationship struct {
+	Following  bool
+	FollowedBy bool
+	Blocking   bool
+	// Only known for local accounts: peers don't tell us.
+	BlockedBy bool
+	Muting    bool
+	// Whether a follow request to the account awaits an answer.
+	Requested bool
+	// The local actor's private note about the account.
+	Note string
+}
+
+// Relationship works out how the local actor at `actorIRI` stands with
+// `targetIRI`.
+func (s *Service) Relationship(c context.Context, actorIRI, targetIRI *url.URL) (Relationship, error) {
+	following, err := s.IsFollowing(c, actorIRI, targetIRI)
+	if err != nil {
+		return Relationship{}, err
+	}
+	followedBy, err := s.isFollowedBy(c, actorIRI, targetIRI)
+	if err != nil {
+		return Relationship{}, err
+	}
+	rel := Relationship{
+		Following:  following,
+		FollowedBy: followedBy,
+		Blocking:   s.db.IsBlocking(actorIRI, targetIRI),
+		BlockedBy:  s.db.IsBlocking(targetIRI, actorIRI),
+		Muting:     s.db.IsMuting(actorIRI, targetIRI),
+		Note:       s.db.Note(actorIRI, targetIRI),
+	}
+	if !following {
+		if rel.Requested, err = s.hasSentFollow(c, actorIRI, targetIRI); err != nil {
+			return Relationship{}, err
+		}
+	}
+	return rel, nil
+}
+
+// isFollowedBy reports whether `targetIRI` is in the followers collection of
+// the local actor at `actorIRI`.
+func (s *Service) isFollowedBy(c context.Context, actorIRI, targetIRI *url.URL) (bool, error) {
+	followers, err := s.db.Followers(c, actorIRI)
+	if err != nil {
+		return false, err
+	}
+	items := followers.GetActivityStreamsItems()
+	if items == nil {
+		return false, nil
+	}
+	for iter := items.Begin(); iter != items.End(); iter = iter.Next() {
+		if id, err := pub.ToId(iter); err == nil && id.String() == targetIRI.String() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// hasSentFollow reports whether the outbox of the local actor at `actorIRI`
+// holds a Follow of `targetIRI`. Unless they are following, it's a request
+// still waiting on an answer.
+func (s *Service) hasSentFollow(c context.Context, actorIRI, targetIRI *url.URL) (bool, error) {
+	items, _, err := s.collectionItems(c, s.boxIRI(actorIRI, "outbox"))
+	if err != nil {
+		return false, err
+	}
+	for _, item := range items {
+		t, err := s.db.Get(c, item)
+		if err != nil || t.GetTypeName() != "Follow" {
+			continue
+		}
+		for _, object := range objectsOf(t) {
+			if object.String() == targetIRI.String() {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,57 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRelationship(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	bobIRI := register(t, s, "bob")
+	respondLocally(t, s, transport, aliceIRI, bobIRI)
+	carol := newTestPeer(t, transport, "https://remote.test/users/carol", "rsa")
+	dave := newTestPeer(t, transport, "https://remote.test/users/dave", "rsa")
+
+	following(t, s, aliceIRI, bobIRI)
+	follow(t, s, aliceIRI, carol.iri)
+	s.db.SetBlocking(bobIRI, aliceIRI, true)
+	s.db.SetBlocking(aliceIRI, carol.iri, true)
+	s.db.SetMuting(aliceIRI, carol.iri, true)
+	// A Follow dave hasn't answered is a request.
+	if err := s.Follow(c, aliceIRI, dave.iri); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetAccountNote(c, aliceIRI, dave.iri, "slow to answer"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		actor, target string
+		want          Relationship
+	}{
+		{aliceIRI.String(), bobIRI.String(), Relationship{Following: true, BlockedBy: true}},
+		{bobIRI.String(), aliceIRI.String(), Relationship{Blocking: true}},
+		{aliceIRI.String(), carol.iri.String(), Relationship{FollowedBy: true, Blocking: true, Muting: true}},
+		{aliceIRI.String(), dave.iri.String(), Relationship{Requested: true, Note: "slow to answer"}},
+		{bobIRI.String(), dave.iri.String(), Relationship{}},
+	} {
+		got, err := s.Relationship(c, mustParse(t, test.actor), mustParse(t, test.target))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.want {
+			t.Errorf("%s with %s: %+v, want %+v", test.actor, test.target, got, test.want)
+		}
+	}
+
+	// Once accepted, the request is a follow.
+	following(t, s, aliceIRI, dave.iri)
+	if got, _ := s.Relationship(c, aliceIRI, dave.iri); !got.Following || got.Requested {
+		t.Errorf("accepted follow %+v", got)
+	}
+}
@@ -0,0 +1,60 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"errors"
+	"net/url"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// Go-Fed tells deliveries apart by the id of the activity, but some peers,
+// and relays, deliver the same post again wrapped in a Create of a new id.
+// Taken in, it would have the inbox list the post twice, so we stop it
+// there and tell the peer it went through: we have it already.
+
+// errReplayedCreate stops Go-Fed taking in a replayed Create.
+var errReplayedCreate = errors.New("replayed Create")
+
+// replayedCreate reports whether `activity`, delivered to our inbox at
+// `inboxIRI`, is a Create of objects we have and that the inbox already
+// holds a Create of, under another id. Only the Creates we store of those
+// objects are looked for in the inbox, not every Create it holds.
+func (s *Service) replayedCreate(c context.Context, inboxIRI *url.URL, activity pub.Activity) bool {
+	create, ok := activity.(vocab.ActivityStreamsCreate)
+	if !ok {
+		return false
+	}
+	objects := objectsOf(create)
+	if len(objects) == 0 {
+		return false
+	}
+	id, err := pub.GetId(create)
+	if err != nil {
+		return false
+	}
+	for _, o := range objects {
+		// New posts, by far the most delivered, are let through here.
+		if exists, err := s.db.Exists(c, o); err != nil || !exists {
+			return false
+		}
+		held := false
+		for _, createIRI := range s.db.CreatesOf(o) {
+			if createIRI.String() == id.String() {
+				// A redelivery, which Go-Fed sees to.
+				return false
+			}
+			if contains, err := s.db.InboxContains(c, inboxIRI, createIRI); err == nil && contains {
+				held = true
+			}
+		}
+		if !held {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,87 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/go-fed/activity/streams"
+)
+
+func TestReplayedCreate(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	s.config.MaxInlineItems = 0
+	aliceIRI := register(t, s, "alice")
+	inboxIRI := s.boxIRI(aliceIRI, "inbox")
+	bob := newTestPeer(t, transport, "https://remote.test/users/bob", "rsa")
+	following(t, s, aliceIRI, bob.iri)
+	note, err := s.PostStatus(c, aliceIRI, StatusParams{Status: "hello", Visibility: VisibilityPublic})
+	if err != nil {
+		t.Fatal(err)
+	}
+	replies := note.GetJSONLDId().Get().String() + "/replies"
+	reply := postBy("Note", "https://remote.test/notes/1", bob.iri.String(), aliceIRI.String())
+	reply["inReplyTo"] = note.GetJSONLDId().Get().String()
+	create := creating(reply)
+	inboxSize := func() int {
+		t.Helper()
+		items, _, err := s.collectionItems(c, inboxIRI)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(items)
+	}
+	before := inboxSize()
+	deliver(t, s, bob, inboxIRI, create)
+
+	// The same note, wrapped in a Create of a new id, as relays send it.
+	replayed := creating(reply)
+	replayed["id"] = "https://relay.test/activities/1"
+	deliver(t, s, bob, inboxIRI, replayed)
+
+	if got := inboxSize(); got != before+1 {
+		t.Errorf("inbox grew by %d, want 1", got-before)
+	}
+	if n := inboxCount(t, s, aliceIRI, replayed["id"].(string)); n != 0 {
+		t.Errorf("inbox holds the replayed Create %d times", n)
+	}
+	if root := getCollection(t, s, replies, http.StatusOK); root.TotalItems != 1 {
+		t.Errorf("%d replies, want 1", root.TotalItems)
+	}
+	home, err := s.HomeTimeline(c, aliceIRI, TimeRange{}, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := 0
+	for _, o := range home {
+		if o.GetJSONLDId().Get().String() == reply["id"] {
+			seen++
+		}
+	}
+	if seen != 1 {
+		t.Errorf("home timeline shows the note %d times, want once", seen)
+	}
+
+	// A Create of a note we have, but that the inbox holds no Create of,
+	// comes in.
+	other := postBy("Note", "https://remote.test/notes/2", bob.iri.String(), aliceIRI.String())
+	m := map[string]interface{}{"@context": "https://www.w3.org/ns/activitystreams"}
+	for k, v := range other {
+		m[k] = v
+	}
+	fetched, err := streams.ToType(c, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.storeFetched(c, fetched); err != nil {
+		t.Fatal(err)
+	}
+	deliver(t, s, bob, inboxIRI, creating(other))
+	if n := inboxCount(t, s, aliceIRI, creating(other)["id"].(string)); n != 1 {
+		t.Errorf("inbox holds the Create of a note we had %d times, want once", n)
+	}
+}
@@ -0,0 +1,87 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// Every local status has a `replies` collection, listing the public replies
+// to it we know of, so peers can find the rest of the conversation. It's
+// never stored: we work it out from the threads when asked.
+
+// repliesIRI is where the replies to the local status at `id` are served.
+func repliesIRI(id *url.URL) *url.URL {
+	u := *id
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/replies"
+	return &u
+}
+
+// withReplies gives the local status `t` its `replies` collection, if it
+// doesn't have one yet.
+func withReplies(t vocab.Type, id *url.URL) {
+	o, ok := t.(interface {
+		GetActivityStreamsReplies() vocab.ActivityStreamsRepliesProperty
+		SetActivityStreamsReplies(vocab.ActivityStreamsRepliesProperty)
+	})
+	if !ok || o.GetActivityStreamsReplies() != nil || !IsSupportedStatus(t) {
+		return
+	}
+	replies := streams.NewActivityStreamsRepliesProperty()
+	replies.SetIRI(repliesIRI(id))
+	o.SetActivityStreamsReplies(replies)
+}
+
+// repliesItems returns the public replies to the local status whose
+// `replies` collection is at `id`, newest first, and whether `id` is such a
+// collection at all. Replies to statuses that aren't public themselves
+// aren't shown.
+func (s *Service) repliesItems(c context.Context, id *url.URL) ([]*url.URL, bool) {
+	if !strings.HasSuffix(id.Path, "/replies") {
+		return nil, false
+	}
+	parentIRI := *id
+	parentIRI.Path = strings.TrimSuffix(id.Path, "/replies")
+	parentIRI.RawQuery = ""
+	if owns, err := s.db.Owns(c, &parentIRI); err != nil || !owns {
+		return nil, false
+	}
+	parent, err := s.db.Get(c, &parentIRI)
+	if err != nil || !IsSupportedStatus(parent) || !isPublic(parent) {
+		return nil, false
+	}
+	index, err := s.db.ReplyIndex(c)
+	if err != nil {
+		return nil, false
+	}
+	var replies []vocab.Type
+	for _, replyIRI := range index[parentIRI.String()] {
+		if reply, err := s.db.Get(c, replyIRI); err == nil && isPublic(reply) && !s.hidden(c, replyIRI) {
+			replies = append(replies, reply)
+		}
+	}
+	sort.SliceStable(replies, func(i, j int) bool {
+		return published(replies[i]).After(published(replies[j]))
+	})
+	items := make([]*url.URL, 0, len(replies))
+	for _, reply := range replies {
+		if replyIRI, err := pub.GetId(reply); err == nil {
+			items = append(items, replyIRI)
+		}
+	}
+	return items, true
+}
+
+// isPublic reports whether `t` is for everyone to see, listed or not.
+func isPublic(t vocab.Type) bool {
+	v := Visibility(t)
+	return v == VisibilityPublic || v == VisibilityUnlisted
+}
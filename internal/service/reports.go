@@ -0,0 +1,165 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/url"
+	"unicode/utf8"
+
+	"mastogon/internal/db"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+)
+
+// Users report accounts, and statuses of theirs, to our moderators. A report
+// against a peer's account can also be forwarded to the peer, as Mastodon
+// does: a Flag from our instance actor, so who reported stays between us and
+// them.
+
+// The longest comment a report may have, as on Mastodon.
+const maxReportComment = 1000
+
+// ReportParams is what a user reporting an account supplies.
+type ReportParams struct {
+	Target   *url.URL
+	Statuses []*url.URL
+	Comment  string
+	// Whether to forward the report to the target's instance too.
+	Forward bool
+}
+
+// Report files a report by the local actor at `reporterIRI`, forwarding it
+// if asked and the target is a peer's. Should forwarding fail, the report is
+// still filed, for a moderator to forward later.
+func (s *Service) Report(c context.Context, reporterIRI *url.URL, params ReportParams) (*db.Report, error) {
+	if t, err := s.db.Get(c, params.Target); err != nil {
+		return nil, ErrNotFound
+	} else if _, ok := db.ToActor(t); !ok {
+		return nil, ErrNotFound
+	}
+	if utf8.RuneCountInString(params.Comment) > maxReportComment {
+		return nil, &ValidationError{"Comment is too long (maximum is 1000 characters)"}
+	}
+	for _, statusIRI := range params.Statuses {
+		t, err := s.db.Get(c, statusIRI)
+		if err != nil || !containsIRI(authorsOf(t), params.Target) {
+			return nil, &ValidationError{"Statuses must be by the account reported"}
+		}
+	}
+	r := &db.Report{
+		Reporter:  reporterIRI,
+		Target:    params.Target,
+		Statuses:  params.Statuses,
+		Comment:   params.Comment,
+		CreatedAt: s.Now(),
+	}
+	s.db.CreateReport(r)
+	if params.Forward && !s.db.IsLocalHost(params.Target.Host) {
+		if err := s.ForwardReport(c, r.ID); err != nil {
+			log.Printf("forwarding report %s to %s: %s", r.ID, params.Target.Host, err)
+		}
+		r, _ = s.db.Report(r.ID)
+	}
+	return r, nil
+}
+
+// Reports returns all the reports filed, most recent first, for moderators.
+func (s *Service) Reports(c context.Context) []*db.Report {
+	return s.db.Reports()
+}
+
+// ForwardReport sends the report `id` to the instance of the account it's
+// against, as a Flag of the account and the statuses reported, unless it
+// was already.
+func (s *Service) ForwardReport(c context.Context, id string) error {
+	r, err := s.db.Report(id)
+	if err != nil {
+		return err
+	}
+	if s.db.IsLocalHost(r.Target.Host) {
+		return &ValidationError{"Only reports against remote accounts can be forwarded"}
+	}
+	if r.Forwarded != nil {
+		return nil
+	}
+	inboxIRI, err := s.reportInbox(c, r.Target)
+	if err != nil {
+		return err
+	}
+	instanceIRI, err := s.instanceActor(c)
+	if err != nil {
+		return err
+	}
+	flag := streams.NewActivityStreamsFlag()
+	actor := streams.NewActivityStreamsActorProperty()
+	actor.AppendIRI(instanceIRI)
+	flag.SetActivityStreamsActor(actor)
+	object := streams.NewActivityStreamsObjectProperty()
+	object.AppendIRI(r.Target)
+	for _, statusIRI := range r.Statuses {
+		object.AppendIRI(statusIRI)
+	}
+	flag.SetActivityStreamsObject(object)
+	if r.Comment != "" {
+		content := streams.NewActivityStreamsContentProperty()
+		content.AppendXMLSchemaString(r.Comment)
+		flag.SetActivityStreamsContent(content)
+	}
+	flagIRI, err := s.db.NewID(c, flag)
+	if err != nil {
+		return err
+	}
+	idProp := streams.NewJSONLDIdProperty()
+	idProp.Set(flagIRI)
+	flag.SetJSONLDId(idProp)
+	m, err := streams.Serialize(flag)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	// It isn't addressed to anyone, being for the peer's moderators rather
+	// than the account, so it goes straight to the inbox rather than
+	// through our outbox.
+	tp, err := s.NewTransport(c, nil, "")
+	if err != nil {
+		return err
+	}
+	if err := tp.Deliver(c, b, inboxIRI); err != nil {
+		return err
+	}
+	updated := *r
+	updated.Forwarded = flagIRI
+	s.db.UpdateReport(&updated)
+	return nil
+}
+
+// reportInbox returns where to deliver a report against the peer's actor at
+// `actorIRI`: their instance's shared inbox if we know of one, or else their
+// own inbox.
+func (s *Service) reportInbox(c context.Context, actorIRI *url.URL) (*url.URL, error) {
+	t, err := s.db.Get(c, actorIRI)
+	if err != nil {
+		return nil, err
+	}
+	actor, ok := db.ToActor(t)
+	if !ok || actor.GetActivityStreamsInbox() == nil {
+		return nil, errors.New("no inbox to report to")
+	}
+	inboxIRI, err := pub.ToId(actor.GetActivityStreamsInbox())
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := s.sharedInboxes.Load(inboxIRI.String()); ok {
+		return v.(*url.URL), nil
+	}
+	return inboxIRI, nil
+}
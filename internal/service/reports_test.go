@@ -0,0 +1,97 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReportForwarded(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	bobIRI := register(t, s, "bob")
+	carol := newTestPeer(t, transport, "https://remote.test/users/carol", "rsa")
+	doc := carol.actorDoc(carol.publicKeyDoc(t, carol.iri.String()))
+	doc["endpoints"] = map[string]interface{}{"sharedInbox": "https://remote.test/inbox"}
+	respondJSON(t, transport, carol.iri.String(), doc)
+	dave := newTestPeer(t, transport, "https://other.test/users/dave", "rsa")
+	note := postBy("Note", "https://remote.test/notes/1", carol.iri.String(), aliceIRI.String())
+	note["@context"] = "https://www.w3.org/ns/activitystreams"
+	respondJSON(t, transport, note["id"].(string), note)
+	for _, iri := range []string{carol.iri.String(), dave.iri.String(), note["id"].(string)} {
+		if _, err := s.RefreshObject(c, aliceIRI, mustParse(t, iri)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// flags returns the activities delivered by `report`, by inbox.
+	flags := func(report func() error) map[string]map[string]interface{} {
+		t.Helper()
+		before := len(transport.Delivered())
+		if err := report(); err != nil {
+			t.Fatal(err)
+		}
+		delivered := make(map[string]map[string]interface{})
+		for _, d := range transport.Delivered()[before:] {
+			if strings.Contains(string(d.Body), aliceIRI.String()) {
+				t.Errorf("report to %s says who reported it: %s", d.To, d.Body)
+			}
+			var m map[string]interface{}
+			if err := json.Unmarshal(d.Body, &m); err != nil {
+				t.Fatal(err)
+			}
+			delivered[d.To.String()] = m
+		}
+		return delivered
+	}
+	reporting := func(params ReportParams) func() error {
+		return func() error {
+			_, err := s.Report(c, aliceIRI, params)
+			return err
+		}
+	}
+
+	// A report against a peer's account goes to its instance, from ours.
+	got := flags(reporting(ReportParams{
+		Target:   carol.iri,
+		Statuses: []*url.URL{mustParse(t, note["id"].(string))},
+		Comment:  "spam",
+		Forward:  true,
+	}))
+	flag, ok := got["https://remote.test/inbox"]
+	if len(got) != 1 || !ok {
+		t.Fatalf("delivered %v, want a Flag to carol's shared inbox", got)
+	}
+	if flag["type"] != "Flag" || flag["actor"] != s.instanceActorIRI().String() || flag["content"] != "spam" {
+		t.Errorf("delivered %v, want a Flag from our instance actor", flag)
+	}
+	if want := []interface{}{carol.iri.String(), note["id"]}; !reflect.DeepEqual(flag["object"], want) {
+		t.Errorf("flagged %v, want %v", flag["object"], want)
+	}
+	reports := s.Reports(c)
+	if len(reports) != 1 || reports[0].Forwarded == nil || reports[0].Forwarded.String() != flag["id"] {
+		t.Fatalf("reports %+v, want one forwarded as %v", reports, flag["id"])
+	}
+	// Forwarding it again sends nothing.
+	if got := flags(func() error { return s.ForwardReport(c, reports[0].ID) }); len(got) != 0 {
+		t.Errorf("forwarded again to %v", got)
+	}
+
+	// Without a shared inbox, it goes to the account's own.
+	if got := flags(reporting(ReportParams{Target: dave.iri, Forward: true})); len(got) != 1 || got[dave.iri.String()+"/inbox"] == nil {
+		t.Errorf("delivered %v, want a Flag to dave's inbox", got)
+	}
+	// Reports not to be forwarded, or against our own accounts, stay here.
+	if got := flags(reporting(ReportParams{Target: carol.iri})); len(got) != 0 {
+		t.Errorf("report not to forward delivered to %v", got)
+	}
+	if got := flags(reporting(ReportParams{Target: bobIRI, Forward: true})); len(got) != 0 {
+		t.Errorf("report against bob delivered to %v", got)
+	}
+}
@@ -0,0 +1,330 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Most of the fediverse signs requests the way draft-cavage-http-signatures
+// had it, which go-fed/httpsig implements. Newer software signs them the way
+// RFC 9421 ended up: a `Signature-Input` header saying what's covered and a
+// `Signature` header of another format. We verify both, and sign with
+// whichever the peer takes (see httpTransport).
+
+// The ways we can sign requests.
+const (
+	SignatureCavage  = "cavage"
+	SignatureRFC9421 = "rfc9421"
+)
+
+// The label we give our RFC 9421 signatures.
+const rfc9421Label = "sig1"
+
+// How far from our clock an RFC 9421 signature's creation time may be.
+const maxSignatureSkew = time.Hour
+
+// rfc9421Signature is a signature parsed from `Signature-Input` and
+// `Signature`.
+type rfc9421Signature struct {
+	// The covered components, in order, such as "@method" or "date".
+	components []string
+	// The parameters, raw, such as `keyid` or `created`.
+	params map[string]string
+	// The serialization of the components and parameters, exactly as they
+	// appeared in `Signature-Input`.
+	rawParams string
+	sig       []byte
+}
+
+// isRFC9421 reports whether `r` is signed the RFC 9421 way.
+func isRFC9421(r *http.Request) bool {
+	return r.Header.Get("Signature-Input") != ""
+}
+
+// parseRFC9421 reads the first signature on `r`, skipping inputs that no
+// signature goes with.
+func parseRFC9421(r *http.Request) (*rfc9421Signature, error) {
+	inputs := splitDictionary(r.Header.Get("Signature-Input"))
+	sigs := splitDictionary(r.Header.Get("Signature"))
+	if len(inputs) == 0 {
+		return nil, errors.New("no Signature-Input")
+	}
+	for _, input := range inputs {
+		label, value, ok := strings.Cut(input, "=")
+		if !ok {
+			continue
+		}
+		var sigValue string
+		for _, s := range sigs {
+			if l, v, ok := strings.Cut(s, "="); ok && l == label {
+				sigValue = v
+			}
+		}
+		if !strings.HasPrefix(sigValue, ":") || !strings.HasSuffix(sigValue, ":") || len(sigValue) < 2 {
+			continue
+		}
+		sig, err := base64.StdEncoding.DecodeString(sigValue[1 : len(sigValue)-1])
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(value, "(") {
+			return nil, errors.New("malformed Signature-Input")
+		}
+		end := strings.Index(value, ")")
+		if end < 0 {
+			return nil, errors.New("malformed Signature-Input")
+		}
+		s := &rfc9421Signature{params: make(map[string]string), rawParams: value, sig: sig}
+		for _, c := range strings.Fields(value[1:end]) {
+			s.components = append(s.components, strings.Trim(c, `"`))
+		}
+		for _, p := range strings.Split(value[end+1:], ";") {
+			if k, v, ok := strings.Cut(p, "="); ok {
+				s.params[strings.TrimSpace(k)] = strings.Trim(strings.TrimSpace(v), `"`)
+			}
+		}
+		return s, nil
+	}
+	return nil, errors.New("no signature goes with any Signature-Input")
+}
+
+// splitDictionary splits a structured field dictionary into its members,
+// minding commas within quotes and parentheses.
+func splitDictionary(header string) (members []string) {
+	var b strings.Builder
+	depth, quoted := 0, false
+	for _, r := range header {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == '(' && !quoted:
+			depth++
+		case r == ')' && !quoted:
+			depth--
+		case r == ',' && !quoted && depth == 0:
+			members = append(members, strings.TrimSpace(b.String()))
+			b.Reset()
+			continue
+		}
+		b.WriteRune(r)
+	}
+	if m := strings.TrimSpace(b.String()); m != "" {
+		members = append(members, m)
+	}
+	return
+}
+
+// signatureBase builds what an RFC 9421 signature over `components` of `r`
+// signs, ending with the signature's own parameters, `rawParams`.
+func signatureBase(r *http.Request, components []string, rawParams string) (string, error) {
+	// Requests we make have only their URL saying where they're going.
+	host := r.Host
+	if host == "" {
+		host = r.URL.Host
+	}
+	var b strings.Builder
+	for _, c := range components {
+		var value string
+		switch c {
+		case "@method":
+			value = r.Method
+		case "@target-uri":
+			value = "https://" + host + r.URL.RequestURI()
+		case "@authority":
+			value = strings.ToLower(host)
+		case "@scheme":
+			value = "https"
+		case "@request-target":
+			value = r.URL.RequestURI()
+		case "@path":
+			value = r.URL.EscapedPath()
+		case "@query":
+			value = "?" + r.URL.RawQuery
+		default:
+			if strings.HasPrefix(c, "@") {
+				return "", fmt.Errorf("unsupported component %s", c)
+			}
+			// Values returns the header's own slice.
+			values := append([]string(nil), r.Header.Values(c)...)
+			if len(values) == 0 {
+				return "", fmt.Errorf("covered header %s is missing", c)
+			}
+			for i := range values {
+				values[i] = strings.TrimSpace(values[i])
+			}
+			value = strings.Join(values, ", ")
+		}
+		fmt.Fprintf(&b, "%q: %s\n", c, value)
+	}
+	fmt.Fprintf(&b, "%q: %s", "@signature-params", rawParams)
+	return b.String(), nil
+}
+
+// verifyRFC9421 checks the RFC 9421 signature `sig` on `r`, whose body is
+// `body`, against `key`.
+func (s *Service) verifyRFC9421(r *http.Request, body []byte, sig *rfc9421Signature, key crypto.PublicKey) error {
+	covered := make(map[string]bool)
+	for _, c := range sig.components {
+		covered[c] = true
+	}
+	// The path alone leaves who the request was for, and its query, to be
+	// changed.
+	target := covered["@target-uri"] || covered["@request-target"] ||
+		(covered["@path"] && covered["@authority"] && (r.URL.RawQuery == "" || covered["@query"]))
+	if !covered["@method"] || !target {
+		return errors.New("signature doesn't cover the method and target")
+	}
+	if len(body) > 0 {
+		if !covered["content-digest"] {
+			return errors.New("signature doesn't cover the body")
+		}
+		if err := checkContentDigest(r.Header.Get("Content-Digest"), body); err != nil {
+			return err
+		}
+	}
+	if created, err := strconv.ParseInt(sig.params["created"], 10, 64); err == nil {
+		if skew := s.Now().Sub(time.Unix(created, 0)); skew > maxSignatureSkew || skew < -maxSignatureSkew {
+			return errors.New("signature is too old or too new")
+		}
+	} else {
+		return errors.New("signature has no creation time")
+	}
+	if expires, err := strconv.ParseInt(sig.params["expires"], 10, 64); err == nil && s.Now().After(time.Unix(expires, 0)) {
+		return errors.New("signature has expired")
+	}
+	base, err := signatureBase(r, sig.components, sig.rawParams)
+	if err != nil {
+		return err
+	}
+	alg := sig.params["alg"]
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		pkcs1 := func() error {
+			digest := sha256.Sum256([]byte(base))
+			return rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig.sig)
+		}
+		pss := func() error {
+			digest := sha512.Sum512([]byte(base))
+			return rsa.VerifyPSS(k, crypto.SHA512, digest[:], sig.sig, nil)
+		}
+		switch alg {
+		case "rsa-v1_5-sha256":
+			return pkcs1()
+		case "rsa-pss-sha512":
+			return pss()
+		case "":
+			// An RSA key is published the same whichever way it signs, so
+			// without `alg` either will do.
+			if err := pkcs1(); err == nil {
+				return nil
+			}
+			return pss()
+		}
+	case ed25519.PublicKey:
+		if alg == "" || alg == "ed25519" {
+			if !ed25519.Verify(k, []byte(base), sig.sig) {
+				return errors.New("invalid signature")
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("algorithm %q doesn't go with a %T", alg, key)
+}
+
+// checkContentDigest checks a `Content-Digest` header against `body`. Only
+// SHA-256 and SHA-512 digests count.
+func checkContentDigest(header string, body []byte) error {
+	for _, member := range splitDictionary(header) {
+		algo, value, _ := strings.Cut(member, "=")
+		var sum []byte
+		switch algo {
+		case "sha-256":
+			s := sha256.Sum256(body)
+			sum = s[:]
+		case "sha-512":
+			s := sha512.Sum512(body)
+			sum = s[:]
+		default:
+			continue
+		}
+		if value != ":"+base64.StdEncoding.EncodeToString(sum)+":" {
+			return errors.New("Content-Digest doesn't match the body")
+		}
+		return nil
+	}
+	return errors.New("no usable Content-Digest")
+}
+
+// signRFC9421 signs `r`, whose body is `body`, the RFC 9421 way with `key`,
+// known to peers as `keyId`.
+func signRFC9421(r *http.Request, body []byte, key crypto.PrivateKey, keyId string, now time.Time) error {
+	components := []string{"@method", "@target-uri"}
+	if body != nil {
+		sum := sha256.Sum256(body)
+		r.Header.Set("Content-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(sum[:])+":")
+		components = append(components, "content-digest")
+	}
+	var alg string
+	switch key.(type) {
+	case *rsa.PrivateKey:
+		alg = "rsa-v1_5-sha256"
+	case ed25519.PrivateKey:
+		alg = "ed25519"
+	default:
+		return fmt.Errorf("unsupported key type %T", key)
+	}
+	quoted := make([]string, len(components))
+	for i, c := range components {
+		quoted[i] = strconv.Quote(c)
+	}
+	rawParams := fmt.Sprintf("(%s);created=%d;keyid=%s;alg=%s",
+		strings.Join(quoted, " "), now.Unix(), strconv.Quote(keyId), strconv.Quote(alg))
+	base, err := signatureBase(r, components, rawParams)
+	if err != nil {
+		return err
+	}
+	var sig []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		digest := sha256.Sum256([]byte(base))
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(k, []byte(base))
+	}
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Signature-Input", rfc9421Label+"="+rawParams)
+	r.Header.Set("Signature", rfc9421Label+"=:"+base64.StdEncoding.EncodeToString(sig)+":")
+	return nil
+}
+
+// readBody reads the body of `r`, leaving it in place to be read again.
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
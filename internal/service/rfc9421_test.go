@@ -0,0 +1,212 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"bufio"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The requests under testdata/signatures are the examples of
+// draft-cavage-http-signatures, Appendix C, and of RFC 9421, Appendix B.2,
+// signed with the keys published alongside them.
+
+// readFixtureRequest reads the request in testdata/signatures/`file`, as it
+// would come in.
+func readFixtureRequest(t *testing.T, file string) *http.Request {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", "signatures", file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	r, err := http.ReadRequest(bufio.NewReader(f))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// readFixtureKey reads the public key in testdata/signatures/`file`.
+func readFixtureKey(t *testing.T, file string) *remoteKey {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join("testdata", "signatures", file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := parsePublicKeyPEM(string(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &remoteKey{key: key, owner: mustParse(t, "https://example.com/users/test")}
+}
+
+func TestVerifySignatureFixtures(t *testing.T) {
+	for _, test := range []struct {
+		file, keyId, keyFile string
+		// When it was signed.
+		signed time.Time
+		// Why it's refused, if it is.
+		refused string
+	}{
+		{"cavage-c1-default.http", "Test", "cavage-test-key.pem", time.Date(2014, 1, 5, 21, 31, 40, 0, time.UTC), "doesn't cover the body"},
+		{"cavage-c2-basic.http", "Test", "cavage-test-key.pem", time.Date(2014, 1, 5, 21, 31, 40, 0, time.UTC), "doesn't cover the body"},
+		{"cavage-c3-all-headers.http", "Test", "cavage-test-key.pem", time.Date(2014, 1, 5, 21, 31, 40, 0, time.UTC), ""},
+		{"rfc9421-b21-minimal.http", "test-key-rsa-pss", "test-key-rsa-pss.pem", time.Unix(1618884473, 0), "doesn't cover the method and target"},
+		{"rfc9421-b23-full.http", "test-key-rsa-pss", "test-key-rsa-pss.pem", time.Unix(1618884473, 0), ""},
+		{"rfc9421-b26-ed25519.http", "test-key-ed25519", "test-key-ed25519.pem", time.Unix(1618884473, 0), "doesn't cover the method and target"},
+	} {
+		t.Run(strings.TrimSuffix(test.file, ".http"), func(t *testing.T) {
+			s, _ := newTestService(t)
+			s.config.EnforceSignatureDate = true
+			s.SetClock(&testClock{now: test.signed.Add(time.Minute)})
+			rk := readFixtureKey(t, test.keyFile)
+			s.keys.Store(test.keyId, rk)
+
+			owner, err := s.verifyRequest(context.Background(), mustParse(t, "https://"+testHostname+"/users/alice/inbox"), readFixtureRequest(t, test.file))
+			switch {
+			case test.refused == "" && err != nil:
+				t.Fatalf("refused: %s", err)
+			case test.refused == "" && owner.String() != rk.owner.String():
+				t.Errorf("signed by %s, want %s", owner, rk.owner)
+			case test.refused != "" && (err == nil || !strings.Contains(err.Error(), test.refused)):
+				t.Errorf("error %v, want one saying it %s", err, test.refused)
+			}
+
+			// The same, long after it was signed.
+			if test.refused == "" {
+				s.SetClock(&testClock{now: test.signed.Add(2 * maxSignatureSkew)})
+				if _, err := s.verifyRequest(context.Background(), mustParse(t, "https://"+testHostname+"/users/alice/inbox"), readFixtureRequest(t, test.file)); err == nil {
+					t.Error("took a stale signature")
+				}
+			}
+		})
+	}
+}
+
+// What's refused above for not covering the query is still signed as the
+// RFC has it: the signature base we build is what it signed.
+func TestRFC9421SignatureBaseFixture(t *testing.T) {
+	r := readFixtureRequest(t, "rfc9421-b26-ed25519.http")
+	sig, err := parseRFC9421(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, err := signatureBase(r, sig.components, sig.rawParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `"date": Tue, 20 Apr 2021 02:07:55 GMT
+"@method": POST
+"@path": /foo
+"@authority": example.com
+"content-type": application/json
+"content-length": 18
+"@signature-params": ("date" "@method" "@path" "@authority" "content-type" "content-length");created=1618884473;keyid="test-key-ed25519"`
+	if base != want {
+		t.Errorf("signature base\n%s\nwant\n%s", base, want)
+	}
+	if !ed25519.Verify(readFixtureKey(t, "test-key-ed25519.pem").key.(ed25519.PublicKey), []byte(base), sig.sig) {
+		t.Error("the RFC's signature doesn't verify")
+	}
+}
+
+// signRFC9421Covering signs `r` with `key` the RFC 9421 way, covering
+// `components`, under the label `label`.
+func signRFC9421Covering(t *testing.T, r *http.Request, key ed25519.PrivateKey, label string, components ...string) {
+	t.Helper()
+	quoted := make([]string, len(components))
+	for i, c := range components {
+		quoted[i] = strconv.Quote(c)
+	}
+	rawParams := fmt.Sprintf(`(%s);created=%d;keyid="test-key-ed25519"`, strings.Join(quoted, " "), time.Now().Unix())
+	base, err := signatureBase(r, components, rawParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Signature-Input", label+"="+rawParams)
+	r.Header.Set("Signature", label+"=:"+base64.StdEncoding.EncodeToString(ed25519.Sign(key, []byte(base)))+":")
+}
+
+func TestVerifyRFC9421Target(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		target     string
+		components []string
+		taken      bool
+	}{
+		{"/users/alice", []string{"@method", "@target-uri"}, true},
+		{"/users/alice?page=2", []string{"@method", "@request-target"}, true},
+		{"/users/alice", []string{"@method", "@path", "@authority"}, true},
+		{"/users/alice?page=2", []string{"@method", "@path", "@query", "@authority"}, true},
+		{"/users/alice", []string{"@method", "@path"}, false},
+		{"/users/alice?page=2", []string{"@method", "@path", "@authority"}, false},
+		{"/users/alice", []string{"@target-uri"}, false},
+	} {
+		s, _ := newTestService(t)
+		r := httptest.NewRequest(http.MethodGet, "https://"+testHostname+test.target, nil)
+		signRFC9421Covering(t, r, private, "sig1", test.components...)
+		sig, err := parseRFC9421(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = s.verifyRFC9421(r, nil, sig, public)
+		if taken := err == nil; taken != test.taken {
+			t.Errorf("GET %s covering %q: %v, want taken %v", test.target, test.components, err, test.taken)
+		}
+	}
+}
+
+func TestParseRFC9421SkipsUnsignedInputs(t *testing.T) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodGet, "https://"+testHostname+"/users/alice", nil)
+	signRFC9421Covering(t, r, private, "sig2", "@method", "@target-uri")
+	r.Header.Set("Signature-Input", `sig1=("@method");created=1;keyid="other", `+r.Header.Get("Signature-Input"))
+	sig, err := parseRFC9421(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(sig.components, " "); got != "@method @target-uri" {
+		t.Errorf("read the signature covering %s, want sig2's", got)
+	}
+
+	r.Header.Set("Signature", "sig3=:AAAA:")
+	if _, err := parseRFC9421(r); err == nil {
+		t.Error("read a signature with no input for it")
+	}
+}
+
+func TestSignatureBaseLeavesHeaders(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "https://"+testHostname+"/users/alice", nil)
+	r.Header.Add("X-Padded", "  a  ")
+	r.Header.Add("X-Padded", " b")
+	base, err := signatureBase(r, []string{"x-padded"}, "()")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(base, `"x-padded": a, b`+"\n") {
+		t.Errorf("signature base %q", base)
+	}
+	if got := r.Header.Values("X-Padded"); len(got) != 2 || got[0] != "  a  " || got[1] != " b" {
+		t.Errorf("headers left as %q", got)
+	}
+}
@@ -0,0 +1,55 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"mastogon/internal/db"
+
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// Discoverable reports whether the actor `t` opted in to being found: listed
+// in directories and search results, and indexed by search engines. Actors
+// saying nothing haven't, as with Mastodon.
+func Discoverable(t vocab.Type) bool {
+	actor, ok := db.ToActor(t)
+	if !ok {
+		return false
+	}
+	d := actor.GetTootDiscoverable()
+	return d != nil && d.IsXMLSchemaBoolean() && d.Get()
+}
+
+// serveRobots serves Config.RobotsTxt, if there is one.
+func (s *Service) serveRobots(w http.ResponseWriter, r *http.Request) {
+	if s.config.RobotsTxt == "" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(s.config.RobotsTxt))
+}
+
+// setRobotsTag asks search engines not to index the local actor at `id`, or
+// what it has posted, unless it's discoverable.
+func (s *Service) setRobotsTag(c context.Context, w http.ResponseWriter, id *url.URL) {
+	ownerIRI := s.localOwner(c, id)
+	if ownerIRI == nil {
+		ownerIRI = id
+	}
+	if owns, err := s.db.Owns(c, ownerIRI); err != nil || !owns {
+		return
+	}
+	t, err := s.db.Get(c, ownerIRI)
+	if err != nil {
+		return
+	}
+	if _, ok := db.ToActor(t); ok && !Discoverable(t) {
+		w.Header().Set("X-Robots-Tag", "noindex")
+	}
+}
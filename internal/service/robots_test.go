@@ -0,0 +1,69 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRobotsTxt(t *testing.T) {
+	s, _ := newTestService(t)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/robots.txt", nil))
+	if w.Code != http.StatusOK || w.Body.String() != s.config.RobotsTxt {
+		t.Errorf("robots.txt: %d %q, want %q", w.Code, w.Body, s.config.RobotsTxt)
+	}
+	if got := w.Header().Get("Content-Type"); got != "text/plain; charset=utf-8" {
+		t.Errorf("robots.txt served as %s", got)
+	}
+
+	s.config.RobotsTxt = ""
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/robots.txt", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("robots.txt with none configured: %d", w.Code)
+	}
+}
+
+func TestRobotsTag(t *testing.T) {
+	c := context.Background()
+	s, _ := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	bobIRI := register(t, s, "bob")
+	discoverable := true
+	if err := s.UpdateCredentials(c, bobIRI, CredentialsParams{Discoverable: &discoverable}); err != nil {
+		t.Fatal(err)
+	}
+	var notes []string
+	for _, actorIRI := range []string{aliceIRI.String(), bobIRI.String()} {
+		note, err := s.PostStatus(c, mustParse(t, actorIRI), StatusParams{Status: "hello", Visibility: VisibilityPublic})
+		if err != nil {
+			t.Fatal(err)
+		}
+		notes = append(notes, note.GetJSONLDId().Get().String())
+	}
+
+	// Actors are only indexed, along with what they post, once they opt in.
+	for _, test := range []struct {
+		iri  string
+		want string
+	}{
+		{aliceIRI.String(), "noindex"},
+		{notes[0], "noindex"},
+		{bobIRI.String(), ""},
+		{notes[1], ""},
+	} {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, signedFetch(t, nil, test.iri))
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: %d %s", test.iri, w.Code, w.Body)
+		}
+		if got := w.Header().Get("X-Robots-Tag"); got != test.want {
+			t.Errorf("GET %s: X-Robots-Tag %q, want %q", test.iri, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// The elements we keep in peers' HTML, and the attributes we keep on each.
+// It's Mastodon's list: enough for paragraphs, links, mentions, hashtags and
+// the odd bit of emphasis, and nothing that runs or fetches anything.
+var allowedElements = map[string]map[string]bool{
+	"p":          nil,
+	"br":         nil,
+	"span":       {"class": true},
+	"a":          {"href": true, "class": true},
+	"del":        nil,
+	"pre":        nil,
+	"code":       nil,
+	"em":         nil,
+	"strong":     nil,
+	"b":          nil,
+	"i":          nil,
+	"u":          nil,
+	"ul":         nil,
+	"ol":         {"start": true, "reversed": true},
+	"li":         {"value": true},
+	"blockquote": nil,
+}
+
+// Elements dropped with everything in them, rather than just their tags.
+var droppedElements = map[string]bool{"script": true, "style": true, "template": true}
+
+// Elements that have no content, and so no closing tag.
+var voidElements = map[string]bool{"br": true}
+
+// The link schemes we keep, as Mastodon does.
+var allowedSchemes = map[string]bool{
+	"http": true, "https": true, "mailto": true, "xmpp": true,
+	"gemini": true, "gopher": true, "magnet": true,
+}
+
+// The classes microformats and Mastodon's own markup use, which clients
+// style mentions, hashtags and shortened links by.
+var allowedClass = regexp.MustCompile(`^(?:(?:h|p|u|dt|e)-[\w-]+|mention|hashtag|ellipsis|invisible)$`)
+
+var (
+	// A comment, or a start or end tag and its attributes.
+	markupPattern = regexp.MustCompile(`<!--[\s\S]*?(?:-->|$)|<(/?)([a-zA-Z][a-zA-Z0-9]*)((?:\s+[^\s=/>]+(?:\s*=\s*(?:"[^"]*"|'[^']*'|[^\s>]*))?)*)\s*/?>`)
+	// An attribute, with or without a value.
+	attributePattern = regexp.MustCompile(`([^\s=/>]+)(?:\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]*)))?`)
+)
+
+// SanitizeHTML returns the HTML `s`, as a peer sent it, cut down to markup
+// that's safe to hand to clients: the elements and attributes above, links
+// only to the schemes above, and every tag closed. Text, and anything that
+// only looks like markup, comes out escaped.
+func SanitizeHTML(s string) string {
+	var b strings.Builder
+	var open []string
+	// The element we're skipping the content of, if any.
+	skipping := ""
+	text := func(t string) {
+		if skipping == "" {
+			b.WriteString(html.EscapeString(html.UnescapeString(t)))
+		}
+	}
+	last := 0
+	for _, m := range markupPattern.FindAllStringSubmatchIndex(s, -1) {
+		text(s[last:m[0]])
+		last = m[1]
+		if m[4] < 0 {
+			// A comment.
+			continue
+		}
+		closing := m[3] > m[2]
+		name := strings.ToLower(s[m[4]:m[5]])
+		switch {
+		case skipping != "":
+			if closing && name == skipping {
+				skipping = ""
+			}
+		case droppedElements[name]:
+			if !closing {
+				skipping = name
+			}
+		case !closing:
+			attributes, ok := allowedElements[name]
+			if !ok {
+				continue
+			}
+			b.WriteString("<" + name)
+			b.WriteString(sanitizedAttributes(name, attributes, s[m[6]:m[7]]))
+			b.WriteString(">")
+			if !voidElements[name] {
+				open = append(open, name)
+			}
+		default:
+			// Close whatever was left open inside the element, and
+			// drop closing tags of elements that aren't open.
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i] != name {
+					continue
+				}
+				for j := len(open) - 1; j >= i; j-- {
+					b.WriteString("</" + open[j] + ">")
+				}
+				open = open[:i]
+				break
+			}
+		}
+	}
+	text(s[last:])
+	for i := len(open) - 1; i >= 0; i-- {
+		b.WriteString("</" + open[i] + ">")
+	}
+	return b.String()
+}
+
+// sanitizedAttributes returns those of the `attributes` of an element
+// `name` that we keep, written out again.
+func sanitizedAttributes(name string, allowed map[string]bool, attributes string) string {
+	var b strings.Builder
+	seen := make(map[string]bool)
+	linked := false
+	for _, m := range attributePattern.FindAllStringSubmatch(attributes, -1) {
+		key := strings.ToLower(m[1])
+		if !allowed[key] || seen[key] {
+			continue
+		}
+		seen[key] = true
+		value := html.UnescapeString(m[2] + m[3] + m[4])
+		switch key {
+		case "href":
+			u, err := url.Parse(strings.TrimSpace(value))
+			if err != nil || !allowedSchemes[strings.ToLower(u.Scheme)] {
+				continue
+			}
+			value = u.String()
+		case "class":
+			var classes []string
+			for _, class := range strings.Fields(value) {
+				if allowedClass.MatchString(class) {
+					classes = append(classes, class)
+				}
+			}
+			if len(classes) == 0 {
+				continue
+			}
+			value = strings.Join(classes, " ")
+		}
+		b.WriteString(" " + key + `="` + html.EscapeString(value) + `"`)
+		linked = linked || key == "href"
+	}
+	// Links to elsewhere open on their own, and pass nothing on to where
+	// they lead.
+	if name == "a" && linked {
+		b.WriteString(` rel="nofollow noopener noreferrer" target="_blank"`)
+	}
+	return b.String()
+}
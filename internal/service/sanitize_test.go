@@ -0,0 +1,40 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import "testing"
+
+func TestSanitizeHTML(t *testing.T) {
+	for _, test := range []struct {
+		name, html, want string
+	}{
+		{"plain paragraphs", "<p>hello</p><p>there<br>you</p>", "<p>hello</p><p>there<br>you</p>"},
+		{
+			"a mention",
+			`<p><span class="h-card"><a href="https://remote.test/@bob" class="u-url mention">@<span>bob</span></a></span> hi</p>`,
+			`<p><span class="h-card"><a href="https://remote.test/@bob" class="u-url mention" rel="nofollow noopener noreferrer" target="_blank">@<span>bob</span></a></span> hi</p>`,
+		},
+		{"a script", `<p>hi</p><script>alert("pwned")</script>`, "<p>hi</p>"},
+		{"a style", `<style>body { display: none }</style><p>hi</p>`, "<p>hi</p>"},
+		{"an image", `<p>look <img src="https://evil.test/track.gif"></p>`, "<p>look </p>"},
+		{"an iframe's content kept as text", `<iframe src="https://evil.test">hi</iframe>`, "hi"},
+		{"event handlers", `<p onclick="alert(1)" class="mention">hi</p>`, "<p>hi</p>"},
+		{"a javascript link", `<a href="javascript:alert(1)">hi</a>`, "<a>hi</a>"},
+		{"an entity-encoded javascript link", `<a href="&#106;avascript:alert(1)">hi</a>`, "<a>hi</a>"},
+		{"made-up classes", `<span class="invisible evil">https://</span>`, `<span class="invisible">https://</span>`},
+		{"unclosed tags", "<p><strong>hi", "<p><strong>hi</strong></p>"},
+		{"stray closing tags", "hi</p></strong>", "hi"},
+		{"misnested tags", "<p><em>hi</p>there</em>", "<p><em>hi</em></p>there"},
+		{"comments", "<p>hi<!-- <script>alert(1)</script> --></p>", "<p>hi</p>"},
+		{"what only looks like markup", "<p>1 < 2 & 3 > 2</p>", "<p>1 &lt; 2 &amp; 3 &gt; 2</p>"},
+		{"entities", "<p>&lt;script&gt; &amp;amp;</p>", "<p>&lt;script&gt; &amp;amp;</p>"},
+		{"quotes in attributes", `<a href='https://remote.test/"><script>'>hi</a>`, `<a href="https://remote.test/%22%3E%3Cscript%3E" rel="nofollow noopener noreferrer" target="_blank">hi</a>`},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := SanitizeHTML(test.html); got != test.want {
+				t.Errorf("SanitizeHTML(%q) =\n%q, want\n%q", test.html, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"sync"
+	"time"
+
+	"mastogon/internal/db"
+)
+
+// Like Mastodon, statuses can't be scheduled for sooner than this, which
+// would be barely any different from posting them.
+const minScheduleDelay = 5 * time.Minute
+
+// scheduler posts scheduled statuses when they fall due, waiting for the
+// next one with At.
+type scheduler struct {
+	mu      sync.Mutex
+	started bool
+	// Counts the waits, so that only the latest goes on to the next.
+	wait int
+	// Cancels the latest wait, until it's over.
+	cancel func()
+}
+
+// ScheduleStatus stores a status from the local actor at `actorIRI` to be
+// posted at `at`.
+func (s *Service) ScheduleStatus(c context.Context,
+	actorIRI *url.URL,
+	params StatusParams,
+	at time.Time) (*db.ScheduledStatus, error) {
+	if err := s.validateStatus(params); err != nil {
+		return nil, err
+	}
+	if at.Before(s.Now().Add(minScheduleDelay)) {
+		return nil, &ValidationError{"Scheduled time must be at least 5 minutes in the future"}
+	}
+	scheduled := &db.ScheduledStatus{
+		Owner:       actorIRI,
+		ScheduledAt: at,
+		Status:      params.Status,
+		Language:    params.Language,
+		Visibility:  params.Visibility,
+		Sensitive:   params.Sensitive,
+		Quote:       params.Quote,
+	}
+	s.db.CreateScheduledStatus(scheduled)
+	s.wakeScheduler()
+	return scheduled, nil
+}
+
+// ScheduledStatuses returns the statuses the local actor at `actorIRI` has
+// waiting to be posted, soonest first.
+func (s *Service) ScheduledStatuses(actorIRI *url.URL) []*db.ScheduledStatus {
+	return s.db.ScheduledStatuses(actorIRI)
+}
+
+// ScheduledStatus returns the status `id` the local actor at `actorIRI` has
+// waiting to be posted.
+func (s *Service) ScheduledStatus(actorIRI *url.URL, id string) (*db.ScheduledStatus, error) {
+	scheduled, err := s.db.ScheduledStatus(id)
+	if err != nil || scheduled.Owner.String() != actorIRI.String() {
+		return nil, ErrNotFound
+	}
+	return scheduled, nil
+}
+
+// CancelScheduledStatus drops the status `id` the local actor at `actorIRI`
+// has waiting to be posted.
+func (s *Service) CancelScheduledStatus(actorIRI *url.URL, id string) error {
+	if _, err := s.ScheduledStatus(actorIRI, id); err != nil {
+		return err
+	}
+	if !s.db.TakeScheduledStatus(id) {
+		// It just got posted.
+		return ErrNotFound
+	}
+	s.wakeScheduler()
+	return nil
+}
+
+// StartScheduler posts scheduled statuses as they fall due, including any
+// stored before it started, until Shutdown. Overdue ones go out straight
+// away.
+func (s *Service) StartScheduler() {
+	q := &s.scheduler
+	q.mu.Lock()
+	if q.started {
+		q.mu.Unlock()
+		return
+	}
+	q.started = true
+	q.mu.Unlock()
+	s.wakeScheduler()
+}
+
+// wakeScheduler gets the scheduler to look at the schedule again, now. A
+// wait still to end is called off, but statuses being posted are left to
+// finish.
+func (s *Service) wakeScheduler() {
+	q := &s.scheduler
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.started {
+		return
+	}
+	if q.cancel != nil {
+		q.cancel()
+	}
+	s.waitScheduler(s.Now())
+}
+
+// waitScheduler posts what's due at `t`, then waits for the next status to
+// fall due. The scheduler must be locked.
+func (s *Service) waitScheduler(t time.Time) {
+	q := &s.scheduler
+	q.wait++
+	wait := q.wait
+	q.cancel = s.At(t, func(c context.Context) {
+		q.mu.Lock()
+		if wait == q.wait {
+			// Too late to call off.
+			q.cancel = nil
+		}
+		q.mu.Unlock()
+		next := s.PostDueStatuses(c)
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		if wait == q.wait && !next.IsZero() && q.started {
+			s.waitScheduler(next)
+		}
+	})
+}
+
+// stopScheduler stops the scheduler StartScheduler started, if it did.
+func (s *Service) stopScheduler() {
+	q := &s.scheduler
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.started = false
+	if q.cancel != nil {
+		q.cancel()
+		q.cancel = nil
+	}
+}
+
+// PostDueStatuses posts every scheduled status that has fallen due, and
+// returns when the next one will, or the zero time if none are left.
+func (s *Service) PostDueStatuses(c context.Context) (next time.Time) {
+	now := s.Now()
+	for _, scheduled := range s.db.ScheduledStatuses(nil) {
+		if scheduled.ScheduledAt.After(now) {
+			return scheduled.ScheduledAt
+		}
+		if !s.db.TakeScheduledStatus(scheduled.ID) {
+			// Cancelled meanwhile.
+			continue
+		}
+		if _, err := s.PostStatus(c, scheduled.Owner, StatusParams{
+			Status:     scheduled.Status,
+			Language:   scheduled.Language,
+			Visibility: scheduled.Visibility,
+			Sensitive:  scheduled.Sensitive,
+			Quote:      scheduled.Quote,
+		}); err != nil {
+			log.Printf("posting scheduled status %s: %s", scheduled.ID, err)
+		}
+	}
+	return
+}
@@ -0,0 +1,114 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestScheduledStatusKeepsParams(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	clock := &testClock{now: time.Now()}
+	s.SetClock(clock)
+	aliceIRI := register(t, s, "alice")
+	respondLocally(t, s, transport, s.boxIRI(aliceIRI, "followers"))
+	quoted, err := s.PostStatus(c, aliceIRI, StatusParams{Status: "quote me", Visibility: VisibilityPublic})
+	if err != nil {
+		t.Fatal(err)
+	}
+	quotedIRI := quoted.GetJSONLDId().Get()
+
+	sensitive := true
+	scheduled, err := s.ScheduleStatus(c, aliceIRI, StatusParams{
+		Status:     "later",
+		Language:   "fr",
+		Visibility: VisibilityUnlisted,
+		Sensitive:  &sensitive,
+		Quote:      quotedIRI,
+	}, clock.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next := s.PostDueStatuses(c); !next.Equal(scheduled.ScheduledAt) {
+		t.Fatalf("next due at %s, want %s", next, scheduled.ScheduledAt)
+	}
+	clock.Advance(time.Hour)
+	if next := s.PostDueStatuses(c); !next.IsZero() {
+		t.Fatalf("next due at %s, want none", next)
+	}
+
+	notes, err := s.db.LocalNotesSince(c, clock.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notes) != 1 {
+		t.Fatalf("posted %d notes, want 1", len(notes))
+	}
+	note := notes[0]
+	if v := Visibility(note); v != VisibilityUnlisted {
+		t.Errorf("visibility = %s, want %s", v, VisibilityUnlisted)
+	}
+	if !Sensitive(note) {
+		t.Error("posted without its content warning")
+	}
+	if q := QuoteOf(note); q == nil || q.String() != quotedIRI.String() {
+		t.Errorf("quotes %v, want %s", q, quotedIRI)
+	}
+	if content := note.GetActivityStreamsContent(); content == nil || content.Len() < 2 || !content.At(1).IsRDFLangString() ||
+		content.At(1).GetRDFLangString()["fr"] == "" {
+		t.Error("posted without its language")
+	}
+}
+
+func TestStartScheduler(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	clock := &testClock{now: time.Now()}
+	s.SetClock(clock)
+	aliceIRI := register(t, s, "alice")
+	respondLocally(t, s, transport, s.boxIRI(aliceIRI, "followers"))
+	// waitPosted waits for none of alice's statuses to be left scheduled.
+	waitPosted := func() {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for len(s.ScheduledStatuses(aliceIRI)) > 0 {
+			if time.Now().After(deadline) {
+				t.Fatal("scheduled status not posted")
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// One stored before the scheduler starts, and overdue by then.
+	if _, err := s.ScheduleStatus(c, aliceIRI, StatusParams{Status: "overdue"}, clock.Now().Add(minScheduleDelay)); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(minScheduleDelay)
+	s.StartScheduler()
+	waitPosted()
+
+	if _, err := s.ScheduleStatus(c, aliceIRI, StatusParams{Status: "later"}, clock.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Hour)
+	// The scheduler waits on the wall clock, so we nudge it.
+	s.wakeScheduler()
+	waitPosted()
+
+	if err := s.Shutdown(c); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ScheduleStatus(c, aliceIRI, StatusParams{Status: "never"}, clock.Now().Add(minScheduleDelay)); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(minScheduleDelay)
+	s.wakeScheduler()
+	time.Sleep(50 * time.Millisecond)
+	if len(s.ScheduledStatuses(aliceIRI)) != 1 {
+		t.Error("posted a scheduled status after Shutdown")
+	}
+}
@@ -5,97 +5,359 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"mastogon/internal/db"
+
 	"github.com/go-fed/activity/pub"
 	"github.com/go-fed/activity/streams/vocab"
 )
 
-type Service struct{}
+type Service struct {
+	// Operator-supplied settings.
+	config Config
+	// Where everything we know about is stored.
+	db *db.DB
+	// What we make requests to peers with.
+	client *http.Client
+	// If set, what all requests to peers go through instead, unsigned.
+	transport pub.Transport
+	// The Go-Fed actor doing the federating on our behalf.
+	actor pub.FederatingActor
+	// Where the service gets the current time from. If nil, the wall clock.
+	clock pub.Clock
+	// When we last fetched each remote object RefreshObject was asked for,
+	// keyed by IRI.
+	refreshed sync.Map
+	// Coalesces concurrent refreshes of the same object.
+	refreshes flight
+	// Peers' public keys, keyed by keyId.
+	keys sync.Map
+	// Coalesces concurrent fetches of the same key.
+	keyFetches flight
+	// How each peer took our signatures last, keyed by host.
+	signatureStyles sync.Map
+	// How deliveries to each peer have been going, keyed by host.
+	deliveryHealth sync.Map
+	// The peers we've dealt with, keyed by host.
+	instances sync.Map
+	// Remote accounts' WebFinger lookups, and coalescing concurrent ones.
+	webFingers       webFingerCache
+	webFingerLookups flight
+	// The shared inboxes of the peers' actors we've fetched, keyed by the
+	// actors' own inboxes.
+	sharedInboxes sync.Map
+	// The JSON-LD contexts LD signatures have needed, keyed by IRI.
+	ldContexts sync.Map
+	// The deliveries to our inboxes we've recently taken in.
+	deliveries dedupWindow
+	// Cleared while we shouldn't be sent traffic, such as during
+	// migrations.
+	ready atomic.Bool
+	// Our outgoing deliveries.
+	delivery deliveryQueue
+	// Set once we're shutting down and refusing deliveries to our inboxes.
+	draining atomic.Bool
+	// The hashtags trending among our local users.
+	trends trends
+	// Posts scheduled statuses.
+	scheduler scheduler
+	// Runs our background work, and stored jobs.
+	jobs jobRunner
+	// Hands out events to extensions listening for them.
+	events eventBus
+	// Held while making our instance actor, so it's only made once.
+	instanceActorMu sync.Mutex
+}
+
+func (s *Service) Construct(db *db.DB, config Config) {
+	s.config = config
+	s.db = db
+	s.client = newHTTPClient(config)
+	s.actor = pub.NewFederatingActor(s, s, db, s)
+	s.HandleJobs(deliveryRetryJob, s.retryDelivery)
+	s.ready.Store(true)
+}
 
-func (*Service) AuthenticateGetInbox(c context.Context,
+// SetReady marks the service as ready for traffic or not, say while
+// migrating the database.
+func (s *Service) SetReady(ready bool) {
+	s.ready.Store(ready)
+}
+
+// Ready returns why the service can't take traffic right now, if it can't.
+func (s *Service) Ready(c context.Context) error {
+	if !s.ready.Load() {
+		return errors.New("not ready")
+	}
+	return s.db.Ping(c)
+}
+
+// SetClock makes the service, and Go-Fed on its behalf, take the current time
+// from `clock` instead of the wall clock. Tests use it to pin time down.
+func (s *Service) SetClock(clock pub.Clock) {
+	s.clock = clock
+}
+
+// SetTransport makes the service fetch and deliver through `t` instead of
+// signed HTTP requests. Tests use it, with a FakeTransport, to federate
+// without a network.
+func (s *Service) SetTransport(t pub.Transport) {
+	s.transport = t
+}
+
+// Config returns the settings the service was constructed with.
+func (s *Service) Config() Config {
+	return s.config
+}
+
+// ServeHTTP routes ActivityPub requests: inboxes go to the Go-Fed actor,
+// posts to outboxes are sent on their owners' behalf, collections are
+// paginated, and everything else is served straight from the database.
+func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// What Go-Fed and we lock handling it is held by the request.
+	r = r.WithContext(db.WithLockHolder(r.Context()))
+	c := r.Context()
+	id := &url.URL{Scheme: "https", Host: s.db.Hostname(), Path: r.URL.Path}
+	var isAS bool
+	var err error
+	switch {
+	case r.URL.Path == "/healthz":
+		// We're up if we can answer at all.
+		w.Write([]byte("ok\n"))
+		return
+	case r.URL.Path == "/readyz":
+		if err := s.Ready(c); err != nil {
+			WriteError(w, fmt.Errorf("%w: %s", ErrUnavailable, err))
+			return
+		}
+		w.Write([]byte("ok\n"))
+		return
+	case r.URL.Path == "/robots.txt":
+		s.serveRobots(w, r)
+		return
+	case r.URL.Path == "/.well-known/webfinger":
+		s.serveWebFinger(w, r)
+		return
+	case strings.HasSuffix(r.URL.Path, "/inbox") && r.Method == http.MethodPost && s.draining.Load():
+		// Peers retry, so they can deliver to whoever takes over from us.
+		WriteError(w, fmt.Errorf("shutting down: %w", ErrUnavailable))
+		return
+	case r.URL.Path == "/inbox" && r.Method == http.MethodPost:
+		if !s.bufferBody(w, r) {
+			return
+		}
+		s.postSharedInbox(withActivityContentType(c, r), w, r)
+		return
+	case strings.HasSuffix(r.URL.Path, "/inbox") && r.Method == http.MethodPost:
+		if !s.bufferBody(w, r) {
+			return
+		}
+		c := withActivityContentType(c, r)
+		if s.postEmojiReact(c, w, r) {
+			return
+		}
+		isAS, err = s.postInbox(c, w, r)
+	case strings.HasSuffix(r.URL.Path, "/inbox"):
+		isAS, err = s.actor.GetInbox(c, w, r)
+	case strings.HasSuffix(r.URL.Path, "/outbox") && r.Method == http.MethodPost:
+		s.postOutbox(w, r, id)
+		return
+	case s.hidden(c, id):
+		WriteError(w, ErrNotFound)
+		return
+	case r.Method == http.MethodGet && s.isCollection(c, id) || isActivityStreamsGet(r):
+		viewer, err := s.authorizeFetch(c, r, id)
+		if err != nil {
+			WriteError(w, ErrInvalidSignature)
+			return
+		}
+		s.setRobotsTag(c, w, id)
+		if r.Method == http.MethodGet && s.isCollection(c, id) {
+			s.serveCollection(w, r, id, viewer)
+		} else {
+			s.serveObject(w, r, id, viewer)
+		}
+		return
+	}
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	if !isAS {
+		WriteError(w, ErrNotFound)
+	}
+}
+
+func (s *Service) AuthenticateGetInbox(c context.Context,
 	w http.ResponseWriter,
 	r *http.Request) (out context.Context, authenticated bool, err error) {
-	// TODO
-	return
+	// Inboxes are only for their owners to read, with a client's bearer
+	// token.
+	actorIRI, err := s.authenticateBearer(r)
+	if err == nil && s.boxIRI(actorIRI, "inbox").Path != r.URL.Path {
+		err = fmt.Errorf("inbox %s: %w", r.URL.Path, db.ErrNotOwned)
+	}
+	if err != nil {
+		WriteError(w, err)
+		return c, false, nil
+	}
+	return WithActor(c, actorIRI, TokenScopes), true, nil
 }
 
-func (*Service) AuthenticateGetOutbox(c context.Context,
+func (s *Service) AuthenticateGetOutbox(c context.Context,
 	w http.ResponseWriter,
 	r *http.Request) (out context.Context, authenticated bool, err error) {
-	// TODO
-	return
+	// Outboxes are public, but their owners may see more.
+	if actorIRI, err := s.authenticateBearer(r); err == nil {
+		c = WithActor(c, actorIRI, TokenScopes)
+	}
+	return c, true, nil
 }
 
-func (*Service) GetOutbox(c context.Context,
+func (s *Service) GetOutbox(c context.Context,
 	r *http.Request) (vocab.ActivityStreamsOrderedCollectionPage, error) {
-	// TODO
-	return nil, nil
-}
-
-func (*Service) NewTransport(c context.Context,
-	actorBoxIRI *url.URL,
-	gofedAgent string) (t pub.Transport, err error) {
-	// TODO
-	return
+	return s.requestedOrderedCollectionPage(c, r)
 }
 
-func (*Service) PostInboxRequestBodyHook(c context.Context,
+func (s *Service) PostInboxRequestBodyHook(c context.Context,
 	r *http.Request,
-	activity Activity) (context.Context, error) {
-	// TODO
-	return nil, nil
+	activity pub.Activity) (context.Context, error) {
+	inboxIRI := &url.URL{Scheme: "https", Host: s.db.Hostname(), Path: r.URL.Path}
+	if s.replayedCreate(c, inboxIRI, activity) {
+		return c, errReplayedCreate
+	}
+	// Which inbox it is decides what's done with Follows.
+	return withInbox(c, inboxIRI), nil
 }
 
-func (*Service) AuthenticatePostInbox(c context.Context,
+func (s *Service) AuthenticatePostInbox(c context.Context,
 	w http.ResponseWriter,
 	r *http.Request) (out context.Context, authenticated bool, err error) {
-	// TODO
-	return
+	// Only deliveries signed by their sender get in. Who signed is left in
+	// the context for Go-Fed's callbacks, see ActorFromContext.
+	if isAuthenticated(c) {
+		return c, true, nil
+	}
+	inboxIRI := &url.URL{Scheme: "https", Host: s.db.Hostname(), Path: r.URL.Path}
+	signer, ok := s.verifyDelivery(c, inboxIRI, r)
+	if !ok {
+		WriteError(w, ErrInvalidSignature)
+		return c, false, nil
+	}
+	return WithActor(c, signer, nil), true, nil
 }
 
-func (*Service) Blocked(c context.Context,
+func (s *Service) Blocked(c context.Context,
 	actorIRIs []*url.URL) (blocked bool, err error) {
-	// TODO
+	// Suspended actors, and everyone on suspended domains, don't get to
+	// talk to us at all.
+	for _, actorIRI := range actorIRIs {
+		if s.db.IsSuspended(actorIRI) {
+			return true, nil
+		}
+		if b, ok := s.DomainBlockFor(actorIRI.Host); ok && b.Severity == "suspend" {
+			return true, nil
+		}
+	}
 	return
 }
 
-func (*Service) FederatingCallbacks(c context.Context) (wrapped FederatingWrappedCallbacks, other []interface{}, err error) {
-	// TODO
+func (s *Service) FederatingCallbacks(c context.Context) (wrapped pub.FederatingWrappedCallbacks, other []interface{}, err error) {
+	// These run after Go-Fed's defaults.
+	wrapped.Accept = s.accepted
+	wrapped.Reject = s.rejected
+	wrapped.Follow = s.followed
+	wrapped.OnFollow = s.onFollow(c)
+	wrapped.Like = s.liked
+	wrapped.Announce = s.announced
+	// Those we've nothing to add to are only announced to listeners.
+	wrapped.Create = func(c context.Context, a vocab.ActivityStreamsCreate) error {
+		s.received(a)
+		return nil
+	}
+	wrapped.Update = func(c context.Context, a vocab.ActivityStreamsUpdate) error {
+		s.received(a)
+		return nil
+	}
+	wrapped.Block = func(c context.Context, a vocab.ActivityStreamsBlock) error {
+		s.received(a)
+		return nil
+	}
+	// Ours replace Go-Fed's defaults, rather than running after them.
+	other = []interface{}{
+		s.add,
+		s.remove,
+		s.moved,
+		s.undo,
+		s.delete,
+	}
 	return
 }
 
-func (*Service) DefaultCallback(c context.Context,
-	activity Activity) error {
-	// TODO
+func (s *Service) DefaultCallback(c context.Context,
+	activity pub.Activity) error {
+	// Go-Fed has no handling of these, but extensions may.
+	s.received(activity)
 	return nil
 }
 
-func (*Service) MaxInboxForwardingRecursionDepth(c context.Context) int {
-	// TODO
-	return -1
+func (s *Service) MaxInboxForwardingRecursionDepth(c context.Context) int {
+	// How far up `inReplyTo` chains and into objects Go-Fed looks for one
+	// of ours, deciding whether to forward. Zero would mean no limit.
+	return s.config.MaxInboxForwardingDepth
 }
 
-func (*Service) MaxDeliveryRecursionDepth(c context.Context) int {
-	// TODO
-	return -1
+func (s *Service) MaxDeliveryRecursionDepth(c context.Context) int {
+	// How far Go-Fed looks into the collections we address, for their
+	// members' inboxes. It counts the addressees as level zero and stops
+	// before the level it's given, so it's given one more than configured to
+	// reach the members of our followers collection at all. Zero would mean
+	// no limit, having us deliver to the followers of a remote actor's
+	// followers and on.
+	if s.config.MaxDeliveryDepth < 1 {
+		return 2
+	}
+	return s.config.MaxDeliveryDepth + 1
 }
 
-func (*Service) FilterForwarding(c context.Context,
+// FilterForwarding is handed the collections of ours an activity in our
+// inbox is addressed to, such as a reply to one of our users sent to their
+// followers, when Go-Fed finds the activity should be forwarded to their
+// members, since the sender can't see who they are. Without it those
+// followers would see the thread with the reply missing.
+//
+// Go-Fed would deliver to the members themselves rather than to their
+// inboxes, so we forward it here and leave Go-Fed nothing to do.
+func (s *Service) FilterForwarding(c context.Context,
 	potentialRecipients []*url.URL,
-	a Activity) (filteredRecipients []*url.URL, err error) {
-	// TODO
-	return
+	a pub.Activity) (filteredRecipients []*url.URL, err error) {
+	return nil, s.forward(c, potentialRecipients, a)
 }
 
-func (*Service) GetInbox(c context.Context,
+func (s *Service) GetInbox(c context.Context,
 	r *http.Request) (vocab.ActivityStreamsOrderedCollectionPage, error) {
-	// TODO
-	return nil, nil
+	return s.requestedOrderedCollectionPage(c, r)
+}
+
+// LocalTime returns `t` in the instance's time zone, for showing to people.
+func (s *Service) LocalTime(t time.Time) time.Time {
+	if s.config.TimeZone == nil {
+		return t.UTC()
+	}
+	return t.In(s.config.TimeZone)
 }
 
-func (*Service) Now() time.Time {
+func (s *Service) Now() time.Time {
+	if s.clock != nil {
+		return s.clock.Now()
+	}
 	return time.Now()
 }
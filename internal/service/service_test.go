@@ -0,0 +1,210 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"mastogon/internal/db"
+
+	"github.com/go-fed/activity/streams"
+)
+
+// The hostname our test services' actors live on.
+const testHostname = "mastogon.test"
+
+// newTestService returns a service with its database in memory, open
+// registrations and `transport` to federate through.
+func newTestService(t testing.TB) (*Service, *FakeTransport) {
+	t.Helper()
+	d := &db.DB{}
+	d.Construct(&sync.Map{}, testHostname)
+	config := DefaultConfig()
+	config.RegistrationsOpen = true
+	s := &Service{}
+	s.Construct(d, config)
+	transport := &FakeTransport{}
+	s.SetTransport(transport)
+	return s, transport
+}
+
+// register signs `username` up on `s`, returning their actor.
+func register(t testing.TB, s *Service, username string) *url.URL {
+	t.Helper()
+	token, err := s.Register(context.Background(), Registration{
+		Username: username,
+		Email:    username + "@" + testHostname,
+		Password: "password",
+	})
+	if err != nil {
+		t.Fatalf("registering %s: %s", username, err)
+	}
+	actorIRI, err := s.db.ActorForToken(token)
+	if err != nil {
+		t.Fatalf("registering %s: %s", username, err)
+	}
+	return actorIRI
+}
+
+// mustParse parses `iri`, failing the test if it can't.
+func mustParse(t testing.TB, iri string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(iri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+// respondLocally makes `transport` serve what `s` stores at `iris`, as our
+// own server would when Go-Fed fetches them, say to resolve followers.
+func respondLocally(t testing.TB, s *Service, transport *FakeTransport, iris ...*url.URL) {
+	t.Helper()
+	for _, iri := range iris {
+		v, err := s.db.Get(context.Background(), iri)
+		if err != nil {
+			t.Fatalf("getting %s: %s", iri, err)
+		}
+		m, err := streams.Serialize(v)
+		if err != nil {
+			t.Fatalf("serializing %s: %s", iri, err)
+		}
+		b, err := json.Marshal(m)
+		if err != nil {
+			t.Fatalf("serializing %s: %s", iri, err)
+		}
+		transport.Respond(iri, b)
+	}
+}
+
+// testClock is a clock tests move by hand.
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock `d` forward.
+func (c *testClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestSetClock(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	clock := &testClock{now: time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)}
+	s.SetClock(clock)
+	if !s.Now().Equal(clock.now) {
+		t.Fatalf("now %v, want %v", s.Now(), clock.now)
+	}
+	aliceIRI := register(t, s, "alice")
+	respondLocally(t, s, transport, s.boxIRI(aliceIRI, "followers"))
+
+	clock.Advance(time.Hour)
+	note, err := s.PostStatus(c, aliceIRI, StatusParams{Status: "on time", Visibility: VisibilityPublic})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := time.Date(2026, 10, 1, 13, 0, 0, 0, time.UTC)
+	if got := published(note); !got.Equal(want) {
+		t.Errorf("note published %v, want %v", got, want)
+	}
+	outbox, _, err := s.collectionItems(c, s.boxIRI(aliceIRI, "outbox"))
+	if err != nil || len(outbox) != 1 {
+		t.Fatalf("outbox %v, %v", outbox, err)
+	}
+	if got := s.db.Published(outbox[0]); !got.Equal(want) {
+		t.Errorf("Create published %v, want %v", got, want)
+	}
+}
+
+func TestHealthAndReadiness(t *testing.T) {
+	s, _ := newTestService(t)
+	get := func(path string) int {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code
+	}
+	if got := get("/healthz"); got != http.StatusOK {
+		t.Errorf("healthz %d", got)
+	}
+	if got := get("/readyz"); got != http.StatusOK {
+		t.Errorf("readyz %d once constructed", got)
+	}
+	s.SetReady(false)
+	if got := get("/readyz"); got != http.StatusServiceUnavailable {
+		t.Errorf("readyz %d while not ready, want 503", got)
+	}
+	if got := get("/healthz"); got != http.StatusOK {
+		t.Errorf("healthz %d while not ready, want 200", got)
+	}
+	s.SetReady(true)
+	if got := get("/readyz"); got != http.StatusOK {
+		t.Errorf("readyz %d once ready again", got)
+	}
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := get("/readyz"); got != http.StatusServiceUnavailable {
+		t.Errorf("readyz %d shutting down, want 503", got)
+	}
+
+	// An unusable database makes us unready however we're marked.
+	unconstructed := &Service{db: &db.DB{}}
+	unconstructed.SetReady(true)
+	if err := unconstructed.Ready(context.Background()); err == nil {
+		t.Error("ready without a database")
+	}
+}
+
+func TestFakeTransportAcceptsFollow(t *testing.T) {
+	s, transport := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	bob := newTestPeer(t, transport, "https://remote.test/users/bob", "rsa")
+	deliver(t, s, bob, s.boxIRI(aliceIRI, "inbox"), followBy(bob.iri.String(), aliceIRI.String()))
+
+	delivered := transport.Delivered()
+	if len(delivered) != 1 || delivered[0].To.String() != bob.iri.String()+"/inbox" {
+		t.Fatalf("delivered %+v, want the Accept sent to bob", delivered)
+	}
+	var accept struct {
+		Type   string      `json:"type"`
+		Actor  string      `json:"actor"`
+		Object interface{} `json:"object"`
+	}
+	if err := json.Unmarshal(delivered[0].Body, &accept); err != nil {
+		t.Fatal(err)
+	}
+	if accept.Type != "Accept" || accept.Actor != aliceIRI.String() {
+		t.Errorf("delivered a %s by %s, want alice's Accept", accept.Type, accept.Actor)
+	}
+}
+
+func TestFakeTransportResponds(t *testing.T) {
+	c := context.Background()
+	var transport FakeTransport
+	if _, err := transport.Dereference(c, mustParse(t, "https://remote.test/users/bob")); err == nil {
+		t.Error("the zero value served something")
+	}
+	transport.Respond(mustParse(t, "https://remote.test/users/bob"), []byte(`{"type":"Person"}`))
+	// Keys are served by their actor's document.
+	b, err := transport.Dereference(c, mustParse(t, "https://remote.test/users/bob#main-key"))
+	if err != nil || string(b) != `{"type":"Person"}` {
+		t.Errorf("served %s, %v", b, err)
+	}
+}
@@ -0,0 +1,204 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+
+	"mastogon/internal/db"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// Peers offering a shared inbox take a single delivery for all their actors
+// an activity is for, rather than one per actor. Go-Fed resolves the
+// recipients of our activities to their own inboxes, fetching their actors
+// as it goes; we note the shared inboxes of the actors fetched, and swap
+// them in when delivering. Actors without one, even on a peer where others
+// have one, keep getting deliveries of their own.
+//
+// We offer one too, at /inbox, handing what's delivered there to the inbox
+// of each of our actors it's for.
+
+// noteSharedInbox remembers the shared inbox of the actor `b`, if it's one
+// and has one on the same host as its own inbox.
+func (s *Service) noteSharedInbox(b []byte) {
+	var m struct {
+		Inbox     string          `json:"inbox"`
+		Endpoints json.RawMessage `json:"endpoints"`
+	}
+	if err := json.Unmarshal(b, &m); err != nil || m.Inbox == "" || len(m.Endpoints) == 0 {
+		return
+	}
+	var endpoints struct {
+		SharedInbox string `json:"sharedInbox"`
+	}
+	if err := json.Unmarshal(m.Endpoints, &endpoints); err != nil || endpoints.SharedInbox == "" {
+		return
+	}
+	inbox, err := url.Parse(m.Inbox)
+	if err != nil {
+		return
+	}
+	shared, err := url.Parse(endpoints.SharedInbox)
+	// Else an actor could have the activities for its neighbours sent
+	// anywhere it liked.
+	if err != nil || shared.Host != inbox.Host {
+		return
+	}
+	s.sharedInboxes.Store(inbox.String(), shared)
+}
+
+// withSharedInboxes returns `recipients`, the inboxes the activity `b` is to
+// be delivered to, with those of actors having a shared inbox replaced by
+// it, once per shared inbox. Direct messages go to each inbox: a shared
+// inbox only gets to see who they're addressed to, not who was blind copied.
+func (s *Service) withSharedInboxes(c context.Context, b []byte, recipients []*url.URL) []*url.URL {
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return recipients
+	}
+	t, err := streams.ToType(c, m)
+	if err != nil || Visibility(t) == VisibilityDirect {
+		return recipients
+	}
+	seen := make(map[string]bool, len(recipients))
+	grouped := make([]*url.URL, 0, len(recipients))
+	for _, to := range recipients {
+		if v, ok := s.sharedInboxes.Load(to.String()); ok {
+			to = v.(*url.URL)
+		}
+		if !seen[to.String()] {
+			seen[to.String()] = true
+			grouped = append(grouped, to)
+		}
+	}
+	return grouped
+}
+
+// sharedInboxIRI is where peers may deliver once for all our actors an
+// activity is for.
+func (s *Service) sharedInboxIRI() *url.URL {
+	return &url.URL{Scheme: "https", Host: s.db.Hostname(), Path: "/inbox"}
+}
+
+// withEndpoints adds to our actor `t`, serialized as `m`, the endpoints
+// peers and clients may use: our shared inbox, and where to get OAuth
+// tokens if we say. Go-Fed has no type for the endpoints object, so it's
+// added as the actor is served rather than stored.
+func (s *Service) withEndpoints(m map[string]interface{}, t vocab.Type) {
+	if _, ok := db.ToActor(t); !ok {
+		return
+	}
+	endpoints := map[string]interface{}{
+		"sharedInbox": s.sharedInboxIRI().String(),
+	}
+	if s.config.OAuthAuthorizationEndpoint != "" {
+		endpoints["oauthAuthorizationEndpoint"] = s.config.OAuthAuthorizationEndpoint
+	}
+	if s.config.OAuthTokenEndpoint != "" {
+		endpoints["oauthTokenEndpoint"] = s.config.OAuthTokenEndpoint
+	}
+	m["endpoints"] = endpoints
+}
+
+// postSharedInbox takes the delivery `r` to our shared inbox, handing it to
+// the inbox of each of our actors it's for. Its body must have been
+// buffered. Like the peers we learnt this from, we say we accepted it
+// whatever the inboxes make of it.
+func (s *Service) postSharedInbox(c context.Context, w http.ResponseWriter, r *http.Request) {
+	body, err := r.GetBody()
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	var m map[string]interface{}
+	if err := json.NewDecoder(body).Decode(&m); err != nil {
+		WriteError(w, &ParseError{err})
+		return
+	}
+	t, err := streams.ToType(c, m)
+	if err != nil {
+		WriteError(w, &ParseError{err})
+		return
+	}
+	recipients := s.sharedInboxRecipients(c, t)
+	if len(recipients) == 0 {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	// Keys are fetched as any of the recipients would have.
+	signer, ok := s.verifyDelivery(c, s.boxIRI(recipients[0], "inbox"), r)
+	if !ok {
+		WriteError(w, ErrInvalidSignature)
+		return
+	}
+	// The signature is only good for the request it was made for, so the
+	// deliveries we hand on go as authenticated already.
+	c = WithActor(c, signer, nil)
+	for _, actorIRI := range recipients {
+		delivery := r.Clone(c)
+		delivery.URL.Path = s.boxIRI(actorIRI, "inbox").Path
+		if delivery.Body, err = r.GetBody(); err != nil {
+			break
+		}
+		discard := &discardResponse{header: make(http.Header)}
+		if s.postEmojiReact(c, discard, delivery) {
+			continue
+		}
+		if _, err := s.postInbox(c, discard, delivery); err != nil {
+			log.Printf("delivering to %s from our shared inbox: %s", delivery.URL.Path, err)
+		}
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// sharedInboxRecipients returns the local actors the activity `t` is for:
+// those it's addressed to and, if it's addressed to anyone else, such as
+// the public or its actor's followers, our actors following its actor.
+func (s *Service) sharedInboxRecipients(c context.Context, t vocab.Type) (recipients []*url.URL) {
+	seen := make(map[string]bool)
+	add := func(actorIRI *url.URL) {
+		if !seen[actorIRI.String()] {
+			seen[actorIRI.String()] = true
+			recipients = append(recipients, actorIRI)
+		}
+	}
+	toOthers := false
+	for _, to := range recipientsOf(t) {
+		if s.isLocalActor(c, to) {
+			add(to)
+		} else {
+			toOthers = true
+		}
+	}
+	if !toOthers {
+		return
+	}
+	authors := authorsOf(t)
+	for _, account := range s.db.Accounts() {
+		for _, author := range authors {
+			if following, _ := s.IsFollowing(c, account.ActorIRI, author); following {
+				add(account.ActorIRI)
+				break
+			}
+		}
+	}
+	return
+}
+
+// discardResponse is where the inboxes a shared inbox delivery is handed to
+// answer: the peer gets a single answer from the shared inbox.
+type discardResponse struct {
+	header http.Header
+}
+
+func (w *discardResponse) Header() http.Header         { return w.header }
+func (w *discardResponse) Write(b []byte) (int, error) { return len(b), nil }
+func (w *discardResponse) WriteHeader(int)             {}
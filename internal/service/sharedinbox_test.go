@@ -0,0 +1,142 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// inboxCount returns how many times the activity at `id` is in the inbox
+// of the local actor at `actorIRI`.
+func inboxCount(t *testing.T, s *Service, actorIRI *url.URL, id string) (n int) {
+	t.Helper()
+	v, err := s.db.Get(context.Background(), s.boxIRI(actorIRI, "inbox"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	inbox, ok := v.(vocab.ActivityStreamsOrderedCollection)
+	if !ok || inbox.GetActivityStreamsOrderedItems() == nil {
+		return 0
+	}
+	for iter := inbox.GetActivityStreamsOrderedItems().Begin(); iter != inbox.GetActivityStreamsOrderedItems().End(); iter = iter.Next() {
+		if itemId, err := pub.ToId(iter); err == nil && itemId.String() == id {
+			n++
+		}
+	}
+	return
+}
+
+func TestSharedInboxDelivery(t *testing.T) {
+	s, transport := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	carolIRI := register(t, s, "carol")
+	daveIRI := register(t, s, "dave")
+	erinIRI := register(t, s, "erin")
+	bob := newTestPeer(t, transport, "https://remote.test/users/bob", "rsa")
+	// Erin follows bob, dave doesn't.
+	following(t, s, erinIRI, bob.iri)
+
+	for i, test := range []struct {
+		name string
+		to   []interface{}
+		// Who gets it.
+		alice, carol, dave, erin int
+	}{
+		{"addressed", []interface{}{aliceIRI.String(), carolIRI.String()}, 1, 1, 0, 0},
+		{"addressed twice", []interface{}{aliceIRI.String(), aliceIRI.String()}, 1, 0, 0, 0},
+		{"public", []interface{}{pub.PublicActivityPubIRI, aliceIRI.String()}, 1, 0, 0, 1},
+		{"followers", []interface{}{bob.iri.String() + "/followers"}, 0, 0, 0, 1},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			note := postBy("Note", fmt.Sprintf("https://remote.test/notes/%d", i+1), bob.iri.String(), "")
+			note["to"] = test.to
+			create := creating(note)
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, signedDelivery(t, bob, s.sharedInboxIRI(), create, false))
+			if w.Code != http.StatusAccepted {
+				t.Fatalf("POST to the shared inbox: %d %s", w.Code, w.Body)
+			}
+			id := create["id"].(string)
+			for _, got := range []struct {
+				actorIRI *url.URL
+				want     int
+			}{
+				{aliceIRI, test.alice},
+				{carolIRI, test.carol},
+				{daveIRI, test.dave},
+				{erinIRI, test.erin},
+			} {
+				if n := inboxCount(t, s, got.actorIRI, id); n != got.want {
+					t.Errorf("%s got it %d times, want %d", got.actorIRI, n, got.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSharedInboxOutgoing(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	// withSharedInbox has `p`'s document advertise `sharedInbox`.
+	withSharedInbox := func(p *testPeer, sharedInbox string) *testPeer {
+		doc := p.actorDoc(p.publicKeyDoc(t, p.iri.String()))
+		doc["endpoints"] = map[string]interface{}{"sharedInbox": sharedInbox}
+		respondJSON(t, transport, p.iri.String(), doc)
+		return p
+	}
+	bob := withSharedInbox(newTestPeer(t, transport, "https://remote.test/users/bob", "rsa"), "https://remote.test/inbox")
+	carol := withSharedInbox(newTestPeer(t, transport, "https://remote.test/users/carol", "rsa"), "https://remote.test/inbox")
+	dave := newTestPeer(t, transport, "https://other.test/users/dave", "rsa")
+	// Nor may an actor have its neighbours' deliveries sent elsewhere.
+	mallory := withSharedInbox(newTestPeer(t, transport, "https://remote.test/users/mallory", "rsa"), "https://evil.test/inbox")
+	for _, p := range []*testPeer{bob, carol, dave, mallory} {
+		follow(t, s, aliceIRI, p.iri)
+	}
+	delivered := func(status StatusParams) map[string]int {
+		t.Helper()
+		before := len(transport.Delivered())
+		if _, err := s.PostStatus(c, aliceIRI, status); err != nil {
+			t.Fatal(err)
+		}
+		to := make(map[string]int)
+		for _, d := range transport.Delivered()[before:] {
+			to[d.To.String()]++
+		}
+		return to
+	}
+
+	// bob and carol's instance gets one POST for both of them.
+	got := delivered(StatusParams{Status: "hello", Visibility: VisibilityPublic})
+	want := map[string]int{
+		"https://remote.test/inbox":               1,
+		dave.iri.String() + "/inbox":              1,
+		"https://remote.test/users/mallory/inbox": 1,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("a public post was delivered to %v, want %v", got, want)
+	}
+
+	// Direct messages go to each inbox.
+	s.webFingers.Store("bob@remote.test", webFingerResult{bob.iri, s.Now().Add(time.Hour)})
+	s.webFingers.Store("carol@remote.test", webFingerResult{carol.iri, s.Now().Add(time.Hour)})
+	got = delivered(StatusParams{Status: "@bob@remote.test @carol@remote.test hi", Visibility: VisibilityDirect})
+	want = map[string]int{
+		bob.iri.String() + "/inbox":   1,
+		carol.iri.String() + "/inbox": 1,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("a direct message was delivered to %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,433 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"mastogon/internal/db"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/go-fed/httpsig"
+)
+
+// remoteKey is a peer's public key we verify signatures with.
+type remoteKey struct {
+	key crypto.PublicKey
+	// The actor the key belongs to.
+	owner *url.URL
+	// When we fetched it.
+	fetched time.Time
+}
+
+// verifyRequest checks the HTTP signature on `r`, be it of the cavage draft
+// or RFC 9421, fetching the signing key as the local actor owning `boxIRI`.
+// Keys are cached by keyId, but a signature failing to verify with a cached
+// key gets the key refetched once: the peer may well have rotated it. Not
+// more than once every Config.MinRefreshInterval, though, lest each forged
+// signature have us fetch someone's key again.
+func (s *Service) verifyRequest(c context.Context,
+	boxIRI *url.URL,
+	r *http.Request) (owner *url.URL, err error) {
+	var keyId string
+	var verify func(rk *remoteKey) error
+	if isRFC9421(r) {
+		sig, err := parseRFC9421(r)
+		if err != nil {
+			return nil, err
+		}
+		body, err := readBody(r)
+		if err != nil {
+			return nil, err
+		}
+		keyId = sig.params["keyid"]
+		verify = func(rk *remoteKey) error {
+			return s.verifyRFC9421(r, body, sig, rk.key)
+		}
+	} else {
+		// Go takes Host out of the headers, where httpsig looks for it.
+		if r.Header.Get("Host") == "" {
+			r.Header.Set("Host", r.Host)
+		}
+		verifier, err := httpsig.NewVerifier(r)
+		if err != nil {
+			return nil, err
+		}
+		keyId = verifier.KeyId()
+		body, err := readBody(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(body) > 0 {
+			if err := checkSignedDigest(r, body); err != nil {
+				return nil, err
+			}
+		}
+		if s.config.EnforceSignatureDate {
+			if err := s.checkSignatureDate(r); err != nil {
+				return nil, err
+			}
+		}
+		verify = func(rk *remoteKey) error {
+			algo, err := verificationAlgorithm(r, rk.key)
+			if err != nil {
+				return err
+			}
+			if key, ok := rk.key.(ed25519.PublicKey); ok {
+				return verifyCavageEd25519(r, key)
+			}
+			return verifier.Verify(rk.key, algo)
+		}
+	}
+	rk, cached, err := s.publicKey(c, boxIRI, keyId, false)
+	if err != nil {
+		return nil, err
+	}
+	err = verify(rk)
+	if err != nil && cached && s.mayRefetchKey(rk) {
+		// Not getting the key again leaves the signature as bad as it was.
+		if fresh, _, fetchErr := s.publicKey(c, boxIRI, keyId, true); fetchErr == nil {
+			rk = fresh
+			err = verify(rk)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.notePeer(rk.owner.Host)
+	return rk.owner, nil
+}
+
+// Which requests peers must sign is up to Config: SignedDeliveries for
+// deliveries to our inboxes, shared or not, AuthorizedFetch for fetches of
+// our objects and collections, and SignedActorFetches for fetches of our
+// actors. Deliveries are checked by verifyDelivery and fetches by
+// authorizeFetch, whatever route they come in by.
+
+// verifyDelivery checks the signature on the delivery `r` to our inbox at
+// `inboxIRI`, returning who signed it and whether to take it. Only its actor
+// may sign it, lest anyone with a key speak for anyone else: one signed by
+// someone other than its actor, as forwarded ones are, is only taken with
+// Config.LDSignatures and the actor's LD signature, and its signer is the
+// actor then. One whose signature doesn't verify is still taken, with no
+// signer, when Config.SignedDeliveries is off or Config.UnverifiedDeletes
+// lets it in. Its body must have been buffered.
+func (s *Service) verifyDelivery(c context.Context, inboxIRI *url.URL, r *http.Request) (signer *url.URL, ok bool) {
+	delivered := asDelivered(c, r)
+	signer, err := s.verifyRequest(c, inboxIRI, delivered)
+	// Verifying may have buffered the body.
+	r.Body = delivered.Body
+	if err == nil {
+		return s.deliveredByActor(c, inboxIRI, r, signer)
+	}
+	return nil, !s.config.SignedDeliveries || s.acceptUnverified(c, r)
+}
+
+// authorizeFetch checks the request `r` for our object, collection or actor
+// at `id` is signed by someone allowed to see it, when Config asks for that,
+// and returns who's asking: the peer that signed it, or the local actor
+// whose bearer token it carries. A request for what Config lets anyone
+// fetch may still be signed, for things only the signer may see. What
+// doesn't belong to a local actor, such as hashtags, is for anyone to fetch.
+// Keys are fetched as the owner of `id`, or as the actor it is.
+func (s *Service) authorizeFetch(c context.Context, r *http.Request, id *url.URL) (viewer *url.URL, err error) {
+	ownerIRI := s.localOwner(c, id)
+	required := true
+	switch {
+	case s.isInstanceActor(id):
+		// Peers fetch it to check our signatures, signed fetches of their
+		// own included.
+		return nil, nil
+	case ownerIRI != nil && !s.config.AuthorizedFetch:
+		required = false
+	case ownerIRI == nil && (!s.config.SignedActorFetches || !s.isLocalActor(c, id)):
+		return nil, nil
+	case ownerIRI == nil:
+		ownerIRI = id
+	}
+	if actorIRI, err := s.authenticateBearer(r); err == nil {
+		return actorIRI, nil
+	}
+	if !required && r.Header.Get("Signature") == "" {
+		return nil, nil
+	}
+	signer, err := s.verifyRequest(c, s.boxIRI(ownerIRI, "inbox"), r)
+	switch {
+	case err != nil && !required:
+		// As good as unsigned.
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+	if blocked, _ := s.Blocked(c, []*url.URL{signer}); blocked {
+		return nil, errors.New("signer is blocked")
+	}
+	return signer, nil
+}
+
+// isLocalActor reports whether `iri` is one of our actors.
+func (s *Service) isLocalActor(c context.Context, iri *url.URL) bool {
+	if owns, err := s.db.Owns(c, iri); err != nil || !owns {
+		return false
+	}
+	t, err := s.db.Get(c, iri)
+	if err != nil {
+		return false
+	}
+	_, ok := db.ToActor(t)
+	return ok
+}
+
+// localOwner returns the local actor our object or collection at `id`
+// belongs to, if any: the actor it lives under, such as their outbox, or
+// else its author, such as a status. Actors don't belong to anyone.
+func (s *Service) localOwner(c context.Context, id *url.URL) *url.URL {
+	if rest := strings.TrimPrefix(id.Path, "/users/"); rest != id.Path {
+		username, _, belowActor := strings.Cut(rest, "/")
+		if !belowActor {
+			return nil
+		}
+		actorIRI, err := s.db.ActorForUsername(c, username)
+		if err != nil {
+			return nil
+		}
+		return actorIRI
+	}
+	t, err := s.db.Get(c, id)
+	if err != nil {
+		return nil
+	}
+	for _, author := range authorsOf(t) {
+		if owns, err := s.db.Owns(c, author); err == nil && owns {
+			return author
+		}
+	}
+	return nil
+}
+
+// checkSignedDigest checks the cavage-style signature on `r` covers its
+// Digest header, and that it matches `body`: the signature alone says
+// nothing of the body.
+func checkSignedDigest(r *http.Request, body []byte) error {
+	covered := false
+	for _, h := range strings.Fields(strings.ToLower(signatureParam(r, "headers"))) {
+		covered = covered || h == "digest"
+	}
+	if !covered {
+		return errors.New("signature doesn't cover the body")
+	}
+	return checkDigest(r.Header.Get("Digest"), body)
+}
+
+// checkSignatureDate checks the cavage-style signature on `r` covers its
+// Date header, and that it's within maxSignatureSkew of now.
+func (s *Service) checkSignatureDate(r *http.Request) error {
+	// Signatures not listing their headers cover only the date.
+	headers := signatureParam(r, "headers")
+	covered := headers == ""
+	for _, h := range strings.Fields(strings.ToLower(headers)) {
+		covered = covered || h == "date"
+	}
+	if !covered {
+		return errors.New("signature doesn't cover the date")
+	}
+	date, err := http.ParseTime(r.Header.Get("Date"))
+	if err != nil {
+		return fmt.Errorf("invalid date: %w", err)
+	}
+	if skew := s.Now().Sub(date); skew > maxSignatureSkew || skew < -maxSignatureSkew {
+		return errors.New("signature is too old or too new")
+	}
+	return nil
+}
+
+// keyAlgorithm returns the signature algorithm that goes with `key`: RSA
+// keys sign with RSA-SHA256, as everyone does, and Ed25519 keys with Ed25519.
+func keyAlgorithm(key interface{}) (httpsig.Algorithm, error) {
+	switch key.(type) {
+	case *rsa.PublicKey, *rsa.PrivateKey:
+		return httpsig.RSA_SHA256, nil
+	case ed25519.PublicKey, ed25519.PrivateKey:
+		return algorithmEd25519, nil
+	}
+	return "", fmt.Errorf("unsupported key type %T", key)
+}
+
+// verificationAlgorithm returns the algorithm to check the signature on `r`
+// with, made by `key`. Signatures saying "hs2019", or nothing, leave it to
+// the key; those naming an algorithm must name the key's.
+func verificationAlgorithm(r *http.Request, key crypto.PublicKey) (httpsig.Algorithm, error) {
+	algo, err := keyAlgorithm(key)
+	if err != nil {
+		return "", err
+	}
+	claimed := signatureParam(r, "algorithm")
+	if claimed == "" || claimed == "hs2019" || httpsig.Algorithm(claimed) == algo {
+		return algo, nil
+	}
+	return "", fmt.Errorf("signature claims %s but the key is for %s", claimed, algo)
+}
+
+// signatureParam returns the parameter `name` of the HTTP signature on `r`.
+func signatureParam(r *http.Request, name string) string {
+	header := r.Header.Get("Signature")
+	if header == "" {
+		header = strings.TrimPrefix(r.Header.Get("Authorization"), "Signature ")
+	}
+	for _, param := range strings.Split(header, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if ok && k == name {
+			return strings.Trim(v, `"`)
+		}
+	}
+	return ""
+}
+
+// publicKey returns the key with `keyId`, and whether it came from our cache.
+// Unless `refetch` is set a cached key is used. Concurrent fetches of the
+// same key share a single request.
+func (s *Service) publicKey(c context.Context,
+	boxIRI *url.URL,
+	keyId string,
+	refetch bool) (rk *remoteKey, cached bool, err error) {
+	if !refetch {
+		if v, ok := s.keys.Load(keyId); ok {
+			return v.(*remoteKey), true, nil
+		}
+	}
+	v, err := s.keyFetches.do(keyId, func() (interface{}, error) {
+		rk, err := s.fetchPublicKey(c, boxIRI, keyId)
+		if err != nil {
+			return nil, err
+		}
+		s.keys.Store(keyId, rk)
+		return rk, nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return v.(*remoteKey), false, nil
+}
+
+// mayRefetchKey reports whether the cached key `rk` was fetched long enough
+// ago to fetch again when a signature doesn't verify with it.
+func (s *Service) mayRefetchKey(rk *remoteKey) bool {
+	return s.Now().Sub(rk.fetched) >= s.config.MinRefreshInterval
+}
+
+// fetchPublicKey dereferences `keyId`, which usually points into the actor
+// document of its owner. A key living elsewhere only counts if its owner's
+// document lists it too: anyone may publish a key saying it's someone else's.
+// Either way the owner must be on the key's host.
+func (s *Service) fetchPublicKey(c context.Context,
+	boxIRI *url.URL,
+	keyId string) (*remoteKey, error) {
+	keyIRI, err := url.Parse(keyId)
+	if err != nil {
+		return nil, err
+	}
+	tp, err := s.NewTransport(c, boxIRI, "")
+	if err != nil {
+		return nil, err
+	}
+	t, err := s.dereferenceType(c, tp, keyIRI)
+	if err != nil {
+		return nil, err
+	}
+	k := publicKeyOf(t, keyId)
+	if k == nil {
+		return nil, fmt.Errorf("no key %s in %s", keyId, keyIRI)
+	}
+	owner := k.GetW3IDSecurityV1Owner()
+	pemProp := k.GetW3IDSecurityV1PublicKeyPem()
+	if owner == nil || owner.Get() == nil || pemProp == nil {
+		return nil, fmt.Errorf("key %s lacks an owner or PEM", keyId)
+	}
+	ownerIRI := owner.Get()
+	if ownerIRI.Host != keyIRI.Host {
+		return nil, fmt.Errorf("key %s is owned by %s, on another host", keyId, ownerIRI)
+	}
+	if id := t.GetJSONLDId(); id == nil || id.Get() == nil || id.Get().String() != ownerIRI.String() {
+		ownerDoc, err := s.dereferenceType(c, tp, ownerIRI)
+		if err != nil {
+			return nil, fmt.Errorf("fetching the owner of key %s: %w", keyId, err)
+		}
+		listed := publicKeyOf(ownerDoc, keyId)
+		if listed == nil || listed.GetW3IDSecurityV1PublicKeyPem() == nil ||
+			listed.GetW3IDSecurityV1PublicKeyPem().Get() != pemProp.Get() {
+			return nil, fmt.Errorf("%s doesn't list key %s as theirs", ownerIRI, keyId)
+		}
+	}
+	key, err := parsePublicKeyPEM(pemProp.Get())
+	if err != nil {
+		return nil, err
+	}
+	return &remoteKey{key: key, owner: ownerIRI, fetched: s.Now()}, nil
+}
+
+// dereferenceType fetches what's at `iri` with `tp`.
+func (s *Service) dereferenceType(c context.Context, tp pub.Transport, iri *url.URL) (vocab.Type, error) {
+	b, err := tp.Dereference(c, iri)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	return streams.ToType(c, m)
+}
+
+// publicKeyOf returns the key with `keyId` that `t` is, or that `t`, an
+// actor, has.
+func publicKeyOf(t vocab.Type, keyId string) vocab.W3IDSecurityV1PublicKey {
+	var keys []vocab.W3IDSecurityV1PublicKey
+	switch v := t.(type) {
+	case vocab.W3IDSecurityV1PublicKey:
+		keys = append(keys, v)
+	case interface {
+		GetW3IDSecurityV1PublicKey() vocab.W3IDSecurityV1PublicKeyProperty
+	}:
+		if prop := v.GetW3IDSecurityV1PublicKey(); prop != nil {
+			for iter := prop.Begin(); iter != prop.End(); iter = iter.Next() {
+				if iter.IsW3IDSecurityV1PublicKey() {
+					keys = append(keys, iter.Get())
+				}
+			}
+		}
+	}
+	for _, k := range keys {
+		if id := k.GetJSONLDId(); id != nil && id.Get() != nil && id.Get().String() == keyId {
+			return k
+		}
+	}
+	return nil
+}
+
+// parsePublicKeyPEM reads a PEM-encoded public key, in either the PKIX form
+// most software publishes or the PKCS #1 form some older software does.
+func parsePublicKeyPEM(s string) (crypto.PublicKey, error) {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		return nil, errors.New("invalid PEM")
+	}
+	if key, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return x509.ParsePKCS1PublicKey(block.Bytes)
+}
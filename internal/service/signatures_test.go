@@ -0,0 +1,485 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testPeer is a remote actor whose documents a FakeTransport serves.
+type testPeer struct {
+	iri   *url.URL
+	keyId string
+	key   crypto.Signer
+}
+
+// publicKeyDoc returns the publicKey of `p`, said to be owned by `owner`.
+func (p *testPeer) publicKeyDoc(t testing.TB, owner string) map[string]interface{} {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(p.key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]interface{}{
+		"id":           p.keyId,
+		"owner":        owner,
+		"publicKeyPem": string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+	}
+}
+
+// keyDoc returns the publicKey of `p`, owned by `owner`, as a document of
+// its own.
+func (p *testPeer) keyDoc(t testing.TB, owner string) map[string]interface{} {
+	t.Helper()
+	m := p.publicKeyDoc(t, owner)
+	m["@context"] = "https://w3id.org/security/v1"
+	m["type"] = "PublicKey"
+	return m
+}
+
+// actorDoc returns the Person `p` is, with `keys` as its public keys.
+func (p *testPeer) actorDoc(keys ...map[string]interface{}) map[string]interface{} {
+	m := map[string]interface{}{
+		"@context":          []interface{}{"https://www.w3.org/ns/activitystreams", "https://w3id.org/security/v1"},
+		"id":                p.iri.String(),
+		"type":              "Person",
+		"preferredUsername": "peer",
+		"inbox":             p.iri.String() + "/inbox",
+		"outbox":            p.iri.String() + "/outbox",
+	}
+	if len(keys) == 1 {
+		m["publicKey"] = keys[0]
+	} else if len(keys) > 1 {
+		m["publicKey"] = keys
+	}
+	return m
+}
+
+func respondJSON(t testing.TB, transport *FakeTransport, iri string, m map[string]interface{}) {
+	t.Helper()
+	b, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport.Respond(mustParse(t, iri), b)
+}
+
+// newTestPeer makes up a peer at `iri` with a key of `keyType`, "rsa" or
+// "ed25519", whose document `transport` serves with the key in it.
+func newTestPeer(t testing.TB, transport *FakeTransport, iri, keyType string) *testPeer {
+	t.Helper()
+	p := &testPeer{iri: mustParse(t, iri), keyId: iri + "#main-key"}
+	switch keyType {
+	case "rsa":
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.key = key
+	case "ed25519":
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.key = key
+	}
+	respondJSON(t, transport, iri, p.actorDoc(p.publicKeyDoc(t, iri)))
+	return p
+}
+
+// signedDelivery returns a POST of `activity` to `inboxIRI`, signed by `p`
+// either the cavage way or the RFC 9421 way.
+func signedDelivery(t testing.TB, p *testPeer, inboxIRI *url.URL, activity map[string]interface{}, rfc9421 bool) *http.Request {
+	t.Helper()
+	body, err := json.Marshal(activity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := http.NewRequest(http.MethodPost, inboxIRI.String(), bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Content-Type", "application/activity+json")
+	r.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	if rfc9421 {
+		err = signRFC9421(r, body, p.key, p.keyId, time.Now())
+	} else {
+		var signer *cavageSigner
+		if signer, err = newCavageSigner(p.key, p.keyId); err == nil {
+			err = signer.sign(r, body)
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	// As the server sees it, with the host out of the headers.
+	r.Header.Del("Host")
+	return r
+}
+
+func followBy(actorIRI, objectIRI string) map[string]interface{} {
+	return map[string]interface{}{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id":       actorIRI + "/follows/1",
+		"type":     "Follow",
+		"actor":    actorIRI,
+		"object":   objectIRI,
+	}
+}
+
+func TestVerifyDeliveryRoundTrip(t *testing.T) {
+	for _, test := range []struct {
+		keyType string
+		rfc9421 bool
+	}{
+		{"rsa", false},
+		{"ed25519", false},
+		{"rsa", true},
+		{"ed25519", true},
+	} {
+		name := test.keyType + "/cavage"
+		if test.rfc9421 {
+			name = test.keyType + "/rfc9421"
+		}
+		t.Run(name, func(t *testing.T) {
+			c := context.Background()
+			s, transport := newTestService(t)
+			aliceIRI := register(t, s, "alice")
+			inboxIRI := s.boxIRI(aliceIRI, "inbox")
+			bob := newTestPeer(t, transport, "https://remote.test/users/bob", test.keyType)
+
+			r := signedDelivery(t, bob, inboxIRI, followBy(bob.iri.String(), aliceIRI.String()), test.rfc9421)
+			signer, ok := s.verifyDelivery(c, inboxIRI, r)
+			if !ok || signer == nil || signer.String() != bob.iri.String() {
+				t.Fatalf("verifyDelivery = %v, %t, want %s, true", signer, ok, bob.iri)
+			}
+
+			// Tampering with the body breaks the signature.
+			r = signedDelivery(t, bob, inboxIRI, followBy(bob.iri.String(), aliceIRI.String()), test.rfc9421)
+			tampered, _ := json.Marshal(followBy(bob.iri.String(), "https://mastogon.test/users/carol"))
+			r.Body = io.NopCloser(bytes.NewReader(tampered))
+			r.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(tampered)), nil }
+			if signer, ok := s.verifyDelivery(c, inboxIRI, r); ok {
+				t.Fatalf("verifyDelivery took a tampered delivery signed by %v", signer)
+			}
+		})
+	}
+}
+
+func TestVerifyDeliveryRefusesOthersActivities(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	inboxIRI := s.boxIRI(aliceIRI, "inbox")
+	newTestPeer(t, transport, "https://remote.test/users/bob", "rsa")
+	mallory := newTestPeer(t, transport, "https://evil.test/users/mallory", "rsa")
+
+	// Mallory signs, with her own key, a Follow saying it's Bob's.
+	r := signedDelivery(t, mallory, inboxIRI, followBy("https://remote.test/users/bob", aliceIRI.String()), false)
+	if signer, ok := s.verifyDelivery(c, inboxIRI, r); ok {
+		t.Fatalf("verifyDelivery took Bob's activity signed by %v", signer)
+	}
+}
+
+func TestFetchPublicKeyChecksOwner(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	inboxIRI := s.boxIRI(aliceIRI, "inbox")
+	bob := newTestPeer(t, transport, "https://remote.test/users/bob", "rsa")
+
+	t.Run("owner on another host", func(t *testing.T) {
+		mallory := newTestPeer(t, transport, "https://evil.test/users/mallory", "rsa")
+		// Mallory's document says her key is Bob's.
+		respondJSON(t, transport, mallory.iri.String(), mallory.actorDoc(mallory.publicKeyDoc(t, bob.iri.String())))
+		if _, err := s.fetchPublicKey(c, inboxIRI, mallory.keyId); err == nil {
+			t.Fatal("took a key owned by an actor on another host")
+		}
+	})
+
+	t.Run("key document the owner doesn't list", func(t *testing.T) {
+		other, _ := rsa.GenerateKey(rand.Reader, 2048)
+		stray := &testPeer{iri: bob.iri, keyId: "https://remote.test/keys/stray", key: other}
+		respondJSON(t, transport, stray.keyId, stray.keyDoc(t, bob.iri.String()))
+		if _, err := s.fetchPublicKey(c, inboxIRI, stray.keyId); err == nil {
+			t.Fatal("took a key its owner doesn't list")
+		}
+	})
+
+	t.Run("key document the owner lists", func(t *testing.T) {
+		key, _ := rsa.GenerateKey(rand.Reader, 2048)
+		carol := &testPeer{iri: mustParse(t, "https://remote.test/users/carol"), keyId: "https://remote.test/keys/carol", key: key}
+		respondJSON(t, transport, carol.keyId, carol.keyDoc(t, carol.iri.String()))
+		respondJSON(t, transport, carol.iri.String(), carol.actorDoc(carol.publicKeyDoc(t, carol.iri.String())))
+		rk, err := s.fetchPublicKey(c, inboxIRI, carol.keyId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rk.owner.String() != carol.iri.String() {
+			t.Errorf("owner = %s, want %s", rk.owner, carol.iri)
+		}
+	})
+}
+
+// countingTransport counts what's fetched through it, and holds fetches up
+// while `hold` is open.
+type countingTransport struct {
+	*FakeTransport
+	mu      sync.Mutex
+	fetches map[string]int
+	hold    chan struct{}
+}
+
+func (t *countingTransport) Dereference(c context.Context, iri *url.URL) ([]byte, error) {
+	t.mu.Lock()
+	if t.fetches == nil {
+		t.fetches = make(map[string]int)
+	}
+	t.fetches[withoutFragment(iri)]++
+	hold := t.hold
+	t.mu.Unlock()
+	if hold != nil {
+		<-hold
+	}
+	return t.FakeTransport.Dereference(c, iri)
+}
+
+// fetched returns how many times `iri` was fetched.
+func (t *countingTransport) fetched(iri *url.URL) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.fetches[withoutFragment(iri)]
+}
+
+// newKeyCacheTest returns a service fetching through a countingTransport,
+// its local actor's inbox, and a peer delivering to it.
+func newKeyCacheTest(t *testing.T) (*Service, *countingTransport, *url.URL, *testPeer) {
+	s, fake := newTestService(t)
+	transport := &countingTransport{FakeTransport: fake}
+	s.SetTransport(transport)
+	aliceIRI := register(t, s, "alice")
+	bob := newTestPeer(t, fake, "https://remote.test/users/bob", "rsa")
+	return s, transport, s.boxIRI(aliceIRI, "inbox"), bob
+}
+
+func TestPublicKeyCacheHit(t *testing.T) {
+	c := context.Background()
+	s, transport, inboxIRI, bob := newKeyCacheTest(t)
+	for i := 0; i < 3; i++ {
+		r := signedDelivery(t, bob, inboxIRI, followBy(bob.iri.String(), "https://mastogon.test/users/alice"), i%2 == 1)
+		if _, err := s.verifyRequest(c, inboxIRI, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := transport.fetched(bob.iri); n != 1 {
+		t.Errorf("fetched the key %d times, want once", n)
+	}
+}
+
+func TestPublicKeyRefetchedOnRotation(t *testing.T) {
+	c := context.Background()
+	s, transport, inboxIRI, bob := newKeyCacheTest(t)
+	clock := &testClock{now: time.Now()}
+	s.SetClock(clock)
+	follow := followBy(bob.iri.String(), "https://mastogon.test/users/alice")
+	if _, err := s.verifyRequest(c, inboxIRI, signedDelivery(t, bob, inboxIRI, follow, false)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Bob rotates his key, keeping its keyId, a while later.
+	clock.Advance(s.config.MinRefreshInterval)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob.key = key
+	respondJSON(t, transport.FakeTransport, bob.iri.String(), bob.actorDoc(bob.publicKeyDoc(t, bob.iri.String())))
+	if _, err := s.verifyRequest(c, inboxIRI, signedDelivery(t, bob, inboxIRI, follow, false)); err != nil {
+		t.Fatalf("a delivery signed with the rotated key: %s", err)
+	}
+	if n := transport.fetched(bob.iri); n != 2 {
+		t.Errorf("fetched the key %d times, want twice", n)
+	}
+	// The new key is cached in place of the old.
+	if _, err := s.verifyRequest(c, inboxIRI, signedDelivery(t, bob, inboxIRI, follow, true)); err != nil {
+		t.Fatal(err)
+	}
+	if n := transport.fetched(bob.iri); n != 2 {
+		t.Errorf("fetched the key %d times, want twice", n)
+	}
+
+	// A signature the refetched key doesn't verify either is refused.
+	clock.Advance(s.config.MinRefreshInterval)
+	mallory, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forger := &testPeer{iri: bob.iri, keyId: bob.keyId, key: mallory}
+	if _, err := s.verifyRequest(c, inboxIRI, signedDelivery(t, forger, inboxIRI, follow, false)); err == nil {
+		t.Error("took a signature made with another key")
+	}
+	if n := transport.fetched(bob.iri); n != 3 {
+		t.Errorf("fetched the key %d times, want it refetched once more", n)
+	}
+}
+
+func TestPublicKeyRefetchesThrottled(t *testing.T) {
+	c := context.Background()
+	s, transport, inboxIRI, bob := newKeyCacheTest(t)
+	clock := &testClock{now: time.Now()}
+	s.SetClock(clock)
+	follow := followBy(bob.iri.String(), "https://mastogon.test/users/alice")
+	if _, err := s.verifyRequest(c, inboxIRI, signedDelivery(t, bob, inboxIRI, follow, false)); err != nil {
+		t.Fatal(err)
+	}
+	mallory, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forger := &testPeer{iri: bob.iri, keyId: bob.keyId, key: mallory}
+
+	// Forged signatures coming in soon after we fetched the key don't get
+	// it fetched again.
+	clock.Advance(s.config.MinRefreshInterval / 2)
+	for i := 0; i < 3; i++ {
+		if _, err := s.verifyRequest(c, inboxIRI, signedDelivery(t, forger, inboxIRI, follow, i%2 == 1)); err == nil {
+			t.Error("took a signature made with another key")
+		}
+	}
+	if n := transport.fetched(bob.iri); n != 1 {
+		t.Errorf("fetched the key %d times, want once", n)
+	}
+
+	// Once the interval is up, a bad signature has it refetched, but only
+	// the once.
+	clock.Advance(s.config.MinRefreshInterval)
+	for i := 0; i < 2; i++ {
+		if _, err := s.verifyRequest(c, inboxIRI, signedDelivery(t, forger, inboxIRI, follow, false)); err == nil {
+			t.Error("took a signature made with another key")
+		}
+	}
+	if n := transport.fetched(bob.iri); n != 2 {
+		t.Errorf("fetched the key %d times, want twice", n)
+	}
+}
+
+func TestPublicKeyFetchesCoalesce(t *testing.T) {
+	c := context.Background()
+	s, transport, inboxIRI, bob := newKeyCacheTest(t)
+	hold := make(chan struct{})
+	transport.mu.Lock()
+	transport.hold = hold
+	transport.mu.Unlock()
+
+	const deliveries = 8
+	var wg sync.WaitGroup
+	for i := 0; i < deliveries; i++ {
+		r := signedDelivery(t, bob, inboxIRI, followBy(bob.iri.String(), "https://mastogon.test/users/alice"), false)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.verifyRequest(c, inboxIRI, r); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	// Let the first fetch start, and the rest catch up with it, before it
+	// finishes.
+	deadline := time.Now().Add(5 * time.Second)
+	for transport.fetched(bob.iri) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the key wasn't fetched")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(hold)
+	wg.Wait()
+	if n := transport.fetched(bob.iri); n != 1 {
+		t.Errorf("%d concurrent deliveries fetched the key %d times, want once", deliveries, n)
+	}
+}
+
+func TestSignaturesRequiredPerRoute(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	inboxIRI := s.boxIRI(aliceIRI, "inbox")
+	note, err := s.PostStatus(c, aliceIRI, StatusParams{Status: "hello", Visibility: VisibilityPublic})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob := newTestPeer(t, transport, "https://remote.test/users/bob", "rsa")
+	routes := map[string]string{
+		"actor":      aliceIRI.String(),
+		"note":       note.GetJSONLDId().Get().String(),
+		"collection": s.boxIRI(aliceIRI, "outbox").String(),
+	}
+
+	for _, test := range []struct {
+		name     string
+		config   func(*Config)
+		required map[string]bool
+	}{
+		{"none", func(config *Config) {}, map[string]bool{}},
+		{"deliveries", func(config *Config) { config.SignedDeliveries = true }, map[string]bool{"inbox": true}},
+		{"objects", func(config *Config) { config.AuthorizedFetch = true }, map[string]bool{"note": true, "collection": true}},
+		{"actors", func(config *Config) { config.SignedActorFetches = true }, map[string]bool{"actor": true}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			s.config.SignedDeliveries = false
+			s.config.AuthorizedFetch = false
+			s.config.SignedActorFetches = false
+			test.config(&s.config)
+
+			// Unsigned deliveries are only refused where they must be signed,
+			// and signed ones are taken regardless.
+			body, _ := json.Marshal(followBy(bob.iri.String(), aliceIRI.String()))
+			r, err := http.NewRequest(http.MethodPost, inboxIRI.String(), bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.Header.Set("Content-Type", "application/activity+json")
+			if _, ok := s.verifyDelivery(c, inboxIRI, r); ok == test.required["inbox"] {
+				t.Errorf("unsigned delivery taken: %t", ok)
+			}
+			r = signedDelivery(t, bob, inboxIRI, followBy(bob.iri.String(), aliceIRI.String()), false)
+			if signer, ok := s.verifyDelivery(c, inboxIRI, r); !ok || signer == nil {
+				t.Errorf("signed delivery taken: %v, %t", signer, ok)
+			}
+
+			for route, iri := range routes {
+				want := http.StatusOK
+				if test.required[route] {
+					want = http.StatusUnauthorized
+				}
+				w := httptest.NewRecorder()
+				s.ServeHTTP(w, signedFetch(t, nil, iri))
+				if w.Code != want {
+					t.Errorf("unsigned GET of the %s: %d, want %d", route, w.Code, want)
+				}
+				w = httptest.NewRecorder()
+				s.ServeHTTP(w, signedFetch(t, bob, iri))
+				if w.Code != http.StatusOK {
+					t.Errorf("signed GET of the %s: %d %s", route, w.Code, w.Body)
+				}
+			}
+		})
+	}
+}
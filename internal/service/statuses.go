@@ -0,0 +1,231 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"net/url"
+
+	"mastogon/internal/db"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// The special collection addressing everyone.
+var publicIRI, _ = url.Parse(pub.PublicActivityPubIRI)
+
+// StatusParams is what a local user supplies when posting a status.
+type StatusParams struct {
+	// The plain-text source of the status.
+	Status string
+	// The ISO 639-1 language the status is in. Empty means the author's
+	// default language.
+	Language string
+	// Who the status is for, one of the Visibility constants. Empty means
+	// the author's default.
+	Visibility string
+	// Whether the status is hidden behind a warning. Nil means the author's
+	// default.
+	Sensitive *bool
+	// The status this one quotes, if any.
+	Quote *url.URL
+}
+
+// validateStatus checks `params` against the instance's limits.
+func (s *Service) validateStatus(params StatusParams) error {
+	if NoteLength(params.Status) > s.config.MaxNoteChars {
+		return &ValidationError{fmt.Sprintf("Text character limit of %d exceeded", s.config.MaxNoteChars)}
+	}
+	if params.Visibility != "" && !isVisibility(params.Visibility) {
+		return &ValidationError{"Visibility is not included in the list"}
+	}
+	return nil
+}
+
+// PostStatus publishes a note authored by the local actor at `actorIRI`,
+// delivering it to their followers unless it's direct. What `params` leaves
+// out comes from the author's Preferences. The note is returned with the
+// `id` Go-Fed assigned it.
+func (s *Service) PostStatus(c context.Context,
+	actorIRI *url.URL,
+	params StatusParams) (vocab.ActivityStreamsNote, error) {
+	if err := s.validateStatus(params); err != nil {
+		return nil, err
+	}
+	t, err := s.db.Get(c, actorIRI)
+	if err != nil {
+		return nil, err
+	}
+	author, ok := db.ToActor(t)
+	if !ok {
+		return nil, errors.New("not a local actor")
+	}
+	outbox := author.GetActivityStreamsOutbox()
+	if outbox == nil {
+		return nil, errors.New("actor has no outbox")
+	}
+	outboxIRI, err := pub.ToId(outbox)
+	if err != nil {
+		return nil, err
+	}
+
+	prefs, err := s.Preferences(c, actorIRI)
+	if err != nil {
+		return nil, err
+	}
+	if params.Visibility == "" {
+		params.Visibility = prefs.Visibility
+	}
+	sensitive := prefs.Sensitive
+	if params.Sensitive != nil {
+		sensitive = *params.Sensitive
+	}
+
+	to := streams.NewActivityStreamsToProperty()
+	cc := streams.NewActivityStreamsCcProperty()
+	var followersIRI *url.URL
+	if f := author.GetActivityStreamsFollowers(); f != nil {
+		followersIRI, _ = pub.ToId(f)
+	}
+	switch params.Visibility {
+	case VisibilityPublic:
+		to.AppendIRI(publicIRI)
+		if followersIRI != nil {
+			cc.AppendIRI(followersIRI)
+		}
+	case VisibilityUnlisted:
+		if followersIRI != nil {
+			to.AppendIRI(followersIRI)
+		}
+		cc.AppendIRI(publicIRI)
+	case VisibilityPrivate:
+		if followersIRI != nil {
+			to.AppendIRI(followersIRI)
+		}
+	}
+	// Those mentioned get the status whoever else does, and are all a direct
+	// one is for.
+	mentions := s.mentioned(c, actorIRI, params.Status)
+	for _, m := range mentions {
+		if params.Visibility == VisibilityDirect {
+			to.AppendIRI(m.actorIRI)
+		} else {
+			cc.AppendIRI(m.actorIRI)
+		}
+	}
+	published := streams.NewActivityStreamsPublishedProperty()
+	published.Set(s.Now())
+
+	note := streams.NewActivityStreamsNote()
+	language := params.Language
+	if language == "" {
+		language = prefs.Language
+	}
+	rendered := "<p>" + html.EscapeString(params.Status) + "</p>"
+	if params.Quote != nil {
+		if err := s.checkQuotable(c, actorIRI, params.Quote); err != nil {
+			return nil, err
+		}
+		rendered += quoteInline(params.Quote)
+	}
+	content := streams.NewActivityStreamsContentProperty()
+	content.AppendXMLSchemaString(rendered)
+	if language != "" {
+		// Mastodon reads the language off the contentMap.
+		content.AppendRDFLangString(map[string]string{language: rendered})
+	}
+	note.SetActivityStreamsContent(content)
+	attributedTo := streams.NewActivityStreamsAttributedToProperty()
+	attributedTo.AppendIRI(actorIRI)
+	note.SetActivityStreamsAttributedTo(attributedTo)
+	note.SetActivityStreamsTo(to)
+	note.SetActivityStreamsCc(cc)
+	note.SetActivityStreamsPublished(published)
+	tags := streams.NewActivityStreamsTagProperty()
+	for _, m := range mentions {
+		tags.AppendActivityStreamsMention(newMention(m))
+	}
+	if params.Quote != nil {
+		tags.AppendActivityStreamsLink(newQuoteLink(params.Quote))
+	}
+	if tags.Len() > 0 {
+		note.SetActivityStreamsTag(tags)
+	}
+	if note, err = s.withHashtags(c, note, Hashtags(params.Status)); err != nil {
+		return nil, err
+	}
+	if sensitive {
+		t, err := extended(c, note, func(m map[string]interface{}) {
+			m["sensitive"] = true
+		})
+		if err != nil {
+			return nil, err
+		}
+		note = t.(vocab.ActivityStreamsNote)
+	}
+
+	create := streams.NewActivityStreamsCreate()
+	actor := streams.NewActivityStreamsActorProperty()
+	actor.AppendIRI(actorIRI)
+	create.SetActivityStreamsActor(actor)
+	object := streams.NewActivityStreamsObjectProperty()
+	object.AppendActivityStreamsNote(note)
+	create.SetActivityStreamsObject(object)
+	create.SetActivityStreamsTo(to)
+	create.SetActivityStreamsCc(cc)
+	create.SetActivityStreamsPublished(published)
+
+	// Go-Fed assigns the ids, stores the Create, adds it to the outbox, and
+	// delivers it. The Note is ours to store.
+	if _, err := s.actor.Send(c, outboxIRI, create); err != nil {
+		return nil, err
+	}
+	if err := s.storeCreated(c, create); err != nil {
+		return nil, err
+	}
+	s.emit(Event{Kind: EventStatusCreated, Activity: note, Actor: actorIRI})
+	return note, nil
+}
+
+// DeleteStatus deletes the status at `iri` by the local actor at `actorIRI`,
+// telling everyone it went to, and leaves a Tombstone in its place. The
+// status is returned as it was.
+func (s *Service) DeleteStatus(c context.Context, actorIRI, iri *url.URL) (vocab.Type, error) {
+	if err := s.checkOwned(c, iri, actorIRI); err != nil {
+		return nil, err
+	}
+	t, err := s.db.Get(c, iri)
+	if err != nil {
+		return nil, err
+	}
+	del := streams.NewActivityStreamsDelete()
+	actor := streams.NewActivityStreamsActorProperty()
+	actor.AppendIRI(actorIRI)
+	del.SetActivityStreamsActor(actor)
+	object := streams.NewActivityStreamsObjectProperty()
+	object.AppendActivityStreamsTombstone(s.newTombstone(iri, t))
+	del.SetActivityStreamsObject(object)
+	if o, ok := t.(interface {
+		GetActivityStreamsTo() vocab.ActivityStreamsToProperty
+	}); ok && o.GetActivityStreamsTo() != nil {
+		del.SetActivityStreamsTo(o.GetActivityStreamsTo())
+	}
+	if o, ok := t.(interface {
+		GetActivityStreamsCc() vocab.ActivityStreamsCcProperty
+	}); ok && o.GetActivityStreamsCc() != nil {
+		del.SetActivityStreamsCc(o.GetActivityStreamsCc())
+	}
+	if _, err := s.actor.Send(c, s.boxIRI(actorIRI, "outbox"), del); err != nil {
+		return nil, err
+	}
+	if err := s.bury(c, iri); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
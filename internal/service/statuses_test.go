@@ -0,0 +1,114 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"mastogon/internal/db"
+
+	"github.com/go-fed/activity/pub"
+)
+
+func TestPostStatusStoresNote(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	actorIRI := register(t, s, "alice")
+	respondLocally(t, s, transport, s.boxIRI(actorIRI, "followers"))
+	note, err := s.PostStatus(c, actorIRI, StatusParams{Status: "hello", Visibility: VisibilityPublic})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.db.Get(c, note.GetJSONLDId().Get())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.GetTypeName() != "Note" {
+		t.Errorf("stored a %s, want a Note", got.GetTypeName())
+	}
+}
+
+func TestPostStatusTooLong(t *testing.T) {
+	c := context.Background()
+	s, _ := newTestService(t)
+	actorIRI := register(t, s, "alice")
+	_, err := s.PostStatus(c, actorIRI, StatusParams{Status: strings.Repeat("a", s.config.MaxNoteChars+1)})
+	if err == nil {
+		t.Fatal("posted a note over the limit")
+	}
+}
+
+func TestDeletedStatusesGone(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	bobIRI := register(t, s, "bob")
+	s.db.SetToken("alice-token", aliceIRI)
+	respondLocally(t, s, transport, s.boxIRI(aliceIRI, "followers"))
+	carol := newTestPeer(t, transport, "https://remote.test/users/carol", "rsa")
+	follow(t, s, aliceIRI, carol.iri)
+	post := func() *url.URL {
+		t.Helper()
+		note, err := s.PostStatus(c, aliceIRI, StatusParams{Status: "hello", Visibility: VisibilityPublic})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return note.GetJSONLDId().Get()
+	}
+	// gone checks the status at `iri` is served as a Tombstone, with
+	// `code`.
+	gone := func(iri *url.URL, code int) {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodGet, iri.String(), nil)
+		r.Header.Set("Accept", "application/activity+json")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		var m map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &m); err != nil {
+			t.Fatal(err)
+		}
+		if w.Code != code || m["type"] != "Tombstone" || m["id"] != iri.String() || m["formerType"] != "Note" {
+			t.Errorf("GET %s: %d %s, want a Tombstone with %d", iri, w.Code, w.Body, code)
+		}
+	}
+
+	noteIRI := post()
+	if _, err := s.DeleteStatus(c, bobIRI, noteIRI); !errors.Is(err, db.ErrNotOwned) {
+		t.Errorf("bob deleting alice's status: %v", err)
+	}
+	before := len(transport.Delivered())
+	if _, err := s.DeleteStatus(c, aliceIRI, noteIRI); err != nil {
+		t.Fatal(err)
+	}
+	gone(noteIRI, http.StatusGone)
+	delivered := false
+	for _, d := range transport.Delivered()[before:] {
+		delivered = delivered || (d.To.String() == carol.iri.String()+"/inbox" && strings.Contains(string(d.Body), `"Delete"`))
+	}
+	if !delivered {
+		t.Error("the Delete wasn't delivered to alice's follower")
+	}
+	s.config.TombstonesGone = false
+	gone(noteIRI, http.StatusOK)
+	s.config.TombstonesGone = true
+
+	// Deleting through the outbox buries too.
+	noteIRI = post()
+	if w := postToOutbox(t, s, aliceIRI.String(), "alice-token", map[string]interface{}{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"type":     "Delete",
+		"object":   noteIRI.String(),
+		"to":       pub.PublicActivityPubIRI,
+	}); w.Code != http.StatusCreated {
+		t.Fatalf("deleting through the outbox: %d %s", w.Code, w.Body)
+	}
+	gone(noteIRI, http.StatusGone)
+}
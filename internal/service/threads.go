@@ -0,0 +1,168 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"net/url"
+	"sort"
+
+	"mastogon/internal/collections"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// inReplyTo returns what `t` replies to, if anything.
+func inReplyTo(t vocab.Type) *url.URL {
+	if o, ok := t.(interface {
+		GetActivityStreamsInReplyTo() vocab.ActivityStreamsInReplyToProperty
+	}); ok && o.GetActivityStreamsInReplyTo() != nil {
+		prop := o.GetActivityStreamsInReplyTo()
+		for iter := prop.Begin(); iter != prop.End(); iter = iter.Next() {
+			if id, err := pub.ToId(iter); err == nil {
+				return id
+			}
+		}
+	}
+	return nil
+}
+
+// Context returns the thread around the object at `iri`: what it replies to,
+// oldest first, and the replies to it, each followed by its own replies.
+//
+// Ancestors we don't have are fetched on behalf of `viewerIRI`, if there is
+// one, and so are the replies a remote status's `replies` collection lists
+// that we don't have, up to Config.MaxContextFetches fetches in all. Neither
+// direction goes more than Config.MaxContextDepth deep, and loops are cut.
+func (s *Service) Context(c context.Context,
+	viewerIRI *url.URL,
+	iri *url.URL) (ancestors, descendants []vocab.Type, err error) {
+	t, err := s.db.Get(c, iri)
+	if err != nil {
+		return nil, nil, ErrNotFound
+	}
+	seen := map[string]bool{iri.String(): true}
+
+	fetches := 0
+	for parentIRI := inReplyTo(t); parentIRI != nil && len(ancestors) < s.config.MaxContextDepth; {
+		if seen[parentIRI.String()] {
+			break
+		}
+		seen[parentIRI.String()] = true
+		parent, err := s.db.Get(c, parentIRI)
+		if err != nil {
+			if viewerIRI == nil || fetches >= s.config.MaxContextFetches {
+				break
+			}
+			fetches++
+			if parent, err = s.RefreshObject(c, viewerIRI, parentIRI); err != nil {
+				break
+			}
+		}
+		ancestors = append(ancestors, parent)
+		parentIRI = inReplyTo(parent)
+	}
+	// Walked from the status up, but shown from the top down.
+	for i, j := 0, len(ancestors)-1; i < j; i, j = i+1, j-1 {
+		ancestors[i], ancestors[j] = ancestors[j], ancestors[i]
+	}
+
+	if viewerIRI != nil {
+		s.fetchReplies(c, viewerIRI, t, &fetches)
+	}
+	index, err := s.db.ReplyIndex(c)
+	if err != nil {
+		return nil, nil, err
+	}
+	var walk func(parentIRI *url.URL, depth int)
+	walk = func(parentIRI *url.URL, depth int) {
+		if depth > s.config.MaxContextDepth {
+			return
+		}
+		var replies []vocab.Type
+		for _, replyIRI := range index[parentIRI.String()] {
+			if seen[replyIRI.String()] {
+				continue
+			}
+			seen[replyIRI.String()] = true
+			if reply, err := s.db.Get(c, replyIRI); err == nil {
+				replies = append(replies, reply)
+			}
+		}
+		sort.SliceStable(replies, func(i, j int) bool {
+			return published(replies[i]).Before(published(replies[j]))
+		})
+		for _, reply := range replies {
+			descendants = append(descendants, reply)
+			if replyIRI, err := pub.GetId(reply); err == nil {
+				walk(replyIRI, depth+1)
+			}
+		}
+	}
+	walk(iri, 1)
+	return s.visible(c, ancestors), s.visible(c, descendants), nil
+}
+
+// fetchReplies stores the replies listed in the `replies` collection of the
+// remote status `t` that we don't have, fetching them, and the collection's
+// pages, on behalf of the local actor at `viewerIRI`. It stops once
+// `fetches` reaches Config.MaxContextFetches. Replies embedded in the
+// collection are only taken as they are from the status's own host.
+func (s *Service) fetchReplies(c context.Context, viewerIRI *url.URL, t vocab.Type, fetches *int) {
+	o, ok := t.(interface {
+		GetActivityStreamsReplies() vocab.ActivityStreamsRepliesProperty
+	})
+	if !ok || o.GetActivityStreamsReplies() == nil {
+		return
+	}
+	id, err := pub.GetId(t)
+	if err != nil {
+		return
+	}
+	if owns, err := s.db.Owns(c, id); err != nil || owns {
+		return
+	}
+	repliesIRI, err := pub.ToId(o.GetActivityStreamsReplies())
+	if err != nil {
+		return
+	}
+	fetch := func(c context.Context, iri *url.URL) (vocab.Type, error) {
+		if *fetches >= s.config.MaxContextFetches {
+			return nil, collections.ErrStop
+		}
+		*fetches++
+		return s.fetch(c, viewerIRI, iri)
+	}
+	collections.Walk(c, s.db, fetch, repliesIRI, func(item pub.IdProperty) error {
+		replyIRI, err := pub.ToId(item)
+		if err != nil {
+			return nil
+		}
+		if exists, err := s.db.Exists(c, replyIRI); err != nil || exists {
+			return nil
+		}
+		if reply := item.GetType(); reply != nil && replyIRI.Host == id.Host {
+			s.storeFetched(c, reply)
+			return nil
+		}
+		if *fetches >= s.config.MaxContextFetches {
+			return collections.ErrStop
+		}
+		*fetches++
+		s.RefreshObject(c, viewerIRI, replyIRI)
+		return nil
+	})
+}
+
+// visible drops from `objects` those by blocked actors.
+func (s *Service) visible(c context.Context, objects []vocab.Type) []vocab.Type {
+	kept := objects[:0]
+	for _, o := range objects {
+		if blocked, _ := s.Blocked(c, authorsOf(o)); !blocked {
+			kept = append(kept, o)
+		}
+	}
+	return kept
+}
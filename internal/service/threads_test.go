@@ -0,0 +1,193 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// storeReply stores a note at `id` replying to `parent`, if that isn't
+// empty, published at `published`.
+func storeReply(t *testing.T, s *Service, id, parent, published string) {
+	t.Helper()
+	m := postBy("Note", id, "https://remote.test/users/bob", "https://remote.test/users/bob/followers")
+	m["@context"] = "https://www.w3.org/ns/activitystreams"
+	m["published"] = published
+	if parent != "" {
+		m["inReplyTo"] = parent
+	}
+	note, err := streams.ToType(context.Background(), m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.db.Create(context.Background(), note); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// idsOf returns the ids of `objects`, in order.
+func idsOf(objects []vocab.Type) []string {
+	var ids []string
+	for _, o := range objects {
+		if id, err := pub.GetId(o); err == nil {
+			ids = append(ids, id.String())
+		}
+	}
+	return ids
+}
+
+func TestContext(t *testing.T) {
+	c := context.Background()
+	s, fake := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	const n = "https://remote.test/notes/"
+	// 1 ─┬─ 2 ── 3 ─┬─ 5 ── 7
+	//    │          └─ 6
+	//    └─ 4
+	storeReply(t, s, n+"1", n+"0", "2026-10-16T12:01:00Z")
+	storeReply(t, s, n+"2", n+"1", "2026-10-16T12:02:00Z")
+	storeReply(t, s, n+"3", n+"2", "2026-10-16T12:03:00Z")
+	storeReply(t, s, n+"4", n+"1", "2026-10-16T12:04:00Z")
+	storeReply(t, s, n+"6", n+"3", "2026-10-16T12:06:00Z")
+	storeReply(t, s, n+"5", n+"3", "2026-10-16T12:05:00Z")
+	storeReply(t, s, n+"7", n+"5", "2026-10-16T12:07:00Z")
+	root := postBy("Note", n+"0", "https://remote.test/users/bob", aliceIRI.String())
+	root["@context"] = "https://www.w3.org/ns/activitystreams"
+	respondJSON(t, fake, n+"0", root)
+
+	// Without a viewer to fetch it for, the thread stops at what we have.
+	ancestors, descendants, err := s.Context(c, nil, mustParse(t, n+"3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := idsOf(ancestors), []string{n + "1", n + "2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ancestors %v, want %v", got, want)
+	}
+	if got, want := idsOf(descendants), []string{n + "5", n + "7", n + "6"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("descendants %v, want %v", got, want)
+	}
+
+	// Nor when it may fetch nothing.
+	s.config.MaxContextFetches = 0
+	if ancestors, _, err = s.Context(c, aliceIRI, mustParse(t, n+"3")); err != nil {
+		t.Fatal(err)
+	}
+	if len(ancestors) != 2 {
+		t.Errorf("ancestors %v without fetches, want 2", idsOf(ancestors))
+	}
+
+	// The missing root is fetched for alice.
+	s.config.MaxContextFetches = 1
+	if ancestors, _, err = s.Context(c, aliceIRI, mustParse(t, n+"3")); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := idsOf(ancestors), []string{n + "0", n + "1", n + "2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ancestors %v after fetching, want %v", got, want)
+	}
+
+	s.config.MaxContextDepth = 1
+	if ancestors, descendants, err = s.Context(c, nil, mustParse(t, n+"3")); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := idsOf(ancestors), []string{n + "2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ancestors %v with a depth of 1, want %v", got, want)
+	}
+	if got, want := idsOf(descendants), []string{n + "5", n + "6"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("descendants %v with a depth of 1, want %v", got, want)
+	}
+
+	if _, _, err := s.Context(c, nil, mustParse(t, n+"8")); err != ErrNotFound {
+		t.Errorf("context of a note we don't have: %v", err)
+	}
+}
+
+func TestContextLoop(t *testing.T) {
+	s, _ := newTestService(t)
+	const n = "https://remote.test/notes/"
+	storeReply(t, s, n+"1", n+"2", "2026-10-16T12:01:00Z")
+	storeReply(t, s, n+"2", n+"1", "2026-10-16T12:02:00Z")
+	ancestors, descendants, err := s.Context(context.Background(), nil, mustParse(t, n+"1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := idsOf(ancestors), []string{n + "2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ancestors %v, want %v", got, want)
+	}
+	if len(descendants) != 0 {
+		t.Errorf("descendants %v, want none", idsOf(descendants))
+	}
+}
+
+func TestContextFetchesReplies(t *testing.T) {
+	c := context.Background()
+	s, fake := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	const n = "https://remote.test/notes/"
+	// As Mastodon serves them, the first page of replies inline.
+	root := postBy("Note", n+"0", "https://remote.test/users/bob", aliceIRI.String())
+	root["@context"] = "https://www.w3.org/ns/activitystreams"
+	root["replies"] = map[string]interface{}{
+		"id":   n + "0/replies",
+		"type": "Collection",
+		"first": map[string]interface{}{
+			"id":    n + "0/replies?page=1",
+			"type":  "CollectionPage",
+			"items": []interface{}{n + "1"},
+			"next":  n + "0/replies?page=2",
+		},
+	}
+	respondJSON(t, fake, n+"0", root)
+	replies := root["replies"].(map[string]interface{})
+	respondJSON(t, fake, n+"0/replies", map[string]interface{}{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id":       replies["id"],
+		"type":     replies["type"],
+		"first":    replies["first"],
+	})
+	respondJSON(t, fake, n+"0/replies?page=2", map[string]interface{}{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id":       n + "0/replies?page=2",
+		"type":     "CollectionPage",
+		"items": []interface{}{
+			// Embedded replies are taken from the status's own host only.
+			map[string]interface{}{
+				"id":        n + "2",
+				"type":      "Note",
+				"inReplyTo": n + "0",
+				"published": "2026-10-16T12:02:00Z",
+			},
+			map[string]interface{}{
+				"id":        "https://elsewhere.test/notes/3",
+				"type":      "Note",
+				"inReplyTo": n + "0",
+				"content":   "<p>forged</p>",
+			},
+		},
+	})
+	reply := postBy("Note", n+"1", "https://remote.test/users/carol", aliceIRI.String())
+	reply["@context"] = "https://www.w3.org/ns/activitystreams"
+	reply["inReplyTo"] = n + "0"
+	reply["published"] = "2026-10-16T12:01:00Z"
+	respondJSON(t, fake, n+"1", reply)
+	if _, err := s.RefreshObject(c, aliceIRI, mustParse(t, n+"0")); err != nil {
+		t.Fatal(err)
+	}
+
+	_, descendants, err := s.Context(c, aliceIRI, mustParse(t, n+"0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := idsOf(descendants), []string{n + "1", n + "2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("descendants %v, want %v", got, want)
+	}
+	if exists, _ := s.db.Exists(c, mustParse(t, "https://elsewhere.test/notes/3")); exists {
+		t.Error("stored a reply embedded by another host as it came")
+	}
+}
@@ -0,0 +1,269 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/url"
+	"sort"
+	"time"
+
+	"mastogon/internal/db"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// The object types we know how to present as statuses. Mastodon itself only
+// speaks Note, but peers like PeerTube and WriteFreely send the others.
+var statusTypes = map[string]bool{
+	"Note":     true,
+	"Article":  true,
+	"Page":     true,
+	"Video":    true,
+	"Audio":    true,
+	"Image":    true,
+	"Event":    true,
+	"Question": true,
+}
+
+// IsSupportedStatus reports whether `t` is a type we present as a status.
+// Objects of other types are still stored and shown, but flagged so clients
+// know they might be missing something.
+func IsSupportedStatus(t vocab.Type) bool {
+	return statusTypes[t.GetTypeName()]
+}
+
+// HomeTimeline returns up to `limit` of the objects created by or delivered
+// to the local actor at `actorIRI` and published within `tr`, newest first.
+func (s *Service) HomeTimeline(c context.Context,
+	actorIRI *url.URL,
+	tr TimeRange,
+	limit int) ([]vocab.Type, error) {
+	return s.timeline(c, actorIRI, tr, limit, func(vocab.Type) bool { return true })
+}
+
+// timeline returns up to `limit` of the objects created by or delivered to
+// the local actor at `actorIRI`, published within `tr`, that `keep` keeps,
+// newest first. Those the actor's irreversible home filters match are
+// dropped.
+//
+// The activities bringing them are gone through newest first, as the
+// database's index of when things were published has them, and only until
+// there are enough.
+func (s *Service) timeline(c context.Context,
+	actorIRI *url.URL,
+	tr TimeRange,
+	limit int,
+	keep func(vocab.Type) bool) ([]vocab.Type, error) {
+	t, err := s.db.Get(c, actorIRI)
+	if err != nil {
+		return nil, err
+	}
+	actor, ok := db.ToActor(t)
+	if !ok {
+		return nil, errors.New("not a local actor")
+	}
+	var boxes []*url.URL
+	if inbox := actor.GetActivityStreamsInbox(); inbox != nil {
+		if id, err := pub.ToId(inbox); err == nil {
+			boxes = append(boxes, id)
+		}
+	}
+	if outbox := actor.GetActivityStreamsOutbox(); outbox != nil {
+		if id, err := pub.ToId(outbox); err == nil {
+			boxes = append(boxes, id)
+		}
+	}
+	var items []*url.URL
+	for _, box := range boxes {
+		boxItems, _, err := s.collectionItems(c, box)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, boxItems...)
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return s.db.Published(items[i]).After(s.db.Published(items[j]))
+	})
+	seen := make(map[string]bool)
+	var objects []vocab.Type
+	for _, item := range items {
+		if len(objects) >= limit {
+			break
+		}
+		// What was sent before the range can't have created anything in
+		// it, and isn't worth getting.
+		if p := s.db.Published(item); !tr.Since.IsZero() && !p.IsZero() && p.Before(tr.Since) {
+			continue
+		}
+		for _, o := range s.createdObjects(c, item) {
+			id, err := pub.GetId(o)
+			if err != nil || seen[id.String()] {
+				continue
+			}
+			seen[id.String()] = true
+			if !tr.Contains(published(o)) || !keep(o) {
+				continue
+			}
+			if blocked, _ := s.Blocked(c, authorsOf(o)); blocked {
+				continue
+			}
+			if dropped(s.FiltersMatching(c, actorIRI, "home", o)) {
+				continue
+			}
+			objects = append(objects, o)
+		}
+	}
+	sort.SliceStable(objects, func(i, j int) bool {
+		return published(objects[i]).After(published(objects[j]))
+	})
+	if len(objects) > limit {
+		objects = objects[:limit]
+	}
+	return objects, nil
+}
+
+// createdObjects returns the objects of the activity at `id` if it is a
+// Create, or a group's Announce of one, as we have them stored. Those deleted
+// since are left out, the copies embedded in the activity being as they were
+// when it was sent.
+func (s *Service) createdObjects(c context.Context, id *url.URL) []vocab.Type {
+	t, err := s.db.Get(c, id)
+	if err != nil {
+		return nil
+	}
+	switch a := t.(type) {
+	case vocab.ActivityStreamsCreate:
+		return s.activityObjects(c, a.GetActivityStreamsObject())
+	case vocab.ActivityStreamsAnnounce:
+		if !s.byGroup(c, a) {
+			return nil
+		}
+		// Lemmy communities announce the Creates of their members'
+		// posts, though some group implementations announce the posts
+		// themselves.
+		var objects []vocab.Type
+		for _, create := range s.announcedCreates(c, a) {
+			objects = append(objects, s.activityObjects(c, create.GetActivityStreamsObject())...)
+		}
+		for _, o := range s.activityObjects(c, a.GetActivityStreamsObject()) {
+			if IsSupportedStatus(o) {
+				objects = append(objects, o)
+			}
+		}
+		return objects
+	}
+	return nil
+}
+
+// announcedCreates returns the Creates `a` announces, whether embedded in it
+// or stored. We don't store those embedded, the posts they create being
+// what's shown.
+func (s *Service) announcedCreates(c context.Context, a vocab.ActivityStreamsAnnounce) (creates []vocab.ActivityStreamsCreate) {
+	prop := a.GetActivityStreamsObject()
+	if prop == nil {
+		return nil
+	}
+	for iter := prop.Begin(); iter != prop.End(); iter = iter.Next() {
+		if create, ok := iter.GetType().(vocab.ActivityStreamsCreate); ok {
+			creates = append(creates, create)
+		} else if iter.IsIRI() {
+			if t, err := s.db.Get(c, iter.GetIRI()); err == nil {
+				if create, ok := t.(vocab.ActivityStreamsCreate); ok {
+					creates = append(creates, create)
+				}
+			}
+		}
+	}
+	return
+}
+
+// activityObjects returns the objects in `prop` as we have them stored,
+// whether embedded or given by IRI, leaving out those we don't have or that
+// have been deleted.
+func (s *Service) activityObjects(c context.Context, prop vocab.ActivityStreamsObjectProperty) (objects []vocab.Type) {
+	if prop == nil {
+		return nil
+	}
+	for iter := prop.Begin(); iter != prop.End(); iter = iter.Next() {
+		id, err := pub.ToId(iter)
+		if err != nil {
+			continue
+		}
+		if o, err := s.db.Get(c, id); err == nil && o.GetTypeName() != "Tombstone" {
+			objects = append(objects, o)
+		}
+	}
+	return
+}
+
+// announced runs after Go-Fed's default handling of an Announce. A group's
+// Announces are how its members' posts reach us, and Go-Fed stores none of
+// what's announced. We fetch the posts from where they were published, rather
+// than take the group's word for them, so they're in the timeline and leave
+// it when their authors delete them.
+func (s *Service) announced(c context.Context, a vocab.ActivityStreamsAnnounce) error {
+	s.received(a)
+	if !s.byGroup(c, a) {
+		return nil
+	}
+	creates := make(map[string]bool)
+	var posts []*url.URL
+	for _, create := range s.announcedCreates(c, a) {
+		if id, err := pub.GetId(create); err == nil {
+			creates[id.String()] = true
+		}
+		posts = append(posts, objectsOf(create)...)
+	}
+	for _, id := range objectsOf(a) {
+		if !creates[id.String()] {
+			posts = append(posts, id)
+		}
+	}
+	for _, post := range posts {
+		if exists, err := s.db.Exists(c, post); err != nil || exists {
+			continue
+		}
+		if _, err := s.RefreshObject(c, s.instanceActorIRI(), post); err != nil {
+			log.Printf("fetching %s announced by %v: %v", post, authorsOf(a), err)
+		}
+	}
+	return nil
+}
+
+// byGroup reports whether the activity `a` is performed by a Group, such as
+// a Lemmy community, relaying its members' posts to its followers.
+func (s *Service) byGroup(c context.Context, a vocab.Type) bool {
+	for _, actorIRI := range authorsOf(a) {
+		if t, err := s.db.Get(c, actorIRI); err == nil && t.GetTypeName() == "Group" {
+			return true
+		}
+	}
+	return false
+}
+
+// published returns when `t` was published, or the zero time if it doesn't
+// say.
+func published(t vocab.Type) time.Time {
+	if o, ok := t.(interface {
+		GetActivityStreamsPublished() vocab.ActivityStreamsPublishedProperty
+	}); ok && o.GetActivityStreamsPublished() != nil {
+		return o.GetActivityStreamsPublished().Get()
+	}
+	return time.Time{}
+}
+
+// dropped reports whether any of `filters` drops what it matches rather than
+// marking it.
+func dropped(filters []*db.Filter) bool {
+	for _, f := range filters {
+		if f.Irreversible {
+			return true
+		}
+	}
+	return false
+}
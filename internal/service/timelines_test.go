@@ -0,0 +1,190 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"math"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// deliver has `p` deliver `activity` to `inboxIRI` on `s`, failing the test
+// if it's refused.
+func deliver(t testing.TB, s *Service, p *testPeer, inboxIRI *url.URL, activity map[string]interface{}) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, signedDelivery(t, p, inboxIRI, activity, false))
+	if w.Code < 200 || w.Code >= 300 {
+		t.Fatalf("delivering %v: %d %s", activity["id"], w.Code, w.Body)
+	}
+}
+
+// postBy returns an object of `objectType` by `actorIRI`, at `id` and
+// addressed to `to`.
+func postBy(objectType, id, actorIRI, to string) map[string]interface{} {
+	return map[string]interface{}{
+		"id":           id,
+		"type":         objectType,
+		"attributedTo": actorIRI,
+		"content":      "<p>hello</p>",
+		"published":    "2026-10-16T12:00:00Z",
+		"to":           []interface{}{pub.PublicActivityPubIRI, to},
+	}
+}
+
+// creating returns the Create of `object` by its author.
+func creating(object map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id":       object["id"].(string) + "/activity",
+		"type":     "Create",
+		"actor":    object["attributedTo"],
+		"to":       object["to"],
+		"object":   object,
+	}
+}
+
+// deleting returns the Delete of the object at `id` by `actorIRI`.
+func deleting(actorIRI, id string) map[string]interface{} {
+	return map[string]interface{}{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id":       id + "#delete",
+		"type":     "Delete",
+		"actor":    actorIRI,
+		"to":       pub.PublicActivityPubIRI,
+		"object":   id,
+	}
+}
+
+// typesOf returns the ids and types of `objects`.
+func typesOf(objects []vocab.Type) map[string]string {
+	types := make(map[string]string)
+	for _, o := range objects {
+		if id, err := pub.GetId(o); err == nil {
+			types[id.String()] = o.GetTypeName()
+		}
+	}
+	return types
+}
+
+func TestHomeTimelineObjectTypes(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	inboxIRI := s.boxIRI(aliceIRI, "inbox")
+	bob := newTestPeer(t, transport, "https://remote.test/users/bob", "rsa")
+
+	deliver(t, s, bob, inboxIRI, creating(postBy("Article", "https://remote.test/articles/1", bob.iri.String(), aliceIRI.String())))
+	deliver(t, s, bob, inboxIRI, creating(postBy("Video", "https://remote.test/videos/1", bob.iri.String(), aliceIRI.String())))
+	deliver(t, s, bob, inboxIRI, creating(postBy("Note", "https://remote.test/notes/1", bob.iri.String(), aliceIRI.String())))
+
+	home, err := s.HomeTimeline(c, aliceIRI, TimeRange{}, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"https://remote.test/articles/1": "Article",
+		"https://remote.test/videos/1":   "Video",
+		"https://remote.test/notes/1":    "Note",
+	}
+	if got := typesOf(home); !reflect.DeepEqual(got, want) {
+		t.Errorf("home timeline %v, want %v", got, want)
+	}
+	for _, o := range home {
+		if !IsSupportedStatus(o) {
+			t.Errorf("%s isn't supported", o.GetTypeName())
+		}
+	}
+}
+
+func TestHomeTimelineLeavesOutDeleted(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	inboxIRI := s.boxIRI(aliceIRI, "inbox")
+	bob := newTestPeer(t, transport, "https://remote.test/users/bob", "rsa")
+	kept := postBy("Note", "https://remote.test/notes/1", bob.iri.String(), aliceIRI.String())
+	deleted := postBy("Note", "https://remote.test/notes/2", bob.iri.String(), aliceIRI.String())
+	deliver(t, s, bob, inboxIRI, creating(kept))
+	deliver(t, s, bob, inboxIRI, creating(deleted))
+	deliver(t, s, bob, inboxIRI, deleting(bob.iri.String(), "https://remote.test/notes/2"))
+
+	want := map[string]string{"https://remote.test/notes/1": "Note"}
+	home, err := s.HomeTimeline(c, aliceIRI, TimeRange{}, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := typesOf(home); !reflect.DeepEqual(got, want) {
+		t.Errorf("home timeline %v, want %v", got, want)
+	}
+}
+
+func TestGroupAnnounces(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	inboxIRI := s.boxIRI(aliceIRI, "inbox")
+	group := newTestPeer(t, transport, "https://lemmy.test/c/retro", "rsa")
+	groupDoc := group.actorDoc(group.publicKeyDoc(t, group.iri.String()))
+	groupDoc["type"] = "Group"
+	respondJSON(t, transport, group.iri.String(), groupDoc)
+	if _, err := s.RefreshObject(c, aliceIRI, group.iri); err != nil {
+		t.Fatal(err)
+	}
+	tinker := newTestPeer(t, transport, "https://lemmy.test/u/tinker", "rsa")
+
+	page := postBy("Page", "https://lemmy.test/post/1", tinker.iri.String(), group.iri.String())
+	page["@context"] = "https://www.w3.org/ns/activitystreams"
+	respondJSON(t, transport, "https://lemmy.test/post/1", page)
+	// The group's copy isn't what's shown: the post is fetched from where
+	// it was published.
+	forged := postBy("Page", "https://lemmy.test/post/1", tinker.iri.String(), group.iri.String())
+	forged["content"] = "<p>not what tinker wrote</p>"
+	announce := func(id string, object interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"@context": "https://www.w3.org/ns/activitystreams",
+			"id":       id,
+			"type":     "Announce",
+			"actor":    group.iri.String(),
+			"to":       []interface{}{pub.PublicActivityPubIRI, aliceIRI.String()},
+			"object":   object,
+		}
+	}
+	deliver(t, s, group, inboxIRI, announce("https://lemmy.test/activities/announce/1", creating(forged)))
+
+	home, err := s.HomeTimeline(c, aliceIRI, TimeRange{}, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := typesOf(home), map[string]string{"https://lemmy.test/post/1": "Page"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("home timeline %v, want %v", got, want)
+	}
+	if m, err := streams.Serialize(home[0]); err != nil || m["content"] != "<p>hello</p>" {
+		t.Errorf("showing %v, want the post as published", m["content"])
+	}
+
+	// Someone else's Announces of the same aren't unwrapped.
+	bob := newTestPeer(t, transport, "https://remote.test/users/bob", "rsa")
+	other := postBy("Page", "https://lemmy.test/post/2", tinker.iri.String(), group.iri.String())
+	other["@context"] = "https://www.w3.org/ns/activitystreams"
+	respondJSON(t, transport, "https://lemmy.test/post/2", other)
+	boosted := announce("https://remote.test/announces/1", creating(other))
+	boosted["actor"] = bob.iri.String()
+	deliver(t, s, bob, inboxIRI, boosted)
+	if exists, _ := s.db.Exists(c, mustParse(t, "https://lemmy.test/post/2")); exists {
+		t.Error("fetched what a Person announced")
+	}
+
+	deliver(t, s, tinker, inboxIRI, deleting(tinker.iri.String(), "https://lemmy.test/post/1"))
+	if home, err = s.HomeTimeline(c, aliceIRI, TimeRange{}, math.MaxInt); err != nil || len(home) != 0 {
+		t.Errorf("home timeline %v after the post was deleted, %v", typesOf(home), err)
+	}
+}
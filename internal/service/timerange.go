@@ -0,0 +1,98 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// The widest a TimeRange closed at both ends may be, so a single request
+// can't have us sift through everything there is.
+const maxTimeRange = 366 * 24 * time.Hour
+
+// TimeRange picks out what was published from Since up to, but not
+// including, Until. Either end may be zero, leaving the range open there.
+type TimeRange struct {
+	Since time.Time
+	Until time.Time
+}
+
+// ParseTimeRange reads the TimeRange from `since` to `until`, each an RFC
+// 3339 time or empty.
+func ParseTimeRange(since, until string) (TimeRange, error) {
+	var tr TimeRange
+	var err error
+	if since != "" {
+		if tr.Since, err = time.Parse(time.RFC3339, since); err != nil {
+			return tr, &ValidationError{"Since must be an RFC 3339 time"}
+		}
+	}
+	if until != "" {
+		if tr.Until, err = time.Parse(time.RFC3339, until); err != nil {
+			return tr, &ValidationError{"Until must be an RFC 3339 time"}
+		}
+	}
+	if !tr.Since.IsZero() && !tr.Until.IsZero() {
+		if !tr.Until.After(tr.Since) {
+			return tr, &ValidationError{"Until must be after since"}
+		}
+		if tr.Until.Sub(tr.Since) > maxTimeRange {
+			return tr, &ValidationError{"The time range can span a year at most"}
+		}
+	}
+	return tr, nil
+}
+
+// IsZero reports whether `tr` is open at both ends, and so keeps everything.
+func (tr TimeRange) IsZero() bool {
+	return tr.Since.IsZero() && tr.Until.IsZero()
+}
+
+// Contains reports whether `t` is within `tr`. Unless `tr` is open at both
+// ends, the zero time, for what doesn't say when it was published, isn't.
+func (tr TimeRange) Contains(t time.Time) bool {
+	if tr.IsZero() {
+		return true
+	}
+	if t.IsZero() {
+		return false
+	}
+	return !t.Before(tr.Since) && (tr.Until.IsZero() || t.Before(tr.Until))
+}
+
+// query returns `tr` as the query parameters it's read from.
+func (tr TimeRange) query() url.Values {
+	q := make(url.Values)
+	if !tr.Since.IsZero() {
+		q.Set("since", tr.Since.Format(time.RFC3339))
+	}
+	if !tr.Until.IsZero() {
+		q.Set("until", tr.Until.Format(time.RFC3339))
+	}
+	return q
+}
+
+// requestedTimeRange returns the TimeRange the `since` and `until` query
+// parameters of `r` ask for.
+func requestedTimeRange(r *http.Request) (TimeRange, error) {
+	return ParseTimeRange(r.URL.Query().Get("since"), r.URL.Query().Get("until"))
+}
+
+// itemsWithin returns those of the collection `items` published within
+// `tr`, in the order they come in, going by the database's index of when
+// things were published.
+func (s *Service) itemsWithin(items []*url.URL, tr TimeRange) []*url.URL {
+	if tr.IsZero() {
+		return items
+	}
+	var within []*url.URL
+	for _, item := range items {
+		if tr.Contains(s.db.Published(item)) {
+			within = append(within, item)
+		}
+	}
+	return within
+}
@@ -0,0 +1,142 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseTimeRange(t *testing.T) {
+	since := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		name, since, until string
+		want               TimeRange
+		invalid            bool
+	}{
+		{"open", "", "", TimeRange{}, false},
+		{"open until", "2026-10-01T00:00:00Z", "", TimeRange{Since: since}, false},
+		{"open since", "", "2026-10-01T00:00:00Z", TimeRange{Until: since}, false},
+		{"closed", "2026-10-01T00:00:00Z", "2026-10-02T00:00:00Z", TimeRange{since, since.Add(24 * time.Hour)}, false},
+		{"a year", "2026-10-01T00:00:00Z", "2027-10-01T00:00:00Z", TimeRange{since, since.AddDate(1, 0, 0)}, false},
+		{"not RFC 3339", "2026-10-01", "", TimeRange{}, true},
+		{"until not RFC 3339", "", "yesterday", TimeRange{}, true},
+		{"until before since", "2026-10-02T00:00:00Z", "2026-10-01T00:00:00Z", TimeRange{}, true},
+		{"empty", "2026-10-01T00:00:00Z", "2026-10-01T00:00:00Z", TimeRange{}, true},
+		{"over a year", "2026-10-01T00:00:00Z", "2027-10-03T00:00:00Z", TimeRange{}, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			tr, err := ParseTimeRange(test.since, test.until)
+			var invalid *ValidationError
+			if test.invalid {
+				if !errors.As(err, &invalid) {
+					t.Errorf("error %v, want a ValidationError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tr.Since.Equal(test.want.Since) || !tr.Until.Equal(test.want.Until) {
+				t.Errorf("got %v, want %v", tr, test.want)
+			}
+		})
+	}
+}
+
+func TestTimeRangeContains(t *testing.T) {
+	since := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	until := since.Add(time.Hour)
+	closed := TimeRange{since, until}
+	for _, test := range []struct {
+		name string
+		tr   TimeRange
+		t    time.Time
+		want bool
+	}{
+		{"since", closed, since, true},
+		{"within", closed, since.Add(time.Minute), true},
+		{"until", closed, until, false},
+		{"before", closed, since.Add(-time.Second), false},
+		{"after", closed, until.Add(time.Second), false},
+		{"unknown", closed, time.Time{}, false},
+		{"unknown in an open range", TimeRange{}, time.Time{}, true},
+		{"open until", TimeRange{Since: since}, until.AddDate(10, 0, 0), true},
+		{"open since", TimeRange{Until: until}, since.AddDate(-10, 0, 0), true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.tr.Contains(test.t); got != test.want {
+				t.Errorf("%v contains %v: %v, want %v", test.tr, test.t, got, test.want)
+			}
+		})
+	}
+}
+
+// A range over part of a collection picks out just what was published in
+// it, both in timelines and when the collection is served.
+func TestTimeRangeWithinCollection(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	start := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	clock := &testClock{now: start}
+	s.SetClock(clock)
+	aliceIRI := register(t, s, "alice")
+	respondLocally(t, s, transport, s.boxIRI(aliceIRI, "followers"))
+	var posted []string
+	for i := 0; i < 5; i++ {
+		note, err := s.PostStatus(c, aliceIRI, StatusParams{Status: "hello", Visibility: VisibilityPublic})
+		if err != nil {
+			t.Fatal(err)
+		}
+		posted = append(posted, note.GetJSONLDId().Get().String())
+		clock.Advance(time.Hour)
+	}
+	// From the second to the fourth, not including it.
+	tr := TimeRange{start.Add(time.Hour), start.Add(3 * time.Hour)}
+
+	home, err := s.HomeTimeline(c, aliceIRI, tr, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for id := range typesOf(home) {
+		got = append(got, id)
+	}
+	if len(home) != 2 || typesOf(home)[posted[1]] == "" || typesOf(home)[posted[2]] == "" {
+		t.Errorf("home timeline %v, want %v", got, posted[1:3])
+	}
+	if home, err = s.HomeTimeline(c, aliceIRI, TimeRange{Since: start.Add(3 * time.Hour)}, 1); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(typesOf(home), map[string]string{posted[4]: "Note"}) {
+		t.Errorf("the newest since the fourth %v, want %s", typesOf(home), posted[4])
+	}
+
+	outbox := s.boxIRI(aliceIRI, "outbox").String()
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, signedFetch(t, nil, outbox+"?since=2026-10-01T13:00:00Z&until=2026-10-01T15:00:00Z"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET the outbox within a range: %d %s", w.Code, w.Body)
+	}
+	var collection struct {
+		TotalItems int `json:"totalItems"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &collection); err != nil {
+		t.Fatal(err)
+	}
+	if collection.TotalItems != 2 {
+		t.Errorf("%d items within the range, want 2", collection.TotalItems)
+	}
+
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, signedFetch(t, nil, outbox+"?since=2026-10-01T15:00:00Z&until=2026-10-01T13:00:00Z"))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("GET the outbox with until before since: %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
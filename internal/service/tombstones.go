@@ -0,0 +1,57 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// bury replaces our object at `iri` with a Tombstone, so those asking for it
+// later learn it was deleted rather than never there.
+func (s *Service) bury(c context.Context, iri *url.URL) error {
+	if err := s.db.Lock(c, iri); err != nil {
+		return err
+	}
+	defer s.db.Unlock(c, iri)
+	t, err := s.db.Get(c, iri)
+	if err != nil || t.GetTypeName() == "Tombstone" {
+		return nil
+	}
+	return s.db.Update(c, s.newTombstone(iri, t))
+}
+
+// buryDeleted buries the objects of `activity`, just sent, if it's a Delete.
+// Go-Fed only deletes them as a client-to-server side effect, which we don't
+// run, and would leave nothing in their place.
+func (s *Service) buryDeleted(c context.Context, activity pub.Activity) error {
+	if _, ok := activity.(vocab.ActivityStreamsDelete); !ok {
+		return nil
+	}
+	for _, id := range objectsOf(activity) {
+		if err := s.bury(c, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newTombstone returns the Tombstone for `t`, at `iri`, deleted now.
+func (s *Service) newTombstone(iri *url.URL, t vocab.Type) vocab.ActivityStreamsTombstone {
+	tombstone := streams.NewActivityStreamsTombstone()
+	id := streams.NewJSONLDIdProperty()
+	id.Set(iri)
+	tombstone.SetJSONLDId(id)
+	formerType := streams.NewActivityStreamsFormerTypeProperty()
+	formerType.AppendXMLSchemaString(t.GetTypeName())
+	tombstone.SetActivityStreamsFormerType(formerType)
+	deleted := streams.NewActivityStreamsDeletedProperty()
+	deleted.Set(s.Now())
+	tombstone.SetActivityStreamsDeleted(deleted)
+	return tombstone
+}
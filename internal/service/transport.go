@@ -0,0 +1,339 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-fed/activity/pub"
+)
+
+// The user agent we fetch and deliver with, ahead of Go-Fed's own.
+const userAgent = "mastogon/0.1.0"
+
+// NewTransport signs requests with the key of the local actor owning
+// `actorBoxIRI`, which may be either their inbox or their outbox, or with our
+// instance actor's if it's nil, for requests made for the server itself.
+// Deliveries go through the delivery queue once StartDelivery has been
+// called.
+func (s *Service) NewTransport(c context.Context,
+	actorBoxIRI *url.URL,
+	gofedAgent string) (t pub.Transport, err error) {
+	actorIRI, err := s.signingActor(c, actorBoxIRI)
+	if err != nil {
+		return
+	}
+	if actorBoxIRI == nil {
+		actorBoxIRI = s.boxIRI(actorIRI, "outbox")
+	}
+	key, err := s.db.PrivateKey(actorIRI)
+	if err != nil {
+		return
+	}
+	keyIRI := *actorIRI
+	keyIRI.Fragment = "main-key"
+	signer, err := newCavageSigner(key, keyIRI.String())
+	if err != nil {
+		return
+	}
+	if s.transport != nil {
+		return &queuedTransport{Transport: s.transport, s: s, from: actorBoxIRI, resolving: gofedAgent != ""}, nil
+	}
+	agent := userAgent
+	if gofedAgent != "" {
+		agent += " " + gofedAgent
+	}
+	t = &queuedTransport{
+		Transport: &httpTransport{
+			s:         s,
+			client:    s.client,
+			userAgent: agent,
+			signer:    signer,
+			keyId:     keyIRI.String(),
+			key:       key,
+		},
+		s:         s,
+		from:      actorBoxIRI,
+		resolving: gofedAgent != "",
+	}
+	return
+}
+
+// newHTTPClient returns a client held to the timeout and connection limits
+// in `config`, so a slow or hostile peer can't tie us up, and that won't
+// connect to our own network.
+func newHTTPClient(config Config) *http.Client {
+	var allowed []netip.Prefix
+	for _, cidr := range config.AllowedPrivateNetworks {
+		if prefix, err := netip.ParsePrefix(cidr); err == nil {
+			allowed = append(allowed, prefix)
+		} else {
+			log.Printf("ignoring allowed private network %q: %s", cidr, err)
+		}
+	}
+	dialer := &net.Dialer{
+		Timeout: config.FetchTimeout,
+		// Checking the address we actually dial, after resolving, catches
+		// hostnames pointing inward and redirects alike.
+		Control: func(network, address string, _ syscall.RawConn) error {
+			return checkDialAddress(address, allowed)
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.MaxConnsPerHost = config.MaxConnsPerHost
+	transport.MaxIdleConnsPerHost = config.MaxConnsPerHost
+	transport.ResponseHeaderTimeout = config.FetchTimeout
+	return &http.Client{
+		Transport: transport,
+		Timeout:   config.FetchTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > config.MaxRedirects {
+				return fmt.Errorf("stopped after %d redirects", config.MaxRedirects)
+			}
+			return nil
+		},
+	}
+}
+
+// checkDialAddress refuses `address`, an "ip:port", if it's private,
+// loopback, link-local or otherwise not on the public internet, unless it's
+// in one of the `allowed` networks.
+func checkDialAddress(address string, allowed []netip.Prefix) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	ip := addrPort.Addr().Unmap()
+	for _, prefix := range allowed {
+		if prefix.Contains(ip) {
+			return nil
+		}
+	}
+	if ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return fmt.Errorf("refusing to connect to non-public address %s", ip)
+	}
+	return nil
+}
+
+// readResponse reads the body of `resp`, failing if it's over
+// Config.MaxResponseSize.
+func (s *Service) readResponse(resp *http.Response) ([]byte, error) {
+	if resp.ContentLength > s.config.MaxResponseSize {
+		return nil, fmt.Errorf("response from %s is too large", resp.Request.URL)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, s.config.MaxResponseSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > s.config.MaxResponseSize {
+		return nil, fmt.Errorf("response from %s is too large", resp.Request.URL)
+	}
+	return b, nil
+}
+
+// httpTransport fetches and delivers with requests signed either the way of
+// the cavage draft or of RFC 9421. It signs first the way Config.SignatureStyle
+// prefers, and should the peer refuse that, the other way, remembering which
+// worked for next time.
+type httpTransport struct {
+	s         *Service
+	client    *http.Client
+	userAgent string
+	signer    *cavageSigner
+	keyId     string
+	key       crypto.PrivateKey
+}
+
+func (t *httpTransport) Dereference(c context.Context, iri *url.URL) ([]byte, error) {
+	resp, err := t.do(c, http.MethodGet, iri, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return nil, fmt.Errorf("GET request to %s: %w", iri, ErrRateLimited)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET request to %s failed (%d): %s", iri, resp.StatusCode, resp.Status)
+	}
+	b, err := t.s.readResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+	if final := resp.Request.URL; final.Host != iri.Host {
+		if err := checkRedirectedId(b, final); err != nil {
+			return nil, fmt.Errorf("GET request to %s redirected to %s: %w", iri, final, err)
+		}
+	}
+	return b, nil
+}
+
+// checkRedirectedId checks the object `b` we were redirected to at `final`,
+// on another host than we asked, is one that host speaks for: else anyone
+// could have us take their object for another host's by redirecting.
+func checkRedirectedId(b []byte, final *url.URL) error {
+	var m struct {
+		Id string `json:"id"`
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	id, err := url.Parse(m.Id)
+	if err != nil {
+		return err
+	}
+	if id.Host != final.Host {
+		return fmt.Errorf("object %s isn't on %s", id, final.Host)
+	}
+	return nil
+}
+
+// errDeliveryRefused is what a delivery fails with when the peer answered,
+// but wouldn't take it: trying again won't change its mind.
+var errDeliveryRefused = errors.New("refused")
+
+func (t *httpTransport) Deliver(c context.Context, b []byte, to *url.URL) error {
+	if !t.s.deliveryAllowed(to.Host) {
+		return fmt.Errorf("POST request to %s: %w", to, ErrPeerUnavailable)
+	}
+	start := time.Now()
+	resp, err := t.do(c, http.MethodPost, to, b)
+	if err != nil {
+		t.s.recordDelivery(to.Host, time.Since(start), false)
+		return err
+	}
+	defer resp.Body.Close()
+	// A peer refusing one delivery is still up; one erroring or telling
+	// us to slow down isn't, as far as we're concerned.
+	up := resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests
+	t.s.recordDelivery(to.Host, time.Since(start), up)
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case up:
+		return fmt.Errorf("POST request to %s failed (%d): %w", to, resp.StatusCode, errDeliveryRefused)
+	}
+	return fmt.Errorf("POST request to %s failed (%d): %s", to, resp.StatusCode, resp.Status)
+}
+
+func (t *httpTransport) BatchDeliver(c context.Context, b []byte, recipients []*url.URL) error {
+	var wg sync.WaitGroup
+	errs := make(chan error, len(recipients))
+	for _, to := range recipients {
+		wg.Add(1)
+		go func(to *url.URL) {
+			defer wg.Done()
+			if err := t.Deliver(c, b, to); err != nil {
+				errs <- err
+			}
+		}(to)
+	}
+	wg.Wait()
+	close(errs)
+	var failed []string
+	for err := range errs {
+		failed = append(failed, err.Error())
+	}
+	if len(failed) > 0 {
+		return errors.New("batch deliver had at least one failure: " + strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// do makes a signed request for `iri`, with `body` if it's a POST. A peer
+// answering 400, 401 or 403 to one style of signature is asked again with
+// the other. Suspended domains aren't asked at all if
+// Config.RefuseSuspendedDomains is set.
+func (t *httpTransport) do(c context.Context, method string, iri *url.URL, body []byte) (*http.Response, error) {
+	if t.s.config.RefuseSuspendedDomains {
+		if b, ok := t.s.DomainBlockFor(iri.Host); ok && b.Severity == "suspend" {
+			return nil, fmt.Errorf("%s request to %s: domain is suspended", method, iri)
+		}
+	}
+	t.s.notePeer(iri.Host)
+	style := t.s.signatureStyle(iri.Host)
+	resp, err := t.try(c, method, iri, body, style)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden:
+	default:
+		return resp, nil
+	}
+	other := SignatureRFC9421
+	if style == SignatureRFC9421 {
+		other = SignatureCavage
+	}
+	retry, err := t.try(c, method, iri, body, other)
+	if err != nil {
+		return resp, nil
+	}
+	switch retry.StatusCode {
+	case http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden:
+		retry.Body.Close()
+		return resp, nil
+	}
+	resp.Body.Close()
+	t.s.signatureStyles.Store(iri.Host, other)
+	return retry, nil
+}
+
+// try makes a request for `iri` signed in `style`.
+func (t *httpTransport) try(c context.Context, method string, iri *url.URL, body []byte, style string) (*http.Response, error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(c, method, iri.String(), r)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", mediaTypeActivityJSON)
+	} else {
+		req.Header.Set("Accept", acceptActivityStreams)
+	}
+	req.Header.Set("Accept-Charset", "utf-8")
+	req.Header.Set("Date", t.s.Now().UTC().Format(http.TimeFormat))
+	req.Header.Set("User-Agent", t.userAgent)
+	if style == SignatureRFC9421 {
+		err = signRFC9421(req, body, t.key, t.keyId, t.s.Now())
+	} else {
+		err = t.signer.sign(req, body)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t.client.Do(req)
+}
+
+// signatureStyle returns how to sign requests to `host` first: however
+// worked last time, or else as configured.
+func (s *Service) signatureStyle(host string) string {
+	if v, ok := s.signatureStyles.Load(host); ok {
+		return v.(string)
+	}
+	if s.config.SignatureStyle == SignatureRFC9421 {
+		return SignatureRFC9421
+	}
+	return SignatureCavage
+}
@@ -0,0 +1,347 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-fed/httpsig"
+)
+
+// newHTTPTest returns a service fetching and delivering over HTTP, as it does
+// outside tests, and a peer at 127.0.0.1 serving `h`, which it's allowed to
+// reach.
+func newHTTPTest(t *testing.T, h http.Handler) (*Service, *httptest.Server) {
+	t.Helper()
+	s, _ := newTestService(t)
+	s.config.AllowedPrivateNetworks = []string{"127.0.0.0/8"}
+	s.client = newHTTPClient(s.config)
+	s.transport = nil
+	peer := httptest.NewServer(h)
+	t.Cleanup(peer.Close)
+	return s, peer
+}
+
+func TestTransportSigningActors(t *testing.T) {
+	c := context.Background()
+	requests := make(chan *http.Request, 1)
+	s, peer := newHTTPTest(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r
+		w.Write([]byte(`{"id":"http://` + r.Host + r.URL.Path + `"}`))
+	}))
+	aliceIRI := register(t, s, "alice")
+	instanceIRI, err := s.instanceActor(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name  string
+		box   *url.URL
+		actor *url.URL
+	}{
+		{"outbox", s.boxIRI(aliceIRI, "outbox"), aliceIRI},
+		{"inbox", s.boxIRI(aliceIRI, "inbox"), aliceIRI},
+		{"instance", nil, instanceIRI},
+		{"instance outbox", s.boxIRI(instanceIRI, "outbox"), instanceIRI},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			tp, err := s.NewTransport(c, test.box, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tp.Dereference(c, mustParse(t, peer.URL+"/notes/1")); err != nil {
+				t.Fatal(err)
+			}
+			r := <-requests
+			if got, want := signatureParam(r, "keyId"), test.actor.String()+"#main-key"; got != want {
+				t.Errorf("signed with %s, want %s", got, want)
+			}
+			for _, actorIRI := range []*url.URL{aliceIRI, instanceIRI} {
+				key, err := s.db.PrivateKey(actorIRI)
+				if err != nil {
+					t.Fatal(err)
+				}
+				publicKey := key.(crypto.Signer).Public()
+				algo, err := keyAlgorithm(publicKey)
+				if err != nil {
+					t.Fatal(err)
+				}
+				r.Header.Set("Host", r.Host)
+				verifier, err := httpsig.NewVerifier(r)
+				if err != nil {
+					t.Fatal(err)
+				}
+				verified := verifier.Verify(publicKey, algo) == nil
+				if want := actorIRI.String() == test.actor.String(); verified != want {
+					t.Errorf("verified with the key of %s: %t, want %t", actorIRI, verified, want)
+				}
+			}
+		})
+	}
+
+	for _, box := range []string{
+		"https://" + testHostname + "/users/nobody/outbox",
+		"https://" + testHostname + "/users/alice/followers",
+		"https://remote.test/users/alice/outbox",
+	} {
+		if _, err := s.NewTransport(c, mustParse(t, box), ""); err == nil {
+			t.Errorf("made a transport for %s", box)
+		}
+	}
+}
+
+func TestHTTPClientTimeout(t *testing.T) {
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer peer.Close()
+	config := DefaultConfig()
+	config.AllowedPrivateNetworks = []string{"127.0.0.0/8"}
+	config.FetchTimeout = 100 * time.Millisecond
+
+	start := time.Now()
+	resp, err := newHTTPClient(config).Get(peer.URL)
+	if err == nil {
+		resp.Body.Close()
+		t.Fatal("a peer answering too slowly was waited for")
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("gave up after %s, want about %s", took, config.FetchTimeout)
+	}
+}
+
+func TestHTTPClientPrivateNetworks(t *testing.T) {
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer peer.Close()
+	config := DefaultConfig()
+	config.FetchTimeout = time.Second
+
+	for _, iri := range []string{peer.URL, "http://169.254.169.254/latest/meta-data/", "http://[::1]:1/"} {
+		resp, err := newHTTPClient(config).Get(iri)
+		if err == nil {
+			resp.Body.Close()
+			t.Errorf("connected to %s", iri)
+		} else if !strings.Contains(err.Error(), "non-public address") {
+			t.Errorf("getting %s: %s, want it refused", iri, err)
+		}
+	}
+
+	config.AllowedPrivateNetworks = []string{"127.0.0.0/8"}
+	resp, err := newHTTPClient(config).Get(peer.URL)
+	if err != nil {
+		t.Fatalf("refused an allowed network: %s", err)
+	}
+	resp.Body.Close()
+	if err := checkDialAddress("169.254.169.254:80", []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}); err == nil {
+		t.Error("allowing one private network allowed another")
+	}
+	if err := checkDialAddress("93.184.215.14:443", nil); err != nil {
+		t.Errorf("refused a public address: %s", err)
+	}
+}
+
+func TestCheckDialAddress(t *testing.T) {
+	for _, test := range []struct {
+		address string
+		refused bool
+	}{
+		{"93.184.215.14:443", false},
+		{"[2606:2800:21f:cb07:6820:80da:af6b:8b2c]:443", false},
+		{"127.0.0.1:80", true},
+		{"10.1.2.3:80", true},
+		{"172.16.0.1:80", true},
+		{"192.168.1.1:80", true},
+		{"169.254.169.254:80", true},
+		{"0.0.0.0:80", true},
+		{"224.0.0.1:80", true},
+		{"[::1]:80", true},
+		{"[::]:80", true},
+		{"[fd00::1]:80", true},
+		{"[fe80::1]:80", true},
+		// IPv4 addresses written as IPv6 ones are what they map to.
+		{"[::ffff:127.0.0.1]:80", true},
+		{"[::ffff:169.254.169.254]:80", true},
+		{"[::ffff:93.184.215.14]:443", false},
+	} {
+		if err := checkDialAddress(test.address, nil); (err != nil) != test.refused {
+			t.Errorf("%s: %v, want refused %t", test.address, err, test.refused)
+		}
+	}
+	allowed := []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}
+	if err := checkDialAddress("[::ffff:127.0.0.1]:80", allowed); err != nil {
+		t.Errorf("refused a mapped address in an allowed network: %s", err)
+	}
+}
+
+func TestHTTPClientRedirectToPrivateNetwork(t *testing.T) {
+	// A peer we may reach can't send us somewhere we may not.
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+	}))
+	defer peer.Close()
+	config := DefaultConfig()
+	config.AllowedPrivateNetworks = []string{"127.0.0.0/8"}
+	config.FetchTimeout = time.Second
+	resp, err := newHTTPClient(config).Get(peer.URL)
+	if err == nil {
+		resp.Body.Close()
+		t.Fatal("followed a redirect to a link-local address")
+	}
+	if !strings.Contains(err.Error(), "non-public address") {
+		t.Errorf("redirected to a link-local address: %s, want it refused", err)
+	}
+}
+
+func TestHTTPClientMaxRedirects(t *testing.T) {
+	// /n redirects n more times.
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/"))
+		if n > 0 {
+			http.Redirect(w, r, "/"+strconv.Itoa(n-1), http.StatusFound)
+		}
+	}))
+	defer peer.Close()
+	config := DefaultConfig()
+	config.AllowedPrivateNetworks = []string{"127.0.0.0/8"}
+	config.MaxRedirects = 2
+	client := newHTTPClient(config)
+
+	resp, err := client.Get(peer.URL + "/2")
+	if err != nil {
+		t.Fatalf("following %d redirects: %s", config.MaxRedirects, err)
+	}
+	resp.Body.Close()
+	if resp, err := client.Get(peer.URL + "/3"); err == nil {
+		resp.Body.Close()
+		t.Errorf("followed %d redirects", config.MaxRedirects+1)
+	}
+}
+
+func TestDereferenceRedirectedElsewhere(t *testing.T) {
+	c := context.Background()
+	var id string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":"` + id + `"}`))
+	}))
+	defer other.Close()
+	s, peer := newHTTPTest(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, other.URL+r.URL.Path, http.StatusFound)
+	}))
+	tp, err := s.NewTransport(c, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The host redirected to speaks for its own objects...
+	id = other.URL + "/notes/1"
+	if _, err := tp.Dereference(c, mustParse(t, peer.URL+"/notes/1")); err != nil {
+		t.Errorf("redirected to an object of the host redirected to: %s", err)
+	}
+	// ...but not for anyone else's.
+	for _, id = range []string{peer.URL + "/notes/1", "https://remote.test/notes/1"} {
+		if _, err := tp.Dereference(c, mustParse(t, peer.URL+"/notes/1")); err == nil || !strings.Contains(err.Error(), "isn't on") {
+			t.Errorf("redirected to %s on %s: %v, want it refused", id, other.URL, err)
+		}
+	}
+}
+
+func TestDereferenceRedirectedWithinHost(t *testing.T) {
+	c := context.Background()
+	s, peer := newHTTPTest(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/@bob" {
+			http.Redirect(w, r, "/users/bob", http.StatusMovedPermanently)
+			return
+		}
+		w.Write([]byte(`{"id":"http://` + r.Host + r.URL.Path + `"}`))
+	}))
+	tp, err := s.NewTransport(c, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tp.Dereference(c, mustParse(t, peer.URL+"/@bob")); err != nil {
+		t.Errorf("redirected within the host: %s", err)
+	}
+
+	// Unless we follow no redirects at all.
+	s.config.MaxRedirects = 0
+	s.client = newHTTPClient(s.config)
+	if tp, err = s.NewTransport(c, nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tp.Dereference(c, mustParse(t, peer.URL+"/@bob")); err == nil {
+		t.Error("followed a redirect with MaxRedirects 0")
+	}
+}
+
+func TestDeliverRefused(t *testing.T) {
+	c := context.Background()
+	s, peer := newHTTPTest(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/"))
+		w.WriteHeader(status)
+	}))
+	tp, err := s.NewTransport(c, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		status  int
+		refused bool
+	}{
+		{http.StatusAccepted, false},
+		{http.StatusForbidden, true},
+		{http.StatusGone, true},
+		{http.StatusTooManyRequests, false},
+		{http.StatusInternalServerError, false},
+	} {
+		err := tp.Deliver(c, []byte(`{"type":"Note"}`), mustParse(t, peer.URL+"/"+strconv.Itoa(test.status)))
+		if refused := errors.Is(err, errDeliveryRefused); refused != test.refused {
+			t.Errorf("delivery answered with %d: %v, refused %t, want %t", test.status, err, refused, test.refused)
+		}
+		if test.status < 300 && err != nil {
+			t.Errorf("delivery answered with %d: %s", test.status, err)
+		}
+	}
+}
+
+func TestTransportMediaTypes(t *testing.T) {
+	c := context.Background()
+	requests := make(chan *http.Request, 1)
+	s, peer := newHTTPTest(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r
+		w.Header().Set("Content-Type", mediaTypeActivityJSON)
+		w.Write([]byte(`{"id":"http://` + r.Host + r.URL.Path + `"}`))
+	}))
+	aliceIRI := register(t, s, "alice")
+	tp, err := s.NewTransport(c, s.boxIRI(aliceIRI, "outbox"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tp.Deliver(c, []byte(`{"type":"Note"}`), mustParse(t, peer.URL+"/inbox")); err != nil {
+		t.Fatal(err)
+	}
+	if r := <-requests; r.Header.Get("Content-Type") != mediaTypeActivityJSON {
+		t.Errorf("delivered as %q, want %q", r.Header.Get("Content-Type"), mediaTypeActivityJSON)
+	}
+	if _, err := tp.Dereference(c, mustParse(t, peer.URL+"/notes/1")); err != nil {
+		t.Fatal(err)
+	}
+	if r := <-requests; r.Header.Get("Accept") != acceptActivityStreams {
+		t.Errorf("fetched accepting %q, want %q", r.Header.Get("Accept"), acceptActivityStreams)
+	}
+}
@@ -0,0 +1,238 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// A hashtag: a `#` not stuck to the end of a word, URL or entity, then a
+// name with at least one letter in it.
+var hashtagPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_/&#])#([\p{L}\p{N}_]*\p{L}[\p{L}\p{N}_]*)`)
+
+// Hashtags returns the hashtags in the plain text `s`, lowercased, without
+// their `#` and without repeats.
+func Hashtags(s string) (tags []string) {
+	seen := make(map[string]bool)
+	for _, m := range hashtagPattern.FindAllStringSubmatch(s, -1) {
+		tag := strings.ToLower(m[1])
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return
+}
+
+// hashtagsOf returns the names of the hashtags `t` is tagged with, lowercased
+// and without their `#`. Go-Fed has no Hashtag type: it keeps them as it read
+// them, so we read them off the serialized tags.
+func hashtagsOf(t vocab.Type) (tags []string) {
+	o, ok := t.(interface {
+		GetActivityStreamsTag() vocab.ActivityStreamsTagProperty
+	})
+	if !ok || o.GetActivityStreamsTag() == nil {
+		return
+	}
+	v, err := o.GetActivityStreamsTag().Serialize()
+	if err != nil {
+		return
+	}
+	for _, e := range serializedValues(v) {
+		m, ok := e.(map[string]interface{})
+		if !ok || m["type"] != "Hashtag" {
+			continue
+		}
+		if name, ok := m["name"].(string); ok {
+			tags = append(tags, strings.ToLower(strings.TrimPrefix(name, "#")))
+		}
+	}
+	return
+}
+
+// TagURL returns where the hashtag `tag` is browsed on our web UI.
+func (s *Service) TagURL(tag string) *url.URL {
+	return &url.URL{Scheme: "https", Host: s.db.Hostname(), Path: "/tags/" + tag}
+}
+
+// withHashtags returns `note` tagged with the hashtags `tags` as well. They
+// go in serialized, for want of a Go-Fed type.
+func (s *Service) withHashtags(c context.Context, note vocab.ActivityStreamsNote, tags []string) (vocab.ActivityStreamsNote, error) {
+	if len(tags) == 0 {
+		return note, nil
+	}
+	t, err := extended(c, note, func(m map[string]interface{}) {
+		all := serializedValues(m["tag"])
+		for _, tag := range tags {
+			all = append(all, map[string]interface{}{
+				"type": "Hashtag",
+				"name": "#" + tag,
+				"href": s.TagURL(tag).String(),
+			})
+		}
+		m["tag"] = all
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t.(vocab.ActivityStreamsNote), nil
+}
+
+// Trend is a hashtag local users have been posting with lately.
+type Trend struct {
+	Name string
+	// How hot the hashtag is: each account using it counts for one, halved
+	// for every Config.TrendHalfLife since they last did.
+	Score float64
+	// Usage over the trend window, a day at a time, most recent first.
+	History []TrendDay
+}
+
+// TrendDay is how much a hashtag got used on a given day.
+type TrendDay struct {
+	Day time.Time
+	// The posts using the hashtag, and the accounts that wrote them.
+	Uses     int
+	Accounts int
+}
+
+// trends holds the latest trends, and stops their computation.
+type trends struct {
+	mu      sync.Mutex
+	current []Trend
+	stop    func()
+}
+
+// Trends returns up to `limit` of the hashtags trending as of the last
+// computation, hottest first.
+func (s *Service) Trends(limit int) []Trend {
+	s.trends.mu.Lock()
+	defer s.trends.mu.Unlock()
+	if limit > len(s.trends.current) {
+		limit = len(s.trends.current)
+	}
+	return append([]Trend(nil), s.trends.current[:limit]...)
+}
+
+// StartTrends computes the trending hashtags now and then every
+// Config.TrendInterval, until Shutdown.
+func (s *Service) StartTrends() {
+	s.trends.mu.Lock()
+	defer s.trends.mu.Unlock()
+	if s.trends.stop != nil {
+		return
+	}
+	compute := func(c context.Context) {
+		if err := s.ComputeTrends(c); err != nil {
+			log.Printf("computing trends: %s", err)
+		}
+	}
+	stopNow := s.At(s.Now(), compute)
+	stopEvery := s.Every(s.config.TrendInterval, compute)
+	s.trends.stop = func() {
+		stopNow()
+		stopEvery()
+	}
+}
+
+// stopTrends stops the computation StartTrends started, if it did.
+func (s *Service) stopTrends() {
+	s.trends.mu.Lock()
+	defer s.trends.mu.Unlock()
+	if s.trends.stop != nil {
+		s.trends.stop()
+		s.trends.stop = nil
+	}
+}
+
+// ComputeTrends ranks the hashtags on our local public notes published within
+// Config.TrendWindow. An account's use of a hashtag counts for less the
+// longer ago it was, so trends follow what's being talked about now, and
+// counts once however many times they used it, so no one account can make a
+// hashtag trend.
+func (s *Service) ComputeTrends(c context.Context) error {
+	now := s.Now()
+	notes, err := s.db.LocalNotesSince(c, now.Add(-s.config.TrendWindow))
+	if err != nil {
+		return err
+	}
+	type usage struct {
+		// When each account last used the hashtag, keyed by IRI.
+		lastUsed map[string]time.Time
+		// Posts and accounts per day, keyed by days ago.
+		uses     map[int]int
+		accounts map[int]map[string]bool
+	}
+	usages := make(map[string]*usage)
+	for _, note := range notes {
+		if Visibility(note) != VisibilityPublic {
+			continue
+		}
+		authors := authorsOf(note)
+		if len(authors) == 0 {
+			continue
+		}
+		author := authors[0].String()
+		published := note.GetActivityStreamsPublished().Get()
+		daysAgo := int(now.Sub(published) / (24 * time.Hour))
+		for _, tag := range hashtagsOf(note) {
+			u, ok := usages[tag]
+			if !ok {
+				u = &usage{
+					lastUsed: make(map[string]time.Time),
+					uses:     make(map[int]int),
+					accounts: make(map[int]map[string]bool),
+				}
+				usages[tag] = u
+			}
+			if published.After(u.lastUsed[author]) {
+				u.lastUsed[author] = published
+			}
+			u.uses[daysAgo]++
+			if u.accounts[daysAgo] == nil {
+				u.accounts[daysAgo] = make(map[string]bool)
+			}
+			u.accounts[daysAgo][author] = true
+		}
+	}
+	days := int(math.Ceil(float64(s.config.TrendWindow) / float64(24*time.Hour)))
+	current := make([]Trend, 0, len(usages))
+	for tag, u := range usages {
+		t := Trend{Name: tag}
+		for _, last := range u.lastUsed {
+			t.Score += math.Exp2(-float64(now.Sub(last)) / float64(s.config.TrendHalfLife))
+		}
+		for d := 0; d < days; d++ {
+			t.History = append(t.History, TrendDay{
+				Day:      now.Add(-time.Duration(d) * 24 * time.Hour).Truncate(24 * time.Hour),
+				Uses:     u.uses[d],
+				Accounts: len(u.accounts[d]),
+			})
+		}
+		current = append(current, t)
+	}
+	sort.Slice(current, func(i, j int) bool {
+		if current[i].Score != current[j].Score {
+			return current[i].Score > current[j].Score
+		}
+		return current[i].Name < current[j].Name
+	})
+	if len(current) > s.config.MaxTrends {
+		current = current[:s.config.MaxTrends]
+	}
+	s.trends.mu.Lock()
+	s.trends.current = current
+	s.trends.mu.Unlock()
+	return nil
+}
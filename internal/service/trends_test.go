@@ -0,0 +1,115 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/go-fed/activity/streams"
+)
+
+func TestHashtags(t *testing.T) {
+	for _, test := range []struct {
+		text string
+		want []string
+	}{
+		{"no tags", nil},
+		{"#Go and #go again", []string{"go"}},
+		{"(#fediverse) #été", []string{"fediverse", "été"}},
+		{"not a#tag, &#39; nor #123 nor https://example.com/#anchor", nil},
+		{"#tag_2", []string{"tag_2"}},
+	} {
+		if got := Hashtags(test.text); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Hashtags(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestHashtagsOfInbound(t *testing.T) {
+	// Tagged as Mastodon tags them, among mentions and emoji.
+	note, err := streams.ToType(context.Background(), map[string]interface{}{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id":       "https://remote.test/notes/1",
+		"type":     "Note",
+		"tag": []interface{}{
+			map[string]interface{}{"type": "Hashtag", "name": "#Fediverse", "href": "https://remote.test/tags/fediverse"},
+			map[string]interface{}{"type": "Mention", "name": "@alice@mastogon.test", "href": "https://mastogon.test/users/alice"},
+			map[string]interface{}{"type": "Emoji", "name": ":blob:"},
+			map[string]interface{}{"type": "Hashtag", "name": "go"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := hashtagsOf(note), []string{"fediverse", "go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("hashtagsOf = %q, want %q", got, want)
+	}
+}
+
+func TestPostStatusHashtags(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	aliceIRI := register(t, s, "alice")
+	respondLocally(t, s, transport, s.boxIRI(aliceIRI, "followers"))
+	note, err := s.PostStatus(c, aliceIRI, StatusParams{Status: "#Go is fun, #go", Visibility: VisibilityPublic})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := s.db.Get(c, note.GetJSONLDId().Get())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := streams.Serialize(stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"type": "Hashtag", "name": "#go", "href": s.TagURL("go").String()}
+	if tags := serializedValues(m["tag"]); len(tags) != 1 || !reflect.DeepEqual(tags[0], want) {
+		t.Errorf("tags = %v, want [%v]", m["tag"], want)
+	}
+	if got := hashtagsOf(stored); !reflect.DeepEqual(got, []string{"go"}) {
+		t.Errorf("hashtagsOf = %q, want [go]", got)
+	}
+}
+
+func TestComputeTrends(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	for _, username := range []string{"alice", "bob"} {
+		actorIRI := register(t, s, username)
+		respondLocally(t, s, transport, s.boxIRI(actorIRI, "followers"))
+		for _, status := range []string{"#popular", "#popular #rare"} {
+			if username == "bob" && status != "#popular" {
+				continue
+			}
+			if _, err := s.PostStatus(c, actorIRI, StatusParams{Status: status, Visibility: VisibilityPublic}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// Nor do private posts trend.
+	carolIRI := register(t, s, "carol")
+	respondLocally(t, s, transport, s.boxIRI(carolIRI, "followers"))
+	if _, err := s.PostStatus(c, carolIRI, StatusParams{Status: "#secret", Visibility: VisibilityPrivate}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.ComputeTrends(c); err != nil {
+		t.Fatal(err)
+	}
+	trends := s.Trends(10)
+	var names []string
+	for _, trend := range trends {
+		names = append(names, trend.Name)
+	}
+	if want := []string{"popular", "rare"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("trends = %q, want %q", names, want)
+	}
+	// Counted once per account, however often it used the tag.
+	if today := trends[0].History[0]; today.Accounts != 2 || today.Uses != 3 {
+		t.Errorf("today's use of #popular = %+v, want 2 accounts and 3 uses", today)
+	}
+}
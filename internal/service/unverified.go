@@ -0,0 +1,66 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+)
+
+// What we may do with a Delete delivered to us whose signature we can't
+// check. When an account is deleted, its instance tells everyone with a
+// Delete of the actor, signed with the actor's key, which then can no longer
+// be fetched.
+const (
+	// Refuse it, as any other unverified delivery. The peer keeps retrying
+	// until it gives up, and whatever we have of the actor stays.
+	UnverifiedDeleteReject = "reject"
+	// Take it if it's an actor deleting itself, and the actor is indeed
+	// gone from its instance, which is all the signature would tell us.
+	UnverifiedDeleteAcceptSelf = "accept-self"
+)
+
+// acceptUnverified reports whether the delivery `r`, whose signature didn't
+// verify, may be taken all the same under Config.UnverifiedDeletes. Its
+// body must have been buffered.
+func (s *Service) acceptUnverified(c context.Context, r *http.Request) bool {
+	if s.config.UnverifiedDeletes != UnverifiedDeleteAcceptSelf || r.GetBody == nil {
+		return false
+	}
+	body, err := r.GetBody()
+	if err != nil {
+		return false
+	}
+	var m struct {
+		Type   string          `json:"type"`
+		Actor  json.RawMessage `json:"actor"`
+		Object json.RawMessage `json:"object"`
+	}
+	if err := json.NewDecoder(body).Decode(&m); err != nil || m.Type != "Delete" {
+		return false
+	}
+	actorIRI, err := url.Parse(rawID(m.Actor))
+	if err != nil || !actorIRI.IsAbs() || rawID(m.Object) != actorIRI.String() {
+		return false
+	}
+	return s.gone(c, actorIRI)
+}
+
+// gone reports whether the peer says the object at `iri` is no more.
+func (s *Service) gone(c context.Context, iri *url.URL) bool {
+	req, err := http.NewRequestWithContext(c, http.MethodGet, iri.String(), nil)
+	if err != nil {
+		return false
+	}
+	req.Header.Set("Accept", acceptActivityStreams)
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone
+}
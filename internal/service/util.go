@@ -0,0 +1,109 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// authorsOf returns who is responsible for `t`: the `attributedTo` of an
+// object and the `actor` of an activity.
+func authorsOf(t vocab.Type) (authors []*url.URL) {
+	if o, ok := t.(interface {
+		GetActivityStreamsAttributedTo() vocab.ActivityStreamsAttributedToProperty
+	}); ok && o.GetActivityStreamsAttributedTo() != nil {
+		prop := o.GetActivityStreamsAttributedTo()
+		for iter := prop.Begin(); iter != prop.End(); iter = iter.Next() {
+			if id, err := pub.ToId(iter); err == nil {
+				authors = append(authors, id)
+			}
+		}
+	}
+	if a, ok := t.(interface {
+		GetActivityStreamsActor() vocab.ActivityStreamsActorProperty
+	}); ok && a.GetActivityStreamsActor() != nil {
+		prop := a.GetActivityStreamsActor()
+		for iter := prop.Begin(); iter != prop.End(); iter = iter.Next() {
+			if id, err := pub.ToId(iter); err == nil {
+				authors = append(authors, id)
+			}
+		}
+	}
+	return
+}
+
+// objectsOf returns the IRIs in the `object` of an activity.
+func objectsOf(t vocab.Type) (objects []*url.URL) {
+	if a, ok := t.(interface {
+		GetActivityStreamsObject() vocab.ActivityStreamsObjectProperty
+	}); ok && a.GetActivityStreamsObject() != nil {
+		prop := a.GetActivityStreamsObject()
+		for iter := prop.Begin(); iter != prop.End(); iter = iter.Next() {
+			if id, err := pub.ToId(iter); err == nil {
+				objects = append(objects, id)
+			}
+		}
+	}
+	return
+}
+
+// extended returns `t` with what `edit` adds to it serialized. Go-Fed has no
+// types or properties for some of what peers expect of us, such as Hashtags,
+// but it keeps whatever it doesn't know of in what it deserializes, and
+// serializes it back as it was. Content in each language is the exception,
+// Go-Fed not reading back the way it serializes it, so it's carried over.
+func extended(c context.Context, t vocab.Type, edit func(m map[string]interface{})) (vocab.Type, error) {
+	m, err := streams.Serialize(t)
+	if err != nil {
+		return nil, err
+	}
+	edit(m)
+	withLanguageMaps(m)
+	delete(m, "contentMap")
+	out, err := streams.ToType(c, m)
+	if err != nil {
+		return nil, err
+	}
+	from, ok := t.(contentHaver)
+	to, ok2 := out.(contentHaver)
+	if !ok || !ok2 || from.GetActivityStreamsContent() == nil {
+		return out, nil
+	}
+	content := to.GetActivityStreamsContent()
+	for iter := from.GetActivityStreamsContent().Begin(); iter != from.GetActivityStreamsContent().End(); iter = iter.Next() {
+		if !iter.IsRDFLangString() {
+			continue
+		}
+		if content == nil {
+			content = streams.NewActivityStreamsContentProperty()
+			to.SetActivityStreamsContent(content)
+		}
+		content.AppendRDFLangString(iter.GetRDFLangString())
+	}
+	return out, nil
+}
+
+// contentHaver is what has `content`.
+type contentHaver interface {
+	GetActivityStreamsContent() vocab.ActivityStreamsContentProperty
+	SetActivityStreamsContent(vocab.ActivityStreamsContentProperty)
+}
+
+// serializedValues returns the values of the serialized property `v`, which
+// Go-Fed leaves out of an array when there's just the one.
+func serializedValues(v interface{}) []interface{} {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return v
+	default:
+		return []interface{}{v}
+	}
+}
@@ -0,0 +1,212 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"mastogon/internal/collections"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// What would become of a delivery from a peer, as ValidateRemote sees it.
+const (
+	VerdictAccepted = "accepted"
+	// Refused by moderation: the actor or their domain is suspended.
+	VerdictBlocked = "blocked"
+	// Taken in, but the object isn't a kind of status we really show.
+	VerdictUnsupported = "unsupported"
+	// Not something we could make sense of at all.
+	VerdictInvalid = "invalid"
+)
+
+// The most we read of a document ValidateRemote fetches.
+const maxValidateBody = 1 << 20
+
+// ValidationCheck is one of the checks ValidateRemote ran.
+type ValidationCheck struct {
+	Name   string
+	OK     bool
+	Detail string
+}
+
+// ValidationReport is what ValidateRemote found out about a peer's actor and
+// one of their objects.
+type ValidationReport struct {
+	Actor *url.URL
+	// The object checked, if one could be found.
+	Object  *url.URL
+	Checks  []ValidationCheck
+	Verdict string
+}
+
+func (r *ValidationReport) check(name string, ok bool, detail string, args ...interface{}) bool {
+	r.Checks = append(r.Checks, ValidationCheck{Name: name, OK: ok, Detail: fmt.Sprintf(detail, args...)})
+	return ok
+}
+
+// ValidateRemote fetches the actor at `actorIRI` and the object at
+// `objectIRI`, or failing that the latest object in the actor's outbox, and
+// reports how we'd take a delivery of that object from them. It's a dry
+// run: nothing is stored, and the fetches aren't signed, as they needn't be
+// made on behalf of any local actor.
+func (s *Service) ValidateRemote(c context.Context, actorIRI, objectIRI *url.URL) *ValidationReport {
+	report := &ValidationReport{Actor: actorIRI, Object: objectIRI, Verdict: VerdictInvalid}
+
+	t, err := fetchUnsigned(c, actorIRI)
+	if err != nil {
+		report.check("fetch actor", false, "%s", err)
+		return report
+	}
+	report.check("fetch actor", true, "%s", t.GetTypeName())
+	inboxed, ok := t.(interface {
+		GetActivityStreamsInbox() vocab.ActivityStreamsInboxProperty
+	})
+	if !report.check("actor has an inbox", ok && inboxed.GetActivityStreamsInbox() != nil, "") {
+		return report
+	}
+	report.check("actor has a public key", hasPublicKey(t), "")
+	if blocked, _ := s.Blocked(c, []*url.URL{actorIRI}); !report.check("actor not blocked", !blocked, "") {
+		report.Verdict = VerdictBlocked
+		return report
+	}
+
+	if objectIRI == nil {
+		if objectIRI, err = s.latestOutboxItem(c, t); err != nil {
+			report.check("find a sample object in the outbox", false, "%s", err)
+			return report
+		}
+		report.Object = objectIRI
+	}
+	o, err := fetchUnsigned(c, objectIRI)
+	if err != nil {
+		report.check("fetch object", false, "%s", err)
+		return report
+	}
+	report.check("fetch object", true, "%s", o.GetTypeName())
+	if _, ok := o.(pub.Activity); ok {
+		if callback, err := s.callbackFor(c, o); err == nil {
+			report.check("dispatched to", true, "%s", callback)
+		}
+	}
+	objects := []vocab.Type{o}
+	if create, ok := o.(vocab.ActivityStreamsCreate); ok {
+		// Go-Fed unwraps Creates, each of their objects, and so do we.
+		if embedded := s.embeddedOrStored(c, create); len(embedded) > 0 {
+			objects = embedded
+		}
+	}
+	for _, o := range objects {
+		attributed := false
+		for _, author := range authorsOf(o) {
+			attributed = attributed || author.String() == actorIRI.String()
+		}
+		if !report.check("object attributed to the actor", attributed, "%s", idOf(o)) {
+			return report
+		}
+		if blocked, _ := s.Blocked(c, authorsOf(o)); !report.check("authors not blocked", !blocked, "%s", idOf(o)) {
+			report.Verdict = VerdictBlocked
+			return report
+		}
+		if !report.check("supported status type", IsSupportedStatus(o), "%s", o.GetTypeName()) {
+			report.Verdict = VerdictUnsupported
+			return report
+		}
+	}
+	report.Verdict = VerdictAccepted
+	return report
+}
+
+// idOf returns the id of `t`, or nothing if it has none.
+func idOf(t vocab.Type) string {
+	if id, err := pub.GetId(t); err == nil {
+		return id.String()
+	}
+	return ""
+}
+
+// fetchUnsigned fetches and parses the ActivityStreams document at `iri`
+// with a plain GET.
+func fetchUnsigned(c context.Context, iri *url.URL) (vocab.Type, error) {
+	req, err := http.NewRequestWithContext(c, http.MethodGet, iri.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", acceptActivityStreams)
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", iri, resp.Status)
+	}
+	var m map[string]interface{}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxValidateBody)).Decode(&m); err != nil {
+		return nil, err
+	}
+	return streams.ToType(c, m)
+}
+
+// hasPublicKey reports whether the actor `t` has a public key we can read.
+func hasPublicKey(t vocab.Type) bool {
+	o, ok := t.(interface {
+		GetW3IDSecurityV1PublicKey() vocab.W3IDSecurityV1PublicKeyProperty
+	})
+	if !ok || o.GetW3IDSecurityV1PublicKey() == nil {
+		return false
+	}
+	for iter := o.GetW3IDSecurityV1PublicKey().Begin(); iter != o.GetW3IDSecurityV1PublicKey().End(); iter = iter.Next() {
+		if !iter.IsW3IDSecurityV1PublicKey() {
+			continue
+		}
+		pem := iter.Get().GetW3IDSecurityV1PublicKeyPem()
+		if pem == nil {
+			continue
+		}
+		if _, err := parsePublicKeyPEM(pem.Get()); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// latestOutboxItem finds the newest item in the outbox of the actor `t`,
+// following the outbox to its first page if need be.
+func (s *Service) latestOutboxItem(c context.Context, t vocab.Type) (*url.URL, error) {
+	o, ok := t.(interface {
+		GetActivityStreamsOutbox() vocab.ActivityStreamsOutboxProperty
+	})
+	if !ok || o.GetActivityStreamsOutbox() == nil {
+		return nil, fmt.Errorf("no outbox")
+	}
+	outboxIRI, err := pub.ToId(o.GetActivityStreamsOutbox())
+	if err != nil {
+		return nil, err
+	}
+	var latest *url.URL
+	err = collections.Walk(c, s.db, fetchUnsigned, outboxIRI, func(item pub.IdProperty) error {
+		id, err := pub.ToId(item)
+		if err != nil {
+			return err
+		}
+		latest = id
+		return collections.ErrStop
+	})
+	if err != nil {
+		return nil, err
+	} else if latest == nil {
+		return nil, fmt.Errorf("outbox is empty")
+	}
+	return latest, nil
+}
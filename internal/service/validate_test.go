@@ -0,0 +1,114 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The hosts the documents under testdata/validate were recorded from, and
+// where they're to be found there. Each peer's software serves the
+// documents of its own shape.
+var (
+	validateHosts  = []string{"https://mastodon.example", "https://pleroma.example", "https://misskey.example"}
+	validateRoutes = map[string]string{
+		"/users/ada":                                    "mastodon/actor.json",
+		"/users/ada/outbox":                             "mastodon/outbox.json",
+		"/users/ada/outbox?page=true":                   "mastodon/outbox_page.json",
+		"/users/ada/statuses/111/activity":              "mastodon/create.json",
+		"/users/lain":                                   "pleroma/actor.json",
+		"/objects/4a0c6b2e-8d4f-4e0b-a1c2-7f3e5d9b1a20": "pleroma/note.json",
+		"/users/9abcdefghi":                             "misskey/actor.json",
+		"/notes/9xyz000001":                             "misskey/question.json",
+	}
+)
+
+// servePeers serves the recorded documents of all the peers from one
+// server, returning its URL, which stands in for all their hosts.
+func servePeers(t testing.TB) string {
+	t.Helper()
+	var origin string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		file, ok := validateRoutes[r.URL.RequestURI()]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		b, err := os.ReadFile(filepath.Join("testdata", "validate", file))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		doc := string(b)
+		for _, host := range validateHosts {
+			doc = strings.ReplaceAll(doc, host, origin)
+		}
+		w.Header().Set("Content-Type", "application/activity+json")
+		w.Write([]byte(doc))
+	}))
+	t.Cleanup(srv.Close)
+	origin = srv.URL
+	return origin
+}
+
+func TestValidateRemote(t *testing.T) {
+	c := context.Background()
+	origin := servePeers(t)
+	for _, test := range []struct {
+		name    string
+		actor   string
+		object  string
+		verdict string
+		// A check that must have passed, and one that must have failed.
+		passed, failed string
+	}{
+		{"mastodon outbox", "/users/ada", "", VerdictAccepted, "actor has a public key", ""},
+		{"mastodon create", "/users/ada", "/users/ada/statuses/111/activity", VerdictAccepted, "dispatched to", ""},
+		{"pleroma note", "/users/lain", "/objects/4a0c6b2e-8d4f-4e0b-a1c2-7f3e5d9b1a20", VerdictAccepted, "actor has a public key", ""},
+		{"misskey poll", "/users/9abcdefghi", "/notes/9xyz000001", VerdictAccepted, "supported status type", ""},
+		{"someone else's note", "/users/lain", "/users/ada/statuses/111/activity", VerdictInvalid, "fetch object", "object attributed to the actor"},
+		{"no such actor", "/users/nobody", "", VerdictInvalid, "", "fetch actor"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			s, _ := newTestService(t)
+			var objectIRI *url.URL
+			if test.object != "" {
+				objectIRI = mustParse(t, origin+test.object)
+			}
+			report := s.ValidateRemote(c, mustParse(t, origin+test.actor), objectIRI)
+			if report.Verdict != test.verdict {
+				t.Errorf("verdict %s, want %s: %+v", report.Verdict, test.verdict, report.Checks)
+			}
+			ran := map[string]bool{}
+			for _, check := range report.Checks {
+				ran[check.Name] = check.OK
+			}
+			if ok, found := ran[test.passed]; test.passed != "" && (!found || !ok) {
+				t.Errorf("check %q didn't pass: %+v", test.passed, report.Checks)
+			}
+			if ok, found := ran[test.failed]; test.failed != "" && (!found || ok) {
+				t.Errorf("check %q didn't fail: %+v", test.failed, report.Checks)
+			}
+			if test.object == "" && test.verdict == VerdictAccepted && report.Object == nil {
+				t.Error("found no object in the outbox")
+			}
+		})
+	}
+
+	t.Run("blocked", func(t *testing.T) {
+		s, _ := newTestService(t)
+		actorIRI := mustParse(t, origin+"/users/ada")
+		s.db.SetSuspended(actorIRI, true)
+		if report := s.ValidateRemote(c, actorIRI, nil); report.Verdict != VerdictBlocked {
+			t.Errorf("verdict %s, want %s", report.Verdict, VerdictBlocked)
+		}
+	})
+}
@@ -0,0 +1,251 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jrd is the subset of a WebFinger JSON Resource Descriptor we care about.
+type jrd struct {
+	Subject string    `json:"subject"`
+	Aliases []string  `json:"aliases"`
+	Links   []jrdLink `json:"links"`
+}
+
+type jrdLink struct {
+	Rel  string `json:"rel"`
+	Type string `json:"type"`
+	Href string `json:"href"`
+}
+
+// AccountDomain is the domain in our users' handles. It is usually the one
+// our actors live on, but may be a separate one such as the web UI's.
+func (s *Service) AccountDomain() string {
+	if s.config.AccountDomain != "" {
+		return s.config.AccountDomain
+	}
+	return s.db.Hostname()
+}
+
+// isLocalAcctDomain reports whether handles on `domain` are ours.
+func (s *Service) isLocalAcctDomain(domain string) bool {
+	return domain == "" ||
+		strings.EqualFold(domain, s.AccountDomain()) ||
+		s.db.IsLocalHost(domain)
+}
+
+// splitAcct turns `@user@domain`, `user@domain` or `acct:user@domain` into
+// its username and domain. The domain is empty for local accounts.
+func splitAcct(acct string) (username, domain string) {
+	acct = strings.TrimPrefix(strings.TrimSpace(acct), "acct:")
+	acct = strings.TrimPrefix(acct, "@")
+	username, domain, _ = strings.Cut(acct, "@")
+	return username, strings.ToLower(domain)
+}
+
+// errNoSuchAccount is returned by webFinger when the peer says there's no
+// such account, rather than failing to answer.
+var errNoSuchAccount = errors.New("no such account")
+
+// webFingerResult is what a WebFinger lookup of a remote account came to,
+// cached until `expires`. A nil `actorIRI` means there's no such account.
+type webFingerResult struct {
+	actorIRI *url.URL
+	expires  time.Time
+}
+
+// webFingerCache holds remote accounts' WebFinger lookups, keyed by
+// lower-cased `user@domain`, along with the keys that came to each actor so
+// that they can be dropped when it moves.
+type webFingerCache struct {
+	mu      sync.Mutex
+	results map[string]webFingerResult
+	// Keyed by actor IRI.
+	accts map[string]map[string]bool
+}
+
+// Load returns the lookup cached for `key`, if any, expired or not.
+func (w *webFingerCache) Load(key string) (webFingerResult, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	r, ok := w.results[key]
+	return r, ok
+}
+
+// Store caches `r` as the lookup for `key`.
+func (w *webFingerCache) Store(key string, r webFingerResult) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.results == nil {
+		w.results = make(map[string]webFingerResult)
+		w.accts = make(map[string]map[string]bool)
+	}
+	w.unindex(key)
+	w.results[key] = r
+	if r.actorIRI != nil {
+		accts := w.accts[r.actorIRI.String()]
+		if accts == nil {
+			accts = make(map[string]bool)
+			w.accts[r.actorIRI.String()] = accts
+		}
+		accts[key] = true
+	}
+}
+
+// Forget drops the lookups that came to the actor at `actorIRI`.
+func (w *webFingerCache) Forget(actorIRI *url.URL) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for key := range w.accts[actorIRI.String()] {
+		delete(w.results, key)
+	}
+	delete(w.accts, actorIRI.String())
+}
+
+// unindex drops `key` from the keys of the actor it was cached as coming
+// to. `w.mu` must be held.
+func (w *webFingerCache) unindex(key string) {
+	old, ok := w.results[key]
+	if !ok || old.actorIRI == nil {
+		return
+	}
+	accts := w.accts[old.actorIRI.String()]
+	delete(accts, key)
+	if len(accts) == 0 {
+		delete(w.accts, old.actorIRI.String())
+	}
+}
+
+// ResolveAccount finds the actor IRI of an account given as `user@domain`,
+// asking the domain's WebFinger endpoint for remote accounts. Answers are
+// cached for Config.WebFingerCacheTTL, and accounts found not to exist for
+// Config.WebFingerNegativeTTL.
+func (s *Service) ResolveAccount(c context.Context, acct string) (*url.URL, error) {
+	username, domain := splitAcct(acct)
+	if username == "" {
+		return nil, errors.New("empty username")
+	}
+	if s.isLocalAcctDomain(domain) {
+		return s.db.ActorForUsername(c, username)
+	}
+	key := strings.ToLower(username) + "@" + domain
+	if r, ok := s.webFingers.Load(key); ok && s.Now().Before(r.expires) {
+		if actorIRI := r.actorIRI; actorIRI != nil {
+			return actorIRI, nil
+		}
+		return nil, fmt.Errorf("webfinger for %s: %w", acct, errNoSuchAccount)
+	}
+	v, err := s.webFingerLookups.do(key, func() (interface{}, error) {
+		actorIRI, err := s.webFinger(c, username, domain)
+		switch {
+		case err == nil && s.config.WebFingerCacheTTL > 0:
+			s.webFingers.Store(key, webFingerResult{actorIRI, s.Now().Add(s.config.WebFingerCacheTTL)})
+		case errors.Is(err, errNoSuchAccount) && s.config.WebFingerNegativeTTL > 0:
+			s.webFingers.Store(key, webFingerResult{nil, s.Now().Add(s.config.WebFingerNegativeTTL)})
+		}
+		return actorIRI, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*url.URL), nil
+}
+
+// forgetWebFingers drops the cached lookups that came to the actor at
+// `actorIRI`, such as when it moves.
+func (s *Service) forgetWebFingers(actorIRI *url.URL) {
+	s.webFingers.Forget(actorIRI)
+}
+
+// webFinger asks `domain` for the actor IRI of its account `username`.
+func (s *Service) webFinger(c context.Context, username, domain string) (*url.URL, error) {
+	acct := username + "@" + domain
+	u := &url.URL{
+		Scheme:   "https",
+		Host:     domain,
+		Path:     "/.well-known/webfinger",
+		RawQuery: url.Values{"resource": {"acct:" + acct}}.Encode(),
+	}
+	req, err := http.NewRequestWithContext(c, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/jrd+json")
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+		return nil, fmt.Errorf("webfinger for %s: %w", acct, errNoSuchAccount)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("webfinger for %s: %s", acct, resp.Status)
+	}
+	b, err := s.readResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+	var j jrd
+	if err := json.Unmarshal(b, &j); err != nil {
+		return nil, err
+	}
+	for _, link := range j.Links {
+		if link.Rel == "self" && isActivityStreamsMediaType(link.Type) {
+			return url.Parse(link.Href)
+		}
+	}
+	return nil, fmt.Errorf("webfinger for %s: no ActivityPub actor", acct)
+}
+
+// serveWebFinger answers WebFinger lookups of our local accounts, whichever
+// of our domains the handle is on, with the actor on our ActivityPub domain.
+func (s *Service) serveWebFinger(w http.ResponseWriter, r *http.Request) {
+	resource := r.URL.Query().Get("resource")
+	if resource == "" {
+		WriteError(w, &ParseError{errors.New("missing resource")})
+		return
+	}
+	var actorIRI *url.URL
+	var err error
+	if u, perr := url.Parse(resource); perr == nil && u.Scheme == "https" {
+		// Lookups may also be by actor IRI.
+		if _, err = s.db.Get(r.Context(), u); err == nil && s.db.IsLocalHost(u.Host) {
+			actorIRI = u
+		}
+	} else if username, domain := splitAcct(resource); username != "" && domain != "" && s.isLocalAcctDomain(domain) {
+		actorIRI, err = s.db.ActorForUsername(r.Context(), username)
+	}
+	if actorIRI == nil || err != nil {
+		WriteError(w, ErrNotFound)
+		return
+	}
+	username, _, _ := strings.Cut(strings.TrimPrefix(actorIRI.Path, "/users/"), "/")
+	j := jrd{
+		Subject: "acct:" + username + "@" + s.AccountDomain(),
+		Aliases: []string{actorIRI.String()},
+		Links: []jrdLink{{
+			Rel:  "self",
+			Type: mediaTypeActivityJSON,
+			Href: actorIRI.String(),
+		}},
+	}
+	b, err := json.Marshal(j)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/jrd+json")
+	w.Write(b)
+}
@@ -0,0 +1,169 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// Handles may be on another domain than our actors, such as the web UI's.
+func TestWebFingerAccountDomain(t *testing.T) {
+	s, _ := newTestService(t)
+	s.config.AccountDomain = "example.test"
+	aliceIRI := register(t, s, "alice")
+	if s.AccountDomain() != "example.test" {
+		t.Errorf("account domain %s", s.AccountDomain())
+	}
+
+	for _, resource := range []string{"acct:alice@example.test", "alice@example.test", "acct:alice@" + testHostname, aliceIRI.String()} {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/.well-known/webfinger?resource="+url.QueryEscape(resource), nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("looking up %s: %d %s", resource, w.Code, w.Body)
+			continue
+		}
+		var j jrd
+		if err := json.Unmarshal(w.Body.Bytes(), &j); err != nil {
+			t.Fatal(err)
+		}
+		if j.Subject != "acct:alice@example.test" {
+			t.Errorf("looking up %s: subject %s", resource, j.Subject)
+		}
+		if len(j.Links) != 1 || j.Links[0].Rel != "self" || j.Links[0].Href != aliceIRI.String() || !isActivityStreamsMediaType(j.Links[0].Type) {
+			t.Errorf("looking up %s: links %+v", resource, j.Links)
+		}
+	}
+
+	for resource, status := range map[string]int{
+		"":                              http.StatusBadRequest,
+		"acct:alice@remote.test":        http.StatusNotFound,
+		"acct:nobody@example.test":      http.StatusNotFound,
+		"https://remote.test/users/x":   http.StatusNotFound,
+		"https://" + testHostname + "/": http.StatusNotFound,
+	} {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/.well-known/webfinger?resource="+url.QueryEscape(resource), nil))
+		if w.Code != status {
+			t.Errorf("looking up %q: %d, want %d", resource, w.Code, status)
+		}
+	}
+
+	// Handles on either domain resolve without asking anyone.
+	for _, acct := range []string{"@alice@example.test", "alice@" + testHostname, "alice"} {
+		if got, err := s.ResolveAccount(context.Background(), acct); err != nil || got.String() != aliceIRI.String() {
+			t.Errorf("resolving %s: %v, %v", acct, got, err)
+		}
+	}
+}
+
+// serving is an http.RoundTripper answering every request with `h`, for
+// talking to made-up peers over plain HTTP.
+type serving struct {
+	h http.Handler
+}
+
+func (s serving) RoundTrip(r *http.Request) (*http.Response, error) {
+	w := httptest.NewRecorder()
+	s.h.ServeHTTP(w, r)
+	resp := w.Result()
+	resp.Request = r
+	return resp, nil
+}
+
+func TestResolveAccountCached(t *testing.T) {
+	c := context.Background()
+	s, transport := newTestService(t)
+	clock := &testClock{now: time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)}
+	s.SetClock(clock)
+	aliceIRI := register(t, s, "alice")
+	bob := newTestPeer(t, transport, "https://remote.test/users/bob", "rsa")
+	// What remote.test's WebFinger answers for each account, and how often
+	// it was asked.
+	answers := map[string]int{"bob": http.StatusOK, "gone": http.StatusGone, "nobody": http.StatusNotFound, "broken": http.StatusInternalServerError}
+	lookups := make(map[string]int)
+	s.client = &http.Client{Transport: serving{http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, _ := splitAcct(r.URL.Query().Get("resource"))
+		lookups[username]++
+		if status := answers[username]; status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		json.NewEncoder(w).Encode(jrd{
+			Subject: "acct:" + username + "@remote.test",
+			Links:   []jrdLink{{Rel: "self", Type: mediaTypeActivityJSON, Href: "https://remote.test/users/" + username}},
+		})
+	})}}
+	resolve := func(acct string) (*url.URL, error) {
+		t.Helper()
+		actorIRI, err := s.ResolveAccount(c, acct)
+		if err == nil && actorIRI.String() != bob.iri.String() {
+			t.Errorf("resolved %s to %s", acct, actorIRI)
+		}
+		return actorIRI, err
+	}
+
+	// Asked once, and then answered from the cache, whatever the case.
+	for _, acct := range []string{"@bob@remote.test", "bob@REMOTE.test", "Bob@remote.test"} {
+		if _, err := resolve(acct); err != nil {
+			t.Fatalf("resolving %s: %s", acct, err)
+		}
+	}
+	if lookups["bob"] != 1 {
+		t.Errorf("looked bob up %d times, want once", lookups["bob"])
+	}
+	// Until the answer expires.
+	clock.Advance(s.config.WebFingerCacheTTL)
+	resolve("bob@remote.test")
+	if lookups["bob"] != 2 {
+		t.Errorf("looked bob up %d times once the answer expired, want twice", lookups["bob"])
+	}
+
+	// Accounts that don't exist are remembered not to for a while, but not
+	// accounts the peer failed to answer for.
+	for _, username := range []string{"gone", "nobody", "broken"} {
+		for i := 0; i < 2; i++ {
+			if _, err := resolve(username + "@remote.test"); err == nil {
+				t.Errorf("resolved %s", username)
+			}
+		}
+	}
+	if lookups["gone"] != 1 || lookups["nobody"] != 1 {
+		t.Errorf("looked up missing accounts %d and %d times, want once", lookups["gone"], lookups["nobody"])
+	}
+	if lookups["broken"] != 2 {
+		t.Errorf("looked up a failing account %d times, want twice", lookups["broken"])
+	}
+	clock.Advance(s.config.WebFingerNegativeTTL)
+	resolve("nobody@remote.test")
+	if lookups["nobody"] != 2 {
+		t.Errorf("looked up a missing account %d times once it expired, want twice", lookups["nobody"])
+	}
+
+	// Once bob moves, their handles are looked up afresh.
+	resolve("bob@remote.test")
+	s.webFingers.Store("bob@alias.test", webFingerResult{bob.iri, s.Now().Add(time.Hour)})
+	deliver(t, s, bob, s.boxIRI(aliceIRI, "inbox"), map[string]interface{}{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id":       "https://remote.test/users/bob#moves/1",
+		"type":     "Move",
+		"actor":    bob.iri.String(),
+		"object":   bob.iri.String(),
+		"target":   "https://new.test/users/bob",
+	})
+	for _, key := range []string{"bob@remote.test", "bob@alias.test"} {
+		if _, ok := s.webFingers.Load(key); ok {
+			t.Errorf("still cached %s after bob moved", key)
+		}
+	}
+	resolve("bob@remote.test")
+	if lookups["bob"] != 3 {
+		t.Errorf("looked bob up %d times after moving, want 3", lookups["bob"])
+	}
+}
@@ -0,0 +1,66 @@
+/* SPDX-FileCopyrightText: © Capsule Social, Inc. <nadim@capsule.social>
+ * SPDX-License-Identifier: AGPL-3.0-only */
+
+package testserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"mastogon/internal/api"
+
+	"github.com/go-fed/activity/streams"
+)
+
+// TestSmoke has a peer follow a local user, who then posts, and checks the
+// peer is sent the post and it's on the user's home timeline.
+func TestSmoke(t *testing.T) {
+	ts := NewTestServer(t)
+	aliceIRI, token := ts.Register("alice")
+	bob := ts.AddRemoteActor("https://remote.test/users/bob")
+
+	follow := streams.NewActivityStreamsFollow()
+	id := streams.NewJSONLDIdProperty()
+	id.Set(bob.IRI.JoinPath("follows", "1"))
+	follow.SetJSONLDId(id)
+	actor := streams.NewActivityStreamsActorProperty()
+	actor.AppendIRI(bob.IRI)
+	follow.SetActivityStreamsActor(actor)
+	object := streams.NewActivityStreamsObjectProperty()
+	object.AppendIRI(aliceIRI)
+	follow.SetActivityStreamsObject(object)
+	ts.Inject(bob, aliceIRI.JoinPath("inbox"), follow)
+	if !sentTo(ts, bob.Inbox, "Accept") {
+		t.Fatal("follow not accepted")
+	}
+
+	var posted api.Status
+	if code := ts.Call(http.MethodPost, "/api/v1/statuses", token, url.Values{"status": {"hello"}}, &posted); code != http.StatusOK {
+		t.Fatalf("posting: %d", code)
+	}
+	if !sentTo(ts, bob.Inbox, "Create") {
+		t.Error("post not delivered to the follower")
+	}
+
+	var home []api.Status
+	if code := ts.Call(http.MethodGet, "/api/v1/timelines/home", token, nil, &home); code != http.StatusOK {
+		t.Fatalf("getting the home timeline: %d", code)
+	}
+	if len(home) != 1 || home[0].URI != posted.URI {
+		t.Errorf("home timeline = %+v, want the post %s", home, posted.URI)
+	}
+}
+
+// sentTo reports whether an activity of type `activityType` was delivered
+// to `inbox`.
+func sentTo(ts *TestServer, inbox *url.URL, activityType string) bool {
+	for _, d := range ts.Transport.Delivered() {
+		var m map[string]interface{}
+		if json.Unmarshal(d.Body, &m) == nil && d.To.String() == inbox.String() && m["type"] == activityType {
+			return true
+		}
+	}
+	return false
+}
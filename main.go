@@ -4,7 +4,7 @@ Copyright © 2022 NAME HERE <EMAIL ADDRESS>
 */
 package main
 
-import "mastogon/cmd"
+import cmd "mastogon/cmd/mastogon"
 
 func main() {
 	cmd.Execute()